@@ -31,6 +31,7 @@ func usage(fset *flag.FlagSet) {
 - Create/Drop
     cbindex -auth user:pass -type create -bucket default -using memdb -index first_name -fields=first_name,last_name
     cbindex -auth user:pass -type create -bucket default -primary=true -index primary
+    cbindex -auth user:pass -type create -bucket default -scope s1 -collection c1 -index age -fields=age
     cbindex -auth user:pass -type drop -instanceid 1234
 
 - List
@@ -0,0 +1,154 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+// cbindexverify verifies an index against the documents in its bucket,
+// and optionally repairs documents found inconsistent.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/couchbase/cbauth"
+	c "github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/common/json"
+	"github.com/couchbase/indexing/secondary/logging"
+	qclient "github.com/couchbase/indexing/secondary/queryport/client"
+	"github.com/couchbase/indexing/secondary/verifier"
+)
+
+var options struct {
+	bucket   string
+	index    string
+	auth     string
+	numConns int
+	repair   bool
+	json     bool
+	info     bool
+	debug    bool
+}
+
+func argParse() string {
+	flag.StringVar(&options.bucket, "bucket", "default",
+		"bucket of the index")
+	flag.StringVar(&options.index, "index", "",
+		"name of the index to verify")
+	flag.StringVar(&options.auth, "auth", "",
+		"Auth user and password")
+	flag.IntVar(&options.numConns, "numconns", 4,
+		"number of DCP connections per kv-node")
+	flag.BoolVar(&options.repair, "repair", false,
+		"re-inject mutations for documents that are inconsistent")
+	flag.BoolVar(&options.json, "json", false,
+		"print report as JSON")
+	flag.BoolVar(&options.info, "info", false,
+		"display informational logs")
+	flag.BoolVar(&options.debug, "debug", false,
+		"display debug logs")
+
+	flag.Parse()
+
+	if options.debug {
+		logging.SetLogLevel(logging.Debug)
+	} else if options.info {
+		logging.SetLogLevel(logging.Info)
+	} else {
+		logging.SetLogLevel(logging.Warn)
+	}
+
+	args := flag.Args()
+	if len(args) < 1 || options.index == "" {
+		usage()
+		os.Exit(2)
+	}
+	return args[0]
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage : %s [OPTIONS] -index <name> <cluster-addr> \n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	cluster := argParse()
+
+	if options.auth != "" {
+		up := strings.Split(options.auth, ":")
+		if _, err := cbauth.InternalRetryDefaultInit(cluster, up[0], up[1]); err != nil {
+			logging.Fatalf("Failed to initialize cbauth: %s", err)
+			os.Exit(2)
+		}
+	}
+
+	b, err := c.ConnectBucket(cluster, "default", options.bucket)
+	mf(err, "bucket")
+	defer b.Close()
+
+	config := c.SystemConfig.SectionConfig("queryport.client.", true)
+	client, err := qclient.NewGsiClient(cluster, config)
+	mf(err, "gsi client")
+	defer client.Close()
+
+	dcpConfig := verifier.DefaultDcpConfig()
+	dcpConfig["numConnections"] = options.numConns
+	report, err := verifier.Verify(client, b, &verifier.Config{
+		Bucket:    options.bucket,
+		Index:     options.index,
+		DcpConfig: dcpConfig,
+	})
+	mf(err, "verify")
+
+	if options.json {
+		data, err := json.MarshalIndent(report, "", "  ")
+		mf(err, "report")
+		fmt.Println(string(data))
+	} else {
+		printReport(report)
+	}
+
+	if options.repair && !report.Consistent() {
+		n, err := verifier.Repair(b, report)
+		mf(err, "repair")
+		fmt.Fprintf(os.Stderr, "Repaired %v of %v documents\n", n, len(report.DocIds()))
+	}
+
+	if !report.Consistent() {
+		os.Exit(1)
+	}
+}
+
+func printReport(r *verifier.Report) {
+	fmt.Printf("Index %v:%v\n", r.Bucket, r.Index)
+	fmt.Printf("  documents to index : %v\n", r.NumDocs)
+	fmt.Printf("  documents indexed  : %v\n", r.NumIndexed)
+	fmt.Printf("  skipped (mutated)  : %v\n", r.NumSkipped)
+	fmt.Printf("  missing            : %v\n", len(r.Missing))
+	fmt.Printf("  extra              : %v\n", len(r.Extra))
+	fmt.Printf("  mismatched         : %v\n", len(r.Mismatched))
+	fmt.Printf("  elapsed            : %v\n", r.Elapsed)
+
+	for _, e := range r.Missing {
+		fmt.Printf("missing    %q %v\n", e.DocId, e.Keys)
+	}
+	for _, e := range r.Extra {
+		fmt.Printf("extra      %q %v\n", e.DocId, e.Keys)
+	}
+	for _, m := range r.Mismatched {
+		fmt.Printf("mismatched %q expected:%v actual:%v\n", m.DocId, m.Expected, m.Actual)
+	}
+}
+
+func mf(err error, msg string) {
+	if err != nil {
+		logging.Fatalf("%v: %v", msg, err)
+		os.Exit(2)
+	}
+}
@@ -63,6 +63,7 @@ func main() {
 	}
 
 	logging.SetLogLevel(logging.Level(*logLevel))
+	logging.SetComponent("indexer")
 	forestdb.Log = &logging.SystemLogger
 
 	// setup cbauth
@@ -89,6 +89,7 @@ func main() {
 		logging.SetLogWriter(f)
 		config.SetValue("log.file", f.Name())
 	}
+	logging.SetComponent("projector")
 	config.SetValue("projector.clusterAddr", cluster)
 	config.SetValue("projector.adminport.listenAddr", options.adminport)
 	config.SetValue("projector.diagnostics_dir", options.diagDir)
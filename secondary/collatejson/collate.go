@@ -88,6 +88,8 @@ type Codec struct {
 	propertyLenPrefix bool        // if true, first sort properties based on length
 	doMissing         bool        // if true, handle missing values (for N1QL)
 	numberType        interface{} // "float64" | "int64" | "decimal"
+	collator          Collator    // if not nil, collate strings, see collation.go
+	keyCodecs         []*Codec    // codec for each key of secondary key
 	//-- unicode
 	//backwards        bool
 	//hiraganaQ        bool
@@ -238,6 +240,8 @@ func (codec *Codec) json2code(val interface{}, code []byte) ([]byte, error) {
 		if codec.doMissing && MissingLiteral.Equal(value) {
 			code = append(code, TypeMissing)
 			code = append(code, Terminator)
+		} else if codec.collator != nil {
+			code = codec.collateString([]byte(value), code)
 		} else {
 			code = append(code, TypeString)
 			cs = suffixEncodeString([]byte(value), code[1:])
@@ -254,9 +258,9 @@ func (codec *Codec) json2code(val interface{}, code []byte) ([]byte, error) {
 			}
 		}
 		if err == nil {
-			for _, val := range value {
+			for i, val := range value {
 				l := len(code)
-				cs, err = codec.json2code(val, code[l:])
+				cs, err = codec.elemCodec(i).json2code(val, code[l:])
 				if err == nil {
 					code = code[:l+len(cs)]
 					continue
@@ -280,13 +284,13 @@ func (codec *Codec) json2code(val interface{}, code []byte) ([]byte, error) {
 			for _, key := range keys {
 				l := len(code)
 				// encode key
-				if cs, err = codec.json2code(key, code[l:]); err != nil {
+				if cs, err = codec.elemCodec(-1).json2code(key, code[l:]); err != nil {
 					break
 				}
 				code = code[:l+len(cs)]
 				l = len(code)
 				// encode value
-				if cs, err = codec.json2code(value[key], code[l:]); err != nil {
+				if cs, err = codec.elemCodec(-1).json2code(value[key], code[l:]); err != nil {
 					break
 				}
 				code = code[:l+len(cs)]
@@ -350,7 +354,13 @@ func (codec *Codec) code2json(code, text []byte) ([]byte, []byte, error) {
 	case TypeString:
 		var strb []byte
 		tmp := bufPool.Get().(*[]byte)
-		strb, remaining, err = suffixDecodeString(code[1:], (*tmp)[:0])
+		code = code[1:]
+		if code[0] == collatedString {
+			code, err = skipCollationKey(code)
+		}
+		if err == nil {
+			strb, remaining, err = suffixDecodeString(code, (*tmp)[:0])
+		}
 		if err == nil {
 			text, err = encodeString(strb, text)
 			bufPool.Put(tmp)
@@ -551,8 +561,12 @@ func (codec *Codec) n1ql2code(val n1ql.Value, code []byte) ([]byte, error) {
 			code = append(code, Terminator)
 		}
 	case n1ql.STRING:
-		code = append(code, TypeString)
 		act := val.ActualForIndex().(string)
+		if codec.collator != nil {
+			code = codec.collateString([]byte(act), code)
+			break
+		}
+		code = append(code, TypeString)
 		cs = suffixEncodeString([]byte(act), code[1:])
 		code = code[:len(code)+len(cs)]
 		code = append(code, Terminator)
@@ -569,9 +583,9 @@ func (codec *Codec) n1ql2code(val n1ql.Value, code []byte) ([]byte, error) {
 			}
 		}
 		if err == nil {
-			for _, val := range act {
+			for i, val := range act {
 				l := len(code)
-				cs, err = codec.n1ql2code(n1ql.NewValue(val), code[l:])
+				cs, err = codec.elemCodec(i).n1ql2code(n1ql.NewValue(val), code[l:])
 				if err == nil {
 					code = code[:l+len(cs)]
 					continue
@@ -595,13 +609,13 @@ func (codec *Codec) n1ql2code(val n1ql.Value, code []byte) ([]byte, error) {
 			for _, key := range keys {
 				l := len(code)
 				// encode key
-				if cs, err = codec.n1ql2code(n1ql.NewValue(key), code[l:]); err != nil {
+				if cs, err = codec.elemCodec(-1).n1ql2code(n1ql.NewValue(key), code[l:]); err != nil {
 					break
 				}
 				code = code[:l+len(cs)]
 				l = len(code)
 				// encode value
-				if cs, err = codec.n1ql2code(n1ql.NewValue(act[key]), code[l:]); err != nil {
+				if cs, err = codec.elemCodec(-1).n1ql2code(n1ql.NewValue(act[key]), code[l:]); err != nil {
 					break
 				}
 				code = code[:l+len(cs)]
@@ -863,7 +877,13 @@ func (codec *Codec) code2n1ql(code, text []byte, decode bool) (n1ql.Value, []byt
 
 	case TypeString:
 		var strb []byte
-		strb, remaining, err = suffixDecodeString(code[1:], text)
+		code = code[1:]
+		if code[0] == collatedString {
+			code, err = skipCollationKey(code)
+		}
+		if err == nil {
+			strb, remaining, err = suffixDecodeString(code, text)
+		}
 		if decode && err == nil {
 			n1qlVal = n1ql.NewValue(string(strb))
 		}
@@ -1105,6 +1125,12 @@ func (codec *Codec) fixEncodedInt(code, text []byte) ([]byte, []byte, error) {
 
 	case TypeString:
 		datum, remaining, err = getStringDatum(code)
+		if err == nil && isCollatedString(code) {
+			// binary value follows collation key.
+			var value []byte
+			value, remaining, err = getStringDatum(remaining)
+			datum = code[:len(datum)+1+len(value)]
+		}
 		text = append(text, datum...)
 		text = append(text, Terminator)
 
@@ -0,0 +1,268 @@
+package collatejson
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	json "github.com/couchbase/indexing/secondary/common/json"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Collation of strings in an index key.
+const (
+	// CollationBinary orders strings by their UTF-8 bytes, default.
+	CollationBinary = "binary"
+	// CollationNoCase orders strings by their case folded UTF-8 bytes.
+	CollationNoCase = "nocase"
+	// CollationUnicode orders strings by the Unicode collation algorithm,
+	// optionally tailored to a language as "unicode:<language tag>".
+	CollationUnicode = "unicode"
+)
+
+// ErrInvalidCollation means collation name is not supported.
+var ErrInvalidCollation = errors.New("collatejson.invalidCollation")
+
+// collatedString follows TypeString for strings encoded with their
+// collation key. 0xFE never occurs in UTF-8 text, hence it does not clash
+// with the first byte of a string in binary collation.
+const collatedString byte = 0xFE
+
+// Collator computes the collation key of strings. Collated strings are
+// ordered by their collation key and then by their binary value, so
+// that the order is total and strings decode back as is.
+type Collator interface {
+	// Key appends the collation key of UTF-8 text `s` to `buf`.
+	Key(buf, s []byte) []byte
+
+	// Name of the collation.
+	Name() string
+}
+
+var collators = struct {
+	sync.RWMutex
+	byName map[string]Collator
+}{byName: make(map[string]Collator)}
+
+// NewCollator returns the collator for `collation`, one of "binary",
+// "nocase", "unicode" or "unicode:<language tag>" like "unicode:de".
+// Binary collation, also for empty string, is a nil Collator.
+// Collators are shared and safe for concurrent use.
+func NewCollator(collation string) (Collator, error) {
+	name := strings.ToLower(strings.TrimSpace(collation))
+	if name == "" || name == CollationBinary {
+		return nil, nil
+	}
+	collators.RLock()
+	c, ok := collators.byName[name]
+	collators.RUnlock()
+	if ok {
+		return c, nil
+	}
+
+	switch {
+	case name == CollationNoCase:
+		c = nocaseCollator{}
+
+	case name == CollationUnicode:
+		c = newUnicodeCollator(name, language.Und)
+
+	case strings.HasPrefix(name, CollationUnicode+":"):
+		tag, err := language.Parse(name[len(CollationUnicode)+1:])
+		if err != nil {
+			return nil, ErrInvalidCollation
+		}
+		c = newUnicodeCollator(name, tag)
+
+	default:
+		return nil, ErrInvalidCollation
+	}
+
+	collators.Lock()
+	defer collators.Unlock()
+	if actual, ok := collators.byName[name]; ok {
+		return actual, nil
+	}
+	collators.byName[name] = c
+	return c, nil
+}
+
+// nocaseCollator folds the case of each rune.
+type nocaseCollator struct{}
+
+func (nocaseCollator) Key(buf, s []byte) []byte {
+	var scratch [utf8.UTFMax]byte
+	for len(s) > 0 {
+		if s[0] < utf8.RuneSelf {
+			x := s[0]
+			if 'A' <= x && x <= 'Z' {
+				x += 'a' - 'A'
+			}
+			buf, s = append(buf, x), s[1:]
+			continue
+		}
+		r, n := utf8.DecodeRune(s)
+		if r == utf8.RuneError && n == 1 {
+			buf = append(buf, s[0])
+		} else {
+			m := utf8.EncodeRune(scratch[:], unicode.ToLower(unicode.ToUpper(r)))
+			buf = append(buf, scratch[:m]...)
+		}
+		s = s[n:]
+	}
+	return buf
+}
+
+func (nocaseCollator) Name() string {
+	return CollationNoCase
+}
+
+// unicodeCollator uses a pool of collate.Collator, which is not safe
+// for concurrent use.
+type unicodeCollator struct {
+	name string
+	pool sync.Pool
+}
+
+func newUnicodeCollator(name string, tag language.Tag) *unicodeCollator {
+	c := &unicodeCollator{name: name}
+	c.pool.New = func() interface{} {
+		return collate.New(tag)
+	}
+	return c
+}
+
+func (c *unicodeCollator) Key(buf, s []byte) []byte {
+	var kb collate.Buffer
+	coll := c.pool.Get().(*collate.Collator)
+	buf = append(buf, coll.Key(&kb, s)...)
+	c.pool.Put(coll)
+	return buf
+}
+
+func (c *unicodeCollator) Name() string {
+	return c.name
+}
+
+// CollateStrings encodes all strings with their collation key as per
+// `collator`, nil for binary collation.
+func (codec *Codec) CollateStrings(collator Collator) {
+	codec.collator = collator
+}
+
+// CollateKeys encodes strings in the i-th element of the top-level
+// array, that is the i-th key of a secondary key, as per `collators[i]`.
+// Call after other options of the codec are set.
+func (codec *Codec) CollateKeys(collators []Collator) {
+	codec.keyCodecs = nil
+	for _, collator := range collators {
+		if collator != nil {
+			codec.keyCodecs = make([]*Codec, 0, len(collators)+1)
+			break
+		}
+	}
+	if codec.keyCodecs == nil {
+		return
+	}
+	// codec for each key, and a binary codec for the rest.
+	for _, collator := range append(collators, nil) {
+		keyCodec := *codec
+		keyCodec.keyCodecs, keyCodec.collator = nil, collator
+		codec.keyCodecs = append(codec.keyCodecs, &keyCodec)
+	}
+}
+
+// elemCodec returns the codec to encode the i-th element of an array,
+// i < 0 for property of an object.
+func (codec *Codec) elemCodec(i int) *Codec {
+	n := len(codec.keyCodecs)
+	if n == 0 {
+		return codec
+	} else if i < 0 || i >= n-1 {
+		return codec.keyCodecs[n-1]
+	}
+	return codec.keyCodecs[i]
+}
+
+// collateString encodes `s` as
+//
+//	TypeString, collatedString, key, Terminator, Terminator,
+//	s, Terminator, Terminator
+//
+// key and s are suffix encoded like strings in binary collation.
+func (codec *Codec) collateString(s []byte, code []byte) []byte {
+	code = codec.collationKey(s, code)
+	code = suffixEncodeString(s, code)
+	return append(code, Terminator)
+}
+
+func (codec *Codec) collationKey(s []byte, code []byte) []byte {
+	code = append(code, TypeString, collatedString)
+	tmp := bufPool.Get().(*[]byte)
+	key := codec.collator.Key((*tmp)[:0], s)
+	code = suffixEncodeString(key, code)
+	bufPool.Put(tmp)
+	return append(code, Terminator)
+}
+
+// isCollatedString returns true if `code`, starting with TypeString or
+// its reverse, is a string encoded with its collation key.
+func isCollatedString(code []byte) bool {
+	if len(code) < 2 {
+		return false
+	}
+	return (code[0] == TypeString && code[1] == collatedString) ||
+		(code[0] == ^TypeString && code[1] == ^collatedString)
+}
+
+// skipCollationKey of collated string `code`, following TypeString,
+// returns the code of its binary value.
+func skipCollationKey(code []byte) ([]byte, error) {
+	_, remaining, err := getEncodedString(code[1:])
+	return remaining, err
+}
+
+// EncodeBound encodes `text`, JSON value of low or high bound for a
+// range on keys collated by the codec. A string bound is encoded with its
+// collation key and the least or the greatest binary value, `upper`, so
+// that the range can include or exclude all the strings having the same
+// collation key. Other values are encoded as is.
+func (codec *Codec) EncodeBound(text, code []byte, upper bool) (bs []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if strings.Contains(fmt.Sprint(r), "slice bounds out of range") {
+				err = ErrorOutputLen
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+
+	code = code[:0]
+	if cap(code) < (3*len(text)) || cap(code) < MinBufferSize {
+		return nil, ErrorOutputLen
+	} else if len(text) == 0 {
+		return code, nil
+	}
+	var m interface{}
+	if err := json.Unmarshal(text, &m); err != nil {
+		return nil, err
+	}
+
+	s, ok := m.(string)
+	if !ok || codec.collator == nil || (codec.doMissing && MissingLiteral.Equal(s)) {
+		return codec.json2code(m, code)
+	}
+	code = codec.collationKey([]byte(s), code)
+	if upper {
+		// greater than any UTF-8 text.
+		code = suffixEncodeString([]byte{0xFF}, code)
+	} else {
+		code = suffixEncodeString(nil, code)
+	}
+	return append(code, Terminator), nil
+}
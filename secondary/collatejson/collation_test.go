@@ -0,0 +1,156 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+
+package collatejson
+
+import "bytes"
+import "sort"
+import "testing"
+
+import "github.com/couchbase/indexing/secondary/collatejson/util"
+
+func encodeCollated(t *testing.T, codec *Codec, texts []string) [][]byte {
+	codes := make([][]byte, 0, len(texts))
+	for _, text := range texts {
+		code, err := codec.Encode([]byte(text), make([]byte, 0, 1024))
+		if err != nil {
+			t.Fatalf("encode %v: %v", text, err)
+		}
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+func decodeCollated(t *testing.T, codec *Codec, code []byte) string {
+	text, err := codec.Decode(code, make([]byte, 0, 1024))
+	if err != nil {
+		t.Fatalf("decode %v: %v", code, err)
+	}
+	return string(text)
+}
+
+func TestCollateNoCase(t *testing.T) {
+	collator, err := NewCollator("NoCase")
+	if err != nil || collator == nil {
+		t.Fatalf("unexpected collator %v: %v", collator, err)
+	}
+	codec := NewCodec(16)
+	codec.CollateKeys([]Collator{collator, nil})
+
+	texts := []string{`["b","y"]`, `["A","y"]`, `["a","Y"]`, `["B","y"]`, `["ab","y"]`, `[10,"y"]`}
+	codes := encodeCollated(t, codec, texts)
+	sort.Sort(util.ByteSlices(codes))
+
+	// second key is binary collated, decoded with a plain codec.
+	plain := NewCodec(16)
+	ref := []string{`[10,"y"]`, `["A","y"]`, `["a","Y"]`, `["ab","y"]`, `["B","y"]`, `["b","y"]`}
+	for i, code := range codes {
+		if text := decodeCollated(t, plain, code); text != ref[i] {
+			t.Errorf("position %v expected %v, got %v", i, ref[i], text)
+		}
+	}
+
+	// non-ASCII runes are case folded.
+	if key := string(collator.Key(nil, []byte("ÉCOLE"))); key != "école" {
+		t.Errorf("unexpected collation key %v", key)
+	}
+}
+
+func TestCollateUnicode(t *testing.T) {
+	collator, err := NewCollator("unicode:de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec := NewCodec(16)
+	codec.CollateStrings(collator)
+
+	codes := encodeCollated(t, codec, []string{`"b"`, `"ä"`, `"a"`, `null`})
+	sort.Sort(util.ByteSlices(codes))
+	ref := []string{`null`, `"a"`, `"ä"`, `"b"`}
+	for i, code := range codes {
+		if text := decodeCollated(t, codec, code); text != ref[i] {
+			t.Errorf("position %v expected %v, got %v", i, ref[i], text)
+		}
+	}
+}
+
+func TestNewCollator(t *testing.T) {
+	if c, err := NewCollator(" NOCASE "); err != nil || c.Name() != CollationNoCase {
+		t.Errorf("expected nocase collation, got %v %v", c, err)
+	}
+	for _, name := range []string{"", "binary", "Binary"} {
+		if c, err := NewCollator(name); c != nil || err != nil {
+			t.Errorf("%q expected binary collation, got %v %v", name, c, err)
+		}
+	}
+	for _, name := range []string{"caseless", "unicode:"} {
+		if _, err := NewCollator(name); err != ErrInvalidCollation {
+			t.Errorf("%q expected invalid collation, got %v", name, err)
+		}
+	}
+}
+
+func TestCollateBound(t *testing.T) {
+	collator, _ := NewCollator(CollationNoCase)
+	codec := NewCodec(16)
+	codec.CollateStrings(collator)
+
+	low, err := codec.EncodeBound([]byte(`"aB"`), make([]byte, 0, 1024), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	high, err := codec.EncodeBound([]byte(`"aB"`), make([]byte, 0, 1024), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	within := encodeCollated(t, codec, []string{`"AB"`, `"Ab"`, `"ab"`, `"aB"`})
+	for _, code := range within {
+		if bytes.Compare(code, low) <= 0 || bytes.Compare(code, high) >= 0 {
+			t.Errorf("%v expected within bounds", decodeCollated(t, codec, code))
+		}
+	}
+	outside := encodeCollated(t, codec, []string{`"aa"`, `"abc"`, `"B"`})
+	for _, code := range outside {
+		if bytes.Compare(code, low) >= 0 && bytes.Compare(code, high) <= 0 {
+			t.Errorf("%v expected outside bounds", decodeCollated(t, codec, code))
+		}
+	}
+
+	// other values are encoded as is.
+	bound, _ := codec.EncodeBound([]byte(`10`), make([]byte, 0, 1024), true)
+	if code := encodeCollated(t, codec, []string{`10`}); !bytes.Equal(bound, code[0]) {
+		t.Errorf("expected %v, got %v", code[0], bound)
+	}
+}
+
+func TestCollateDesc(t *testing.T) {
+	collator, _ := NewCollator(CollationNoCase)
+	codec := NewCodec(16)
+	codec.CollateKeys([]Collator{collator, collator})
+
+	codes := encodeCollated(t, codec, []string{`["Ab","x"]`, `["ab","x"]`, `["b","X"]`})
+	desc := []bool{true, false}
+	for _, code := range codes {
+		if _, err := codec.ReverseCollate(code, desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if bytes.Compare(codes[0], codes[1]) <= 0 || bytes.Compare(codes[1], codes[2]) <= 0 {
+		t.Errorf("expected descending order of first key")
+	}
+
+	code := codes[0]
+	if _, err := codec.ReverseCollate(code, desc); err != nil {
+		t.Fatal(err)
+	}
+	if text := decodeCollated(t, codec, code); text != `["Ab","x"]` {
+		t.Errorf("unexpected %v", text)
+	}
+	keys, err := codec.ExplodeArray(code, make([]byte, 0, 1024))
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("unexpected %v %v", keys, err)
+	}
+	if text := decodeCollated(t, codec, keys[1]); text != `"x"` {
+		t.Errorf("unexpected %v", text)
+	}
+}
@@ -121,6 +121,12 @@ func (codec *Codec) extractEncodedField(code []byte, fieldPos int) ([]byte, []by
 
 	case TypeString, ^TypeString:
 		datum, remaining, err = getEncodedString(code)
+		if err == nil && isCollatedString(code) {
+			// binary value follows collation key.
+			var value []byte
+			value, remaining, err = getEncodedString(remaining)
+			datum = code[:len(datum)+len(value)]
+		}
 
 	case TypeArray, ^TypeArray:
 		var l, currField, currFieldStart int
@@ -11,9 +11,11 @@ package common
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/couchbase/indexing/secondary/collatejson"
 	"github.com/couchbase/query/value"
+	"reflect"
 )
 
 type AggrFuncType uint32
@@ -24,6 +26,10 @@ const (
 	AGG_SUM
 	AGG_COUNT
 	AGG_COUNTN
+	AGG_AVG
+	AGG_ARRAY_AGG
+	AGG_APPROX_COUNT_DISTINCT
+	AGG_APPROX_QUANTILE
 	AGG_INVALID
 )
 
@@ -40,6 +46,14 @@ func (a AggrFuncType) String() string {
 		return "COUNT"
 	case AGG_COUNTN:
 		return "COUNTN"
+	case AGG_AVG:
+		return "AVG"
+	case AGG_ARRAY_AGG:
+		return "ARRAY_AGG"
+	case AGG_APPROX_COUNT_DISTINCT:
+		return "APPROX_COUNT_DISTINCT"
+	case AGG_APPROX_QUANTILE:
+		return "APPROX_QUANTILE"
 	default:
 		return "AGG_UNKNOWN"
 	}
@@ -55,16 +69,54 @@ type AggrFunc interface {
 	IsValid() bool
 }
 
+// MergeableAggrFunc is an aggregate whose partial state can be carried
+// out of a partition and merged with the partial state of other
+// partitions.  AVG is carried as a [sum, count] pair, ARRAY_AGG as the
+// array, approximate aggregates as their sketch.
+type MergeableAggrFunc interface {
+	AggrFunc
+	PartialValue() interface{}
+	MergePartial(partial interface{}) error
+}
+
 var (
 	encodedNull = []byte{2, 0}
 )
 
+var ErrInvalidAggrPartial = errors.New("Invalid partial aggregate")
+
+// IsMergeableAggr returns true if partial aggregates of typ need to be
+// merged as MergeableAggrFunc.
+func IsMergeableAggr(typ AggrFuncType) bool {
+	switch typ {
+	case AGG_AVG, AGG_ARRAY_AGG, AGG_APPROX_COUNT_DISTINCT, AGG_APPROX_QUANTILE:
+		return true
+	}
+	return false
+}
+
 func NewAggrFunc(typ AggrFuncType, val interface{}, distinct bool, n1qlValue bool) AggrFunc {
+	return NewAggrFunc2(typ, val, distinct, n1qlValue, 0, 0)
+}
+
+// NewAggrFunc2 takes limit on the number of values for ARRAY_AGG and
+// quantile for APPROX_QUANTILE.
+func NewAggrFunc2(typ AggrFuncType, val interface{}, distinct bool, n1qlValue bool,
+	limit int64, quantile float64) AggrFunc {
 
 	var agg AggrFunc
 
 	switch typ {
 
+	case AGG_AVG, AGG_ARRAY_AGG, AGG_APPROX_COUNT_DISTINCT, AGG_APPROX_QUANTILE:
+		agg = NewMergeableAggrFunc(typ, distinct, n1qlValue, limit, quantile)
+		if n1qlValue {
+			agg.AddDeltaObj(val.(value.Value))
+		} else {
+			agg.AddDelta(val)
+		}
+		return agg
+
 	case AGG_SUM:
 		agg = &AggrFuncSum{typ: AGG_SUM, distinct: distinct, n1qlValue: n1qlValue}
 	case AGG_COUNT:
@@ -644,3 +696,373 @@ func isNumericRaw(val []byte) bool {
 
 	return false
 }
+
+// NewMergeableAggrFunc returns an empty aggregate for typ, nil if partial
+// aggregates of typ cannot be merged.
+func NewMergeableAggrFunc(typ AggrFuncType, distinct bool, n1qlValue bool,
+	limit int64, quantile float64) MergeableAggrFunc {
+
+	switch typ {
+	case AGG_AVG:
+		return &AggrFuncAvg{typ: AGG_AVG, distinct: distinct, n1qlValue: n1qlValue}
+	case AGG_ARRAY_AGG:
+		return &AggrFuncArrayAgg{typ: AGG_ARRAY_AGG, limit: limit, distinct: distinct,
+			n1qlValue: n1qlValue}
+	case AGG_APPROX_COUNT_DISTINCT:
+		return &AggrFuncApproxCountDistinct{typ: AGG_APPROX_COUNT_DISTINCT,
+			hll: NewHyperLogLog(), n1qlValue: n1qlValue}
+	case AGG_APPROX_QUANTILE:
+		return &AggrFuncApproxQuantile{typ: AGG_APPROX_QUANTILE, quantile: quantile,
+			sketch: NewQuantileSketch(), n1qlValue: n1qlValue}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------
+// AVG
+//-----------------------------------------------------------
+
+type AggrFuncAvg struct {
+	typ   AggrFuncType
+	sum   AggrFuncSum
+	count int64
+
+	lastVal   float64
+	distinct  bool
+	n1qlValue bool
+}
+
+func (a AggrFuncAvg) Type() AggrFuncType {
+	return AGG_AVG
+}
+
+func (a AggrFuncAvg) Value() interface{} {
+	if a.count == 0 {
+		return nil
+	}
+
+	var sum float64
+	switch v := a.sum.Value().(type) {
+	case int64:
+		sum = float64(v)
+	case float64:
+		sum = v
+	}
+	return sum / float64(a.count)
+}
+
+//partial aggregate is [sum, count]
+func (a AggrFuncAvg) PartialValue() interface{} {
+	if a.count == 0 {
+		return nil
+	}
+	return []interface{}{a.sum.Value(), a.count}
+}
+
+func (a AggrFuncAvg) Distinct() bool {
+	return a.distinct
+}
+
+func (a AggrFuncAvg) IsValid() bool {
+	return a.count != 0
+}
+
+func (a *AggrFuncAvg) AddDeltaObj(delta value.Value) {
+	a.AddDelta(delta.ActualForIndex())
+}
+
+//Only numeric values are considered.
+//null/missing/non-numeric are ignored.
+func (a *AggrFuncAvg) AddDelta(delta interface{}) {
+
+	f, ok := toFloat64(delta)
+	if !ok {
+		return
+	}
+
+	if a.distinct {
+		if a.count != 0 && a.lastVal == f {
+			return
+		}
+		a.lastVal = f
+	}
+
+	a.sum.AddDelta(delta)
+	a.count++
+}
+
+func (a *AggrFuncAvg) AddDeltaRaw(delta []byte) {
+	//not implemented
+}
+
+func (a *AggrFuncAvg) MergePartial(partial interface{}) error {
+
+	if partial == nil {
+		return nil
+	}
+
+	pair, ok := partial.([]interface{})
+	if !ok || len(pair) != 2 {
+		return ErrInvalidAggrPartial
+	}
+
+	count, ok := toFloat64(pair[1])
+	if !ok {
+		return ErrInvalidAggrPartial
+	}
+
+	a.sum.AddDelta(pair[0])
+	a.count += int64(count)
+	return nil
+}
+
+func (a AggrFuncAvg) String() string {
+	return fmt.Sprintf("Type %v Sum %v Count %v Distinct %v", a.typ, a.sum.Value(), a.count, a.distinct)
+}
+
+//-----------------------------------------------------------
+// ARRAY_AGG
+//-----------------------------------------------------------
+
+type AggrFuncArrayAgg struct {
+	typ   AggrFuncType
+	vals  []interface{}
+	limit int64 // 0 means no limit
+
+	distinct  bool
+	n1qlValue bool
+}
+
+func (a AggrFuncArrayAgg) Type() AggrFuncType {
+	return AGG_ARRAY_AGG
+}
+
+func (a AggrFuncArrayAgg) Value() interface{} {
+	if len(a.vals) == 0 {
+		return nil
+	}
+	return a.vals
+}
+
+func (a AggrFuncArrayAgg) PartialValue() interface{} {
+	return a.Value()
+}
+
+func (a AggrFuncArrayAgg) Distinct() bool {
+	return a.distinct
+}
+
+func (a AggrFuncArrayAgg) IsValid() bool {
+	return len(a.vals) != 0
+}
+
+//missing is ignored.
+func (a *AggrFuncArrayAgg) AddDeltaObj(delta value.Value) {
+
+	if delta.Type() == value.MISSING {
+		return
+	}
+	a.AddDelta(delta.ActualForIndex())
+}
+
+func (a *AggrFuncArrayAgg) AddDelta(delta interface{}) {
+
+	if a.limit > 0 && int64(len(a.vals)) >= a.limit {
+		return
+	}
+
+	// values are in index order within a partition, compare
+	// with the last value only.
+	if a.distinct && len(a.vals) != 0 &&
+		reflect.DeepEqual(a.vals[len(a.vals)-1], delta) {
+		return
+	}
+
+	a.vals = append(a.vals, delta)
+}
+
+func (a *AggrFuncArrayAgg) AddDeltaRaw(delta []byte) {
+	//not implemented
+}
+
+func (a *AggrFuncArrayAgg) MergePartial(partial interface{}) error {
+
+	if partial == nil {
+		return nil
+	}
+
+	vals, ok := partial.([]interface{})
+	if !ok {
+		return ErrInvalidAggrPartial
+	}
+
+	for _, val := range vals {
+		if a.limit > 0 && int64(len(a.vals)) >= a.limit {
+			break
+		}
+		if a.distinct && a.contains(val) {
+			continue
+		}
+		a.vals = append(a.vals, val)
+	}
+	return nil
+}
+
+func (a *AggrFuncArrayAgg) contains(val interface{}) bool {
+	for _, v := range a.vals {
+		if reflect.DeepEqual(v, val) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a AggrFuncArrayAgg) String() string {
+	return fmt.Sprintf("Type %v Values %v Limit %v Distinct %v", a.typ, len(a.vals), a.limit, a.distinct)
+}
+
+//-----------------------------------------------------------
+// APPROX_COUNT_DISTINCT
+//-----------------------------------------------------------
+
+type AggrFuncApproxCountDistinct struct {
+	typ AggrFuncType
+	hll *HyperLogLog
+
+	n1qlValue bool
+}
+
+func (a AggrFuncApproxCountDistinct) Type() AggrFuncType {
+	return AGG_APPROX_COUNT_DISTINCT
+}
+
+func (a AggrFuncApproxCountDistinct) Value() interface{} {
+	return a.hll.Count()
+}
+
+//partial aggregate is the encoded sketch
+func (a AggrFuncApproxCountDistinct) PartialValue() interface{} {
+	return a.hll.Encode()
+}
+
+func (a AggrFuncApproxCountDistinct) Distinct() bool {
+	return true
+}
+
+func (a AggrFuncApproxCountDistinct) IsValid() bool {
+	return true
+}
+
+//null/missing are ignored.
+func (a *AggrFuncApproxCountDistinct) AddDeltaObj(delta value.Value) {
+
+	if isNullOrMissing(delta) {
+		return
+	}
+	a.AddDelta(delta.ActualForIndex())
+}
+
+func (a *AggrFuncApproxCountDistinct) AddDelta(delta interface{}) {
+
+	if delta == nil {
+		return
+	}
+	a.hll.Add(HashValue(delta))
+}
+
+func (a *AggrFuncApproxCountDistinct) AddDeltaRaw(delta []byte) {
+	//not implemented
+}
+
+func (a *AggrFuncApproxCountDistinct) MergePartial(partial interface{}) error {
+
+	encoded, ok := partial.(string)
+	if !ok {
+		// count of an empty result
+		return nil
+	}
+
+	hll, err := DecodeHyperLogLog(encoded)
+	if err != nil {
+		return err
+	}
+	a.hll.Merge(hll)
+	return nil
+}
+
+func (a AggrFuncApproxCountDistinct) String() string {
+	return fmt.Sprintf("Type %v Value %v", a.typ, a.hll.Count())
+}
+
+//-----------------------------------------------------------
+// APPROX_QUANTILE
+//-----------------------------------------------------------
+
+type AggrFuncApproxQuantile struct {
+	typ      AggrFuncType
+	quantile float64
+	sketch   *QuantileSketch
+
+	n1qlValue bool
+}
+
+func (a AggrFuncApproxQuantile) Type() AggrFuncType {
+	return AGG_APPROX_QUANTILE
+}
+
+func (a AggrFuncApproxQuantile) Value() interface{} {
+	if val, ok := a.sketch.Quantile(a.quantile); ok {
+		return val
+	}
+	return nil
+}
+
+//partial aggregate is the list of [mean, weight] centroids
+func (a AggrFuncApproxQuantile) PartialValue() interface{} {
+	return a.sketch.Encode()
+}
+
+func (a AggrFuncApproxQuantile) Distinct() bool {
+	return false
+}
+
+func (a AggrFuncApproxQuantile) IsValid() bool {
+	return a.sketch.Count() != 0
+}
+
+func (a *AggrFuncApproxQuantile) AddDeltaObj(delta value.Value) {
+	a.AddDelta(delta.ActualForIndex())
+}
+
+//Only numeric values are considered.
+//null/missing/non-numeric are ignored.
+func (a *AggrFuncApproxQuantile) AddDelta(delta interface{}) {
+
+	if f, ok := toFloat64(delta); ok {
+		a.sketch.Add(f)
+	}
+}
+
+func (a *AggrFuncApproxQuantile) AddDeltaRaw(delta []byte) {
+	//not implemented
+}
+
+func (a *AggrFuncApproxQuantile) MergePartial(partial interface{}) error {
+
+	encoded, ok := partial.([]interface{})
+	if !ok {
+		// quantile of an empty result
+		return nil
+	}
+
+	sketch, err := DecodeQuantileSketch(encoded)
+	if err != nil {
+		return err
+	}
+	a.sketch.Merge(sketch)
+	return nil
+}
+
+func (a AggrFuncApproxQuantile) String() string {
+	return fmt.Sprintf("Type %v Quantile %v Count %v", a.typ, a.quantile, a.sketch.Count())
+}
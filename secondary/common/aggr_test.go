@@ -0,0 +1,92 @@
+package common
+
+import "testing"
+import "math"
+import "reflect"
+import "encoding/json"
+
+// round trip the partial state through JSON as it is carried over the wire
+func roundTrip(t *testing.T, partial interface{}) interface{} {
+	bs, err := json.Marshal(partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var val interface{}
+	if err := json.Unmarshal(bs, &val); err != nil {
+		t.Fatal(err)
+	}
+	return val
+}
+
+func mergePartitions(t *testing.T, typ AggrFuncType, limit int64,
+	quantile float64, partitions ...[]interface{}) MergeableAggrFunc {
+
+	merged := NewMergeableAggrFunc(typ, false, false, limit, quantile)
+	for _, vals := range partitions {
+		partn := NewMergeableAggrFunc(typ, false, false, limit, quantile)
+		for _, val := range vals {
+			partn.AddDelta(val)
+		}
+		if err := merged.MergePartial(roundTrip(t, partn.PartialValue())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return merged
+}
+
+func TestAggrAvgMerge(t *testing.T) {
+	avg := mergePartitions(t, AGG_AVG, 0, 0,
+		[]interface{}{int64(1), int64(2), nil, "a"},
+		[]interface{}{float64(3), int64(4), int64(5)},
+		[]interface{}{})
+
+	if avg.Value() != float64(3) {
+		t.Fatalf("expected avg 3, got %v", avg.Value())
+	}
+
+	empty := NewMergeableAggrFunc(AGG_AVG, false, false, 0, 0)
+	if empty.Value() != nil || empty.PartialValue() != nil {
+		t.Fatalf("expected null avg for empty input")
+	}
+}
+
+func TestAggrArrayAggLimit(t *testing.T) {
+	agg := mergePartitions(t, AGG_ARRAY_AGG, 3, 0,
+		[]interface{}{"a", "b"},
+		[]interface{}{"c", "d"})
+
+	if !reflect.DeepEqual(agg.Value(), []interface{}{"a", "b", "c"}) {
+		t.Fatalf("unexpected array_agg %v", agg.Value())
+	}
+}
+
+func TestAggrApproxCountDistinct(t *testing.T) {
+	var p1, p2 []interface{}
+	for i := 0; i < 20000; i++ {
+		p1 = append(p1, float64(i))
+		p2 = append(p2, float64(i+10000))
+	}
+
+	agg := mergePartitions(t, AGG_APPROX_COUNT_DISTINCT, 0, 0, p1, p2)
+	count := agg.Value().(int64)
+	if math.Abs(float64(count-30000)) > 30000*0.05 {
+		t.Fatalf("approx count distinct %v too far from 30000", count)
+	}
+}
+
+func TestAggrApproxQuantile(t *testing.T) {
+	var p1, p2 []interface{}
+	for i := 0; i < 10000; i++ {
+		if i%2 == 0 {
+			p1 = append(p1, float64(i))
+		} else {
+			p2 = append(p2, int64(i))
+		}
+	}
+
+	agg := mergePartitions(t, AGG_APPROX_QUANTILE, 0, 0.9, p1, p2)
+	val := agg.Value().(float64)
+	if math.Abs(val-9000) > 100 {
+		t.Fatalf("approx quantile %v too far from 9000", val)
+	}
+}
@@ -88,6 +88,59 @@ var SystemConfig = Config{
 		true,  // immutable
 		false, // case-insensitive
 	},
+	"security.clientAuth.caFile": ConfigValue{
+		"",
+		"PEM bundle of CAs trusted to sign client certificates on " +
+			"queryport and dataport, node certificate is used if empty",
+		"",
+		true, // immutable
+		true, // case-sensitive
+	},
+	"security.clientAuth.required": ConfigValue{
+		false,
+		"reject queryport and dataport clients that do not present " +
+			"a valid certificate, when encryption is enabled",
+		false,
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"security.clientAuth.identityMap": ConfigValue{
+		"",
+		"comma separated field:pattern=identity rules mapping client " +
+			"certificates to identities, field is one of cn, san or ou. " +
+			"Certificates not matching any rule are rejected",
+		"",
+		true, // immutable
+		true, // case-sensitive
+	},
+	"security.clientAuth.queryportIdentities": ConfigValue{
+		"",
+		"comma separated identities allowed to connect to queryport, " +
+			"when encryption is enabled. If empty any client passing " +
+			"certificate verification is allowed, otherwise clients " +
+			"without a certificate are rejected",
+		"",
+		true, // immutable
+		true, // case-sensitive
+	},
+	"security.clientAuth.dataportIdentities": ConfigValue{
+		"",
+		"comma separated identities allowed to connect to dataport, " +
+			"when encryption is enabled. If empty any client passing " +
+			"certificate verification is allowed, otherwise clients " +
+			"without a certificate are rejected",
+		"",
+		true, // immutable
+		true, // case-sensitive
+	},
+	"security.clientAuth.reloadInterval": ConfigValue{
+		60,
+		"interval, in seconds, to check certificate, key and CA files " +
+			"for change, 0 disables hot-reload",
+		60,
+		true,  // immutable
+		false, // case-insensitive
+	},
 	// projector parameters
 	"projector.name": ConfigValue{
 		"projector",
@@ -271,6 +324,22 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"projector.dcp.collectionsAware": ConfigValue{
+		true,
+		"negotiate collections with dcp producer, documents of non-default " +
+			"collections are streamed only when enabled",
+		true,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.dcp.snappy": ConfigValue{
+		true,
+		"negotiate snappy datatype with dcp producer, compressed values " +
+			"are inflated by projector before evaluating index expressions",
+		true,
+		false, // mutable
+		false, // case-insensitive
+	},
 	// projector adminport parameters
 	"projector.adminport.name": ConfigValue{
 		"projector.adminport",
@@ -368,6 +437,15 @@ var SystemConfig = Config{
 		true,        // immutable
 		false,       // case-insensitive
 	},
+	"projector.dataport.compression": ConfigValue{
+		"none",
+		"compression codec for payload sent from router to downstream " +
+			"client, one of none, snappy, gzip, bzip2. Indexer decompresses " +
+			"based on packet flags, does not affect existing feeds.",
+		"none",
+		false, // mutable
+		false, // case-insensitive
+	},
 	"projector.statsLogDumpInterval": ConfigValue{
 		60, // 1 minute
 		"in seconds, periodically log stats of all projector components",
@@ -456,6 +534,14 @@ var SystemConfig = Config{
 		false,      // mutable
 		false,      // case-insensitive
 	},
+	"indexer.dataport.drainTimeout": ConfigValue{
+		30,
+		"time, in seconds, connections accepted before a certificate " +
+			"rotation are allowed to stream, before they are closed",
+		30,
+		true,  // immutable
+		false, // case-insensitive
+	},
 	// indexer queryport configuration
 	"indexer.queryport.maxPayload": ConfigValue{
 		64 * 1024,
@@ -499,6 +585,22 @@ var SystemConfig = Config{
 		false, // immutable
 		false, // case-insensitive
 	},
+	"indexer.queryport.drainTimeout": ConfigValue{
+		30,
+		"time, in seconds, to wait for requests in flight on connections " +
+			"accepted before a certificate rotation, before they are closed",
+		30,
+		true,  // immutable
+		false, // case-insensitive
+	},
+	"indexer.queryport.allowCompression": ConfigValue{
+		true,
+		"advertise payload compression to queryport clients, responses " +
+			"are compressed with the same codec as the request.",
+		true,
+		false, // mutable
+		false, // case-insensitive
+	},
 	// queryport client configuration
 	"queryport.client.maxPayload": ConfigValue{
 		1000 * 1024,
@@ -507,6 +609,15 @@ var SystemConfig = Config{
 		true,  // immutable
 		false, // case-insensitive
 	},
+	"queryport.client.compression": ConfigValue{
+		"none",
+		"compression codec for requests and responses, one of none, " +
+			"snappy, gzip, bzip2, applicable only when indexer allows it, " +
+			"does not affect existing connections.",
+		"none",
+		false, // mutable
+		false, // case-insensitive
+	},
 	"queryport.client.readDeadline": ConfigValue{
 		300000,
 		"timeout, in milliseconds, is timeout while reading from socket",
@@ -655,6 +766,13 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"queryport.client.log_format": ConfigValue{
+		"text",
+		"GsiClient logging format, text or json",
+		"text",
+		false, // mutable
+		false, // case-insensitive
+	},
 	"queryport.client.scan.max_concurrency": ConfigValue{
 		0,
 		"When performing query on partitioned index, specify maximum concurrency allowed. Use 0 to disable.",
@@ -676,6 +794,60 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"queryport.client.routing.preferServerGroup": ConfigValue{
+		false,
+		"prefer replicas in the server group of the query node, when scanning " +
+			"an index with replicas",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"queryport.client.routing.serverGroup": ConfigValue{
+		"",
+		"server group of the query node, if empty it is discovered from cluster " +
+			"membership",
+		"",
+		false, // mutable
+		false, // case-insensitive
+	},
+	"queryport.client.routing.latencyWeighted": ConfigValue{
+		false,
+		"pick replicas with a probability inversely proportional to their " +
+			"observed scan latency",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"queryport.client.routing.latencyAlpha": ConfigValue{
+		0.2,
+		"smoothing factor between (0, 1.0] for moving average of replica scan " +
+			"latency, higher the value more weight to recent scans",
+		0.2,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"queryport.client.routing.hedge.enable": ConfigValue{
+		false,
+		"send a duplicate scan request to another replica if the first replica " +
+			"has not responded within the hedge delay",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"queryport.client.routing.hedge.percentile": ConfigValue{
+		95.0,
+		"hedge delay is this percentile of recent scan latencies of a replica",
+		95.0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"queryport.client.routing.hedge.minDelay": ConfigValue{
+		10,
+		"minimum hedge delay in milliseconds",
+		10,
+		false, // mutable
+		false, // case-insensitive
+	},
 	// projector's adminport client, can be used by indexer.
 	"indexer.projectorclient.retryInterval": ConfigValue{
 		16,
@@ -1769,6 +1941,15 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.log_format": ConfigValue{
+		"text",
+		"Indexer logging format, text or json. json logs one object per " +
+			"line with level, component, bucket, index, requestId and " +
+			"partition fields",
+		"text",
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.scan_timeout": ConfigValue{
 		120000,
 		"timeout, in milliseconds, timeout for index scan processing",
@@ -1776,6 +1957,15 @@ var SystemConfig = Config{
 		true,  // immutable
 		false, // case-insensitive
 	},
+	"indexer.settings.scan_reverse_buffer_limit": ConfigValue{
+		64 * 1024 * 1024,
+		"memory, in bytes, for entries of a partition buffered by reverse " +
+			"scan on storage that iterates only forward, past it the scan " +
+			"fails, 0 is unbounded",
+		64 * 1024 * 1024,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.max_array_seckey_size": ConfigValue{
 		10240,
 		"Maximum size of secondary index key size for array index",
@@ -1968,6 +2158,16 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.moi.persistence.max_delta_snapshots": ConfigValue{
+		0,
+		"Maximum number of delta snapshots, recording only the items inserted or " +
+			"deleted since the previous persisted snapshot, to persist before " +
+			"consolidating into a full snapshot. Deleted items are retained in memory " +
+			"between persisted snapshots. 0 disables delta snapshots",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.moi.recovery_threads": ConfigValue{
 		runtime.GOMAXPROCS(0),
 		"Number of concurrent threads for rebuilding index from disk snapshot",
@@ -1989,6 +2189,51 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.slow_scan_threshold": ConfigValue{
+		0,
+		"scan requests taking longer than this, in milliseconds, are " +
+			"logged with their execution profile, 0 disables the slow scan log",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.slow_scan_log_size": ConfigValue{
+		100,
+		"number of most recent slow scan requests kept by the slow scan log",
+		100,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.materialized_aggr.max_memory": ConfigValue{
+		256 * 1024 * 1024,
+		"memory, in bytes, of materialized aggregates of all indexes, past it " +
+			"the partition exceeding it stops materializing aggregates, " +
+			"0 is unbounded",
+		256 * 1024 * 1024,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.scan_snapshot_lease_default": ConfigValue{
+		30000,
+		"lease, in milliseconds, for a pinned scan snapshot when client does not ask for one",
+		30000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.scan_snapshot_lease_max": ConfigValue{
+		600000,
+		"maximum lease, in milliseconds, that can be granted for a pinned scan snapshot",
+		600000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.scan_snapshot_max_leases": ConfigValue{
+		1024,
+		"maximum number of scan snapshots that can be pinned at the same time",
+		1024,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.num_replica": ConfigValue{
 		0,
 		"Number of additional replica for each index.",
@@ -2003,6 +2248,13 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"projector.settings.log_format": ConfigValue{
+		"text",
+		"Projector logging format, text or json",
+		"text",
+		false, // mutable
+		false, // case-insensitive
+	},
 	"projector.diagnostics_dir": ConfigValue{
 		"./",
 		"Projector diagnostics information directory",
@@ -2113,6 +2365,14 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.restore_max_size": ConfigValue{
+		10 * 1024 * 1024 * 1024,
+		"size, in bytes, of the files extracted from a backup archive by " +
+			"restoreIndexData, past it the restore fails, 0 is unbounded",
+		10 * 1024 * 1024 * 1024,
+		true,  // immutable
+		false, // case-insensitive
+	},
 	"indexer.settings.enable_corrupt_index_backup": ConfigValue{
 		false,
 		"When corrupted index is found, backup the corrupted index data files.",
@@ -2162,6 +2422,42 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.scan.statistics.numBins": ConfigValue{
+		32,
+		"number of bins in the equi-depth histogram computed for index statistics",
+		32,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.scan.statistics.refreshInterval": ConfigValue{
+		300,
+		"interval (sec) after which cached index statistics are recomputed",
+		300,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.scan.statistics.refreshRatio": ConfigValue{
+		0.1,
+		"recompute cached index statistics when the number of items in index changes by this ratio.",
+		0.1,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.scan.statistics.histogram.sampleSize": ConfigValue{
+		100000,
+		"maximum number of index entries sampled for the histogram of leading key of a partition",
+		100000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.scan.statistics.histogram.refreshRatio": ConfigValue{
+		0.2,
+		"resample the histogram of leading key of a partition when the number of mutations " +
+			"indexed since last sample exceeds this ratio of its items.",
+		0.2,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.planner.timeout": ConfigValue{
 		300,
 		"timeout (sec) on planner",
@@ -44,11 +44,18 @@ var ErrIndexNotFound = errors.New("Index not found")
 // Index not ready
 var ErrIndexNotReady = errors.New("Index not ready for serving queries")
 
+// Index maintenance is paused, only AnyConsistency scans are served
+var ErrIndexPaused = errors.New("Index maintenance is paused. Only scans with AnyConsistency are allowed")
+
 // ErrClientCancel when query client cancels an ongoing scan request.
 var ErrClientCancel = errors.New("Client requested cancel")
 
 var ErrIndexerInBootstrap = errors.New("Indexer In Warmup State. Please retry the request later.")
 
+// ErrHistogramNotAvailable is returned for the lead key histogram of an
+// index partition that is being sampled.
+var ErrHistogramNotAvailable = errors.New("Lead key histogram not available, sampling in progress. Please retry the request later.")
+
 const INDEXER_45_VERSION = 1
 const INDEXER_50_VERSION = 2
 const INDEXER_55_VERSION = 3
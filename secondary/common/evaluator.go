@@ -20,6 +20,12 @@ type Evaluator interface {
 	// SnapshotData is generated for downstream.
 	SnapshotData(m *mc.DcpEvent, vbno uint16, vbuuid, seqno, opaque2 uint64) interface{}
 
+	// SystemEventData is generated for downstream.
+	SystemEventData(m *mc.DcpEvent, vbno uint16, vbuuid, seqno, opaque2 uint64) interface{}
+
+	// UpdateSeqnoData is generated for downstream.
+	UpdateSeqnoData(vbno uint16, vbuuid, seqno, opaque2 uint64) interface{}
+
 	// StreamEnd is generated for downstream.
 	StreamEndData(vbno uint16, vbuuid, seqno, opaque2 uint64) (data interface{})
 
@@ -35,4 +41,8 @@ type Evaluator interface {
 
 	// Get the name of the index
 	GetIndexName() string
+
+	// CollectionID returns the hex encoded id of the collection on which
+	// the index is defined.
+	CollectionID() string
 }
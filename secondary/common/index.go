@@ -13,6 +13,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/couchbase/indexing/secondary/collatejson"
 	"github.com/couchbase/indexing/secondary/logging"
 	"strings"
 )
@@ -54,6 +55,15 @@ const (
 	N1QL                = "N1QL"
 )
 
+// Default scope and collection of a bucket. Index definitions created
+// without a scope and collection belong to the default collection.
+const (
+	DEFAULT_SCOPE         = "_default"
+	DEFAULT_COLLECTION    = "_default"
+	DEFAULT_SCOPE_ID      = "0"
+	DEFAULT_COLLECTION_ID = "0"
+)
+
 type PartitionScheme string
 
 const (
@@ -194,6 +204,10 @@ type IndexDefn struct {
 	Using           IndexType       `json:"using,omitempty"`
 	Bucket          string          `json:"bucket,omitempty"`
 	BucketUUID      string          `json:"bucketUUID,omitempty"`
+	Scope           string          `json:"scope,omitempty"`
+	ScopeId         string          `json:"scopeId,omitempty"`
+	Collection      string          `json:"collection,omitempty"`
+	CollectionId    string          `json:"collectionId,omitempty"`
 	IsPrimary       bool            `json:"isPrimary,omitempty"`
 	SecExprs        []string        `json:"secExprs,omitempty"`
 	ExprType        ExprType        `json:"exprType,omitempty"`
@@ -202,6 +216,7 @@ type IndexDefn struct {
 	PartitionKey       string     `json:"partitionKey,omitempty"`
 	WhereExpr          string     `json:"where,omitempty"`
 	Desc               []bool     `json:"desc,omitempty"`
+	Collations         []string   `json:"collations,omitempty"`
 	Deferred           bool       `json:"deferred,omitempty"`
 	Immutable          bool       `json:"immutable,omitempty"`
 	Nodes              []string   `json:"nodes,omitempty"`
@@ -211,6 +226,11 @@ type IndexDefn struct {
 	RetainDeletedXATTR bool       `json:"retainDeletedXATTR,omitempty"`
 	HashScheme         HashScheme `json:"hashScheme,omitempty"`
 	NumReplica2        Counter    `json:"NumReplica2,omitempty"`
+	// RangeBoundaries are JSON encoded lower bounds of partitions 2..N,
+	// for RANGE partitioned index. Refer RangeKeyPartition().
+	RangeBoundaries []string `json:"rangeBoundaries,omitempty"`
+	// Aggregates materialized with the index.
+	Aggregates []AggregateDefn `json:"aggregates,omitempty"`
 
 	// Sizing info
 	NumDoc        uint64  `json:"numDoc,omitempty"`
@@ -230,6 +250,31 @@ type IndexDefn struct {
 	RealInstId    IndexInstId   `json:"realInstId,omitempty"`
 }
 
+// AggregateDefn is a group aggregate materialized with an index. It is
+// maintained as mutations are applied to the index, and scans with a
+// matching group aggregate are answered from it.
+type AggregateDefn struct {
+	Name  string          `json:"name,omitempty"`
+	Group []int32         `json:"group,omitempty"` // index key positions
+	Aggrs []AggregateFunc `json:"aggrs,omitempty"`
+}
+
+// AggregateFunc is an aggregate function over the index key at KeyPos.
+// Negative KeyPos is allowed only for COUNT, which then counts the index
+// entries in the group.
+type AggregateFunc struct {
+	Type   AggrFuncType `json:"type"`
+	KeyPos int32        `json:"keyPos"`
+}
+
+func (a AggregateDefn) String() string {
+	return fmt.Sprintf("{Name: %v Group: %v Aggrs: %v}", a.Name, a.Group, a.Aggrs)
+}
+
+func (f AggregateFunc) String() string {
+	return fmt.Sprintf("%v(%v)", f.Type, f.KeyPos)
+}
+
 //IndexInst is an instance of an Index(aka replica)
 type IndexInst struct {
 	InstId         IndexInstId
@@ -246,6 +291,7 @@ type IndexInst struct {
 	StorageMode    string
 	OldStorageMode string
 	RealInstId     IndexInstId
+	Paused         bool
 }
 
 //IndexInstMap is a map from IndexInstanceId to IndexInstance
@@ -257,16 +303,27 @@ func (idx IndexDefn) String() string {
 	str += fmt.Sprintf("Name: %v ", idx.Name)
 	str += fmt.Sprintf("Using: %v ", idx.Using)
 	str += fmt.Sprintf("Bucket: %v ", idx.Bucket)
+	str += fmt.Sprintf("Scope: %v ", idx.GetScope())
+	str += fmt.Sprintf("Collection: %v ", idx.GetCollection())
 	str += fmt.Sprintf("IsPrimary: %v ", idx.IsPrimary)
 	str += fmt.Sprintf("NumReplica: %v ", idx.GetNumReplica())
 	str += fmt.Sprintf("InstVersion: %v ", idx.InstVersion)
 	str += fmt.Sprintf("\n\t\tSecExprs: %v ", logging.TagUD(idx.SecExprs))
 	str += fmt.Sprintf("\n\t\tDesc: %v", idx.Desc)
+	if idx.HasCollation() {
+		str += fmt.Sprintf("\n\t\tCollations: %v", idx.Collations)
+	}
 	str += fmt.Sprintf("\n\t\tPartitionScheme: %v ", idx.PartitionScheme)
 	str += fmt.Sprintf("\n\t\tHashScheme: %v ", idx.HashScheme.String())
 	str += fmt.Sprintf("PartitionKeys: %v ", idx.PartitionKeys)
+	if idx.PartitionScheme == RANGE {
+		str += fmt.Sprintf("RangeBoundaries: %v ", logging.TagUD(idx.RangeBoundaries))
+	}
 	str += fmt.Sprintf("WhereExpr: %v ", logging.TagUD(idx.WhereExpr))
 	str += fmt.Sprintf("RetainDeletedXATTR: %v ", idx.RetainDeletedXATTR)
+	if len(idx.Aggregates) != 0 {
+		str += fmt.Sprintf("Aggregates: %v ", idx.Aggregates)
+	}
 	return str
 
 }
@@ -280,13 +337,20 @@ func (idx IndexDefn) Clone() *IndexDefn {
 		Using:              idx.Using,
 		Bucket:             idx.Bucket,
 		BucketUUID:         idx.BucketUUID,
+		Scope:              idx.Scope,
+		ScopeId:            idx.ScopeId,
+		Collection:         idx.Collection,
+		CollectionId:       idx.CollectionId,
 		IsPrimary:          idx.IsPrimary,
 		SecExprs:           idx.SecExprs,
 		Desc:               idx.Desc,
+		Collations:         idx.Collations,
 		ExprType:           idx.ExprType,
 		PartitionScheme:    idx.PartitionScheme,
 		PartitionKeys:      idx.PartitionKeys,
 		HashScheme:         idx.HashScheme,
+		RangeBoundaries:    idx.RangeBoundaries,
+		Aggregates:         idx.Aggregates,
 		WhereExpr:          idx.WhereExpr,
 		Deferred:           idx.Deferred,
 		Immutable:          idx.Immutable,
@@ -315,6 +379,132 @@ func (idx *IndexDefn) HasDescending() bool {
 
 }
 
+// HasCollation returns true if strings of any index key are not in
+// binary collation.
+func (idx *IndexDefn) HasCollation() bool {
+	for _, collation := range idx.Collations {
+		if collation != "" && collation != collatejson.CollationBinary {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCollation returns the collation of strings in the index key at
+// `keyPos`, empty for binary collation.
+func (idx *IndexDefn) GetCollation(keyPos int) string {
+	if keyPos >= 0 && keyPos < len(idx.Collations) &&
+		idx.Collations[keyPos] != collatejson.CollationBinary {
+		return idx.Collations[keyPos]
+	}
+	return ""
+}
+
+// KeyCollators returns the collator of each index key, nil if strings
+// of all the keys are in binary collation.
+func (idx *IndexDefn) KeyCollators() ([]collatejson.Collator, error) {
+	if !idx.HasCollation() {
+		return nil, nil
+	}
+	collators := make([]collatejson.Collator, len(idx.Collations))
+	for i, collation := range idx.Collations {
+		collator, err := collatejson.NewCollator(collation)
+		if err != nil {
+			return nil, err
+		}
+		collators[i] = collator
+	}
+	return collators, nil
+}
+
+// GetScope returns the scope of the index, index definitions created
+// before collections were supported belong to the default scope.
+func (idx *IndexDefn) GetScope() string {
+	if idx.Scope == "" {
+		return DEFAULT_SCOPE
+	}
+	return idx.Scope
+}
+
+// GetCollection returns the collection of the index, index definitions
+// created before collections were supported belong to the default
+// collection.
+func (idx *IndexDefn) GetCollection() string {
+	if idx.Collection == "" {
+		return DEFAULT_COLLECTION
+	}
+	return idx.Collection
+}
+
+func (idx *IndexDefn) GetScopeId() string {
+	if idx.ScopeId == "" {
+		return DEFAULT_SCOPE_ID
+	}
+	return idx.ScopeId
+}
+
+func (idx *IndexDefn) GetCollectionId() string {
+	if idx.CollectionId == "" {
+		return DEFAULT_COLLECTION_ID
+	}
+	return idx.CollectionId
+}
+
+// FindAggregate returns the aggregate materialized with the index by
+// `name`, nil if there is none.
+func (idx *IndexDefn) FindAggregate(name string) *AggregateDefn {
+	for i := range idx.Aggregates {
+		if idx.Aggregates[i].Name == name {
+			return &idx.Aggregates[i]
+		}
+	}
+	return nil
+}
+
+// ValidateAggregate returns an error if `aggr` cannot be materialized
+// with the index.
+func (idx *IndexDefn) ValidateAggregate(aggr *AggregateDefn) error {
+	if aggr.Name == "" {
+		return errors.New("Aggregate name is empty")
+	}
+	if idx.IsPrimary || idx.IsArrayIndex || idx.HasDescending() {
+		return errors.New("Aggregates are supported only on secondary " +
+			"index with ascending and non-array keys")
+	}
+	if len(aggr.Aggrs) == 0 {
+		return errors.New("Aggregate has no aggregate function")
+	}
+
+	nkeys := int32(len(idx.SecExprs))
+	seen := make(map[int32]bool)
+	for _, pos := range aggr.Group {
+		if pos < 0 || pos >= nkeys {
+			return fmt.Errorf("Group key position %v is not an index key", pos)
+		} else if seen[pos] {
+			return fmt.Errorf("Group key position %v is repeated", pos)
+		}
+		seen[pos] = true
+	}
+	for _, fn := range aggr.Aggrs {
+		switch fn.Type {
+		case AGG_MIN, AGG_MAX, AGG_SUM, AGG_COUNT, AGG_COUNTN:
+		default:
+			return fmt.Errorf("Aggregate function %v cannot be materialized", fn.Type)
+		}
+		if fn.KeyPos >= nkeys || (fn.KeyPos < 0 && fn.Type != AGG_COUNT) {
+			return fmt.Errorf("Aggregate %v key position %v is not an index key",
+				fn.Type, fn.KeyPos)
+		}
+	}
+	return nil
+}
+
+// IsDefaultCollection returns true if the index is defined on the default
+// collection of its bucket.
+func (idx *IndexDefn) IsDefaultCollection() bool {
+	return idx.GetCollectionId() == DEFAULT_COLLECTION_ID
+}
+
 func (idx *IndexDefn) GetNumReplica() int {
 
 	numReplica, hasValue := idx.NumReplica2.Value()
@@ -339,6 +529,7 @@ func (idx IndexInst) String() string {
 	str += fmt.Sprintf("\tStream: %v\n", idx.Stream)
 	str += fmt.Sprintf("\tVersion: %v\n", idx.Version)
 	str += fmt.Sprintf("\tReplicaId: %v\n", idx.ReplicaId)
+	str += fmt.Sprintf("\tPaused: %v\n", idx.Paused)
 	str += fmt.Sprintf("\tPartitionContainer: %v", idx.Pc)
 	return str
 
@@ -591,6 +782,16 @@ func IsEquivalentIndex(d1, d2 *IndexDefn) bool {
 		}
 	}
 
+	if len(d1.RangeBoundaries) != len(d2.RangeBoundaries) {
+		return false
+	}
+
+	for i, s1 := range d1.RangeBoundaries {
+		if s1 != d2.RangeBoundaries[i] {
+			return false
+		}
+	}
+
 	if len(d1.Desc) != len(d2.Desc) {
 		return false
 	}
@@ -601,6 +802,12 @@ func IsEquivalentIndex(d1, d2 *IndexDefn) bool {
 		}
 	}
 
+	for i := range d1.SecExprs {
+		if d1.GetCollation(i) != d2.GetCollation(i) {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -43,6 +43,7 @@ type KeyPartitionContainer struct {
 	PartitionSize int
 	scheme        PartitionScheme
 	hash          HashScheme
+	boundaries    [][]byte // collatejson encoded, for RANGE scheme
 }
 
 //NewKeyPartitionContainer initializes a new KeyPartitionContainer and returns
@@ -64,6 +65,31 @@ func NewKeyPartitionContainer(numVbuckets int, numPartitions int, scheme Partiti
 
 }
 
+//NewIndexPartitionContainer initializes a new KeyPartitionContainer for
+//index definition, along with range boundaries for RANGE partitioned index
+func NewIndexPartitionContainer(numVbuckets int, numPartitions int, defn *IndexDefn) PartitionContainer {
+
+	pc := NewKeyPartitionContainer(numVbuckets, numPartitions, defn.PartitionScheme, defn.HashScheme)
+	if defn.PartitionScheme == RANGE {
+		if err := pc.(*KeyPartitionContainer).SetRangeBoundaries(defn.RangeBoundaries); err != nil {
+			logging.Errorf("KeyPartitionContainer: Index %v invalid range boundaries: %v", defn.DefnId, err)
+		}
+	}
+	return pc
+}
+
+//SetRangeBoundaries sets the JSON encoded range boundaries used to route
+//partition keys for RANGE scheme
+func (pc *KeyPartitionContainer) SetRangeBoundaries(boundaries []string) error {
+
+	collated, err := CollateRangeBoundaries(boundaries)
+	if err != nil {
+		return err
+	}
+	pc.boundaries = collated
+	return nil
+}
+
 //AddPartition adds a partition to the container
 func (pc *KeyPartitionContainer) AddPartition(id PartitionId, p PartitionDefn) {
 	pc.PartitionMap[id] = p.(KeyPartitionDefn)
@@ -97,6 +123,15 @@ func (pc *KeyPartitionContainer) GetPartitionIdByPartitionKey(key PartitionKey)
 		return HashKeyPartition(key, pc.NumPartitions, pc.hash)
 	}
 
+	if pc.scheme == RANGE {
+		code, err := CollateRangeKey(key)
+		if err != nil {
+			logging.Errorf("KeyPartitionContainer: Invalid partition key %v: %v", logging.TagUD(string(key)), err)
+			return PartitionId(1)
+		}
+		return RangeKeyPartition(code, pc.boundaries)
+	}
+
 	return PartitionId(NON_PARTITION_ID)
 }
 
@@ -161,6 +196,7 @@ func (pc *KeyPartitionContainer) GetNumPartitions() int {
 
 func (pc *KeyPartitionContainer) Clone() PartitionContainer {
 	clone := NewKeyPartitionContainer(pc.NumVbuckets, pc.NumPartitions, pc.scheme, pc.hash)
+	clone.(*KeyPartitionContainer).boundaries = pc.boundaries
 
 	for id, partition := range pc.PartitionMap {
 		clone.AddPartition(id, partition)
@@ -38,6 +38,8 @@ const (
 	StreamBegin                    // control command
 	StreamEnd                      // control command
 	Snapshot                       // control command
+	SystemEvent                    // control command
+	UpdateSeqno                    // control command
 )
 
 type ProjectorVersion byte
@@ -312,6 +314,27 @@ func (kv *KeyVersions) AddSnapshot(typ uint32, start, end uint64) {
 	kv.addKey(uint64(typ), Snapshot, key[:8], okey[:8], nil)
 }
 
+// AddSystemEvent add SystemEvent command for collection/scope changes.
+// * event type is sent via uuid field
+// * collection-id and scope-id are big-endian encoded as key
+// * manifest-uid is big-endian encoded as old-key
+func (kv *KeyVersions) AddSystemEvent(typ uint32, manifestUID uint64,
+	scopeID, collectionID uint32) {
+
+	var key [8]byte
+	var okey [8]byte
+	binary.BigEndian.PutUint32(key[:4], collectionID)
+	binary.BigEndian.PutUint32(key[4:8], scopeID)
+	binary.BigEndian.PutUint64(okey[:8], manifestUID)
+	kv.addKey(uint64(typ), SystemEvent, key[:8], okey[:8], nil)
+}
+
+// AddUpdateSeqno add UpdateSeqno command to move the seqno of vbucket
+// forward, for mutations that are not applicable to downstream.
+func (kv *KeyVersions) AddUpdateSeqno() {
+	kv.addKey(0, UpdateSeqno, nil, nil, nil)
+}
+
 func (kv *KeyVersions) String() string {
 	s := fmt.Sprintf("`%s` - Seqno:%v\n", string(kv.Docid), kv.Seqno)
 	for i, uuid := range kv.Uuids {
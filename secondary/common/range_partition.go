@@ -0,0 +1,99 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/couchbase/indexing/secondary/collatejson"
+)
+
+// RANGE partitioning
+//
+// A RANGE partitioned index with N partitions is defined by N-1 boundary
+// values on the partition key, sorted in N1QL collation order. Partition
+// 1 holds all keys less than the first boundary, partition i holds keys
+// >= boundary[i-2] and < boundary[i-1], and partition N holds all keys
+// >= the last boundary. Missing and null partition keys sort before any
+// boundary hence they always land in partition 1.
+//
+// Boundaries and keys are compared in their collatejson encoded form.
+
+var ErrInvalidRangeBoundaries = errors.New("Range boundaries must be distinct JSON values in ascending order")
+
+var rangeCodec = collatejson.NewCodec(16)
+
+// CollateRangeBoundaries validate the JSON encoded boundaries and return
+// them collatejson encoded, to be used with RangeKeyPartition.
+func CollateRangeBoundaries(boundaries []string) ([][]byte, error) {
+	collated := make([][]byte, 0, len(boundaries))
+	for i, boundary := range boundaries {
+		// partition keys are evaluated as an array of values.
+		code, err := CollateRangeKey([]byte("[" + boundary + "]"))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid range boundary %v: %v", boundary, err)
+		}
+		if i > 0 && bytes.Compare(collated[i-1], code) >= 0 {
+			return nil, ErrInvalidRangeBoundaries
+		}
+		collated = append(collated, code)
+	}
+	return collated, nil
+}
+
+// CollateRangeKey return the collatejson encoded form of a JSON encoded
+// partition key.
+func CollateRangeKey(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+	size := 3 * len(key)
+	if size < collatejson.MinBufferSize {
+		size = collatejson.MinBufferSize
+	}
+	return rangeCodec.Encode(key, make([]byte, 0, size))
+}
+
+// RangeKeyPartition return the partition holding the collatejson encoded
+// partition `key`.
+func RangeKeyPartition(key []byte, boundaries [][]byte) PartitionId {
+	n := sort.Search(len(boundaries), func(i int) bool {
+		return bytes.Compare(boundaries[i], key) > 0
+	})
+	return PartitionId(n + 1)
+}
+
+// RangeSpanPartitions return the partitions that can hold keys between
+// collatejson encoded `low` and `high`. A nil low or high is unbounded.
+// If `inclHigh` is false, keys equal to high are excluded.
+func RangeSpanPartitions(low, high []byte, inclHigh bool,
+	boundaries [][]byte) []PartitionId {
+
+	first, last := PartitionId(1), PartitionId(len(boundaries)+1)
+	if low != nil {
+		first = RangeKeyPartition(low, boundaries)
+	}
+	if high != nil {
+		last = RangeKeyPartition(high, boundaries)
+		// high is exactly the lower bound of its partition.
+		if !inclHigh && last > first && bytes.Equal(boundaries[last-2], high) {
+			last--
+		}
+	}
+
+	partnIds := make([]PartitionId, 0, int(last)-int(first)+1)
+	for id := first; id <= last; id++ {
+		partnIds = append(partnIds, id)
+	}
+	return partnIds
+}
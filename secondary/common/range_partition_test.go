@@ -0,0 +1,78 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func collateRangeKey(t *testing.T, key string) []byte {
+	code, err := CollateRangeKey([]byte(key))
+	if err != nil {
+		t.Fatalf("collate %v: %v", key, err)
+	}
+	return code
+}
+
+func TestRangeKeyPartition(t *testing.T) {
+	boundaries, err := CollateRangeBoundaries([]string{`10`, `20`, `"a"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := map[string]PartitionId{
+		`[null]`:  1,
+		`[5]`:     1,
+		`[10]`:    2,
+		`[19.5]`:  2,
+		`[20]`:    3,
+		`[1000]`:  3,
+		`["a"]`:   4,
+		`["zzz"]`: 4,
+		`[[1]]`:   4,
+	}
+	for key, expected := range testcases {
+		if id := RangeKeyPartition(collateRangeKey(t, key), boundaries); id != expected {
+			t.Errorf("key %v expected partition %v got %v", key, expected, id)
+		}
+	}
+
+	if id := RangeKeyPartition(nil, boundaries); id != 1 {
+		t.Errorf("missing key expected partition 1 got %v", id)
+	}
+}
+
+func TestRangeSpanPartitions(t *testing.T) {
+	boundaries, err := CollateRangeBoundaries([]string{`10`, `20`, `30`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	partns := RangeSpanPartitions(collateRangeKey(t, `[12]`), collateRangeKey(t, `[25]`), true, boundaries)
+	if !reflect.DeepEqual(partns, []PartitionId{2, 3}) {
+		t.Errorf("unexpected partitions %v", partns)
+	}
+
+	partns = RangeSpanPartitions(collateRangeKey(t, `[12]`), collateRangeKey(t, `[20]`), false, boundaries)
+	if !reflect.DeepEqual(partns, []PartitionId{2}) {
+		t.Errorf("unexpected partitions %v", partns)
+	}
+
+	partns = RangeSpanPartitions(nil, collateRangeKey(t, `[20]`), true, boundaries)
+	if !reflect.DeepEqual(partns, []PartitionId{1, 2, 3}) {
+		t.Errorf("unexpected partitions %v", partns)
+	}
+
+	partns = RangeSpanPartitions(collateRangeKey(t, `[30]`), nil, true, boundaries)
+	if !reflect.DeepEqual(partns, []PartitionId{4}) {
+		t.Errorf("unexpected partitions %v", partns)
+	}
+}
+
+func TestRangeBoundariesOrder(t *testing.T) {
+	if _, err := CollateRangeBoundaries([]string{`20`, `10`}); err != ErrInvalidRangeBoundaries {
+		t.Errorf("expected error for unordered boundaries, got %v", err)
+	}
+	if _, err := CollateRangeBoundaries([]string{`10`, `10`}); err != ErrInvalidRangeBoundaries {
+		t.Errorf("expected error for duplicate boundaries, got %v", err)
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package common
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// Mergeable sketches used by approximate aggregates. Sketches computed
+// on different partitions of an index can be merged into a sketch of the
+// union of the partitions.
+
+var ErrInvalidSketch = errors.New("Invalid sketch")
+
+//-----------------------------------------------------------
+// HyperLogLog
+//-----------------------------------------------------------
+
+// 4096 registers, standard error of about 1.6%
+const hllPrecision = 12
+const hllRegisters = 1 << hllPrecision
+
+type HyperLogLog struct {
+	registers []uint8
+}
+
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{registers: make([]uint8, hllRegisters)}
+}
+
+func (h *HyperLogLog) Add(hash uint64) {
+	idx := hash >> (64 - hllPrecision)
+	w := hash<<hllPrecision | 1<<(hllPrecision-1)
+	rank := uint8(leadingZeros64(w) + 1)
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// leadingZeros64 returns the number of leading zero bits in `x`.
+func leadingZeros64(x uint64) int {
+	if x == 0 {
+		return 64
+	}
+	n := 0
+	for x&0xff00000000000000 == 0 {
+		x <<= 8
+		n += 8
+	}
+	for x&(1<<63) == 0 {
+		x <<= 1
+		n++
+	}
+	return n
+}
+
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+func (h *HyperLogLog) Count() int64 {
+	m := float64(hllRegisters)
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1.0 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha * m * m / sum
+	// small range correction
+	if estimate <= 2.5*m && zeros != 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(estimate + 0.5)
+}
+
+// Encode registers so that the sketch can be carried as a string value.
+func (h *HyperLogLog) Encode() string {
+	return base64.StdEncoding.EncodeToString(h.registers)
+}
+
+func DecodeHyperLogLog(s string) (*HyperLogLog, error) {
+	registers, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(registers) != hllRegisters {
+		return nil, ErrInvalidSketch
+	}
+	return &HyperLogLog{registers: registers}, nil
+}
+
+// HashValue hashes the JSON representation of a value.  encoding/json
+// sorts object keys, so that equal values have the same hash.
+func HashValue(val interface{}) uint64 {
+	bs, err := json.Marshal(val)
+	if err != nil {
+		return 0
+	}
+
+	h := fnv.New64a()
+	h.Write(bs)
+
+	// fnv does not mix well into the high bits, which selects
+	// the register, use the finalizer of splitmix64.
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+//-----------------------------------------------------------
+// Quantile sketch
+//-----------------------------------------------------------
+
+// QuantileSketch is a digest of weighted centroids.  Centroids are kept
+// small near the tails so that extreme quantiles are more accurate.
+type QuantileSketch struct {
+	centroids    []centroid
+	maxCentroids int
+	unmerged     int
+}
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// centroidList sorts centroids by their mean.
+type centroidList []centroid
+
+func (c centroidList) Len() int           { return len(c) }
+func (c centroidList) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c centroidList) Less(i, j int) bool { return c[i].mean < c[j].mean }
+
+const defaultMaxCentroids = 100
+
+func NewQuantileSketch() *QuantileSketch {
+	return &QuantileSketch{maxCentroids: defaultMaxCentroids}
+}
+
+func (q *QuantileSketch) Add(x float64) {
+	q.centroids = append(q.centroids, centroid{mean: x, weight: 1})
+	q.unmerged++
+	if q.unmerged > q.maxCentroids {
+		q.compress()
+	}
+}
+
+func (q *QuantileSketch) Merge(other *QuantileSketch) {
+	q.centroids = append(q.centroids, other.centroids...)
+	q.compress()
+}
+
+func (q *QuantileSketch) Count() float64 {
+	total := 0.0
+	for _, c := range q.centroids {
+		total += c.weight
+	}
+	return total
+}
+
+// Quantile returns the estimated value at quantile (0 <= quantile <= 1).
+// Returns false if the sketch is empty.
+func (q *QuantileSketch) Quantile(quantile float64) (float64, bool) {
+	q.compress()
+
+	if len(q.centroids) == 0 {
+		return 0, false
+	}
+	if len(q.centroids) == 1 {
+		return q.centroids[0].mean, true
+	}
+
+	target := quantile * q.Count()
+
+	// interpolate between the centers of adjacent centroids
+	cumulative := q.centroids[0].weight / 2
+	if target <= cumulative {
+		return q.centroids[0].mean, true
+	}
+	for i := 1; i < len(q.centroids); i++ {
+		prev, curr := q.centroids[i-1], q.centroids[i]
+		next := cumulative + (prev.weight+curr.weight)/2
+		if target <= next {
+			ratio := (target - cumulative) / (next - cumulative)
+			return prev.mean + ratio*(curr.mean-prev.mean), true
+		}
+		cumulative = next
+	}
+	return q.centroids[len(q.centroids)-1].mean, true
+}
+
+func (q *QuantileSketch) compress() {
+	q.unmerged = 0
+	if len(q.centroids) <= 1 {
+		return
+	}
+
+	sort.Sort(centroidList(q.centroids))
+
+	total := q.Count()
+	result := q.centroids[:1]
+	sofar := 0.0
+	for _, c := range q.centroids[1:] {
+		last := &result[len(result)-1]
+		quantile := (sofar + (last.weight+c.weight)/2) / total
+		limit := math.Pi * total * math.Sqrt(quantile*(1-quantile)) / float64(q.maxCentroids)
+		if last.weight+c.weight <= limit {
+			last.mean += (c.mean - last.mean) * c.weight / (last.weight + c.weight)
+			last.weight += c.weight
+		} else {
+			sofar += last.weight
+			result = append(result, c)
+		}
+	}
+	q.centroids = result
+}
+
+// Encode centroids as a list of [mean, weight] pairs.
+func (q *QuantileSketch) Encode() []interface{} {
+	q.compress()
+
+	encoded := make([]interface{}, len(q.centroids))
+	for i, c := range q.centroids {
+		encoded[i] = []interface{}{c.mean, c.weight}
+	}
+	return encoded
+}
+
+func DecodeQuantileSketch(encoded []interface{}) (*QuantileSketch, error) {
+	q := NewQuantileSketch()
+	for _, e := range encoded {
+		pair, ok := e.([]interface{})
+		if !ok || len(pair) != 2 {
+			return nil, ErrInvalidSketch
+		}
+		mean, ok1 := toFloat64(pair[0])
+		weight, ok2 := toFloat64(pair[1])
+		if !ok1 || !ok2 {
+			return nil, ErrInvalidSketch
+		}
+		q.centroids = append(q.centroids, centroid{mean: mean, weight: weight})
+	}
+	return q, nil
+}
+
+func toFloat64(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
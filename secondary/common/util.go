@@ -747,6 +747,29 @@ func GetBucketUUID(cluster, bucket string) (string, error) {
 	return cinfo.GetBucketUUID(bucket), nil
 }
 
+// GetCollectionID returns the hex encoded scope and collection id for
+// collection in bucket. Default collection is present in every bucket,
+// including buckets created before collections were supported.
+func GetCollectionID(cluster, bucket, scope, collection string) (string, string, error) {
+
+	if (scope == "" || scope == DEFAULT_SCOPE) &&
+		(collection == "" || collection == DEFAULT_COLLECTION) {
+		return DEFAULT_SCOPE_ID, DEFAULT_COLLECTION_ID, nil
+	}
+
+	b, err := ConnectBucket(cluster, DEFAULT_POOL, bucket)
+	if err != nil {
+		return "", "", err
+	}
+	defer b.Close()
+
+	manifest, err := b.GetCollectionsManifest()
+	if err != nil {
+		return "", "", err
+	}
+	return manifest.GetCollectionID(scope, collection)
+}
+
 func FileSize(name string) (int64, error) {
 	f, err := os.Open(name)
 	if err != nil {
@@ -814,6 +837,20 @@ func Console(clusterAddr string, format string, v ...interface{}) error {
 	return err
 }
 
+// GetClientAuthConfig returns client certificate authentication settings
+// from "security.clientAuth" section of system config.
+func GetClientAuthConfig(config Config) security.ClientAuthConfig {
+	interval := config["security.clientAuth.reloadInterval"].Int()
+	return security.ClientAuthConfig{
+		CAFile:              config["security.clientAuth.caFile"].String(),
+		Required:            config["security.clientAuth.required"].Bool(),
+		IdentityMap:         config["security.clientAuth.identityMap"].String(),
+		QueryportIdentities: config["security.clientAuth.queryportIdentities"].String(),
+		DataportIdentities:  config["security.clientAuth.dataportIdentities"].String(),
+		ReloadInterval:      time.Duration(interval) * time.Second,
+	}
+}
+
 func CopyFile(dest, source string) (err error) {
 	var sf, df *os.File
 
@@ -20,6 +20,8 @@ var commandNames = map[byte]string{
 	c.StreamBegin:    "StreamBegin",
 	c.StreamEnd:      "StreamEnd",
 	c.Snapshot:       "Snapshot",
+	c.SystemEvent:    "SystemEvent",
+	c.UpdateSeqno:    "UpdateSeqno",
 }
 
 // Application starts a new dataport application to receive mutations from the
@@ -124,7 +126,7 @@ func processMutations(
 				}
 				commandWise[cmd]++
 
-				if cmd == 0 || cmd == c.Snapshot || uuid == 0 || key == "" {
+				if cmd == 0 || cmd == c.Snapshot || cmd == c.SystemEvent || uuid == 0 || key == "" {
 					continue
 				}
 
@@ -369,6 +369,11 @@ func (c *Client) runTransmitter(
 	pkt := transport.NewTransportPacket(c.maxPayload, flags)
 	pkt.SetEncoder(transport.EncodingProtobuf, protobufEncode)
 	pkt.SetDecoder(transport.EncodingProtobuf, protobufDecode)
+	defer func() {
+		uncompressed, compressed := pkt.CompressionStats()
+		fmsg := "%v transmitter %q payload bytes %v compressed to %v\n"
+		logging.Infof(fmsg, logPrefix, laddr, uncompressed, compressed)
+	}()
 
 	transmit := func(payload interface{}) bool {
 		if err := pkt.Send(conn, payload); err != nil {
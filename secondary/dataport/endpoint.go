@@ -72,6 +72,9 @@ type EndpointStats struct {
 	flushCount  stats.Uint64Val
 	prjLatency  stats.Average
 	endpChLen   stats.Uint64Val
+	// payload bytes before and after compression
+	uncompressed stats.Uint64Val
+	compressed   stats.Uint64Val
 }
 
 func (stats *EndpointStats) Init() {
@@ -87,6 +90,8 @@ func (stats *EndpointStats) Init() {
 	stats.flushCount.Init()
 	stats.prjLatency.Init()
 	stats.endpChLen.Init()
+	stats.uncompressed.Init()
+	stats.compressed.Init()
 }
 
 func (stats *EndpointStats) IsClosed() bool {
@@ -94,7 +99,7 @@ func (stats *EndpointStats) IsClosed() bool {
 }
 
 func (stats *EndpointStats) String() string {
-	var stitems [14]string
+	var stitems [16]string
 	stitems[0] = `"mutCount":` + strconv.FormatUint(stats.mutCount.Value(), 10)
 	stitems[1] = `"upsertCount":` + strconv.FormatUint(stats.upsertCount.Value(), 10)
 	stitems[2] = `"deleteCount":` + strconv.FormatUint(stats.deleteCount.Value(), 10)
@@ -109,6 +114,8 @@ func (stats *EndpointStats) String() string {
 	stitems[11] = `"latency.avg":` + strconv.FormatInt(stats.prjLatency.Mean(), 10)
 	stitems[12] = `"latency.movingAvg":` + strconv.FormatInt(stats.prjLatency.MovingAvg(), 10)
 	stitems[13] = `"endpChLen":` + strconv.FormatUint(stats.endpChLen.Value(), 10)
+	stitems[14] = `"bytesUncompressed":` + strconv.FormatUint(stats.uncompressed.Value(), 10)
+	stitems[15] = `"bytesCompressed":` + strconv.FormatUint(stats.compressed.Value(), 10)
 	statjson := strings.Join(stitems[:], ",")
 	return fmt.Sprintf("{%v}", statjson)
 }
@@ -140,8 +147,13 @@ func NewRouterEndpoint(
 	endpoint.stats.Init()
 	endpoint.ch = make(chan []interface{}, endpoint.keyChSize)
 	endpoint.conn = conn
-	// TODO: add configuration params for transport flags.
 	flags := transport.TransportFlag(0).SetProtobuf()
+	compression, err := transport.CompressionFromString(config["compression"].String())
+	if err != nil {
+		fmsg := "ENDP[<-%v #%v] invalid compression %q, sending uncompressed\n"
+		logging.Errorf(fmsg, raddr, topic, config["compression"].String())
+	}
+	flags = flags.SetCompression(compression)
 	maxPayload := config["maxPayload"].Int()
 	endpoint.pkt = transport.NewTransportPacket(maxPayload, flags)
 	endpoint.pkt.SetEncoder(transport.EncodingProtobuf, protobufEncode)
@@ -275,6 +287,9 @@ func (endpoint *RouterEndpoint) run(ch chan []interface{}) {
 				logging.Errorf("%v flushBuffers() %v\n", endpoint.logPrefix, err)
 			}
 			endpoint.stats.flushCount.Add(1)
+			uncompressed, compressed := endpoint.pkt.CompressionStats()
+			endpoint.stats.uncompressed.Set(uncompressed)
+			endpoint.stats.compressed.Set(compressed)
 		}
 		messageCount = 0
 		return
@@ -142,6 +142,7 @@ type Server struct {
 	genChSize    int           // channel size for genServer routine
 	maxPayload   int           // maximum payload length from router
 	readDeadline time.Duration // timeout, in millisecond, reading from socket
+	drainTimeout time.Duration // timeout, in second, draining connections on reset
 	logPrefix    string
 
 	mu sync.Mutex
@@ -170,10 +171,11 @@ func NewServer(
 		genChSize:    genChSize,
 		maxPayload:   config["maxPayload"].Int(),
 		readDeadline: time.Duration(config["tcpReadDeadline"].Int()),
+		drainTimeout: time.Duration(config["drainTimeout"].Int()),
 	}
 	s.logPrefix = fmt.Sprintf("DATP[->dataport %q]", laddr)
 
-	if s.lis, err = security.MakeListener(laddr); err != nil {
+	if s.lis, err = security.MakeClientAuthListener(laddr); err != nil {
 		logging.Errorf("%v failed starting! %v\n", s.logPrefix, err)
 		return nil, err
 	}
@@ -429,9 +431,23 @@ func (s *Server) handleResetConnections() error {
 		}
 	}()
 
-	// close connections (simulate network partition)
+	// connections authenticated with the earlier setting are allowed to
+	// stream until drainTimeout, then closed (simulate network partition).
+	conns := make([]net.Conn, 0, len(s.conns))
 	for _, nc := range s.conns {
-		nc.conn.Close()
+		conns = append(conns, nc.conn)
+	}
+	closeConns := func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+	if s.drainTimeout > 0 && len(conns) > 0 {
+		fmsg := "%v draining %v connections in %vs\n"
+		logging.Infof(fmsg, s.logPrefix, len(conns), int64(s.drainTimeout))
+		time.AfterFunc(s.drainTimeout*time.Second, closeConns)
+	} else {
+		closeConns()
 	}
 
 	// restart listener
@@ -440,7 +456,7 @@ func (s *Server) handleResetConnections() error {
 		s.mu.Lock()
 		defer s.mu.Unlock()
 
-		if s.lis, err = security.MakeListener(s.laddr); err != nil {
+		if s.lis, err = security.MakeClientAuthListener(s.laddr); err != nil {
 			logging.Errorf("%v failed starting listener %v! %v\n", s.logPrefix, s.laddr, err)
 			return err
 		}
@@ -557,7 +573,9 @@ func closeConnection(prefix, raddr string, nc *netConn) {
 	}()
 	close(nc.worker)
 	nc.conn.Close()
-	logging.Infof("%v connection %q closed !\n", prefix, raddr)
+	uncompressed, compressed := nc.tpkt.CompressionStats()
+	fmsg := "%v connection %q closed ! payload bytes %v compressed to %v\n"
+	logging.Infof(fmsg, prefix, raddr, uncompressed, compressed)
 }
 
 // get all remote connections for `host`
@@ -589,7 +607,7 @@ func (s *Server) listener() {
 
 		if s.lis != nil && lis == s.lis { // if s.lis == nil, then Server.Close() was called
 			s.lis.Close()
-			if s.lis, err = security.MakeListener(s.laddr); err != nil {
+			if s.lis, err = security.MakeClientAuthListener(s.laddr); err != nil {
 				logging.Errorf("%v failed starting %v !!\n", s.logPrefix, err)
 				panic(err)
 			}
@@ -617,16 +635,36 @@ func (s *Server) listener() {
 			break //After loop breaks, selfRestart() is called in defer
 
 		} else {
-			msg := serverMessage{
-				cmd:   serverCmdNewConnection,
-				raddr: conn.RemoteAddr().String(),
-				args:  []interface{}{conn},
-			}
-			s.reqch <- []interface{}{msg}
+			go s.handshake(conn)
 		}
 	}
 }
 
+// authenticate a new connection and hand it over to gen-server.
+func (s *Server) handshake(conn net.Conn) {
+	raddr := conn.RemoteAddr().String()
+	identity, err := security.ServerHandshake(conn, security.DataportListener)
+	if err != nil {
+		logging.Errorf("%v %v\n", s.logPrefix, err)
+		conn.Close()
+		return
+	} else if identity != "" {
+		fmsg := "%v connection %q authenticated as %q\n"
+		logging.Infof(fmsg, s.logPrefix, raddr, identity)
+	}
+
+	msg := serverMessage{
+		cmd:   serverCmdNewConnection,
+		raddr: raddr,
+		args:  []interface{}{conn},
+	}
+	select {
+	case s.reqch <- []interface{}{msg}:
+	case <-s.finch:
+		conn.Close()
+	}
+}
+
 // per connection go-routine to read []*VbKeyVersions.
 func doReceive(
 	prefix string,
@@ -37,6 +37,52 @@ func TestPktKeyVersions(t *testing.T) {
 	}
 }
 
+func TestPktCompressedKeyVersions(t *testing.T) {
+	seqno, nVbs, nMuts, nIndexes := 1, 20, 5, 5
+	vbsRef := constructVbKeyVersions("default", seqno, nVbs, nMuts, nIndexes)
+	for _, compression := range transport.Compressions {
+		tc := newTestConnection()
+		tc.reset()
+		flags := transport.TransportFlag(0).SetProtobuf()
+		flags = flags.SetCompression(compression)
+		pkt := transport.NewTransportPacket(1000*1024, flags)
+		pkt.SetEncoder(transport.EncodingProtobuf, protobufEncode)
+		pkt.SetDecoder(transport.EncodingProtobuf, protobufDecode)
+
+		if err := pkt.Send(tc, vbsRef); err != nil { // Send reference
+			t.Fatal(err)
+		}
+		uncompressed, compressed := pkt.CompressionStats()
+		if compressed >= uncompressed {
+			t.Fatalf("%v: expected compression, %v -> %v",
+				transport.CompressionString(compression), uncompressed, compressed)
+		}
+
+		// receive with a packet configured without compression.
+		rflags := transport.TransportFlag(0).SetProtobuf()
+		rpkt := transport.NewTransportPacket(1000*1024, rflags)
+		rpkt.SetEncoder(transport.EncodingProtobuf, protobufEncode)
+		rpkt.SetDecoder(transport.EncodingProtobuf, protobufDecode)
+		if payload, err := rpkt.Receive(tc); err != nil { // Receive reference
+			t.Fatal(err)
+		} else { // compare both
+			val := payload.([]*protobuf.VbKeyVersions)
+			vbs := protobuf2VbKeyVersions(val)
+			if len(vbsRef) != len(vbs) {
+				t.Fatal("Mismatch in length")
+			}
+			for i, vb := range vbs {
+				if vb.Equal(vbsRef[i]) == false {
+					t.Fatal("Mismatch in VbKeyVersions")
+				}
+			}
+		}
+		if u, c := rpkt.CompressionStats(); u != uncompressed || c != compressed {
+			t.Fatalf("Mismatch in stats %v,%v != %v,%v", u, c, uncompressed, compressed)
+		}
+	}
+}
+
 func TestPktVbmap(t *testing.T) {
 	vbmapRef := &c.VbConnectionMap{
 		Bucket:   "default",
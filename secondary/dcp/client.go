@@ -537,6 +537,27 @@ func (b *Bucket) AddRaw(k string, exp int, v []byte) (added bool, err error) {
 	return (err == nil), err
 }
 
+// AddRawCas is AddRaw that also returns the CAS of the added item.
+func (b *Bucket) AddRawCas(k string, exp int, v []byte) (cas uint64, added bool, err error) {
+	if ClientOpCallback != nil {
+		defer func(t time.Time) { ClientOpCallback("AddRawCas", k, t, err) }(time.Now())
+	}
+
+	err = b.Do(k, func(mc *memcached.Client, vb uint16) error {
+		res, err := memcached.UnwrapMemcachedError(mc.Add(vb, k, 0, exp, v))
+		if err != nil {
+			return err
+		} else if res.Status == transport.KEY_EEXISTS {
+			return nil
+		} else if res.Status != transport.SUCCESS {
+			return res
+		}
+		cas, added = res.Cas, true
+		return nil
+	})
+	return
+}
+
 // Append appends raw data to an existing item.
 func (b *Bucket) Append(k string, data []byte) error {
 	return b.Write(k, 0, 0, data, Append|Raw)
@@ -598,6 +619,18 @@ func (b *Bucket) Delete(k string) error {
 	return b.Write(k, 0, 0, nil, Raw)
 }
 
+// DeleteCas deletes a key from this bucket if its CAS matches `cas`.
+func (b *Bucket) DeleteCas(k string, cas uint64) (err error) {
+	if ClientOpCallback != nil {
+		defer func(t time.Time) { ClientOpCallback("DeleteCas", k, t, err) }(time.Now())
+	}
+
+	return b.Do(k, func(mc *memcached.Client, vb uint16) error {
+		_, err := mc.DelCas(vb, k, cas)
+		return err
+	})
+}
+
 // Incr increments the value at a given key.
 func (b *Bucket) Incr(k string, amt, def uint64, exp int) (val uint64, err error) {
 	if ClientOpCallback != nil {
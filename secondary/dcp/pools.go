@@ -508,6 +508,52 @@ func (b *Bucket) Refresh() error {
 	return nil
 }
 
+// ErrorNoCollection
+var ErrorNoCollection = errors.New("dcp.noCollection")
+
+// Manifest of scopes and collections in a bucket, ids are hex encoded.
+type Manifest struct {
+	UID    string          `json:"uid"`
+	Scopes []ManifestScope `json:"scopes"`
+}
+
+type ManifestScope struct {
+	UID         string               `json:"uid"`
+	Name        string               `json:"name"`
+	Collections []ManifestCollection `json:"collections"`
+}
+
+type ManifestCollection struct {
+	UID  string `json:"uid"`
+	Name string `json:"name"`
+}
+
+// GetCollectionsManifest fetches the collections manifest of bucket.
+func (b *Bucket) GetCollectionsManifest() (*Manifest, error) {
+	manifest := &Manifest{}
+	path := "/pools/default/buckets/" + b.Name + "/scopes"
+	if err := b.pool.client.parseURLResponse(path, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// GetCollectionID returns the scope and collection id, ErrorNoCollection
+// if the collection does not exist in the manifest.
+func (m *Manifest) GetCollectionID(scope, collection string) (string, string, error) {
+	for _, s := range m.Scopes {
+		if s.Name != scope {
+			continue
+		}
+		for _, c := range s.Collections {
+			if c.Name == collection {
+				return s.UID, c.UID, nil
+			}
+		}
+	}
+	return "", "", ErrorNoCollection
+}
+
 func (b *Bucket) init(nb *Bucket) {
 	connHost, _, _ := net.SplitHostPort(b.pool.client.BaseURL.Host)
 	for i := range nb.NodesJSON {
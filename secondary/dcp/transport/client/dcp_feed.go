@@ -6,6 +6,7 @@ package memcached
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -17,6 +18,7 @@ import (
 	"github.com/couchbase/indexing/secondary/dcp/transport"
 	"github.com/couchbase/indexing/secondary/logging"
 	"github.com/couchbase/indexing/secondary/stats"
+	"github.com/golang/snappy"
 )
 
 const dcpMutationExtraLen = 16
@@ -24,9 +26,11 @@ const bufferAckThreshold = 0.2
 const opaqueOpen = 0xBEAF0001
 const opaqueFailover = 0xDEADBEEF
 const opaqueGetseqno = 0xDEADBEEF
+const opaqueHelo = 0xBEAF0002
 const openConnFlag = uint32(0x1)
 const includeXATTR = uint32(0x4)
 const dcpJSON = uint8(0x1)
+const dcpSnappy = uint8(0x2)
 const dcpXATTR = uint8(0x4)
 const bufferAckPeriod = 20
 
@@ -39,6 +43,9 @@ var ErrorConnection = errors.New("dcp.connection")
 // ErrorInvalidFeed
 var ErrorInvalidFeed = errors.New("dcp.invalidFeed")
 
+// ErrorCollectionsNotEnabled
+var ErrorCollectionsNotEnabled = errors.New("dcp.collectionsNotEnabled")
+
 // DcpFeed represents an DCP feed. A feed contains a connection to a single
 // host and multiple vBuckets
 type DcpFeed struct {
@@ -58,6 +65,12 @@ type DcpFeed struct {
 	stats              *DcpStats // Stats for dcp client
 	done               uint32
 	enableReadDeadline int32 // 0 => Read deadline is disabled in doReceive, 1 => enabled
+	// collections are requested via config and negotiated with HELO
+	// while opening the connection.
+	collectionsAware bool
+	// snappy compressed values are requested via config and negotiated
+	// with HELO, values are inflated by the consumer of the feed.
+	snappy bool
 }
 
 // NewDcpFeed creates a new DCP Feed.
@@ -78,6 +91,12 @@ func NewDcpFeed(
 		logPrefix: fmt.Sprintf("DCPT[%s]", name),
 		stats:     &DcpStats{},
 	}
+	if val, ok := config["collectionsAware"]; ok && val != nil {
+		feed.collectionsAware = val.(bool)
+	}
+	if val, ok := config["snappy"]; ok && val != nil {
+		feed.snappy = val.(bool)
+	}
 	feed.stats.Init()
 	mc.Hijack()
 	feed.conn = mc
@@ -143,14 +162,31 @@ func (feed *DcpFeed) DcpGetSeqnos() (map[uint16]uint64, error) {
 	return resp[0].(map[uint16]uint64), nil
 }
 
+// IsCollectionsAware returns true if collections were negotiated with
+// the DCP producer, valid only after DcpOpen.
+func (feed *DcpFeed) IsCollectionsAware() bool {
+	return feed.collectionsAware
+}
+
 // DcpRequestStream for a single vbucket.
 func (feed *DcpFeed) DcpRequestStream(vbno, opaqueMSB uint16, flags uint32,
 	vuuid, startSequence, endSequence, snapStart, snapEnd uint64) error {
 
+	return feed.DcpRequestStreamWithCollections(vbno, opaqueMSB, flags,
+		vuuid, startSequence, endSequence, snapStart, snapEnd, nil)
+}
+
+// DcpRequestStreamWithCollections for a single vbucket, streaming only
+// the mutations of listed collections. Collection ids are hex encoded,
+// as in the bucket manifest. An empty list streams all collections.
+func (feed *DcpFeed) DcpRequestStreamWithCollections(vbno, opaqueMSB uint16,
+	flags uint32, vuuid, startSequence, endSequence, snapStart, snapEnd uint64,
+	collectionIds []string) error {
+
 	respch := make(chan []interface{}, 1)
 	cmd := []interface{}{
 		dfCmdRequestStream, vbno, opaqueMSB, flags, vuuid,
-		startSequence, endSequence, snapStart, snapEnd, respch}
+		startSequence, endSequence, snapStart, snapEnd, collectionIds, respch}
 	resp, err := failsafeOp(feed.reqch, respch, cmd, feed.finch)
 	return opError(err, resp, 0)
 }
@@ -253,10 +289,12 @@ loop:
 				flags, vuuid := msg[3].(uint32), msg[4].(uint64)
 				startSequence, endSequence := msg[5].(uint64), msg[6].(uint64)
 				snapStart, snapEnd := msg[7].(uint64), msg[8].(uint64)
-				respch := msg[9].(chan []interface{})
+				collectionIds := msg[9].([]string)
+				respch := msg[10].(chan []interface{})
 				err := feed.doDcpRequestStream(
 					vbno, opaqueMSB, flags, vuuid,
-					startSequence, endSequence, snapStart, snapEnd)
+					startSequence, endSequence, snapStart, snapEnd,
+					collectionIds)
 				respch <- []interface{}{err}
 
 			case dfCmdCloseStream:
@@ -329,7 +367,13 @@ func (feed *DcpFeed) handlePacket(
 		return "ok" // yeah it not _my_ mistake...
 	}
 
-	defer func() { feed.stats.Dcplatency.Add(computeLatency(stream)) }()
+	defer func() {
+		latency := computeLatency(stream)
+		feed.stats.Dcplatency.Add(latency)
+		if latency > 0 {
+			feed.stats.DcplatencyDist.Add(latency)
+		}
+	}()
 
 	stream.LastSeen = time.Now().UnixNano()
 	switch pkt.Opcode {
@@ -345,6 +389,21 @@ func (feed *DcpFeed) handlePacket(
 		feed.stats.TotalMutation.Add(1)
 		sendAck = true
 
+	case transport.DCP_SYSTEM_EVENT:
+		event = newDcpEvent(pkt, stream)
+		stream.Seqno = event.Seqno
+		feed.stats.TotalSystemEvent.Add(1)
+		sendAck = true
+		fmsg := "%v ##%x DCP_SYSTEM_EVENT %v for vb %d collection %x\n"
+		logging.Infof(fmsg, prefix, stream.AppOpaque, event.EventType, vb,
+			event.CollectionID)
+
+	case transport.DCP_SEQNO_ADVANCED:
+		event = newDcpEvent(pkt, stream)
+		stream.Seqno = event.Seqno
+		feed.stats.TotalSeqnoAdvanced.Add(1)
+		sendAck = true
+
 	case transport.DCP_STREAMEND:
 		event = newDcpEvent(pkt, stream)
 		sendAck = true
@@ -556,6 +615,12 @@ func (feed *DcpFeed) doDcpOpen(
 	opaque uint16,
 	rcvch chan []interface{}) error {
 
+	if feed.collectionsAware || feed.snappy {
+		if err := feed.doHelo(name, opaque, rcvch); err != nil {
+			return err
+		}
+	}
+
 	rq := &transport.MCRequest{
 		Opcode: transport.DCP_OPEN,
 		Key:    []byte(name),
@@ -724,15 +789,106 @@ func (feed *DcpFeed) doDcpOpen(
 	return nil
 }
 
+// doHelo negotiates collections and datatypes with the DCP producer, if
+// the producer does not support collections the feed falls back to the
+// default collection, if it does not support snappy values are streamed
+// uncompressed.
+func (feed *DcpFeed) doHelo(
+	name string, opaque uint16, rcvch chan []interface{}) error {
+
+	prefix := feed.logPrefix
+
+	features := []transport.Feature{transport.FeatureXattr}
+	if feed.collectionsAware {
+		features = append(features, transport.FeatureCollections)
+	}
+	if feed.snappy {
+		features = append(features,
+			transport.FeatureJSON, transport.FeatureSnappy)
+	}
+
+	rq := &transport.MCRequest{
+		Opcode: transport.HELO,
+		Key:    []byte(name),
+		Opaque: opaqueHelo,
+	}
+	rq.Body = make([]byte, 2*len(features))
+	for i, feature := range features {
+		binary.BigEndian.PutUint16(rq.Body[2*i:], uint16(feature))
+	}
+
+	feed.conn.SetMcdConnectionDeadline()
+	defer feed.conn.ResetMcdConnectionDeadline()
+
+	if err := feed.conn.Transmit(rq); err != nil {
+		fmsg := "%v ##%x doHelo.Transmit(): %v"
+		logging.Errorf(fmsg, prefix, opaque, err)
+		return err
+	}
+	feed.stats.LastMsgSend.Set(time.Now().UnixNano())
+	msg, ok := <-rcvch
+	if !ok {
+		logging.Errorf("%v ##%x doHelo.rcvch closed", prefix, opaque)
+		return ErrorConnection
+	}
+	pkt := msg[0].(*transport.MCRequest)
+	opcode, status := pkt.Opcode, transport.Status(pkt.VBucket)
+	if opcode != transport.HELO {
+		logging.Errorf("%v ##%x doHelo unexpected #%v", prefix, opaque, opcode)
+		return ErrorConnection
+	} else if status != transport.SUCCESS {
+		fmsg := "%v ##%x doHelo response status %v"
+		logging.Errorf(fmsg, prefix, opaque, status)
+		return ErrorConnection
+	}
+
+	wantCollections, wantSnappy := feed.collectionsAware, feed.snappy
+	feed.collectionsAware, feed.snappy = false, false
+	for i := 0; i+2 <= len(pkt.Body); i += 2 {
+		feature := transport.Feature(binary.BigEndian.Uint16(pkt.Body[i:]))
+		switch feature {
+		case transport.FeatureCollections:
+			feed.collectionsAware = wantCollections
+		case transport.FeatureSnappy:
+			feed.snappy = wantSnappy
+		}
+	}
+	if wantCollections && !feed.collectionsAware {
+		fmsg := "%v ##%x collections not supported by producer, " +
+			"streaming default collection"
+		logging.Warnf(fmsg, prefix, opaque)
+	} else if feed.collectionsAware {
+		logging.Infof("%v ##%x collections enabled", prefix, opaque)
+	}
+	if wantSnappy && !feed.snappy {
+		fmsg := "%v ##%x snappy not supported by producer, " +
+			"streaming uncompressed values"
+		logging.Warnf(fmsg, prefix, opaque)
+	} else if feed.snappy {
+		logging.Infof("%v ##%x snappy enabled", prefix, opaque)
+	}
+	return nil
+}
+
 func (feed *DcpFeed) doDcpRequestStream(
 	vbno, opaqueMSB uint16, flags uint32,
-	vuuid, startSequence, endSequence, snapStart, snapEnd uint64) error {
+	vuuid, startSequence, endSequence, snapStart, snapEnd uint64,
+	collectionIds []string) error {
 
 	rq := &transport.MCRequest{
 		Opcode:  transport.DCP_STREAMREQ,
 		VBucket: vbno,
 		Opaque:  composeOpaque(vbno, opaqueMSB),
 	}
+	if len(collectionIds) > 0 {
+		if !feed.collectionsAware {
+			return ErrorCollectionsNotEnabled
+		}
+		filter := struct {
+			Collections []string `json:"collections"`
+		}{collectionIds}
+		rq.Body, _ = json.Marshal(&filter)
+	}
 	rq.Extras = make([]byte, 48) // #Extras
 	binary.BigEndian.PutUint32(rq.Extras[:4], flags)
 	binary.BigEndian.PutUint32(rq.Extras[4:8], uint32(0))
@@ -758,11 +914,12 @@ func (feed *DcpFeed) doDcpRequestStream(
 	}
 	feed.stats.LastMsgSend.Set(time.Now().UnixNano())
 	stream := &DcpStream{
-		AppOpaque: opaqueMSB,
-		Vbucket:   vbno,
-		Vbuuid:    vuuid,
-		StartSeq:  startSequence,
-		EndSeq:    endSequence,
+		AppOpaque:        opaqueMSB,
+		Vbucket:          vbno,
+		Vbuuid:           vuuid,
+		StartSeq:         startSequence,
+		EndSeq:           endSequence,
+		CollectionsAware: feed.collectionsAware,
 	}
 	feed.vbstreams[vbno] = stream
 	return nil
@@ -918,6 +1075,8 @@ type DcpStream struct {
 	Snapend     uint64
 	LastSeen    int64 // UnixNano value of last seen
 	connected   bool
+	// document keys are prefixed with collection-id
+	CollectionsAware bool
 }
 
 // DcpEvent memcached events for DCP streams.
@@ -951,6 +1110,11 @@ type DcpEvent struct {
 	// extended attributes
 	RawXATTR    map[string][]byte
 	ParsedXATTR map[string]interface{}
+	// collections
+	CollectionID uint32                    // collection of the document
+	ScopeID      uint32                    // for DCP_SYSTEM_EVENT
+	ManifestUID  uint64                    // for DCP_SYSTEM_EVENT
+	EventType    transport.SystemEventType // for DCP_SYSTEM_EVENT
 }
 
 func newDcpEvent(rq *transport.MCRequest, stream *DcpStream) (event *DcpEvent) {
@@ -971,8 +1135,17 @@ func newDcpEvent(rq *transport.MCRequest, stream *DcpStream) (event *DcpEvent) {
 		VBuuid:   stream.Vbuuid,
 		Ctime:    time.Now().UnixNano(),
 	}
-	event.Key = make([]byte, len(rq.Key))
-	copy(event.Key, rq.Key)
+	key := rq.Key
+	if stream.CollectionsAware {
+		switch event.Opcode {
+		case transport.DCP_MUTATION, transport.DCP_DELETION,
+			transport.DCP_EXPIRATION:
+			cid, n := decodeLeb128(key)
+			event.CollectionID, key = cid, key[n:]
+		}
+	}
+	event.Key = make([]byte, len(key))
+	copy(event.Key, key)
 
 	// 16 LSBits are used by client library to encode vbucket number.
 	// 16 MSBits are left for application to multiplex on opaque value.
@@ -995,6 +1168,16 @@ func newDcpEvent(rq *transport.MCRequest, stream *DcpStream) (event *DcpEvent) {
 			event.RevSeqno = binary.BigEndian.Uint64(rq.Extras[8:])
 		}
 
+	} else if len(rq.Extras) >= 8 &&
+		(event.Opcode == transport.DCP_SYSTEM_EVENT ||
+			event.Opcode == transport.DCP_SEQNO_ADVANCED) {
+
+		event.Seqno = binary.BigEndian.Uint64(rq.Extras[:8])
+		if event.Opcode == transport.DCP_SYSTEM_EVENT {
+			event.parseSystemEvent(rq)
+		}
+		return event
+
 	} else if len(rq.Extras) >= tapMutationExtraLen &&
 		event.Opcode == transport.DCP_SNAPSHOT {
 
@@ -1003,10 +1186,25 @@ func newDcpEvent(rq *transport.MCRequest, stream *DcpStream) (event *DcpEvent) {
 		event.SnapshotType = binary.BigEndian.Uint32(rq.Extras[16:20])
 	}
 
+	if event.IsSnappy() {
+		// XATTRs are part of the compressed body, they are parsed
+		// when the value is inflated.
+		event.Value = make([]byte, len(rq.Body))
+		copy(event.Value, rq.Body)
+	} else {
+		event.setValue(rq.Body)
+	}
+
+	return event
+}
+
+// setValue copies the uncompressed body as the event's value, splitting
+// the extended attributes, if any, from the document.
+func (event *DcpEvent) setValue(body []byte) {
 	if (event.Opcode == transport.DCP_MUTATION ||
 		event.Opcode == transport.DCP_DELETION) && event.HasXATTR() {
-		xattrLen := int(binary.BigEndian.Uint32(rq.Body))
-		xattrData := rq.Body[4 : 4+xattrLen]
+		xattrLen := int(binary.BigEndian.Uint32(body))
+		xattrData := body[4 : 4+xattrLen]
 		event.RawXATTR = make(map[string][]byte, xattrLen)
 		for len(xattrData) > 0 {
 			pairLen := binary.BigEndian.Uint32(xattrData[0:])
@@ -1016,14 +1214,77 @@ func newDcpEvent(rq *transport.MCRequest, stream *DcpStream) (event *DcpEvent) {
 			kvPair := bytes.Split(binaryPair, []byte{0x00})
 			event.RawXATTR[string(kvPair[0])] = kvPair[1]
 		}
-		event.Value = make([]byte, len(rq.Body)-(4+xattrLen))
-		copy(event.Value, rq.Body[4+xattrLen:])
+		event.Value = make([]byte, len(body)-(4+xattrLen))
+		copy(event.Value, body[4+xattrLen:])
 	} else {
-		event.Value = make([]byte, len(rq.Body))
-		copy(event.Value, rq.Body)
+		event.Value = make([]byte, len(body))
+		copy(event.Value, body)
 	}
+}
 
-	return event
+// Inflate decompresses a snappy compressed value in place and parses its
+// extended attributes. Returns the size of the inflated body. On error
+// the value is treated as an empty binary document.
+func (event *DcpEvent) Inflate() (n int, err error) {
+	if !event.IsSnappy() {
+		return len(event.Value), nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			// Error parsing XATTR, inflated body might be malformed
+			err = fmt.Errorf("%v", r)
+		}
+		if err != nil {
+			event.Value = make([]byte, 0)
+			event.RawXATTR = nil
+			event.Datatype &= ^(dcpXATTR | dcpJSON)
+		}
+	}()
+
+	body, err := snappy.Decode(nil, event.Value)
+	event.Datatype &= ^dcpSnappy
+	if err != nil {
+		return 0, err
+	}
+	event.setValue(body)
+	return len(body), nil
+}
+
+// parseSystemEvent decodes the extras {seqno, event, version} and the
+// value {manifest-uid, scope-id, [collection-id]} of DCP_SYSTEM_EVENT.
+func (event *DcpEvent) parseSystemEvent(rq *transport.MCRequest) {
+	if len(rq.Extras) >= 12 {
+		event.EventType = transport.SystemEventType(
+			binary.BigEndian.Uint32(rq.Extras[8:12]))
+	}
+	if len(rq.Body) >= 12 {
+		event.ManifestUID = binary.BigEndian.Uint64(rq.Body[0:8])
+		event.ScopeID = binary.BigEndian.Uint32(rq.Body[8:12])
+	}
+	switch event.EventType {
+	case transport.COLLECTION_CREATE, transport.COLLECTION_DROP,
+		transport.COLLECTION_FLUSH:
+		if len(rq.Body) >= 16 {
+			event.CollectionID = binary.BigEndian.Uint32(rq.Body[12:16])
+		}
+	}
+}
+
+// decodeLeb128 returns the unsigned LEB128 encoded collection-id prefixed
+// to the document key, along with the number of bytes consumed.
+func decodeLeb128(buf []byte) (uint32, int) {
+	var value uint32
+	for i, b := range buf {
+		value |= uint32(b&0x7f) << uint(7*i)
+		if b&0x80 == 0 {
+			return value, i + 1
+		}
+		if i == 4 {
+			break
+		}
+	}
+	return 0, 0 // malformed, treat as key without prefix
 }
 
 func (event *DcpEvent) IsJSON() bool {
@@ -1038,6 +1299,10 @@ func (event *DcpEvent) HasXATTR() bool {
 	return (event.Datatype & dcpXATTR) != 0
 }
 
+func (event *DcpEvent) IsSnappy() bool {
+	return (event.Datatype & dcpSnappy) != 0
+}
+
 func (event *DcpEvent) String() string {
 	name := transport.CommandNames[event.Opcode]
 	if name == "" {
@@ -1058,6 +1323,8 @@ type DcpStats struct {
 	TotalCloseStream   stats.Uint64Val
 	TotalStreamEnd     stats.Uint64Val
 	TotalSpurious      stats.Uint64Val
+	TotalSystemEvent   stats.Uint64Val
+	TotalSeqnoAdvanced stats.Uint64Val
 	ToAckBytes         stats.Uint64Val
 
 	// Last memcached communication times
@@ -1069,6 +1336,8 @@ type DcpStats struct {
 
 	RcvchLen   stats.Uint64Val
 	Dcplatency stats.Average
+	// Distribution of the non-zero samples of Dcplatency
+	DcplatencyDist stats.Histogram
 	// This stat help to determine the drain rate of dcp feed
 	IncomingMsg stats.Uint64Val
 }
@@ -1083,6 +1352,8 @@ func (dcpStats *DcpStats) Init() {
 	dcpStats.TotalCloseStream.Init()
 	dcpStats.TotalStreamEnd.Init()
 	dcpStats.TotalSpurious.Init()
+	dcpStats.TotalSystemEvent.Init()
+	dcpStats.TotalSeqnoAdvanced.Init()
 	dcpStats.ToAckBytes.Init()
 	dcpStats.LastAckTime.Init()
 	dcpStats.LastNoopSend.Init()
@@ -1091,6 +1362,7 @@ func (dcpStats *DcpStats) Init() {
 	dcpStats.LastMsgRecv.Init()
 	dcpStats.RcvchLen.Init()
 	dcpStats.Dcplatency.Init()
+	dcpStats.DcplatencyDist.Init(stats.LatencyBuckets, nil)
 	dcpStats.IncomingMsg.Init()
 }
 
@@ -1107,7 +1379,7 @@ func (stats *DcpStats) String() (string, string) {
 		return now.Sub(time.Unix(0, t))
 	}
 
-	var stitems [15]string
+	var stitems [17]string
 	stitems[0] = `"bytes":` + strconv.FormatUint(stats.TotalBytes.Value(), 10)
 	stitems[1] = `"bufferacks":` + strconv.FormatUint(stats.TotalBufferAckSent.Value(), 10)
 	stitems[2] = `"toAckBytes":` + strconv.FormatUint(stats.ToAckBytes.Value(), 10)
@@ -1123,6 +1395,8 @@ func (stats *DcpStats) String() (string, string) {
 	stitems[12] = `"lastMsgRecv":` + getTimeDur(stats.LastMsgRecv.Value()).String()
 	stitems[13] = `"rcvchLen":` + strconv.FormatUint(stats.RcvchLen.Value(), 10)
 	stitems[14] = `"incomingMsg":` + strconv.FormatUint(stats.IncomingMsg.Value(), 10)
+	stitems[15] = `"systemEvents":` + strconv.FormatUint(stats.TotalSystemEvent.Value(), 10)
+	stitems[16] = `"seqnoAdvanced":` + strconv.FormatUint(stats.TotalSeqnoAdvanced.Value(), 10)
 	statjson := strings.Join(stitems[:], ",")
 
 	statsStr := fmt.Sprintf("{%v}", statjson)
@@ -0,0 +1,59 @@
+package memcached
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/dcp/transport"
+	"github.com/golang/snappy"
+)
+
+func TestDcpEventInflate(t *testing.T) {
+	doc := []byte(`{"name":"hi"}`)
+
+	// xattr section: total length followed by {length, key\0value\0}
+	pair := []byte("_sync\x00{\"rev\":1}\x00")
+	body := make([]byte, 8)
+	binary.BigEndian.PutUint32(body[0:], uint32(4+len(pair)))
+	binary.BigEndian.PutUint32(body[4:], uint32(len(pair)))
+	body = append(body, pair...)
+	body = append(body, doc...)
+
+	rq := &transport.MCRequest{
+		Opcode:   transport.DCP_MUTATION,
+		Datatype: dcpJSON | dcpXATTR | dcpSnappy,
+		Key:      []byte("hi"),
+		Body:     snappy.Encode(nil, body),
+		Extras:   make([]byte, dcpMutationExtraLen+15),
+	}
+	e := newDcpEvent(rq, &DcpStream{Vbucket: 1})
+	if !e.IsSnappy() || e.RawXATTR != nil {
+		t.Fatalf("Expected compressed value to be left as is")
+	}
+
+	n, err := e.Inflate()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	} else if n != len(body) {
+		t.Fatalf("Expected inflated size %v, got %v", len(body), n)
+	}
+	if e.IsSnappy() || !e.IsJSON() {
+		t.Fatalf("Unexpected datatype %x", e.Datatype)
+	}
+	if string(e.Value) != string(doc) {
+		t.Fatalf("Expected value %s, got %s", doc, e.Value)
+	}
+	if string(e.RawXATTR["_sync"]) != `{"rev":1}` {
+		t.Fatalf("Unexpected xattrs %v", e.RawXATTR)
+	}
+
+	// malformed compressed value
+	rq.Body = []byte("not snappy")
+	e = newDcpEvent(rq, &DcpStream{Vbucket: 1})
+	if _, err := e.Inflate(); err == nil {
+		t.Fatalf("Expected error inflating malformed value")
+	}
+	if e.IsJSON() || len(e.Value) != 0 {
+		t.Fatalf("Expected malformed value to be dropped")
+	}
+}
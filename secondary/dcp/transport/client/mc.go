@@ -217,6 +217,15 @@ func (c *Client) Del(vb uint16, key string) (*transport.MCResponse, error) {
 		Key:     []byte(key)})
 }
 
+// DelCas deletes a key if its cas matches.
+func (c *Client) DelCas(vb uint16, key string, cas uint64) (*transport.MCResponse, error) {
+	return c.Send(&transport.MCRequest{
+		Opcode:  transport.DELETE,
+		VBucket: vb,
+		Key:     []byte(key),
+		Cas:     cas})
+}
+
 // AuthList lists SASL auth mechanisms.
 func (c *Client) AuthList() (*transport.MCResponse, error) {
 	return c.Send(&transport.MCRequest{
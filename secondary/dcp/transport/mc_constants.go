@@ -41,6 +41,7 @@ const (
 	FLUSHQ     = CommandCode(0x18)
 	APPENDQ    = CommandCode(0x19)
 	PREPENDQ   = CommandCode(0x1a)
+	HELO       = CommandCode(0x1f) // Negotiate features with memcached
 	RGET       = CommandCode(0x30)
 	RSET       = CommandCode(0x31)
 	RSETQ      = CommandCode(0x32)
@@ -84,6 +85,9 @@ const (
 	DCP_BUFFERACK   = CommandCode(0x5d) // DCP Buffer Acknowledgement
 	DCP_CONTROL     = CommandCode(0x5e) // Set flow control params
 
+	DCP_SYSTEM_EVENT   = CommandCode(0x5f) // Collection/scope create and drop
+	DCP_SEQNO_ADVANCED = CommandCode(0x64) // Seqno moved past filtered items
+
 	SELECT_BUCKET = CommandCode(0x89) // Select bucket
 
 	OBSERVE = CommandCode(0x92)
@@ -106,6 +110,29 @@ const (
 	UNKNOWN_COMMAND = Status(0x81)
 	ENOMEM          = Status(0x82)
 	TMPFAIL         = Status(0x86)
+
+	UNKNOWN_COLLECTION = Status(0x88)
+)
+
+// Feature negotiated with memcached using HELO.
+type Feature uint16
+
+const (
+	FeatureXattr       = Feature(0x06)
+	FeatureSnappy      = Feature(0x0a)
+	FeatureJSON        = Feature(0x0b)
+	FeatureCollections = Feature(0x12)
+)
+
+// SystemEventType of a DCP_SYSTEM_EVENT.
+type SystemEventType uint32
+
+const (
+	COLLECTION_CREATE = SystemEventType(0)
+	COLLECTION_DROP   = SystemEventType(1)
+	COLLECTION_FLUSH  = SystemEventType(2)
+	SCOPE_CREATE      = SystemEventType(3)
+	SCOPE_DROP        = SystemEventType(4)
 )
 
 // MCItem is an internal representation of an item.
@@ -153,6 +180,7 @@ func init() {
 	CommandNames[FLUSHQ] = "FLUSHQ"
 	CommandNames[APPENDQ] = "APPENDQ"
 	CommandNames[PREPENDQ] = "PREPENDQ"
+	CommandNames[HELO] = "HELO"
 	CommandNames[RGET] = "RGET"
 	CommandNames[RSET] = "RSET"
 	CommandNames[RSETQ] = "RSETQ"
@@ -195,6 +223,8 @@ func init() {
 	CommandNames[DCP_BUFFERACK] = "DCP_BUFFERACK"
 	CommandNames[DCP_CONTROL] = "DCP_CONTROL"
 	CommandNames[DCP_GET_SEQNO] = "DCP_GET_SEQNO"
+	CommandNames[DCP_SYSTEM_EVENT] = "DCP_SYSTEM_EVENT"
+	CommandNames[DCP_SEQNO_ADVANCED] = "DCP_SEQNO_ADVANCED"
 
 	StatusNames = make(map[Status]string)
 	StatusNames[SUCCESS] = "SUCCESS"
@@ -210,6 +240,7 @@ func init() {
 	StatusNames[ROLLBACK] = "ROLLBACK"
 	StatusNames[ENOMEM] = "ENOMEM"
 	StatusNames[TMPFAIL] = "TMPFAIL"
+	StatusNames[UNKNOWN_COLLECTION] = "UNKNOWN_COLLECTION"
 
 }
 
@@ -222,6 +253,22 @@ func (o CommandCode) String() (rv string) {
 	return rv
 }
 
+func (e SystemEventType) String() string {
+	switch e {
+	case COLLECTION_CREATE:
+		return "COLLECTION_CREATE"
+	case COLLECTION_DROP:
+		return "COLLECTION_DROP"
+	case COLLECTION_FLUSH:
+		return "COLLECTION_FLUSH"
+	case SCOPE_CREATE:
+		return "SCOPE_CREATE"
+	case SCOPE_DROP:
+		return "SCOPE_DROP"
+	}
+	return fmt.Sprintf("0x%02x", uint32(e))
+}
+
 // String an op code.
 func (s Status) String() (rv string) {
 	rv = StatusNames[s]
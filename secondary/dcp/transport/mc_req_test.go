@@ -220,6 +220,31 @@ func TestReceiveRequest(t *testing.T) {
 	}
 }
 
+func TestRequestDatatype(t *testing.T) {
+	req := MCRequest{
+		Opcode:   DCP_MUTATION,
+		Datatype: 0x1, // JSON
+		Opaque:   7242,
+		VBucket:  824,
+		Extras:   make([]byte, 31),
+		Key:      []byte("somekey"),
+		Body:     []byte(`{"some":"value"}`),
+	}
+
+	data := req.Bytes()
+	if data[5] != req.Datatype {
+		t.Fatalf("Expected datatype %v in header, got %v", req.Datatype, data[5])
+	}
+
+	req2 := MCRequest{}
+	if _, err := req2.Receive(bytes.NewReader(data), nil); err != nil {
+		t.Fatalf("Error receiving: %v", err)
+	}
+	if !reflect.DeepEqual(req, req2) {
+		t.Fatalf("Expected %#v == %#v", req, req2)
+	}
+}
+
 func TestReceiveRequestNoContent(t *testing.T) {
 	req := MCRequest{
 		Opcode:  SET,
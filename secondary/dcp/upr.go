@@ -197,6 +197,18 @@ func (feed *DcpFeed) DcpRequestStream(
 	vb uint16, opaque uint16, flags uint32,
 	vbuuid, startSequence, endSequence, snapStart, snapEnd uint64) error {
 
+	return feed.DcpRequestStreamWithCollections(vb, opaque, flags, vbuuid,
+		startSequence, endSequence, snapStart, snapEnd, nil)
+}
+
+// DcpRequestStreamWithCollections is same as DcpRequestStream, except that
+// the stream is filtered to the list of collection ids.
+// Synchronous call.
+func (feed *DcpFeed) DcpRequestStreamWithCollections(
+	vb uint16, opaque uint16, flags uint32,
+	vbuuid, startSequence, endSequence, snapStart, snapEnd uint64,
+	collectionIds []string) error {
+
 	// only request active vbucket
 	if feed.activeVbOnly {
 		flags = flags | DCP_ADD_STREAM_ACTIVE_VB_ONLY
@@ -205,7 +217,7 @@ func (feed *DcpFeed) DcpRequestStream(
 	respch := make(chan []interface{}, 1)
 	cmd := []interface{}{
 		ufCmdRequestStream, vb, opaque, flags, vbuuid, startSequence,
-		endSequence, snapStart, snapEnd, respch}
+		endSequence, snapStart, snapEnd, collectionIds, respch}
 	resp, err := failsafeOp(feed.reqch, respch, cmd, feed.finch)
 	return opError(err, resp, 0)
 }
@@ -288,10 +300,11 @@ loop:
 				flags, vbuuid := msg[3].(uint32), msg[4].(uint64)
 				startSeq, endSeq := msg[5].(uint64), msg[6].(uint64)
 				snapStart, snapEnd := msg[7].(uint64), msg[8].(uint64)
+				collectionIds := msg[9].([]string)
 				err := feed.dcpRequestStream(
 					vb, opaque, flags, vbuuid, startSeq, endSeq,
-					snapStart, snapEnd)
-				respch := msg[9].(chan []interface{})
+					snapStart, snapEnd, collectionIds)
+				respch := msg[10].(chan []interface{})
 				respch <- []interface{}{err}
 
 			case ufCmdCloseStream:
@@ -419,7 +432,8 @@ func (feed *DcpFeed) reConnectToNodes(
 
 func (feed *DcpFeed) dcpRequestStream(
 	vb uint16, opaque uint16, flags uint32,
-	vbuuid, startSequence, endSequence, snapStart, snapEnd uint64) error {
+	vbuuid, startSequence, endSequence, snapStart, snapEnd uint64,
+	collectionIds []string) error {
 
 	prefix := feed.logPrefix
 	vbm := feed.bucket.VBServerMap()
@@ -450,9 +464,14 @@ func (feed *DcpFeed) dcpRequestStream(
 			logging.Errorf(fmsg, prefix, opaque, master, vb)
 			return memcached.ErrorInvalidFeed
 		}
-		err = singleFeed.dcpFeed.DcpRequestStream(
+		filter := collectionIds
+		if !singleFeed.dcpFeed.IsCollectionsAware() {
+			// documents are all in the default collection.
+			filter = nil
+		}
+		err = singleFeed.dcpFeed.DcpRequestStreamWithCollections(
 			vb, opaque, flags, vbuuid, startSequence, endSequence,
-			snapStart, snapEnd)
+			snapStart, snapEnd, filter)
 		if err != nil {
 			fmsg := "%v ##%x DcpFeed %v failed, trying next"
 			logging.Errorf(fmsg, prefix, opaque, singleFeed.dcpFeed.Name())
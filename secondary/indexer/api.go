@@ -5,9 +5,21 @@ import "strings"
 import re "regexp"
 import "path/filepath"
 import "fmt"
+import "io/ioutil"
+import "strconv"
+import "sync"
+import "errors"
+import "encoding/base64"
+import "hash/crc32"
+import "bytes"
+import "math"
 
 import log "github.com/couchbase/indexing/secondary/logging"
 import c "github.com/couchbase/indexing/secondary/common"
+import json "github.com/couchbase/indexing/secondary/common/json"
+import qclient "github.com/couchbase/indexing/secondary/queryport/client"
+import "github.com/couchbase/indexing/secondary/collatejson"
+import qvalue "github.com/couchbase/query/value"
 import "github.com/couchbase/cbauth"
 
 type target struct {
@@ -17,10 +29,17 @@ type target struct {
 	skipEmpty bool
 	partition bool
 	pretty    bool
+	statNames map[string]bool
 }
 
 type restServer struct {
+	cluster  string
+	config   c.Config
 	statsMgr *statsManager
+
+	// client for the scan api, created on the first scan
+	clientLock sync.Mutex
+	client     *qclient.GsiClient
 }
 
 type request struct {
@@ -42,11 +61,12 @@ func initHandlers(api *restServer) {
 	versionRx = re.MustCompile("v\\d+")
 	staticRoutes = make(map[string]reqHandler)
 	staticRoutes["stats"] = api.statsHandler
+	staticRoutes["bucket"] = api.bucketHandler
 }
 
-func NewRestServer(cluster string, stMgr *statsManager) (*restServer, Message) {
+func NewRestServer(cluster string, stMgr *statsManager, config c.Config) (*restServer, Message) {
 	log.Infof("%v starting RESTful services", cluster)
-	restapi := &restServer{statsMgr: stMgr}
+	restapi := &restServer{cluster: cluster, config: config, statsMgr: stMgr}
 	initHandlers(restapi)
 	mux := GetHTTPMux()
 	mux.HandleFunc("/api/", restapi.routeRequest)
@@ -125,15 +145,20 @@ func (api *restServer) statsHandler(req request) {
 		segs := strings.Split(req.url, "/")
 		t := &target{version: req.version, skipEmpty:skipEmpty,
 			partition:partition, pretty:pretty,}
+		// Example: ?stats=items_count,data_size
+		if names := req.r.URL.Query().Get("stats"); names != "" {
+			t.statNames = make(map[string]bool)
+			for _, name := range strings.Split(names, ",") {
+				t.statNames[strings.TrimSpace(name)] = true
+			}
+		}
 		switch req.version {
 		case "v1":
 			if len(segs) == 3 { // Indexer node level stats
 				t.level = "indexer"
 			} else if len(segs) == 4 { // Bucket level stats
-				errStr := fmt.Sprintf("Bucket-Level statistics are unavailable" +
-					"\nPlease retry at Indexer Node or Index granularity \n%s", req.r.URL.Path)
-				http.Error(req.w, errStr, 404)
-				return
+				t.level = "bucket"
+				t.resource = segs[3]
 			} else if len(segs) == 5 { // Index level stats
 				t.level = "index"
 				t.resource = segs[4]
@@ -163,6 +188,594 @@ func (api *restServer) statsHandler(req request) {
 	}
 }
 
+func (api *restServer) bucketHandler(req request) {
+	// Example: _/api/bucket/{bucket}/index/{index}/scan (_ is a blank)
+	segs := strings.Split(req.url, "/")
+	switch req.version {
+	case "v1":
+		if len(segs) == 7 && segs[4] == "index" && segs[6] == "scan" {
+			api.scanHandler(req, segs[3], segs[5])
+			return
+		}
+		http.Error(req.w, req.r.URL.Path, 404)
+	default:
+		http.Error(req.w, req.r.URL.Path, 404)
+	}
+}
+
+//
+// Scan API
+//
+// GET|POST _/api/v1/bucket/{bucket}/index/{index}/scan
+//
+// The optional request body has the same parameters as a query scan:
+//
+//    {"scans": ..., "projection": ..., "groupAggr": ..., "indexOrder": ...,
+//     "reverse": false, "distinct": false, "limit": 1000,
+//     "stale": "ok|false|partial", "timestamp": {"vbno": ["vbuuid", "seqno"]},
+//     "resume": "token"}
+//
+// The query parameters scope, collection, limit and resume can be
+// used instead of the body for a full scan of an index.  The result
+// is streamed as newline-delimited JSON, one {"key": ..., "docid": ...}
+// per row.  If the scan has more rows than the limit, the last line is
+// {"resume": token}, and the next page is scanned by the same request
+// with the token.  An error after the rows are streamed is returned
+// as a last line {"error": ...}.
+//
+// A page is resumed after the index key and the docid of the last row
+// of the previous page, so rows added or removed before that position
+// do not shift the rows of the next page.  Scans with groupAggr or
+// indexOrder, and distinct scans with a projection, are not in the
+// order of the index keys, and return only the first page.
+//
+
+const (
+	defaultScanPageSize = 1000
+	maxScanPageSize     = 100000
+)
+
+type scanRequest struct {
+	Scans      json.RawMessage          `json:"scans,omitempty"`
+	Projection *qclient.IndexProjection `json:"projection,omitempty"`
+	GroupAggr  *qclient.GroupAggr       `json:"groupAggr,omitempty"`
+	IndexOrder *qclient.IndexKeyOrder   `json:"indexOrder,omitempty"`
+	Reverse    bool                     `json:"reverse,omitempty"`
+	Distinct   bool                     `json:"distinct,omitempty"`
+	Limit      int64                    `json:"limit,omitempty"`
+	Stale      string                   `json:"stale,omitempty"`
+	Timestamp  map[string][]string      `json:"timestamp,omitempty"`
+	Resume     string                   `json:"resume,omitempty"`
+}
+
+// isPaged returns true if the rows of the scan are in the order of the
+// index keys, so that a page can be resumed after the last row of the
+// previous page.
+func (sreq *scanRequest) isPaged() bool {
+	return sreq.GroupAggr == nil && sreq.IndexOrder == nil &&
+		!(sreq.Distinct && sreq.Projection != nil)
+}
+
+// scanResumeToken is the position of the next page of a scan, the
+// index key and the docid of the last row of the page.  The digest is
+// of the index and of the parameters of the scan, so that a token
+// cannot be used to resume a different scan.
+type scanResumeToken struct {
+	Key    json.RawMessage `json:"key"`
+	DocId  string          `json:"docid,omitempty"`
+	Digest uint32          `json:"digest"`
+}
+
+type scanRow struct {
+	Key   interface{} `json:"key"`
+	DocId string      `json:"docid,omitempty"`
+}
+
+func (api *restServer) scanHandler(req request, bucket, name string) {
+
+	if req.r.Method != "GET" && req.r.Method != "POST" {
+		http.Error(req.w, "Unsupported method", 405)
+		return
+	}
+
+	permission := fmt.Sprintf("cluster.bucket[%s].n1ql.index!read", bucket)
+	if !c.IsAllowed(req.creds, []string{permission}, req.w) {
+		return
+	}
+
+	sreq, err := api.parseScanRequest(req)
+	if err != nil {
+		api.writeError(req.w, err)
+		return
+	}
+
+	client, err := api.getClient()
+	if err != nil {
+		http.Error(req.w, err.Error(), 500)
+		return
+	}
+
+	scope := req.r.URL.Query().Get("scope")
+	if scope == "" {
+		scope = c.DEFAULT_SCOPE
+	}
+	collection := req.r.URL.Query().Get("collection")
+	if collection == "" {
+		collection = c.DEFAULT_COLLECTION
+	}
+
+	defn, err := api.findIndex(client, bucket, scope, collection, name)
+	if err != nil {
+		http.Error(req.w, err.Error(), 404)
+		return
+	}
+
+	scans := qclient.Scans{&qclient.Scan{
+		Filter: []*qclient.CompositeElementFilter{
+			&qclient.CompositeElementFilter{
+				Low:       c.MinUnbounded,
+				High:      c.MaxUnbounded,
+				Inclusion: qclient.Both,
+			},
+		},
+	}}
+	if len(sreq.Scans) != 0 {
+		if scans, err = getScans(sreq.Scans); err != nil {
+			api.writeError(req.w, fmt.Errorf("Invalid scans: %v", err))
+			return
+		}
+	}
+
+	cons, ok := stale2consistency(sreq.Stale)
+	if !ok {
+		api.writeError(req.w, errors.New("Invalid stale option"))
+		return
+	}
+
+	var ts *qclient.TsConsistency
+	if sreq.Stale == "partial" {
+		if sreq.Timestamp == nil {
+			api.writeError(req.w, errors.New("Missing timestamp for stale=partial"))
+			return
+		}
+		if ts, err = vector2tsconsistency(sreq.Timestamp); err != nil {
+			api.writeError(req.w, fmt.Errorf("Invalid timestamp: %v", err))
+			return
+		}
+	}
+
+	digest, err := scanDigest(defn.DefnId, sreq)
+	if err != nil {
+		http.Error(req.w, err.Error(), 500)
+		return
+	}
+
+	paged := sreq.isPaged()
+	pageSize := sreq.Limit
+
+	// a paged scan gets all the keys and the docid of the rows, to
+	// order them, and the projection is applied to the rows returned
+	projection, limit := sreq.Projection, pageSize+1
+	var order *scanOrder
+	if paged {
+		if order, err = newScanOrder(defn, sreq); err != nil {
+			http.Error(req.w, err.Error(), 500)
+			return
+		}
+		projection, limit = nil, math.MaxInt64
+	}
+
+	var resumeKey qvalue.Values
+	var resumeDocId []byte
+	if sreq.Resume != "" {
+		token, err := decodeResumeToken(sreq.Resume)
+		if err == nil && (token.Digest != digest || !paged) {
+			err = errors.New("token is not of the scan")
+		}
+		if err == nil {
+			resumeKey, err = decodeScanKey(token.Key)
+		}
+		if err != nil {
+			api.writeError(req.w, fmt.Errorf("Invalid resume token: %v", err))
+			return
+		}
+		resumeDocId = []byte(token.DocId)
+		scans = order.resumeScans(scans, resumeKey[0])
+	}
+
+	req.w.Header().Set("Content-Type", "application/x-ndjson")
+	req.w.WriteHeader(200)
+	flusher, _ := req.w.(http.Flusher)
+
+	if len(scans) == 0 {
+		return
+	}
+
+	dataEncFmt := client.GetDataEncodingFormat()
+
+	count, more := int64(0), false
+	var lastKey json.RawMessage
+	var lastDocId string
+	err = nil
+
+	writeRow := func(key qvalue.Values, docid []byte) bool {
+		// rows of the previous page with the same leading key
+		if resumeKey != nil && order.compare(key, docid, resumeKey, resumeDocId) <= 0 {
+			return true
+		}
+		if count == pageSize {
+			more = true
+			return false
+		}
+
+		row := &scanRow{Key: key, DocId: string(docid)}
+		if paged {
+			row = projectScanRow(key, docid, sreq.Projection)
+			if lastKey, err = json.Marshal(key); err != nil {
+				return false
+			}
+			lastDocId = string(docid)
+		}
+
+		var data []byte
+		if data, err = json.Marshal(row); err != nil {
+			return false
+		}
+		req.w.Write(append(data, '\n'))
+		count++
+		return true
+	}
+
+	e := client.Scan3(
+		uint64(defn.DefnId), "", scans, sreq.Reverse, sreq.Distinct,
+		projection, 0, limit, sreq.GroupAggr, sreq.IndexOrder,
+		cons, ts,
+		func(res qclient.ResponseReader) bool {
+			var skeys *c.ScanResultEntries
+			var pkeys [][]byte
+
+			if err = res.Error(); err != nil {
+				return false
+			} else if skeys, pkeys, err = res.GetEntries(dataEncFmt); err != nil {
+				return false
+			}
+			//nil means no more data
+			if skeys == nil {
+				return true
+			}
+			next, err1 := forEachScanRow(skeys, pkeys, writeRow)
+			if err1 != nil {
+				err = err1
+			}
+			if !next || err != nil {
+				return false
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return true
+		})
+	if err == nil {
+		err = e
+	}
+
+	if err != nil {
+		log.Errorf("restServer::scanHandler Bucket %v Index %v Error %v", bucket, name, err)
+		data, _ := json.Marshal(map[string]string{"error": err.Error()})
+		req.w.Write(append(data, '\n'))
+	} else if more && paged {
+		token := encodeResumeToken(&scanResumeToken{Key: lastKey, DocId: lastDocId, Digest: digest})
+		data, _ := json.Marshal(map[string]string{"resume": token})
+		req.w.Write(append(data, '\n'))
+	}
+}
+
+func (api *restServer) parseScanRequest(req request) (*scanRequest, error) {
+
+	sreq := &scanRequest{}
+
+	bytes, err := ioutil.ReadAll(req.r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes) != 0 {
+		if err := json.Unmarshal(bytes, sreq); err != nil {
+			return nil, fmt.Errorf("Invalid request body: %v", err)
+		}
+	}
+
+	q := req.r.URL.Query()
+	if limit := q.Get("limit"); limit != "" {
+		if sreq.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil {
+			return nil, fmt.Errorf("Invalid limit: %v", err)
+		}
+	}
+	if resume := q.Get("resume"); resume != "" {
+		sreq.Resume = resume
+	}
+
+	if sreq.Stale == "" {
+		sreq.Stale = "ok"
+	}
+
+	if sreq.Limit <= 0 {
+		sreq.Limit = defaultScanPageSize
+	} else if sreq.Limit > maxScanPageSize {
+		return nil, fmt.Errorf("Limit %v exceeds maximum %v", sreq.Limit, maxScanPageSize)
+	}
+
+	return sreq, nil
+}
+
+func (api *restServer) getClient() (*qclient.GsiClient, error) {
+
+	api.clientLock.Lock()
+	defer api.clientLock.Unlock()
+
+	if api.client != nil {
+		return api.client, nil
+	}
+
+	config, err := c.GetSettingsConfig(c.SystemConfig)
+	if err != nil {
+		return nil, err
+	}
+	qconf := config.SectionConfig("queryport.client.", true /*trim*/)
+	qconf.SetValue("encryption.certFile", api.config["certFile"].String())
+	qconf.SetValue("encryption.keyFile", api.config["keyFile"].String())
+
+	client, err := qclient.NewGsiClient(api.cluster, qconf)
+	if err != nil {
+		return nil, err
+	}
+
+	api.client = client
+	return client, nil
+}
+
+func (api *restServer) findIndex(client *qclient.GsiClient,
+	bucket, scope, collection, name string) (*c.IndexDefn, error) {
+
+	indexes, _, _, err := client.Refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, index := range indexes {
+		defn := index.Definition
+		if defn.Bucket != bucket || defn.GetScope() != scope ||
+			defn.GetCollection() != collection || defn.Name != name {
+			continue
+		}
+
+		for _, inst := range index.Instances {
+			if inst.State == c.INDEX_STATE_ACTIVE {
+				return defn, nil
+			}
+		}
+		return nil, fmt.Errorf("Index %v is not active", name)
+	}
+
+	return nil, fmt.Errorf("Index %v not found in %v.%v.%v",
+		name, bucket, scope, collection)
+}
+
+// forEachScanRow calls fn with the key and the docid of the rows in
+// the scan results, till fn returns false.
+func forEachScanRow(skeys *c.ScanResultEntries, pkeys [][]byte,
+	fn func(key qvalue.Values, docid []byte) bool) (bool, error) {
+
+	tmpbuf, tmpbufPoolIdx := qclient.GetFromPools()
+	defer func() {
+		qclient.PutInPools(tmpbuf, tmpbufPoolIdx)
+	}()
+
+	result, err, retBuf := skeys.Get(tmpbuf)
+	if err != nil {
+		return false, err
+	}
+
+	if retBuf != nil {
+		tmpbuf = retBuf
+	}
+
+	for i, skey := range result {
+		var docid []byte
+		if i < len(pkeys) {
+			docid = pkeys[i]
+		}
+		if !fn(skey, docid) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// projectScanRow returns the row of a paged scan, which gets all the
+// keys and the docid, with the projection of the scan request.
+func projectScanRow(key qvalue.Values, docid []byte, proj *qclient.IndexProjection) *scanRow {
+
+	if proj == nil {
+		return &scanRow{Key: key, DocId: string(docid)}
+	}
+
+	projected := make(qvalue.Values, 0, len(proj.EntryKeys))
+	for i := range key {
+		for _, pos := range proj.EntryKeys {
+			if pos == int64(i) {
+				projected = append(projected, key[i])
+				break
+			}
+		}
+	}
+
+	row := &scanRow{Key: projected}
+	if proj.PrimaryKey {
+		row.DocId = string(docid)
+	}
+	return row
+}
+
+// scanOrder is the order of the rows of a paged scan, by the index
+// keys and then by the docid.
+type scanOrder struct {
+	desc      []bool
+	collators []collatejson.Collator
+	reverse   bool
+	distinct  bool
+}
+
+func newScanOrder(defn *c.IndexDefn, sreq *scanRequest) (*scanOrder, error) {
+
+	collators, err := defn.KeyCollators()
+	if err != nil {
+		return nil, err
+	}
+
+	return &scanOrder{
+		desc:      defn.Desc,
+		collators: collators,
+		reverse:   sreq.Reverse,
+		distinct:  sreq.Distinct,
+	}, nil
+}
+
+// compare returns -ve, 0 or +ve if the row of key1, docid1 is returned
+// before, at or after the row of key2, docid2.
+func (o *scanOrder) compare(key1 qvalue.Values, docid1 []byte,
+	key2 qvalue.Values, docid2 []byte) int {
+
+	r := 0
+	for i := 0; r == 0 && i < len(key1) && i < len(key2); i++ {
+		r = o.collate(i, key1[i], key2[i])
+		if i < len(o.desc) && o.desc[i] {
+			r = -r
+		}
+	}
+	if r == 0 {
+		r = len(key1) - len(key2)
+	}
+	// a distinct scan has one row for a key
+	if r == 0 && !o.distinct {
+		r = bytes.Compare(docid1, docid2)
+	}
+
+	if o.reverse {
+		return -r
+	}
+	return r
+}
+
+// collate compares values of the index key at position i, strings of a
+// collated key by their collation key and then by value, as they are
+// ordered in the index.
+func (o *scanOrder) collate(i int, v1, v2 qvalue.Value) int {
+	if i < len(o.collators) && o.collators[i] != nil &&
+		v1.Type() == qvalue.STRING && v2.Type() == qvalue.STRING {
+
+		s1, s2 := v1.Actual().(string), v2.Actual().(string)
+		k1 := o.collators[i].Key(nil, []byte(s1))
+		k2 := o.collators[i].Key(nil, []byte(s2))
+		if r := bytes.Compare(k1, k2); r != 0 {
+			return r
+		}
+	}
+	return v1.Collate(v2)
+}
+
+// resumeScans returns the scans narrowed to the rows from the leading
+// key of the position a page is resumed from, and drops the scans with
+// all rows before it.  The rows with the same leading key before the
+// position are skipped by compare.
+func (o *scanOrder) resumeScans(scans qclient.Scans, lead qvalue.Value) qclient.Scans {
+
+	// whether the rows are returned by increasing leading key
+	increasing := (len(o.desc) > 0 && o.desc[0]) == o.reverse
+
+	var resumed qclient.Scans
+	for _, scan := range scans {
+		if len(scan.Filter) == 0 {
+			resumed = append(resumed, scan)
+			continue
+		}
+
+		filter := *scan.Filter[0]
+		if increasing {
+			if filter.High != c.MaxUnbounded && o.collate(0, qvalue.NewValue(filter.High), lead) < 0 {
+				continue
+			}
+			if filter.Low == c.MinUnbounded || o.collate(0, qvalue.NewValue(filter.Low), lead) < 0 {
+				filter.Low = lead.Actual()
+				filter.Inclusion |= qclient.Low
+			}
+		} else {
+			if filter.Low != c.MinUnbounded && o.collate(0, qvalue.NewValue(filter.Low), lead) > 0 {
+				continue
+			}
+			if filter.High == c.MaxUnbounded || o.collate(0, qvalue.NewValue(filter.High), lead) > 0 {
+				filter.High = lead.Actual()
+				filter.Inclusion |= qclient.High
+			}
+		}
+
+		filters := append([]*qclient.CompositeElementFilter{&filter}, scan.Filter[1:]...)
+		resumed = append(resumed, &qclient.Scan{Seek: scan.Seek, Filter: filters})
+	}
+	return resumed
+}
+
+func scanDigest(defnId c.IndexDefnId, sreq *scanRequest) (uint32, error) {
+
+	params := *sreq
+	params.Limit = 0
+	params.Resume = ""
+
+	data, err := json.Marshal(&params)
+	if err != nil {
+		return 0, err
+	}
+
+	data = append(data, []byte(strconv.FormatUint(uint64(defnId), 10))...)
+	return crc32.ChecksumIEEE(data), nil
+}
+
+func encodeResumeToken(token *scanResumeToken) string {
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeResumeToken(s string) (*scanResumeToken, error) {
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &scanResumeToken{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// decodeScanKey returns the index key of a resume token.
+func decodeScanKey(data json.RawMessage) (qvalue.Values, error) {
+
+	var key []interface{}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		return nil, errors.New("empty key")
+	}
+
+	values := make(qvalue.Values, 0, len(key))
+	for _, v := range key {
+		values = append(values, qvalue.NewValue(v))
+	}
+	return values, nil
+}
+
 func (api *restServer) authorizeStats(req request, t *target) bool {
 
 	permissions := ([]string)(nil)
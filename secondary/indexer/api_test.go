@@ -0,0 +1,265 @@
+package indexer
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	json "github.com/couchbase/indexing/secondary/common/json"
+	qclient "github.com/couchbase/indexing/secondary/queryport/client"
+	qvalue "github.com/couchbase/query/value"
+)
+
+type testScanRow struct {
+	key   qvalue.Values
+	docid []byte
+}
+
+func newTestScanRow(docid string, keys ...interface{}) testScanRow {
+	key := make(qvalue.Values, 0, len(keys))
+	for _, k := range keys {
+		key = append(key, qvalue.NewValue(k))
+	}
+	return testScanRow{key: key, docid: []byte(docid)}
+}
+
+// testScanRows sorts rows in the order of a scan.
+type testScanRows struct {
+	rows  []testScanRow
+	order *scanOrder
+}
+
+func (r testScanRows) Len() int      { return len(r.rows) }
+func (r testScanRows) Swap(i, j int) { r.rows[i], r.rows[j] = r.rows[j], r.rows[i] }
+func (r testScanRows) Less(i, j int) bool {
+	x, y := r.rows[i], r.rows[j]
+	return r.order.compare(x.key, x.docid, y.key, y.docid) < 0
+}
+
+// scanTestPage returns a page of the rows in the index after the
+// position of a resume token, as the scan handler does.
+func scanTestPage(t *testing.T, order *scanOrder, index []testScanRow,
+	token *scanResumeToken, pageSize int) ([]string, *scanResumeToken) {
+
+	var resumeKey qvalue.Values
+	if token != nil {
+		var err error
+		if resumeKey, err = decodeScanKey(token.Key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows := append([]testScanRow(nil), index...)
+	sort.Sort(testScanRows{rows, order})
+
+	var page []string
+	var last testScanRow
+	for _, row := range rows {
+		if resumeKey != nil && order.compare(row.key, row.docid, resumeKey, []byte(token.DocId)) <= 0 {
+			continue
+		}
+		if len(page) == pageSize {
+			data, err := json.Marshal(last.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return page, &scanResumeToken{Key: data, DocId: string(last.docid)}
+		}
+		page = append(page, string(row.docid))
+		last = row
+	}
+	return page, nil
+}
+
+func TestScanOrderCompare(t *testing.T) {
+	order := &scanOrder{desc: []bool{false, true}}
+
+	tests := []struct {
+		row1, row2 testScanRow
+		r          int
+	}{
+		{newTestScanRow("d1", 1.0, "a"), newTestScanRow("d1", 2.0, "a"), -1},
+		{newTestScanRow("d1", 1.0, "a"), newTestScanRow("d1", 1.0, "b"), 1},
+		{newTestScanRow("d1", 1.0, "a"), newTestScanRow("d2", 1.0, "a"), -1},
+		{newTestScanRow("d2", 1.0, "a"), newTestScanRow("d2", 1.0, "a"), 0},
+		{newTestScanRow("d1", "x", "a"), newTestScanRow("d1", 5.0, "a"), 1},
+	}
+	for i, test := range tests {
+		r := order.compare(test.row1.key, test.row1.docid, test.row2.key, test.row2.docid)
+		if sign(r) != test.r {
+			t.Errorf("%v: expected %v, got %v", i, test.r, r)
+		}
+	}
+
+	order.reverse = true
+	row1, row2 := newTestScanRow("d1", 1.0, "a"), newTestScanRow("d1", 2.0, "a")
+	if r := order.compare(row1.key, row1.docid, row2.key, row2.docid); r <= 0 {
+		t.Errorf("expected reverse scan to return %v after %v", row1.key, row2.key)
+	}
+
+	order = &scanOrder{distinct: true}
+	row1, row2 = newTestScanRow("d1", 1.0), newTestScanRow("d2", 1.0)
+	if r := order.compare(row1.key, row1.docid, row2.key, row2.docid); r != 0 {
+		t.Errorf("expected distinct rows of the same key to be equal, got %v", r)
+	}
+}
+
+func sign(r int) int {
+	if r < 0 {
+		return -1
+	} else if r > 0 {
+		return 1
+	}
+	return 0
+}
+
+func TestResumeScans(t *testing.T) {
+	lead := qvalue.NewValue(10.0)
+	scans := qclient.Scans{
+		{Filter: []*qclient.CompositeElementFilter{
+			{Low: c.MinUnbounded, High: 5.0, Inclusion: qclient.Both}}},
+		{Filter: []*qclient.CompositeElementFilter{
+			{Low: 5.0, High: 20.0, Inclusion: qclient.Neither},
+			{Low: "a", High: "b", Inclusion: qclient.Both}}},
+		{Filter: []*qclient.CompositeElementFilter{
+			{Low: 15.0, High: c.MaxUnbounded, Inclusion: qclient.Low}}},
+		{Seek: c.SecondaryKey{1.0}},
+	}
+
+	order := &scanOrder{}
+	resumed := order.resumeScans(scans, lead)
+	if len(resumed) != 3 {
+		t.Fatalf("expected the scan before 10 to be dropped, got %v scans", len(resumed))
+	}
+	if f := resumed[0].Filter[0]; f.Low != 10.0 || f.High != 20.0 || f.Inclusion != qclient.Low {
+		t.Errorf("unexpected filter %+v", f)
+	}
+	if f := resumed[0].Filter[1]; f.Low != "a" || f.High != "b" {
+		t.Errorf("expected filter of second key unchanged, got %+v", f)
+	}
+	if f := resumed[1].Filter[0]; f.Low != 15.0 || f.Inclusion != qclient.Low {
+		t.Errorf("expected scan after 10 unchanged, got %+v", f)
+	}
+	if resumed[2].Seek == nil {
+		t.Errorf("expected lookup unchanged")
+	}
+	if f := scans[1].Filter[0]; f.Low != 5.0 || f.Inclusion != qclient.Neither {
+		t.Errorf("expected scans of the request unchanged, got %+v", f)
+	}
+
+	// a reverse scan, or a scan of a descending key, resumes below
+	for _, order := range []*scanOrder{{reverse: true}, {desc: []bool{true}}} {
+		resumed := order.resumeScans(scans, lead)
+		if len(resumed) != 3 {
+			t.Fatalf("expected the scan after 10 to be dropped, got %v scans", len(resumed))
+		}
+		if f := resumed[0].Filter[0]; f.Low != c.MinUnbounded || f.High != 5.0 {
+			t.Errorf("expected scan before 10 unchanged, got %+v", f)
+		}
+		if f := resumed[1].Filter[0]; f.Low != 5.0 || f.High != 10.0 || f.Inclusion != qclient.High {
+			t.Errorf("unexpected filter %+v", f)
+		}
+	}
+}
+
+func TestScanPages(t *testing.T) {
+	order := &scanOrder{}
+	index := []testScanRow{
+		newTestScanRow("d1", 1.0),
+		newTestScanRow("d2", 1.0),
+		newTestScanRow("d3", 1.0),
+		newTestScanRow("d4", 2.0),
+		newTestScanRow("d5", 3.0),
+		newTestScanRow("d6", 3.0),
+	}
+
+	page, token := scanTestPage(t, order, index, nil, 2)
+	if !reflect.DeepEqual(page, []string{"d1", "d2"}) || token == nil {
+		t.Fatalf("unexpected first page %v %v", page, token)
+	}
+
+	// rows added before the position do not shift the next page
+	index = append(index, newTestScanRow("d0", 0.0), newTestScanRow("d10", 1.0))
+	page, token = scanTestPage(t, order, index, token, 2)
+	if !reflect.DeepEqual(page, []string{"d3", "d4"}) || token == nil {
+		t.Fatalf("unexpected second page %v %v", page, token)
+	}
+
+	// rows removed before the position do not shift the next page
+	index = index[2:]
+	page, token = scanTestPage(t, order, index, token, 2)
+	if !reflect.DeepEqual(page, []string{"d5", "d6"}) || token != nil {
+		t.Fatalf("unexpected last page %v %v", page, token)
+	}
+}
+
+func TestScanResumeToken(t *testing.T) {
+	key, err := json.Marshal(newTestScanRow("", "x", 1.0).key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &scanResumeToken{Key: key, DocId: "doc1", Digest: 42}
+
+	decoded, err := decodeResumeToken(encodeResumeToken(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.DocId != "doc1" || decoded.Digest != 42 {
+		t.Errorf("unexpected token %+v", decoded)
+	}
+	values, err := decodeScanKey(decoded.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || values[0].Actual() != "x" || values[1].Collate(qvalue.NewValue(1.0)) != 0 {
+		t.Errorf("unexpected key %v", values)
+	}
+
+	if _, err := decodeResumeToken("not a token"); err == nil {
+		t.Errorf("expected error for invalid token")
+	}
+	if _, err := decodeScanKey([]byte("[]")); err == nil {
+		t.Errorf("expected error for empty key")
+	}
+}
+
+func TestProjectScanRow(t *testing.T) {
+	row := newTestScanRow("doc1", "a", "b", "c")
+
+	projected := projectScanRow(row.key, row.docid, nil)
+	if !reflect.DeepEqual(projected.Key, row.key) || projected.DocId != "doc1" {
+		t.Errorf("unexpected row %+v", projected)
+	}
+
+	proj := &qclient.IndexProjection{EntryKeys: []int64{2, 0}}
+	projected = projectScanRow(row.key, row.docid, proj)
+	expected := qvalue.Values{row.key[0], row.key[2]}
+	if !reflect.DeepEqual(projected.Key, expected) || projected.DocId != "" {
+		t.Errorf("unexpected row %+v", projected)
+	}
+
+	proj.PrimaryKey = true
+	if projected = projectScanRow(row.key, row.docid, proj); projected.DocId != "doc1" {
+		t.Errorf("expected docid in row, got %+v", projected)
+	}
+}
+
+func TestScanRequestIsPaged(t *testing.T) {
+	tests := []struct {
+		sreq  scanRequest
+		paged bool
+	}{
+		{scanRequest{}, true},
+		{scanRequest{Reverse: true, Projection: &qclient.IndexProjection{}}, true},
+		{scanRequest{Distinct: true}, true},
+		{scanRequest{Distinct: true, Projection: &qclient.IndexProjection{}}, false},
+		{scanRequest{GroupAggr: &qclient.GroupAggr{}}, false},
+		{scanRequest{IndexOrder: &qclient.IndexKeyOrder{}}, false},
+	}
+	for i, test := range tests {
+		if paged := test.sreq.isPaged(); paged != test.paged {
+			t.Errorf("%v: expected %v, got %v", i, test.paged, paged)
+		}
+	}
+}
@@ -0,0 +1,547 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/couchbase/cbauth"
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+//
+// Backup of index data
+//
+// /backupIndexData exports the latest persisted snapshot of every
+// partition of the built indexes of a bucket on this indexer as a tar
+// archive.  The archive has a manifest, with the definition and the
+// snapshot timestamp of every partition, and the slice files of each
+// partition under its own directory.
+//
+// /restoreIndexData imports an archive into the indexes created for
+// the restore by /restoreIndexMetadata, which are created deferred.
+// If the bucket has not failed over since the backup, the slices in
+// the archive replace the slices of the indexes, and the indexes are
+// built from the timestamp of the backup.  Otherwise, the indexes are
+// built from 0.  An index whose data in the archive does not match
+// the index is left deferred, to be built from 0 once the restored
+// indexes are built.  An index in the archive is matched to a local
+// index by name, so the archives of all the indexer nodes can be
+// restored on every node.
+//
+
+const (
+	BACKUP_VERSION  = 1
+	BACKUP_MANIFEST = "manifest.json"
+
+	RESTORE_STATUS_RESTORED = "restored"
+	RESTORE_STATUS_BUILD    = "build"
+	RESTORE_STATUS_DEFERRED = "deferred"
+	RESTORE_STATUS_SKIPPED  = "skipped"
+)
+
+const backupFailoverLogOpaque = 0xBAC0
+
+// failover logs are fetched on a dcp connection with no mutations
+var backupDcpConfig = map[string]interface{}{
+	"genChanSize":  16,
+	"dataChanSize": 16,
+}
+
+type indexBackupManifest struct {
+	Version int                 `json:"version"`
+	Bucket  string              `json:"bucket"`
+	Entries []*indexBackupEntry `json:"entries"`
+}
+
+// indexBackupEntry is the backup of an index partition.  The slice
+// files of the partition are under Dir in the archive.
+type indexBackupEntry struct {
+	Defn          common.IndexDefn   `json:"defn"`
+	InstId        common.IndexInstId `json:"instId"`
+	PartnId       common.PartitionId `json:"partnId"`
+	NumPartitions int                `json:"numPartitions"`
+	Timestamp     *common.TsVbuuid   `json:"timestamp"`
+	Dir           string             `json:"dir"`
+}
+
+// indexRestoreStatus is the result of the restore of an index.
+type indexRestoreStatus struct {
+	Bucket     string             `json:"bucket"`
+	Scope      string             `json:"scope"`
+	Collection string             `json:"collection"`
+	Name       string             `json:"name"`
+	InstId     common.IndexInstId `json:"instId,omitempty"`
+	Status     string             `json:"status"`
+	Reason     string             `json:"reason,omitempty"`
+}
+
+type indexRestoreResponse struct {
+	Code    string                `json:"code"`
+	Indexes []*indexRestoreStatus `json:"indexes,omitempty"`
+}
+
+type backupManager struct {
+	supvMsgch   MsgChannel //channel to send any message to supervisor
+	storageDir  string
+	clusterAddr string
+	numVbuckets int
+	maxRestore  int64 // bytes extracted from a backup archive
+}
+
+func NewBackupManager(supvMsgch MsgChannel, config common.Config) *backupManager {
+
+	m := &backupManager{
+		supvMsgch:   supvMsgch,
+		storageDir:  config["storage_dir"].String(),
+		clusterAddr: config["clusterAddr"].String(),
+		numVbuckets: config["numVbuckets"].Int(),
+		maxRestore:  int64(config["settings.restore_max_size"].Int()),
+	}
+
+	mux := GetHTTPMux()
+	mux.HandleFunc("/backupIndexData", m.handleBackupIndexData)
+	mux.HandleFunc("/restoreIndexData", m.handleRestoreIndexData)
+
+	return m
+}
+
+func (m *backupManager) validateAuth(w http.ResponseWriter, r *http.Request) (cbauth.Creds, bool) {
+	creds, valid, err := common.IsAuthValid(r)
+	if err != nil {
+		m.writeError(w, http.StatusBadRequest, err)
+	} else if valid == false {
+		w.WriteHeader(401)
+		w.Write([]byte("401 Unauthorized\n"))
+	}
+	return creds, valid
+}
+
+func (m *backupManager) writeError(w http.ResponseWriter, code int, err error) {
+	w.WriteHeader(code)
+	w.Write([]byte(err.Error() + "\n"))
+}
+
+func (m *backupManager) handleBackupIndexData(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := m.validateAuth(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != "GET" {
+		m.writeError(w, http.StatusMethodNotAllowed, errors.New("Unsupported method"))
+		return
+	}
+
+	bucket := r.FormValue("bucket")
+	if bucket == "" {
+		m.writeError(w, http.StatusBadRequest, errors.New("Missing bucket"))
+		return
+	}
+
+	// the archive has the data of the bucket in the index keys
+	permission := fmt.Sprintf("cluster.bucket[%s].n1ql.index!list", bucket)
+	if !common.IsAllowed(creds, []string{permission}, w) {
+		return
+	}
+
+	permissions := []string{
+		fmt.Sprintf("cluster.bucket[%s].data!backup", bucket),
+		fmt.Sprintf("cluster.bucket[%s].data.docs!read", bucket),
+	}
+	if !common.IsAllowed(creds, permissions, w) {
+		return
+	}
+
+	logging.Infof("BackupManager::handleBackupIndexData Bucket %v", bucket)
+
+	dir, err := ioutil.TempDir(m.storageDir, "backup_")
+	if err != nil {
+		m.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	respch := make(chan []*indexBackupEntry)
+	errch := make(chan error)
+	m.supvMsgch <- &MsgIndexBackup{
+		bucket: bucket,
+		dir:    dir,
+		respch: respch,
+		errch:  errch,
+	}
+
+	var entries []*indexBackupEntry
+	select {
+	case entries = <-respch:
+	case err = <-errch:
+	}
+
+	if err != nil {
+		logging.Errorf("BackupManager::handleBackupIndexData Bucket %v Error %v", bucket, err)
+		m.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	manifest := &indexBackupManifest{
+		Version: BACKUP_VERSION,
+		Bucket:  bucket,
+		Entries: entries,
+	}
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeBackupArchive(w, dir, manifest); err != nil {
+		logging.Errorf("BackupManager::handleBackupIndexData Bucket %v Error writing archive %v",
+			bucket, err)
+		return
+	}
+
+	logging.Infof("BackupManager::handleBackupIndexData Bucket %v backed up %v partitions",
+		bucket, len(entries))
+}
+
+func (m *backupManager) handleRestoreIndexData(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := m.validateAuth(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != "POST" {
+		m.writeError(w, http.StatusMethodNotAllowed, errors.New("Unsupported method"))
+		return
+	}
+
+	// the bucket to restore to, which can differ from the bucket of the
+	// backup, is authorized before the archive is read.
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		m.writeError(w, http.StatusBadRequest, errors.New("Missing bucket"))
+		return
+	}
+
+	permission := fmt.Sprintf("cluster.bucket[%s].n1ql.index!build", bucket)
+	if !common.IsAllowed(creds, []string{permission}, w) {
+		return
+	}
+
+	dir, err := ioutil.TempDir(m.storageDir, "restore_")
+	if err != nil {
+		m.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, err := readBackupArchive(r.Body, dir, m.maxRestore)
+	if err != nil {
+		m.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	logging.Infof("BackupManager::handleRestoreIndexData Bucket %v from backup of Bucket %v",
+		bucket, manifest.Bucket)
+
+	importData := true
+	if err := validateBackupTs(m.clusterAddr, bucket, m.numVbuckets, manifest.Entries); err != nil {
+		logging.Infof("BackupManager::handleRestoreIndexData Bucket %v. Index data is not "+
+			"imported. %v", bucket, err)
+		importData = false
+	}
+
+	respch := make(chan []*indexRestoreStatus)
+	errch := make(chan error)
+	m.supvMsgch <- &MsgIndexRestore{
+		bucket:     bucket,
+		dir:        dir,
+		entries:    manifest.Entries,
+		importData: importData,
+		respch:     respch,
+		errch:      errch,
+	}
+
+	var statuses []*indexRestoreStatus
+	select {
+	case statuses = <-respch:
+	case err = <-errch:
+	}
+
+	if err != nil {
+		logging.Errorf("BackupManager::handleRestoreIndexData Bucket %v Error %v", bucket, err)
+		m.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	bytes, err := json.Marshal(&indexRestoreResponse{Code: "success", Indexes: statuses})
+	if err != nil {
+		m.writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(bytes)
+}
+
+// writeBackupArchive writes the manifest and the files under dir as a
+// tar archive.
+func writeBackupArchive(w io.Writer, dir string, manifest *indexBackupManifest) error {
+
+	tw := tar.NewWriter(w)
+
+	bytes, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{
+		Name:    BACKUP_MANIFEST,
+		Mode:    0644,
+		Size:    int64(len(bytes)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(bytes); err != nil {
+		return err
+	}
+
+	walkFn := func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.CopyN(tw, f, fi.Size())
+		return err
+	}
+
+	if err := filepath.Walk(dir, walkFn); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// readBackupArchive extracts the files of a backup archive to dir, and
+// returns its manifest. Archive with more than maxSize bytes of files
+// is rejected, 0 is unbounded.
+func readBackupArchive(r io.Reader, dir string, maxSize int64) (*indexBackupManifest, error) {
+
+	var manifest *indexBackupManifest
+	var size int64
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." ||
+			strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("Invalid path %v in backup", hdr.Name)
+		}
+
+		// tar reader returns no more than hdr.Size bytes of a file.
+		size += hdr.Size
+		if maxSize > 0 && size > maxSize {
+			return nil, fmt.Errorf("Backup exceeds %v bytes", maxSize)
+		}
+
+		if name == BACKUP_MANIFEST {
+			manifest = &indexBackupManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if manifest == nil {
+		return nil, errors.New("Manifest not found in backup")
+	}
+
+	if manifest.Version > BACKUP_VERSION {
+		return nil, fmt.Errorf("Unsupported backup version %v", manifest.Version)
+	}
+
+	return manifest, nil
+}
+
+// validateBackupTs returns an error if the bucket may have lost any of
+// the mutations up to the timestamps of a backup.  For every vbucket,
+// the vbuuid of the timestamp has to be in the failover log, and the
+// vbucket must not have failed over to a newer vbuuid before the seqno
+// of the timestamp.
+func validateBackupTs(cluster, bucket string, numVbuckets int, entries []*indexBackupEntry) error {
+
+	b, err := common.ConnectBucket(cluster, DEFAULT_POOL, bucket)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	vbnos := make([]uint16, 0, numVbuckets)
+	for vb := 0; vb < numVbuckets; vb++ {
+		vbnos = append(vbnos, uint16(vb))
+	}
+
+	flogs, err := b.GetFailoverLogs(backupFailoverLogOpaque, vbnos, backupDcpConfig)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		ts := entry.Timestamp
+		if ts == nil || len(ts.Vbuuids) != numVbuckets || len(ts.Seqnos) != numVbuckets {
+			return fmt.Errorf("Invalid timestamp of Index %v PartitionId %v in backup",
+				entry.InstId, entry.PartnId)
+		}
+
+		for vb, vbuuid := range ts.Vbuuids {
+			seqno := ts.Seqnos[vb]
+			if vbuuid == 0 && seqno == 0 {
+				continue
+			}
+
+			if !isValidInFailoverLog(flogs[uint16(vb)], vbuuid, seqno) {
+				return fmt.Errorf("Vbucket %v of Bucket %v has failed over since backup. "+
+					"Vbuuid %v Seqno %v", vb, bucket, vbuuid, seqno)
+			}
+		}
+	}
+
+	return nil
+}
+
+// isValidInFailoverLog returns true if the mutations of a vbucket up to
+// seqno on the branch of vbuuid have not been rolled back.  The failover
+// log has the vbuuid and the start seqno of every branch, latest first.
+func isValidInFailoverLog(flog [][2]uint64, vbuuid, seqno uint64) bool {
+
+	for i, entry := range flog {
+		if entry[0] == vbuuid {
+			return i == 0 || flog[i-1][1] >= seqno
+		}
+	}
+	return false
+}
+
+// checkRestoreData returns an error if the data of an index in a backup
+// cannot be imported into a local index.
+func checkRestoreData(inst common.IndexInst, partns map[common.PartitionId]*indexBackupEntry) error {
+
+	for _, partnDefn := range inst.Pc.GetAllPartitions() {
+
+		entry, ok := partns[partnDefn.GetPartitionId()]
+		if !ok {
+			return fmt.Errorf("PartitionId %v not in backup", partnDefn.GetPartitionId())
+		}
+
+		if entry.Timestamp == nil {
+			return fmt.Errorf("PartitionId %v has no timestamp in backup", entry.PartnId)
+		}
+
+		defn := &entry.Defn
+		if defn.Using != inst.Defn.Using {
+			return fmt.Errorf("Storage %v of backup does not match storage %v of index",
+				defn.Using, inst.Defn.Using)
+		}
+
+		if defn.IsPrimary != inst.Defn.IsPrimary || defn.WhereExpr != inst.Defn.WhereExpr ||
+			!reflect.DeepEqual(defn.SecExprs, inst.Defn.SecExprs) ||
+			!reflect.DeepEqual(defn.Desc, inst.Defn.Desc) ||
+			entry.NumPartitions != inst.Pc.GetNumPartitions() {
+			return errors.New("Index definition in backup does not match index")
+		}
+	}
+
+	return nil
+}
+
+// rollbackToBackupSnapshot rolls an imported slice back to the snapshot
+// of the backup.  Slice files copied by the backup can have data after
+// the snapshot.
+func rollbackToBackupSnapshot(slice Slice, ts *common.TsVbuuid) error {
+
+	infos, err := slice.GetSnapshots()
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		if info.Timestamp().Equal(ts) {
+			return slice.Rollback(info, false)
+		}
+	}
+
+	return fmt.Errorf("Snapshot of backup not found in slice %v", slice.Path())
+}
@@ -0,0 +1,226 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestRestoreBuildList(t *testing.T) {
+	newStatuses := func() []*indexRestoreStatus {
+		return []*indexRestoreStatus{
+			{Name: "idx1", InstId: 1},
+			{Name: "idx2", InstId: 2},
+			{Name: "idx3", Status: RESTORE_STATUS_SKIPPED},
+			{Name: "idx4", InstId: 4},
+		}
+	}
+	errMismatch := errors.New("Index definition in backup does not match index")
+
+	// an index that cannot be imported does not fall back the others
+	statuses := newStatuses()
+	imported := map[common.IndexInstId]bool{1: true, 4: true}
+	failed := map[common.IndexInstId]error{2: errMismatch}
+	instIdList, fromBackup := restoreBuildList(statuses, imported, failed)
+	if !fromBackup {
+		t.Errorf("expected build from backup")
+	}
+	if !reflect.DeepEqual(instIdList, []common.IndexInstId{1, 4}) {
+		t.Errorf("expected to build [1 4], got %v", instIdList)
+	}
+	expected := []string{RESTORE_STATUS_RESTORED, RESTORE_STATUS_DEFERRED,
+		RESTORE_STATUS_SKIPPED, RESTORE_STATUS_RESTORED}
+	for i, status := range statuses {
+		if status.Status != expected[i] {
+			t.Errorf("%v: expected status %v, got %v", status.Name, expected[i], status.Status)
+		}
+	}
+	if statuses[1].Reason != errMismatch.Error() || statuses[0].Reason != "" {
+		t.Errorf("unexpected reasons %q %q", statuses[0].Reason, statuses[1].Reason)
+	}
+
+	// with no data imported, all the indexes are built from 0
+	statuses = newStatuses()
+	failed = map[common.IndexInstId]error{1: errMismatch, 2: errMismatch}
+	instIdList, fromBackup = restoreBuildList(statuses, nil, failed)
+	if fromBackup {
+		t.Errorf("expected build from 0")
+	}
+	if !reflect.DeepEqual(instIdList, []common.IndexInstId{1, 2, 4}) {
+		t.Errorf("expected to build [1 2 4], got %v", instIdList)
+	}
+	expected = []string{RESTORE_STATUS_BUILD, RESTORE_STATUS_BUILD,
+		RESTORE_STATUS_SKIPPED, RESTORE_STATUS_BUILD}
+	for i, status := range statuses {
+		if status.Status != expected[i] {
+			t.Errorf("%v: expected status %v, got %v", status.Name, expected[i], status.Status)
+		}
+	}
+}
+
+func TestCheckRestoreData(t *testing.T) {
+	newInst := func(numPartitions int) common.IndexInst {
+		var scheme common.PartitionScheme = common.SINGLE
+		if numPartitions > 1 {
+			scheme = common.KEY
+		}
+		pc := common.NewKeyPartitionContainer(8, numPartitions, scheme, common.CRC32)
+		for i := 1; i <= numPartitions; i++ {
+			id := common.PartitionId(i)
+			if numPartitions == 1 {
+				id = 0
+			}
+			pc.AddPartition(id, common.KeyPartitionDefn{Id: id})
+		}
+		defn := common.IndexDefn{
+			Name:     "idx",
+			Using:    common.PlasmaDB,
+			SecExprs: []string{"`age`"},
+		}
+		return common.IndexInst{InstId: 10, Defn: defn, Pc: pc}
+	}
+	newEntries := func(inst common.IndexInst) map[common.PartitionId]*indexBackupEntry {
+		entries := make(map[common.PartitionId]*indexBackupEntry)
+		for _, partn := range inst.Pc.GetAllPartitions() {
+			id := partn.GetPartitionId()
+			entries[id] = &indexBackupEntry{
+				Defn:          inst.Defn,
+				InstId:        20,
+				PartnId:       id,
+				NumPartitions: inst.Pc.GetNumPartitions(),
+				Timestamp:     common.NewTsVbuuid("default", 8),
+			}
+		}
+		return entries
+	}
+
+	inst := newInst(2)
+	if err := checkRestoreData(inst, newEntries(inst)); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	entries := newEntries(inst)
+	delete(entries, 2)
+	if err := checkRestoreData(inst, entries); err == nil {
+		t.Errorf("expected error for missing partition")
+	}
+
+	entries = newEntries(inst)
+	entries[1].Timestamp = nil
+	if err := checkRestoreData(inst, entries); err == nil {
+		t.Errorf("expected error for missing timestamp")
+	}
+
+	entries = newEntries(inst)
+	entries[2].Defn.Using = common.ForestDB
+	if err := checkRestoreData(inst, entries); err == nil {
+		t.Errorf("expected error for storage mismatch")
+	}
+
+	entries = newEntries(inst)
+	entries[1].Defn.SecExprs = []string{"`name`"}
+	if err := checkRestoreData(inst, entries); err == nil {
+		t.Errorf("expected error for definition mismatch")
+	}
+
+	single := newInst(1)
+	if err := checkRestoreData(single, newEntries(inst)); err == nil {
+		t.Errorf("expected error for partition mismatch")
+	}
+}
+
+func TestIsValidInFailoverLog(t *testing.T) {
+	// latest first: branch 30 from seqno 100, branch 20 from 50, branch 10 from 0
+	flog := [][2]uint64{{30, 100}, {20, 50}, {10, 0}}
+
+	tests := []struct {
+		vbuuid, seqno uint64
+		valid         bool
+	}{
+		{30, 150, true},
+		{20, 100, true},
+		{20, 101, false},
+		{10, 50, true},
+		{10, 60, false},
+		{40, 1, false},
+	}
+	for _, test := range tests {
+		if valid := isValidInFailoverLog(flog, test.vbuuid, test.seqno); valid != test.valid {
+			t.Errorf("vbuuid %v seqno %v: expected %v, got %v",
+				test.vbuuid, test.seqno, test.valid, valid)
+		}
+	}
+}
+
+func TestBackupArchive(t *testing.T) {
+	src, err := ioutil.TempDir("", "backup_src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dest, err := ioutil.TempDir("", "backup_dest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+
+	files := map[string]string{
+		"10_0/mainIndex/log.00000000000000.data": "main",
+		"10_0/docIndex/log.00000000000000.data":  "back",
+	}
+	for name, data := range files {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest := &indexBackupManifest{
+		Version: BACKUP_VERSION,
+		Bucket:  "default",
+		Entries: []*indexBackupEntry{{InstId: 10, Dir: "10_0"}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeBackupArchive(&buf, src, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := buf.Bytes()
+	restored, err := readBackupArchive(bytes.NewReader(archive), dest, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Bucket != "default" || len(restored.Entries) != 1 || restored.Entries[0].Dir != "10_0" {
+		t.Errorf("unexpected manifest %+v", restored)
+	}
+	for name, data := range files {
+		bs, err := ioutil.ReadFile(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(bs) != data {
+			t.Errorf("%v: expected %q, got %q", name, data, bs)
+		}
+	}
+
+	// manifest and one of the files fit in the limit.
+	mbytes, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := int64(len(mbytes) + len("main"))
+	if _, err := readBackupArchive(bytes.NewReader(archive), dest, limit); err == nil {
+		t.Errorf("expected archive past the size limit to be rejected")
+	}
+}
@@ -153,6 +153,9 @@ func (c *clustMgrAgent) handleSupvervisorCommands(cmd Message) {
 	case CLUST_MGR_DEL_BUCKET:
 		c.handleDeleteBucket(cmd)
 
+	case CLUST_MGR_DEL_COLLECTION:
+		c.handleDeleteCollection(cmd)
+
 	case CLUST_MGR_CLEANUP_INDEX:
 		c.handleCleanupIndex(cmd)
 
@@ -410,7 +413,7 @@ func (c *clustMgrAgent) handleGetGlobalTopology(cmd Message) {
 				partitions[i] = common.PartitionId(partn.PartId)
 				versions[i] = int(partn.Version)
 			}
-			pc := c.metaNotifier.makeDefaultPartitionContainer(partitions, versions, inst.NumPartitions, idxDefn.PartitionScheme, idxDefn.HashScheme)
+			pc := c.metaNotifier.makeDefaultPartitionContainer(partitions, versions, inst.NumPartitions, &idxDefn)
 
 			// create index instance
 			idxInst := common.IndexInst{
@@ -426,6 +429,12 @@ func (c *clustMgrAgent) handleGetGlobalTopology(cmd Message) {
 				OldStorageMode: inst.OldStorageMode,
 				Pc:             pc,
 				RealInstId:     common.IndexInstId(inst.RealInstId),
+				Paused:         inst.Paused,
+			}
+
+			// paused index is not added to any stream till it is resumed
+			if idxInst.Paused {
+				idxInst.Stream = common.NIL_STREAM
 			}
 
 			if idxInst.State != common.INDEX_STATE_DELETED {
@@ -516,6 +525,20 @@ func (c *clustMgrAgent) handleDeleteBucket(cmd Message) {
 	c.supvCmdch <- &MsgSuccess{}
 }
 
+func (c *clustMgrAgent) handleDeleteCollection(cmd Message) {
+
+	logging.Infof("ClustMgr:handleDeleteCollection %v", cmd)
+
+	bucket := cmd.(*MsgClustMgrUpdate).GetBucket()
+	collectionId := cmd.(*MsgClustMgrUpdate).GetCollectionId()
+	streamId := cmd.(*MsgClustMgrUpdate).GetStreamId()
+
+	err := c.mgr.DeleteIndexForCollection(bucket, collectionId, streamId)
+	common.CrashOnError(err)
+
+	c.supvCmdch <- &MsgSuccess{}
+}
+
 func (c *clustMgrAgent) handleCleanupIndex(cmd Message) {
 
 	logging.Infof("ClustMgr:handleCleanupIndex %v", cmd)
@@ -602,7 +625,7 @@ func (meta *metaNotifier) OnIndexCreate(indexDefn *common.IndexDefn, instId comm
 	logging.Infof("clustMgrAgent::OnIndexCreate Notification "+
 		"Received for Create Index %v %v partitions %v", indexDefn, reqCtx, partitions)
 
-	pc := meta.makeDefaultPartitionContainer(partitions, versions, numPartitions, indexDefn.PartitionScheme, indexDefn.HashScheme)
+	pc := meta.makeDefaultPartitionContainer(partitions, versions, numPartitions, indexDefn)
 
 	idxInst := common.IndexInst{InstId: instId,
 		Defn:       *indexDefn,
@@ -756,6 +779,97 @@ func (meta *metaNotifier) OnIndexDelete(instId common.IndexInstId,
 	return nil
 }
 
+func (meta *metaNotifier) OnIndexPause(instId common.IndexInstId, pause bool, reqCtx *common.MetadataRequestContext) error {
+
+	logging.Infof("clustMgrAgent::OnIndexPause Notification "+
+		"Received for Pause Index IndexId %v Pause %v %v", instId, pause, reqCtx)
+
+	respCh := make(MsgChannel)
+
+	meta.adminCh <- &MsgClustMgrPauseIndex{
+		instId: instId,
+		pause:  pause,
+		reqCtx: reqCtx,
+		respCh: respCh}
+
+	//wait for response
+	if res, ok := <-respCh; ok {
+
+		switch res.GetMsgType() {
+
+		case MSG_SUCCESS:
+			logging.Infof("clustMgrAgent::OnIndexPause Success "+
+				"for IndexId %v", instId)
+			return nil
+
+		case MSG_ERROR:
+			logging.Errorf("clustMgrAgent::OnIndexPause Error "+
+				"for IndexId %v. Error %v", instId, res)
+			err := res.(*MsgError).GetError()
+			return &common.IndexerError{Reason: err.String(), Code: err.convertError()}
+
+		default:
+			logging.Fatalf("clustMgrAgent::OnIndexPause Unknown Response "+
+				"Received for IndexId %v. Response %v", instId, res)
+			common.CrashOnError(errors.New("Unknown Response"))
+
+		}
+
+	} else {
+		logging.Fatalf("clustMgrAgent::OnIndexPause Unexpected Channel Close "+
+			"for IndexId %v", instId)
+		common.CrashOnError(errors.New("Unknown Response"))
+	}
+
+	return nil
+}
+
+func (meta *metaNotifier) OnIndexAggregates(instId common.IndexInstId,
+	aggregates []common.AggregateDefn, reqCtx *common.MetadataRequestContext) error {
+
+	logging.Infof("clustMgrAgent::OnIndexAggregates Notification "+
+		"Received for IndexId %v Aggregates %v %v", instId, aggregates, reqCtx)
+
+	respCh := make(MsgChannel)
+
+	meta.adminCh <- &MsgClustMgrUpdateAggregates{
+		instId:     instId,
+		aggregates: aggregates,
+		reqCtx:     reqCtx,
+		respCh:     respCh}
+
+	//wait for response
+	if res, ok := <-respCh; ok {
+
+		switch res.GetMsgType() {
+
+		case MSG_SUCCESS:
+			logging.Infof("clustMgrAgent::OnIndexAggregates Success "+
+				"for IndexId %v", instId)
+			return nil
+
+		case MSG_ERROR:
+			logging.Errorf("clustMgrAgent::OnIndexAggregates Error "+
+				"for IndexId %v. Error %v", instId, res)
+			err := res.(*MsgError).GetError()
+			return &common.IndexerError{Reason: err.String(), Code: err.convertError()}
+
+		default:
+			logging.Fatalf("clustMgrAgent::OnIndexAggregates Unknown Response "+
+				"Received for IndexId %v. Response %v", instId, res)
+			common.CrashOnError(errors.New("Unknown Response"))
+
+		}
+
+	} else {
+		logging.Fatalf("clustMgrAgent::OnIndexAggregates Unexpected Channel Close "+
+			"for IndexId %v", instId)
+		common.CrashOnError(errors.New("Unknown Response"))
+	}
+
+	return nil
+}
+
 func (meta *metaNotifier) OnPartitionPrune(instId common.IndexInstId, partitions []common.PartitionId, reqCtx *common.MetadataRequestContext) error {
 
 	logging.Infof("clustMgrAgent::OnPartitionPrune Notification "+
@@ -828,10 +942,10 @@ func (meta *metaNotifier) fetchStats() {
 }
 
 func (meta *metaNotifier) makeDefaultPartitionContainer(partitions []common.PartitionId, versions []int, numPartitions uint32,
-	scheme common.PartitionScheme, hash common.HashScheme) common.PartitionContainer {
+	defn *common.IndexDefn) common.PartitionContainer {
 
 	numVbuckets := meta.config["numVbuckets"].Int()
-	pc := common.NewKeyPartitionContainer(numVbuckets, int(numPartitions), scheme, hash)
+	pc := common.NewIndexPartitionContainer(numVbuckets, int(numPartitions), defn)
 
 	//Add one partition for now
 	addr := net.JoinHostPort("", meta.config["streamMaintPort"].String())
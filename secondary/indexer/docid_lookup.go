@@ -0,0 +1,157 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+var (
+	// back-index is not available for the slice or the type of index.
+	errBackIndexUnsupported = errors.New("Back index lookup not supported")
+
+	// back-index may have moved past the snapshot for the document.
+	errBackIndexAhead = errors.New("Back index ahead of snapshot")
+)
+
+// backIndexReader is implemented by snapshots of slices that maintain a
+// back-index. lookupBackIndex returns the main-index entries the back-index
+// presently holds for `docid`. The back-index is not versioned along with
+// the snapshot, hence entries returned shall be verified against the
+// snapshot before they are served.
+type backIndexReader interface {
+	lookupBackIndex(docid []byte, stopch StopChannel) ([][]byte, error)
+}
+
+// lookupDocIds calls `callb` with the index entry of each document in
+// `r.DocIds`, as of the snapshot. Slice snapshots of all partitions in the
+// request are looked up, a document being present in at most one of them.
+func lookupDocIds(r *ScanRequest, snapshots []SliceSnapshot,
+	stopch StopChannel, callb EntryCallback) error {
+
+	pending := make(map[string]bool)
+	for _, docid := range r.DocIds {
+		pending[string(docid)] = true
+	}
+
+	for i, snap := range snapshots {
+		if len(pending) == 0 {
+			break
+		}
+		err := lookupSliceDocIds(r, r.Ctxs[i], snap.Snapshot(), pending, stopch, callb)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupSliceDocIds looks up `pending` documents in a slice snapshot,
+// documents found are removed from `pending`. Documents that could not be
+// resolved through the back-index are located with a full scan of the
+// snapshot.
+func lookupSliceDocIds(r *ScanRequest, ctx IndexReaderContext, snap Snapshot,
+	pending map[string]bool, stopch StopChannel, callb EntryCallback) error {
+
+	unresolved := make(map[string]bool)
+	for docid := range pending {
+		found, err := lookupDocId(r, ctx, snap, []byte(docid), stopch, callb)
+		switch err {
+		case nil:
+			if found {
+				delete(pending, docid)
+			}
+		case errBackIndexUnsupported, errBackIndexAhead:
+			unresolved[docid] = true
+		default:
+			return err
+		}
+	}
+
+	if len(unresolved) == 0 {
+		return nil
+	}
+
+	var buf []byte
+	scanCallb := func(entry []byte) error {
+		select {
+		case <-stopch:
+			return common.ErrClientCancel
+		default:
+		}
+
+		docid := entry
+		if !r.isPrimary {
+			buf, _ = secondaryIndexEntry(entry).ReadDocId(buf[:0])
+			docid = buf
+		}
+		if unresolved[string(docid)] {
+			delete(pending, string(docid))
+			return callb(entry)
+		}
+		return nil
+	}
+	return snap.All(ctx, scanCallb)
+}
+
+// lookupDocId looks up a single document, returns whether it is present
+// in the snapshot.
+func lookupDocId(r *ScanRequest, ctx IndexReaderContext, snap Snapshot,
+	docid []byte, stopch StopChannel, callb EntryCallback) (bool, error) {
+
+	var found bool
+
+	// primary index is keyed on docid, no back-index is needed.
+	if r.isPrimary {
+		key, _ := NewPrimaryKey(docid)
+		err := snap.Lookup(ctx, key, func(entry []byte) error {
+			found = true
+			return callb(entry)
+		})
+		return found, err
+	}
+
+	br, ok := snap.(backIndexReader)
+	if !ok {
+		return false, errBackIndexUnsupported
+	}
+	// an empty result does not mean the document is absent from the
+	// snapshot, it may have been deleted after the snapshot was taken.
+	entries, err := br.lookupBackIndex(docid, stopch)
+	if err != nil {
+		return false, err
+	} else if len(entries) == 0 {
+		return false, errBackIndexAhead
+	}
+
+	var buf []byte
+	for _, entry := range entries {
+		key := secondaryKey(secondaryIndexEntry(entry).ReadSecKeyCJson())
+		err := snap.Lookup(ctx, &key, func(e []byte) error {
+			buf, _ = secondaryIndexEntry(e).ReadDocId(buf[:0])
+			if !bytes.Equal(buf, docid) {
+				return nil
+			}
+			found = true
+			return callb(e)
+		})
+		if err != nil {
+			return found, err
+		}
+	}
+
+	if !found {
+		return false, errBackIndexAhead
+	}
+	return true, nil
+}
@@ -0,0 +1,112 @@
+package indexer
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+)
+
+// docidTestSnapshot serves entries of the snapshot, and a back-index that
+// may have moved past the snapshot. Methods not overridden are not called
+// by docid lookups.
+type docidTestSnapshot struct {
+	Snapshot
+	entries   []secondaryIndexEntry
+	backIndex map[string][]secondaryIndexEntry
+	fullScans int
+}
+
+func (s *docidTestSnapshot) Lookup(ctx IndexReaderContext, key IndexKey,
+	callb EntryCallback) error {
+
+	for _, entry := range s.entries {
+		if bytes.Equal(entry.ReadSecKeyCJson(), key.Bytes()) {
+			if err := callb(entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *docidTestSnapshot) All(ctx IndexReaderContext, callb EntryCallback) error {
+	s.fullScans++
+	for _, entry := range s.entries {
+		if err := callb(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *docidTestSnapshot) lookupBackIndex(docid []byte,
+	stopch StopChannel) ([][]byte, error) {
+
+	var entries [][]byte
+	for _, entry := range s.backIndex[string(docid)] {
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func TestLookupDocIds(t *testing.T) {
+	newEntry := func(key, docid string) secondaryIndexEntry {
+		entry, err := newSKEntry([]byte(key), []byte(docid))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(secondaryIndexEntry(nil), entry...)
+	}
+
+	snap := &docidTestSnapshot{
+		entries: []secondaryIndexEntry{
+			newEntry(`["a"]`, "doc1"),
+			newEntry(`["b"]`, "doc2"),
+			newEntry(`["c"]`, "doc3"),
+		},
+		backIndex: map[string][]secondaryIndexEntry{
+			"doc1": {newEntry(`["a"]`, "doc1")},
+		},
+	}
+
+	lookup := func(docids ...string) []string {
+		r := &ScanRequest{}
+		for _, docid := range docids {
+			r.DocIds = append(r.DocIds, []byte(docid))
+		}
+		r.Ctxs = []IndexReaderContext{nil}
+
+		var found []string
+		var buf []byte
+		err := lookupDocIds(r, []SliceSnapshot{&sliceSnapshot{snap: snap}}, nil,
+			func(entry []byte) error {
+				buf, _ = secondaryIndexEntry(entry).ReadDocId(buf[:0])
+				found = append(found, string(buf))
+				return nil
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(found)
+		return found
+	}
+
+	// back-index agrees with the snapshot
+	if found := lookup("doc1"); len(found) != 1 || found[0] != "doc1" {
+		t.Errorf("expected doc1, got %v", found)
+	}
+	if snap.fullScans != 0 {
+		t.Errorf("expected lookup through back-index, got %v full scans", snap.fullScans)
+	}
+
+	// doc2 deleted after the snapshot, doc3 updated after the snapshot
+	snap.backIndex["doc3"] = []secondaryIndexEntry{newEntry(`["z"]`, "doc3")}
+	found := lookup("doc1", "doc2", "doc3", "doc4")
+	if len(found) != 3 || found[0] != "doc1" || found[1] != "doc2" || found[2] != "doc3" {
+		t.Errorf("expected documents in the snapshot, got %v", found)
+	}
+	if snap.fullScans != 1 {
+		t.Errorf("expected one full scan to verify against the snapshot, got %v",
+			snap.fullScans)
+	}
+}
@@ -151,6 +151,7 @@ retry:
 	slice.path = path
 	slice.currfile = filepath
 	slice.idxInstId = idxInstId
+	slice.idxPartnId = partitionId
 	slice.idxDefnId = idxDefn.DefnId
 	slice.idxDefn = idxDefn
 	slice.id = sliceId
@@ -217,6 +218,11 @@ type fdbSlice struct {
 	//while compaction is running in the background.
 	compactFd *forestdb.File
 
+	//backup copies the data file, which compaction replaces, up to
+	//the last commit, which has to include the snapshot meta
+	backupLock sync.Mutex
+	commitLock sync.Mutex
+
 	fileVersion uint8
 
 	metaLock sync.Mutex
@@ -226,9 +232,10 @@ type fdbSlice struct {
 
 	config *forestdb.Config
 
-	idxDefn   common.IndexDefn
-	idxDefnId common.IndexDefnId
-	idxInstId common.IndexInstId
+	idxDefn    common.IndexDefn
+	idxDefnId  common.IndexDefnId
+	idxInstId  common.IndexInstId
+	idxPartnId common.PartitionId
 
 	status        SliceStatus
 	isActive      bool
@@ -319,6 +326,46 @@ func (fdb *fdbSlice) Delete(docid []byte, meta *MutationMeta) error {
 	return fdb.fatalDbErr
 }
 
+//backIndexLookup is queued on the command channel to read
+//the back index from a worker, as handles are not shared
+//across goroutines.
+type backIndexLookup struct {
+	docid  []byte
+	respch chan interface{}
+}
+
+//lookupBackIndex returns the main index entry held by the
+//back index for docid. Array indexes keep the raw array key
+//in the back index, lookup is not supported for them.
+func (fdb *fdbSlice) lookupBackIndex(docid []byte, stopch StopChannel) ([][]byte, error) {
+	if fdb.isPrimary || fdb.idxDefn.IsArrayIndex {
+		return nil, errBackIndexUnsupported
+	}
+
+	cmd := &backIndexLookup{docid: docid, respch: make(chan interface{}, 1)}
+	select {
+	case fdb.cmdCh <- cmd:
+	case <-stopch:
+		return nil, common.ErrClientCancel
+	}
+
+	select {
+	case resp := <-cmd.respch:
+		switch r := resp.(type) {
+		case error:
+			return nil, r
+		case []byte:
+			if len(r) == 0 {
+				return nil, nil
+			}
+			return [][]byte{r}, nil
+		}
+		return nil, nil
+	case <-stopch:
+		return nil, common.ErrClientCancel
+	}
+}
+
 //handleCommands keep listening to any buffered
 //write requests for the slice and processes
 //those. This will shut itself down internal
@@ -351,6 +398,15 @@ loop:
 				elapsed = time.Since(start)
 				fdb.totalFlushTime += elapsed
 
+			case *backIndexLookup:
+				lcmd := c.(*backIndexLookup)
+				if kbytes, err := fdb.getBackIndexEntry(lcmd.docid, workerId); err != nil {
+					lcmd.respch <- err
+				} else {
+					lcmd.respch <- kbytes
+				}
+				continue loop
+
 			default:
 				logging.Errorf("ForestDBSlice::handleCommandsWorker \n\tSliceId %v IndexInstId %v Received "+
 					"Unknown Command %v", fdb.id, fdb.idxInstId, logging.TagUD(c))
@@ -469,6 +525,7 @@ func (fdb *fdbSlice) insertSecIndex(key []byte, docid []byte, workerId int) (nmu
 		}
 		fdb.idxStats.Timings.stKVDelete.Put(time.Now().Sub(t0))
 		atomic.AddInt64(&fdb.delete_bytes, int64(len(oldkey)))
+		materializedAggrs.update(fdb.idxInstId, fdb.idxPartnId, oldkey, nil)
 
 		// If a field value changed from "existing" to "missing" (ie, key = nil),
 		// we need to remove back index entry corresponding to the previous "existing" value.
@@ -514,6 +571,7 @@ func (fdb *fdbSlice) insertSecIndex(key []byte, docid []byte, workerId int) (nmu
 	}
 	fdb.idxStats.Timings.stKVSet.Put(time.Now().Sub(t0))
 	atomic.AddInt64(&fdb.insert_bytes, int64(len(key)))
+	materializedAggrs.update(fdb.idxInstId, fdb.idxPartnId, nil, key)
 	fdb.isDirty = true
 
 	nmut = 1
@@ -793,6 +851,7 @@ func (fdb *fdbSlice) deleteSecIndex(docid []byte, workerId int) (nmut int) {
 	}
 	fdb.idxStats.Timings.stKVDelete.Put(time.Now().Sub(t0))
 	atomic.AddInt64(&fdb.delete_bytes, int64(len(olditm)))
+	materializedAggrs.update(fdb.idxInstId, fdb.idxPartnId, olditm, nil)
 
 	//delete from the back index
 	t0 = time.Now()
@@ -1227,14 +1286,17 @@ func (fdb *fdbSlice) NewSnapshot(ts *common.TsVbuuid, commit bool) (SnapshotInfo
 
 		// Meta update should be done before commit
 		// Otherwise, metadata will not be atomically updated along with disk commit.
+		fdb.commitLock.Lock()
 		err = fdb.updateSnapshotsMeta(sic.List())
 		if err != nil {
+			fdb.commitLock.Unlock()
 			return nil, err
 		}
 
 		// Commit database file
 		start := time.Now()
 		err = fdb.dbfile.Commit(forestdb.COMMIT_MANUAL_WAL_FLUSH)
+		fdb.commitLock.Unlock()
 		elapsed := time.Since(start)
 		fdb.idxStats.Timings.stCommit.Put(elapsed)
 
@@ -1375,6 +1437,9 @@ func (fdb *fdbSlice) Compact(abortTime time.Time, minFrag int) error {
 	fdb.IncrRef()
 	defer fdb.DecrRef()
 
+	fdb.backupLock.Lock()
+	defer fdb.backupLock.Unlock()
+
 	fdb.setIsCompacting(true)
 	defer fdb.setIsCompacting(false)
 
@@ -1597,6 +1662,46 @@ handle_err:
 	return errors.New("Failed to update snapshots list -" + err.Error())
 }
 
+//Backup copies the data file up to the commit of the latest snapshot
+//to dir. The file is append-only till it is replaced by compaction,
+//which waits for the backup to complete.
+func (fdb *fdbSlice) Backup(dir string) (SnapshotInfo, error) {
+
+	fdb.backupLock.Lock()
+	defer fdb.backupLock.Unlock()
+
+	fdb.commitLock.Lock()
+	infos, err := fdb.getSnapshotsMeta()
+	if err != nil {
+		fdb.commitLock.Unlock()
+		return nil, err
+	}
+	size, err := common.FileSize(fdb.currfile)
+	fdb.commitLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	info := NewSnapshotInfoContainer(infos).GetLatest()
+	if info == nil {
+		return nil, ErrNoSnapshotForBackup
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	dest := filepath.Join(dir, filepath.Base(fdb.currfile))
+	if err := copyFilePrefix(dest, fdb.currfile, size); err != nil {
+		return nil, err
+	}
+
+	logging.Infof("ForestDBSlice::Backup Slice Id %v, IndexInstId %v, IndexDefnId %v backed up "+
+		"%v bytes of %v to %v", fdb.id, fdb.idxInstId, fdb.idxDefnId, size, fdb.currfile, dir)
+
+	return info, nil
+}
+
 func (fdb *fdbSlice) getSnapshotsMeta() ([]SnapshotInfo, error) {
 	var tmp []*fdbSnapshotInfo
 	var snapList []SnapshotInfo
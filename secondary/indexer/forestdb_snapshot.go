@@ -179,3 +179,7 @@ func (s *fdbSnapshot) Info() SnapshotInfo {
 		Ts:        s.ts,
 	}
 }
+
+func (s *fdbSnapshot) lookupBackIndex(docid []byte, stopch StopChannel) ([][]byte, error) {
+	return s.slice.lookupBackIndex(docid, stopch)
+}
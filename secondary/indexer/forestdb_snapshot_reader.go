@@ -197,12 +197,15 @@ func (s *fdbSnapshot) Iterate(ctx IndexReaderContext, low, high IndexKey, inclus
 	ttime := time.Now()
 
 	var entry IndexEntry
+	log := readerLogger(ctx)
 	it, err := newFDBSnapshotIterator(s)
 	if err != nil {
+		log.Errorf("ForestDBSnapshot::Iterate Slice Id %v IndexInstId %v "+
+			"failed to create iterator (%v)", s.slice.id, s.slice.idxInstId, err)
 		return err
 	}
 	defer func() {
-		go closeIterator(it)
+		go closeIterator(it, log)
 	}()
 
 	defer func() {
@@ -253,10 +256,10 @@ func (s *fdbSnapshot) isPrimary() bool {
 	return s.slice.isPrimary
 }
 
-func closeIterator(it *ForestDBIterator) {
+func closeIterator(it *ForestDBIterator, log *logging.Entry) {
 	err := it.Close()
 	if err != nil {
-		logging.Errorf("ForestDB iterator: dealloc failed (%v)", err)
+		log.Errorf("ForestDB iterator: dealloc failed (%v)", err)
 	}
 }
 
@@ -9,6 +9,8 @@
 
 package indexer
 
+import "github.com/couchbase/indexing/secondary/logging"
+
 // Inclusion controls how the boundaries values of a range are treated
 type Inclusion int
 
@@ -58,6 +60,12 @@ type Ranger interface {
 	Range(IndexReaderContext, IndexKey, IndexKey, Inclusion, EntryCallback) error
 }
 
+// ReverseRanger is a class of algorithms that can extract a range of keys
+// from the index in descending order, without materializing the range.
+type ReverseRanger interface {
+	ReverseRange(IndexReaderContext, IndexKey, IndexKey, Inclusion, EntryCallback) error
+}
+
 // RangeCounter is a class of algorithms that can count a range efficiently
 type RangeCounter interface {
 	CountRange(ctx IndexReaderContext, low, high IndexKey, inclusion Inclusion, stopch StopChannel) (
@@ -80,4 +88,8 @@ type IndexReaderContext interface {
 	Done()
 	SetCursorKey(cur *[]byte)
 	GetCursorKey() *[]byte
+	// Logger carries the correlation fields of the scan request
+	// reading through this context.
+	SetLogger(log *logging.Entry)
+	Logger() *logging.Entry
 }
@@ -79,6 +79,10 @@ func (ps *partitionSnapshot) Slices() map[SliceId]SliceSnapshot {
 type sliceSnapshot struct {
 	id   SliceId
 	snap Snapshot
+
+	// materialized aggregates as of the snapshot, nil if the index has
+	// none or they are being seeded.
+	aggrs *aggrFrozen
 }
 
 func (ss *sliceSnapshot) SliceId() SliceId {
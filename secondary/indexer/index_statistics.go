@@ -0,0 +1,318 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+package indexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"github.com/golang/protobuf/proto"
+)
+
+//--------------------------
+// statistics collector
+//--------------------------
+
+// statsCollector computes count, distinct count, min/max key and an
+// equi-depth histogram over index keys, fed in index order. Equal keys
+// are always adjacent in index order, hence distinct count is exact
+// for a single slice.
+//
+// Histogram is built in a single pass without knowing the total count
+// upfront. Bins are closed once they reach `depth` rows and only on a key
+// change, so that a key never spans two bins. When the number of bins
+// reach 2*nbins adjacent bins are merged and the depth is doubled, which
+// leaves the collector with nbins to 2*nbins bins of nearly equal depth.
+type statsCollector struct {
+	nbins int
+	depth uint64
+
+	count    uint64
+	distinct uint64
+	min, max []byte
+	prev     []byte
+	started  bool
+
+	bins []*statsBin
+	bin  *statsBin
+
+	leadKey *statsCollector
+	explode []byte
+	lead    []byte
+
+	decode func(key, buf []byte) ([]byte, error)
+}
+
+type statsBin struct {
+	count    uint64
+	distinct uint64
+	min, max []byte
+}
+
+func newStatsCollector(nbins int, isPrimary, isComposite bool) *statsCollector {
+	c := newKeyCollector(nbins, isPrimary)
+	if isComposite {
+		c.leadKey = newKeyCollector(nbins, false)
+	}
+	return c
+}
+
+func newKeyCollector(nbins int, isPrimary bool) *statsCollector {
+	c := &statsCollector{nbins: nbins, depth: 1}
+	if isPrimary {
+		c.decode = decodePrimaryKey
+	} else {
+		c.decode = decodeSecondaryKey
+	}
+	return c
+}
+
+// addKey to statistics, `key` is in its natural collation (i.e. desc
+// keys are already reverse collated) and `count` is the number of rows
+// the key stands for.
+func (c *statsCollector) addKey(key []byte, count uint64) error {
+	changed := !c.started || !bytes.Equal(c.prev, key)
+	if changed {
+		c.started = true
+		c.prev = append(c.prev[:0], key...)
+		c.distinct++
+		if c.min == nil || bytes.Compare(key, c.min) < 0 {
+			c.min = append(c.min[:0], key...)
+		}
+		if c.max == nil || bytes.Compare(key, c.max) > 0 {
+			c.max = append(c.max[:0], key...)
+		}
+	}
+	c.count += count
+
+	if c.nbins > 0 {
+		c.addToBin(key, count, changed)
+	}
+
+	if c.leadKey != nil {
+		if changed {
+			if err := c.projectLeadKey(key); err != nil {
+				return err
+			}
+		}
+		return c.leadKey.addKey(c.lead, count)
+	}
+	return nil
+}
+
+func (c *statsCollector) addToBin(key []byte, count uint64, changed bool) {
+	if c.bin == nil || (changed && c.bin.count >= c.depth) {
+		c.bin = &statsBin{}
+		c.bins = append(c.bins, c.bin)
+		if len(c.bins) >= 2*c.nbins {
+			c.foldBins()
+		}
+	}
+	bin := c.bin
+	if changed {
+		bin.distinct++
+		if bin.min == nil || bytes.Compare(key, bin.min) < 0 {
+			bin.min = append(bin.min[:0], key...)
+		}
+		if bin.max == nil || bytes.Compare(key, bin.max) > 0 {
+			bin.max = append(bin.max[:0], key...)
+		}
+	}
+	bin.count += count
+}
+
+// foldBins merge adjacent pair of bins and double the depth.
+func (c *statsCollector) foldBins() {
+	bins := make([]*statsBin, 0, c.nbins)
+	for i := 0; i < len(c.bins); i += 2 {
+		if i+1 == len(c.bins) {
+			bins = append(bins, c.bins[i])
+			break
+		}
+		bins = append(bins, mergeBins(c.bins[i], c.bins[i+1]))
+	}
+	c.bins, c.depth = bins, c.depth*2
+	c.bin = c.bins[len(c.bins)-1]
+}
+
+func mergeBins(a, b *statsBin) *statsBin {
+	bin := &statsBin{
+		count:    a.count + b.count,
+		distinct: a.distinct + b.distinct,
+		min:      a.min,
+		max:      a.max,
+	}
+	if b.min != nil && (bin.min == nil || bytes.Compare(b.min, bin.min) < 0) {
+		bin.min = b.min
+	}
+	if b.max != nil && (bin.max == nil || bytes.Compare(b.max, bin.max) > 0) {
+		bin.max = b.max
+	}
+	return bin
+}
+
+func (c *statsCollector) projectLeadKey(key []byte) (err error) {
+	if len(key) > cap(c.explode) {
+		c.explode = make([]byte, 0, len(key)+RESIZE_PAD)
+	}
+	compositekeys, err := jsonEncoder.ExplodeArray(key, c.explode[:0])
+	if err != nil {
+		return err
+	}
+	c.lead, err = jsonEncoder.JoinArray(compositekeys[:1], c.lead[:0])
+	return err
+}
+
+// statistics as protobuf message, keys are decoded to JSON.
+func (c *statsCollector) statistics() (*protobuf.IndexStatistics, error) {
+	stats, err := c.makeStatistics(c.count, c.distinct, c.min, c.max)
+	if err != nil {
+		return nil, err
+	}
+	for _, bin := range c.bins {
+		b, err := c.makeStatistics(bin.count, bin.distinct, bin.min, bin.max)
+		if err != nil {
+			return nil, err
+		}
+		stats.Bins = append(stats.Bins, b)
+	}
+	if c.leadKey != nil {
+		if stats.LeadKey, err = c.leadKey.statistics(); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+func (c *statsCollector) makeStatistics(count, distinct uint64,
+	min, max []byte) (stats *protobuf.IndexStatistics, err error) {
+
+	stats = &protobuf.IndexStatistics{
+		KeysCount:       proto.Uint64(count),
+		UniqueKeysCount: proto.Uint64(distinct),
+		KeyMin:          []byte("[]"),
+		KeyMax:          []byte("[]"),
+	}
+	if min != nil {
+		if stats.KeyMin, err = c.decode(min, nil); err != nil {
+			return nil, err
+		}
+	}
+	if max != nil {
+		if stats.KeyMax, err = c.decode(max, nil); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+func decodeSecondaryKey(key, buf []byte) ([]byte, error) {
+	if cap(buf) < 3*len(key)+RESIZE_PAD {
+		buf = make([]byte, 0, 3*len(key)+RESIZE_PAD)
+	}
+	out, err := jsonEncoder.Decode(key, buf[:0])
+	if err != nil {
+		return nil, fmt.Errorf("Collatejson decode error: %v", err)
+	}
+	return out, nil
+}
+
+// primary keys are raw docids, present them as single element array.
+func decodePrimaryKey(key, buf []byte) ([]byte, error) {
+	return json.Marshal([]string{string(key)})
+}
+
+//--------------------------
+// statistics cache
+//--------------------------
+
+// indexStatsCache hold statistics on full index, per index instance and
+// set of partitions. Computing statistics require a full scan, hence they
+// are refreshed only when the cached copy is older than refresh interval
+// or the number of items in the index has changed beyond refresh ratio.
+type indexStatsCache struct {
+	mu    sync.Mutex
+	cache map[indexStatsKey]*cachedIndexStats
+}
+
+type indexStatsKey struct {
+	instId common.IndexInstId
+	partns string
+}
+
+type cachedIndexStats struct {
+	stats   *protobuf.IndexStatistics
+	count   uint64
+	nbins   int
+	created time.Time
+}
+
+func newIndexStatsCache() *indexStatsCache {
+	return &indexStatsCache{cache: make(map[indexStatsKey]*cachedIndexStats)}
+}
+
+func makeIndexStatsKey(instId common.IndexInstId,
+	partnIds []common.PartitionId) indexStatsKey {
+
+	return indexStatsKey{instId: instId, partns: fmt.Sprintf("%v", partnIds)}
+}
+
+// get cached statistics if still current, `count` is the number of items
+// presently in the index.
+func (sc *indexStatsCache) get(key indexStatsKey, count uint64, nbins int,
+	interval time.Duration, ratio float64) *protobuf.IndexStatistics {
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	cached, ok := sc.cache[key]
+	if !ok || cached.nbins != nbins {
+		return nil
+	}
+
+	delta := float64(count) - float64(cached.count)
+	if delta < 0 {
+		delta = -delta
+	}
+	if delta > ratio*float64(cached.count) || time.Since(cached.created) > interval {
+		return nil
+	}
+	return cached.stats
+}
+
+func (sc *indexStatsCache) put(key indexStatsKey, count uint64, nbins int,
+	stats *protobuf.IndexStatistics) {
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.cache[key] = &cachedIndexStats{
+		stats:   stats,
+		count:   count,
+		nbins:   nbins,
+		created: time.Now(),
+	}
+}
+
+// prune statistics of index instances not present in `indexInstMap`.
+func (sc *indexStatsCache) prune(indexInstMap common.IndexInstMap) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for key := range sc.cache {
+		if _, ok := indexInstMap[key.instId]; !ok {
+			delete(sc.cache, key)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package indexer
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+)
+
+func encodeStatsKey(t *testing.T, key string) []byte {
+	code, err := jsonEncoder.Encode([]byte(key), make([]byte, 0, 3*len(key)+RESIZE_PAD))
+	if err != nil {
+		t.Fatalf("encode %v: %v", key, err)
+	}
+	return code
+}
+
+func TestStatsCollector(t *testing.T) {
+	nbins := 4
+	c := newStatsCollector(nbins, false, true)
+
+	// 10 leading keys, each with 10 distinct second keys.
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			key := fmt.Sprintf(`["a%d","k%02d"]`, i, j)
+			if err := c.addKey(encodeStatsKey(t, key), 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// duplicate keys adds to count, not to distinct.
+	if err := c.addKey(encodeStatsKey(t, `["a9","k09"]`), 5); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := c.statistics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.GetKeysCount() != 105 || stats.GetUniqueKeysCount() != 100 {
+		t.Errorf("unexpected count %v distinct %v",
+			stats.GetKeysCount(), stats.GetUniqueKeysCount())
+	}
+	if s := string(stats.GetKeyMin()); s != `["a0","k00"]` {
+		t.Errorf("unexpected min %v", s)
+	}
+	if s := string(stats.GetKeyMax()); s != `["a9","k09"]` {
+		t.Errorf("unexpected max %v", s)
+	}
+
+	bins := stats.GetBins()
+	if len(bins) < nbins || len(bins) >= 2*nbins {
+		t.Errorf("unexpected number of bins %v", len(bins))
+	}
+	var count, distinct uint64
+	for _, bin := range bins {
+		count += bin.GetKeysCount()
+		distinct += bin.GetUniqueKeysCount()
+	}
+	if count != 105 || distinct != 100 {
+		t.Errorf("unexpected bin count %v distinct %v", count, distinct)
+	}
+
+	lead := stats.GetLeadKey()
+	if lead == nil {
+		t.Fatalf("missing lead key statistics")
+	}
+	if lead.GetKeysCount() != 105 || lead.GetUniqueKeysCount() != 10 {
+		t.Errorf("unexpected lead key count %v distinct %v",
+			lead.GetKeysCount(), lead.GetUniqueKeysCount())
+	}
+	if s := string(lead.GetKeyMin()); s != `["a0"]` {
+		t.Errorf("unexpected lead key min %v", s)
+	}
+	if s := string(lead.GetKeyMax()); s != `["a9"]` {
+		t.Errorf("unexpected lead key max %v", s)
+	}
+}
+
+func TestStatsCollectorEmpty(t *testing.T) {
+	stats, err := newStatsCollector(4, true, false).statistics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.GetKeysCount() != 0 || len(stats.GetBins()) != 0 {
+		t.Errorf("unexpected statistics %v", stats)
+	}
+	if string(stats.GetKeyMin()) != "[]" || string(stats.GetKeyMax()) != "[]" {
+		t.Errorf("unexpected min/max %s/%s", stats.GetKeyMin(), stats.GetKeyMax())
+	}
+}
+
+// statsTestSnapshot serves primary keys of a sorted list, methods not
+// overridden are not called by statistics.
+type statsTestSnapshot struct {
+	Snapshot
+	keys [][]byte
+}
+
+func (s *statsTestSnapshot) All(ctx IndexReaderContext, callb EntryCallback) error {
+	return s.Range(ctx, &NilIndexKey{}, &NilIndexKey{}, Both, callb)
+}
+
+func (s *statsTestSnapshot) Range(ctx IndexReaderContext, low, high IndexKey,
+	incl Inclusion, callb EntryCallback) error {
+
+	for _, key := range s.keys {
+		if l := low.Bytes(); l != nil && bytes.Compare(key, l) < 0 {
+			continue
+		}
+		if h := high.Bytes(); h != nil && bytes.Compare(key, h) > 0 {
+			continue
+		}
+		if err := callb(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestStatsSingleSliceLookup(t *testing.T) {
+	snap := &statsTestSnapshot{}
+	for i := 0; i < 10; i++ {
+		snap.keys = append(snap.keys, []byte(fmt.Sprintf("doc%d", i)))
+	}
+
+	statistics := func(keys ...string) uint64 {
+		r := &ScanRequest{isPrimary: true, Low: &NilIndexKey{}, High: &NilIndexKey{}}
+		for _, key := range keys {
+			k, _ := NewPrimaryKey([]byte(key))
+			r.Keys = append(r.Keys, k)
+		}
+		var wg sync.WaitGroup
+		var stats *protobuf.IndexStatistics
+		errch := make(chan error, 1)
+		wg.Add(1)
+		statsSingleSlice(r, nil, &sliceSnapshot{snap: snap}, 4, &wg, errch,
+			make(StopChannel), &stats)
+		if len(errch) > 0 {
+			t.Fatal(<-errch)
+		}
+		return stats.GetKeysCount()
+	}
+
+	if count := statistics(); count != 10 {
+		t.Errorf("expected 10 keys in index, got %v", count)
+	}
+	if count := statistics("doc3"); count != 1 {
+		t.Errorf("expected 1 key for lookup, got %v", count)
+	}
+	if count := statistics("doc3", "doc7", "missing"); count != 2 {
+		t.Errorf("expected 2 keys for lookup, got %v", count)
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"time"
 
 	"github.com/couchbase/indexing/secondary/common"
+	mcd "github.com/couchbase/indexing/secondary/dcp/transport"
 	"github.com/couchbase/indexing/secondary/fdb"
 	"github.com/couchbase/indexing/secondary/logging"
 	mc "github.com/couchbase/indexing/secondary/manager/common"
@@ -108,6 +109,9 @@ type indexer struct {
 	bucketBuildTs map[string]Timestamp
 	buildTsLock   map[common.StreamId]map[string]*sync.Mutex
 
+	//collections being dropped, keyed by bucket and collection id
+	collectionDropInProgress map[string]bool
+
 	//TODO Remove this once cbq bridge support goes away
 	bucketCreateClientChMap map[string]MsgChannel
 
@@ -240,6 +244,7 @@ func NewIndexer(config common.Config) (Indexer, Message) {
 		streamBucketRequestLock:      make(map[common.StreamId]map[string]chan *sync.Mutex),
 		streamBucketSessionId:        make(map[common.StreamId]map[string]uint64),
 		bucketBuildTs:                make(map[string]Timestamp),
+		collectionDropInProgress:     make(map[string]bool),
 		buildTsLock:                  make(map[common.StreamId]map[string]*sync.Mutex),
 		bucketRollbackTimes:          make(map[string]int64),
 		bucketCreateClientChMap:      make(map[string]MsgChannel),
@@ -263,7 +268,7 @@ func NewIndexer(config common.Config) (Indexer, Message) {
 
 	//Initialize security context
 	encryptLocalHost := config["security.encryption.encryptLocalhost"].Bool()
-	err := idx.initSecurityContext(encryptLocalHost)
+	err := idx.initSecurityContext(encryptLocalHost, common.GetClientAuthConfig(config))
 	if err != nil {
 		idxErr := Error{
 			code:     ERROR_INDEXER_INTERNAL_ERROR,
@@ -380,7 +385,8 @@ func NewIndexer(config common.Config) (Indexer, Message) {
 
 }
 
-func (idx *indexer) initSecurityContext(encryptLocalHost bool) error {
+func (idx *indexer) initSecurityContext(encryptLocalHost bool,
+	clientAuth security.ClientAuthConfig) error {
 
 	certFile := idx.config["certFile"].String()
 	keyFile := idx.config["keyFile"].String()
@@ -390,6 +396,10 @@ func (idx *indexer) initSecurityContext(encryptLocalHost bool) error {
 		return err
 	}
 
+	if err := security.SetClientAuthConfig(clientAuth); err != nil {
+		return err
+	}
+
 	fn := func(refreshCert bool, refreshEncrypt bool) error {
 		select {
 		case <-idx.enableSecurityChange:
@@ -520,6 +530,7 @@ func (idx *indexer) initFromConfig() {
 	plasma.SetMemoryQuota(int64(float64(memQuota) * PLASMA_MEMQUOTA_FRAC))
 	memdb.Debug(idx.config["settings.moi.debug"].Bool())
 	updateMOIWriters(idx.config["settings.moi.persistence_threads"].Int())
+	materializedAggrs.setMaxMemory(int64(idx.config["settings.materialized_aggr.max_memory"].Int()))
 	reclaimBlockSize := int64(idx.config["plasma.LSSReclaimBlockSize"].Int())
 	plasma.SetLogReclaimBlockSize(reclaimBlockSize)
 
@@ -592,6 +603,7 @@ func (idx *indexer) initHTTPMux() {
 	idx.settingsMgr.RegisterRestEndpoints()
 	idx.statsMgr.RegisterRestEndpoints()
 	idx.clustMgrAgent.RegisterRestEndpoints()
+	idx.scanCoord.RegisterRestEndpoints()
 }
 
 func (idx *indexer) initPeriodicProfile() {
@@ -963,6 +975,9 @@ func (idx *indexer) handleWorkerMsgs(msg Message) {
 		idx.tkCmdCh <- msg
 		<-idx.tkCmdCh
 
+	case STREAM_READER_SYSTEM_EVENT:
+		idx.handleSystemEvent(msg)
+
 	case TK_STABILITY_TIMESTAMP:
 		//send TS to Mutation Manager
 		ts := msg.(*MsgTKStabilityTS).GetTimestamp()
@@ -1044,7 +1059,8 @@ func (idx *indexer) handleWorkerMsgs(msg Message) {
 
 	case STORAGE_INDEX_SNAP_REQUEST,
 		STORAGE_INDEX_STORAGE_STATS,
-		STORAGE_INDEX_COMPACT:
+		STORAGE_INDEX_COMPACT,
+		STORAGE_INDEX_BACKUP:
 		idx.storageMgrCmdCh <- msg
 		<-idx.storageMgrCmdCh
 
@@ -1164,6 +1180,9 @@ func (idx *indexer) handleWorkerMsgs(msg Message) {
 	case INDEXER_SECURITY_CHANGE:
 		idx.handleSecurityChange(msg)
 
+	case INDEXER_RESTORE_INDEX_DATA:
+		idx.handleRestoreIndexData(msg)
+
 	case STORAGE_ROLLBACK_DONE:
 		idx.handleStorageRollbackDone(msg)
 
@@ -1282,6 +1301,7 @@ func (idx *indexer) handleConfigUpdate(msg Message) {
 	}
 
 	memdb.Debug(idx.config["settings.moi.debug"].Bool())
+	materializedAggrs.setMaxMemory(int64(newConfig["settings.materialized_aggr.max_memory"].Int()))
 	idx.setProfilerOptions(newConfig)
 	idx.config = newConfig
 	idx.compactMgrCmdCh <- msg
@@ -1326,6 +1346,14 @@ func (idx *indexer) handleAdminMsgs(msg Message) (resp Message) {
 	case CLUST_MGR_PRUNE_PARTITION:
 		resp = idx.handlePrunePartition(msg)
 
+	case CLUST_MGR_PAUSE_INDEX:
+		idx.handlePauseIndex(msg)
+		resp = &MsgSuccess{}
+
+	case CLUST_MGR_UPDATE_AGGREGATES:
+		idx.handleUpdateAggregates(msg)
+		resp = &MsgSuccess{}
+
 	case MSG_ERROR:
 
 		logging.Fatalf("Indexer::handleAdminMsgs Fatal Error On Admin Channel %+v", msg)
@@ -2126,6 +2154,616 @@ func (idx *indexer) cleanupIndexAfterMerge(inst common.IndexInst, merged map[com
 //
 // Prune Partition.
 //
+//
+// Pause or resume maintenance of an index instance.
+//
+// A paused index is removed from MAINT_STREAM and moved to NIL_STREAM.  It
+// keeps its data and snapshots, so that it can still serve scans with
+// AnyConsistency.  The paused flag is persisted by the manager, and the
+// index stays in NIL_STREAM after indexer restart.
+//
+// When resumed, the index goes through the same path as an initial build,
+// except that the stream is started from the last snapshot of the index.
+// If the bucket is already in MAINT_STREAM, the index catches up in
+// INIT_STREAM and is merged back to MAINT_STREAM when done.
+//
+func (idx *indexer) handlePauseIndex(msg Message) {
+
+	instId := msg.(*MsgClustMgrPauseIndex).GetInstId()
+	pause := msg.(*MsgClustMgrPauseIndex).GetPause()
+	respCh := msg.(*MsgClustMgrPauseIndex).GetRespCh()
+
+	logging.Infof("Indexer::handlePauseIndex InstId %v Pause %v", instId, pause)
+
+	if is := idx.getIndexerState(); is != common.INDEXER_ACTIVE {
+		errStr := fmt.Sprintf("Indexer Cannot Process Pause Index In %v State", is)
+		idx.sendPauseIndexError(respCh, ERROR_INDEXER_NOT_ACTIVE, errStr)
+		return
+	}
+
+	if idx.rebalanceRunning || idx.rebalanceToken != nil {
+		errStr := fmt.Sprintf("Indexer Cannot Process Pause Index - Rebalance In Progress")
+		idx.sendPauseIndexError(respCh, ERROR_INDEXER_REBALANCE_IN_PROGRESS, errStr)
+		return
+	}
+
+	inst, ok := idx.indexInstMap[instId]
+	if !ok || inst.State == common.INDEX_STATE_DELETED {
+		errStr := fmt.Sprintf("Unknown Index Instance %v", instId)
+		idx.sendPauseIndexError(respCh, ERROR_INDEXER_UNKNOWN_INDEX, errStr)
+		return
+	}
+
+	if inst.Paused == pause {
+		logging.Infof("Indexer::handlePauseIndex Index %v already has Paused %v. Skip.", instId, pause)
+		respCh <- &MsgSuccess{}
+		return
+	}
+
+	bucket := inst.Defn.Bucket
+
+	//only one build or catchup can run on a bucket at a time
+	for _, index := range idx.indexInstMap {
+		if (index.State == common.INDEX_STATE_INITIAL ||
+			index.State == common.INDEX_STATE_CATCHUP) &&
+			index.Defn.Bucket == bucket {
+			errStr := fmt.Sprintf("Build Already In Progress. Bucket %v. Please retry later.", bucket)
+			idx.sendPauseIndexError(respCh, ERROR_INDEX_BUILD_IN_PROGRESS, errStr)
+			return
+		}
+	}
+
+	initState := idx.getStreamBucketState(common.INIT_STREAM, bucket)
+	maintState := idx.getStreamBucketState(common.MAINT_STREAM, bucket)
+	if initState == STREAM_RECOVERY || initState == STREAM_PREPARE_RECOVERY ||
+		maintState == STREAM_RECOVERY || maintState == STREAM_PREPARE_RECOVERY {
+		idx.sendPauseIndexError(respCh, ERROR_INDEXER_IN_RECOVERY, ErrIndexerInRecovery.Error())
+		return
+	}
+
+	if pause {
+		idx.pauseIndex(inst, respCh)
+	} else {
+		idx.resumeIndex(inst, respCh)
+	}
+}
+
+func (idx *indexer) pauseIndex(inst common.IndexInst, respCh MsgChannel) {
+
+	if inst.State != common.INDEX_STATE_ACTIVE || inst.Stream != common.MAINT_STREAM {
+		errStr := fmt.Sprintf("Index %v in State %v Stream %v cannot be paused. "+
+			"Only an active index in MAINT_STREAM can be paused.", inst.InstId, inst.State, inst.Stream)
+		idx.sendPauseIndexError(respCh, ERROR_INDEXER_INTERNAL_ERROR, errStr)
+		return
+	}
+
+	indexList := []common.IndexInst{inst}
+
+	inst.Paused = true
+	inst.Stream = common.NIL_STREAM
+	idx.indexInstMap[inst.InstId] = inst
+
+	msgUpdateIndexInstMap := idx.newIndexInstMsg(idx.indexInstMap)
+	if err := idx.distributeIndexMapsToWorkers(msgUpdateIndexInstMap, nil); err != nil {
+		idx.sendPauseIndexError(respCh, ERROR_INDEXER_INTERNAL_ERROR, err.Error())
+		common.CrashOnError(err)
+	}
+
+	//if this is the last index of the bucket, the bucket is removed from the stream
+	idx.removeIndexesFromStream(indexList, inst.Defn.Bucket, inst.Defn.BucketUUID,
+		common.MAINT_STREAM, common.INDEX_STATE_ACTIVE, respCh)
+
+	logging.Infof("Indexer::pauseIndex Index %v removed from %v", inst.InstId, common.MAINT_STREAM)
+
+	respCh <- &MsgSuccess{}
+}
+
+func (idx *indexer) resumeIndex(inst common.IndexInst, respCh MsgChannel) {
+
+	bucket := inst.Defn.Bucket
+
+	cluster := idx.config["clusterAddr"].String()
+	numVbuckets := idx.config["numVbuckets"].Int()
+	buildTs, err := GetCurrentKVTs(cluster, "default", bucket, numVbuckets)
+	if err != nil {
+		errStr := fmt.Sprintf("Error Connecting KV %v Err %v", cluster, err)
+		idx.sendPauseIndexError(respCh, ERROR_INDEXER_INTERNAL_ERROR, errStr)
+		return
+	}
+
+	var snapInfos [][]SnapshotInfo
+	for _, partnInst := range idx.indexPartnMap[inst.InstId] {
+
+		//there is only one slice for now
+		slice := partnInst.Sc.GetSliceById(0)
+
+		infos, err := slice.GetSnapshots()
+		if err != nil {
+			idx.sendPauseIndexError(respCh, ERROR_INDEXER_INTERNAL_ERROR, err.Error())
+			return
+		}
+		snapInfos = append(snapInfos, infos)
+	}
+	restartTs := resumeRestartTs(snapInfos)
+
+	instIdList := []common.IndexInstId{inst.InstId}
+	if err := idx.buildIndexesFromTs(bucket, instIdList, buildTs, restartTs, respCh); err != nil {
+		idx.sendPauseIndexError(respCh, ERROR_INDEXER_INTERNAL_ERROR, err.Error())
+		common.CrashOnError(err)
+	}
+
+	respCh <- &MsgSuccess{}
+}
+
+//buildIndexesFromTs adds the indexes of a bucket, which are not in any
+//stream, to the stream in which a new index of the bucket is built.
+//The stream is requested from restartTs, which has to be the timestamp
+//of the data in all the indexes. A nil restartTs builds from 0.
+func (idx *indexer) buildIndexesFromTs(bucket string, instIdList []common.IndexInstId,
+	buildTs Timestamp, restartTs *common.TsVbuuid, respCh MsgChannel) error {
+
+	//if there is already an index for this bucket in MAINT_STREAM,
+	//catchup in INIT_STREAM
+	var buildStream common.StreamId
+	if idx.checkBucketExistsInStream(bucket, common.MAINT_STREAM, false) {
+		buildStream = common.INIT_STREAM
+	} else {
+		buildStream = common.MAINT_STREAM
+	}
+
+	for _, instId := range instIdList {
+		inst := idx.indexInstMap[instId]
+		inst.Paused = false
+		inst.Stream = buildStream
+		inst.State = common.INDEX_STATE_INITIAL
+		idx.indexInstMap[instId] = inst
+	}
+
+	logging.Infof("Indexer::buildIndexesFromTs Added Index: %v to Stream: %v State: %v RestartTs %v",
+		instIdList, buildStream, common.INDEX_STATE_INITIAL, restartTs)
+
+	msgUpdateIndexInstMap := idx.newIndexInstMsg(idx.indexInstMap)
+	if err := idx.distributeIndexMapsToWorkers(msgUpdateIndexInstMap, nil); err != nil {
+		return err
+	}
+
+	idx.sendStreamUpdateForBuildIndex(instIdList, buildStream, bucket, buildTs, restartTs, respCh)
+
+	idx.stateLock.Lock()
+	if _, ok := idx.streamBucketStatus[buildStream]; !ok {
+		idx.streamBucketStatus[buildStream] = make(BucketStatus)
+	}
+	idx.stateLock.Unlock()
+
+	idx.setStreamBucketState(buildStream, bucket, STREAM_ACTIVE)
+
+	//store updated state and streamId in meta store
+	if err := idx.updateMetaInfoForIndexList(instIdList, true,
+		true, false, false, true, false, false, false, nil); err != nil {
+		common.CrashOnError(err)
+	}
+
+	return nil
+}
+
+//handleUpdateAggregates updates the aggregates materialized with an index
+//instance. Aggregates are maintained by the flusher once the workers have
+//the updated instance map, refer materialized_aggr.go.
+func (idx *indexer) handleUpdateAggregates(msg Message) {
+
+	instId := msg.(*MsgClustMgrUpdateAggregates).GetInstId()
+	aggregates := msg.(*MsgClustMgrUpdateAggregates).GetAggregates()
+	respCh := msg.(*MsgClustMgrUpdateAggregates).GetRespCh()
+
+	logging.Infof("Indexer::handleUpdateAggregates InstId %v Aggregates %v", instId, aggregates)
+
+	inst, ok := idx.indexInstMap[instId]
+	if !ok || inst.State == common.INDEX_STATE_DELETED {
+		logging.Errorf("Indexer::handleUpdateAggregates Unknown Index Instance %v", instId)
+		respCh <- &MsgError{
+			err: Error{code: ERROR_INDEXER_UNKNOWN_INDEX,
+				severity: FATAL,
+				cause:    fmt.Errorf("Unknown Index Instance %v", instId),
+				category: INDEXER}}
+		return
+	}
+
+	inst.Defn.Aggregates = aggregates
+	idx.indexInstMap[instId] = inst
+
+	msgUpdateIndexInstMap := idx.newIndexInstMsg(idx.indexInstMap)
+	if err := idx.distributeIndexMapsToWorkers(msgUpdateIndexInstMap, nil); err != nil {
+		respCh <- &MsgError{
+			err: Error{code: ERROR_INDEXER_INTERNAL_ERROR,
+				severity: FATAL,
+				cause:    err,
+				category: INDEXER}}
+		common.CrashOnError(err)
+	}
+
+	respCh <- &MsgSuccess{}
+}
+
+//
+// Restart timestamp of a resumed index, given the snapshots of each of its
+// partitions.  For each vbucket, the index restarts from the oldest of the
+// latest snapshots of the partitions, mutations flushed after the snapshot
+// are applied again.  If any partition has no snapshot, restart from 0.
+//
+func resumeRestartTs(snapInfos [][]SnapshotInfo) *common.TsVbuuid {
+
+	var restartTs *common.TsVbuuid
+	for _, infos := range snapInfos {
+
+		latestSnapInfo := NewSnapshotInfoContainer(infos).GetLatest()
+		if latestSnapInfo == nil {
+			return nil
+		}
+
+		ts := latestSnapInfo.Timestamp()
+		if restartTs == nil {
+			restartTs = ts.Copy()
+			continue
+		}
+
+		for i, seqno := range ts.Seqnos {
+			if i < len(restartTs.Seqnos) && seqno < restartTs.Seqnos[i] {
+				restartTs.Seqnos[i] = seqno
+				restartTs.Vbuuids[i] = ts.Vbuuids[i]
+				restartTs.Snapshots[i] = ts.Snapshots[i]
+				restartTs.Crc64 = 0
+			}
+		}
+	}
+
+	return restartTs
+}
+
+func (idx *indexer) sendPauseIndexError(respCh MsgChannel, code errCode, errStr string) {
+
+	logging.Errorf("Indexer::handlePauseIndex %v", errStr)
+
+	respCh <- &MsgError{
+		err: Error{code: code,
+			severity: FATAL,
+			cause:    errors.New(errStr),
+			category: INDEXER}}
+}
+
+//handleRestoreIndexData restores the indexes of a bucket in a backup to
+//the local indexes created for the restore, which are yet to be built.
+//The indexes whose data is imported are built from the timestamp of
+//the backup, and an index whose data cannot be imported is left to be
+//built from 0. If no data can be imported, the indexes are built from
+//0.
+func (idx *indexer) handleRestoreIndexData(msg Message) {
+
+	req := msg.(*MsgIndexRestore)
+	bucket := req.GetBucket()
+	errch := req.GetErrorChannel()
+
+	logging.Infof("Indexer::handleRestoreIndexData Bucket %v ImportData %v", bucket, req.GetImportData())
+
+	if is := idx.getIndexerState(); is != common.INDEXER_ACTIVE {
+		errch <- fmt.Errorf("Indexer Cannot Process Restore Index Data In %v State", is)
+		return
+	}
+
+	if idx.rebalanceRunning || idx.rebalanceToken != nil {
+		errch <- errors.New("Indexer Cannot Process Restore Index Data - Rebalance In Progress")
+		return
+	}
+
+	//only one build or catchup can run on a bucket at a time
+	for _, index := range idx.indexInstMap {
+		if (index.State == common.INDEX_STATE_INITIAL ||
+			index.State == common.INDEX_STATE_CATCHUP) &&
+			index.Defn.Bucket == bucket {
+			errch <- fmt.Errorf("Build Already In Progress. Bucket %v. Please retry later.", bucket)
+			return
+		}
+	}
+
+	initState := idx.getStreamBucketState(common.INIT_STREAM, bucket)
+	maintState := idx.getStreamBucketState(common.MAINT_STREAM, bucket)
+	if initState == STREAM_RECOVERY || initState == STREAM_PREPARE_RECOVERY ||
+		maintState == STREAM_RECOVERY || maintState == STREAM_PREPARE_RECOVERY {
+		errch <- ErrIndexerInRecovery
+		return
+	}
+
+	cluster := idx.config["clusterAddr"].String()
+	numVbuckets := idx.config["numVbuckets"].Int()
+	buildTs, err := GetCurrentKVTs(cluster, "default", bucket, numVbuckets)
+	if err != nil {
+		errch <- fmt.Errorf("Error Connecting KV %v Err %v", cluster, err)
+		return
+	}
+
+	//group the partitions in the backup by index
+	backupPartns := make(map[common.IndexInstId]map[common.PartitionId]*indexBackupEntry)
+	for _, entry := range req.GetEntries() {
+		if _, ok := backupPartns[entry.InstId]; !ok {
+			backupPartns[entry.InstId] = make(map[common.PartitionId]*indexBackupEntry)
+		}
+		backupPartns[entry.InstId][entry.PartnId] = entry
+	}
+
+	importData := req.GetImportData()
+
+	var statuses []*indexRestoreStatus
+	var instIdList, importList []common.IndexInstId
+	restorePartns := make(map[common.IndexInstId]map[common.PartitionId]*indexBackupEntry)
+	failed := make(map[common.IndexInstId]error)
+
+	for _, partns := range backupPartns {
+
+		var defn common.IndexDefn
+		for _, entry := range partns {
+			defn = entry.Defn
+			break
+		}
+
+		status := &indexRestoreStatus{
+			Bucket:     bucket,
+			Scope:      defn.GetScope(),
+			Collection: defn.GetCollection(),
+			Name:       defn.Name,
+		}
+		statuses = append(statuses, status)
+
+		inst, ok := idx.findRestoreTarget(bucket, &defn)
+		if !ok {
+			status.Status = RESTORE_STATUS_SKIPPED
+			status.Reason = "No index to restore to. Index has to be created deferred and not built."
+			continue
+		}
+
+		if _, ok := restorePartns[inst.InstId]; ok {
+			status.Status = RESTORE_STATUS_SKIPPED
+			status.Reason = "Index already restored from another replica in backup."
+			continue
+		}
+
+		status.InstId = inst.InstId
+		instIdList = append(instIdList, inst.InstId)
+		restorePartns[inst.InstId] = partns
+
+		if !importData {
+			continue
+		}
+
+		if err := checkRestoreData(inst, partns); err != nil {
+			logging.Infof("Indexer::handleRestoreIndexData Index %v cannot be imported. %v", inst.InstId, err)
+			failed[inst.InstId] = err
+			continue
+		}
+		importList = append(importList, inst.InstId)
+	}
+
+	if len(instIdList) == 0 {
+		req.GetReplyChannel() <- statuses
+		return
+	}
+
+	var restartTs *common.TsVbuuid
+	imported := make(map[common.IndexInstId]bool)
+	if len(importList) != 0 {
+		var errs map[common.IndexInstId]error
+		restartTs, errs = idx.importIndexData(importList, restorePartns, req.GetDir())
+		for _, instId := range importList {
+			if err, ok := errs[instId]; ok {
+				logging.Errorf("Indexer::handleRestoreIndexData Error importing data of Index %v. "+
+					"Index is to be built from 0. Error %v", instId, err)
+				failed[instId] = err
+			} else {
+				imported[instId] = true
+			}
+		}
+	}
+
+	buildList, fromBackup := restoreBuildList(statuses, imported, failed)
+	if !fromBackup {
+		restartTs = nil
+	}
+
+	if err := idx.buildIndexesFromTs(bucket, buildList, buildTs, restartTs, nil); err != nil {
+		common.CrashOnError(err)
+	}
+
+	req.GetReplyChannel() <- statuses
+}
+
+//findRestoreTarget returns the local index to restore an index in a
+//backup to. The index has been created deferred for the restore, and
+//is yet to be built.
+func (idx *indexer) findRestoreTarget(bucket string, defn *common.IndexDefn) (common.IndexInst, bool) {
+
+	for _, inst := range idx.indexInstMap {
+		if inst.Defn.Bucket != bucket || inst.Defn.Name != defn.Name ||
+			inst.Defn.GetScope() != defn.GetScope() ||
+			inst.Defn.GetCollection() != defn.GetCollection() {
+			continue
+		}
+
+		if (inst.State == common.INDEX_STATE_CREATED || inst.State == common.INDEX_STATE_READY) &&
+			inst.Stream == common.NIL_STREAM && !inst.Paused &&
+			inst.RState == common.REBAL_ACTIVE && !inst.IsProxy() {
+			return inst, true
+		}
+	}
+
+	return common.IndexInst{}, false
+}
+
+//restoreBuildList sets the restore status of the indexes to restore to,
+//and returns the indexes to build now, and whether they are built from
+//the timestamp of the backup. If the data of any index is imported,
+//the imported indexes are built, and the rest are left deferred, to be
+//built from 0 once the build is done. Otherwise, all the indexes are
+//built from 0.
+func restoreBuildList(statuses []*indexRestoreStatus, imported map[common.IndexInstId]bool,
+	failed map[common.IndexInstId]error) ([]common.IndexInstId, bool) {
+
+	var instIdList []common.IndexInstId
+	fromBackup := len(imported) != 0
+
+	for _, status := range statuses {
+		if status.InstId == 0 {
+			continue
+		}
+
+		if err, ok := failed[status.InstId]; ok {
+			status.Reason = err.Error()
+		}
+
+		switch {
+		case !fromBackup:
+			status.Status = RESTORE_STATUS_BUILD
+		case imported[status.InstId]:
+			status.Status = RESTORE_STATUS_RESTORED
+		default:
+			status.Status = RESTORE_STATUS_DEFERRED
+			continue
+		}
+		instIdList = append(instIdList, status.InstId)
+	}
+
+	return instIdList, fromBackup
+}
+
+//importIndexData replaces the slices of the indexes with the slices in
+//a backup, and returns the oldest timestamp of the imported data. If a
+//slice of an index cannot be imported, the slices of the index are
+//reset, so that the index can be built from 0, and the error of the
+//index is returned.
+func (idx *indexer) importIndexData(instIdList []common.IndexInstId,
+	backupPartns map[common.IndexInstId]map[common.PartitionId]*indexBackupEntry,
+	dir string) (*common.TsVbuuid, map[common.IndexInstId]error) {
+
+	var restartTs *common.TsVbuuid
+	errs := make(map[common.IndexInstId]error)
+
+	for _, instId := range instIdList {
+		inst := idx.indexInstMap[instId]
+
+		var instTs *common.TsVbuuid
+		var imported []common.PartitionId
+		var err error
+
+		for partnId := range idx.indexPartnMap[instId] {
+
+			entry := backupPartns[instId][partnId]
+			imported = append(imported, partnId)
+
+			var slice Slice
+			if slice, err = idx.replacePartitionSlice(inst, partnId, filepath.Join(dir, entry.Dir)); err != nil {
+				break
+			}
+
+			if err = rollbackToBackupSnapshot(slice, entry.Timestamp); err != nil {
+				break
+			}
+
+			logging.Infof("Indexer::importIndexData Imported Index %v PartitionId %v from %v",
+				instId, partnId, entry.Dir)
+
+			if instTs == nil || !entry.Timestamp.AsRecentTs(instTs) {
+				instTs = entry.Timestamp
+			}
+		}
+
+		if err != nil {
+			errs[instId] = err
+			for _, partnId := range imported {
+				if _, err1 := idx.replacePartitionSlice(inst, partnId, ""); err1 != nil {
+					common.CrashOnError(err1)
+				}
+			}
+			continue
+		}
+
+		if instTs != nil && (restartTs == nil || !instTs.AsRecentTs(restartTs)) {
+			restartTs = instTs
+		}
+	}
+
+	msgUpdateIndexInstMap := idx.newIndexInstMsg(idx.indexInstMap)
+	msgUpdateIndexPartnMap := &MsgUpdatePartnMap{indexPartnMap: idx.indexPartnMap}
+	if err := idx.distributeIndexMapsToWorkers(msgUpdateIndexInstMap, msgUpdateIndexPartnMap); err != nil {
+		common.CrashOnError(err)
+	}
+
+	if restartTs == nil {
+		return nil, errs
+	}
+
+	//open the snapshots of the imported data
+	for _, instId := range instIdList {
+		if _, ok := errs[instId]; ok {
+			continue
+		}
+		idx.storageMgrCmdCh <- &MsgUpdateSnapMap{
+			idxInstId: instId,
+			idxInst:   idx.indexInstMap[instId],
+			partnMap:  idx.indexPartnMap[instId],
+			streamId:  common.ALL_STREAMS,
+			bucket:    "",
+		}
+		<-idx.storageMgrCmdCh
+	}
+
+	return restartTs.Copy(), errs
+}
+
+//replacePartitionSlice replaces the slice of an index partition with a
+//slice opened on the slice files copied from dir. If dir is empty, or
+//the slice cannot be opened, the partition has an empty slice.
+func (idx *indexer) replacePartitionSlice(inst common.IndexInst, partnId common.PartitionId,
+	dir string) (Slice, error) {
+
+	partnInst := idx.indexPartnMap[inst.InstId][partnId]
+
+	//there is only one slice for now
+	slice := partnInst.Sc.GetSliceById(0)
+	path := slice.Path()
+
+	//the index has not been built, so the slice is not in use
+	slice.Close()
+	slice.Destroy()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		common.CrashOnError(fmt.Errorf("Slice %v of Index %v not removed", path, inst.InstId))
+	}
+
+	var err error
+	if dir != "" {
+		err = common.CopyDir(path, dir)
+	}
+
+	var newSlice Slice
+	if err == nil {
+		newSlice, err = NewSlice(SliceId(0), &inst, &partnInst, idx.config, idx.stats)
+	}
+
+	if err != nil {
+		logging.Errorf("Indexer::replacePartitionSlice Error opening slice of Index %v "+
+			"PartitionId %v from %v. Error %v", inst.InstId, partnId, dir, err)
+
+		os.RemoveAll(path)
+
+		var err1 error
+		if newSlice, err1 = NewSlice(SliceId(0), &inst, &partnInst, idx.config, idx.stats); err1 != nil {
+			common.CrashOnError(err1)
+		}
+	}
+
+	partnInst.Sc = NewHashedSliceContainer()
+	partnInst.Sc.AddSlice(0, newSlice)
+	idx.indexPartnMap[inst.InstId][partnId] = partnInst
+
+	return newSlice, err
+}
+
 func (idx *indexer) handlePrunePartition(msg Message) (resp Message) {
 
 	instId := msg.(*MsgClustMgrPrunePartition).GetInstId()
@@ -2647,7 +3285,7 @@ func (idx *indexer) handleBuildIndex(msg Message) {
 		}
 
 		//send Stream Update to workers
-		idx.sendStreamUpdateForBuildIndex(instIdList, buildStream, bucket, buildTs, clientCh)
+		idx.sendStreamUpdateForBuildIndex(instIdList, buildStream, bucket, buildTs, nil, clientCh)
 
 		idx.stateLock.Lock()
 		if _, ok := idx.streamBucketStatus[buildStream]; !ok {
@@ -2751,11 +3389,12 @@ func (idx *indexer) handleDropIndex(msg Message) (resp Message) {
 
 	idx.stats.RemoveIndex(indexInst.InstId)
 
-	//if the index state is Created/Ready/Deleted, only data cleanup is
-	//required. No stream updates are required.
+	//if the index state is Created/Ready/Deleted or the index is paused,
+	//only data cleanup is required. No stream updates are required.
 	if indexInst.State == common.INDEX_STATE_CREATED ||
 		indexInst.State == common.INDEX_STATE_READY ||
-		indexInst.State == common.INDEX_STATE_DELETED {
+		indexInst.State == common.INDEX_STATE_DELETED ||
+		indexInst.Paused {
 
 		idx.cleanupIndexData(indexInst, clientCh)
 		logging.Infof("Indexer::handleDropIndex Cleanup Successful for "+
@@ -3418,6 +4057,7 @@ func (idx *indexer) cleanupIndexData(indexInst common.IndexInst,
 	delete(idx.indexInstMap, indexInstId)
 	delete(idx.indexPartnMap, indexInstId)
 	deleteFreeWriters(indexInst.InstId)
+	materializedAggrs.drop(indexInstId)
 
 	msgUpdateIndexInstMap := idx.newIndexInstMsg(idx.indexInstMap)
 	msgUpdateIndexPartnMap := &MsgUpdatePartnMap{indexPartnMap: idx.indexPartnMap}
@@ -3621,8 +4261,14 @@ func (idx *indexer) Shutdown() Message {
 	return nil
 }
 
+//
+// Open the stream for initial build of the indexes.  If restartTs is not nil,
+// the indexes already have data upto restartTs (e.g. a paused index being
+// resumed) and the stream is started from restartTs.
+//
 func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstId,
-	buildStream common.StreamId, bucket string, buildTs Timestamp, clientCh MsgChannel) bool {
+	buildStream common.StreamId, bucket string, buildTs Timestamp,
+	restartTs *common.TsVbuuid, clientCh MsgChannel) bool {
 
 	var cmd Message
 	var indexList []common.IndexInst
@@ -3650,8 +4296,8 @@ func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstI
 		indexList:          indexList,
 		buildTs:            buildTs,
 		respCh:             respCh,
-		restartTs:          nil,
-		allowMarkFirstSnap: true,
+		restartTs:          restartTs,
+		allowMarkFirstSnap: restartTs == nil,
 		rollbackTime:       idx.bucketRollbackTimes[bucket],
 		async:              async,
 		sessionId:          sessionId}
@@ -3733,9 +4379,23 @@ func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstI
 
 				case INDEXER_ROLLBACK:
 					//an initial build request should never receive rollback message
-					logging.Errorf("Indexer::sendStreamUpdateForBuildIndex Unexpected Rollback from "+
-						"Projector during Initial Stream Request %v", resp)
-					common.CrashOnError(ErrKVRollbackForInitRequest)
+					if restartTs == nil {
+						logging.Errorf("Indexer::sendStreamUpdateForBuildIndex Unexpected Rollback from "+
+							"Projector during Initial Stream Request %v", resp)
+						common.CrashOnError(ErrKVRollbackForInitRequest)
+					}
+
+					//stream started from an existing snapshot can be rolled back
+					logging.Infof("Indexer::sendStreamUpdateForBuildIndex Rollback from "+
+						"Projector For Stream %v Bucket %v SessionId %v", buildStream,
+						bucket, sessionId)
+					idx.internalRecvCh <- &MsgRecovery{mType: INDEXER_INIT_PREP_RECOVERY,
+						streamId:  buildStream,
+						bucket:    bucket,
+						restartTs: resp.(*MsgRollback).GetRollbackTs(),
+						requestCh: stopCh,
+						sessionId: sessionId}
+					break retryloop
 
 				default:
 					//log and retry for all other responses
@@ -5378,7 +6038,8 @@ func (idx *indexer) handleStorageWarmupDone(msg Message) {
 	logging.Infof("Indexer::NewIndexer Status %v", idx.getIndexerState())
 
 	// Initialize the public REST API server after indexer bootstrap is completed
-	NewRestServer(idx.config["clusterAddr"].String(), idx.statsMgr)
+	NewRestServer(idx.config["clusterAddr"].String(), idx.statsMgr, idx.config)
+	NewBackupManager(idx.wrkrRecvCh, idx.config)
 
 	go idx.monitorMemUsage()
 	go idx.logMemstats()
@@ -6075,6 +6736,7 @@ func (idx *indexer) upgradeSingleIndex(inst *common.IndexInst, storageMode commo
 
 	partnDefnList := inst.Pc.GetAllPartitions()
 	for _, partnDefn := range partnDefnList {
+		RecoverRenamedIndexPath(storage_dir, inst, partnDefn.GetPartitionId(), SliceId(0))
 		path := filepath.Join(storage_dir, IndexPath(inst, partnDefn.GetPartitionId(), SliceId(0)))
 		if err := os.RemoveAll(path); err != nil {
 			common.CrashOnError(err)
@@ -6100,7 +6762,8 @@ func (idx *indexer) validateIndexInstMap() {
 		//failed while processing the request, cleanup the index.
 		//for deferred index in CREATED state, update the state of the index
 		//to READY in manager, so that build index request can be processed.
-		if index.Stream == common.NIL_STREAM {
+		//a paused index is not in any stream till it is resumed.
+		if index.Stream == common.NIL_STREAM && !index.Paused {
 			if index.Defn.Deferred || index.Scheduled {
 				if index.State == common.INDEX_STATE_CREATED {
 					logging.Warnf("Indexer::validateIndexInstMap State %v Stream %v Deferred %v Found. "+
@@ -6212,6 +6875,7 @@ func (idx *indexer) forceCleanupIndexData(inst *common.IndexInst, sliceId SliceI
 func (idx *indexer) forceCleanupPartitionData(inst *common.IndexInst, partitionId common.PartitionId, sliceId SliceId) error {
 
 	storage_dir := idx.config["storage_dir"].String()
+	RecoverRenamedIndexPath(storage_dir, inst, partitionId, sliceId)
 	path := filepath.Join(storage_dir, IndexPath(inst, partitionId, sliceId))
 	return os.RemoveAll(path)
 }
@@ -6479,6 +7143,14 @@ func (idx *indexer) updateMetaInfoForDeleteBucket(bucket string, streamId common
 	return idx.sendMsgToClusterMgr(msg)
 }
 
+func (idx *indexer) updateMetaInfoForDeleteCollection(bucket string,
+	collectionId string, streamId common.StreamId) error {
+
+	msg := &MsgClustMgrUpdate{mType: CLUST_MGR_DEL_COLLECTION, bucket: bucket,
+		collectionId: collectionId, streamId: streamId}
+	return idx.sendMsgToClusterMgr(msg)
+}
+
 func (idx *indexer) cleanupIndexMetadata(indexInst common.IndexInst) error {
 
 	temp := indexInst
@@ -6855,6 +7527,7 @@ func NewSlice(id SliceId, indInst *common.IndexInst, partnInst *PartitionInst,
 	if _, e := os.Stat(storage_dir); e != nil {
 		common.CrashOnError(e)
 	}
+	RecoverRenamedIndexPath(storage_dir, indInst, partnInst.Defn.GetPartitionId(), id)
 	path := filepath.Join(storage_dir, IndexPath(indInst, partnInst.Defn.GetPartitionId(), id))
 
 	ephemeral, err := IsEphemeral(conf["clusterAddr"].String(), indInst.Defn.Bucket)
@@ -6967,6 +7640,53 @@ func (idx *indexer) deleteIndexInstOnDeletedBucket(bucket string, streamId commo
 	return instIdList
 }
 
+//handleSystemEvent drops the indexes defined on a dropped collection.
+//Every vbucket of the bucket sends the system event, the metadata is
+//updated only once per collection.
+func (idx *indexer) handleSystemEvent(msg Message) {
+
+	ev := msg.(*MsgStreamSystemEvent)
+	if mcd.SystemEventType(ev.GetEventType()) != mcd.COLLECTION_DROP {
+		return
+	}
+
+	bucket := ev.GetMutationMeta().bucket
+	collectionId := fmt.Sprintf("%x", ev.GetCollectionId())
+	key := bucket + ":" + collectionId
+
+	found := false
+	for _, index := range idx.indexInstMap {
+		if index.Defn.Bucket == bucket &&
+			index.Defn.GetCollectionId() == collectionId {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		delete(idx.collectionDropInProgress, key)
+		return
+	}
+
+	if idx.collectionDropInProgress[key] {
+		return
+	}
+
+	logging.Infof("Indexer::handleSystemEvent Collection %v dropped in bucket %v "+
+		"StreamId %v. Dropping dependent indexes.", collectionId, bucket,
+		ev.GetStreamId())
+
+	if idx.enableManager {
+		idx.collectionDropInProgress[key] = true
+		if err := idx.updateMetaInfoForDeleteCollection(bucket, collectionId,
+			common.NIL_STREAM); err != nil {
+			delete(idx.collectionDropInProgress, key)
+			logging.Errorf("Indexer::handleSystemEvent Error dropping indexes "+
+				"for collection %v in bucket %v. Err %v", collectionId, bucket, err)
+		}
+	}
+}
+
 // start cpu profiling.
 func startCPUProfile(filename string) *os.File {
 	if filename == "" {
@@ -0,0 +1,68 @@
+package indexer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+type testSnapshotInfo struct {
+	ts *common.TsVbuuid
+}
+
+func (info *testSnapshotInfo) Timestamp() *common.TsVbuuid {
+	return info.ts
+}
+
+func (info *testSnapshotInfo) IsCommitted() bool {
+	return true
+}
+
+func (info *testSnapshotInfo) Stats() map[string]interface{} {
+	return nil
+}
+
+func newTestSnapshotInfo(seqnos, vbuuids []uint64) SnapshotInfo {
+	ts := common.NewTsVbuuid("default", len(seqnos))
+	copy(ts.Seqnos, seqnos)
+	copy(ts.Vbuuids, vbuuids)
+	for i, seqno := range seqnos {
+		ts.Snapshots[i] = [2]uint64{seqno, seqno}
+	}
+	return &testSnapshotInfo{ts: ts}
+}
+
+func TestResumeRestartTs(t *testing.T) {
+	partn1 := newTestSnapshotInfo([]uint64{10, 5, 7}, []uint64{1, 1, 1})
+	partn2 := newTestSnapshotInfo([]uint64{8, 9, 7}, []uint64{2, 2, 2})
+	older := newTestSnapshotInfo([]uint64{1, 1, 1}, []uint64{1, 1, 1})
+
+	// latest snapshot of each partition is first.
+	ts := resumeRestartTs([][]SnapshotInfo{{partn1, older}, {partn2}})
+	if ts == nil {
+		t.Fatal("expected restart timestamp")
+	}
+	if !reflect.DeepEqual(ts.Seqnos, []uint64{8, 5, 7}) {
+		t.Errorf("expected oldest seqno of each vbucket, got %v", ts.Seqnos)
+	}
+	if !reflect.DeepEqual(ts.Vbuuids, []uint64{2, 1, 1}) {
+		t.Errorf("expected vbuuid of the oldest seqno, got %v", ts.Vbuuids)
+	}
+	if ts.Snapshots[0] != [2]uint64{8, 8} || ts.Snapshots[1] != [2]uint64{5, 5} {
+		t.Errorf("expected snapshot of the oldest seqno, got %v", ts.Snapshots)
+	}
+
+	// snapshot of a partition is not changed.
+	if partn1.Timestamp().Seqnos[0] != 10 {
+		t.Errorf("expected snapshot timestamp unchanged, got %v", partn1.Timestamp().Seqnos)
+	}
+
+	// restart from 0 if any partition has no snapshot.
+	if ts := resumeRestartTs([][]SnapshotInfo{{partn1}, nil}); ts != nil {
+		t.Errorf("expected nil restart timestamp, got %v", ts)
+	}
+	if ts := resumeRestartTs(nil); ts != nil {
+		t.Errorf("expected nil restart timestamp without partitions, got %v", ts)
+	}
+}
@@ -1368,7 +1368,10 @@ func convertIndexDefnToProtobuf(indexDefn c.IndexDefn) *protobuf.IndexDefn {
 		protobuf.ExprType_value[strings.ToUpper(string(indexDefn.ExprType))]).Enum()
 	partnScheme := protobuf.PartitionScheme(
 		protobuf.PartitionScheme_value[string(c.SINGLE)]).Enum()
-	if c.IsPartitioned(indexDefn.PartitionScheme) {
+	if indexDefn.PartitionScheme == c.RANGE {
+		partnScheme = protobuf.PartitionScheme(
+			protobuf.PartitionScheme_value[string(c.RANGE)]).Enum()
+	} else if c.IsPartitioned(indexDefn.PartitionScheme) {
 		partnScheme = protobuf.PartitionScheme(
 			protobuf.PartitionScheme_value[string(c.KEY)]).Enum()
 	}
@@ -1381,11 +1384,16 @@ func convertIndexDefnToProtobuf(indexDefn c.IndexDefn) *protobuf.IndexDefn {
 		Using:              using,
 		ExprType:           exprType,
 		SecExpressions:     indexDefn.SecExprs,
+		Collations:         indexDefn.Collations,
 		PartitionScheme:    partnScheme,
 		PartnExpressions:   indexDefn.PartitionKeys,
 		HashScheme:         protobuf.HashScheme(indexDefn.HashScheme).Enum(),
 		WhereExpression:    proto.String(indexDefn.WhereExpr),
 		RetainDeletedXATTR: proto.Bool(indexDefn.RetainDeletedXATTR),
+		Scope:              proto.String(indexDefn.GetScope()),
+		ScopeID:            proto.String(indexDefn.GetScopeId()),
+		Collection:         proto.String(indexDefn.GetCollection()),
+		CollectionID:       proto.String(indexDefn.GetCollectionId()),
 	}
 
 	return defn
@@ -1454,6 +1462,19 @@ func addPartnInfoToProtoInst(cfg c.Config, cinfo *c.ClusterInfoCache,
 			protoInst.SinglePartn = &protobuf.SinglePartition{
 				Endpoints: endpoints,
 			}
+		} else if indexInst.Defn.PartitionScheme == c.RANGE {
+			partIds := make([]uint64, len(partnDefn))
+			for i, p := range partnDefn {
+				partIds[i] = uint64(p.GetPartitionId())
+			}
+
+			if protoInst.RangePartn == nil {
+				boundaries, err := c.CollateRangeBoundaries(indexInst.Defn.RangeBoundaries)
+				c.CrashOnError(err)
+				protoInst.RangePartn = protobuf.NewRangePartition(uint64(indexInst.Pc.GetNumPartitions()), endpoints, partIds, boundaries)
+			} else {
+				protoInst.RangePartn.AddPartitions(partIds)
+			}
 		} else {
 			partIds := make([]uint64, len(partnDefn))
 			for i, p := range partnDefn {
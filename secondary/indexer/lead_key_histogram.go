@@ -0,0 +1,360 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/common/json"
+	"github.com/couchbase/indexing/secondary/logging"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+)
+
+//--------------------------
+// leading key histogram
+//--------------------------
+
+// leadKeyHistogram is the histogram of the leading index key of a
+// partition, sampled from a slice snapshot, for the cost based
+// optimizer. It is refreshed once the partition has indexed more
+// mutations than `refreshRatio` of the items sampled, and persisted
+// with the index stats so that it survives an indexer restart.
+type leadKeyHistogram struct {
+	Stats     *protobuf.IndexStatistics `json:"stats"`
+	Items     uint64                    `json:"items"`     // items in snapshot
+	Mutations int64                     `json:"mutations"` // numDocsIndexed at sampling
+	Sampled   int64                     `json:"sampled"`   // unix time in nanoseconds
+}
+
+// refreshDue returns true if the histogram is to be sampled again
+// after `mutations` documents are indexed by the partition.
+func (h *leadKeyHistogram) refreshDue(mutations int64, ratio float64) bool {
+	if h == nil {
+		return true
+	}
+	delta := mutations - h.Mutations
+	if delta < 0 {
+		// counter restarted with the indexer.
+		delta = mutations
+	}
+	return float64(delta) > ratio*float64(h.Items)
+}
+
+type histogramKey struct {
+	instId  common.IndexInstId
+	partnId common.PartitionId
+}
+
+// histogramStore holds the leading key histogram of all partitions
+// hosted by the indexer.
+type histogramStore struct {
+	mu       sync.Mutex
+	hists    map[histogramKey]*leadKeyHistogram
+	sampling map[histogramKey]bool
+}
+
+var leadKeyHistograms = newHistogramStore()
+
+func newHistogramStore() *histogramStore {
+	return &histogramStore{
+		hists:    make(map[histogramKey]*leadKeyHistogram),
+		sampling: make(map[histogramKey]bool),
+	}
+}
+
+func (hs *histogramStore) get(instId common.IndexInstId,
+	partnId common.PartitionId) *leadKeyHistogram {
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	return hs.hists[histogramKey{instId, partnId}]
+}
+
+func (hs *histogramStore) put(instId common.IndexInstId,
+	partnId common.PartitionId, h *leadKeyHistogram) {
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.hists[histogramKey{instId, partnId}] = h
+}
+
+// prune histograms of index instances no longer in `indexInstMap`.
+func (hs *histogramStore) prune(indexInstMap common.IndexInstMap) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	for key := range hs.hists {
+		if _, ok := indexInstMap[key.instId]; !ok {
+			delete(hs.hists, key)
+		}
+	}
+}
+
+// marshal the histogram of a partition for the stats persister.
+func (hs *histogramStore) marshal(instId common.IndexInstId,
+	partnId common.PartitionId) (string, bool) {
+
+	h := hs.get(instId, partnId)
+	if h == nil {
+		return "", false
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		logging.Warnf("LeadKeyHistogram: Index %v Partition %v error marshalling "+
+			"histogram: %v", instId, partnId, err)
+		return "", false
+	}
+	return string(data), true
+}
+
+// restore the histogram of a partition read back by the stats persister.
+// numDocsIndexed restarts from zero with the indexer, mutations are
+// counted afresh.
+func (hs *histogramStore) restore(instId common.IndexInstId,
+	partnId common.PartitionId, data string) error {
+
+	h := &leadKeyHistogram{}
+	if err := json.Unmarshal([]byte(data), h); err != nil {
+		return err
+	}
+	h.Mutations = 0
+	hs.put(instId, partnId, h)
+	return nil
+}
+
+// onSnapshot is called by storage manager for every new snapshot of a
+// partition. If the histogram of the partition is due for a refresh, it
+// is sampled from `snap` in the background.
+func (hs *histogramStore) onSnapshot(inst *common.IndexInst,
+	partnId common.PartitionId, slice Slice, snap Snapshot,
+	partnStats *IndexStats, config common.Config) {
+
+	if inst.State != common.INDEX_STATE_ACTIVE || partnStats == nil {
+		return
+	}
+
+	mutations := partnStats.numDocsIndexed.Value()
+	ratio := config["scan.statistics.histogram.refreshRatio"].Float64()
+	hs.sample(inst, partnId, slice, snap, mutations, config,
+		func(h *leadKeyHistogram) bool {
+			return h.refreshDue(mutations, ratio)
+		})
+}
+
+// sample the histogram of a partition from `snap` in the background,
+// unless the partition is being sampled or `due` returns false for its
+// current histogram.
+func (hs *histogramStore) sample(inst *common.IndexInst,
+	partnId common.PartitionId, slice Slice, snap Snapshot, mutations int64,
+	config common.Config, due func(h *leadKeyHistogram) bool) {
+
+	key := histogramKey{inst.InstId, partnId}
+
+	hs.mu.Lock()
+	if hs.sampling[key] || !due(hs.hists[key]) {
+		hs.mu.Unlock()
+		return
+	}
+	hs.sampling[key] = true
+	hs.mu.Unlock()
+
+	nbins := config["scan.statistics.numBins"].Int()
+	sampleSize := config["scan.statistics.histogram.sampleSize"].Int()
+	instId, defn := inst.InstId, inst.Defn
+
+	snap.Open()
+	go func() {
+		defer snap.Close()
+		defer func() {
+			hs.mu.Lock()
+			delete(hs.sampling, key)
+			hs.mu.Unlock()
+		}()
+
+		ctx := slice.GetReaderContext()
+		ctx.Init(make(chan bool))
+		defer ctx.Done()
+
+		h, err := sampleLeadKey(&defn, ctx, snap, nbins, sampleSize)
+		if err != nil {
+			// retried with the next snapshot.
+			logging.Errorf("LeadKeyHistogram: Index %v Partition %v error sampling "+
+				"histogram: %v", instId, partnId, err)
+			return
+		}
+		h.Mutations = mutations
+		hs.put(instId, partnId, h)
+		logging.Verbosef("LeadKeyHistogram: Index %v Partition %v sampled histogram, "+
+			"items:%v", instId, partnId, h.Items)
+	}()
+}
+
+// sampleLeadKey builds the histogram of the leading key of `defn` from
+// a snapshot. Snapshot is read in full, but at most `sampleSize`
+// entries, evenly spaced in index order, are fed to the collector, each
+// standing for the entries skipped after it. Hence keys count and bin
+// depths are estimates when the snapshot has more than `sampleSize`
+// items, and distinct counts are those of the sample. It is run in the
+// background only, never on the scan path.
+func sampleLeadKey(defn *common.IndexDefn, ctx IndexReaderContext, snap Snapshot,
+	nbins, sampleSize int) (*leadKeyHistogram, error) {
+
+	items, err := snap.StatCountTotal()
+	if err != nil {
+		return nil, err
+	}
+	stride := uint64(1)
+	if sampleSize > 0 && items > uint64(sampleSize) {
+		stride = (items + uint64(sampleSize) - 1) / uint64(sampleSize)
+	}
+
+	collector := newKeyCollector(nbins, defn.IsPrimary)
+	var project *statsCollector
+	if !defn.IsPrimary && len(defn.SecExprs) > 1 {
+		project = &statsCollector{}
+	}
+
+	hasDesc := defn.HasDescending()
+	var revbuf *[]byte
+	if hasDesc {
+		revbuf = secKeyBufPool.Get()
+		defer secKeyBufPool.Put(revbuf)
+	}
+
+	var n uint64
+	callb := func(entry []byte) error {
+		n++
+		if (n-1)%stride != 0 {
+			return nil
+		}
+
+		if defn.IsPrimary {
+			return collector.addKey(entry, stride)
+		}
+
+		if hasDesc {
+			*revbuf = append((*revbuf)[:0], entry...)
+			if _, err := jsonEncoder.ReverseCollate(*revbuf, defn.Desc); err != nil {
+				return err
+			}
+			entry = *revbuf
+		}
+
+		e := secondaryIndexEntry(entry)
+		key := entry[:e.lenKey()]
+		if project != nil {
+			if err := project.projectLeadKey(key); err != nil {
+				return err
+			}
+			key = project.lead
+		}
+		return collector.addKey(key, stride*uint64(e.Count()))
+	}
+
+	if err := snap.All(ctx, callb); err != nil {
+		return nil, err
+	}
+
+	stats, err := collector.statistics()
+	if err != nil {
+		return nil, err
+	}
+	return &leadKeyHistogram{
+		Stats:   stats,
+		Items:   items,
+		Sampled: time.Now().UnixNano(),
+	}, nil
+}
+
+//--------------------------
+// scan coordinator hooks
+//--------------------------
+
+// handleLeadKeyHistogramRequest merges the histograms of the requested
+// partitions. Partitions not sampled yet are sampled from the scan
+// snapshot in the background, the request fails with
+// ErrHistogramNotAvailable till they are.
+func (s *scanCoordinator) handleLeadKeyHistogramRequest(req *ScanRequest,
+	w ScanResponseWriter, is IndexSnapshot) {
+
+	var stats *protobuf.IndexStatistics
+	var err error
+	var snapshots []SliceSnapshot
+
+	cfg := s.config.Load()
+	nbins := cfg["scan.statistics.numBins"].Int()
+
+	if snapshots, err = GetSliceSnapshots(is, req.PartitionIds); err == nil {
+		results := make([]*protobuf.IndexStatistics, 0, len(snapshots))
+		for i, snap := range snapshots {
+			if i >= len(req.PartitionIds) {
+				break
+			}
+			partnId := req.PartitionIds[i]
+			h := leadKeyHistograms.get(req.IndexInstId, partnId)
+			if h == nil {
+				if slice := s.getSlice(req.IndexInstId, partnId, snap.SliceId()); slice != nil {
+					leadKeyHistograms.sample(&req.IndexInst, partnId, slice,
+						snap.Snapshot(), s.numDocsIndexed(req.IndexInstId, partnId), cfg,
+						func(h *leadKeyHistogram) bool {
+							return h == nil
+						})
+				}
+				err = common.ErrHistogramNotAvailable
+				continue
+			}
+			results = append(results, h.Stats)
+		}
+		if err == nil {
+			if len(results) == 0 {
+				stats, err = newKeyCollector(nbins, req.isPrimary).statistics()
+			} else {
+				stats, err = protobuf.MergeStatistics(nbins, results...)
+			}
+		}
+	}
+
+	if s.tryRespondWithError(w, req, err) {
+		return
+	}
+
+	logging.Verbosef("%s RESPONSE status:ok", req.LogPrefix)
+	err = w.Stats(stats)
+	s.handleError(req.LogPrefix, err)
+}
+
+// getSlice returns slice `sliceId` of partition `partnId` of an index
+// instance, nil if the partition is not hosted by the indexer.
+func (s *scanCoordinator) getSlice(instId common.IndexInstId,
+	partnId common.PartitionId, sliceId SliceId) Slice {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if partnInst, ok := s.indexPartnMap[instId][partnId]; ok {
+		return partnInst.Sc.GetSliceById(sliceId)
+	}
+	return nil
+}
+
+func (s *scanCoordinator) numDocsIndexed(instId common.IndexInstId,
+	partnId common.PartitionId) int64 {
+
+	if stats := s.stats.Get(); stats != nil {
+		if idxStats := stats.indexes[instId]; idxStats != nil {
+			if partnStats := idxStats.getPartitionStats(partnId); partnStats != nil {
+				return partnStats.numDocsIndexed.Value()
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,136 @@
+package indexer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestLeadKeyHistogramRefresh(t *testing.T) {
+	var h *leadKeyHistogram
+	if !h.refreshDue(0, 0.2) {
+		t.Errorf("expected refresh without histogram")
+	}
+
+	h = &leadKeyHistogram{Items: 100, Mutations: 1000}
+	testcases := []struct {
+		mutations int64
+		due       bool
+	}{
+		{1000, false},
+		{1020, false},
+		{1021, true},
+		{10, false}, // restarted
+		{21, true},
+	}
+	for _, tc := range testcases {
+		if due := h.refreshDue(tc.mutations, 0.2); due != tc.due {
+			t.Errorf("mutations %v refresh %v, expected %v", tc.mutations, due, tc.due)
+		}
+	}
+}
+
+func TestLeadKeyHistogramPersist(t *testing.T) {
+	c := newKeyCollector(2, false)
+	for _, key := range []string{`["a"]`, `["b"]`, `["c"]`, `["d"]`} {
+		if err := c.addKey(encodeStatsKey(t, key), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats, err := c.statistics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs := newHistogramStore()
+	instId, partnId := common.IndexInstId(1), common.PartitionId(2)
+	hs.put(instId, partnId, &leadKeyHistogram{Stats: stats, Items: 4, Mutations: 50})
+	data, ok := hs.marshal(instId, partnId)
+	if !ok {
+		t.Fatalf("expected histogram")
+	}
+
+	restored := newHistogramStore()
+	if err := restored.restore(instId, partnId, data); err != nil {
+		t.Fatal(err)
+	}
+	h := restored.get(instId, partnId)
+	if h == nil || h.Items != 4 || h.Mutations != 0 {
+		t.Fatalf("unexpected histogram %+v", h)
+	}
+	if len(h.Stats.GetBins()) != len(stats.GetBins()) || h.Stats.GetKeysCount() != 4 ||
+		string(h.Stats.GetKeyMax()) != `["d"]` {
+		t.Errorf("unexpected statistics %v", h.Stats)
+	}
+
+	restored.prune(common.IndexInstMap{})
+	if restored.get(instId, partnId) != nil {
+		t.Errorf("expected histogram to be pruned")
+	}
+}
+
+// histogramTestSnapshot serves primary keys, All waits on `release`.
+type histogramTestSnapshot struct {
+	statsTestSnapshot
+	release chan bool
+	closed  chan bool
+}
+
+func (s *histogramTestSnapshot) Open() error {
+	return nil
+}
+
+func (s *histogramTestSnapshot) Close() error {
+	s.closed <- true
+	return nil
+}
+
+func (s *histogramTestSnapshot) StatCountTotal() (uint64, error) {
+	return uint64(len(s.keys)), nil
+}
+
+func (s *histogramTestSnapshot) All(ctx IndexReaderContext, callb EntryCallback) error {
+	<-s.release
+	return s.statsTestSnapshot.All(ctx, callb)
+}
+
+func TestLeadKeyHistogramSample(t *testing.T) {
+	snap := &histogramTestSnapshot{release: make(chan bool), closed: make(chan bool, 1)}
+	for i := 0; i < 10; i++ {
+		snap.keys = append(snap.keys, []byte(fmt.Sprintf("doc%d", i)))
+	}
+
+	hs := newHistogramStore()
+	inst := &common.IndexInst{InstId: 1}
+	inst.Defn.IsPrimary = true
+	config := common.SystemConfig.SectionConfig("indexer.", true)
+	missing := func(h *leadKeyHistogram) bool {
+		return h == nil
+	}
+
+	// sampled in the background, once at a time.
+	hs.sample(inst, 0, &aggrTestSlice{}, snap, 50, config, missing)
+	hs.sample(inst, 0, &aggrTestSlice{}, snap, 50, config, missing)
+	if h := hs.get(inst.InstId, 0); h != nil {
+		t.Fatalf("expected histogram to be sampled in the background")
+	}
+	close(snap.release)
+	<-snap.closed
+
+	h := hs.get(inst.InstId, 0)
+	if h == nil || h.Items != 10 || h.Mutations != 50 || h.Stats.GetKeysCount() != 10 {
+		t.Fatalf("unexpected histogram %+v", h)
+	}
+
+	// not sampled when not due.
+	hs.sample(inst, 0, &aggrTestSlice{}, snap, 100, config, missing)
+	select {
+	case <-snap.closed:
+		t.Errorf("expected no sampling")
+	default:
+	}
+	if hs.get(inst.InstId, 0) != h {
+		t.Errorf("expected histogram to be unchanged")
+	}
+}
@@ -0,0 +1,997 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/couchbase/indexing/secondary/collatejson"
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/query/value"
+)
+
+// Materialized aggregates are group aggregates defined with an index
+// (IndexDefn.Aggregates) and maintained in memory, per partition, by
+// the slice as entries are applied to its main index. Every slice
+// snapshot carries an immutable copy of the aggregates, consistent with
+// the snapshot, that full scans with a matching group aggregate are
+// answered from without scanning the index.
+//
+// Aggregates are not persisted. After a restart or a rollback, or when
+// an aggregate is created, they are seeded from a full scan of a slice
+// snapshot in the background, entries applied in the meantime are
+// replayed on top of the scan. Scans are served from the index till
+// seeding completes.
+//
+// Memory held is of the groups, and of the distinct values of MIN/MAX
+// keys in every group, counted to recompute MIN/MAX when the value is
+// removed, so it can grow with the number of documents. Memory of all
+// partitions is bounded by indexer.settings.materialized_aggr.max_memory,
+// the partition whose aggregates exceed it stops materializing them and
+// its scans are served from the index, till the partition is rolled
+// back or aggregates of the index are altered.
+
+var materializedAggrs = newAggrRegistry()
+
+// maxAggrPending bounds the entries kept while a store is seeded, past
+// it seeding is restarted from a later snapshot.
+const maxAggrPending = 100000
+
+// approximate memory held by a group and by a distinct MIN/MAX value of
+// a group, besides their keys.
+const (
+	aggrGroupOverhead = 160
+	aggrValueOverhead = 64
+)
+
+var errAggrMemory = errors.New("materialized aggregates exceed max_memory")
+
+type aggrStoreKey struct {
+	instId  common.IndexInstId
+	partnId common.PartitionId
+}
+
+// aggrRegistry is the aggregate store of every index partition with
+// materialized aggregates.
+type aggrRegistry struct {
+	n         int64 // number of stores
+	memUsed   int64 // memory of aggregates of all stores
+	maxMemory int64 // bound on memUsed, 0 if unbounded
+
+	mu     sync.RWMutex
+	stores map[aggrStoreKey]*aggrStore
+}
+
+func newAggrRegistry() *aggrRegistry {
+	return &aggrRegistry{stores: make(map[aggrStoreKey]*aggrStore)}
+}
+
+// get returns the store of partition `partnId` of `inst`, nil if the
+// index has no aggregates. The store is replaced when the aggregates of
+// the index have changed.
+func (r *aggrRegistry) get(inst *common.IndexInst,
+	partnId common.PartitionId) *aggrStore {
+
+	aggrs := inst.Defn.Aggregates
+	if len(aggrs) == 0 && atomic.LoadInt64(&r.n) == 0 {
+		return nil
+	}
+
+	key := aggrStoreKey{inst.InstId, partnId}
+	r.mu.RLock()
+	st := r.stores[key]
+	r.mu.RUnlock()
+	if st != nil && sameAggregates(st.defns, aggrs) {
+		return st
+	} else if st == nil && len(aggrs) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if st = r.stores[key]; st != nil && sameAggregates(st.defns, aggrs) {
+		return st
+	}
+	if st != nil {
+		st.close()
+	}
+	if len(aggrs) == 0 {
+		delete(r.stores, key)
+		atomic.StoreInt64(&r.n, int64(len(r.stores)))
+		return nil
+	}
+	st = newAggrStore(r, key, aggrs)
+	r.stores[key] = st
+	atomic.StoreInt64(&r.n, int64(len(r.stores)))
+	logging.Infof("MaterializedAggr: Index %v PartitionId %v aggregates %v",
+		inst.InstId, partnId, aggrs)
+	return st
+}
+
+// drop the stores of all partitions of `instId`, they are seeded again
+// if the index is still around.
+func (r *aggrRegistry) drop(instId common.IndexInstId) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, st := range r.stores {
+		if key.instId == instId {
+			st.close()
+			delete(r.stores, key)
+		}
+	}
+	atomic.StoreInt64(&r.n, int64(len(r.stores)))
+}
+
+// reset the store of a partition whose slice was rolled back.
+func (r *aggrRegistry) reset(instId common.IndexInstId, partnId common.PartitionId) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := aggrStoreKey{instId, partnId}
+	if st := r.stores[key]; st != nil {
+		st.close()
+		delete(r.stores, key)
+	}
+	atomic.StoreInt64(&r.n, int64(len(r.stores)))
+}
+
+// setMaxMemory bounds the memory of aggregates of all partitions, 0
+// leaves it unbounded.
+func (r *aggrRegistry) setMaxMemory(maxMemory int64) {
+	atomic.StoreInt64(&r.maxMemory, maxMemory)
+}
+
+// memoryUsed returns the memory of aggregates of a partition.
+func (r *aggrRegistry) memoryUsed(instId common.IndexInstId,
+	partnId common.PartitionId) int64 {
+
+	r.mu.RLock()
+	st := r.stores[aggrStoreKey{instId, partnId}]
+	r.mu.RUnlock()
+	if st == nil {
+		return 0
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.size
+}
+
+// update the aggregates of a partition for main index entry `old`
+// replaced by `new`, either is nil when an entry is only inserted or
+// deleted. Called by the slice writers, hence keys skipped by the slice
+// are not aggregated. Stores are created on snapshot, entries applied
+// before are seeded from the snapshot.
+func (r *aggrRegistry) update(instId common.IndexInstId, partnId common.PartitionId,
+	old, new []byte) {
+
+	if atomic.LoadInt64(&r.n) == 0 {
+		return
+	}
+
+	r.mu.RLock()
+	st := r.stores[aggrStoreKey{instId, partnId}]
+	r.mu.RUnlock()
+	if st == nil {
+		return
+	}
+
+	var oldKey, newKey []byte
+	if old != nil {
+		oldKey = secondaryIndexEntry(old).ReadSecKeyCJson()
+	}
+	if new != nil {
+		newKey = secondaryIndexEntry(new).ReadSecKeyCJson()
+	}
+	st.update(oldKey, newKey)
+}
+
+// snapshot returns the aggregates of a partition as of `snap`, the
+// latest snapshot of `slice`.
+func (r *aggrRegistry) snapshot(inst *common.IndexInst, partnId common.PartitionId,
+	slice Slice, snap Snapshot) *aggrFrozen {
+
+	if st := r.get(inst, partnId); st != nil {
+		return st.snapshot(slice, snap)
+	}
+	return nil
+}
+
+func sameAggregates(a, b []common.AggregateDefn) bool {
+	if len(a) != len(b) {
+		return false
+	} else if len(a) == 0 || &a[0] == &b[0] {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+//--------------------------
+// aggregate store
+//--------------------------
+
+// aggrStore holds the aggregates of a partition. While the store is
+// seeded, keys replaced are kept in `pending` and replayed on top of
+// the seed.
+type aggrStore struct {
+	mu       sync.Mutex
+	reg      *aggrRegistry
+	key      aggrStoreKey
+	defns    []common.AggregateDefn
+	state    *aggrState
+	seeding  bool
+	pending  []aggrDelta
+	overflow bool        // pending exceeded maxAggrPending
+	frozen   *aggrFrozen // copy of state, reset on every update
+	size     int64       // memory of state accounted in reg
+	disabled bool        // exceeded max memory, not materialized
+}
+
+// aggrDelta is collatejson key `old` replaced by `new`.
+type aggrDelta struct {
+	old, new []byte
+}
+
+func newAggrStore(reg *aggrRegistry, key aggrStoreKey,
+	defns []common.AggregateDefn) *aggrStore {
+
+	return &aggrStore{reg: reg, key: key, defns: defns}
+}
+
+// update collatejson key `old` to `new`, nil `old` inserts a key and nil
+// `new` deletes it.
+func (st *aggrStore) update(old, new []byte) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.state == nil {
+		// entries applied before seeding starts are in its snapshot.
+		if !st.seeding || st.overflow || st.disabled {
+			return
+		} else if len(st.pending) >= maxAggrPending {
+			st.overflow = true
+			st.pending = nil
+			return
+		}
+		st.pending = append(st.pending, aggrDelta{
+			old: append([]byte(nil), old...),
+			new: append([]byte(nil), new...),
+		})
+		return
+	}
+	if st.state.update(old, new) {
+		st.frozen = nil
+		st.account()
+	}
+}
+
+// account the memory of state in the registry, and stop materializing
+// if aggregates of all stores exceed max memory. Called with st.mu held.
+func (st *aggrStore) account() {
+	delta := st.state.size - st.size
+	st.size = st.state.size
+	used := atomic.AddInt64(&st.reg.memUsed, delta)
+	if max := atomic.LoadInt64(&st.reg.maxMemory); delta > 0 && max > 0 && used > max {
+		logging.Warnf("MaterializedAggr: Index %v PartitionId %v aggregates of all "+
+			"indexes use %v bytes, more than %v, stopped materializing",
+			st.key.instId, st.key.partnId, used, max)
+		st.release()
+		st.disabled = true
+	}
+}
+
+// release the state and its memory. Called with st.mu held.
+func (st *aggrStore) release() {
+	atomic.AddInt64(&st.reg.memUsed, -st.size)
+	st.state, st.frozen, st.size = nil, nil, 0
+}
+
+// close a store removed from the registry, writers may still hold it.
+func (st *aggrStore) close() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.release()
+	st.disabled = true
+}
+
+// snapshot returns a copy of the aggregates, nil till the store is
+// seeded. Seeding is started from `snap` on the first call. Flush and
+// snapshot are serialized by timekeeper, hence the copy is consistent
+// with `snap`.
+func (st *aggrStore) snapshot(slice Slice, snap Snapshot) *aggrFrozen {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.state == nil {
+		if !st.seeding && !st.disabled {
+			st.seeding = true
+			snap.Open()
+			go st.seed(slice, snap)
+		}
+		return nil
+	}
+	if st.frozen == nil {
+		st.frozen = st.state.freeze()
+	}
+	return st.frozen
+}
+
+// seed the store with a full scan of `snap`.
+func (st *aggrStore) seed(slice Slice, snap Snapshot) {
+	defer snap.Close()
+
+	state := newAggrState(st.defns)
+	ctx := slice.GetReaderContext()
+	ctx.Init(make(chan bool))
+	defer ctx.Done()
+
+	var count int64
+	err := snap.All(ctx, func(entry []byte) error {
+		state.update(nil, secondaryIndexEntry(entry).ReadSecKeyCJson())
+		count++
+		max := atomic.LoadInt64(&st.reg.maxMemory)
+		if max > 0 && atomic.LoadInt64(&st.reg.memUsed)+state.size > max {
+			return errAggrMemory
+		}
+		return nil
+	})
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	pending, overflow := st.pending, st.overflow
+	st.seeding, st.pending, st.overflow = false, nil, false
+	if st.disabled {
+		// store closed while seeding.
+		return
+	} else if err == errAggrMemory {
+		logging.Warnf("MaterializedAggr: Slice %v aggregates of all indexes use more "+
+			"than %v bytes, stopped materializing", slice.Id(),
+			atomic.LoadInt64(&st.reg.maxMemory))
+		st.disabled = true
+		return
+	} else if err != nil {
+		// retried with the next snapshot.
+		logging.Errorf("MaterializedAggr: Slice %v error seeding aggregates: %v",
+			slice.Id(), err)
+		return
+	} else if overflow {
+		logging.Warnf("MaterializedAggr: Slice %v more than %v entries applied "+
+			"while seeding aggregates, retried with the next snapshot",
+			slice.Id(), maxAggrPending)
+		return
+	}
+	for _, d := range pending {
+		state.update(d.old, d.new)
+	}
+	st.state = state
+	if st.account(); st.state != nil {
+		logging.Infof("MaterializedAggr: Slice %v seeded aggregates, entries %v",
+			slice.Id(), count)
+	}
+}
+
+//--------------------------
+// aggregate state
+//--------------------------
+
+// aggrState is the groups of every aggregate of a partition.
+type aggrState struct {
+	tables []*aggrTable
+	size   int64 // approximate memory of groups
+
+	explode []byte
+	decode  []byte
+}
+
+// aggrTable is the groups of an aggregate, keyed on concatenated group
+// keys.
+type aggrTable struct {
+	defn   common.AggregateDefn
+	minmax bool
+	groups map[string]*aggrGroup
+}
+
+type aggrGroup struct {
+	keys  [][]byte // collatejson group keys, in defn.Group order
+	count int64    // index entries in the group
+	accs  []aggrAcc
+
+	// count of every value of MIN/MAX keys in the group, by key
+	// position, to recompute MIN/MAX when its value is removed.
+	values map[int32]map[string]int64
+	size   int64 // approximate memory of the group
+}
+
+// aggrAcc accumulates an aggregate function of a group.
+type aggrAcc struct {
+	count   int64 // non null values for COUNT, numbers for COUNTN and SUM
+	isum    int64
+	fsum    float64
+	nfloat  int64
+	inexact bool // int64 sum overflowed, summed as float
+
+	raw []byte // MIN/MAX, nil if none
+}
+
+func newAggrState(defns []common.AggregateDefn) *aggrState {
+	s := &aggrState{}
+	for _, defn := range defns {
+		t := &aggrTable{defn: defn, groups: make(map[string]*aggrGroup)}
+		for _, fn := range defn.Aggrs {
+			if fn.Type == common.AGG_MIN || fn.Type == common.AGG_MAX {
+				t.minmax = true
+			}
+		}
+		s.tables = append(s.tables, t)
+	}
+	return s
+}
+
+// update key `old` to `new`, nil `old` inserts a key and nil `new`
+// deletes it. Returns whether aggregates have changed.
+func (s *aggrState) update(old, new []byte) bool {
+	if bytes.Equal(old, new) {
+		return false
+	}
+	if old != nil {
+		s.apply(old, false)
+	}
+	if new != nil {
+		s.apply(new, true)
+	}
+	return true
+}
+
+func (s *aggrState) apply(key []byte, add bool) {
+	vals, err := s.explodeKey(key)
+	if err != nil {
+		logging.Errorf("MaterializedAggr: error exploding key %v: %v",
+			logging.TagUD(key), err)
+		return
+	}
+	for _, t := range s.tables {
+		if add {
+			s.add(t, vals)
+		} else {
+			s.remove(t, vals)
+		}
+	}
+}
+
+func (s *aggrState) explodeKey(key []byte) ([][]byte, error) {
+	if len(key) > cap(s.explode) {
+		s.explode = make([]byte, 0, len(key)+RESIZE_PAD)
+	}
+	return jsonEncoder.ExplodeArray(key, s.explode[:0])
+}
+
+func (t *aggrTable) groupKey(vals [][]byte) string {
+	var key []byte
+	for _, pos := range t.defn.Group {
+		key = append(key, vals[pos]...)
+	}
+	return string(key)
+}
+
+func (s *aggrState) add(t *aggrTable, vals [][]byte) {
+	gkey := t.groupKey(vals)
+	g := t.groups[gkey]
+	if g == nil {
+		g = &aggrGroup{accs: make([]aggrAcc, len(t.defn.Aggrs))}
+		for _, pos := range t.defn.Group {
+			g.keys = append(g.keys, append([]byte(nil), vals[pos]...))
+		}
+		if t.minmax {
+			g.values = make(map[int32]map[string]int64)
+			for _, fn := range t.defn.Aggrs {
+				if fn.Type == common.AGG_MIN || fn.Type == common.AGG_MAX {
+					g.values[fn.KeyPos] = make(map[string]int64)
+				}
+			}
+		}
+		g.size = aggrGroupOverhead + 2*int64(len(gkey))
+		s.size += g.size
+		t.groups[gkey] = g
+	}
+
+	g.count++
+	for pos, counts := range g.values {
+		if !isAggrValue(vals[pos]) {
+			continue
+		}
+		val := string(vals[pos])
+		if counts[val] == 0 {
+			g.size += aggrValueOverhead + int64(len(val))
+			s.size += aggrValueOverhead + int64(len(val))
+		}
+		counts[val]++
+	}
+	for i, fn := range t.defn.Aggrs {
+		if fn.KeyPos >= 0 {
+			s.accumulate(&g.accs[i], fn.Type, vals[fn.KeyPos], 1)
+		}
+	}
+}
+
+func (s *aggrState) remove(t *aggrTable, vals [][]byte) {
+	gkey := t.groupKey(vals)
+	g := t.groups[gkey]
+	if g == nil {
+		return
+	}
+
+	g.count--
+	if g.count <= 0 {
+		s.size -= g.size
+		delete(t.groups, gkey)
+		return
+	}
+
+	for pos, counts := range g.values {
+		if val := string(vals[pos]); isAggrValue(vals[pos]) {
+			if counts[val]--; counts[val] <= 0 {
+				delete(counts, val)
+				g.size -= aggrValueOverhead + int64(len(val))
+				s.size -= aggrValueOverhead + int64(len(val))
+			}
+		}
+	}
+	for i, fn := range t.defn.Aggrs {
+		if fn.KeyPos < 0 {
+			continue
+		}
+		acc := &g.accs[i]
+		switch fn.Type {
+		case common.AGG_MIN, common.AGG_MAX:
+			counts := g.values[fn.KeyPos]
+			if acc.raw != nil && bytes.Equal(vals[fn.KeyPos], acc.raw) &&
+				counts[string(acc.raw)] == 0 {
+				s.recompute(acc, fn.Type, counts)
+			}
+		default:
+			s.accumulate(acc, fn.Type, vals[fn.KeyPos], -1)
+		}
+	}
+}
+
+// recompute MIN/MAX of a group whose value was removed, from the
+// counts of values in the group.
+func (s *aggrState) recompute(acc *aggrAcc, typ common.AggrFuncType,
+	counts map[string]int64) {
+
+	acc.raw = nil
+	for val := range counts {
+		s.accumulate(acc, typ, []byte(val), 1)
+	}
+}
+
+// isAggrValue returns false for missing and null values, which are
+// ignored by aggregate functions.
+func isAggrValue(val []byte) bool {
+	return len(val) != 0 && val[0] != collatejson.TypeMissing &&
+		val[0] != collatejson.TypeNull
+}
+
+// accumulate adds (sign 1) or removes (sign -1) value `val` of an
+// entry. Removal of MIN/MAX is handled by the caller.
+func (s *aggrState) accumulate(acc *aggrAcc, typ common.AggrFuncType,
+	val []byte, sign int64) {
+
+	if !isAggrValue(val) {
+		return
+	}
+
+	switch typ {
+	case common.AGG_COUNT:
+		acc.count += sign
+
+	case common.AGG_COUNTN:
+		if val[0] == collatejson.TypeNumber {
+			acc.count += sign
+		}
+
+	case common.AGG_SUM:
+		if val[0] != collatejson.TypeNumber {
+			return
+		}
+		if len(val)*3 > cap(s.decode) {
+			s.decode = make([]byte, 0, len(val)*3+RESIZE_PAD)
+		}
+		v, err := jsonEncoder.DecodeN1QLValue(val, s.decode[:0])
+		if err != nil {
+			logging.Errorf("MaterializedAggr: error decoding %v: %v",
+				logging.TagUD(val), err)
+			return
+		}
+		acc.count += sign
+		switch n := v.ActualForIndex().(type) {
+		case int64:
+			acc.addInt(n, sign)
+		case float64:
+			acc.fsum += float64(sign) * n
+			acc.nfloat += sign
+		}
+
+	case common.AGG_MIN, common.AGG_MAX:
+		cmp := 0
+		if acc.raw != nil {
+			cmp = bytes.Compare(val, acc.raw)
+		}
+		if acc.raw == nil || (typ == common.AGG_MIN && cmp < 0) ||
+			(typ == common.AGG_MAX && cmp > 0) {
+			// never modified in place, frozen copies share it.
+			acc.raw = append([]byte(nil), val...)
+		}
+	}
+}
+
+func (acc *aggrAcc) addInt(n, sign int64) {
+	if acc.inexact {
+		acc.fsum += float64(sign) * float64(n)
+		return
+	}
+	if sign < 0 {
+		if n == math.MinInt64 {
+			acc.inexact = true
+			acc.fsum += float64(acc.isum) - float64(n)
+			acc.isum = 0
+			return
+		}
+		n = -n
+	}
+	sum := acc.isum + n
+	if (n > 0 && sum < acc.isum) || (n < 0 && sum > acc.isum) {
+		acc.inexact = true
+		acc.fsum += float64(acc.isum) + float64(n)
+		acc.isum = 0
+		return
+	}
+	acc.isum = sum
+}
+
+// merge the accumulator of the same group from another partition.
+func (acc *aggrAcc) merge(other *aggrAcc, typ common.AggrFuncType) {
+	switch typ {
+	case common.AGG_MIN, common.AGG_MAX:
+		if other.raw == nil {
+			return
+		}
+		cmp := 0
+		if acc.raw != nil {
+			cmp = bytes.Compare(other.raw, acc.raw)
+		}
+		if acc.raw == nil || (typ == common.AGG_MIN && cmp < 0) ||
+			(typ == common.AGG_MAX && cmp > 0) {
+			acc.raw = other.raw
+		}
+	default:
+		acc.count += other.count
+		acc.fsum += other.fsum
+		acc.nfloat += other.nfloat
+		if other.inexact {
+			acc.inexact = true
+			acc.fsum += float64(acc.isum) + float64(other.isum)
+			acc.isum = 0
+		} else {
+			acc.addInt(other.isum, 1)
+		}
+	}
+}
+
+// value of the aggregate, as returned by the common.AggrFunc of `typ`.
+func (acc *aggrAcc) value(typ common.AggrFuncType) interface{} {
+	switch typ {
+	case common.AGG_SUM:
+		if acc.count == 0 {
+			return nil
+		} else if acc.nfloat == 0 && !acc.inexact {
+			return acc.isum
+		}
+		return acc.fsum + float64(acc.isum)
+	case common.AGG_MIN, common.AGG_MAX:
+		if acc.raw == nil {
+			return encodedNull
+		}
+		return acc.raw
+	default:
+		return acc.count
+	}
+}
+
+//--------------------------
+// frozen aggregates
+//--------------------------
+
+// aggrFrozen is an immutable copy of the aggregates of a partition, as
+// of a slice snapshot.
+type aggrFrozen struct {
+	tables map[string]*aggrFrozenTable // by aggregate name
+}
+
+type aggrFrozenTable struct {
+	defn   common.AggregateDefn
+	groups []*aggrGroup // without values
+}
+
+func (s *aggrState) freeze() *aggrFrozen {
+	f := &aggrFrozen{tables: make(map[string]*aggrFrozenTable)}
+	for _, t := range s.tables {
+		ft := &aggrFrozenTable{
+			defn:   t.defn,
+			groups: make([]*aggrGroup, 0, len(t.groups)),
+		}
+		for _, g := range t.groups {
+			ft.groups = append(ft.groups, &aggrGroup{
+				keys:  g.keys,
+				count: g.count,
+				accs:  append([]aggrAcc(nil), g.accs...),
+			})
+		}
+		f.tables[t.defn.Name] = ft
+	}
+	return f
+}
+
+//--------------------------
+// scan
+//--------------------------
+
+// materializedRows answers the group aggregate of `r` from an aggregate
+// materialized with the index, rows are in group key order. Returns
+// false if the request has to be answered by scanning the index, which
+// is when no aggregate matches the request or snapshots do not carry
+// aggregates yet.
+func materializedRows(r *ScanRequest, snapshots []SliceSnapshot) ([]*aggrRow, bool) {
+	defn, groupPos, aggrPos := matchAggregate(r)
+	if defn == nil || len(snapshots) == 0 {
+		return nil, false
+	}
+
+	// merge groups across partitions.
+	merged := make(map[string]*aggrGroup)
+	for _, ss := range snapshots {
+		snap, ok := ss.(*sliceSnapshot)
+		if !ok || snap.aggrs == nil {
+			return nil, false
+		}
+		t := snap.aggrs.tables[defn.Name]
+		if t == nil || !reflect.DeepEqual(&t.defn, defn) {
+			return nil, false
+		}
+		for _, g := range t.groups {
+			key := string(bytes.Join(g.keys, nil))
+			m := merged[key]
+			if m == nil {
+				m = &aggrGroup{keys: g.keys, accs: make([]aggrAcc, len(g.accs))}
+				merged[key] = m
+			}
+			m.count += g.count
+			for i := range g.accs {
+				m.accs[i].merge(&g.accs[i], defn.Aggrs[i].Type)
+			}
+		}
+	}
+
+	groups := make([]*aggrGroup, 0, len(merged))
+	for _, g := range merged {
+		groups = append(groups, g)
+	}
+
+	// index order of group keys.
+	order := make([]int, len(defn.Group))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Sort(groupKeyOrder{order: order, group: defn.Group})
+	sort.Sort(aggrGroupList{groups: groups, order: order})
+
+	rows := make([]*aggrRow, 0, len(groups))
+	for _, g := range groups {
+		row := &aggrRow{flush: true}
+		for i, gk := range r.GroupAggr.Group {
+			row.groups = append(row.groups, &groupKey{
+				raw:       g.keys[groupPos[i]],
+				projectId: gk.EntryKeyId,
+			})
+		}
+		for i, ak := range r.GroupAggr.Aggrs {
+			fn := defn.Aggrs[aggrPos[i]]
+			var val interface{}
+			if fn.KeyPos < 0 {
+				val = g.count
+			} else {
+				val = g.accs[aggrPos[i]].value(fn.Type)
+			}
+			row.aggrs = append(row.aggrs, &aggrVal{
+				fn:        &materializedAggr{typ: fn.Type, val: val},
+				typ:       fn.Type,
+				projectId: ak.EntryKeyId,
+			})
+		}
+		rows = append(rows, row)
+	}
+	return rows, true
+}
+
+// matchAggregate returns the aggregate of the index that answers the
+// group aggregate of `r`, with the position in the aggregate of every
+// group key and aggregate of the request. The aggregate named in the
+// request is preferred.
+func matchAggregate(r *ScanRequest) (*common.AggregateDefn, []int, []int) {
+	ga := r.GroupAggr
+	if ga == nil || r.isPrimary || r.IndexInst.Defn.Desc != nil ||
+		len(r.IndexInst.Defn.Aggregates) == 0 || r.Indexprojection == nil ||
+		ga.OnePerPrimaryKey {
+		return nil, nil, nil
+	}
+	if len(r.Scans) != 1 || !isFullScan(r.Scans[0]) {
+		return nil, nil, nil
+	}
+
+	match := func(defn *common.AggregateDefn) ([]int, []int) {
+		if len(ga.Group) != len(defn.Group) {
+			return nil, nil
+		}
+		groupPos := make([]int, len(ga.Group))
+		for i, gk := range ga.Group {
+			groupPos[i] = -1
+			for j, pos := range defn.Group {
+				if gk.KeyPos >= 0 && gk.KeyPos == pos {
+					groupPos[i] = j
+				}
+			}
+			if groupPos[i] < 0 {
+				return nil, nil
+			}
+		}
+		aggrPos := make([]int, len(ga.Aggrs))
+		for i, ak := range ga.Aggrs {
+			if ak.Distinct {
+				return nil, nil
+			}
+			keyPos := ak.KeyPos
+			if keyPos < 0 {
+				keyPos = -1
+				// COUNT(*) and COUNT of a constant count entries.
+				if ak.AggrFunc != common.AGG_COUNT || ak.ExprValue == nil {
+					return nil, nil
+				} else if t := ak.ExprValue.Type(); t == value.MISSING || t == value.NULL {
+					return nil, nil
+				}
+			}
+			aggrPos[i] = -1
+			for j, fn := range defn.Aggrs {
+				if fn.Type == ak.AggrFunc &&
+					(fn.KeyPos == keyPos || (keyPos < 0 && fn.KeyPos < 0)) {
+					aggrPos[i] = j
+					break
+				}
+			}
+			if aggrPos[i] < 0 {
+				return nil, nil
+			}
+		}
+		return groupPos, aggrPos
+	}
+
+	if defn := r.IndexInst.Defn.FindAggregate(ga.Name); defn != nil {
+		if groupPos, aggrPos := match(defn); groupPos != nil {
+			return defn, groupPos, aggrPos
+		}
+	}
+	for i := range r.IndexInst.Defn.Aggregates {
+		defn := &r.IndexInst.Defn.Aggregates[i]
+		if groupPos, aggrPos := match(defn); groupPos != nil {
+			return defn, groupPos, aggrPos
+		}
+	}
+	return nil, nil, nil
+}
+
+// isFullScan returns true if `scan` qualifies every entry in the index.
+// Leading key of an entry is never missing, a span starting at an
+// inclusive null on the leading key is full.
+func isFullScan(scan Scan) bool {
+	if scan.ScanType == AllReq {
+		return true
+	} else if scan.ScanType != RangeReq && scan.ScanType != FilterRangeReq {
+		return false
+	}
+
+	for _, filter := range scan.Filters {
+		full := true
+		for i, cf := range filter.CompositeFilters {
+			if cf.High != MaxIndexKey {
+				full = false
+			} else if cf.Low == MinIndexKey {
+				continue
+			} else if i > 0 || !isEncodedNull(cf.Low.Bytes()) ||
+				(cf.Inclusion != Low && cf.Inclusion != Both) {
+				full = false
+			}
+		}
+		if full {
+			return true
+		}
+	}
+	return false
+}
+
+// materializedAggr is the value of a materialized aggregate, in the
+// form the scan pipeline projects aggregates it computes.
+type materializedAggr struct {
+	typ common.AggrFuncType
+	val interface{}
+}
+
+func (a *materializedAggr) Type() common.AggrFuncType {
+	return a.typ
+}
+
+func (a *materializedAggr) AddDelta(delta interface{}) {
+}
+
+func (a *materializedAggr) AddDeltaObj(delta value.Value) {
+}
+
+func (a *materializedAggr) AddDeltaRaw(delta []byte) {
+}
+
+func (a *materializedAggr) Value() interface{} {
+	return a.val
+}
+
+func (a *materializedAggr) Distinct() bool {
+	return false
+}
+
+func (a *materializedAggr) IsValid() bool {
+	return a.val != nil
+}
+
+// groupKeyOrder sorts positions of group keys by their index key position.
+type groupKeyOrder struct {
+	order []int
+	group []int32
+}
+
+func (o groupKeyOrder) Len() int      { return len(o.order) }
+func (o groupKeyOrder) Swap(i, j int) { o.order[i], o.order[j] = o.order[j], o.order[i] }
+func (o groupKeyOrder) Less(i, j int) bool {
+	return o.group[o.order[i]] < o.group[o.order[j]]
+}
+
+// aggrGroupList sorts groups by their keys, compared in `order`.
+type aggrGroupList struct {
+	groups []*aggrGroup
+	order  []int
+}
+
+func (l aggrGroupList) Len() int      { return len(l.groups) }
+func (l aggrGroupList) Swap(i, j int) { l.groups[i], l.groups[j] = l.groups[j], l.groups[i] }
+func (l aggrGroupList) Less(i, j int) bool {
+	for _, k := range l.order {
+		if cmp := bytes.Compare(l.groups[i].keys[k], l.groups[j].keys[k]); cmp != 0 {
+			return cmp < 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,474 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+var testAggregates = []common.AggregateDefn{
+	{
+		Name:  "byk0",
+		Group: []int32{0},
+		Aggrs: []common.AggregateFunc{
+			{Type: common.AGG_SUM, KeyPos: 1},
+			{Type: common.AGG_COUNT, KeyPos: 1},
+			{Type: common.AGG_MIN, KeyPos: 1},
+			{Type: common.AGG_MAX, KeyPos: 1},
+			{Type: common.AGG_COUNT, KeyPos: -1},
+		},
+	},
+}
+
+// decodeAggrKey decodes collatejson `code`, numbers decoded in
+// scientific notation are formatted as by encoding/json.
+func decodeAggrKey(t *testing.T, code []byte) string {
+	buf, err := jsonEncoder.Decode(code, make([]byte, 0, 3*len(code)+RESIZE_PAD))
+	if err != nil {
+		t.Fatalf("decode %v: %v", code, err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		t.Fatalf("decode %s: %v", buf, err)
+	}
+	buf, _ = json.Marshal(v)
+	return string(buf)
+}
+
+func aggrNumber(v interface{}) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return -1
+}
+
+func checkAggrGroup(t *testing.T, s *aggrState, group string,
+	count int64, sum interface{}, countk int64, min, max string) {
+
+	vals, err := s.explodeKey(encodeStatsKey(t, `[`+group+`]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := s.tables[0].groups[string(vals[0])]
+	if g == nil {
+		t.Fatalf("group %v not found", group)
+	}
+	if g.count != count {
+		t.Errorf("group %v count %v, expected %v", group, g.count, count)
+	}
+	if v := g.accs[0].value(common.AGG_SUM); (v == nil) != (sum == nil) ||
+		(v != nil && aggrNumber(v) != aggrNumber(sum)) {
+		t.Errorf("group %v sum %v, expected %v", group, v, sum)
+	}
+	if v := g.accs[1].value(common.AGG_COUNT); v.(int64) != countk {
+		t.Errorf("group %v count(k1) %v, expected %v", group, v, countk)
+	}
+	if v := decodeAggrKey(t, g.accs[2].value(common.AGG_MIN).([]byte)); v != min {
+		t.Errorf("group %v min %v, expected %v", group, v, min)
+	}
+	if v := decodeAggrKey(t, g.accs[3].value(common.AGG_MAX).([]byte)); v != max {
+		t.Errorf("group %v max %v, expected %v", group, v, max)
+	}
+}
+
+func TestMaterializedAggrState(t *testing.T) {
+	key := func(k string) []byte {
+		return encodeStatsKey(t, k)
+	}
+
+	s := newAggrState(testAggregates)
+	s.update(nil, key(`["a",1]`))
+	s.update(nil, key(`["a",5]`))
+	s.update(nil, key(`["a",5]`))
+	s.update(nil, key(`["a",null]`))
+	s.update(nil, key(`["b",2.5]`))
+	checkAggrGroup(t, s, `"a"`, 4, int64(11), 3, "1", "5")
+	checkAggrGroup(t, s, `"b"`, 1, 2.5, 1, "2.5", "2.5")
+
+	// removing the minimum recomputes it from values in the group.
+	if !s.update(key(`["a",1]`), nil) {
+		t.Errorf("expected delete to change aggregates")
+	}
+	checkAggrGroup(t, s, `"a"`, 3, int64(10), 2, "5", "5")
+
+	// maximum is kept while another entry has its value.
+	s.update(key(`["a",5]`), key(`["b",3]`))
+	checkAggrGroup(t, s, `"a"`, 2, int64(5), 1, "5", "5")
+	checkAggrGroup(t, s, `"b"`, 2, 5.5, 2, "2.5", "3")
+
+	// update moves the entry across groups.
+	s.update(key(`["a",5]`), key(`["b",4]`))
+	checkAggrGroup(t, s, `"a"`, 1, nil, 0, "null", "null")
+	checkAggrGroup(t, s, `"b"`, 3, 9.5, 3, "2.5", "4")
+
+	// unchanged key is a no-op.
+	if s.update(key(`["b",2.5]`), key(`["b",2.5]`)) || s.update(nil, nil) {
+		t.Errorf("expected no change")
+	}
+
+	s.update(key(`["a",null]`), nil)
+	if len(s.tables[0].groups) != 1 {
+		t.Errorf("unexpected groups %v", len(s.tables[0].groups))
+	}
+	// distinct values of the MIN/MAX key are counted.
+	for _, g := range s.tables[0].groups {
+		if len(g.values) != 1 || len(g.values[1]) != 3 {
+			t.Errorf("unexpected values %v", g.values)
+		}
+	}
+}
+
+func TestMaterializedAggrSumOverflow(t *testing.T) {
+	var acc aggrAcc
+	acc.count = 2
+	acc.addInt(1<<62, 1)
+	acc.addInt(1<<62, 1)
+	if v, ok := acc.value(common.AGG_SUM).(float64); !ok || v != float64(1<<63) {
+		t.Errorf("unexpected sum %v", acc.value(common.AGG_SUM))
+	}
+}
+
+func TestMaterializedAggrRows(t *testing.T) {
+	// two partitions, group "a" in both.
+	s1 := newAggrState(testAggregates)
+	s1.update(nil, encodeStatsKey(t, `["b",1]`))
+	s1.update(nil, encodeStatsKey(t, `["a",7]`))
+	s2 := newAggrState(testAggregates)
+	s2.update(nil, encodeStatsKey(t, `["a",2]`))
+
+	r := &ScanRequest{
+		Scans:           []Scan{{ScanType: AllReq}},
+		Indexprojection: &Projection{},
+		GroupAggr: &GroupAggr{
+			Group: []*GroupKey{{EntryKeyId: 0, KeyPos: 0}},
+			Aggrs: []*Aggregate{
+				{AggrFunc: common.AGG_MAX, EntryKeyId: 1, KeyPos: 1},
+				{AggrFunc: common.AGG_SUM, EntryKeyId: 2, KeyPos: 1},
+			},
+		},
+	}
+	r.IndexInst.Defn.Aggregates = testAggregates
+	snapshots := []SliceSnapshot{
+		&sliceSnapshot{aggrs: s1.freeze()},
+		&sliceSnapshot{aggrs: s2.freeze()},
+	}
+
+	rows, ok := materializedRows(r, snapshots)
+	if !ok || len(rows) != 2 {
+		t.Fatalf("unexpected rows %v %v", ok, len(rows))
+	}
+	if g := decodeAggrKey(t, rows[0].groups[0].raw); g != `"a"` {
+		t.Errorf("unexpected first group %v", g)
+	}
+	if v := decodeAggrKey(t, rows[0].aggrs[0].fn.Value().([]byte)); v != "7" {
+		t.Errorf("unexpected max %v", v)
+	}
+	if v := aggrNumber(rows[0].aggrs[1].fn.Value()); v != 9 {
+		t.Errorf("unexpected sum %v", v)
+	}
+
+	// aggregate not seeded in a partition, scanned.
+	snapshots[1] = &sliceSnapshot{}
+	if _, ok := materializedRows(r, snapshots); ok {
+		t.Errorf("expected scan without aggregates of all partitions")
+	}
+
+	// distinct aggregate is not materialized.
+	snapshots[1] = &sliceSnapshot{aggrs: s2.freeze()}
+	r.GroupAggr.Aggrs[1].Distinct = true
+	if _, ok := materializedRows(r, snapshots); ok {
+		t.Errorf("expected scan for distinct aggregate")
+	}
+}
+
+// aggrTestSnapshot serves the seed of aggregates, All waits on `release`
+// so that entries are applied while seeding.
+type aggrTestSnapshot struct {
+	Snapshot
+	entries []secondaryIndexEntry
+	release chan bool
+	closed  chan bool
+}
+
+func (s *aggrTestSnapshot) Open() error {
+	return nil
+}
+
+func (s *aggrTestSnapshot) Close() error {
+	s.closed <- true
+	return nil
+}
+
+func (s *aggrTestSnapshot) All(ctx IndexReaderContext, callb EntryCallback) error {
+	<-s.release
+	for _, entry := range s.entries {
+		if err := callb(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type aggrTestSlice struct {
+	Slice
+}
+
+func (s *aggrTestSlice) Id() SliceId {
+	return 0
+}
+
+func (s *aggrTestSlice) GetReaderContext() IndexReaderContext {
+	return &cursorCtx{}
+}
+
+func TestMaterializedAggrSeed(t *testing.T) {
+	entry := func(key, docid string) []byte {
+		e, err := newSKEntry([]byte(key), []byte(docid))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append([]byte(nil), e...)
+	}
+	newSnapshot := func(entries ...[]byte) *aggrTestSnapshot {
+		snap := &aggrTestSnapshot{release: make(chan bool), closed: make(chan bool, 1)}
+		for _, e := range entries {
+			snap.entries = append(snap.entries, e)
+		}
+		return snap
+	}
+
+	r := newAggrRegistry()
+	inst := &common.IndexInst{InstId: 1}
+	inst.Defn.Aggregates = testAggregates
+	slice := &aggrTestSlice{}
+
+	// entries applied before the store is created are in the snapshot.
+	r.update(inst.InstId, 0, nil, entry(`["z",1]`, "d9"))
+
+	snap := newSnapshot(entry(`["a",1]`, "d1"), entry(`["a",5]`, "d2"),
+		entry(`["b",2]`, "d3"))
+	if f := r.snapshot(inst, 0, slice, snap); f != nil {
+		t.Fatalf("expected no aggregates till seeded")
+	}
+
+	// entries applied while seeding are replayed on the seed.
+	r.update(inst.InstId, 0, entry(`["a",1]`, "d1"), entry(`["a",3]`, "d1"))
+	r.update(inst.InstId, 0, entry(`["a",5]`, "d2"), nil)
+	r.update(inst.InstId, 0, nil, entry(`["c",7]`, "d4"))
+	if f := r.snapshot(inst, 0, slice, snap); f != nil {
+		t.Fatalf("expected no aggregates while seeding")
+	}
+	close(snap.release)
+	<-snap.closed
+
+	f := r.snapshot(inst, 0, slice, snap)
+	if f == nil || len(f.tables["byk0"].groups) != 3 {
+		t.Fatalf("unexpected aggregates %v", f)
+	}
+	s := r.stores[aggrStoreKey{inst.InstId, 0}].state
+	checkAggrGroup(t, s, `"a"`, 1, int64(3), 1, "3", "3")
+	checkAggrGroup(t, s, `"b"`, 1, int64(2), 1, "2", "2")
+	checkAggrGroup(t, s, `"c"`, 1, int64(7), 1, "7", "7")
+
+	// applied after seeding.
+	r.update(inst.InstId, 0, entry(`["c",7]`, "d4"), nil)
+	if f2 := r.snapshot(inst, 0, slice, snap); f2 == f || len(f2.tables["byk0"].groups) != 2 {
+		t.Errorf("expected aggregates to be updated")
+	}
+
+	// seeding restarts with the next snapshot past maxAggrPending.
+	r.reset(inst.InstId, 0)
+	snap = newSnapshot(entry(`["a",1]`, "d1"))
+	r.snapshot(inst, 0, slice, snap)
+	e := entry(`["b",1]`, "d2")
+	for i := 0; i <= maxAggrPending; i++ {
+		r.update(inst.InstId, 0, nil, e)
+	}
+	close(snap.release)
+	<-snap.closed
+	st := r.stores[aggrStoreKey{inst.InstId, 0}]
+	if st.state != nil || st.pending != nil {
+		t.Fatalf("expected seed to be dropped")
+	}
+
+	snap = newSnapshot(entry(`["a",1]`, "d1"), entry(`["b",1]`, "d2"))
+	r.snapshot(inst, 0, slice, snap)
+	close(snap.release)
+	<-snap.closed
+	if f := r.snapshot(inst, 0, slice, snap); f == nil || len(f.tables["byk0"].groups) != 2 {
+		t.Errorf("unexpected aggregates after reseed %v", f)
+	}
+}
+
+func TestMaterializedAggrMemory(t *testing.T) {
+	key := func(k string) []byte {
+		return encodeStatsKey(t, k)
+	}
+
+	s := newAggrState(testAggregates)
+	s.update(nil, key(`["a",1]`))
+	s.update(nil, key(`["a",2]`))
+	s.update(nil, key(`["b",2]`))
+	if s.size <= 0 {
+		t.Fatalf("expected memory of groups to be accounted")
+	}
+	s.update(key(`["a",1]`), key(`["a",2]`))
+	s.update(key(`["a",2]`), nil)
+	s.update(key(`["a",2]`), nil)
+	s.update(key(`["b",2]`), nil)
+	if s.size != 0 {
+		t.Errorf("expected no memory without groups, got %v", s.size)
+	}
+
+	entry := func(key, docid string) []byte {
+		e, err := newSKEntry([]byte(key), []byte(docid))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append([]byte(nil), e...)
+	}
+	seed := func(r *aggrRegistry, inst *common.IndexInst, entries ...[]byte) *aggrFrozen {
+		snap := &aggrTestSnapshot{release: make(chan bool), closed: make(chan bool, 1)}
+		for _, e := range entries {
+			snap.entries = append(snap.entries, e)
+		}
+		r.snapshot(inst, 0, &aggrTestSlice{}, snap)
+		close(snap.release)
+		<-snap.closed
+		return r.snapshot(inst, 0, &aggrTestSlice{}, snap)
+	}
+
+	r := newAggrRegistry()
+	r.setMaxMemory(2000)
+	inst := &common.IndexInst{InstId: 1}
+	inst.Defn.Aggregates = testAggregates
+	if f := seed(r, inst, entry(`["a",1]`, "d1")); f == nil {
+		t.Fatalf("expected aggregates to be seeded")
+	}
+	if used := r.memoryUsed(inst.InstId, 0); used <= 0 || used != r.memUsed {
+		t.Errorf("unexpected memory used %v, registry %v", used, r.memUsed)
+	}
+
+	// distinct values of MIN/MAX key grow the group past max memory.
+	for i := 0; i < 100; i++ {
+		r.update(inst.InstId, 0, nil, entry(fmt.Sprintf(`["a",%d]`, i+2), fmt.Sprintf("d%d", i+2)))
+	}
+	if f := r.snapshot(inst, 0, &aggrTestSlice{}, nil); f != nil {
+		t.Errorf("expected aggregates past max memory to be dropped")
+	}
+	if r.memUsed != 0 || r.memoryUsed(inst.InstId, 0) != 0 {
+		t.Errorf("expected memory to be released, got %v", r.memUsed)
+	}
+
+	// seeding past max memory stops materializing.
+	r.reset(inst.InstId, 0)
+	var entries [][]byte
+	for i := 0; i < 100; i++ {
+		entries = append(entries, entry(fmt.Sprintf(`["a",%d]`, i), fmt.Sprintf("d%d", i)))
+	}
+	if f := seed(r, inst, entries...); f != nil || r.memUsed != 0 {
+		t.Errorf("expected seeding to stop past max memory")
+	}
+
+	// seeded again once the partition is reset.
+	r.setMaxMemory(0)
+	r.reset(inst.InstId, 0)
+	if f := seed(r, inst, entries...); f == nil || len(f.tables["byk0"].groups) != 1 {
+		t.Errorf("unexpected aggregates %v", f)
+	}
+}
+
+func TestMaterializedAggrSlice(t *testing.T) {
+	cfg := common.SystemConfig.SectionConfig("indexer.", true)
+	cfg.SetValue("numSliceWriters", 2)
+	cfg.SetValue("settings.allow_large_keys", false)
+	cfg.SetValue("settings.max_seckey_size", 32)
+	stats := &IndexStats{}
+	stats.Init()
+
+	inst := &common.IndexInst{InstId: common.IndexInstId(1001)}
+	inst.Defn.DefnId = common.IndexDefnId(1001)
+	inst.Defn.SecExprs = []string{"k0", "k1"}
+	inst.Defn.Aggregates = testAggregates
+	slice, err := NewMemDBSlice("/tmp/mdbslice_aggr", SliceId(0), inst.Defn,
+		inst.InstId, common.PartitionId(0), false, false, 1, cfg, stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		materializedAggrs.drop(inst.InstId)
+		slice.Close()
+		slice.Destroy()
+	}()
+
+	meta := NewMutationMeta()
+	insert := func(docid, key string) {
+		slice.Insert([]byte(key), []byte(docid), meta)
+	}
+	var snap Snapshot
+	snapshot := func() *aggrFrozen {
+		if snap != nil {
+			snap.Close()
+		}
+		info, err := slice.NewSnapshot(nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snap, err = slice.OpenSnapshot(info); err != nil {
+			t.Fatal(err)
+		}
+		return materializedAggrs.snapshot(inst, 0, slice, snap)
+	}
+	defer func() {
+		snap.Close()
+	}()
+
+	insert("d1", `["a",1]`)
+	insert("d2", `["b",2]`)
+	for i := 0; snapshot() == nil; i++ {
+		if i == 100 {
+			t.Fatalf("aggregates not seeded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// keys too long are skipped by the slice, and not aggregated.
+	long := `["b","` + strings.Repeat("x", 40) + `"]`
+	insert("d3", `["a",5]`)
+	insert("d4", long)
+	insert("d1", `["a",3]`)
+	insert("d2", long)
+	slice.Delete([]byte("d3"), meta)
+	insert("d5", `["c",null]`)
+
+	f := snapshot()
+	if f == nil || len(f.tables["byk0"].groups) != 2 {
+		t.Fatalf("unexpected aggregates %v", f)
+	}
+	s := materializedAggrs.stores[aggrStoreKey{inst.InstId, 0}].state
+	checkAggrGroup(t, s, `"a"`, 1, int64(3), 1, "3", "3")
+	checkAggrGroup(t, s, `"c"`, 1, nil, 0, "null", "null")
+
+	// aggregates agree with a seed of the snapshot.
+	seed := newAggrState(testAggregates)
+	err = snap.All(slice.GetReaderContext(), func(entry []byte) error {
+		seed.update(nil, secondaryIndexEntry(entry).ReadSecKeyCJson())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAggrGroup(t, seed, `"a"`, 1, int64(3), 1, "3", "3")
+	checkAggrGroup(t, seed, `"c"`, 1, nil, 0, "null", "null")
+	if len(seed.tables[0].groups) != len(s.tables[0].groups) {
+		t.Errorf("expected %v groups, got %v", len(seed.tables[0].groups),
+			len(s.tables[0].groups))
+	}
+}
@@ -41,6 +41,7 @@ const (
 	opInsert = iota
 	opUpdate
 	opDelete
+	opLookup
 )
 
 const tmpDirName = ".tmp"
@@ -50,6 +51,9 @@ type indexMutation struct {
 	key   []byte
 	docid []byte
 	meta  *MutationMeta
+
+	// back-index entries are sent on respch for opLookup.
+	respch chan [][]byte
 }
 
 func docIdFromEntryBytes(e []byte) []byte {
@@ -155,6 +159,16 @@ type memdbSlice struct {
 
 	isPersistorActive int32
 
+	// Last persisted snapshot, kept open as the base of the next delta
+	// snapshot, and the directories of the full snapshot and delta
+	// snapshots persisted since. persistGen is bumped when the stores
+	// are reset, so that a persistor in progress does not retain its
+	// snapshot.
+	persistLock  sync.Mutex
+	persistBase  *memdb.Snapshot
+	persistChain []string
+	persistGen   uint64
+
 	lastRollbackTs *common.TsVbuuid
 
 	// Array processing
@@ -408,6 +422,10 @@ loop:
 				elapsed = time.Since(start)
 				mdb.totalFlushTime += elapsed
 
+			case opLookup:
+				icmd.respch <- mdb.getBackIndexEntries(icmd.docid, workerId)
+				continue loop
+
 			default:
 				logging.Errorf("MemDBSlice::handleCommandsWorker \n\tSliceId %v IndexInstId %v PartitionId %v Received "+
 					"Unknown Command %v", mdb.id, mdb.idxInstId, mdb.idxPartnId, logging.TagUD(icmd))
@@ -563,6 +581,8 @@ func (mdb *memdbSlice) insertSecIndex(key []byte, docid []byte, workerId int, me
 		if updated, oldNode := mdb.back[workerId].Update(entry, unsafe.Pointer(newNode)); updated {
 			t0 := time.Now()
 			oldSz := getNodeItemSize((*skiplist.Node)(oldNode))
+			materializedAggrs.update(mdb.idxInstId, mdb.idxPartnId,
+				getNodeItemBytes((*skiplist.Node)(oldNode)), entry)
 			mdb.main[workerId].DeleteNode((*skiplist.Node)(oldNode))
 			mdb.idxStats.Timings.stKVDelete.Put(time.Since(t0))
 
@@ -571,6 +591,7 @@ func (mdb *memdbSlice) insertSecIndex(key []byte, docid []byte, workerId int, me
 			atomic.AddInt64(&mdb.delete_bytes, int64(len(docid)))
 		} else {
 			// First time insert into back store
+			materializedAggrs.update(mdb.idxInstId, mdb.idxPartnId, nil, entry)
 			mdb.idxStats.backstoreDataSize.Add(int64(len(docid) + 2))
 			mdb.idxStats.dataSize.Add(int64(len(docid) + 2))
 		}
@@ -781,6 +802,8 @@ func (mdb *memdbSlice) deleteSecIndex(docid []byte, workerId int) int {
 		atomic.AddInt64(&mdb.delete_bytes, int64(len(docid)))
 
 		oldSz := getNodeItemSize((*skiplist.Node)(node))
+		materializedAggrs.update(mdb.idxInstId, mdb.idxPartnId,
+			getNodeItemBytes((*skiplist.Node)(node)), nil)
 		t0 = time.Now()
 		mdb.main[workerId].DeleteNode((*skiplist.Node)(node))
 		mdb.idxStats.Timings.stKVDelete.Put(time.Since(t0))
@@ -825,6 +848,56 @@ func (mdb *memdbSlice) deleteSecArrayIndex(docid []byte, workerId int) (nmut int
 	return len(oldEntriesBytes)
 }
 
+// getBackIndexEntries returns a copy of the main index entries held
+// by the back index for docid. Shall be called from the worker owning
+// the docid's vbucket.
+func (mdb *memdbSlice) getBackIndexEntries(docid []byte, workerId int) [][]byte {
+	lookupentry := entryBytesFromDocId(docid)
+	ptr := (*skiplist.Node)(mdb.back[workerId].Get(lookupentry))
+	if ptr == nil {
+		return nil
+	}
+
+	var entries [][]byte
+	if !mdb.idxDefn.IsArrayIndex {
+		itm := (*memdb.Item)(ptr.Item())
+		entries = append(entries, append([]byte(nil), itm.Bytes()...))
+	} else {
+		for _, item := range memdb.NewNodeList(ptr).Keys() {
+			entries = append(entries, append([]byte(nil), item...))
+		}
+	}
+	return entries
+}
+
+// lookupBackIndex queues the lookup behind pending mutations of the
+// docid's vbucket, so that the back index is read by its owning worker.
+func (mdb *memdbSlice) lookupBackIndex(docid []byte, stopch StopChannel) ([][]byte, error) {
+	if mdb.isPrimary {
+		return nil, errBackIndexUnsupported
+	}
+
+	mdb.confLock.RLock()
+	numVbuckets := mdb.sysconf["numVbuckets"].Int()
+	mdb.confLock.RUnlock()
+
+	workerId := vbucketFromEntryBytes(entryBytesFromDocId(docid), numVbuckets) % mdb.numWriters
+	mut := indexMutation{op: opLookup, docid: docid, respch: make(chan [][]byte, 1)}
+
+	select {
+	case mdb.cmdCh[workerId] <- mut:
+	case <-stopch:
+		return nil, common.ErrClientCancel
+	}
+
+	select {
+	case entries := <-mut.respch:
+		return entries, nil
+	case <-stopch:
+		return nil, common.ErrClientCancel
+	}
+}
+
 //checkFatalDbError checks if the error returned from DB
 //is fatal and stores it. This error will be returned
 //to caller on next DB operation
@@ -856,6 +929,11 @@ type memdbSnapshotInfo struct {
 	Version    int
 	InstId     common.IndexInstId
 	PartnId    common.PartitionId
+
+	// Delta snapshots are restored on top of the full snapshot Base,
+	// followed by the delta snapshots Deltas, in order.
+	Base   string   `json:",omitempty"`
+	Deltas []string `json:",omitempty"`
 }
 
 type memdbSnapshot struct {
@@ -932,6 +1010,7 @@ func (mdb *memdbSlice) doPersistSnapshot(s *memdbSnapshot) {
 		if total > 0 {
 			concurrency = int(math.Ceil(float64(maxThreads) * float64(indexCount) / float64(total)))
 		}
+		maxDeltas := mdb.sysconf["settings.moi.persistence.max_delta_snapshots"].Int()
 
 		mdb.confLock.RUnlock()
 
@@ -953,7 +1032,34 @@ func (mdb *memdbSlice) doPersistSnapshot(s *memdbSnapshot) {
 				<-moiWriterSemaphoreCh
 			}
 		}()
-		err := mdb.mainstore.StoreToDisk(tmpdir, s.info.MainSnap, concurrency, limitWriterThreads)
+
+		// Retain the snapshot as the base of the next delta snapshot.
+		// A full snapshot is persisted once max delta snapshots are
+		// chained to the base.
+		var retain bool // extra reference on the snapshot to be released
+		mdb.persistLock.Lock()
+		base, chain, gen := mdb.persistBase, mdb.persistChain, mdb.persistGen
+		if maxDeltas > 0 {
+			retain = s.info.MainSnap.Open()
+		} else if base != nil {
+			// Delta snapshots have been disabled
+			base.Close()
+			mdb.persistBase, mdb.persistChain = nil, nil
+		}
+		if maxDeltas == 0 || len(chain) > maxDeltas || (base != nil && !base.Open()) {
+			base = nil
+		}
+		mdb.persistLock.Unlock()
+
+		var err error
+		if base != nil {
+			s.info.Base, s.info.Deltas = chain[0], append([]string(nil), chain[1:]...)
+			err = mdb.mainstore.StoreIncrementalToDisk(tmpdir, s.info.MainSnap, base, concurrency, limitWriterThreads)
+			base.Close()
+		} else {
+			s.info.Base, s.info.Deltas = "", nil
+			err = mdb.mainstore.StoreToDisk(tmpdir, s.info.MainSnap, concurrency, limitWriterThreads)
+		}
 		if err == nil {
 			var fd *os.File
 			var bs []byte
@@ -981,11 +1087,18 @@ func (mdb *memdbSlice) doPersistSnapshot(s *memdbSnapshot) {
 			if err == nil {
 				err = os.Rename(tmpdir, dir)
 				if err == nil {
+					if retain && mdb.retainPersistBase(s.info.MainSnap, base != nil, filepath.Base(dir), gen) {
+						retain = false
+					}
 					mdb.cleanupOldSnapshotFiles(mdb.maxRollbacks)
 				}
 			}
 		}
 
+		if retain {
+			s.info.MainSnap.Close()
+		}
+
 		if err == nil {
 			dur := time.Since(t0)
 			logging.Infof("MemDBSlice Slice Id %v, Threads %d, IndexInstId %v, PartitionId %v created ondisk"+
@@ -1004,19 +1117,127 @@ func (mdb *memdbSlice) doPersistSnapshot(s *memdbSnapshot) {
 	}
 }
 
+// retainPersistBase keeps snap open as the base of the next delta
+// snapshot, persisted in dir. Returns false if snap is not retained
+// because the stores were reset after the persistor started.
+func (mdb *memdbSlice) retainPersistBase(snap *memdb.Snapshot, isDelta bool,
+	dir string, gen uint64) bool {
+
+	mdb.persistLock.Lock()
+	defer mdb.persistLock.Unlock()
+
+	if gen != mdb.persistGen {
+		return false
+	}
+
+	if mdb.persistBase != nil {
+		mdb.persistBase.Close()
+	}
+	mdb.persistBase = snap
+	if isDelta {
+		mdb.persistChain = append(mdb.persistChain, dir)
+	} else {
+		mdb.persistChain = []string{dir}
+	}
+	return true
+}
+
+// releasePersistBase must be called before closing the mainstore,
+// which otherwise waits for the retained snapshot to be closed.
+func (mdb *memdbSlice) releasePersistBase() {
+	mdb.persistLock.Lock()
+	defer mdb.persistLock.Unlock()
+
+	if mdb.persistBase != nil {
+		mdb.persistBase.Close()
+	}
+	mdb.persistBase = nil
+	mdb.persistChain = nil
+	mdb.persistGen++
+}
+
 func (mdb *memdbSlice) cleanupOldSnapshotFiles(keepn int) {
 	manifests := mdb.getSnapshotManifests()
 	if len(manifests) > keepn {
 		toRemove := len(manifests) - keepn
+
+		// Delta snapshots being kept need their full snapshot and
+		// the delta snapshots they are restored on top of
+		required := make(map[string]bool)
+		for _, m := range manifests[toRemove:] {
+			if info, err := readSnapshotManifest(m); err == nil && info.Base != "" {
+				required[info.Base] = true
+				for _, delta := range info.Deltas {
+					required[delta] = true
+				}
+			}
+		}
+
 		manifests = manifests[:toRemove]
 		for _, m := range manifests {
 			dir := filepath.Dir(m)
+			if required[filepath.Base(dir)] {
+				continue
+			}
 			logging.Infof("MemDBSlice Removing disk snapshot %v", dir)
 			os.RemoveAll(dir)
 		}
 	}
 }
 
+//Backup copies the disk snapshot files of the latest snapshot to dir.
+//The persistor is held for the duration, so that no snapshot is
+//written or cleaned up while the files are copied.
+func (mdb *memdbSlice) Backup(dir string) (SnapshotInfo, error) {
+
+	for !atomic.CompareAndSwapInt32(&mdb.isPersistorActive, 0, 1) {
+		time.Sleep(time.Second)
+	}
+	defer atomic.StoreInt32(&mdb.isPersistorActive, 0)
+
+	manifests := mdb.getSnapshotManifests()
+	if len(manifests) == 0 {
+		return nil, ErrNoSnapshotForBackup
+	}
+
+	info, err := readSnapshotManifest(manifests[len(manifests)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	// A delta snapshot is restored on top of its full snapshot and
+	// the delta snapshots before it
+	snapDirs := []string{filepath.Base(info.dataPath)}
+	if info.Base != "" {
+		snapDirs = append(snapDirs, info.Base)
+		snapDirs = append(snapDirs, info.Deltas...)
+	}
+
+	for _, snapDir := range snapDirs {
+		if err := common.CopyDir(filepath.Join(dir, snapDir), filepath.Join(mdb.path, snapDir)); err != nil {
+			return nil, err
+		}
+	}
+
+	logging.Infof("MemDBSlice::Backup Slice Id %v, IndexInstId %v, PartitionId %v backed up "+
+		"snapshot %v to %v", mdb.id, mdb.idxInstId, mdb.idxPartnId, info.dataPath, dir)
+
+	return info, nil
+}
+
+func readSnapshotManifest(f string) (*memdbSnapshotInfo, error) {
+	bs, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &memdbSnapshotInfo{dataPath: filepath.Dir(f)}
+	if err := json.Unmarshal(bs, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
 func (mdb *memdbSlice) diskSize() int64 {
 	var sz int64
 	snapdirs, _ := filepath.Glob(filepath.Join(mdb.path, "snapshot.*"))
@@ -1077,6 +1298,8 @@ func (mdb *memdbSlice) GetCommittedCount() uint64 {
 }
 
 func (mdb *memdbSlice) resetStores() {
+	mdb.releasePersistBase()
+
 	// This is blocking call if snap refcounts != 0
 	go mdb.mainstore.Close()
 	if !mdb.isPrimary {
@@ -1229,7 +1452,17 @@ func (mdb *memdbSlice) loadSnapshot(snapInfo *memdbSnapshotInfo) (err error) {
 	mdb.confLock.RUnlock()
 
 	var snap *memdb.Snapshot
-	snap, err = mdb.mainstore.LoadFromDisk(snapInfo.dataPath, concurrency, backIndexCallback)
+	if snapInfo.Base != "" {
+		var deltas []string
+		for _, delta := range snapInfo.Deltas {
+			deltas = append(deltas, filepath.Join(mdb.path, delta))
+		}
+		deltas = append(deltas, snapInfo.dataPath)
+		snap, err = mdb.mainstore.LoadIncrementalFromDisk(filepath.Join(mdb.path, snapInfo.Base),
+			deltas, concurrency, backIndexCallback)
+	} else {
+		snap, err = mdb.mainstore.LoadFromDisk(snapInfo.dataPath, concurrency, backIndexCallback)
+	}
 	if err == memdb.ErrCorruptSnapshot {
 		err = errStorageCorrupted
 		logging.Errorf("MemDBSlice::loadSnapshot Slice Id %v, IndexInstId %v failed to load snapshot %v error(%v).",
@@ -1529,6 +1762,7 @@ func tryDeletememdbSlice(mdb *memdbSlice) {
 }
 
 func tryClosememdbSlice(mdb *memdbSlice) {
+	mdb.releasePersistBase()
 	mdb.mainstore.Close()
 	if !mdb.isPrimary {
 		for i := 0; i < mdb.numWriters; i++ {
@@ -1639,6 +1873,10 @@ func (s *memdbSnapshot) Info() SnapshotInfo {
 	return s.info
 }
 
+func (s *memdbSnapshot) lookupBackIndex(docid []byte, stopch StopChannel) ([][]byte, error) {
+	return s.slice.lookupBackIndex(docid, stopch)
+}
+
 // ==============================
 // Snapshot reader implementation
 // ==============================
@@ -1827,6 +2065,13 @@ func (s *memdbSnapshot) Iterate(ctx IndexReaderContext, low, high IndexKey, incl
 	it := s.info.MainSnap.NewIterator()
 	defer it.Close()
 
+	defer func() {
+		if log := readerLogger(ctx); log.IsEnabled(logging.Debug) {
+			log.Debugf("MemDBSnapshot::Iterate Slice Id %v IndexInstId %v "+
+				"took %v (err=%v)", s.slice.id, s.slice.idxInstId, time.Since(t0), err)
+		}
+	}()
+
 	if low.Bytes() == nil {
 		it.SeekFirst()
 	} else {
@@ -1871,6 +2116,71 @@ loop:
 	return nil
 }
 
+func (s *memdbSnapshot) ReverseRange(ctx IndexReaderContext, low, high IndexKey, inclusion Inclusion,
+	callb EntryCallback) error {
+
+	var cmpFn CmpEntry
+	if s.isPrimary() {
+		cmpFn = compareExact
+	} else {
+		cmpFn = comparePrefix
+	}
+
+	return s.ReverseIterate(ctx, low, high, inclusion, cmpFn, callb)
+}
+
+func (s *memdbSnapshot) ReverseIterate(ctx IndexReaderContext, low, high IndexKey, inclusion Inclusion,
+	cmpFn CmpEntry, callback EntryCallback) error {
+	var entry IndexEntry
+	var err error
+	t0 := time.Now()
+	it := s.info.MainSnap.NewIterator()
+	defer it.Close()
+
+	defer func() {
+		if log := readerLogger(ctx); log.IsEnabled(logging.Debug) {
+			log.Debugf("MemDBSnapshot::ReverseIterate Slice Id %v IndexInstId %v "+
+				"took %v (err=%v)", s.slice.id, s.slice.idxInstId, time.Since(t0), err)
+		}
+	}()
+
+	if high.Bytes() == nil {
+		it.SeekLast()
+	} else {
+		// Position past the high key (and past its equal keys if high
+		// inclusion is requested), then step back into the range
+		it.Seek(high.Bytes())
+		if inclusion == Both || inclusion == High {
+			err = s.iterEqualKeys(high, it, cmpFn, nil)
+			if err != nil {
+				return err
+			}
+		}
+		it.Prev()
+	}
+	s.slice.idxStats.Timings.stNewIterator.Put(time.Since(t0))
+
+	for it.Valid() {
+		itm := it.Get()
+		s.newIndexEntry(itm, &entry)
+
+		// Iterator has reached past the low key, no need to scan further
+		r := cmpFn(low, entry)
+		if r > 0 || (r == 0 && (inclusion == Neither || inclusion == High)) {
+			break
+		}
+
+		err = callback(entry.Bytes())
+		if err != nil {
+			return err
+		}
+
+		it.Prev()
+	}
+
+	return nil
+}
+
 func (s *memdbSnapshot) isPrimary() bool {
 	return s.slice.isPrimary
 }
@@ -2044,3 +2354,8 @@ func getNodeItemSize(node *skiplist.Node) int {
 	item := (*memdb.Item)(node.Item())
 	return len(item.Bytes())
 }
+
+func getNodeItemBytes(node *skiplist.Node) []byte {
+	item := (*memdb.Item)(node.Item())
+	return item.Bytes()
+}
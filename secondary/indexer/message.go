@@ -39,6 +39,7 @@ const (
 	STREAM_READER_SHUTDOWN
 	STREAM_READER_CONN_ERROR
 	STREAM_READER_HWT
+	STREAM_READER_SYSTEM_EVENT
 
 	//MUTATION_MANAGER
 	MUT_MGR_PERSIST_MUTATION_QUEUE
@@ -71,6 +72,7 @@ const (
 	STORAGE_INDEX_MERGE_SNAPSHOT
 	STORAGE_INDEX_PRUNE_SNAPSHOT
 	STORAGE_UPDATE_SNAP_MAP
+	STORAGE_INDEX_BACKUP
 
 	//KVSender
 	KV_SENDER_SHUTDOWN
@@ -98,12 +100,15 @@ const (
 	CLUST_MGR_SET_LOCAL
 	CLUST_MGR_DEL_LOCAL
 	CLUST_MGR_DEL_BUCKET
+	CLUST_MGR_DEL_COLLECTION
 	CLUST_MGR_INDEXER_READY
 	CLUST_MGR_REBALANCE_RUNNING
 	CLUST_MGR_CLEANUP_INDEX
 	CLUST_MGR_CLEANUP_PARTITION
 	CLUST_MGR_MERGE_PARTITION
 	CLUST_MGR_PRUNE_PARTITION
+	CLUST_MGR_PAUSE_INDEX
+	CLUST_MGR_UPDATE_AGGREGATES
 
 	//CBQ_BRIDGE_SHUTDOWN
 	CBQ_BRIDGE_SHUTDOWN
@@ -136,6 +141,7 @@ const (
 	INDEXER_ABORT_RECOVERY
 	INDEXER_STORAGE_WARMUP_DONE
 	INDEXER_SECURITY_CHANGE
+	INDEXER_RESTORE_INDEX_DATA
 
 	//SCAN COORDINATOR
 	SCAN_COORD_SHUTDOWN
@@ -1077,6 +1083,80 @@ func (m *MsgClustMgrPrunePartition) GetString() string {
 	return str
 }
 
+// CLUST_MGR_PAUSE_INDEX
+type MsgClustMgrPauseIndex struct {
+	instId common.IndexInstId
+	pause  bool
+	reqCtx *common.MetadataRequestContext
+	respCh MsgChannel
+}
+
+func (m *MsgClustMgrPauseIndex) GetMsgType() MsgType {
+	return CLUST_MGR_PAUSE_INDEX
+}
+
+func (m *MsgClustMgrPauseIndex) GetInstId() common.IndexInstId {
+	return m.instId
+}
+
+func (m *MsgClustMgrPauseIndex) GetPause() bool {
+	return m.pause
+}
+
+func (m *MsgClustMgrPauseIndex) GetRequestCtx() *common.MetadataRequestContext {
+	return m.reqCtx
+}
+
+func (m *MsgClustMgrPauseIndex) GetRespCh() MsgChannel {
+	return m.respCh
+}
+
+func (m *MsgClustMgrPauseIndex) GetString() string {
+
+	str := "\n\tMessage: MsgClustMgrPauseIndex"
+	str += fmt.Sprintf("\n\tType: %v", CLUST_MGR_PAUSE_INDEX)
+	str += fmt.Sprintf("\n\tinst Id: %v", m.instId)
+	str += fmt.Sprintf("\n\tpause: %v", m.pause)
+	return str
+}
+
+// CLUST_MGR_UPDATE_AGGREGATES
+type MsgClustMgrUpdateAggregates struct {
+	instId     common.IndexInstId
+	aggregates []common.AggregateDefn
+	reqCtx     *common.MetadataRequestContext
+	respCh     MsgChannel
+}
+
+func (m *MsgClustMgrUpdateAggregates) GetMsgType() MsgType {
+	return CLUST_MGR_UPDATE_AGGREGATES
+}
+
+func (m *MsgClustMgrUpdateAggregates) GetInstId() common.IndexInstId {
+	return m.instId
+}
+
+func (m *MsgClustMgrUpdateAggregates) GetAggregates() []common.AggregateDefn {
+	return m.aggregates
+}
+
+func (m *MsgClustMgrUpdateAggregates) GetRequestCtx() *common.MetadataRequestContext {
+	return m.reqCtx
+}
+
+func (m *MsgClustMgrUpdateAggregates) GetRespCh() MsgChannel {
+	return m.respCh
+}
+
+func (m *MsgClustMgrUpdateAggregates) GetString() string {
+
+	str := "\n\tMessage: MsgClustMgrUpdateAggregates"
+	str += fmt.Sprintf("\n\tType: %v", CLUST_MGR_UPDATE_AGGREGATES)
+	str += fmt.Sprintf("\n\tinst Id: %v", m.instId)
+	str += fmt.Sprintf("\n\taggregates: %v", m.aggregates)
+	return str
+}
+
 // INDEXER_CANCEL_MERGE_PARTITION
 //CLUST_MGR_BUILD_INDEX_DDL
 type MsgBuildIndex struct {
@@ -1173,6 +1253,55 @@ func (m *MsgDropIndex) GetString() string {
 	return str
 }
 
+//STREAM_READER_SYSTEM_EVENT
+type MsgStreamSystemEvent struct {
+	streamId     common.StreamId
+	meta         *MutationMeta
+	eventType    uint32
+	manifestUID  uint64
+	scopeId      uint32
+	collectionId uint32
+}
+
+func (m *MsgStreamSystemEvent) GetMsgType() MsgType {
+	return STREAM_READER_SYSTEM_EVENT
+}
+
+func (m *MsgStreamSystemEvent) GetStreamId() common.StreamId {
+	return m.streamId
+}
+
+func (m *MsgStreamSystemEvent) GetMutationMeta() *MutationMeta {
+	return m.meta
+}
+
+func (m *MsgStreamSystemEvent) GetEventType() uint32 {
+	return m.eventType
+}
+
+func (m *MsgStreamSystemEvent) GetManifestUID() uint64 {
+	return m.manifestUID
+}
+
+func (m *MsgStreamSystemEvent) GetScopeId() uint32 {
+	return m.scopeId
+}
+
+func (m *MsgStreamSystemEvent) GetCollectionId() uint32 {
+	return m.collectionId
+}
+
+func (m *MsgStreamSystemEvent) String() string {
+	str := "\n\tMessage: MsgStreamSystemEvent"
+	str += fmt.Sprintf("\n\tStreamId: %v", m.streamId)
+	str += fmt.Sprintf("\n\tMeta: %v", m.meta)
+	str += fmt.Sprintf("\n\tEventType: %v", m.eventType)
+	str += fmt.Sprintf("\n\tManifestUID: %x", m.manifestUID)
+	str += fmt.Sprintf("\n\tScopeId: %x", m.scopeId)
+	str += fmt.Sprintf("\n\tCollectionId: %x", m.collectionId)
+	return str
+}
+
 //TK_GET_BUCKET_HWT
 //STREAM_READER_HWT
 type MsgBucketHWT struct {
@@ -1647,6 +1776,34 @@ func (m *MsgIndexCompact) GetMinFrag() int {
 	return m.minFrag
 }
 
+//STORAGE_INDEX_BACKUP
+type MsgIndexBackup struct {
+	bucket string
+	dir    string
+	respch chan []*indexBackupEntry
+	errch  chan error
+}
+
+func (m *MsgIndexBackup) GetMsgType() MsgType {
+	return STORAGE_INDEX_BACKUP
+}
+
+func (m *MsgIndexBackup) GetBucket() string {
+	return m.bucket
+}
+
+func (m *MsgIndexBackup) GetDir() string {
+	return m.dir
+}
+
+func (m *MsgIndexBackup) GetReplyChannel() chan []*indexBackupEntry {
+	return m.respch
+}
+
+func (m *MsgIndexBackup) GetErrorChannel() chan error {
+	return m.errch
+}
+
 //KV_STREAM_REPAIR
 type MsgKVStreamRepair struct {
 	streamId  common.StreamId
@@ -1699,6 +1856,7 @@ type MsgClustMgrUpdate struct {
 	indexList     []common.IndexInst
 	updatedFields MetaUpdateFields
 	bucket        string
+	collectionId  string
 	streamId      common.StreamId
 	syncUpdate    bool
 	respCh        chan error
@@ -1720,6 +1878,10 @@ func (m *MsgClustMgrUpdate) GetBucket() string {
 	return m.bucket
 }
 
+func (m *MsgClustMgrUpdate) GetCollectionId() string {
+	return m.collectionId
+}
+
 func (m *MsgClustMgrUpdate) GetStreamId() common.StreamId {
 	return m.streamId
 }
@@ -1822,6 +1984,44 @@ func (m *MsgSecurityChange) RefreshEncrypt() bool {
 	return m.refreshEncrypt
 }
 
+//INDEXER_RESTORE_INDEX_DATA
+type MsgIndexRestore struct {
+	bucket     string
+	dir        string
+	entries    []*indexBackupEntry
+	importData bool
+	respch     chan []*indexRestoreStatus
+	errch      chan error
+}
+
+func (m *MsgIndexRestore) GetMsgType() MsgType {
+	return INDEXER_RESTORE_INDEX_DATA
+}
+
+func (m *MsgIndexRestore) GetBucket() string {
+	return m.bucket
+}
+
+func (m *MsgIndexRestore) GetDir() string {
+	return m.dir
+}
+
+func (m *MsgIndexRestore) GetEntries() []*indexBackupEntry {
+	return m.entries
+}
+
+func (m *MsgIndexRestore) GetImportData() bool {
+	return m.importData
+}
+
+func (m *MsgIndexRestore) GetReplyChannel() chan []*indexRestoreStatus {
+	return m.respch
+}
+
+func (m *MsgIndexRestore) GetErrorChannel() chan error {
+	return m.errch
+}
+
 //STATS_PERSISTER_START
 //STATS_PERSISTER_STOP
 //STATS_PERSISTER_FORCE_PERSIST
@@ -1963,6 +2163,8 @@ func (m MsgType) String() string {
 		return "STREAM_READER_CONN_ERROR"
 	case STREAM_READER_HWT:
 		return "STREAM_READER_HWT"
+	case STREAM_READER_SYSTEM_EVENT:
+		return "STREAM_READER_SYSTEM_EVENT"
 
 	case MUT_MGR_PERSIST_MUTATION_QUEUE:
 		return "MUT_MGR_PERSIST_MUTATION_QUEUE"
@@ -2068,6 +2270,8 @@ func (m MsgType) String() string {
 		return "INDEXER_CANCEL_MERGE_PARTITION"
 	case INDEXER_STORAGE_WARMUP_DONE:
 		return "INDEXER_STORAGE_WARMUP_DONE"
+	case INDEXER_RESTORE_INDEX_DATA:
+		return "INDEXER_RESTORE_INDEX_DATA"
 
 	case SCAN_COORD_SHUTDOWN:
 		return "SCAN_COORD_SHUTDOWN"
@@ -2121,6 +2325,8 @@ func (m MsgType) String() string {
 		return "CLUST_MGR_DEL_LOCAL"
 	case CLUST_MGR_DEL_BUCKET:
 		return "CLUST_MGR_DEL_BUCKET"
+	case CLUST_MGR_DEL_COLLECTION:
+		return "CLUST_MGR_DEL_COLLECTION"
 	case CLUST_MGR_INDEXER_READY:
 		return "CLUST_MGR_INDEXER_READY"
 	case CLUST_MGR_REBALANCE_RUNNING:
@@ -2133,6 +2339,10 @@ func (m MsgType) String() string {
 		return "CLUST_MGR_MERGE_PARTITION"
 	case CLUST_MGR_PRUNE_PARTITION:
 		return "CLUST_MGR_PRUNE_PARTITION"
+	case CLUST_MGR_PAUSE_INDEX:
+		return "CLUST_MGR_PAUSE_INDEX"
+	case CLUST_MGR_UPDATE_AGGREGATES:
+		return "CLUST_MGR_UPDATE_AGGREGATES"
 
 	case CBQ_CREATE_INDEX_DDL:
 		return "CBQ_CREATE_INDEX_DDL"
@@ -2153,6 +2363,8 @@ func (m MsgType) String() string {
 		return "STORAGE_INDEX_PRUNE_SNAPSHOT"
 	case STORAGE_UPDATE_SNAP_MAP:
 		return "STORAGE_UPDATE_SNAP_MAP"
+	case STORAGE_INDEX_BACKUP:
+		return "STORAGE_INDEX_BACKUP"
 
 	case CONFIG_SETTINGS_UPDATE:
 		return "CONFIG_SETTINGS_UPDATE"
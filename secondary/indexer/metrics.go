@@ -0,0 +1,196 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/stats"
+)
+
+//
+// /metrics exports the indexer stats in the Prometheus text format.
+// Stats of an index are labelled by bucket, index and replica, and
+// the stats kept per partition (e.g. items_count, data_size) also by
+// partition. Durations are in seconds.
+//
+
+func (s *statsManager) handleMetricsReq(w http.ResponseWriter, r *http.Request) {
+	_, valid, _ := common.IsAuthValid(r)
+	if !valid {
+		w.WriteHeader(401)
+		w.Write([]byte("401 Unauthorized"))
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(400)
+		w.Write([]byte("Unsupported method"))
+		return
+	}
+
+	is := s.stats.Get()
+	if common.IndexerState(is.indexerState.Value()) != common.INDEXER_BOOTSTRAP {
+		s.tryUpdateStats(false)
+	}
+
+	m := stats.NewPromMetrics()
+	is.addMetrics(m)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(200)
+	if _, err := m.WriteTo(w); err != nil {
+		logging.Errorf("statsManager::handleMetricsReq Error %v", err)
+	}
+}
+
+func (is *IndexerStats) addMetrics(m *stats.PromMetrics) {
+
+	m.Gauge("index_memory_quota_bytes", "Memory quota of the indexer",
+		nil, float64(is.memoryQuota.Value()))
+	m.Gauge("index_memory_used_bytes", "Memory used by the indexer",
+		nil, float64(is.memoryUsed.Value()))
+	m.Gauge("index_memory_used_storage_bytes", "Memory used by the storage engine",
+		nil, float64(is.memoryUsedStorage.Value()))
+	m.Gauge("index_memory_total_storage_bytes", "Memory allocated by the storage engine",
+		nil, float64(is.memoryTotalStorage.Value()))
+	m.Gauge("index_memory_used_queue_bytes", "Memory used by the mutation queues",
+		nil, float64(is.memoryUsedQueue.Value()))
+	m.Gauge("index_memory_rss_bytes", "Resident set size of the indexer process",
+		nil, float64(getRSS()))
+	m.Gauge("index_cpu_utilization", "CPU utilization of the indexer process in percent",
+		nil, getCpuPercent())
+	m.Gauge("index_num_connections", "Open query connections",
+		nil, float64(is.numConnections.Value()))
+	m.Counter("index_queryport_bytes_uncompressed_total", "Bytes sent to queryport clients before compression",
+		nil, float64(is.qpUncompressed.Value()))
+	m.Counter("index_queryport_bytes_compressed_total", "Bytes sent to queryport clients after compression",
+		nil, float64(is.qpCompressed.Value()))
+	m.Counter("index_not_found_errors_total", "Scans of an index not found on the indexer",
+		nil, float64(is.notFoundError.Value()))
+	m.Counter("index_tls_handshakes_total", "TLS handshakes on queryport and dataport",
+		nil, float64(is.tlsHandshakes.Value()))
+	tlsFailures := []struct {
+		reason string
+		stat   *stats.Int64Val
+	}{
+		{"no_certificate", &is.tlsNoCertificate},
+		{"bad_certificate", &is.tlsBadCertificate},
+		{"identity_rejected", &is.tlsIdentityRejected},
+		{"other", &is.tlsHandshakeErrors},
+	}
+	for _, f := range tlsFailures {
+		m.Counter("index_tls_handshake_failures_total", "Failed TLS handshakes on queryport and dataport",
+			stats.PromLabels{"reason": f.reason}, float64(f.stat.Value()))
+	}
+	m.Gauge("index_state", "State of the indexer",
+		stats.PromLabels{"state": fmt.Sprintf("%v", common.IndexerState(is.indexerState.Value()))}, 1)
+
+	for _, b := range is.buckets {
+		labels := stats.PromLabels{"bucket": b.bucket}
+
+		m.Counter("index_bucket_rollbacks_total", "Rollbacks of the bucket streams",
+			labels, float64(b.numRollbacks.Value()))
+		m.Gauge("index_bucket_mutation_queue_size", "Mutations in the mutation queue",
+			labels, float64(b.mutationQueueSize.Value()))
+		m.Gauge("index_bucket_mutations_queued", "Mutations queued for flush",
+			labels, float64(b.numMutationsQueued.Value()))
+		m.Gauge("index_bucket_ts_queue_size", "Stability timestamps waiting to be flushed",
+			labels, float64(b.tsQueueSize.Value()))
+		m.Counter("index_bucket_nonalign_ts_total", "Stability timestamps not aligned to snapshots",
+			labels, float64(b.numNonAlignTS.Value()))
+
+		for _, stream := range []struct {
+			name   string
+			status stats.Int64Val
+			lag    stats.Int64Val
+		}{
+			{"MAINT_STREAM", b.maintStreamStatus, b.maintFlushLag},
+			{"INIT_STREAM", b.initStreamStatus, b.initFlushLag},
+		} {
+			streamLabels := stats.PromLabels{"bucket": b.bucket, "stream": stream.name}
+			m.Gauge("index_bucket_stream_active", "Stream of the bucket is active",
+				streamLabels, boolMetric(StreamStatus(stream.status.Value()) == STREAM_ACTIVE))
+			m.Gauge("index_bucket_stream_flush_lag", "Mutations received but not yet flushed",
+				streamLabels, float64(stream.lag.Value()))
+		}
+	}
+
+	for _, s := range is.indexes {
+		labels := stats.PromLabels{
+			"bucket":  s.bucket,
+			"index":   s.name,
+			"replica": fmt.Sprintf("%v", s.replicaId),
+		}
+
+		m.Counter("index_scan_requests_total", "Scan requests",
+			labels, float64(s.numRequests.Value()))
+		m.Counter("index_scan_rows_returned_total", "Rows returned by scans",
+			labels, float64(s.numRowsReturned.Value()))
+		m.Counter("index_scan_rows_scanned_total", "Rows scanned by scans",
+			labels, float64(s.numRowsScanned.Value()))
+		m.Counter("index_scan_bytes_read_total", "Bytes read by scans",
+			labels, float64(s.scanBytesRead.Value()))
+		m.Counter("index_scan_timeouts_total", "Scans that timed out",
+			labels, float64(s.numScanTimeouts.Value()))
+		m.Counter("index_scan_errors_total", "Scans that failed",
+			labels, float64(s.numScanErrors.Value()))
+		m.Counter("index_scan_duration_seconds_total", "Time spent in scans",
+			labels, float64(s.scanDuration.Value())/1e9)
+		m.Gauge("index_avg_scan_latency_seconds", "Average scan latency",
+			labels, float64(s.avgScanLatency.Value())/1e9)
+		m.Histogram("index_scan_latency_seconds", "Latency of scans",
+			labels, &s.scanLatencyDist, 1e-9)
+		m.Gauge("index_docs_pending", "Mutations in KV not yet received",
+			labels, float64(s.numDocsPending.Value()))
+		m.Gauge("index_docs_queued", "Mutations received but not yet flushed",
+			labels, float64(s.numDocsQueued.Value()))
+		m.Gauge("index_build_progress", "Initial build progress in percent",
+			labels, float64(s.buildProgress.Value()))
+
+		for partnId, ps := range s.partitions {
+			partnLabels := stats.PromLabels{
+				"bucket":    s.bucket,
+				"index":     s.name,
+				"replica":   fmt.Sprintf("%v", s.replicaId),
+				"partition": fmt.Sprintf("%v", partnId),
+			}
+
+			m.Gauge("index_items_count", "Items in the index",
+				partnLabels, float64(ps.itemsCount.Value()))
+			m.Gauge("index_data_size_bytes", "Size of the data in the index",
+				partnLabels, float64(ps.dataSize.Value()))
+			m.Gauge("index_disk_size_bytes", "Size of the index on disk",
+				partnLabels, float64(ps.diskSize.Value()))
+			m.Gauge("index_frag_percent", "Fragmentation of the index on disk",
+				partnLabels, float64(ps.fragPercent.Value()))
+			m.Gauge("index_resident_percent", "Index data resident in memory",
+				partnLabels, float64(ps.residentPercent.Value()))
+			m.Counter("index_docs_indexed_total", "Documents indexed",
+				partnLabels, float64(ps.numDocsIndexed.Value()))
+			m.Counter("index_items_flushed_total", "Items flushed to the index",
+				partnLabels, float64(ps.numItemsFlushed.Value()))
+			m.Counter("index_cache_hits_total", "Storage cache hits",
+				partnLabels, float64(ps.cacheHits.Value()))
+			m.Counter("index_cache_misses_total", "Storage cache misses",
+				partnLabels, float64(ps.cacheMisses.Value()))
+		}
+	}
+}
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
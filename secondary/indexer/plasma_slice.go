@@ -95,6 +95,10 @@ type plasmaSlice struct {
 
 	isPersistorActive int32
 
+	// log cleaning relocates data in the store files being copied
+	// by backup
+	backupLock sync.Mutex
+
 	lastRollbackTs *common.TsVbuuid
 
 	// Array processing
@@ -710,6 +714,7 @@ func (mdb *plasmaSlice) insertSecIndex(key []byte, docid []byte, workerId int, i
 		defer mdb.back[workerId].End()
 
 		mdb.main[workerId].InsertKV(entry, nil)
+		materializedAggrs.update(mdb.idxInstId, mdb.idxPartnId, nil, entry)
 		// entry2BackEntry overwrites the buffer to remove docid
 		backEntry := entry2BackEntry(entry)
 		mdb.back[workerId].InsertKV(docid, backEntry)
@@ -1053,6 +1058,7 @@ func (mdb *plasmaSlice) deleteSecIndex(docid []byte, compareKey []byte, workerId
 		entry := backEntry2entry(docid, backEntry, buf, mdb.keySzConf[workerId])
 		entrySz := len(entry)
 		mdb.main[workerId].DeleteKV(entry)
+		materializedAggrs.update(mdb.idxInstId, mdb.idxPartnId, entry, nil)
 		mdb.idxStats.Timings.stKVDelete.Put(time.Since(t0))
 
 		mdb.idxStats.dataSize.Add(0 - int64(len(docid)+len(backEntry)+entrySz))
@@ -1339,6 +1345,70 @@ func (mdb *plasmaSlice) doPersistSnapshot(s *plasmaSnapshot) {
 	}
 }
 
+//Backup copies the store files with the latest recovery point to dir.
+//The persistor is held, so that no recovery point is created or
+//removed, and compaction waits for the backup to complete. Automatic
+//log cleaning is paused for the duration.
+func (mdb *plasmaSlice) Backup(dir string) (SnapshotInfo, error) {
+
+	mdb.backupLock.Lock()
+	defer mdb.backupLock.Unlock()
+
+	defer mdb.pauseLSSCleaning()()
+
+	for !atomic.CompareAndSwapInt32(&mdb.isPersistorActive, 0, 1) {
+		time.Sleep(time.Second)
+	}
+	defer atomic.StoreInt32(&mdb.isPersistorActive, 0)
+
+	infos, err := mdb.GetSnapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	info := NewSnapshotInfoContainer(infos).GetLatest()
+	if info == nil {
+		return nil, ErrNoSnapshotForBackup
+	}
+
+	if err := copyDirPrefix(dir, mdb.path); err != nil {
+		return nil, err
+	}
+
+	logging.Infof("plasmaSlice::Backup Slice Id %v, IndexInstId %v, PartitionId %v backed up "+
+		"recovery point %v to %v", mdb.id, mdb.idxInstId, mdb.idxPartnId, info, dir)
+
+	return info, nil
+}
+
+//pauseLSSCleaning turns off automatic log cleaning of the stores, which
+//relocates data and frees the head of the log, and returns a function
+//to turn it back on. The cleaner checks the setting before every pass.
+func (mdb *plasmaSlice) pauseLSSCleaning() func() {
+
+	mdb.confLock.Lock()
+	defer mdb.confLock.Unlock()
+
+	mainAuto := mdb.mainstore.AutoLSSCleaning
+	mdb.mainstore.AutoLSSCleaning = false
+
+	backAuto := false
+	if !mdb.isPrimary && mdb.backstore != nil {
+		backAuto = mdb.backstore.AutoLSSCleaning
+		mdb.backstore.AutoLSSCleaning = false
+	}
+
+	return func() {
+		mdb.confLock.Lock()
+		defer mdb.confLock.Unlock()
+
+		mdb.mainstore.AutoLSSCleaning = mainAuto
+		if !mdb.isPrimary && mdb.backstore != nil {
+			mdb.backstore.AutoLSSCleaning = backAuto
+		}
+	}
+}
+
 func (mdb *plasmaSlice) GetSnapshots() ([]SnapshotInfo, error) {
 	var mRPs, bRPs []*plasma.RecoveryPoint
 	var minRP, maxRP []byte
@@ -1794,6 +1864,9 @@ func (mdb *plasmaSlice) Compact(abortTime time.Time, minFrag int) error {
 	mdb.SetCompacting(true)
 	defer mdb.SetCompacting(false)
 
+	mdb.backupLock.Lock()
+	defer mdb.backupLock.Unlock()
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -2285,6 +2358,8 @@ func (s *plasmaSnapshot) Iterate(ctx IndexReaderContext, low, high IndexKey, inc
 
 	// Snapshot became invalid due to rollback
 	if err == plasma.ErrInvalidSnapshot {
+		reader.Logger().Infof("plasmaSnapshot:Iterate Slice Id %v IndexInstId %v "+
+			"snapshot invalidated by rollback", s.slice.id, s.slice.idxInstId)
 		return ErrIndexRollback
 	}
 
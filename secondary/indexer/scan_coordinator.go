@@ -25,6 +25,8 @@ import (
 	p "github.com/couchbase/indexing/secondary/pipeline"
 	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
 	"github.com/couchbase/indexing/secondary/queryport"
+	"github.com/couchbase/indexing/secondary/security"
+	"github.com/couchbase/indexing/secondary/transport"
 	"github.com/golang/protobuf/proto"
 )
 
@@ -36,6 +38,7 @@ var (
 	ErrUnsupportedRequest = errors.New("Unsupported query request")
 	ErrVbuuidMismatch     = errors.New("Mismatch in session vbuuids")
 	ErrNotMyPartition     = errors.New("Not my partition")
+	ErrReverseScanLimit   = errors.New("Reverse scan exceeds indexer.settings.scan_reverse_buffer_limit")
 )
 
 const DECODE_ERR_THRESHOLD = 100
@@ -43,6 +46,7 @@ const DECODE_ERR_THRESHOLD = 100
 var secKeyBufPool *common.BytesBufPool
 
 type ScanCoordinator interface {
+	RegisterRestEndpoints()
 }
 
 type scanCoordinator struct {
@@ -66,6 +70,12 @@ type scanCoordinator struct {
 
 	stats IndexerStatsHolder
 
+	statsCache *indexStatsCache // index statistics for query planner
+
+	snapLeases *snapshotLeaseContainer // snapshots pinned by clients
+
+	slowScans *slowScanLog // profiles of recent slow scans
+
 	indexerState atomic.Value
 
 	numDecodeErrors uint32 // Number of errors in collatejson decode.
@@ -88,6 +98,9 @@ func NewScanCoordinator(supvCmdch MsgChannel, supvMsgch MsgChannel,
 		snapshotNotifych: snapshotNotifych,
 		logPrefix:        "ScanCoordinator",
 		reqCounter:       0,
+		statsCache:       newIndexStatsCache(),
+		snapLeases:       newSnapshotLeaseContainer(),
+		slowScans:        newSlowScanLog(config["settings.slow_scan_log_size"].Int()),
 	}
 
 	s.config.Store(config)
@@ -127,6 +140,7 @@ loop:
 				if cmd.GetMsgType() == SCAN_COORD_SHUTDOWN {
 					logging.Infof("ScanCoordinator: Shutting Down")
 					s.serv.Close()
+					s.snapLeases.close()
 					s.supvCmdch <- &MsgSuccess{}
 					break loop
 				}
@@ -230,6 +244,9 @@ func (s *scanCoordinator) serverCallback(protoReq interface{}, ctx interface{},
 	if req.ScanType == HeloReq {
 		s.handleHeloRequest(req, w)
 		return
+	} else if req.ScanType == CloseSnapshotReq {
+		s.handleCloseSnapshotRequest(req, w)
+		return
 	}
 
 	logging.LazyVerbose(func() string {
@@ -261,6 +278,11 @@ func (s *scanCoordinator) serverCallback(protoReq interface{}, ctx interface{},
 		return
 	}
 
+	if req.ScanType == OpenSnapshotReq {
+		s.handleOpenSnapshotRequest(req, w)
+		return
+	}
+
 	if req.Stats != nil {
 		req.Stats.scanReqInitDuration.Add(time.Now().Sub(ttime).Nanoseconds())
 
@@ -283,7 +305,7 @@ func (s *scanCoordinator) serverCallback(protoReq interface{}, ctx interface{},
 	}
 
 	t0 := time.Now()
-	is, err := s.getRequestedIndexSnapshot(req)
+	is, err := s.getScanSnapshot(req)
 	if err == common.ErrScanTimedOut && req.Stats != nil {
 		req.Stats.numScanTimeouts.Add(1)
 	}
@@ -386,17 +408,72 @@ func (s *scanCoordinator) processRequest(req *ScanRequest, w ScanResponseWriter,
 		s.handleStatsRequest(req, w, is)
 	case FastCountReq:
 		s.handleFastCountRequest(req, w, is, t0)
+	case DocIdLookupReq:
+		s.handleDocIdLookupRequest(req, w, is, t0)
+	case LeadKeyHistogramReq:
+		s.handleLeadKeyHistogramRequest(req, w, is)
 	}
 }
 
 func (s *scanCoordinator) handleHeloRequest(req *ScanRequest, w ScanResponseWriter) {
-	err := w.Helo()
+	var compressions []uint32
+	if s.config.Load()["queryport.allowCompression"].Bool() {
+		for _, compression := range transport.Compressions {
+			compressions = append(compressions, uint32(compression))
+		}
+	}
+	err := w.Helo(compressions)
 	s.handleError(req.LogPrefix, err)
 }
 
+// handleOpenSnapshotRequest pins a snapshot satisfying the requested
+// consistency and leases it to the client.
+func (s *scanCoordinator) handleOpenSnapshotRequest(req *ScanRequest, w ScanResponseWriter) {
+	cfg := s.config.Load()
+
+	lease := req.leaseTime
+	if lease <= 0 {
+		lease = int64(cfg["settings.scan_snapshot_lease_default"].Int())
+	}
+	if max := int64(cfg["settings.scan_snapshot_lease_max"].Int()); lease > max {
+		lease = max
+	}
+
+	is, err := s.getRequestedIndexSnapshot(req)
+	if s.tryRespondWithError(w, req, err) {
+		return
+	}
+
+	maxLeases := cfg["settings.scan_snapshot_max_leases"].Int()
+	id, err := s.snapLeases.add(req.IndexInstId, common.IndexDefnId(req.DefnID),
+		is, time.Duration(lease)*time.Millisecond, maxLeases)
+	if err != nil {
+		DestroyIndexSnapshot(is)
+		s.tryRespondWithError(w, req, err)
+		return
+	}
+
+	logging.Infof("%s snapshot lease %v opened for inst %v, lease %vms, timestamp: %s, requestId: %v",
+		req.LogPrefix, id, req.IndexInstId, lease, ScanTStoString(is.Timestamp()), req.RequestId)
+	s.handleError(req.LogPrefix, w.OpenSnapshot(id, lease))
+}
+
+func (s *scanCoordinator) handleCloseSnapshotRequest(req *ScanRequest, w ScanResponseWriter) {
+	err := s.snapLeases.release(req.SnapshotId, common.IndexDefnId(req.DefnID))
+	if err != nil {
+		s.handleError(req.LogPrefix, w.Error(err))
+		return
+	}
+
+	logging.Infof("%s snapshot lease %v closed, requestId: %v",
+		req.LogPrefix, req.SnapshotId, req.RequestId)
+	s.handleError(req.LogPrefix, w.CloseSnapshot())
+}
+
 func (s *scanCoordinator) handleScanRequest(req *ScanRequest, w ScanResponseWriter,
 	is IndexSnapshot, t0 time.Time) {
 	waitTime := time.Now().Sub(t0)
+	s.profileRequest(req, t0)
 
 	scanPipeline := NewScanPipeline(req, w, is, s.config.Load())
 	cancelCb := NewCancelCallback(req, func(e error) {
@@ -408,10 +485,19 @@ func (s *scanCoordinator) handleScanRequest(req *ScanRequest, w ScanResponseWrit
 	err := scanPipeline.Execute()
 	scanTime := time.Now().Sub(t0)
 
+	if req.profile != nil {
+		req.profile.setPipeline(req, scanPipeline)
+		s.finishProfile(req, err)
+		if req.Profile && err == nil {
+			s.handleError(req.LogPrefix, w.Profile(req.profile))
+		}
+	}
+
 	if req.Stats != nil {
 		req.Stats.numRowsReturned.Add(int64(scanPipeline.RowsReturned()))
 		req.Stats.scanBytesRead.Add(int64(scanPipeline.BytesRead()))
 		req.Stats.scanDuration.Add(scanTime.Nanoseconds())
+		req.Stats.scanLatencyDist.Add(scanTime.Nanoseconds())
 		req.Stats.scanWaitDuration.Add(waitTime.Nanoseconds())
 
 		if req.GroupAggr != nil {
@@ -571,9 +657,66 @@ func (s *scanCoordinator) handleFastCountRequest(req *ScanRequest, w ScanRespons
 
 }
 
+func (s *scanCoordinator) handleDocIdLookupRequest(req *ScanRequest, w ScanResponseWriter,
+	is IndexSnapshot, t0 time.Time) {
+	var rows uint64
+	var err error
+	var snapshots []SliceSnapshot
+	var tmp []byte
+
+	stopch := make(StopChannel)
+	cancelCb := NewCancelCallback(req, func(e error) {
+		err = e
+		close(stopch)
+	})
+	cancelCb.Run()
+	defer cancelCb.Done()
+
+	callb := func(entry []byte) error {
+		var sk, docid []byte
+		var err error
+
+		if len(entry)*3 > cap(tmp) {
+			tmp = make([]byte, len(entry)*3)
+		}
+
+		if req.isPrimary {
+			sk, docid, err = piSplitEntry(entry, tmp[:0])
+		} else if req.dataEncFmt == common.DATA_ENC_COLLATEJSON {
+			sk, docid, err = siSplitEntryCJson(entry)
+		} else if req.dataEncFmt == common.DATA_ENC_JSON {
+			sk, docid, _, err = siSplitEntry(entry, tmp[:0])
+		} else {
+			err = common.ErrUnexpectedDataEncFmt
+		}
+		if err != nil {
+			return err
+		}
+
+		rows++
+		return w.Row(docid, sk)
+	}
+
+	if snapshots, err = GetSliceSnapshots(is, req.PartitionIds); err == nil {
+		err = lookupDocIds(req, snapshots, stopch, callb)
+	}
+
+	if req.Stats != nil {
+		req.Stats.numRowsReturned.Add(int64(rows))
+		req.Stats.scanDuration.Add(time.Now().Sub(t0).Nanoseconds())
+	}
+
+	if s.tryRespondWithError(w, req, err) {
+		return
+	}
+
+	logging.Verbosef("%s RESPONSE docids:%d rows:%d status:ok", req.LogPrefix,
+		len(req.DocIds), rows)
+}
+
 func (s *scanCoordinator) handleStatsRequest(req *ScanRequest, w ScanResponseWriter,
 	is IndexSnapshot) {
-	var rows uint64
+	var stats *protobuf.IndexStatistics
 	var err error
 	var snapshots []SliceSnapshot
 
@@ -585,8 +728,13 @@ func (s *scanCoordinator) handleStatsRequest(req *ScanRequest, w ScanResponseWri
 	cancelCb.Run()
 	defer cancelCb.Done()
 
+	nbins := s.config.Load()["scan.statistics.numBins"].Int()
 	if snapshots, err = GetSliceSnapshots(is, req.PartitionIds); err == nil {
-		rows, err = scatterStats(req, snapshots, stopch)
+		if len(req.Keys) == 0 && req.Low.Bytes() == nil && req.High.Bytes() == nil {
+			stats, err = s.getIndexStatistics(req, snapshots, nbins, stopch)
+		} else {
+			stats, err = scatterStats(req, snapshots, nbins, stopch)
+		}
 	}
 
 	if s.tryRespondWithError(w, req, err) {
@@ -594,10 +742,43 @@ func (s *scanCoordinator) handleStatsRequest(req *ScanRequest, w ScanResponseWri
 	}
 
 	logging.Verbosef("%s RESPONSE status:ok", req.LogPrefix)
-	err = w.Stats(rows, 0, nil, nil)
+	err = w.Stats(stats)
 	s.handleError(req.LogPrefix, err)
 }
 
+// getIndexStatistics on full index, from cache if still current,
+// else compute them afresh by scanning the snapshots.
+func (s *scanCoordinator) getIndexStatistics(req *ScanRequest,
+	snapshots []SliceSnapshot, nbins int,
+	stopch StopChannel) (*protobuf.IndexStatistics, error) {
+
+	var count uint64
+	for _, snap := range snapshots {
+		cnt, err := snap.Snapshot().StatCountTotal()
+		if err != nil {
+			return nil, err
+		}
+		count += cnt
+	}
+
+	cfg := s.config.Load()
+	interval := time.Duration(cfg["scan.statistics.refreshInterval"].Int()) * time.Second
+	ratio := cfg["scan.statistics.refreshRatio"].Float64()
+
+	key := makeIndexStatsKey(req.IndexInstId, req.PartitionIds)
+	if stats := s.statsCache.get(key, count, nbins, interval, ratio); stats != nil {
+		return stats, nil
+	}
+
+	stats, err := scatterStats(req, snapshots, nbins, stopch)
+	if err != nil {
+		return nil, err
+	}
+	s.statsCache.put(key, count, nbins, stats)
+	logging.Verbosef("%s refreshed statistics, items:%v", req.LogPrefix, count)
+	return stats, nil
+}
+
 /////////////////////////////////////////////////////////////////////////
 //
 //  scan helpers
@@ -672,6 +853,15 @@ func (s *scanCoordinator) getRequestedIndexSnapshot(r *ScanRequest) (snap IndexS
 	return
 }
 
+// getScanSnapshot returns the snapshot leased to the client, if the request
+// refers to one, else a snapshot satisfying the requested consistency.
+func (s *scanCoordinator) getScanSnapshot(r *ScanRequest) (IndexSnapshot, error) {
+	if r.SnapshotId != 0 {
+		return s.snapLeases.get(r.SnapshotId, r.IndexInstId)
+	}
+	return s.getRequestedIndexSnapshot(r)
+}
+
 func readDeallocSnapshot(ch chan interface{}) {
 	msg := <-ch
 	if msg == nil {
@@ -761,7 +951,7 @@ func (s *scanCoordinator) respondWithError(conn net.Conn, req *ScanRequest, err
 	protoErr := &protobuf.Error{Error: proto.String(err.Error())}
 
 	switch req.ScanType {
-	case StatsReq:
+	case StatsReq, LeadKeyHistogramReq:
 		res = &protobuf.StatisticsResponse{
 			Err: protoErr,
 		}
@@ -769,10 +959,14 @@ func (s *scanCoordinator) respondWithError(conn net.Conn, req *ScanRequest, err
 		res = &protobuf.CountResponse{
 			Count: proto.Int64(0), Err: protoErr,
 		}
-	case ScanAllReq, ScanReq:
+	case ScanAllReq, ScanReq, DocIdLookupReq:
 		res = &protobuf.ResponseStream{
 			Err: protoErr,
 		}
+	case OpenSnapshotReq:
+		res = &protobuf.OpenSnapshotResponse{
+			Err: protoErr,
+		}
 	}
 
 	err2 := protobuf.EncodeAndWrite(conn, *buf, res)
@@ -847,6 +1041,15 @@ func (s *scanCoordinator) handleStats(cmd Message) {
 	stats := s.stats.Get()
 	st := s.serv.Statistics()
 	stats.numConnections.Set(st.Connections)
+	stats.qpUncompressed.Set(int64(st.BytesUncompressed))
+	stats.qpCompressed.Set(int64(st.BytesCompressed))
+
+	hs := security.GetHandshakeStats()
+	stats.tlsHandshakes.Set(int64(hs.Succeeded))
+	stats.tlsNoCertificate.Set(int64(hs.NoCertificate))
+	stats.tlsBadCertificate.Set(int64(hs.BadCertificate))
+	stats.tlsIdentityRejected.Set(int64(hs.IdentityRejected))
+	stats.tlsHandshakeErrors.Set(int64(hs.Other))
 
 	// Compute counts asynchronously and reply to stats request
 	go func() {
@@ -889,6 +1092,9 @@ func (s *scanCoordinator) handleUpdateIndexInstMap(cmd Message) {
 	indexInstMap := req.GetIndexInstMap()
 	s.stats.Set(req.GetStatsObject())
 	s.indexInstMap = common.CopyIndexInstMap(indexInstMap)
+	s.statsCache.prune(s.indexInstMap)
+	leadKeyHistograms.prune(s.indexInstMap)
+	s.snapLeases.prune(s.indexInstMap)
 
 	if len(req.GetRollbackTimes()) != 0 {
 		logging.Infof("ScanCoordinator::initialize rollback times on new index inst map: %v", req.GetRollbackTimes())
@@ -912,6 +1118,7 @@ func (s *scanCoordinator) handleUpdateIndexPartnMap(cmd Message) {
 func (s *scanCoordinator) handleConfigUpdate(cmd Message) {
 	cfgUpdate := cmd.(*MsgConfigUpdate)
 	s.config.Store(cfgUpdate.GetConfig())
+	s.slowScans.resize(cfgUpdate.GetConfig()["settings.slow_scan_log_size"].Int())
 	s.supvCmdch <- &MsgSuccess{}
 }
 
@@ -43,9 +43,11 @@ type ScanPipeline struct {
 	rowsReturned  uint64
 	bytesRead     uint64
 	rowsScanned   uint64
+	rowsFiltered  uint64
 	cacheHitRatio int
 	exprEvalDur   time.Duration
 	exprEvalNum   int64
+	aggrDur       time.Duration // measured only when profiling
 }
 
 func (p *ScanPipeline) Cancel(err error) {
@@ -68,6 +70,12 @@ func (p ScanPipeline) RowsScanned() uint64 {
 	return p.rowsScanned
 }
 
+// RowsFiltered returns the rows scanned but rejected by filters on
+// composite keys.
+func (p ScanPipeline) RowsFiltered() uint64 {
+	return p.rowsFiltered
+}
+
 func (p ScanPipeline) CacheHitRatio() int {
 	return p.cacheHitRatio
 }
@@ -80,6 +88,18 @@ func (p ScanPipeline) AvgExprEvalDur() time.Duration {
 	return time.Duration(0)
 }
 
+func (p ScanPipeline) ExprEvalDur() time.Duration {
+	return p.exprEvalDur
+}
+
+func (p ScanPipeline) ExprEvalNum() int64 {
+	return p.exprEvalNum
+}
+
+func (p ScanPipeline) AggrDur() time.Duration {
+	return p.aggrDur
+}
+
 func NewScanPipeline(req *ScanRequest, w ScanResponseWriter, is IndexSnapshot, cfg c.Config) *ScanPipeline {
 	scanPipeline := new(ScanPipeline)
 	scanPipeline.req = req
@@ -101,7 +121,7 @@ func NewScanPipeline(req *ScanRequest, w ScanResponseWriter, is IndexSnapshot, c
 	scanPipeline.object.AddSink("writer", wr)
 
 	if req.GroupAggr != nil {
-		scanPipeline.aggrRes = &aggrResult{}
+		scanPipeline.aggrRes = &aggrResult{partialState: req.GroupAggr.PartialAggrState}
 	}
 
 	return scanPipeline
@@ -129,7 +149,7 @@ func (s *IndexScanSource) Routine() error {
 
 	defer func() {
 		if r := recover(); r != nil {
-			l.Fatalf("IndexScanSource - panic detected while processing %s", s.p.req)
+			s.p.req.log.Fatalf("IndexScanSource - panic detected while processing %s", s.p.req)
 			l.Fatalf("%s", l.StackTraceAll())
 			panic(r)
 		}
@@ -229,6 +249,7 @@ func (s *IndexScanSource) Routine() error {
 		}
 
 		if skipRow {
+			s.p.rowsFiltered++
 			return nil
 		}
 
@@ -260,10 +281,17 @@ func (s *IndexScanSource) Routine() error {
 				}
 			}
 
+			var t0 time.Time
+			if r.profile != nil {
+				t0 = time.Now()
+			}
 			err = computeGroupAggr(ck, dk, count, docid, entry, (*buf)[:0], s.p.aggrRes, r.GroupAggr, cktmp, dktmp, &cachedEntry, s.p)
 			if err != nil {
 				return err
 			}
+			if r.profile != nil {
+				s.p.aggrDur += time.Since(t0)
+			}
 			count = 1 //reset count; count is used for aggregates computation
 		}
 
@@ -334,8 +362,23 @@ func (s *IndexScanSource) Routine() error {
 		}
 	}
 
+	// groups are projected from aggregates materialized with the index,
+	// without scanning it.
+	var materialized bool
+	if r.GroupAggr != nil {
+		var rows []*aggrRow
+		if rows, materialized = materializedRows(r, sliceSnapshots); materialized {
+			s.p.aggrRes.rows = rows
+		}
+	}
+
 loop:
-	for _, scan := range r.Scans {
+	for i := 0; i < len(r.Scans) && !materialized; i++ {
+		scan := r.Scans[i]
+		if r.Reverse {
+			// scans are in index order, visit them last to first
+			scan = r.Scans[len(r.Scans)-1-i]
+		}
 		currentScan = scan
 		err = scatter(r, scan, sliceSnapshots, fn, s.p.config)
 		switch err {
@@ -452,7 +495,7 @@ loop:
 				sk, err = jsonEncoder.Decode(row, t)
 				if err != nil {
 					err = fmt.Errorf("Collatejson decode error: %v", err)
-					l.Errorf("Error (%v) in Decode for row %v, "+
+					d.p.req.log.Errorf("Error (%v) in Decode for row %v, "+
 						"req = %s", err, row, d.p.req)
 					d.CloseWithError(err)
 					break loop
@@ -478,7 +521,7 @@ loop:
 			} else if dataEncFmt == c.DATA_ENC_JSON {
 				sk, docid, _, err = siSplitEntry(row, t)
 				if err != nil {
-					l.Errorf("Error (%v) in siSplitEntry for row %v, "+
+					d.p.req.log.Errorf("Error (%v) in siSplitEntry for row %v, "+
 						"req = %s", err, row, d.p.req)
 					d.CloseWithError(err)
 					break loop
@@ -823,6 +866,8 @@ type aggrVal struct {
 	projectId int32
 	distinct  bool
 	count     int
+	limit     int64
+	quantile  float64
 
 	n1qlValue bool
 }
@@ -837,6 +882,9 @@ type aggrResult struct {
 	rows    []*aggrRow
 	partial bool
 	maxRows int
+
+	// project partial state of mergeable aggregates
+	partialState bool
 }
 
 func (g groupKey) String() string {
@@ -952,6 +1000,12 @@ func computeAggrVal(groupAggr *GroupAggr, ak *Aggregate,
 	if ak.KeyPos >= 0 {
 		if ak.AggrFunc == c.AGG_SUM && !groupAggr.IsPrimary {
 			a.decoded = decodedkeys[ak.KeyPos].ActualForIndex()
+		} else if c.IsMergeableAggr(ak.AggrFunc) {
+			if groupAggr.IsPrimary {
+				a.decoded = string(compositekeys[ak.KeyPos])
+			} else {
+				a.decoded = decodedkeys[ak.KeyPos].ActualForIndex()
+			}
 		} else {
 			a.raw = compositekeys[ak.KeyPos]
 		}
@@ -975,6 +1029,8 @@ func computeAggrVal(groupAggr *GroupAggr, ak *Aggregate,
 	a.projectId = ak.EntryKeyId
 	a.distinct = ak.Distinct
 	a.count = count
+	a.limit = ak.Limit
+	a.quantile = ak.Quantile
 	return nil
 }
 
@@ -1100,14 +1156,15 @@ func (ar *aggrRow) CheckEqualGroup(groups []*groupKey) bool {
 func (ar *aggrRow) AddAggregate(aggrs []*aggrVal) error {
 
 	for i, agg := range aggrs {
+		decoded := agg.typ == c.AGG_SUM || c.IsMergeableAggr(agg.typ)
 		if ar.aggrs[i] == nil {
 			if agg.n1qlValue {
-				ar.aggrs[i] = &aggrVal{fn: c.NewAggrFunc(agg.typ, agg.obj, agg.distinct, true),
-					projectId: agg.projectId}
+				ar.aggrs[i] = &aggrVal{fn: c.NewAggrFunc2(agg.typ, agg.obj, agg.distinct, true,
+					agg.limit, agg.quantile), projectId: agg.projectId}
 			} else {
-				if agg.typ == c.AGG_SUM {
-					ar.aggrs[i] = &aggrVal{fn: c.NewAggrFunc(agg.typ, agg.decoded, agg.distinct, false),
-						projectId: agg.projectId}
+				if decoded {
+					ar.aggrs[i] = &aggrVal{fn: c.NewAggrFunc2(agg.typ, agg.decoded, agg.distinct, false,
+						agg.limit, agg.quantile), projectId: agg.projectId}
 				} else {
 					ar.aggrs[i] = &aggrVal{fn: c.NewAggrFunc(agg.typ, agg.raw, agg.distinct, false),
 						projectId: agg.projectId}
@@ -1117,7 +1174,7 @@ func (ar *aggrRow) AddAggregate(aggrs []*aggrVal) error {
 			if agg.n1qlValue {
 				ar.aggrs[i].fn.AddDeltaObj(agg.obj)
 			} else {
-				if agg.typ == c.AGG_SUM {
+				if decoded {
 					ar.aggrs[i].fn.AddDelta(agg.decoded)
 				} else {
 					ar.aggrs[i].fn.AddDeltaRaw(agg.raw)
@@ -1125,11 +1182,11 @@ func (ar *aggrRow) AddAggregate(aggrs []*aggrVal) error {
 			}
 		}
 		if agg.count > 1 && (agg.typ == c.AGG_SUM || agg.typ == c.AGG_COUNT ||
-			agg.typ == c.AGG_COUNTN) {
+			agg.typ == c.AGG_COUNTN || c.IsMergeableAggr(agg.typ)) {
 			for j := 1; j <= agg.count-1; j++ {
 				if agg.n1qlValue {
 					ar.aggrs[i].fn.AddDeltaObj(agg.obj)
-				} else if agg.typ == c.AGG_SUM {
+				} else if decoded {
 					ar.aggrs[i].fn.AddDelta(agg.decoded)
 				} else {
 					ar.aggrs[i].fn.AddDeltaRaw(agg.raw)
@@ -1167,7 +1224,8 @@ func projectEmptyResult(buf []byte, projection *Projection, groupAggr *GroupAggr
 		aggrs := make([][]byte, len(groupAggr.Aggrs))
 
 		for i, ak := range groupAggr.Aggrs {
-			if ak.AggrFunc == c.AGG_COUNT || ak.AggrFunc == c.AGG_COUNTN {
+			if ak.AggrFunc == c.AGG_COUNT || ak.AggrFunc == c.AGG_COUNTN ||
+				(ak.AggrFunc == c.AGG_APPROX_COUNT_DISTINCT && !groupAggr.PartialAggrState) {
 				aggrs[i] = encodedZero
 			} else {
 				aggrs[i] = encodedNull
@@ -1239,6 +1297,18 @@ func projectGroupAggr(buf []byte, projection *Projection,
 					keysToJoin = append(keysToJoin, gk.raw)
 				}
 			}
+		} else if fn, ok := row.aggrs[projGroup.pos].fn.(c.MergeableAggrFunc); ok {
+			var val []byte
+			if aggrRes.partialState {
+				val, err = encodeValue(fn.PartialValue())
+			} else {
+				val, err = encodeValue(fn.Value())
+			}
+			if err != nil {
+				l.Errorf("ScanPipeline::projectGroupAggr encodeValue error %v", err)
+				return nil, err
+			}
+			keysToJoin = append(keysToJoin, val)
 		} else {
 			if row.aggrs[projGroup.pos].fn.Type() == c.AGG_SUM ||
 				row.aggrs[projGroup.pos].fn.Type() == c.AGG_COUNT ||
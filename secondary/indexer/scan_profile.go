@@ -0,0 +1,337 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/common/json"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+//--------------------------
+// scan profile
+//--------------------------
+
+// ScanProfile is the execution profile of a single scan request. It is
+// collected when the slow scan log is enabled or when the client asks
+// for it, and is returned inline to the client in the latter case.
+// Durations are in nanoseconds.
+type ScanProfile struct {
+	RequestId string      `json:"requestId"`
+	ScanId    uint64      `json:"scanId"`
+	Bucket    string      `json:"bucket"`
+	Index     string      `json:"index"`
+	ScanType  ScanReqType `json:"scanType"`
+	Start     time.Time   `json:"start"`
+
+	WaitTime   time.Duration      `json:"waitTime"` // waiting for a snapshot
+	TotalTime  time.Duration      `json:"totalTime"`
+	Partitions []PartitionProfile `json:"partitions,omitempty"`
+
+	RowsScanned  uint64 `json:"rowsScanned"`
+	RowsFiltered uint64 `json:"rowsFiltered"` // rejected by filters
+	RowsReturned uint64 `json:"rowsReturned"`
+	// fraction of scanned rows that qualified the filters
+	Selectivity   float64           `json:"selectivity"`
+	BytesRead     uint64            `json:"bytesRead"`
+	CacheHitRatio int               `json:"cacheHitRatio"`
+	GroupAggr     *GroupAggrProfile `json:"groupAggr,omitempty"`
+
+	Error string `json:"error,omitempty"`
+
+	mu sync.Mutex // partitions are scanned concurrently
+}
+
+// PartitionProfile is the time spent scanning a partition, across all
+// the spans of the request.
+type PartitionProfile struct {
+	PartitionId common.PartitionId `json:"partitionId"`
+	ScanTime    time.Duration      `json:"scanTime"`
+	RowsScanned uint64             `json:"rowsScanned"`
+}
+
+// GroupAggrProfile is the cost of group by and aggregate pushdown.
+type GroupAggrProfile struct {
+	AggrTime     time.Duration `json:"aggrTime"`     // computing groups
+	ExprEvalTime time.Duration `json:"exprEvalTime"` // evaluating N1QL expressions
+	ExprEvals    int64         `json:"exprEvals"`
+}
+
+func newScanProfile(req *ScanRequest, t0 time.Time) *ScanProfile {
+	return &ScanProfile{
+		RequestId: req.RequestId,
+		ScanId:    req.ScanId,
+		Bucket:    req.Bucket,
+		Index:     req.IndexName,
+		ScanType:  req.ScanType,
+		Start:     t0,
+		WaitTime:  time.Since(t0),
+	}
+}
+
+// addPartition accumulates the scan time of a partition, nil profile
+// is a no-op.
+func (sp *ScanProfile) addPartition(partitionId common.PartitionId,
+	elapsed time.Duration, rows int) {
+
+	if sp == nil {
+		return
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	for i := range sp.Partitions {
+		if pp := &sp.Partitions[i]; pp.PartitionId == partitionId {
+			pp.ScanTime += elapsed
+			pp.RowsScanned += uint64(rows)
+			return
+		}
+	}
+	sp.Partitions = append(sp.Partitions, PartitionProfile{
+		PartitionId: partitionId,
+		ScanTime:    elapsed,
+		RowsScanned: uint64(rows),
+	})
+}
+
+// setPipeline copies the counters of a finished scan pipeline.
+func (sp *ScanProfile) setPipeline(req *ScanRequest, p *ScanPipeline) {
+	sp.RowsScanned = p.RowsScanned()
+	sp.RowsFiltered = p.RowsFiltered()
+	sp.RowsReturned = p.RowsReturned()
+	sp.BytesRead = p.BytesRead()
+	sp.CacheHitRatio = p.CacheHitRatio()
+	if sp.RowsScanned > 0 {
+		qualified := sp.RowsScanned - sp.RowsFiltered
+		sp.Selectivity = float64(qualified) / float64(sp.RowsScanned)
+	}
+	if req.GroupAggr != nil {
+		sp.GroupAggr = &GroupAggrProfile{
+			AggrTime:     p.AggrDur(),
+			ExprEvalTime: p.ExprEvalDur(),
+			ExprEvals:    p.ExprEvalNum(),
+		}
+	}
+}
+
+// done marks the end of the request.
+func (sp *ScanProfile) done(err error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	sp.TotalTime = time.Since(sp.Start)
+	if err != nil {
+		sp.Error = err.Error()
+	}
+	sort.Sort(partitionProfiles(sp.Partitions))
+}
+
+// partitionProfiles sorts profiles by partition id.
+type partitionProfiles []PartitionProfile
+
+func (p partitionProfiles) Len() int      { return len(p) }
+func (p partitionProfiles) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p partitionProfiles) Less(i, j int) bool {
+	return p[i].PartitionId < p[j].PartitionId
+}
+
+//--------------------------
+// slow scan log
+//--------------------------
+
+// slowScanLog is a bounded ring of the most recent scan requests that
+// took longer than the configured threshold, looked up by requestId.
+type slowScanLog struct {
+	mu      sync.Mutex
+	ring    []*ScanProfile
+	next    int
+	byReqId map[string][]*ScanProfile
+}
+
+func newSlowScanLog(size int) *slowScanLog {
+	if size <= 0 {
+		size = 1
+	}
+	return &slowScanLog{
+		ring:    make([]*ScanProfile, size),
+		byReqId: make(map[string][]*ScanProfile),
+	}
+}
+
+func (l *slowScanLog) add(sp *ScanProfile) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if old := l.ring[l.next]; old != nil {
+		l.forget(old)
+	}
+	l.ring[l.next] = sp
+	l.next = (l.next + 1) % len(l.ring)
+	l.byReqId[sp.RequestId] = append(l.byReqId[sp.RequestId], sp)
+}
+
+func (l *slowScanLog) forget(sp *ScanProfile) {
+	profiles := l.byReqId[sp.RequestId]
+	for i, p := range profiles {
+		if p == sp {
+			profiles = append(profiles[:i], profiles[i+1:]...)
+			break
+		}
+	}
+	if len(profiles) == 0 {
+		delete(l.byReqId, sp.RequestId)
+	} else {
+		l.byReqId[sp.RequestId] = profiles
+	}
+}
+
+// get returns the profiles logged for `requestId`.
+func (l *slowScanLog) get(requestId string) []*ScanProfile {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]*ScanProfile(nil), l.byReqId[requestId]...)
+}
+
+// list returns the logged profiles, most recent first.
+func (l *slowScanLog) list() []*ScanProfile {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.listLocked()
+}
+
+func (l *slowScanLog) listLocked() []*ScanProfile {
+	profiles := make([]*ScanProfile, 0, len(l.ring))
+	for i := 1; i <= len(l.ring); i++ {
+		pos := (l.next - i + len(l.ring)) % len(l.ring)
+		if sp := l.ring[pos]; sp != nil {
+			profiles = append(profiles, sp)
+		}
+	}
+	return profiles
+}
+
+// resize keeps the most recent profiles that fit in `size`.
+func (l *slowScanLog) resize(size int) {
+	if size <= 0 {
+		size = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if size == len(l.ring) {
+		return
+	}
+	profiles := l.listLocked()
+	if len(profiles) > size {
+		profiles = profiles[:size]
+	}
+	l.ring = make([]*ScanProfile, size)
+	l.byReqId = make(map[string][]*ScanProfile)
+	for i := len(profiles) - 1; i >= 0; i-- {
+		sp := profiles[i]
+		l.ring[len(profiles)-1-i] = sp
+		l.byReqId[sp.RequestId] = append(l.byReqId[sp.RequestId], sp)
+	}
+	l.next = len(profiles) % size
+}
+
+//--------------------------
+// scan coordinator hooks
+//--------------------------
+
+// profileRequest starts profiling `req` if the client asked for the
+// profile or the slow scan log is enabled.
+func (s *scanCoordinator) profileRequest(req *ScanRequest, t0 time.Time) {
+	threshold := s.config.Load()["settings.slow_scan_threshold"].Int()
+	if req.Profile || threshold > 0 {
+		req.profile = newScanProfile(req, t0)
+	}
+}
+
+// finishProfile completes the profile of `req` and logs it if the
+// request was slow.
+func (s *scanCoordinator) finishProfile(req *ScanRequest, err error) {
+	sp := req.profile
+	if sp == nil {
+		return
+	}
+	sp.done(err)
+
+	threshold := s.config.Load()["settings.slow_scan_threshold"].Int()
+	if threshold > 0 && sp.TotalTime >= time.Duration(threshold)*time.Millisecond {
+		s.slowScans.add(sp)
+		req.log.Infof("%v slow scan, waitTime:%v totalTime:%v rows:%v scanned:%v requestId:%v",
+			req.LogPrefix, sp.WaitTime, sp.TotalTime, sp.RowsReturned,
+			sp.RowsScanned, req.RequestId)
+	}
+}
+
+func (s *scanCoordinator) handleSlowScansReq(w http.ResponseWriter, r *http.Request) {
+	_, valid, _ := common.IsAuthValid(r)
+	if !valid {
+		w.WriteHeader(401)
+		w.Write([]byte("401 Unauthorized"))
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(400)
+		w.Write([]byte("Unsupported method"))
+		return
+	}
+
+	// Example: /slowScans?requestId=<id> or /slowScans?bucket=b&index=i&limit=10
+	query := r.URL.Query()
+	var profiles []*ScanProfile
+	if requestId := query.Get("requestId"); requestId != "" {
+		profiles = s.slowScans.get(requestId)
+	} else {
+		profiles = s.slowScans.list()
+	}
+
+	bucket, index := query.Get("bucket"), query.Get("index")
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	res := make([]*ScanProfile, 0, len(profiles))
+	for _, sp := range profiles {
+		if (bucket != "" && sp.Bucket != bucket) || (index != "" && sp.Index != index) {
+			continue
+		}
+		if limit > 0 && len(res) >= limit {
+			break
+		}
+		res = append(res, sp)
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		logging.Errorf("ScanCoordinator::handleSlowScansReq Error %v", err)
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(data)
+}
+
+func (s *scanCoordinator) RegisterRestEndpoints() {
+	mux := GetHTTPMux()
+	mux.HandleFunc("/slowScans", s.handleSlowScansReq)
+}
@@ -0,0 +1,158 @@
+package indexer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSlowScanLog(t *testing.T) {
+	// an op adds a profile of request id `add`, or resizes the log
+	type op struct {
+		add    string
+		resize int
+	}
+	add := func(reqIds ...string) []op {
+		ops := make([]op, 0, len(reqIds))
+		for _, reqId := range reqIds {
+			ops = append(ops, op{add: reqId})
+		}
+		return ops
+	}
+	resize := func(size int) []op {
+		return []op{{resize: size}}
+	}
+	concat := func(opss ...[]op) []op {
+		var ops []op
+		for _, o := range opss {
+			ops = append(ops, o...)
+		}
+		return ops
+	}
+
+	testcases := []struct {
+		name  string
+		size  int
+		ops   []op
+		list  []string       // request ids, most recent first
+		count map[string]int // profiles per request id
+	}{
+		{
+			name:  "empty",
+			size:  3,
+			list:  []string{},
+			count: map[string]int{},
+		},
+		{
+			name:  "partial",
+			size:  3,
+			ops:   add("r1", "r2"),
+			list:  []string{"r2", "r1"},
+			count: map[string]int{"r1": 1, "r2": 1},
+		},
+		{
+			name:  "full",
+			size:  3,
+			ops:   add("r1", "r2", "r3"),
+			list:  []string{"r3", "r2", "r1"},
+			count: map[string]int{"r1": 1, "r2": 1, "r3": 1},
+		},
+		{
+			name:  "wraparound",
+			size:  3,
+			ops:   add("r1", "r2", "r3", "r4", "r5"),
+			list:  []string{"r5", "r4", "r3"},
+			count: map[string]int{"r3": 1, "r4": 1, "r5": 1},
+		},
+		{
+			name:  "wraparound twice",
+			size:  2,
+			ops:   add("r1", "r2", "r3", "r4", "r5"),
+			list:  []string{"r5", "r4"},
+			count: map[string]int{"r4": 1, "r5": 1},
+		},
+		{
+			name:  "same request id",
+			size:  3,
+			ops:   add("r1", "r2", "r1", "r1"),
+			list:  []string{"r1", "r1", "r2"},
+			count: map[string]int{"r1": 2, "r2": 1},
+		},
+		{
+			name:  "zero size",
+			size:  0,
+			ops:   add("r1", "r2"),
+			list:  []string{"r2"},
+			count: map[string]int{"r2": 1},
+		},
+		{
+			name:  "shrink",
+			size:  4,
+			ops:   concat(add("r1", "r2", "r3", "r4"), resize(2)),
+			list:  []string{"r4", "r3"},
+			count: map[string]int{"r3": 1, "r4": 1},
+		},
+		{
+			name:  "shrink after wraparound",
+			size:  3,
+			ops:   concat(add("r1", "r2", "r3", "r4", "r5"), resize(2), add("r6")),
+			list:  []string{"r6", "r5"},
+			count: map[string]int{"r5": 1, "r6": 1},
+		},
+		{
+			name:  "shrink partial",
+			size:  4,
+			ops:   concat(add("r1"), resize(2), add("r2", "r3")),
+			list:  []string{"r3", "r2"},
+			count: map[string]int{"r2": 1, "r3": 1},
+		},
+		{
+			name:  "grow",
+			size:  2,
+			ops:   concat(add("r1", "r2", "r3"), resize(4), add("r4")),
+			list:  []string{"r4", "r3", "r2"},
+			count: map[string]int{"r2": 1, "r3": 1, "r4": 1},
+		},
+		{
+			name:  "grow and wraparound",
+			size:  2,
+			ops:   concat(add("r1", "r2", "r3"), resize(3), add("r4", "r5")),
+			list:  []string{"r5", "r4", "r3"},
+			count: map[string]int{"r3": 1, "r4": 1, "r5": 1},
+		},
+		{
+			name:  "same size",
+			size:  2,
+			ops:   concat(add("r1", "r2", "r3"), resize(2), add("r4")),
+			list:  []string{"r4", "r3"},
+			count: map[string]int{"r3": 1, "r4": 1},
+		},
+	}
+
+	for _, tc := range testcases {
+		l := newSlowScanLog(tc.size)
+		for _, o := range tc.ops {
+			if o.add != "" {
+				l.add(&ScanProfile{RequestId: o.add})
+			} else {
+				l.resize(o.resize)
+			}
+		}
+
+		list := []string{}
+		for _, sp := range l.list() {
+			list = append(list, sp.RequestId)
+		}
+		if !reflect.DeepEqual(list, tc.list) {
+			t.Errorf("%v: expected %v, got %v", tc.name, tc.list, list)
+		}
+
+		if len(l.byReqId) != len(tc.count) {
+			t.Errorf("%v: expected %v request ids, got %v", tc.name, len(tc.count), len(l.byReqId))
+		}
+		for reqId, n := range tc.count {
+			if profiles := l.get(reqId); len(profiles) != n {
+				t.Errorf("%v: expected %v profiles of %v, got %v", tc.name, n, reqId, len(profiles))
+			}
+		}
+	}
+}
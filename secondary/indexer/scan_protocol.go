@@ -12,6 +12,7 @@ package indexer
 import (
 	"encoding/binary"
 	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/common/json"
 	p "github.com/couchbase/indexing/secondary/pipeline"
 	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
 	"github.com/golang/protobuf/proto"
@@ -20,12 +21,15 @@ import (
 
 type ScanResponseWriter interface {
 	Error(err error) error
-	Stats(rows, unique uint64, min, max []byte) error
+	Stats(stats *protobuf.IndexStatistics) error
 	Count(count uint64) error
 	RawBytes([]byte) error
 	Row(pk, sk []byte) error
 	Done() error
-	Helo() error
+	Helo(compressions []uint32) error
+	OpenSnapshot(snapshotId uint64, leaseTime int64) error
+	CloseSnapshot() error
+	Profile(profile *ScanProfile) error
 }
 
 type protoResponseWriter struct {
@@ -61,7 +65,7 @@ func (w *protoResponseWriter) Error(err error) error {
 	w.rowSize = 0
 
 	switch w.scanType {
-	case StatsReq:
+	case StatsReq, LeadKeyHistogramReq:
 		res = &protobuf.StatisticsResponse{
 			Err: protoErr,
 		}
@@ -69,33 +73,66 @@ func (w *protoResponseWriter) Error(err error) error {
 		res = &protobuf.CountResponse{
 			Count: proto.Int64(0), Err: protoErr,
 		}
-	case ScanAllReq, ScanReq, FastCountReq:
+	case ScanAllReq, ScanReq, FastCountReq, DocIdLookupReq:
 		res = &protobuf.ResponseStream{
 			Err: protoErr,
 		}
+	case OpenSnapshotReq:
+		res = &protobuf.OpenSnapshotResponse{
+			Err: protoErr,
+		}
+	case CloseSnapshotReq:
+		res = &protobuf.CloseSnapshotResponse{
+			Err: protoErr,
+		}
 	}
 
 	return protobuf.EncodeAndWrite(w.conn, *w.encBuf, res)
 }
 
-func (w *protoResponseWriter) Stats(rows, unique uint64, min, max []byte) error {
+func (w *protoResponseWriter) Stats(stats *protobuf.IndexStatistics) error {
 	res := &protobuf.StatisticsResponse{
-		Stats: &protobuf.IndexStatistics{
-			KeysCount:       proto.Uint64(rows),
-			UniqueKeysCount: proto.Uint64(unique),
-			KeyMin:          min,
-			KeyMax:          max,
-		},
+		Stats: stats,
 	}
 
 	return protobuf.EncodeAndWrite(w.conn, *w.encBuf, res)
 }
 
-func (w *protoResponseWriter) Helo() error {
+func (w *protoResponseWriter) Helo(compressions []uint32) error {
 	res := &protobuf.HeloResponse{
-		Version: proto.Uint32(common.INDEXER_CUR_VERSION),
+		Version:      proto.Uint32(common.INDEXER_CUR_VERSION),
+		Compressions: compressions,
+	}
+
+	return protobuf.EncodeAndWrite(w.conn, *w.encBuf, res)
+}
+
+func (w *protoResponseWriter) OpenSnapshot(snapshotId uint64, leaseTime int64) error {
+	res := &protobuf.OpenSnapshotResponse{
+		SnapshotId: proto.Uint64(snapshotId),
+		LeaseTime:  proto.Int64(leaseTime),
+	}
+
+	return protobuf.EncodeAndWrite(w.conn, *w.encBuf, res)
+}
+
+func (w *protoResponseWriter) CloseSnapshot() error {
+	res := &protobuf.CloseSnapshotResponse{}
+	return protobuf.EncodeAndWrite(w.conn, *w.encBuf, res)
+}
+
+// Profile sends the rows collected so far along with the JSON encoded
+// execution profile of the request.
+func (w *protoResponseWriter) Profile(profile *ScanProfile) error {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return err
 	}
 
+	res := &protobuf.ResponseStream{IndexEntries: w.rowEntries, Profile: data}
+	w.rowEntries = nil
+	w.rowSize = 0
+
 	return protobuf.EncodeAndWrite(w.conn, *w.encBuf, res)
 }
 
@@ -157,7 +194,8 @@ func (w *protoResponseWriter) Done() error {
 	defer p.PutBlock(w.encBuf)
 	defer p.PutBlock(w.rowBuf)
 
-	if (w.scanType == ScanReq || w.scanType == ScanAllReq || w.scanType == FastCountReq) && w.rowSize > 0 {
+	if (w.scanType == ScanReq || w.scanType == ScanAllReq || w.scanType == FastCountReq ||
+		w.scanType == DocIdLookupReq) && w.rowSize > 0 {
 		res := &protobuf.ResponseStream{IndexEntries: w.rowEntries}
 		err := protobuf.EncodeAndWrite(w.conn, *w.encBuf, res)
 		if err != nil {
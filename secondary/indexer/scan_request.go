@@ -11,6 +11,7 @@ package indexer
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"sort"
@@ -32,13 +33,17 @@ import (
 type ScanReqType string
 
 const (
-	StatsReq          ScanReqType = "stats"
-	CountReq                      = "count"
-	ScanReq                       = "scan"
-	ScanAllReq                    = "scanAll"
-	HeloReq                       = "helo"
-	MultiScanCountReq             = "multiscancount"
-	FastCountReq                  = "fastcountreq" //generated internally
+	StatsReq            ScanReqType = "stats"
+	CountReq                        = "count"
+	ScanReq                         = "scan"
+	ScanAllReq                      = "scanAll"
+	HeloReq                         = "helo"
+	MultiScanCountReq               = "multiscancount"
+	FastCountReq                    = "fastcountreq" //generated internally
+	OpenSnapshotReq                 = "openSnapshot"
+	CloseSnapshotReq                = "closeSnapshot"
+	DocIdLookupReq                  = "docIdLookup"
+	LeadKeyHistogramReq             = "leadKeyHistogram"
 )
 
 type ScanRequest struct {
@@ -91,6 +96,13 @@ type ScanRequest struct {
 	// Rollback Time
 	rollbackTime int64
 
+	// Leased snapshot to scan, and lease asked for by OpenSnapshotReq
+	SnapshotId uint64
+	leaseTime  int64
+
+	// Documents to lookup by DocIdLookupReq
+	DocIds [][]byte
+
 	ScanId      uint64
 	ExpiredTime time.Time
 	Timeout     *time.Timer
@@ -99,6 +111,15 @@ type ScanRequest struct {
 	RequestId string
 	LogPrefix string
 
+	// log carries bucket, index and RequestId of the request, for
+	// correlating its messages across scan pipeline and storage.
+	log *logging.Entry
+
+	// Profile is set by client to receive the execution profile of
+	// the request along with the results.
+	Profile bool
+	profile *ScanProfile
+
 	keyBufList      []*[]byte
 	indexKeyBuffer  []byte
 	sharedBuffer    *[]byte
@@ -112,6 +133,10 @@ type ScanRequest struct {
 
 	dataEncFmt common.DataEncodingFormat
 	keySzCfg   keySizeConfig
+
+	// memory for entries buffered by reverse scan of a partition on
+	// forward only storage, 0 is unbounded.
+	reverseBufLimit int64
 }
 
 type Projection struct {
@@ -195,6 +220,8 @@ type Aggregate struct {
 	Expr       expression.Expression // Aggregate expression
 	ExprValue  value.Value           // Is non-nil if expression is constant
 	Distinct   bool                  // Aggregate only on Distinct values with in the group
+	Limit      int64                 // Maximum number of values in ARRAY_AGG, 0 means no limit
+	Quantile   float64               // Quantile for APPROX_QUANTILE
 }
 
 type GroupAggr struct {
@@ -206,6 +233,7 @@ type GroupAggr struct {
 	DependsOnPrimaryKey bool
 	AllowPartialAggr    bool // Partial aggregates are allowed
 	OnePerPrimaryKey    bool // Leading Key is ALL & equality span consider one per docid
+	PartialAggrState    bool // Project mergeable partial state of AVG and approximate aggregates
 
 	IsLeadingGroup     bool // Group by key(s) are leading subset
 	IsPrimary          bool
@@ -258,11 +286,18 @@ func (a Aggregate) String() string {
 	str += fmt.Sprintf(" Expr %v", logging.TagUD(a.Expr))
 	str += fmt.Sprintf(" ExprValue %v", logging.TagUD(a.ExprValue))
 	str += fmt.Sprintf(" Distinct %v", a.Distinct)
+	if a.AggrFunc == common.AGG_ARRAY_AGG {
+		str += fmt.Sprintf(" Limit %v", a.Limit)
+	}
+	if a.AggrFunc == common.AGG_APPROX_QUANTILE {
+		str += fmt.Sprintf(" Quantile %v", a.Quantile)
+	}
 	return str
 }
 
 var (
 	ErrInvalidAggrFunc = errors.New("Invalid Aggregate Function")
+	ErrInvalidQuantile = errors.New("Invalid Quantile For Aggregate Function")
 )
 
 var inclusionMatrix = [][]Inclusion{
@@ -303,6 +338,7 @@ func NewScanRequest(protoReq interface{}, ctx interface{},
 	}
 
 	r.keySzCfg = getKeySizeConfig(cfg)
+	r.reverseBufLimit = int64(cfg["settings.scan_reverse_buffer_limit"].Int())
 
 	switch req := protoReq.(type) {
 	case *protobuf.HeloRequest:
@@ -310,6 +346,7 @@ func NewScanRequest(protoReq interface{}, ctx interface{},
 	case *protobuf.StatisticsRequest:
 		r.DefnID = req.GetDefnID()
 		r.RequestId = req.GetRequestId()
+		r.PartitionIds = makePartitionIds(req.GetPartitionIds())
 		r.ScanType = StatsReq
 		r.Incl = Inclusion(req.GetSpan().GetRange().GetInclusion())
 		r.Sorted = true
@@ -343,6 +380,7 @@ func NewScanRequest(protoReq interface{}, ctx interface{},
 		if err = r.setConsistency(cons, vector); err != nil {
 			return
 		}
+		r.SnapshotId = req.GetSnapshotId()
 
 		err = r.fillRanges(
 			req.GetSpan().GetRange().GetLow(),
@@ -380,6 +418,8 @@ func NewScanRequest(protoReq interface{}, ctx interface{},
 			r.Distinct = req.GetDistinct()
 		}
 		r.Offset = req.GetOffset()
+		r.SnapshotId = req.GetSnapshotId()
+		r.Profile = req.GetProfile()
 
 		if err = r.setIndexParams(); err != nil {
 			return
@@ -442,6 +482,60 @@ func NewScanRequest(protoReq interface{}, ctx interface{},
 		if err = r.setConsistency(cons, vector); err != nil {
 			return
 		}
+
+	case *protobuf.OpenSnapshotRequest:
+		r.DefnID = req.GetDefnID()
+		r.RequestId = req.GetRequestId()
+		r.rollbackTime = req.GetRollbackTime()
+		r.PartitionIds = makePartitionIds(req.GetPartitionIds())
+		cons := common.Consistency(req.GetCons())
+		vector := req.GetVector()
+		r.ScanType = OpenSnapshotReq
+		r.leaseTime = req.GetLeaseTime()
+
+		if err = r.setIndexParams(); err != nil {
+			return
+		}
+
+		if err = r.setConsistency(cons, vector); err != nil {
+			return
+		}
+
+	case *protobuf.CloseSnapshotRequest:
+		r.ScanType = CloseSnapshotReq
+		r.DefnID = req.GetDefnID()
+		r.RequestId = req.GetRequestId()
+		r.SnapshotId = req.GetSnapshotId()
+
+	case *protobuf.DocIdLookupRequest:
+		r.DefnID = req.GetDefnID()
+		r.RequestId = req.GetRequestId()
+		r.rollbackTime = req.GetRollbackTime()
+		r.PartitionIds = makePartitionIds(req.GetPartitionIds())
+		cons := common.Consistency(req.GetCons())
+		vector := req.GetVector()
+		r.ScanType = DocIdLookupReq
+		r.DocIds = req.GetDocIds()
+		r.SnapshotId = req.GetSnapshotId()
+		r.dataEncFmt = common.DataEncodingFormat(req.GetDataEncFmt())
+
+		if err = r.setIndexParams(); err != nil {
+			return
+		}
+
+		if err = r.setConsistency(cons, vector); err != nil {
+			return
+		}
+
+	case *protobuf.LeadKeyHistogramRequest:
+		r.DefnID = req.GetDefnID()
+		r.RequestId = req.GetRequestId()
+		r.PartitionIds = makePartitionIds(req.GetPartitionIds())
+		r.ScanType = LeadKeyHistogramReq
+		if err = r.setIndexParams(); err != nil {
+			return
+		}
+
 	default:
 		err = ErrUnsupportedRequest
 	}
@@ -521,9 +615,135 @@ func (r *ScanRequest) newHighKey(k []byte) (IndexKey, error) {
 	return r.newKey(k)
 }
 
+// newFilterKey encodes low or high, `high`, key of the filter on index
+// key at `keyPos`. Bounds on a collated key are encoded to include or
+// exclude all the strings having the same collation key, as per the
+// inclusion of filter.
+func (r *ScanRequest) newFilterKey(keyPos int, k []byte, high bool,
+	incl Inclusion) (IndexKey, error) {
+
+	collation := r.IndexInst.Defn.GetCollation(keyPos)
+	if collation == "" || r.isNil(k) {
+		if high {
+			return r.newHighKey(k)
+		}
+		return r.newLowKey(k)
+	}
+
+	if len(k) > r.keySzCfg.maxSecKeyLen {
+		return nil, fmt.Errorf("Secondary key is too long (> %d)", r.keySzCfg.maxSecKeyLen)
+	}
+	collator, err := collatejson.NewCollator(collation)
+	if err != nil {
+		return nil, err
+	}
+	codec := collatejson.NewCodec(16)
+	codec.CollateStrings(collator)
+
+	upper := incl == Neither || incl == High // low excluded
+	if high {
+		upper = incl == High || incl == Both
+	}
+	buf, err := codec.EncodeBound(k, r.getKeyBuffer(), upper)
+	if err != nil {
+		return nil, err
+	}
+	key := secondaryKey(append([]byte(nil), buf...))
+	return &key, nil
+}
+
+// equalsToFilters returns `protoScan` with equal keys as filters, strings
+// equal as per collation may differ in their encoding.
+func equalsToFilters(protoScan *protobuf.Scan) *protobuf.Scan {
+	incl := uint32(Both)
+	filters := make([]*protobuf.CompositeElementFilter, 0, len(protoScan.Equals))
+	for _, k := range protoScan.Equals {
+		filters = append(filters, &protobuf.CompositeElementFilter{
+			Low: k, High: k, Inclusion: &incl,
+		})
+	}
+	return &protobuf.Scan{Filters: filters}
+}
+
+// newRangeKey encodes low or high, `high`, key of a range on an index
+// with collation. Collated keys of the composite bound are encoded by
+// newFilterKey, as per `incl` for the last key and to include all the
+// strings having the same collation key for the others. Hence the range
+// can span more entries than the bound.
+func (r *ScanRequest) newRangeKey(k []byte, high bool, incl Inclusion) (IndexKey, error) {
+	if r.isNil(k) {
+		if high {
+			return r.newHighKey(k)
+		}
+		return r.newLowKey(k)
+	}
+
+	if len(k) > r.keySzCfg.maxSecKeyLen {
+		return nil, fmt.Errorf("Secondary key is too long (> %d)", r.keySzCfg.maxSecKeyLen)
+	}
+	var values []json.RawMessage
+	if err := json.Unmarshal(k, &values); err != nil {
+		return nil, err
+	}
+
+	keys := make([][]byte, 0, len(values))
+	for i, v := range values {
+		var key IndexKey
+		var err error
+		if r.IndexInst.Defn.GetCollation(i) == "" {
+			key, err = r.newKey(v)
+		} else if i == len(values)-1 {
+			key, err = r.newFilterKey(i, v, high, incl)
+		} else {
+			key, err = r.newFilterKey(i, v, high, Both)
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key.Bytes())
+	}
+
+	joined, err := r.joinKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	key := secondaryKey(joined)
+	return &key, nil
+}
+
+// fillCollatedRanges is fillRanges for an index with collation, strings
+// equal as per collation may differ in their encoding. Hence an equal
+// key is looked up as a range.
+func (r *ScanRequest) fillCollatedRanges(low, high []byte, keys [][]byte) (localErr error) {
+	r.LowBytes = low
+	r.HighBytes = high
+	r.KeysBytes = keys
+
+	if len(keys) > 1 {
+		return fmt.Errorf("Lookup of multiple keys is not supported on index with collation")
+	} else if len(keys) == 1 {
+		low, high, r.Incl = keys[0], keys[0], Both
+	}
+
+	if r.Low, localErr = r.newRangeKey(low, false, r.Incl); localErr != nil {
+		localErr = fmt.Errorf("Invalid low key %s (%s)", string(low), localErr)
+		return
+	}
+
+	if r.High, localErr = r.newRangeKey(high, true, r.Incl); localErr != nil {
+		localErr = fmt.Errorf("Invalid high key %s (%s)", string(high), localErr)
+		return
+	}
+	return
+}
+
 func (r *ScanRequest) fillRanges(low, high []byte, keys [][]byte) (localErr error) {
 	var key IndexKey
 
+	if r.IndexInst.Defn.HasCollation() {
+		return r.fillCollatedRanges(low, high, keys)
+	}
+
 	// range
 	r.LowBytes = low
 	r.HighBytes = high
@@ -1009,6 +1229,9 @@ func (r *ScanRequest) fillScans(protoScans []*protobuf.Scan) (localErr error) {
 	} else {
 		for _, protoScan := range protoScans {
 			skipScan := false
+			if len(protoScan.Equals) != 0 && r.IndexInst.Defn.HasCollation() {
+				protoScan = equalsToFilters(protoScan)
+			}
 			if len(protoScan.Equals) != 0 {
 				//Encode the equals keys
 				var filter Filter
@@ -1039,13 +1262,14 @@ func (r *ScanRequest) fillScans(protoScans []*protobuf.Scan) (localErr error) {
 
 			var compFilters []CompositeElementFilter
 			// Encode Filters
-			for _, fl := range protoScan.Filters {
-				if l, localErr = r.newLowKey(fl.Low); localErr != nil {
+			for i, fl := range protoScan.Filters {
+				incl := Inclusion(fl.GetInclusion())
+				if l, localErr = r.newFilterKey(i, fl.Low, false, incl); localErr != nil {
 					localErr = fmt.Errorf("Invalid low key %s (%s)", logging.TagStrUD(fl.Low), localErr)
 					return
 				}
 
-				if h, localErr = r.newHighKey(fl.High); localErr != nil {
+				if h, localErr = r.newFilterKey(i, fl.High, true, incl); localErr != nil {
 					localErr = fmt.Errorf("Invalid high key %s (%s)", logging.TagStrUD(fl.High), localErr)
 					return
 				}
@@ -1058,7 +1282,7 @@ func (r *ScanRequest) fillScans(protoScans []*protobuf.Scan) (localErr error) {
 				compfil := CompositeElementFilter{
 					Low:       l,
 					High:      h,
-					Inclusion: Inclusion(fl.GetInclusion()),
+					Inclusion: incl,
 				}
 				compFilters = append(compFilters, compfil)
 			}
@@ -1144,6 +1368,13 @@ func (r *ScanRequest) setConsistency(cons common.Consistency, vector *protobuf.T
 
 	r.Consistency = &cons
 	cfg := r.sco.config.Load()
+
+	// A paused index is not receiving mutations. It cannot satisfy
+	// any consistency other than AnyConsistency.
+	if r.IndexInst.Paused && cons != common.AnyConsistency {
+		return common.ErrIndexPaused
+	}
+
 	if cons == common.QueryConsistency && vector != nil {
 		r.Ts = common.NewTsVbuuid(r.Bucket, cfg["numVbuckets"].Int())
 		// if vector == nil, it is similar to AnyConsistency
@@ -1186,6 +1417,18 @@ func (r *ScanRequest) setIndexParams() (localErr error) {
 		r.Stats = stats.indexes[r.IndexInstId]
 		rbMap := *r.sco.getRollbackInProgress()
 		r.hasRollback = rbMap[indexInst.Defn.Bucket]
+
+		r.log = logging.WithFields(logging.Fields{
+			Component: "indexer",
+			Bucket:    r.Bucket,
+			Index:     r.IndexName,
+			RequestId: r.RequestId,
+		})
+		for i, ctx := range r.Ctxs {
+			if ctx != nil && i < len(r.PartitionIds) {
+				ctx.SetLogger(r.log.WithPartition(r.PartitionIds[i]))
+			}
+		}
 	}
 	return
 }
@@ -1304,6 +1547,8 @@ func (r *ScanRequest) fillGroupAggr(protoGroupAggr *protobuf.GroupAggr, protoSca
 
 	r.GroupAggr.AllowPartialAggr = protoGroupAggr.GetAllowPartialAggr()
 	r.GroupAggr.OnePerPrimaryKey = protoGroupAggr.GetOnePerPrimaryKey()
+	r.GroupAggr.Name = string(protoGroupAggr.GetName())
+	r.GroupAggr.PartialAggrState = protoGroupAggr.GetPartialAggrState()
 
 	if err = r.validateGroupAggr(); err != nil {
 		return
@@ -1384,6 +1629,8 @@ func (r *ScanRequest) unmarshallAggrs(protoGroupAggr *protobuf.GroupAggr) error
 		aggr.EntryKeyId = a.GetEntryKeyId()
 		aggr.KeyPos = a.GetKeyPos()
 		aggr.Distinct = a.GetDistinct()
+		aggr.Limit = a.GetLimit()
+		aggr.Quantile = a.GetQuantile()
 
 		if aggr.KeyPos < 0 {
 			if string(a.GetExpr()) == "" {
@@ -1406,7 +1653,7 @@ func (r *ScanRequest) unmarshallAggrs(protoGroupAggr *protobuf.GroupAggr) error
 				r.GroupAggr.exprContext = expression.NewIndexContext()
 			}
 		} else {
-			if aggr.AggrFunc == common.AGG_SUM {
+			if aggr.AggrFunc == common.AGG_SUM || common.IsMergeableAggr(aggr.AggrFunc) {
 				r.GroupAggr.NeedDecode = true
 				if !r.isPrimary {
 					r.decodePositions[aggr.KeyPos] = true
@@ -1474,6 +1721,19 @@ outerloop:
 			logging.Errorf("ScanRequest::validateGroupAggr %v %v", ErrInvalidAggrFunc, a.AggrFunc)
 			return ErrInvalidAggrFunc
 		}
+		if a.AggrFunc == common.AGG_APPROX_QUANTILE && (a.Quantile < 0 || a.Quantile > 1) {
+			logging.Errorf("ScanRequest::validateGroupAggr %v %v", ErrInvalidQuantile, a.Quantile)
+			return ErrInvalidQuantile
+		}
+		// Final value of a mergeable aggregate is computed for each row of a
+		// group. A non-leading group is flushed from the group buffer and a
+		// group can span partitions, giving more than one row for the group.
+		if common.IsMergeableAggr(a.AggrFunc) && !r.GroupAggr.PartialAggrState &&
+			(!r.GroupAggr.IsLeadingGroup || len(r.PartitionIds) > 1) {
+			err = fmt.Errorf("Aggregate %v Needs Partial Aggr State For Given Scan", a.AggrFunc)
+			logging.Errorf("ScanRequest::validateGroupAggr %v", err)
+			return err
+		}
 		if int(a.KeyPos) >= len(r.IndexInst.Defn.SecExprs) {
 			err = fmt.Errorf("Invalid KeyPos In Aggr %v", a)
 			logging.Errorf("ScanRequest::validateGroupAggr %v", err)
@@ -1795,6 +2055,14 @@ func (r ScanRequest) String() string {
 	str := fmt.Sprintf("defnId:%v, instId:%v, index:%v/%v, type:%v, partitions:%v",
 		r.DefnID, r.IndexInstId, r.Bucket, r.IndexName, r.ScanType, r.PartitionIds)
 
+	if r.SnapshotId != 0 {
+		str += fmt.Sprintf(", snapshot:%v", r.SnapshotId)
+	}
+
+	if r.ScanType == DocIdLookupReq {
+		return str + fmt.Sprintf(", docids:%v", len(r.DocIds))
+	}
+
 	if len(r.Scans) == 0 {
 		var incl, span string
 
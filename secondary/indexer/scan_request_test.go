@@ -0,0 +1,164 @@
+package indexer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/collatejson"
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestCollatedFilterKey(t *testing.T) {
+	conf := common.SystemConfig.SectionConfig("indexer.", true /*trim*/)
+	r := &ScanRequest{keySzCfg: getKeySizeConfig(conf)}
+	r.IndexInst.Defn.SecExprs = []string{"name"}
+	r.IndexInst.Defn.Collations = []string{collatejson.CollationNoCase}
+
+	collator, _ := collatejson.NewCollator(collatejson.CollationNoCase)
+	codec := collatejson.NewCodec(16)
+	codec.CollateStrings(collator)
+	encode := func(text string) []byte {
+		code, err := codec.Encode([]byte(text), make([]byte, 0, 1024))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	testcases := []struct {
+		incl    Inclusion
+		matches bool
+	}{
+		{Both, true},
+		{Low, false},
+		{High, false},
+		{Neither, false},
+	}
+	for _, tc := range testcases {
+		low, err := r.newFilterKey(0, []byte(`"aB"`), false, tc.incl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		high, err := r.newFilterKey(0, []byte(`"Ab"`), true, tc.incl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, text := range []string{`"AB"`, `"ab"`} {
+			code := encode(text)
+			matches := bytes.Compare(code, low.Bytes()) > 0 && bytes.Compare(code, high.Bytes()) < 0
+			if matches != tc.matches {
+				t.Errorf("inclusion %v %v matches %v, expected %v", tc.incl, text, matches, tc.matches)
+			}
+		}
+	}
+
+	// nil keys and keys not collated are encoded as is.
+	if key, _ := r.newFilterKey(0, nil, true, Both); key != MaxIndexKey {
+		t.Errorf("expected max index key, got %v", key)
+	}
+	binary, err := collatejson.NewCodec(16).Encode([]byte(`"aB"`), make([]byte, 0, 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := r.newFilterKey(1, []byte(`"aB"`), false, Both); !bytes.Equal(key.Bytes(), binary) {
+		t.Errorf("expected %v, got %v", binary, key.Bytes())
+	}
+}
+
+func TestCollatedRanges(t *testing.T) {
+	conf := common.SystemConfig.SectionConfig("indexer.", true /*trim*/)
+	newRequest := func() *ScanRequest {
+		r := &ScanRequest{keySzCfg: getKeySizeConfig(conf)}
+		r.IndexInst.Defn.SecExprs = []string{"name", "age"}
+		r.IndexInst.Defn.Collations = []string{collatejson.CollationNoCase, ""}
+		return r
+	}
+
+	collator, _ := collatejson.NewCollator(collatejson.CollationNoCase)
+	codec := collatejson.NewCodec(16)
+	codec.CollateKeys([]collatejson.Collator{collator, nil})
+	encode := func(text string) []byte {
+		code, err := codec.Encode([]byte(text), make([]byte, 0, 1024))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	testcases := []struct {
+		name      string
+		low, high string
+		keys      []string
+		incl      Inclusion
+		in, out   []string
+	}{
+		{
+			name: "range",
+			low:  `["aB"]`, high: `["aB"]`, incl: Both,
+			in:  []string{`["AB",1]`, `["ab",2]`},
+			out: []string{`["aa",1]`, `["abc",1]`},
+		},
+		{
+			name: "low excluded",
+			low:  `["ab"]`, high: `["b"]`, incl: High,
+			in:  []string{`["ac",1]`, `["B",5]`},
+			out: []string{`["AB",1]`, `["ab",2]`, `["c",1]`},
+		},
+		{
+			name: "composite",
+			low:  `["aB",5]`, high: `["Ab",8]`, incl: Both,
+			in:  []string{`["ab",5]`, `["AB",8]`},
+			out: []string{`["aa",9]`, `["ac",1]`},
+		},
+		{
+			name: "lookup",
+			keys: []string{`["aB"]`},
+			in:   []string{`["AB",1]`, `["ab",2]`},
+			out:  []string{`["aa",1]`, `["abc",1]`},
+		},
+	}
+	for _, tc := range testcases {
+		r := newRequest()
+		r.Incl = tc.incl
+		var keys [][]byte
+		for _, k := range tc.keys {
+			keys = append(keys, []byte(k))
+		}
+		if err := r.fillRanges([]byte(tc.low), []byte(tc.high), keys); err != nil {
+			t.Fatalf("%v: %v", tc.name, err)
+		}
+		if len(r.Keys) != 0 {
+			t.Errorf("%v: expected keys to be looked up as a range, got %v", tc.name, r.Keys)
+		}
+		lowIncl := r.Incl == Low || r.Incl == Both
+		highIncl := r.Incl == High || r.Incl == Both
+		// bound is compared with the prefix of entry, see secondaryKey.
+		compare := func(key IndexKey, code []byte) int {
+			k := key.Bytes()
+			if len(k) > len(code) {
+				k = k[:len(code)]
+			}
+			return bytes.Compare(k, code[:len(k)])
+		}
+		matches := func(text string) bool {
+			code := encode(text)
+			l, h := compare(r.Low, code), compare(r.High, code)
+			return (l < 0 || (l == 0 && lowIncl)) && (h > 0 || (h == 0 && highIncl))
+		}
+		for _, text := range tc.in {
+			if !matches(text) {
+				t.Errorf("%v: expected %v in range", tc.name, text)
+			}
+		}
+		for _, text := range tc.out {
+			if matches(text) {
+				t.Errorf("%v: expected %v out of range", tc.name, text)
+			}
+		}
+	}
+
+	r := newRequest()
+	if err := r.fillRanges(nil, nil, [][]byte{[]byte(`["a"]`), []byte(`["b"]`)}); err == nil {
+		t.Errorf("expected error for lookup of multiple keys")
+	}
+}
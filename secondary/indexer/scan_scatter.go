@@ -13,11 +13,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/couchbase/indexing/secondary/common"
-	"github.com/couchbase/indexing/secondary/logging"
 	"github.com/couchbase/indexing/secondary/pipeline"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var ErrFinishCallback error = errors.New("Callback done due to error")
@@ -137,7 +138,7 @@ func scanMultiple(request *ScanRequest, scan Scan, snapshots []SliceSnapshot, cb
 		enqCount += queue.EnqueueCount()
 		deqCount += queue.DequeueCount()
 	}
-	logging.Debugf("scan_scatter.scanMultiple: scan done.  enqueue count %v dequeue count %v", enqCount, deqCount)
+	request.log.Debugf("scan_scatter.scanMultiple: scan done.  enqueue count %v dequeue count %v", enqCount, deqCount)
 
 	return
 }
@@ -147,7 +148,7 @@ func scanOne(request *ScanRequest, scan Scan, snapshots []SliceSnapshot, partiti
 	errch := make(chan error, 1)
 	count := scanSingleSlice(request, scan, request.Ctxs[0], snapshots[0], partitionId, nil, nil, errch, cb)
 
-	logging.Debugf("scan_scatter:scanOnce: scan done. Count %v", count)
+	request.log.Debugf("scan_scatter:scanOnce: scan done. Count %v", count)
 
 	errcnt := len(errch)
 	for i := 0; i < errcnt; i++ {
@@ -163,7 +164,11 @@ func scanOne(request *ScanRequest, scan Scan, snapshots []SliceSnapshot, partiti
 func scanSingleSlice(request *ScanRequest, scan Scan, ctx IndexReaderContext, snap SliceSnapshot, partitionId common.PartitionId,
 	queue *Queue, wg *sync.WaitGroup, errch chan error, cb EntryCallback) (count int) {
 
+	t0 := time.Now()
 	defer func() {
+		// before wg.Done(), profile is read once the scatter is done.
+		request.profile.addPartition(partitionId, time.Since(t0), count)
+
 		if wg != nil {
 			wg.Done()
 		}
@@ -198,7 +203,9 @@ func scanSingleSlice(request *ScanRequest, scan Scan, ctx IndexReaderContext, sn
 	}
 
 	var err error
-	if scan.ScanType == AllReq {
+	if request.Reverse {
+		err = reverseScanSingleSlice(ctx, snap, scan, request.reverseBufLimit, handler)
+	} else if scan.ScanType == AllReq {
 		err = snap.Snapshot().All(ctx, handler)
 	} else if scan.ScanType == LookupReq {
 		err = snap.Snapshot().Range(ctx, scan.Equals, scan.Equals, Both, handler)
@@ -208,6 +215,8 @@ func scanSingleSlice(request *ScanRequest, scan Scan, ctx IndexReaderContext, sn
 
 	if err != nil {
 		if err != ErrFinishCallback {
+			ctx.Logger().Debugf("scan_scatter:scanSingleSlice: scan of partition %v failed: %v",
+				partitionId, err)
 			errch <- err
 		}
 		if queue != nil {
@@ -224,6 +233,63 @@ func scanSingleSlice(request *ScanRequest, scan Scan, ctx IndexReaderContext, sn
 	return
 }
 
+func reverseScanSingleSlice(ctx IndexReaderContext, snap SliceSnapshot, scan Scan,
+	bufLimit int64, handler EntryCallback) error {
+
+	ranger, ok := snap.Snapshot().(ReverseRanger)
+	if !ok {
+		return bufferedReverseScan(ctx, snap, scan, bufLimit, handler)
+	}
+
+	if scan.ScanType == AllReq {
+		return ranger.ReverseRange(ctx, MinIndexKey, MaxIndexKey, Both, handler)
+	} else if scan.ScanType == LookupReq {
+		return ranger.ReverseRange(ctx, scan.Equals, scan.Equals, Both, handler)
+	} else if scan.ScanType == RangeReq || scan.ScanType == FilterRangeReq {
+		return ranger.ReverseRange(ctx, scan.Low, scan.High, scan.Incl, handler)
+	}
+	return nil
+}
+
+// bufferedReverseScan serves reverse scan on storage that iterates only
+// forward, the range is scanned forward into a buffer and replayed last
+// to first. Scan fails with ErrReverseScanLimit if the buffered entries
+// exceed `bufLimit` bytes, 0 is unbounded.
+func bufferedReverseScan(ctx IndexReaderContext, snap SliceSnapshot, scan Scan,
+	bufLimit int64, handler EntryCallback) error {
+
+	var entries [][]byte
+	var size int64
+	collect := func(entry []byte) error {
+		size += int64(len(entry))
+		if bufLimit > 0 && size > bufLimit {
+			return ErrReverseScanLimit
+		}
+		// copy, storage may reuse the entry buffer.
+		entries = append(entries, append([]byte(nil), entry...))
+		return nil
+	}
+
+	var err error
+	if scan.ScanType == AllReq {
+		err = snap.Snapshot().All(ctx, collect)
+	} else if scan.ScanType == LookupReq {
+		err = snap.Snapshot().Range(ctx, scan.Equals, scan.Equals, Both, collect)
+	} else if scan.ScanType == RangeReq || scan.ScanType == FilterRangeReq {
+		err = snap.Snapshot().Range(ctx, scan.Low, scan.High, scan.Incl, collect)
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := handler(entries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 //--------------------------
 // scatter count
 //--------------------------
@@ -335,20 +401,22 @@ func multiCountSingleSlice(request *ScanRequest, scan Scan, ctx IndexReaderConte
 // scatter stats
 //--------------------------
 
-func scatterStats(request *ScanRequest, snapshots []SliceSnapshot, stop StopChannel) (count uint64, err error) {
+func scatterStats(request *ScanRequest, snapshots []SliceSnapshot, nbins int,
+	stop StopChannel) (stats *protobuf.IndexStatistics, err error) {
 
 	if len(snapshots) == 0 {
-		return
+		return newStatsCollector(nbins, request.isPrimary, false).statistics()
 	}
 
 	var wg sync.WaitGroup
 
 	errch := make(chan error, len(snapshots))
+	results := make([]*protobuf.IndexStatistics, len(snapshots))
 
 	// run scatter
 	for i, snap := range snapshots {
 		wg.Add(1)
-		go statsSingleSlice(request, request.Ctxs[i], snap, &wg, errch, stop, &count)
+		go statsSingleSlice(request, request.Ctxs[i], snap, nbins, &wg, errch, stop, &results[i])
 	}
 
 	// wait for scatter to be done
@@ -356,31 +424,77 @@ func scatterStats(request *ScanRequest, snapshots []SliceSnapshot, stop StopChan
 
 	if len(errch) > 0 {
 		err = <-errch
+		return
 	}
 
-	return
+	return protobuf.MergeStatistics(nbins, results...)
 }
 
-func statsSingleSlice(request *ScanRequest, ctx IndexReaderContext, snap SliceSnapshot, wg *sync.WaitGroup,
-	errch chan error, stopch StopChannel, count *uint64) {
+func statsSingleSlice(request *ScanRequest, ctx IndexReaderContext, snap SliceSnapshot, nbins int,
+	wg *sync.WaitGroup, errch chan error, stopch StopChannel, stats **protobuf.IndexStatistics) {
 
 	defer func() {
 		wg.Done()
 	}()
 
 	var err error
-	var cnt uint64
 
-	if request.Low.Bytes() == nil && request.Low.Bytes() == nil {
-		cnt, err = snap.Snapshot().StatCountTotal()
-	} else {
-		cnt, err = snap.Snapshot().CountRange(ctx, request.Low, request.High, request.Incl, stopch)
+	defn := request.IndexInst.Defn
+	hasDesc := defn.HasDescending()
+	collector := newStatsCollector(nbins, request.isPrimary, len(defn.SecExprs) > 1)
+
+	var revbuf *[]byte
+	if hasDesc {
+		revbuf = secKeyBufPool.Get()
+		defer secKeyBufPool.Put(revbuf)
+	}
+
+	callb := func(entry []byte) error {
+		select {
+		case <-stopch:
+			return common.ErrClientCancel
+		default:
+		}
+
+		if request.isPrimary {
+			return collector.addKey(entry, 1)
+		}
+
+		//get the key in original format
+		if hasDesc {
+			//copy is required, otherwise storage may get updated if storage
+			//returns pointer to original item(e.g. memdb)
+			*revbuf = append((*revbuf)[:0], entry...)
+			if _, err := jsonEncoder.ReverseCollate(*revbuf, defn.Desc); err != nil {
+				return err
+			}
+			entry = *revbuf
+		}
+
+		e := secondaryIndexEntry(entry)
+		return collector.addKey(entry[:e.lenKey()], uint64(e.Count()))
+	}
+
+	switch {
+	case len(request.Keys) > 0:
+		// lookup of a key is a range on the key.
+		for _, key := range request.Keys {
+			if err = snap.Snapshot().Range(ctx, key, key, Both, callb); err != nil {
+				break
+			}
+		}
+	case request.Low.Bytes() == nil && request.High.Bytes() == nil:
+		err = snap.Snapshot().All(ctx, callb)
+	default:
+		err = snap.Snapshot().Range(ctx, request.Low, request.High, request.Incl, callb)
+	}
+
+	if err == nil {
+		*stats, err = collector.statistics()
 	}
 
 	if err != nil {
 		errch <- err
-	} else {
-		atomic.AddUint64(count, cnt)
 	}
 }
 
@@ -678,11 +792,18 @@ func forward(request *ScanRequest, queues []*Queue, donech chan bool, notifych c
 
 func compareKey(request *ScanRequest, k1 *Row, k2 *Row) int {
 
+	var r int
 	if request.isPrimary {
-		return comparePrimaryKey(k1, k2)
+		r = comparePrimaryKey(k1, k2)
+	} else {
+		r = compareSecKey(k1, k2)
 	}
 
-	return compareSecKey(k1, k2)
+	// rows from each partition arrive in descending order
+	if request.Reverse {
+		return -r
+	}
+	return r
 }
 
 func comparePrimaryKey(k1 *Row, k2 *Row) int {
@@ -0,0 +1,46 @@
+package indexer
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestReverseScanForwardOnlyStorage(t *testing.T) {
+	snap := &statsTestSnapshot{}
+	for i := 0; i < 5; i++ {
+		snap.keys = append(snap.keys, []byte(fmt.Sprintf("doc%d", i)))
+	}
+
+	var got []string
+	handler := func(entry []byte) error {
+		got = append(got, string(entry))
+		return nil
+	}
+	ss := &sliceSnapshot{snap: snap}
+	if err := reverseScanSingleSlice(nil, ss, Scan{ScanType: AllReq}, 0, handler); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "[doc4 doc3 doc2 doc1 doc0]" {
+		t.Errorf("unexpected reverse scan %v", got)
+	}
+
+	got = nil
+	low, _ := NewPrimaryKey([]byte("doc1"))
+	high, _ := NewPrimaryKey([]byte("doc3"))
+	scan := Scan{ScanType: RangeReq, Low: low, High: high, Incl: Both}
+	if err := reverseScanSingleSlice(nil, ss, scan, 0, handler); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "[doc3 doc2 doc1]" {
+		t.Errorf("unexpected reverse range scan %v", got)
+	}
+
+	// entries past the buffer limit fail the scan.
+	got = nil
+	if err := reverseScanSingleSlice(nil, ss, Scan{ScanType: AllReq}, 8, handler); err != ErrReverseScanLimit {
+		t.Errorf("expected %v, got %v", ErrReverseScanLimit, err)
+	}
+	if len(got) != 0 {
+		t.Errorf("unexpected entries of a failed reverse scan %v", got)
+	}
+}
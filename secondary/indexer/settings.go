@@ -406,6 +406,10 @@ func setLogger(config common.Config) {
 	level := logging.Level(logLevel)
 	logging.Infof("Setting log level to %v", level)
 	logging.SetLogLevel(level)
+
+	format := logging.Format(config["indexer.settings.log_format"].String())
+	logging.Infof("Setting log format to %v", format)
+	logging.SetLogFormat(format)
 }
 
 func setBlockPoolSize(o, n common.Config) {
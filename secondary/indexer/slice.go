@@ -10,9 +10,14 @@
 package indexer
 
 import (
+	"errors"
+
 	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
 )
 
+var ErrNoSnapshotForBackup = errors.New("No Persisted Snapshot Found For Backup")
+
 type SliceId uint64
 
 type SliceStatus int16
@@ -41,6 +46,10 @@ type Slice interface {
 
 	UpdateConfig(common.Config)
 
+	//Copy the files of the latest persisted snapshot to the
+	//given directory and return the snapshot info
+	Backup(dir string) (SnapshotInfo, error)
+
 	IndexWriter
 	GetReaderContext() IndexReaderContext
 }
@@ -50,6 +59,7 @@ type Slice interface {
 // for distinct rows
 type cursorCtx struct {
 	cursor *[]byte
+	log    *logging.Entry
 }
 
 func (ctx *cursorCtx) Init(donech chan bool) bool {
@@ -66,3 +76,22 @@ func (ctx *cursorCtx) SetCursorKey(cur *[]byte) {
 func (ctx *cursorCtx) GetCursorKey() *[]byte {
 	return ctx.cursor
 }
+
+func (ctx *cursorCtx) SetLogger(log *logging.Entry) {
+	ctx.log = log
+}
+
+// Logger returns the logger of the scan request, nil entry logs
+// without request fields.
+func (ctx *cursorCtx) Logger() *logging.Entry {
+	return ctx.log
+}
+
+// readerLogger returns the logger of the scan request reading through
+// `ctx`, a nil entry if there is no reader context.
+func readerLogger(ctx IndexReaderContext) *logging.Entry {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Logger()
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+var (
+	ErrSnapshotLeaseNotFound = errors.New("Snapshot lease not found or expired")
+	ErrSnapshotLeaseMismatch = errors.New("Snapshot lease does not belong to index")
+	ErrSnapshotLeaseLimit    = errors.New("Too many snapshot leases")
+)
+
+// interval at which expired snapshot leases are released.
+const snapshotLeaseReapInterval = time.Second
+
+//--------------------------
+// snapshot leases
+//--------------------------
+
+// snapshotLeaseContainer retains index snapshots on behalf of queryport
+// clients that want to run several scans against the same point-in-time.
+// Every lease holds one reference on the snapshot, which is dropped when
+// the client closes the lease, when the lease expires without being used,
+// or when the index instance goes away. Lease ids are random, so that a
+// client cannot guess the lease of another client.
+type snapshotLeaseContainer struct {
+	mu     sync.Mutex
+	leases map[uint64]*snapshotLease
+	donech chan bool
+}
+
+type snapshotLease struct {
+	instId common.IndexInstId
+	defnId common.IndexDefnId
+	snap   IndexSnapshot
+	lease  time.Duration
+	expiry time.Time
+}
+
+func newSnapshotLeaseContainer() *snapshotLeaseContainer {
+	lc := &snapshotLeaseContainer{
+		leases: make(map[uint64]*snapshotLease),
+		donech: make(chan bool),
+	}
+	go lc.run()
+	return lc
+}
+
+// add takes over the reference held on `snap` and returns the id of the
+// lease, the caller shall not destroy the snapshot after this call.
+func (lc *snapshotLeaseContainer) add(instId common.IndexInstId,
+	defnId common.IndexDefnId, snap IndexSnapshot, lease time.Duration,
+	maxLeases int) (uint64, error) {
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	if maxLeases > 0 && len(lc.leases) >= maxLeases {
+		return 0, ErrSnapshotLeaseLimit
+	}
+
+	id, err := lc.newLeaseId()
+	if err != nil {
+		return 0, err
+	}
+	lc.leases[id] = &snapshotLease{
+		instId: instId,
+		defnId: defnId,
+		snap:   snap,
+		lease:  lease,
+		expiry: time.Now().Add(lease),
+	}
+	return id, nil
+}
+
+// newLeaseId returns a random id not used by any other lease, 0 is not a
+// valid id as it means no lease in scan requests.
+func (lc *snapshotLeaseContainer) newLeaseId() (uint64, error) {
+	for {
+		uuid, err := common.NewUUID()
+		if err != nil {
+			return 0, err
+		}
+		id := uuid.Uint64()
+		if _, ok := lc.leases[id]; id != 0 && !ok {
+			return id, nil
+		}
+	}
+}
+
+// get a new reference on the leased snapshot and renew the lease, caller
+// shall destroy the returned snapshot once the scan is done.
+func (lc *snapshotLeaseContainer) get(id uint64,
+	instId common.IndexInstId) (IndexSnapshot, error) {
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	l, ok := lc.leases[id]
+	if !ok || time.Now().After(l.expiry) {
+		return nil, ErrSnapshotLeaseNotFound
+	} else if l.instId != instId {
+		return nil, ErrSnapshotLeaseMismatch
+	}
+	l.expiry = time.Now().Add(l.lease)
+	return CloneIndexSnapshot(l.snap), nil
+}
+
+// release the lease and drop its reference on the snapshot, the lease
+// shall have been opened on index `defnId`.
+func (lc *snapshotLeaseContainer) release(id uint64,
+	defnId common.IndexDefnId) error {
+
+	lc.mu.Lock()
+	l, ok := lc.leases[id]
+	if !ok {
+		lc.mu.Unlock()
+		return ErrSnapshotLeaseNotFound
+	} else if l.defnId != defnId {
+		lc.mu.Unlock()
+		return ErrSnapshotLeaseMismatch
+	}
+	delete(lc.leases, id)
+	lc.mu.Unlock()
+
+	DestroyIndexSnapshot(l.snap)
+	return nil
+}
+
+// prune leases of index instances not present in `indexInstMap`.
+func (lc *snapshotLeaseContainer) prune(indexInstMap common.IndexInstMap) {
+	lc.releaseIf(func(id uint64, l *snapshotLease) bool {
+		_, ok := indexInstMap[l.instId]
+		return !ok
+	})
+}
+
+func (lc *snapshotLeaseContainer) expire(now time.Time) {
+	lc.releaseIf(func(id uint64, l *snapshotLease) bool {
+		if now.After(l.expiry) {
+			logging.Infof("ScanCoordinator: snapshot lease %v for inst %v expired",
+				id, l.instId)
+			return true
+		}
+		return false
+	})
+}
+
+func (lc *snapshotLeaseContainer) releaseIf(
+	cond func(id uint64, l *snapshotLease) bool) {
+
+	var snaps []IndexSnapshot
+
+	lc.mu.Lock()
+	for id, l := range lc.leases {
+		if cond(id, l) {
+			snaps = append(snaps, l.snap)
+			delete(lc.leases, id)
+		}
+	}
+	lc.mu.Unlock()
+
+	for _, snap := range snaps {
+		DestroyIndexSnapshot(snap)
+	}
+}
+
+func (lc *snapshotLeaseContainer) run() {
+	ticker := time.NewTicker(snapshotLeaseReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			lc.expire(now)
+		case <-lc.donech:
+			return
+		}
+	}
+}
+
+// close releases all leases and stops the reaper.
+func (lc *snapshotLeaseContainer) close() {
+	close(lc.donech)
+	lc.releaseIf(func(uint64, *snapshotLease) bool { return true })
+}
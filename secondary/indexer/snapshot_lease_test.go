@@ -0,0 +1,138 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+// leaseTestSnapshot counts the references held on it, methods not
+// overridden are not called by snapshot leases.
+type leaseTestSnapshot struct {
+	Snapshot
+	refCount int
+}
+
+func (s *leaseTestSnapshot) Open() error {
+	s.refCount++
+	return nil
+}
+
+func (s *leaseTestSnapshot) Close() error {
+	s.refCount--
+	return nil
+}
+
+func newLeaseTestSnapshot(instId common.IndexInstId) (IndexSnapshot, *leaseTestSnapshot) {
+	snap := &leaseTestSnapshot{refCount: 1}
+	ss := &sliceSnapshot{snap: snap}
+	ps := &partitionSnapshot{slices: map[SliceId]SliceSnapshot{0: ss}}
+	is := &indexSnapshot{
+		instId: instId,
+		partns: map[common.PartitionId]PartitionSnapshot{0: ps},
+	}
+	return is, snap
+}
+
+func TestSnapshotLease(t *testing.T) {
+	lc := newSnapshotLeaseContainer()
+	defer lc.close()
+
+	is, snap := newLeaseTestSnapshot(1)
+	id, err := lc.add(1, 10, is, time.Minute, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if id == 0 {
+		t.Fatalf("expected non-zero lease id")
+	}
+
+	if _, err := lc.get(id+1, 1); err != ErrSnapshotLeaseNotFound {
+		t.Errorf("expected %v for unknown lease, got %v", ErrSnapshotLeaseNotFound, err)
+	}
+	if _, err := lc.get(id, 2); err != ErrSnapshotLeaseMismatch {
+		t.Errorf("expected %v for other instance, got %v", ErrSnapshotLeaseMismatch, err)
+	}
+
+	scanSnap, err := lc.get(id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.refCount != 2 {
+		t.Errorf("expected 2 references during scan, got %v", snap.refCount)
+	}
+	DestroyIndexSnapshot(scanSnap)
+
+	if err := lc.release(id, 20); err != ErrSnapshotLeaseMismatch {
+		t.Errorf("expected %v for other index, got %v", ErrSnapshotLeaseMismatch, err)
+	}
+	if snap.refCount != 1 {
+		t.Errorf("expected lease to hold its reference, got %v", snap.refCount)
+	}
+	if err := lc.release(id, 10); err != nil {
+		t.Fatal(err)
+	}
+	if snap.refCount != 0 {
+		t.Errorf("expected no references after release, got %v", snap.refCount)
+	}
+	if err := lc.release(id, 10); err != ErrSnapshotLeaseNotFound {
+		t.Errorf("expected %v for released lease, got %v", ErrSnapshotLeaseNotFound, err)
+	}
+}
+
+func TestSnapshotLeaseIds(t *testing.T) {
+	lc := newSnapshotLeaseContainer()
+	defer lc.close()
+
+	ids := make(map[uint64]bool)
+	var prev uint64
+	sequential := true
+	for i := 0; i < 100; i++ {
+		is, _ := newLeaseTestSnapshot(1)
+		id, err := lc.add(1, 10, is, time.Minute, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id == 0 || ids[id] {
+			t.Fatalf("expected unique non-zero lease id, got %v", id)
+		}
+		if i > 0 && id != prev+1 {
+			sequential = false
+		}
+		ids[id], prev = true, id
+	}
+	if sequential {
+		t.Errorf("expected lease ids not to be sequential")
+	}
+
+	is, _ := newLeaseTestSnapshot(1)
+	if _, err := lc.add(1, 10, is, time.Minute, 100); err != ErrSnapshotLeaseLimit {
+		t.Errorf("expected %v, got %v", ErrSnapshotLeaseLimit, err)
+	}
+}
+
+func TestSnapshotLeaseExpiry(t *testing.T) {
+	lc := newSnapshotLeaseContainer()
+	defer lc.close()
+
+	is1, snap1 := newLeaseTestSnapshot(1)
+	id1, _ := lc.add(1, 10, is1, time.Minute, 0)
+	is2, snap2 := newLeaseTestSnapshot(2)
+	id2, _ := lc.add(2, 20, is2, time.Hour, 0)
+
+	lc.expire(time.Now().Add(2 * time.Minute))
+	if _, err := lc.get(id1, 1); err != ErrSnapshotLeaseNotFound {
+		t.Errorf("expected expired lease, got %v", err)
+	}
+	if snap1.refCount != 0 {
+		t.Errorf("expected expired lease to be released, got %v", snap1.refCount)
+	}
+
+	lc.prune(common.IndexInstMap{1: common.IndexInst{InstId: 1}})
+	if _, err := lc.get(id2, 2); err != ErrSnapshotLeaseNotFound {
+		t.Errorf("expected lease of dropped instance to be released, got %v", err)
+	}
+	if snap2.refCount != 0 {
+		t.Errorf("expected no references on snapshot of dropped instance, got %v", snap2.refCount)
+	}
+}
@@ -53,6 +53,13 @@ type BucketStats struct {
 
 	tsQueueSize   stats.Int64Val
 	numNonAlignTS stats.Int64Val
+
+	// stream status and mutations received but not flushed,
+	// updated by timekeeper
+	maintStreamStatus stats.Int64Val
+	maintFlushLag     stats.Int64Val
+	initStreamStatus  stats.Int64Val
+	initFlushLag      stats.Int64Val
 }
 
 func (s *BucketStats) Init() {
@@ -61,6 +68,10 @@ func (s *BucketStats) Init() {
 	s.numMutationsQueued.Init()
 	s.tsQueueSize.Init()
 	s.numNonAlignTS.Init()
+	s.maintStreamStatus.Init()
+	s.maintFlushLag.Init()
+	s.initStreamStatus.Init()
+	s.initFlushLag.Init()
 }
 
 type IndexTimingStats struct {
@@ -135,6 +146,7 @@ type IndexStats struct {
 	numRowsScanned            stats.Int64Val
 	diskSize                  stats.Int64Val
 	memUsed                   stats.Int64Val
+	aggrMemUsed               stats.Int64Val // materialized aggregates
 	buildProgress             stats.Int64Val
 	completionProgress        stats.Int64Val
 	numDocsQueued             stats.Int64Val
@@ -206,6 +218,8 @@ type IndexStats struct {
 	lastNumRequests  stats.Int64Val
 	avgScanLatency   stats.Int64Val
 
+	scanLatencyDist stats.Histogram
+
 	Timings IndexTimingStats
 }
 
@@ -281,6 +295,7 @@ func (s *IndexStats) Init() {
 	s.numRowsScanned.Init()
 	s.diskSize.Init()
 	s.memUsed.Init()
+	s.aggrMemUsed.Init()
 	s.buildProgress.Init()
 	s.completionProgress.Init()
 	s.numDocsQueued.Init()
@@ -352,6 +367,8 @@ func (s *IndexStats) Init() {
 	s.lastNumRequests.Init()
 	s.avgScanLatency.Init()
 
+	s.scanLatencyDist.Init(stats.LatencyBuckets, nil)
+
 	s.Timings.Init()
 
 	s.partitions = make(map[common.PartitionId]*IndexStats)
@@ -478,6 +495,8 @@ type IndexerStats struct {
 	buckets map[string]*BucketStats
 
 	numConnections     stats.Int64Val
+	qpUncompressed     stats.Int64Val
+	qpCompressed       stats.Int64Val
 	memoryQuota        stats.Int64Val
 	memoryUsed         stats.Int64Val
 	memoryUsedStorage  stats.Int64Val
@@ -487,6 +506,13 @@ type IndexerStats struct {
 	statsResponse      stats.TimingStat
 	notFoundError      stats.Int64Val
 
+	// TLS handshakes on queryport and dataport.
+	tlsHandshakes       stats.Int64Val
+	tlsNoCertificate    stats.Int64Val
+	tlsBadCertificate   stats.Int64Val
+	tlsIdentityRejected stats.Int64Val
+	tlsHandshakeErrors  stats.Int64Val
+
 	indexerState  stats.Int64Val
 	prjLatencyMap *LatencyMapHolder
 }
@@ -495,6 +521,8 @@ func (s *IndexerStats) Init() {
 	s.indexes = make(map[common.IndexInstId]*IndexStats)
 	s.buckets = make(map[string]*BucketStats)
 	s.numConnections.Init()
+	s.qpUncompressed.Init()
+	s.qpCompressed.Init()
 	s.memoryQuota.Init()
 	s.memoryUsed.Init()
 	s.memoryUsedStorage.Init()
@@ -504,6 +532,11 @@ func (s *IndexerStats) Init() {
 	s.statsResponse.Init()
 	s.indexerState.Init()
 	s.notFoundError.Init()
+	s.tlsHandshakes.Init()
+	s.tlsNoCertificate.Init()
+	s.tlsBadCertificate.Init()
+	s.tlsIdentityRejected.Init()
+	s.tlsHandshakeErrors.Init()
 	s.prjLatencyMap = &LatencyMapHolder{}
 	s.prjLatencyMap.Init()
 }
@@ -662,7 +695,14 @@ func (is IndexerStats) GetStats(getPartition bool, skipEmpty bool,
 	addStat("timestamp", fmt.Sprintf("%v", time.Now().UnixNano()))
 	addStat("uptime", fmt.Sprintf("%s", time.Since(uptime)))
 	addStat("num_connections", is.numConnections.Value())
+	addStat("queryport_bytes_uncompressed", is.qpUncompressed.Value())
+	addStat("queryport_bytes_compressed", is.qpCompressed.Value())
 	addStat("index_not_found_errcount", is.notFoundError.Value())
+	addStat("tls_handshakes", is.tlsHandshakes.Value())
+	addStat("tls_handshake_failures_no_certificate", is.tlsNoCertificate.Value())
+	addStat("tls_handshake_failures_bad_certificate", is.tlsBadCertificate.Value())
+	addStat("tls_handshake_failures_identity_rejected", is.tlsIdentityRejected.Value())
+	addStat("tls_handshake_failures_other", is.tlsHandshakeErrors.Value())
 	addStat("memory_quota", is.memoryQuota.Value())
 	addStat("memory_used", is.memoryUsed.Value())
 	addStat("memory_used_storage", is.memoryUsedStorage.Value())
@@ -778,6 +818,11 @@ func (is IndexerStats) GetStats(getPartition bool, skipEmpty bool,
 			s.partnInt64Stats(func(ss *IndexStats) int64 {
 				return ss.memUsed.Value()
 			}))
+		// partition stats
+		addStat("materialized_aggr_memory_used",
+			s.partnInt64Stats(func(ss *IndexStats) int64 {
+				return ss.aggrMemUsed.Value()
+			}))
 		addStat("build_progress",
 			s.int64Stats(func(ss *IndexStats) int64 {
 				return ss.buildProgress.Value()
@@ -1160,6 +1205,23 @@ func (is IndexerStats) GetVersionedStats(t *target) (common.Statistics, bool) {
 				break
 			}
 		}
+	} else if t.level == "bucket" {
+		if b, ok := is.buckets[t.resource]; ok {
+			statsMap[b.bucket] = is.constructBucketStats(b, t.skipEmpty, t.version)
+			found = true
+		}
+	}
+
+	if len(t.statNames) != 0 {
+		for _, v := range statsMap {
+			if m, ok := v.(common.Statistics); ok {
+				for name := range m {
+					if !t.statNames[name] {
+						delete(m, name)
+					}
+				}
+			}
+		}
 	}
 	return statsMap, found
 }
@@ -1204,6 +1266,84 @@ func (is IndexerStats) constructIndexerStats(skipEmpty bool, version string) com
 	return indexerStats
 }
 
+// constructBucketStats aggregates the stats of the indexes of a bucket.
+// Scan latency is averaged over the indexes weighted by their requests.
+func (is IndexerStats) constructBucketStats(b *BucketStats, skipEmpty bool,
+	version string) common.Statistics {
+
+	bucketStats := make(map[string]interface{})
+	addStat := addStatFactory(skipEmpty, bucketStats)
+
+	switch version {
+	case "v1":
+		var numIndexes, itemsCount, dataSize, diskSize int64
+		var docsIndexed, docsPending, docsQueued int64
+		var reqs, weightedScanLatency int64
+
+		for _, s := range is.indexes {
+			if s.bucket != b.bucket {
+				continue
+			}
+
+			numIndexes++
+			itemsCount += s.partnInt64Stats(func(ss *IndexStats) int64 {
+				return ss.itemsCount.Value()
+			})
+			dataSize += s.partnInt64Stats(func(ss *IndexStats) int64 {
+				return ss.dataSize.Value()
+			})
+			diskSize += s.partnInt64Stats(func(ss *IndexStats) int64 {
+				return ss.diskSize.Value()
+			})
+			docsIndexed += s.partnInt64Stats(func(ss *IndexStats) int64 {
+				return ss.numDocsIndexed.Value()
+			})
+			docsPending += s.int64Stats(func(ss *IndexStats) int64 {
+				return ss.numDocsPending.Value()
+			})
+			docsQueued += s.int64Stats(func(ss *IndexStats) int64 {
+				return ss.numDocsQueued.Value()
+			})
+
+			indexReqs := s.int64Stats(func(ss *IndexStats) int64 {
+				return ss.numRequests.Value()
+			})
+			reqs += indexReqs
+			weightedScanLatency += s.avgScanLatency.Value() * indexReqs
+		}
+
+		avgScanLatency := int64(0)
+		if reqs != 0 {
+			avgScanLatency = weightedScanLatency / reqs
+		}
+
+		addStat("num_indexes", numIndexes)
+		addStat("items_count", itemsCount)
+		addStat("data_size", dataSize)
+		addStat("disk_size", diskSize)
+		addStat("num_docs_indexed", docsIndexed)
+		addStat("num_docs_pending", docsPending)
+		addStat("num_docs_queued", docsQueued)
+		addStat("num_requests", reqs)
+		addStat("avg_scan_latency", avgScanLatency)
+
+		addStat("num_rollbacks", b.numRollbacks.Value())
+		addStat("mutation_queue_size", b.mutationQueueSize.Value())
+		addStat("num_mutations_queued", b.numMutationsQueued.Value())
+		addStat("ts_queue_size", b.tsQueueSize.Value())
+		addStat("num_nonalign_ts", b.numNonAlignTS.Value())
+
+		addStat("maint_stream_status",
+			fmt.Sprintf("%v", StreamStatus(b.maintStreamStatus.Value())))
+		addStat("maint_stream_flush_lag", b.maintFlushLag.Value())
+		addStat("init_stream_status",
+			fmt.Sprintf("%v", StreamStatus(b.initStreamStatus.Value())))
+		addStat("init_stream_flush_lag", b.initFlushLag.Value())
+	}
+
+	return bucketStats
+}
+
 func (s *IndexStats) constructIndexStats(skipEmpty bool, version string) common.Statistics {
 	indexStats := make(map[string]interface{})
 	addStat := addStatFactory(skipEmpty, indexStats)
@@ -1420,6 +1560,7 @@ func (s *statsManager) RegisterRestEndpoints() {
 	mux.HandleFunc("/stats/storage/mm", s.handleStorageMMStatsReq)
 	mux.HandleFunc("/stats/storage", s.handleStorageStatsReq)
 	mux.HandleFunc("/stats/reset", s.handleStatsResetReq)
+	mux.HandleFunc("/metrics", s.handleMetricsReq)
 }
 
 func (s *statsManager) tryUpdateStats(sync bool) {
@@ -1767,6 +1908,7 @@ const last_known_scan_time = "lqt" //last_query_time
 const avg_scan_rate = "asr"
 const num_rows_scanned = "nrs"
 const last_num_rows_scanned = "lrs"
+const lead_key_histogram = "lkh"
 const chunkSz = "chunkSz"
 
 // Periodically persist a subset of index stats
@@ -1794,6 +1936,9 @@ func (s *statsManager) runStatsPersister() {
 						statsToBePersisted[instdId+":"+partnId+":"+avg_scan_rate] = partnStats.avgScanRate.Value()
 						statsToBePersisted[instdId+":"+partnId+":"+num_rows_scanned] = partnStats.numRowsScanned.Value()
 						statsToBePersisted[instdId+":"+partnId+":"+last_num_rows_scanned] = partnStats.lastNumRowsScanned.Value()
+						if hist, ok := leadKeyHistograms.marshal(k, pk); ok {
+							statsToBePersisted[instdId+":"+partnId+":"+lead_key_histogram] = hist
+						}
 					}
 				}
 				err := s.statsPersister.PersistStats(statsToBePersisted)
@@ -1897,6 +2042,13 @@ func (s *statsManager) updateStatsFromPersistence(indexerStats *IndexerStats) {
 				if ok {
 					indexerStats.indexes[instdId].partitions[partnId].lastNumRowsScanned.Set(val)
 				}
+			case lead_key_histogram:
+				val, ok := value.(string)
+				if !ok {
+					logging.Warnf("StatsPersister: Unable to read stat %v from persistence. Skipping the stat", statName)
+				} else if err := leadKeyHistograms.restore(instdId, partnId, val); err != nil {
+					logging.Warnf("StatsPersister: Unable to restore stat %v. Skipping the stat. Error: %v", statName, err)
+				}
 			}
 		}
 	}
@@ -0,0 +1,97 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestBucketStats(t *testing.T) {
+	is := NewIndexerStats()
+
+	is.AddIndex(1, "b1", "idx1", 0, false)
+	is.AddPartition(2, "b1", "idx2", 0, 1, false)
+	is.AddPartition(2, "b1", "idx2", 0, 2, false)
+	is.AddIndex(3, "b2", "idx3", 0, false)
+
+	idx1 := is.indexes[1]
+	idx1.itemsCount.Set(100)
+	idx1.dataSize.Set(1000)
+	idx1.numDocsPending.Set(5)
+	idx1.numRequests.Set(10)
+	idx1.avgScanLatency.Set(100)
+
+	// partitioned index, sizes are summed over the partitions
+	idx2 := is.indexes[2]
+	idx2.partitions[1].itemsCount.Set(20)
+	idx2.partitions[2].itemsCount.Set(30)
+	idx2.partitions[1].dataSize.Set(200)
+	idx2.partitions[2].dataSize.Set(300)
+	idx2.numRequests.Set(30)
+	idx2.avgScanLatency.Set(200)
+
+	idx3 := is.indexes[3]
+	idx3.itemsCount.Set(1000)
+	idx3.numRequests.Set(1000)
+	idx3.avgScanLatency.Set(1000)
+
+	b1 := is.buckets["b1"]
+	b1.numRollbacks.Set(2)
+	b1.maintStreamStatus.Set(int64(STREAM_ACTIVE))
+	b1.maintFlushLag.Set(7)
+
+	statsMap, found := is.GetVersionedStats(&target{version: "v1", level: "bucket", resource: "b1"})
+	if !found {
+		t.Fatalf("expected stats of bucket b1")
+	}
+	if len(statsMap) != 1 {
+		t.Fatalf("expected stats of only bucket b1, got %v", statsMap)
+	}
+	bucketStats, ok := statsMap["b1"].(common.Statistics)
+	if !ok {
+		t.Fatalf("unexpected stats %v", statsMap)
+	}
+
+	expected := map[string]interface{}{
+		"num_indexes":            int64(2),
+		"items_count":            int64(150),
+		"data_size":              int64(1500),
+		"num_docs_pending":       int64(5),
+		"num_requests":           int64(40),
+		"avg_scan_latency":       int64((100*10 + 200*30) / 40),
+		"num_rollbacks":          int64(2),
+		"maint_stream_status":    STREAM_ACTIVE.String(),
+		"maint_stream_flush_lag": int64(7),
+		"init_stream_status":     STREAM_INACTIVE.String(),
+	}
+	for name, value := range expected {
+		if bucketStats[name] != value {
+			t.Errorf("%v: expected %v, got %v", name, value, bucketStats[name])
+		}
+	}
+
+	// only the requested stats
+	statNames := map[string]bool{"items_count": true, "num_requests": true}
+	statsMap, _ = is.GetVersionedStats(&target{version: "v1", level: "bucket", resource: "b1",
+		statNames: statNames})
+	bucketStats = statsMap["b1"].(common.Statistics)
+	if len(bucketStats) != 2 || bucketStats["items_count"] != int64(150) ||
+		bucketStats["num_requests"] != int64(40) {
+		t.Errorf("expected only the requested stats, got %v", bucketStats)
+	}
+
+	// empty stats are skipped
+	statsMap, _ = is.GetVersionedStats(&target{version: "v1", level: "bucket", resource: "b2",
+		skipEmpty: true})
+	bucketStats = statsMap["b2"].(common.Statistics)
+	if _, ok := bucketStats["num_rollbacks"]; ok {
+		t.Errorf("expected empty num_rollbacks to be skipped, got %v", bucketStats)
+	}
+	if bucketStats["avg_scan_latency"] != int64(1000) {
+		t.Errorf("expected avg_scan_latency 1000, got %v", bucketStats["avg_scan_latency"])
+	}
+
+	if _, found := is.GetVersionedStats(&target{version: "v1", level: "bucket", resource: "b3"}); found {
+		t.Errorf("expected no stats of unknown bucket")
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"path/filepath"
 	"sort"
 	"sync"
 	"time"
@@ -192,6 +193,9 @@ func (s *storageMgr) handleSupvervisorCommands(cmd Message) {
 	case STORAGE_INDEX_COMPACT:
 		s.handleIndexCompaction(cmd)
 
+	case STORAGE_INDEX_BACKUP:
+		s.handleIndexBackup(cmd)
+
 	case STORAGE_STATS:
 		s.handleStats(cmd)
 
@@ -378,16 +382,22 @@ func (s *storageMgr) createSnapshotWorker(streamId common.StreamId, bucket strin
 									"PartitionId: %v SliceId: %v Crc64: %v (%v) SnapCreateDur %v SnapOpenDur %v", idxInstId, partnId, slice.Id(), tsVbuuid.Crc64, info, snapCreateDur, snapOpenDur)
 							}
 							ss := &sliceSnapshot{
-								id:   slice.Id(),
-								snap: newSnapshot,
+								id:    slice.Id(),
+								snap:  newSnapshot,
+								aggrs: materializedAggrs.snapshot(&idxInst, partnId, slice, newSnapshot),
 							}
 							sliceSnaps[slice.Id()] = ss
+							if idxStats != nil {
+								leadKeyHistograms.onSnapshot(&idxInst, partnId, slice, newSnapshot,
+									idxStats.getPartitionStats(partnId), s.config)
+							}
 						} else {
 							// Increment reference
 							latestSnapshot.Open()
 							ss := &sliceSnapshot{
-								id:   slice.Id(),
-								snap: latestSnapshot,
+								id:    slice.Id(),
+								snap:  latestSnapshot,
+								aggrs: materializedAggrs.snapshot(&idxInst, partnId, slice, latestSnapshot),
 							}
 							sliceSnaps[slice.Id()] = ss
 							logging.Debugf("StorageMgr::handleCreateSnapshot Skipped Creating New Snapshot for Index %v "+
@@ -754,6 +764,9 @@ func (sm *storageMgr) rollbackToSnapshot(idxInstId common.IndexInstId,
 	partnId common.PartitionId, slice Slice, snapInfo SnapshotInfo,
 	markAsUsed bool) (*common.TsVbuuid, error) {
 
+	// aggregates are seeded again from the rolled back slice.
+	materializedAggrs.reset(idxInstId, partnId)
+
 	var restartTs *common.TsVbuuid
 	if snapInfo != nil {
 		err := slice.Rollback(snapInfo, markAsUsed)
@@ -1007,6 +1020,7 @@ func (s *storageMgr) handleStats(cmd Message) {
 		if idxStats != nil {
 			idxStats.diskSize.Set(st.Stats.DiskSize)
 			idxStats.memUsed.Set(st.Stats.MemUsed)
+			idxStats.aggrMemUsed.Set(materializedAggrs.memoryUsed(st.InstId, st.PartnId))
 			if common.GetStorageMode() != common.MOI {
 				idxStats.fragPercent.Set(int64(st.GetFragmentation()))
 			}
@@ -1316,10 +1330,14 @@ func (s *storageMgr) deepCloneIndexSnapshot(is IndexSnapshot, partnIds []common.
 
 				// increment ref count of each slice snapshot
 				sliceSnap.Snapshot().Open()
-				ps.slices[sliceId] = &sliceSnapshot{
+				clone := &sliceSnapshot{
 					id:   sliceSnap.SliceId(),
 					snap: sliceSnap.Snapshot(),
 				}
+				if ss, ok := sliceSnap.(*sliceSnapshot); ok {
+					clone.aggrs = ss.aggrs
+				}
+				ps.slices[sliceId] = clone
 			}
 
 			clone.partns[partnId] = ps
@@ -1374,6 +1392,63 @@ func (s *storageMgr) handleIndexCompaction(cmd Message) {
 	}()
 }
 
+func (s *storageMgr) handleIndexBackup(cmd Message) {
+	s.supvCmdch <- &MsgSuccess{}
+	req := cmd.(*MsgIndexBackup)
+	bucket := req.GetBucket()
+	dir := req.GetDir()
+
+	var entries []*indexBackupEntry
+	var slices []Slice
+
+	for instId, inst := range s.indexInstMap {
+		//only a built index has a snapshot of all the data
+		if inst.Defn.Bucket != bucket || inst.State != common.INDEX_STATE_ACTIVE ||
+			inst.RState != common.REBAL_ACTIVE || inst.IsProxy() {
+			continue
+		}
+
+		// Increment rc for slices
+		for partnId, partnInst := range s.indexPartnMap[instId] {
+			//there is only one slice for now
+			slice := partnInst.Sc.GetSliceById(0)
+			slice.IncrRef()
+			slices = append(slices, slice)
+
+			entries = append(entries, &indexBackupEntry{
+				Defn:          inst.Defn,
+				InstId:        instId,
+				PartnId:       partnId,
+				NumPartitions: inst.Pc.GetNumPartitions(),
+				Dir:           fmt.Sprintf("%v_%v", instId, partnId),
+			})
+		}
+	}
+
+	// Copy the slice files without blocking storage manager main loop
+	go func() {
+		var err error
+		for i, slice := range slices {
+			if err == nil {
+				var info SnapshotInfo
+				if info, err = slice.Backup(filepath.Join(dir, entries[i].Dir)); err == nil {
+					entries[i].Timestamp = info.Timestamp()
+				} else {
+					logging.Errorf("StorageMgr::handleIndexBackup Error backing up Index %v "+
+						"PartitionId %v. Error %v", entries[i].InstId, entries[i].PartnId, err)
+				}
+			}
+			slice.DecrRef()
+		}
+
+		if err != nil {
+			req.GetErrorChannel() <- err
+			return
+		}
+		req.GetReplyChannel() <- entries
+	}()
+}
+
 // Used for forestdb and memdb slices.
 func (s *storageMgr) openSnapshot(idxInstId common.IndexInstId, partnInst PartitionInst,
 	partnSnapMap PartnSnapMap) (PartnSnapMap, *common.TsVbuuid, error) {
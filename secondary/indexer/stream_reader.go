@@ -723,6 +723,32 @@ func (w *streamWorker) handleSingleKeyVersion(bucket string, vbucket Vbucket, vb
 				w.updateSnapInFilter(meta, w.snapStart, w.snapEnd)
 			}
 
+		case common.SystemEvent, common.UpdateSeqno:
+
+			//seqno of system events and of mutations on other collections
+			//needs to be tracked in the filter
+			if w.evalFilter {
+				w.evalFilter = false
+				w.skipMutation, meta.firstSnap = w.checkAndSetBucketFilter(meta)
+			}
+
+			if w.skipMutation || byte(cmd) != common.SystemEvent {
+				continue
+			}
+
+			eventType, manifestUID, scopeId, collectionId := kv.SystemEvent()
+
+			//send message to supervisor to take decision
+			msg := &MsgStreamSystemEvent{
+				streamId:     w.streamId,
+				meta:         meta.Clone(),
+				eventType:    eventType,
+				manifestUID:  manifestUID,
+				scopeId:      scopeId,
+				collectionId: collectionId,
+			}
+			w.reader.supvRespch <- msg
+
 		}
 	}
 
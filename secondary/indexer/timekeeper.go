@@ -3467,6 +3467,8 @@ func (tk *timekeeper) handleStats(cmd Message) {
 			}
 		}
 
+		tk.updateBucketStreamStats(stats)
+
 		replych <- true
 	}()
 }
@@ -3489,6 +3491,41 @@ func (tk *timekeeper) updateTimestampStats() {
 			idxStats.progressStatTime.Set(time.Now().UnixNano())
 		}
 	}
+
+	tk.updateBucketStreamStats(stats)
+}
+
+//updateBucketStreamStats updates the stream status of every bucket and
+//the number of mutations received (HWT) but not yet flushed.
+//Caller must hold tk.lock.
+func (tk *timekeeper) updateBucketStreamStats(stats *IndexerStats) {
+
+	flushLag := func(streamId common.StreamId, bucket string) int64 {
+		hwt := tk.ss.streamBucketHWTMap[streamId][bucket]
+		if hwt == nil {
+			return 0
+		}
+		flushedTs := tk.ss.streamBucketLastFlushedTsMap[streamId][bucket]
+
+		lag := uint64(0)
+		for i, seqno := range hwt.Seqnos {
+			flushSeqno := uint64(0)
+			if flushedTs != nil {
+				flushSeqno = flushedTs.Seqnos[i]
+			}
+			if seqno > flushSeqno {
+				lag += seqno - flushSeqno
+			}
+		}
+		return int64(lag)
+	}
+
+	for bucket, bStats := range stats.buckets {
+		bStats.maintStreamStatus.Set(int64(tk.ss.streamBucketStatus[common.MAINT_STREAM][bucket]))
+		bStats.maintFlushLag.Set(flushLag(common.MAINT_STREAM, bucket))
+		bStats.initStreamStatus.Set(int64(tk.ss.streamBucketStatus[common.INIT_STREAM][bucket]))
+		bStats.initFlushLag.Set(flushLag(common.INIT_STREAM, bucket))
+	}
 }
 
 func (tk *timekeeper) isBuildCompletionTs(streamId common.StreamId,
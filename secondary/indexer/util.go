@@ -12,7 +12,10 @@ package indexer
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -115,6 +118,87 @@ func GetInstIdPartnIdFromPath(idxPath string) (common.IndexInstId,
 	return common.IndexInstId(instId), common.PartitionId(partnId), nil
 }
 
+// Index path contains the index name.  If the index has been renamed,
+// the existing data of the index is under its old name.  Move it to
+// the new path, so that the index does not lose its data.
+func RecoverRenamedIndexPath(storageDir string, inst *common.IndexInst,
+	partnId common.PartitionId, sliceId SliceId) {
+
+	path := filepath.Join(storageDir, IndexPath(inst, partnId, sliceId))
+	if _, err := os.Stat(path); err == nil || !os.IsNotExist(err) {
+		return
+	}
+
+	pattern := fmt.Sprintf("%s_*_%d_%d.index", inst.Defn.Bucket, GetRealIndexInstId(inst), partnId)
+	matches, err := filepath.Glob(filepath.Join(storageDir, pattern))
+	if err != nil || len(matches) != 1 {
+		return
+	}
+
+	if err := os.Rename(matches[0], path); err != nil {
+		logging.Errorf("RecoverRenamedIndexPath: Fail to move %v to %v. Error %v", matches[0], path, err)
+		return
+	}
+	logging.Infof("RecoverRenamedIndexPath: Moved renamed index data %v to %v", matches[0], path)
+}
+
+// copyFilePrefix copies the first size bytes of source to dest.
+func copyFilePrefix(dest, source string, size int64) error {
+
+	sf, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+
+	df, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer df.Close()
+
+	if _, err := io.CopyN(df, sf, size); err != nil {
+		return err
+	}
+	return df.Sync()
+}
+
+// copyDirPrefix copies the files of an append-only store from source
+// to dest.  The sizes of all the files are taken before any of them is
+// copied, so that the copy is the state of the store at that point.
+func copyDirPrefix(dest, source string) error {
+
+	sizes := make(map[string]int64)
+	walkFn := func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			sizes[path] = fi.Size()
+		}
+		return nil
+	}
+	if err := filepath.Walk(source, walkFn); err != nil {
+		return err
+	}
+
+	for path, size := range sizes {
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dest, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := copyFilePrefix(target, path, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func GetRealIndexInstId(inst *common.IndexInst) common.IndexInstId {
 	instId := inst.InstId
 	if inst.IsProxy() {
@@ -121,6 +121,8 @@ func Level(s string) LogLevel {
 
 type destination struct {
 	baselevel LogLevel
+	format    LogFormat
+	component string
 	target    *l.Logger
 }
 
@@ -240,10 +242,7 @@ func (log *destination) IsEnabled(at LogLevel) bool {
 }
 
 func (log *destination) printf(at LogLevel, format string, v ...interface{}) {
-	if log.IsEnabled(at) {
-		ts := time.Now().Format("2006-01-02T15:04:05.000-07:00")
-		log.target.Printf(ts+" ["+at.String()+"] "+format, v...)
-	}
+	log.printfFields(at, Fields{}, format, v...)
 }
 
 func (log *destination) getStackTrace(skip int, stack []byte) string {
@@ -263,10 +262,16 @@ func init() {
 	SystemLogger = destination{baselevel: Info, target: dest}
 }
 
-// SetLogWriter sets a new default destination
+// SetLogWriter sets a new default destination, the log format and
+// component of the default logger are retained.
 func SetLogWriter(w io.Writer) {
 	dest := l.New(w, "", 0)
-	SystemLogger = destination{baselevel: Info, target: dest}
+	SystemLogger = destination{
+		baselevel: Info,
+		format:    SystemLogger.format,
+		component: SystemLogger.component,
+		target:    dest,
+	}
 }
 
 //
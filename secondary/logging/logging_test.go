@@ -2,11 +2,10 @@ package logging
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
-	"regexp"
 	"strings"
 	"testing"
-	"time"
 )
 
 var buffer *bytes.Buffer
@@ -158,5 +157,59 @@ func TestStackTheTrace(t *testing.T) {
 
 func StackMe() {
 	st := StackTrace()
-	SystemLogger.Errorf(st)
+	SystemLogger.Errorf("%s", st)
+}
+
+func TestJSONFormat(t *testing.T) {
+	buffer.Reset()
+	SetLogFormat(JSONFormat)
+	SetComponent("indexer")
+	SetLogWriter(buffer) // format and component are retained
+	Infof("plain %v\n", 1)
+	WithFields(Fields{Bucket: "default", Index: "idx", RequestId: "r1"}).
+		WithPartition(3).Warnf("scan %v", "slow")
+	Debugf("debug")
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("JSONFormat failed, expected 2 lines %v", lines)
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &m); err != nil {
+		t.Fatalf("JSONFormat failed %v: %v", err, lines[0])
+	} else if m["msg"] != "plain 1" || m["level"] != "Info" || m["component"] != "indexer" {
+		t.Errorf("JSONFormat failed %v", m)
+	} else if _, ok := m["requestId"]; ok {
+		t.Errorf("JSONFormat failed, unexpected requestId %v", m)
+	}
+
+	m = nil
+	if err := json.Unmarshal([]byte(lines[1]), &m); err != nil {
+		t.Fatalf("JSONFormat failed %v: %v", err, lines[1])
+	} else if m["msg"] != "scan slow" || m["level"] != "Warn" ||
+		m["bucket"] != "default" || m["index"] != "idx" ||
+		m["requestId"] != "r1" || m["partition"] != float64(3) {
+		t.Errorf("JSONFormat failed %v", m)
+	}
+	SetLogFormat(TextFormat)
+	SetComponent("")
+	SetLogWriter(os.Stdout)
+}
+
+func TestTextFormatFields(t *testing.T) {
+	buffer.Reset()
+	SetLogWriter(buffer)
+	var e *Entry
+	e.Infof("nil entry")
+	WithFields(Fields{RequestId: "r1"}).Infof("with fields")
+	s := buffer.String()
+	if strings.Contains(s, "nil entry") == false {
+		t.Errorf("Infof() failed %v", s)
+	} else if strings.Contains(s, "with fields") == false {
+		t.Errorf("Infof() failed %v", s)
+	} else if strings.Contains(s, "r1") == true {
+		t.Errorf("TextFormat failed, unexpected fields %v", s)
+	}
+	SetLogWriter(os.Stdout)
 }
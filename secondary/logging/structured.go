@@ -0,0 +1,167 @@
+package logging
+
+import "encoding/json"
+import "fmt"
+import "strings"
+import "time"
+
+// Log formats
+type LogFormat int16
+
+const (
+	// TextFormat logs free-form lines, "<ts> [<level>] <message>".
+	TextFormat LogFormat = iota
+	// JSONFormat logs one JSON object per line, with level, message and
+	// structured fields.
+	JSONFormat
+)
+
+func (f LogFormat) String() string {
+	switch f {
+	case JSONFormat:
+		return "json"
+	default:
+		return "text"
+	}
+}
+
+// Format returns the log format named `s`, defaults to TextFormat.
+func Format(s string) LogFormat {
+	switch strings.ToLower(s) {
+	case "json":
+		return JSONFormat
+	default:
+		return TextFormat
+	}
+}
+
+// Fields identify the request and the data a log message pertains to, so
+// that messages of a request can be correlated across the query client,
+// indexer scan pipeline and storage. Empty fields are omitted.
+type Fields struct {
+	Component string      `json:"component,omitempty"`
+	Bucket    string      `json:"bucket,omitempty"`
+	Index     string      `json:"index,omitempty"`
+	RequestId string      `json:"requestId,omitempty"`
+	Partition interface{} `json:"partition,omitempty"`
+}
+
+// jsonLine is the layout of a log line in JSONFormat.
+type jsonLine struct {
+	Ts    string `json:"ts"`
+	Level string `json:"level"`
+	Fields
+	Msg string `json:"msg"`
+}
+
+// Entry logs messages with structured fields to the default logger.
+// Fields are rendered only in JSONFormat, in TextFormat messages are
+// logged as is. A nil Entry logs without fields.
+type Entry struct {
+	fields Fields
+}
+
+// WithFields returns an entry logging with `fields`.
+func WithFields(fields Fields) *Entry {
+	return &Entry{fields: fields}
+}
+
+// WithPartition returns a copy of the entry for `partition`.
+func (e *Entry) WithPartition(partition interface{}) *Entry {
+	fields := e.Fields()
+	fields.Partition = partition
+	return &Entry{fields: fields}
+}
+
+// Fields of the entry.
+func (e *Entry) Fields() Fields {
+	if e == nil {
+		return Fields{}
+	}
+	return e.fields
+}
+
+func (e *Entry) Warnf(format string, v ...interface{}) {
+	SystemLogger.printfFields(Warn, e.Fields(), format, v...)
+}
+
+func (e *Entry) Errorf(format string, v ...interface{}) {
+	SystemLogger.printfFields(Error, e.Fields(), format, v...)
+}
+
+func (e *Entry) Fatalf(format string, v ...interface{}) {
+	SystemLogger.printfFields(Fatal, e.Fields(), format, v...)
+}
+
+func (e *Entry) Infof(format string, v ...interface{}) {
+	SystemLogger.printfFields(Info, e.Fields(), format, v...)
+}
+
+func (e *Entry) Verbosef(format string, v ...interface{}) {
+	SystemLogger.printfFields(Verbose, e.Fields(), format, v...)
+}
+
+func (e *Entry) Debugf(format string, v ...interface{}) {
+	SystemLogger.printfFields(Debug, e.Fields(), format, v...)
+}
+
+func (e *Entry) Tracef(format string, v ...interface{}) {
+	SystemLogger.printfFields(Trace, e.Fields(), format, v...)
+}
+
+// Check if enabled
+func (e *Entry) IsEnabled(at LogLevel) bool {
+	return SystemLogger.IsEnabled(at)
+}
+
+// Set the log format of destination
+func (log *destination) SetLogFormat(to LogFormat) {
+	log.format = to
+}
+
+// Set the component reported by messages logged without one
+func (log *destination) SetComponent(name string) {
+	log.component = name
+}
+
+func (log *destination) printfFields(at LogLevel, fields Fields,
+	format string, v ...interface{}) {
+
+	if !log.IsEnabled(at) {
+		return
+	}
+
+	ts := time.Now().Format("2006-01-02T15:04:05.000-07:00")
+	if log.format != JSONFormat {
+		log.target.Printf(ts+" ["+at.String()+"] "+format, v...)
+		return
+	}
+
+	if fields.Component == "" {
+		fields.Component = log.component
+	}
+	line := jsonLine{
+		Ts:     ts,
+		Level:  at.String(),
+		Fields: fields,
+		Msg:    strings.TrimRight(fmt.Sprintf(format, v...), "\n"),
+	}
+	data, err := json.Marshal(&line)
+	if err != nil {
+		// fields that cannot be marshalled, log the message alone.
+		line.Partition = nil
+		data, _ = json.Marshal(&line)
+	}
+	log.target.Print(string(data))
+}
+
+// SetLogFormat sets the format of the default logger
+func SetLogFormat(to LogFormat) {
+	SystemLogger.SetLogFormat(to)
+}
+
+// SetComponent sets the component reported by messages logged to the
+// default logger without one, e.g. "indexer" or "projector"
+func SetComponent(name string) {
+	SystemLogger.SetComponent(name)
+}
@@ -16,6 +16,7 @@ import (
 	c "github.com/couchbase/indexing/secondary/common"
 	logging "github.com/couchbase/indexing/secondary/logging"
 	mc "github.com/couchbase/indexing/secondary/manager/common"
+	"reflect"
 )
 
 /////////////////////////////////////////////////////////////////////////
@@ -51,6 +52,10 @@ const (
 	OPCODE_UPDATE_REPLICA_COUNT                     = OPCODE_DROP_INSTANCE + 1
 	OPCODE_GET_REPLICA_COUNT                        = OPCODE_UPDATE_REPLICA_COUNT + 1
 	OPCODE_CHECK_TOKEN_EXIST                        = OPCODE_GET_REPLICA_COUNT + 1
+	OPCODE_DELETE_COLLECTION                        = OPCODE_CHECK_TOKEN_EXIST + 1
+	OPCODE_ALTER_INDEX                              = OPCODE_DELETE_COLLECTION + 1
+	OPCODE_PAUSE_INDEX                              = OPCODE_ALTER_INDEX + 1
+	OPCODE_RESUME_INDEX                             = OPCODE_PAUSE_INDEX + 1
 )
 
 func Op2String(op common.OpCode) string {
@@ -111,6 +116,14 @@ func Op2String(op common.OpCode) string {
 		return "OPCODE_GET_REPLICA_COUNT"
 	case OPCODE_CHECK_TOKEN_EXIST:
 		return "OPCODE_CHECK_TOKEN_EXIST"
+	case OPCODE_DELETE_COLLECTION:
+		return "OPCODE_DELETE_COLLECTION"
+	case OPCODE_ALTER_INDEX:
+		return "OPCODE_ALTER_INDEX"
+	case OPCODE_PAUSE_INDEX:
+		return "OPCODE_PAUSE_INDEX"
+	case OPCODE_RESUME_INDEX:
+		return "OPCODE_RESUME_INDEX"
 	}
 	return fmt.Sprintf("%v", op)
 }
@@ -210,6 +223,129 @@ type CheckToken struct {
 	Flag   uint32        `json:"flag,omitempty"`
 }
 
+/////////////////////////////////////////////////////////////////////////
+// Alter Index
+////////////////////////////////////////////////////////////////////////
+
+//
+// AlterIndexRequest renames an index and/or changes properties which
+// only affect index metadata.  Properties that are not set are left
+// unchanged.  It also creates or drops an aggregate materialized with
+// the index.
+//
+type AlterIndexRequest struct {
+	DefnId             c.IndexDefnId    `json:"defnId,omitempty"`
+	RequesterId        string           `json:"requesterId,omitempty"`
+	Name               string           `json:"name,omitempty"`
+	RetainDeletedXATTR *bool            `json:"retainDeletedXATTR,omitempty"`
+	Deferred           *bool            `json:"deferred,omitempty"`
+	CreateAggregate    *c.AggregateDefn `json:"createAggregate,omitempty"`
+	DropAggregate      string           `json:"dropAggregate,omitempty"`
+	ValidateOnly       bool             `json:"validateOnly,omitempty"`
+}
+
+func (r *AlterIndexRequest) IsEmpty() bool {
+	return r.Name == "" && r.RetainDeletedXATTR == nil && r.Deferred == nil &&
+		r.CreateAggregate == nil && r.DropAggregate == ""
+}
+
+//
+// Inverse returns the request that restores what this request changes to
+// its value in the index definition.
+//
+func (r *AlterIndexRequest) Inverse(defn *c.IndexDefn) *AlterIndexRequest {
+
+	inverse := &AlterIndexRequest{
+		DefnId:      r.DefnId,
+		RequesterId: r.RequesterId,
+	}
+
+	if r.Name != "" {
+		inverse.Name = defn.Name
+	}
+
+	if r.RetainDeletedXATTR != nil {
+		xattr := defn.RetainDeletedXATTR
+		inverse.RetainDeletedXATTR = &xattr
+	}
+
+	if r.Deferred != nil {
+		deferred := defn.Deferred
+		inverse.Deferred = &deferred
+	}
+
+	if r.CreateAggregate != nil {
+		if aggr := defn.FindAggregate(r.CreateAggregate.Name); aggr != nil {
+			existing := *aggr
+			inverse.CreateAggregate = &existing
+		} else {
+			inverse.DropAggregate = r.CreateAggregate.Name
+		}
+	}
+
+	if r.DropAggregate != "" {
+		if aggr := defn.FindAggregate(r.DropAggregate); aggr != nil {
+			existing := *aggr
+			inverse.CreateAggregate = &existing
+		}
+	}
+
+	return inverse
+}
+
+//
+// Apply the request to the index definition. Returns false if the
+// definition is not changed.
+//
+func (r *AlterIndexRequest) Apply(defn *c.IndexDefn) bool {
+
+	changed := false
+
+	if r.Name != "" && r.Name != defn.Name {
+		defn.Name = r.Name
+		changed = true
+	}
+
+	if r.RetainDeletedXATTR != nil && *r.RetainDeletedXATTR != defn.RetainDeletedXATTR {
+		defn.RetainDeletedXATTR = *r.RetainDeletedXATTR
+		changed = true
+	}
+
+	if r.Deferred != nil && *r.Deferred != defn.Deferred {
+		defn.Deferred = *r.Deferred
+		changed = true
+	}
+
+	// definition is a shallow copy, aggregates are replaced and never
+	// updated in place.
+	if r.CreateAggregate != nil {
+		name := r.CreateAggregate.Name
+		if aggr := defn.FindAggregate(name); aggr == nil || !reflect.DeepEqual(*aggr, *r.CreateAggregate) {
+			aggregates := make([]c.AggregateDefn, 0, len(defn.Aggregates)+1)
+			for _, aggr := range defn.Aggregates {
+				if aggr.Name != name {
+					aggregates = append(aggregates, aggr)
+				}
+			}
+			defn.Aggregates = append(aggregates, *r.CreateAggregate)
+			changed = true
+		}
+	}
+
+	if r.DropAggregate != "" && defn.FindAggregate(r.DropAggregate) != nil {
+		aggregates := make([]c.AggregateDefn, 0, len(defn.Aggregates))
+		for _, aggr := range defn.Aggregates {
+			if aggr.Name != r.DropAggregate {
+				aggregates = append(aggregates, aggr)
+			}
+		}
+		defn.Aggregates = aggregates
+		changed = true
+	}
+
+	return changed
+}
+
 /////////////////////////////////////////////////////////////////////////
 // marshalling/unmarshalling
 ////////////////////////////////////////////////////////////////////////
@@ -426,3 +562,23 @@ func MarshallCheckToken(checkToken *CheckToken) ([]byte, error) {
 
 	return buf, nil
 }
+
+func UnmarshallAlterIndexRequest(data []byte) (*AlterIndexRequest, error) {
+
+	request := new(AlterIndexRequest)
+	if err := json.Unmarshal(data, request); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+func MarshallAlterIndexRequest(request *AlterIndexRequest) ([]byte, error) {
+
+	buf, err := json.Marshal(&request)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
@@ -17,6 +17,7 @@ import (
 	gometaL "github.com/couchbase/gometa/log"
 	"github.com/couchbase/gometa/message"
 	"github.com/couchbase/gometa/protocol"
+	"github.com/couchbase/indexing/secondary/collatejson"
 	c "github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/common/queryutil"
 	"github.com/couchbase/indexing/secondary/logging"
@@ -174,7 +175,8 @@ type watcherCallback func(string, c.IndexerId, c.IndexerId)
 var REQUEST_CHANNEL_COUNT = 1000
 
 var VALID_PARAM_NAMES = []string{"nodes", "defer_build", "retain_deleted_xattr",
-	"num_partition", "num_replica", "docKeySize", "secKeySize", "arrSize", "numDoc", "residentRatio"}
+	"num_partition", "num_replica", "docKeySize", "secKeySize", "arrSize", "numDoc", "residentRatio",
+	"partition_boundaries", "collation"}
 
 ///////////////////////////////////////////////////////
 // Public function : MetadataProvider
@@ -368,8 +370,29 @@ func (o *MetadataProvider) CreateIndexWithPlan(
 	scheme c.PartitionScheme, partitionKeys []string,
 	plan map[string]interface{}) (c.IndexDefnId, error, bool) {
 
+	return o.CreateIndexWithPlan2(name, bucket, "", "", using, exprType, whereExpr,
+		secExprs, desc, isPrimary, scheme, partitionKeys, plan)
+}
+
+//
+// CreateIndexWithPlan2 creates index on the given scope and collection.
+// Empty scope or collection refers to the default scope or collection.
+//
+func (o *MetadataProvider) CreateIndexWithPlan2(
+	name, bucket, scope, collection, using, exprType, whereExpr string,
+	secExprs []string, desc []bool, isPrimary bool,
+	scheme c.PartitionScheme, partitionKeys []string,
+	plan map[string]interface{}) (c.IndexDefnId, error, bool) {
+
+	if scope == "" {
+		scope = c.DEFAULT_SCOPE
+	}
+	if collection == "" {
+		collection = c.DEFAULT_COLLECTION
+	}
+
 	// FindIndexByName will only return valid index
-	if o.findIndexByName(name, bucket) != nil {
+	if o.findIndexByName(name, bucket, scope, collection) != nil {
 		return c.IndexDefnId(0), errors.New(fmt.Sprintf("Index %s already exists.", name)), false
 	}
 
@@ -380,6 +403,11 @@ func (o *MetadataProvider) CreateIndexWithPlan(
 		return c.IndexDefnId(0), err, retry
 	}
 
+	if scope != c.DEFAULT_SCOPE || collection != c.DEFAULT_COLLECTION {
+		idxDefn.Scope = scope
+		idxDefn.Collection = collection
+	}
+
 	clusterVersion := o.GetClusterVersion()
 	if clusterVersion < c.INDEXER_55_VERSION || (!o.settings.UsePlanner() && !c.IsPartitioned(idxDefn.PartitionScheme)) {
 		if err := o.createIndex(idxDefn, plan); err != nil {
@@ -1007,6 +1035,8 @@ func (o *MetadataProvider) PrepareIndexDefn(
 	var nodes []string = nil
 	var numReplica int = 0
 	var numPartition int = 0
+	var rangeBoundaries []string = nil
+	var collations []string = nil
 	var retainDeletedXATTR = false
 	var numDoc uint64 = 0
 	var secKeySize uint64 = 0
@@ -1086,16 +1116,36 @@ func (o *MetadataProvider) PrepareIndexDefn(
 			}
 		}
 
+		rangeBoundaries, err, retry = o.getRangeBoundariesParam(partitionScheme, plan)
+		if err != nil {
+			return nil, err, retry
+		}
+		if rangeBoundaries != nil {
+			partitionScheme = c.PartitionScheme(c.RANGE)
+		}
+
 		err = o.validatePartitionKeys(partitionScheme, partitionKeys, secExprs, isPrimary)
 		if err != nil {
 			return nil, err, false
 		}
 
+		collations, err, retry = o.getCollationParam(plan, secExprs, isPrimary)
+		if err != nil {
+			return nil, err, retry
+		}
+
 		numPartition, err, retry = o.getNumPartitionParam(partitionScheme, plan, version)
 		if err != nil {
 			return nil, err, retry
 		}
 
+		if partitionScheme == c.RANGE {
+			if _, ok := plan["num_partition"]; ok && numPartition != len(rangeBoundaries)+1 {
+				return nil, errors.New("Fails to create index.  Parameter num_partition must be one more than the number of partition_boundaries."), false
+			}
+			numPartition = len(rangeBoundaries) + 1
+		}
+
 		immutable, err, retry = o.getImmutableParam(partitionScheme, plan)
 		if err != nil {
 			return nil, err, retry
@@ -1199,6 +1249,7 @@ func (o *MetadataProvider) PrepareIndexDefn(
 		IsPrimary:          isPrimary,
 		SecExprs:           secExprs,
 		Desc:               desc,
+		Collations:         collations,
 		ExprType:           c.ExprType(exprType),
 		PartitionScheme:    partitionScheme,
 		PartitionKeys:      partitionKeys,
@@ -1209,6 +1260,7 @@ func (o *MetadataProvider) PrepareIndexDefn(
 		IsArrayIndex:       isArrayIndex,
 		NumReplica:         uint32(numReplica),
 		HashScheme:         c.CRC32,
+		RangeBoundaries:    rangeBoundaries,
 		NumPartitions:      uint32(numPartition),
 		RetainDeletedXATTR: retainDeletedXATTR,
 		NumDoc:             numDoc,
@@ -1236,10 +1288,12 @@ func (o *MetadataProvider) prepareIndexSpec(defn *c.IndexDefn) *planner.IndexSpe
 	spec.Immutable = defn.Immutable
 	spec.IsArrayIndex = defn.IsArrayIndex
 	spec.Desc = defn.Desc
+	spec.Collations = defn.Collations
 	spec.NumPartition = uint64(defn.NumPartitions)
 	spec.PartitionScheme = string(defn.PartitionScheme)
 	spec.HashScheme = uint64(defn.HashScheme)
 	spec.PartitionKeys = defn.PartitionKeys
+	spec.RangeBoundaries = defn.RangeBoundaries
 	spec.Replica = uint64(defn.NumReplica) + 1
 	spec.RetainDeletedXATTR = defn.RetainDeletedXATTR
 	spec.ExprType = string(defn.ExprType)
@@ -1625,7 +1679,7 @@ func (o *MetadataProvider) getDeferredParam(plan map[string]interface{}) (bool,
 
 func (o *MetadataProvider) validatePartitionKeys(partitionScheme c.PartitionScheme, partitionKeys []string, secKeys []string, isPrimary bool) error {
 
-	if partitionScheme != c.SINGLE && partitionScheme != c.KEY {
+	if partitionScheme != c.SINGLE && partitionScheme != c.KEY && partitionScheme != c.RANGE {
 		return errors.New(fmt.Sprintf("Fails to create index.  Partition Scheme %v is not allowed.", partitionScheme))
 	}
 
@@ -1641,6 +1695,10 @@ func (o *MetadataProvider) validatePartitionKeys(partitionScheme c.PartitionSche
 		return errors.New(fmt.Sprintf("Fails to create index.  Must specify partition keys for partitioned index."))
 	}
 
+	if partitionScheme == c.RANGE && len(partitionKeys) != 1 {
+		return errors.New(fmt.Sprintf("Fails to create index.  Must specify exactly one partition key for range partitioned index."))
+	}
+
 	secExprs := make(expression.Expressions, 0, len(secKeys))
 	for _, key := range secKeys {
 		expr, err := parser.Parse(key)
@@ -1732,6 +1790,95 @@ func (o *MetadataProvider) getNumPartitionParam(scheme c.PartitionScheme, plan m
 	return numPartition, nil, false
 }
 
+//
+// partition_boundaries is a JSON array of values on the partition key, in
+// ascending order. Its presence turns a HASH partitioned index into a RANGE
+// partitioned index, with one more partition than the number of boundaries.
+//
+func (o *MetadataProvider) getRangeBoundariesParam(scheme c.PartitionScheme, plan map[string]interface{}) ([]string, error, bool) {
+
+	param, ok := plan["partition_boundaries"]
+	if !ok {
+		return nil, nil, false
+	}
+
+	if scheme != c.KEY {
+		return nil, errors.New("Fails to create index.  Parameter partition_boundaries is allowed only for partitioned index."), false
+	}
+
+	values, ok := param.([]interface{})
+	if !ok || len(values) == 0 {
+		return nil, errors.New("Fails to create index.  Parameter partition_boundaries must be a non-empty array of values."), false
+	}
+
+	boundaries := make([]string, 0, len(values))
+	for _, value := range values {
+		boundary, err := json.Marshal(value)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Fails to create index.  Invalid partition boundary %v.", value)), false
+		}
+		boundaries = append(boundaries, string(boundary))
+	}
+
+	if _, err := c.CollateRangeBoundaries(boundaries); err != nil {
+		return nil, errors.New(fmt.Sprintf("Fails to create index.  %v.", err)), false
+	}
+
+	return boundaries, nil, false
+}
+
+func (o *MetadataProvider) getCollationParam(plan map[string]interface{}, secExprs []string, isPrimary bool) ([]string, error, bool) {
+
+	param, ok := plan["collation"]
+	if !ok {
+		return nil, nil, false
+	}
+
+	if isPrimary {
+		return nil, errors.New("Fails to create index.  Parameter collation is not allowed for primary index."), false
+	}
+
+	// a collation for all the index keys, or one for each index key.
+	var names []string
+	switch value := param.(type) {
+	case string:
+		for range secExprs {
+			names = append(names, value)
+		}
+	case []interface{}:
+		if len(value) != len(secExprs) {
+			return nil, errors.New("Fails to create index.  Parameter collation must have a collation for each index key."), false
+		}
+		for _, v := range value {
+			name, ok := v.(string)
+			if !ok {
+				return nil, errors.New("Fails to create index.  Parameter collation must be a string or an array of strings."), false
+			}
+			names = append(names, name)
+		}
+	default:
+		return nil, errors.New("Fails to create index.  Parameter collation must be a string or an array of strings."), false
+	}
+
+	collations := make([]string, len(names))
+	hasCollation := false
+	for i, name := range names {
+		collator, err := collatejson.NewCollator(name)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Fails to create index.  Invalid collation %v.", name)), false
+		}
+		if collator != nil {
+			collations[i] = collator.Name()
+			hasCollation = true
+		}
+	}
+
+	if !hasCollation {
+		return nil, nil, false
+	}
+	return collations, nil, false
+}
+
 func (o *MetadataProvider) getReplicaParam(plan map[string]interface{}, version uint64) (int, error, bool) {
 
 	numReplica := int(0)
@@ -2138,6 +2285,55 @@ func (o *MetadataProvider) DropIndex(defnID c.IndexDefnId) error {
 	return nil
 }
 
+//
+// PauseIndex stops maintenance of all the instances of an index.  When
+// pause is false, maintenance is resumed and the index catches up with
+// the mutations it has missed.
+//
+func (o *MetadataProvider) PauseIndex(defnID c.IndexDefnId, pause bool) error {
+
+	action := "pause"
+	opCode := OPCODE_PAUSE_INDEX
+	if !pause {
+		action = "resume"
+		opCode = OPCODE_RESUME_INDEX
+	}
+
+	clusterVersion := o.GetClusterVersion()
+	if clusterVersion < c.INDEXER_65_VERSION {
+		return fmt.Errorf("Fail to %v index: requires version 6.5 or higher", action)
+	}
+
+	meta := o.findIndex(defnID)
+	if meta == nil {
+		return errors.New("Index does not exist.")
+	}
+
+	watchers, err := o.findWatchersByDefnIdIgnoreStatus(defnID)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Cannot locate cluster node hosting Index %s.", meta.Definition.Name))
+	}
+
+	// The request is idempotent.  If it fails on any indexer, it can be retried.
+	key := fmt.Sprintf("%d", defnID)
+	errMap := make(map[string]bool)
+	for _, watcher := range watchers {
+		if _, err := watcher.makeRequest(opCode, key, []byte("")); err != nil {
+			errMap[err.Error()] = true
+		}
+	}
+
+	if len(errMap) != 0 {
+		errStr := ""
+		for msg, _ := range errMap {
+			errStr += msg + "\n"
+		}
+		return fmt.Errorf("Fail to %v index on some indexer nodes.  Error=%s.  Please retry %v index.", action, errStr, action)
+	}
+
+	return nil
+}
+
 func (o *MetadataProvider) BuildIndexes(defnIDs []c.IndexDefnId) error {
 
 	watcherIndexMap := make(map[c.IndexerId][]c.IndexDefnId)
@@ -2399,6 +2595,16 @@ func (o *MetadataProvider) FindServiceForIndexer(id c.IndexerId) (adminport stri
 	return watcher.getAdminAddr(), watcher.getScanAddr(), watcher.getHttpAddr(), nil
 }
 
+func (o *MetadataProvider) FindServerGroupForIndexer(id c.IndexerId) (string, error) {
+
+	watcher, err := o.findWatcherByIndexerId(id)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Cannot locate cluster node."))
+	}
+
+	return watcher.getServerGroup(), nil
+}
+
 func (o *MetadataProvider) UpdateServiceAddrForIndexer(id c.IndexerId, adminport string) error {
 
 	watcher, err := o.findWatcherByIndexerId(id)
@@ -2409,13 +2615,14 @@ func (o *MetadataProvider) UpdateServiceAddrForIndexer(id c.IndexerId, adminport
 	return watcher.updateServiceMap(adminport)
 }
 
-func (o *MetadataProvider) findIndexByName(name string, bucket string) *IndexMetadata {
+func (o *MetadataProvider) findIndexByName(name, bucket, scope, collection string) *IndexMetadata {
 	o.mutex.Lock()
 	defer o.mutex.Unlock()
 
 	indices, _ := o.repo.listDefnWithValidInstNoLock()
 	for _, meta := range indices {
-		if meta.Definition.Name == name && meta.Definition.Bucket == bucket {
+		if meta.Definition.Name == name && meta.Definition.Bucket == bucket &&
+			meta.Definition.GetScope() == scope && meta.Definition.GetCollection() == collection {
 			// will not hold lock on metadataRepo
 			if o.isValidIndexFromActiveIndexerNoLock(meta) {
 				return meta
@@ -2619,6 +2826,253 @@ func (o *MetadataProvider) AlterReplicaCount(action string, defnId c.IndexDefnId
 	return nil
 }
 
+//
+// AlterIndex renames an index and/or changes its metadata-only properties.  The
+// new name is given by "name" in the WITH clause, along with the properties
+// "retain_deleted_xattr" and "defer_build".
+//
+func (o *MetadataProvider) AlterIndex(defnId c.IndexDefnId, with map[string]interface{}) error {
+
+	clusterVersion := o.GetClusterVersion()
+	if clusterVersion < c.INDEXER_65_VERSION {
+		return errors.New("Alter index requires version 6.5 or higher")
+	}
+
+	idxMeta := o.findIndex(defnId)
+	if idxMeta == nil {
+		return fmt.Errorf("Index %v does not exist.", defnId)
+	}
+	defn := *idxMeta.Definition
+
+	request, err := o.getAlterIndexParams(&defn, with)
+	if err != nil {
+		return err
+	}
+	if request.IsEmpty() {
+		return errors.New("Fail to alter index: missing name or index property.")
+	}
+
+	if request.Name != "" && request.Name != defn.Name {
+		if o.findIndexByName(request.Name, defn.Bucket, defn.GetScope(), defn.GetCollection()) != nil {
+			return fmt.Errorf("Fail to alter index: index %s already exists.", request.Name)
+		}
+	}
+
+	return o.alterIndex(&defn, request)
+}
+
+//
+// CreateAggregate materializes a group aggregate with an index.
+//
+func (o *MetadataProvider) CreateAggregate(defnId c.IndexDefnId, aggr *c.AggregateDefn) error {
+
+	clusterVersion := o.GetClusterVersion()
+	if clusterVersion < c.INDEXER_65_VERSION {
+		return errors.New("Create aggregate requires version 6.5 or higher")
+	}
+
+	idxMeta := o.findIndex(defnId)
+	if idxMeta == nil {
+		return fmt.Errorf("Index %v does not exist.", defnId)
+	}
+	defn := *idxMeta.Definition
+
+	if err := defn.ValidateAggregate(aggr); err != nil {
+		return fmt.Errorf("Fail to create aggregate: %v", err)
+	}
+	if defn.FindAggregate(aggr.Name) != nil {
+		return fmt.Errorf("Fail to create aggregate: aggregate %s already exists.", aggr.Name)
+	}
+
+	return o.alterIndex(&defn, &AlterIndexRequest{CreateAggregate: aggr})
+}
+
+//
+// DropAggregate drops a group aggregate materialized with an index.
+//
+func (o *MetadataProvider) DropAggregate(defnId c.IndexDefnId, name string) error {
+
+	idxMeta := o.findIndex(defnId)
+	if idxMeta == nil {
+		return fmt.Errorf("Index %v does not exist.", defnId)
+	}
+	defn := *idxMeta.Definition
+
+	if defn.FindAggregate(name) == nil {
+		return fmt.Errorf("Fail to drop aggregate: aggregate %s does not exist.", name)
+	}
+
+	return o.alterIndex(&defn, &AlterIndexRequest{DropAggregate: name})
+}
+
+func (o *MetadataProvider) alterIndex(defn *c.IndexDefn, request *AlterIndexRequest) error {
+
+	// Verify if the cluster is in a healthy state.  Retrieve the node list from healthy cluster.
+	nodeList, err := o.getNodesInHealthyCluster()
+	if err != nil {
+		return fmt.Errorf("Fail to alter index: %v", err)
+	}
+
+	//
+	// Acquire the lock from all the indexers, so that there is no concurrent create/alter index
+	// request while the definition is being changed.
+	//
+	watcherMap, err := o.makePrepareIndexRequest(defn.DefnId, defn.Name, defn.Bucket, nil, defn.PartitionScheme, 0)
+	defer o.cancelPrepareIndexRequest(defn.DefnId, watcherMap)
+	if err != nil {
+		return fmt.Errorf("Fail to alter index: %v", err)
+	}
+
+	valid, err := o.verifyNodeList(nodeList, watcherMap)
+	if err != nil {
+		return fmt.Errorf("Fail to alter index: %v", err)
+	}
+	if !valid {
+		return fmt.Errorf("Cluster has failed nodes, undergo network partition, or unable to determine indexer node status.")
+	}
+
+	// Check for any create or drop token
+	for indexerId, _ := range watcherMap {
+		exist, err := o.SendCheckTokenRequest(indexerId, defn.DefnId, CREATE_INDEX_TOKEN|DROP_INDEX_TOKEN)
+		if err != nil {
+			return fmt.Errorf("Fail to alter index: %v", err)
+		}
+		if exist {
+			return fmt.Errorf("Cannot alter index while the index is in the process of being created or dropped.")
+		}
+	}
+
+	request.DefnId = defn.DefnId
+	request.RequesterId = o.providerId
+	rollback := request.Inverse(defn)
+
+	indexerIds := make([]c.IndexerId, 0, len(watcherMap))
+	for indexerId, _ := range watcherMap {
+		indexerIds = append(indexerIds, indexerId)
+	}
+
+	send := func(indexerId c.IndexerId, request *AlterIndexRequest) error {
+		watcher, err := o.findAliveWatcherByIndexerId(indexerId)
+		if err != nil {
+			return fmt.Errorf("cannot reach node %v", indexerId)
+		}
+
+		content, err := MarshallAlterIndexRequest(request)
+		if err != nil {
+			return err
+		}
+
+		if _, err := watcher.makeRequest(OPCODE_ALTER_INDEX, "Alter Index", content); err != nil {
+			return fmt.Errorf("%v: %v", watcher.getAdminAddr(), err)
+		}
+		return nil
+	}
+
+	return alterIndexOnNodes(indexerIds, send, request, rollback)
+}
+
+//
+// Alter index on every indexer, or on none of them.  The request is first
+// validated on every indexer without changing the index.  If applying the
+// request then fails on an indexer, the indexers that have been altered are
+// restored with the rollback request.
+//
+func alterIndexOnNodes(indexerIds []c.IndexerId, send func(c.IndexerId, *AlterIndexRequest) error,
+	request *AlterIndexRequest, rollback *AlterIndexRequest) error {
+
+	validate := *request
+	validate.ValidateOnly = true
+	for _, indexerId := range indexerIds {
+		if err := send(indexerId, &validate); err != nil {
+			return fmt.Errorf("Fail to alter index: %v", err)
+		}
+	}
+
+	altered := make([]c.IndexerId, 0, len(indexerIds))
+	for _, indexerId := range indexerIds {
+		// The request is idempotent.  Restore the failed indexer as well, in
+		// case it has been altered before the failure.
+		altered = append(altered, indexerId)
+
+		if err := send(indexerId, request); err != nil {
+			logging.Errorf("MetadataProvider.alterIndex(): Fail to alter index %v. Rollback. Error: %v",
+				request.DefnId, err)
+
+			var rollbackErr error
+			for _, id := range altered {
+				if err := send(id, rollback); err != nil {
+					logging.Errorf("MetadataProvider.alterIndex(): Fail to rollback alter index %v. Error: %v",
+						request.DefnId, err)
+					rollbackErr = err
+				}
+			}
+
+			if rollbackErr != nil {
+				return fmt.Errorf("Fail to alter index: %v.  Fail to rollback: %v.  Please retry alter index.",
+					err, rollbackErr)
+			}
+			return fmt.Errorf("Fail to alter index: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (o *MetadataProvider) getAlterIndexParams(defn *c.IndexDefn, with map[string]interface{}) (*AlterIndexRequest, error) {
+
+	request := &AlterIndexRequest{}
+
+	for key, _ := range with {
+		switch key {
+		case "action", "name", "retain_deleted_xattr", "defer_build":
+		default:
+			return nil, fmt.Errorf("Fail to alter index: parameter %v cannot be altered.", key)
+		}
+	}
+
+	if _, ok := with["name"]; ok {
+		name, ok := with["name"].(string)
+		if !ok || len(name) == 0 {
+			return nil, errors.New("Fail to alter index: parameter name must be a non-empty string.")
+		}
+		request.Name = name
+	}
+
+	if _, ok := with["retain_deleted_xattr"]; ok {
+		xattr, err, _ := o.getXATTRParam(with)
+		if err != nil {
+			return nil, err
+		}
+
+		if xattr {
+			xattrExprs := make([]string, 0)
+			xattrExprs = append(xattrExprs, defn.SecExprs...)
+			if len(defn.WhereExpr) > 0 {
+				xattrExprs = append(xattrExprs, defn.WhereExpr)
+			}
+			xattrExprs = append(xattrExprs, defn.PartitionKeys...)
+			isXATTRIndex, _, err := queryutil.GetXATTRNames(xattrExprs)
+			if err != nil {
+				return nil, err
+			}
+			if !isXATTRIndex {
+				return nil, errors.New("Fail to alter index: retain_deleted_xattr can be used only if extended attributes are indexed.")
+			}
+		}
+		request.RetainDeletedXATTR = &xattr
+	}
+
+	if _, ok := with["defer_build"]; ok {
+		deferred, err, _ := o.getDeferredParam(with)
+		if err != nil {
+			return nil, err
+		}
+		request.Deferred = &deferred
+	}
+
+	return request, nil
+}
+
 //
 // This function adds replica count of an index.
 //
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	c "github.com/couchbase/indexing/secondary/common"
+)
+
+// alterIndexNodes applies alter index requests to a definition per node,
+// failing the requests listed in fail.
+type alterIndexNodes struct {
+	defns map[c.IndexerId]*c.IndexDefn
+	fail  map[string]bool // "<indexerId>/<validate|apply|rollback>"
+	sent  []string
+}
+
+func newAlterIndexNodes(defn *c.IndexDefn, ids ...c.IndexerId) *alterIndexNodes {
+	nodes := &alterIndexNodes{
+		defns: make(map[c.IndexerId]*c.IndexDefn),
+		fail:  make(map[string]bool),
+	}
+	for _, id := range ids {
+		nodes.defns[id] = defn.Clone()
+	}
+	return nodes
+}
+
+func (n *alterIndexNodes) send(id c.IndexerId, request *AlterIndexRequest) error {
+	op := "apply"
+	if request.ValidateOnly {
+		op = "validate"
+	} else if request.Name == "idx" {
+		op = "rollback"
+	}
+	key := fmt.Sprintf("%v/%v", id, op)
+	n.sent = append(n.sent, key)
+	if n.fail[key] {
+		return errors.New("injected failure")
+	}
+	if !request.ValidateOnly {
+		request.Apply(n.defns[id])
+	}
+	return nil
+}
+
+func (n *alterIndexNodes) names() []string {
+	names := make([]string, 0, len(n.defns))
+	for _, id := range []c.IndexerId{"n1", "n2", "n3"} {
+		names = append(names, n.defns[id].Name)
+	}
+	return names
+}
+
+func TestAlterIndexOnNodes(t *testing.T) {
+	defn := &c.IndexDefn{DefnId: 1, Name: "idx", Bucket: "default"}
+	ids := []c.IndexerId{"n1", "n2", "n3"}
+	request := &AlterIndexRequest{DefnId: 1, Name: "renamed"}
+	rollback := request.Inverse(defn)
+
+	nodes := newAlterIndexNodes(defn, ids...)
+	if err := alterIndexOnNodes(ids, nodes.send, request, rollback); err != nil {
+		t.Fatal(err)
+	}
+	if names := nodes.names(); !reflect.DeepEqual(names, []string{"renamed", "renamed", "renamed"}) {
+		t.Errorf("expected all nodes renamed, got %v", names)
+	}
+
+	// no node is altered if validation fails on any node.
+	nodes = newAlterIndexNodes(defn, ids...)
+	nodes.fail["n3/validate"] = true
+	if err := alterIndexOnNodes(ids, nodes.send, request, rollback); err == nil {
+		t.Fatal("expected validation failure")
+	}
+	if names := nodes.names(); !reflect.DeepEqual(names, []string{"idx", "idx", "idx"}) {
+		t.Errorf("expected no node renamed, got %v", names)
+	}
+
+	// nodes altered before the failure are rolled back.
+	nodes = newAlterIndexNodes(defn, ids...)
+	nodes.fail["n2/apply"] = true
+	if err := alterIndexOnNodes(ids, nodes.send, request, rollback); err == nil {
+		t.Fatal("expected alter index failure")
+	}
+	if names := nodes.names(); !reflect.DeepEqual(names, []string{"idx", "idx", "idx"}) {
+		t.Errorf("expected rename to be rolled back, got %v", names)
+	}
+	expected := []string{
+		"n1/validate", "n2/validate", "n3/validate",
+		"n1/apply", "n2/apply", "n1/rollback", "n2/rollback",
+	}
+	if !reflect.DeepEqual(nodes.sent, expected) {
+		t.Errorf("expected requests %v, got %v", expected, nodes.sent)
+	}
+
+	// failure to rollback is reported.
+	nodes = newAlterIndexNodes(defn, ids...)
+	nodes.fail["n3/apply"] = true
+	nodes.fail["n1/rollback"] = true
+	err := alterIndexOnNodes(ids, nodes.send, request, rollback)
+	if err == nil {
+		t.Fatal("expected alter index failure")
+	}
+	if names := nodes.names(); !reflect.DeepEqual(names, []string{"renamed", "idx", "idx"}) {
+		t.Errorf("expected n1 left renamed, got %v", names)
+	}
+}
+
+func TestAlterIndexRequestInverse(t *testing.T) {
+	aggr := c.AggregateDefn{Name: "a", Group: []int32{0}}
+	defn := &c.IndexDefn{
+		DefnId:     1,
+		Name:       "idx",
+		Deferred:   true,
+		Aggregates: []c.AggregateDefn{aggr},
+	}
+
+	deferred := false
+	requests := []*AlterIndexRequest{
+		{DefnId: 1, Name: "renamed"},
+		{DefnId: 1, Deferred: &deferred},
+		{DefnId: 1, CreateAggregate: &c.AggregateDefn{Name: "b", Group: []int32{1}}},
+		{DefnId: 1, CreateAggregate: &c.AggregateDefn{Name: "a", Group: []int32{1}}},
+		{DefnId: 1, DropAggregate: "a"},
+	}
+	for i, request := range requests {
+		altered := defn.Clone()
+		if !request.Apply(altered) {
+			t.Fatalf("request %v: expected definition to change", i)
+		}
+		request.Inverse(defn).Apply(altered)
+		if altered.Name != defn.Name || altered.Deferred != defn.Deferred ||
+			!reflect.DeepEqual(altered.Aggregates, defn.Aggregates) {
+			t.Errorf("request %v: expected %v, got %v", i, defn, altered)
+		}
+	}
+}
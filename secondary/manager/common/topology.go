@@ -48,6 +48,7 @@ type IndexInstDistribution struct {
 	StorageMode    string                  `json:"storageMode,omitempty"`
 	OldStorageMode string                  `json:"oldStorageMode,omitempty"`
 	RealInstId     uint64                  `json:"realInstId,omitempty"`
+	Paused         bool                    `json:"paused,omitempty"`
 }
 
 type IndexPartDistribution struct {
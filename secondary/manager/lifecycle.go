@@ -223,6 +223,7 @@ func (m *LifecycleMgr) OnNewRequest(fid string, request protocol.RequestMsg) {
 		if !m.indexerReady {
 			if op == client.OPCODE_UPDATE_INDEX_INST ||
 				op == client.OPCODE_DELETE_BUCKET ||
+				op == client.OPCODE_DELETE_COLLECTION ||
 				op == client.OPCODE_CLEANUP_INDEX ||
 				op == client.OPCODE_CLEANUP_PARTITION ||
 				op == client.OPCODE_RESET_INDEX ||
@@ -366,6 +367,8 @@ func (m *LifecycleMgr) dispatchRequest(request *requestHolder, factory *message.
 		result, err = m.handleServiceMap(content)
 	case client.OPCODE_DELETE_BUCKET:
 		err = m.handleDeleteBucket(key, content)
+	case client.OPCODE_DELETE_COLLECTION:
+		err = m.handleDeleteCollection(key, content)
 	case client.OPCODE_CLEANUP_INDEX:
 		err = m.handleCleanupIndexMetadata(content)
 	case client.OPCODE_CLEANUP_DEFER_INDEX:
@@ -408,6 +411,12 @@ func (m *LifecycleMgr) dispatchRequest(request *requestHolder, factory *message.
 		result, err = m.handleGetIndexReplicaCount(content)
 	case client.OPCODE_CHECK_TOKEN_EXIST:
 		result, err = m.handleCheckTokenExist(content)
+	case client.OPCODE_ALTER_INDEX:
+		err = m.handleAlterIndex(content)
+	case client.OPCODE_PAUSE_INDEX:
+		err = m.handlePauseIndex(key, true, common.NewUserRequestContext())
+	case client.OPCODE_RESUME_INDEX:
+		err = m.handlePauseIndex(key, false, common.NewUserRequestContext())
 	}
 
 	logging.Debugf("LifecycleMgr.dispatchRequest () : send response for requestId %d, op %d, len(result) %d", reqId, op, len(result))
@@ -962,6 +971,188 @@ func (m *LifecycleMgr) handleCheckTokenExist(content []byte) ([]byte, error) {
 	return result, nil
 }
 
+//-----------------------------------------------------------
+// Alter Index
+//-----------------------------------------------------------
+
+//
+// Rename an index or change its metadata-only properties.  This function is
+// idempotent, so that the request can be retried on every indexer.
+//
+func (m *LifecycleMgr) handleAlterIndex(content []byte) error {
+
+	request, err := client.UnmarshallAlterIndexRequest(content)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.handleAlterIndex() : Unable to unmarshall request. Reason = %v", err)
+		return err
+	}
+
+	defnId := request.DefnId
+
+	// Reject if another create/alter index request is holding the lock.
+	if m.prepareLock != nil {
+		if m.prepareLock.RequesterId != request.RequesterId || m.prepareLock.DefnId != defnId {
+			if m.prepareLock.Timeout > (time.Now().UnixNano() - m.prepareLock.StartTime) {
+				logging.Infof("LifecycleMgr.handleAlterIndex() : Reject %v because another index %v holding lock",
+					defnId, m.prepareLock.DefnId)
+				return fmt.Errorf("Cannot alter index while another create or alter index request is in progress.")
+			}
+		}
+	}
+
+	existDefn, err := m.repo.GetIndexDefnById(defnId)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.handleAlterIndex() : %v", err)
+		return err
+	}
+
+	if existDefn == nil {
+		logging.Infof("LifecycleMgr.handleAlterIndex() : Index Definition does not exist for %v.  No update is performed.", defnId)
+		return nil
+	}
+
+	// Reject if there is a pending create or drop token for this index.
+	exist, err := mc.DeleteCommandTokenExist(defnId)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.handleAlterIndex(): Fail to retrieve delete token for index %v: %v", defnId, err)
+		return err
+	}
+	if exist {
+		return fmt.Errorf("Cannot alter index while the index is in the process of being dropped.")
+	}
+
+	exist, err = mc.CreateCommandTokenExist(defnId)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.handleAlterIndex(): Fail to retrieve create token for index %v: %v", defnId, err)
+		return err
+	}
+	if exist {
+		return fmt.Errorf("Cannot alter index while the index is in the process of being created.")
+	}
+
+	defn := existDefn.Clone()
+	if !request.Apply(defn) {
+		return nil
+	}
+
+	if request.ValidateOnly {
+		return m.repo.ValidateAlterIndex(defn)
+	}
+
+	// Notify the local instances before the definition is updated, so
+	// that the request can be retried if the notification fails.
+	if request.CreateAggregate != nil || request.DropAggregate != "" {
+		if err := m.notifyAggregates(defn, common.NewUserRequestContext()); err != nil {
+			return err
+		}
+	}
+
+	if err := m.repo.AlterIndex(defn); err != nil {
+		logging.Errorf("LifecycleMgr.handleAlterIndex() : alter index fails for index %v. Reason = %v", defnId, err)
+		return err
+	}
+
+	logging.Infof("LifecycleMgr.handleAlterIndex() : index %v altered.  Name %v, RetainDeletedXATTR %v, Deferred %v, Aggregates %v",
+		defnId, defn.Name, defn.RetainDeletedXATTR, defn.Deferred, defn.Aggregates)
+
+	return nil
+}
+
+//
+// Notify the local instances of an index of the aggregates to maintain.
+//
+func (m *LifecycleMgr) notifyAggregates(defn *common.IndexDefn, reqCtx *common.MetadataRequestContext) error {
+
+	insts, err := m.FindAllLocalIndexInst(defn.Bucket, defn.DefnId)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.notifyAggregates() : fails for index defn %v.  Error = %v.", defn.DefnId, err)
+		return err
+	}
+
+	for _, inst := range insts {
+
+		if common.IndexState(inst.State) == common.INDEX_STATE_DELETED {
+			continue
+		}
+
+		instId := common.IndexInstId(inst.InstId)
+		if err := m.notifier.OnIndexAggregates(instId, defn.Aggregates, reqCtx); err != nil {
+			logging.Errorf("LifecycleMgr.notifyAggregates() : fails for index inst %v.  Error = %v.", instId, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------
+// Pause / Resume Index
+//-----------------------------------------------------------
+
+//
+// Pause or resume maintenance of the local instances of an index.  A paused
+// instance is removed from its stream by the indexer.  When resumed, the
+// instance catches up from its last snapshot through the build path.
+//
+func (m *LifecycleMgr) handlePauseIndex(key string, pause bool, reqCtx *common.MetadataRequestContext) error {
+
+	id, err := indexDefnId(key)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.handlePauseIndex() : pause index fails. Reason = %v", err)
+		return err
+	}
+
+	defn, err := m.repo.GetIndexDefnById(id)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.handlePauseIndex() : pause index fails for index defn %v.  Error = %v.", id, err)
+		return err
+	}
+	if defn == nil {
+		logging.Infof("LifecycleMgr.handlePauseIndex() : index %v does not exist.", id)
+		return nil
+	}
+
+	exist, err := mc.DeleteCommandTokenExist(id)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.handlePauseIndex(): Fail to retrieve delete token for index %v: %v", id, err)
+		return err
+	}
+	if exist {
+		return fmt.Errorf("Index %v is in the process of being dropped.", defn.Name)
+	}
+
+	insts, err := m.FindAllLocalIndexInst(defn.Bucket, id)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.handlePauseIndex() : pause index fails for index defn %v.  Error = %v.", id, err)
+		return err
+	}
+
+	for _, inst := range insts {
+
+		if inst.Paused == pause {
+			continue
+		}
+
+		if pause && common.IndexState(inst.State) != common.INDEX_STATE_ACTIVE {
+			return fmt.Errorf("Index %v is not active.  Only an active index can be paused.", defn.Name)
+		}
+
+		instId := common.IndexInstId(inst.InstId)
+		if err := m.notifier.OnIndexPause(instId, pause, reqCtx); err != nil {
+			logging.Errorf("LifecycleMgr.handlePauseIndex() : pause %v fails for index inst %v.  Error = %v.", pause, instId, err)
+			return err
+		}
+
+		if err := m.SetPausedFlag(defn.Bucket, id, instId, pause); err != nil {
+			return err
+		}
+
+		logging.Infof("LifecycleMgr.handlePauseIndex() : index %v inst %v paused %v", id, instId, pause)
+	}
+
+	return nil
+}
+
 //-----------------------------------------------------------
 // Create Index
 //-----------------------------------------------------------
@@ -1036,6 +1227,10 @@ func (m *LifecycleMgr) CreateIndex(defn *common.IndexDefn, scheduled bool,
 		return err
 	}
 
+	if err := m.setCollectionID(defn); err != nil {
+		return err
+	}
+
 	if err := m.setStorageMode(defn); err != nil {
 		return err
 	}
@@ -1192,6 +1387,27 @@ func (m *LifecycleMgr) setBucketUUID(defn *common.IndexDefn) error {
 	return nil
 }
 
+func (m *LifecycleMgr) setCollectionID(defn *common.IndexDefn) error {
+
+	// Resolve scope and collection id.  Like bucket UUID, the collection id
+	// identifies a specific incarnation of the collection so that the index
+	// can be dropped when the collection is dropped and recreated.
+	scopeId, collectionId, err := common.GetCollectionID(m.clusterURL, defn.Bucket,
+		defn.GetScope(), defn.GetCollection())
+	if err != nil {
+		return fmt.Errorf("Collection %v.%v does not exist or temporarily unavailable for creating new index."+
+			" Please retry the operation at a later time (err=%v).", defn.GetScope(), defn.GetCollection(), err)
+	}
+
+	if len(defn.CollectionId) != 0 && defn.CollectionId != collectionId {
+		return fmt.Errorf("Collection ID has changed.  Collection may have been dropped and recreated.")
+	}
+
+	defn.ScopeId = scopeId
+	defn.CollectionId = collectionId
+	return nil
+}
+
 func (m *LifecycleMgr) setStorageMode(defn *common.IndexDefn) error {
 
 	//if no index_type has been specified
@@ -1891,6 +2107,70 @@ func (m *LifecycleMgr) handleDeleteBucket(bucket string, content []byte) error {
 	return result
 }
 
+//-----------------------------------------------------------
+// Delete Collection
+//-----------------------------------------------------------
+
+//
+// Drop the indexes defined on a dropped collection.  Unlike delete bucket,
+// indexer is notified so that the index instances are cleaned up.
+//
+func (m *LifecycleMgr) handleDeleteCollection(bucket string, content []byte) error {
+
+	if len(content) < 2 {
+		return errors.New("invalid argument")
+	}
+
+	streamId := common.StreamId(content[0])
+	collectionId := string(content[1:])
+
+	topology, err := m.repo.GetTopologyByBucket(bucket)
+	if err != nil || topology == nil {
+		if err == fdb.FDB_RESULT_KEY_NOT_FOUND {
+			return nil
+		}
+		return err
+	}
+
+	var result error
+
+	definitions := make([]IndexDefnDistribution, len(topology.Definitions))
+	copy(definitions, topology.Definitions)
+
+	for _, defnRef := range definitions {
+
+		defn, err := m.repo.GetIndexDefnById(common.IndexDefnId(defnRef.DefnId))
+		if err != nil || defn == nil {
+			logging.Debugf("LifecycleMgr.handleDeleteCollection() : Cannot find index %v.  Skip.", defnRef.DefnId)
+			continue
+		}
+
+		if defn.GetCollectionId() != collectionId {
+			continue
+		}
+
+		matched := streamId == common.NIL_STREAM
+		for _, instRef := range defnRef.Instances {
+			if common.StreamId(instRef.StreamId) == streamId || common.StreamId(instRef.StreamId) == common.NIL_STREAM {
+				matched = true
+				break
+			}
+		}
+
+		if matched {
+			logging.Infof("LifecycleMgr.handleDeleteCollection() : drop index %v (%v) on collection %v bucket %v",
+				defn.DefnId, defn.Name, collectionId, bucket)
+
+			if err := m.DeleteIndex(common.IndexDefnId(defn.DefnId), true, false, common.NewUserRequestContext()); err != nil {
+				result = err
+			}
+			mc.DeleteAllCreateCommandToken(common.IndexDefnId(defn.DefnId))
+		}
+	}
+
+	return result
+}
+
 func (m *LifecycleMgr) deleteCreateTokenForBucket(bucket string) error {
 
 	var result error
@@ -2167,6 +2447,10 @@ func (m *LifecycleMgr) CreateIndexInstance(defn *common.IndexDefn, scheduled boo
 		return err
 	}
 
+	if err := m.setCollectionID(defn); err != nil {
+		return err
+	}
+
 	if err := m.setStorageMode(defn); err != nil {
 		return err
 	}
@@ -2919,6 +3203,31 @@ func (m *LifecycleMgr) SetScheduledFlag(bucket string, defnId common.IndexDefnId
 	return nil
 }
 
+func (m *LifecycleMgr) SetPausedFlag(bucket string, defnId common.IndexDefnId, instId common.IndexInstId, paused bool) error {
+
+	topology, err := m.repo.CloneTopologyByBucket(bucket)
+	if err != nil {
+		logging.Errorf("LifecycleMgr.SetPausedFlag() : index instance update fails. Reason = %v", err)
+		return err
+	}
+	if topology == nil {
+		logging.Warnf("LifecycleMgr.SetPausedFlag() : toplogy does not exist.  Skip index instance update for %v", defnId)
+		return nil
+	}
+
+	changed := topology.UpdatePausedFlagForIndexInst(defnId, instId, paused)
+
+	if changed {
+		if err := m.repo.SetTopologyByBucket(bucket, topology); err != nil {
+			// Topology update is in place.  If there is any error, SetTopologyByBucket will purge the cache copy.
+			logging.Errorf("LifecycleMgr.SetPausedFlag() : index instance update fails. Reason = %v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (m *LifecycleMgr) FindAllLocalIndexInst(bucket string, defnId common.IndexDefnId) ([]IndexInstDistribution, error) {
 
 	topology, err := m.repo.GetTopologyByBucket(bucket)
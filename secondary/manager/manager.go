@@ -98,6 +98,8 @@ type MetadataNotifier interface {
 	OnIndexDelete(common.IndexInstId, string, *common.MetadataRequestContext) error
 	OnIndexBuild([]common.IndexInstId, []string, *common.MetadataRequestContext) map[common.IndexInstId]error
 	OnPartitionPrune(common.IndexInstId, []common.PartitionId, *common.MetadataRequestContext) error
+	OnIndexPause(common.IndexInstId, bool, *common.MetadataRequestContext) error
+	OnIndexAggregates(common.IndexInstId, []common.AggregateDefn, *common.MetadataRequestContext) error
 	OnFetchStats() error
 }
 
@@ -476,6 +478,26 @@ func (m *IndexManager) HandleBuildIndexDDL(indexIds client.IndexIdList) error {
 	return nil
 }
 
+func (m *IndexManager) HandleAlterIndexDDL(request *client.AlterIndexRequest) error {
+
+	key := fmt.Sprintf("%d", request.DefnId)
+	content, err := client.MarshallAlterIndexRequest(request)
+	if err != nil {
+		return err
+	}
+
+	return m.requestServer.MakeRequest(client.OPCODE_ALTER_INDEX, key, content)
+}
+
+func (m *IndexManager) HandlePauseIndexDDL(defnId common.IndexDefnId, pause bool) error {
+
+	key := fmt.Sprintf("%d", defnId)
+	if pause {
+		return m.requestServer.MakeRequest(client.OPCODE_PAUSE_INDEX, key, []byte(""))
+	}
+	return m.requestServer.MakeRequest(client.OPCODE_RESUME_INDEX, key, []byte(""))
+}
+
 func (m *IndexManager) UpdateIndexInstance(bucket string, defnId common.IndexDefnId, instId common.IndexInstId,
 	state common.IndexState, streamId common.StreamId, err string, buildTime []uint64, rState common.RebalanceState,
 	partitions []uint64, versions []int, instVersion int) error {
@@ -609,6 +631,14 @@ func (m *IndexManager) DeleteIndexForBucket(bucket string, streamId common.Strea
 	return m.requestServer.MakeAsyncRequest(client.OPCODE_DELETE_BUCKET, bucket, []byte{byte(streamId)})
 }
 
+func (m *IndexManager) DeleteIndexForCollection(bucket string, collectionId string,
+	streamId common.StreamId) error {
+
+	logging.Debugf("IndexManager.DeleteIndexForCollection(): making request for deleting index for collection")
+	content := append([]byte{byte(streamId)}, []byte(collectionId)...)
+	return m.requestServer.MakeAsyncRequest(client.OPCODE_DELETE_COLLECTION, bucket, content)
+}
+
 func (m *IndexManager) CleanupIndex(index common.IndexInst) error {
 
 	index.Pc = nil
@@ -523,6 +523,93 @@ func (c *MetadataRepo) UpdateIndex(defn *common.IndexDefn) error {
 	return nil
 }
 
+//
+// AlterIndex saves a definition that has been renamed or has its metadata
+// changed.  If the index is renamed, the name must be unique within the
+// keyspace, and the index topology is updated to the new name as well.
+//
+func (c *MetadataRepo) AlterIndex(defn *common.IndexDefn) error {
+
+	exist, err := c.GetIndexDefnById(defn.DefnId)
+	if err != nil {
+		return err
+	}
+
+	if err := c.ValidateAlterIndex(defn); err != nil {
+		return err
+	}
+	renamed := exist.Name != defn.Name
+
+	if err := c.UpdateIndex(defn); err != nil {
+		return err
+	}
+
+	if renamed {
+		topology, err := c.CloneTopologyByBucket(defn.Bucket)
+		if err != nil {
+			return err
+		}
+		if topology == nil {
+			return nil
+		}
+
+		defnRef := topology.FindIndexDefinitionById(defn.DefnId)
+		if defnRef == nil || defnRef.Name == defn.Name {
+			return nil
+		}
+		defnRef.Name = defn.Name
+
+		if err := c.SetTopologyByBucket(defn.Bucket, topology); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//
+// ValidateAlterIndex checks that the altered definition can be saved,
+// without saving it.
+//
+func (c *MetadataRepo) ValidateAlterIndex(defn *common.IndexDefn) error {
+
+	exist, err := c.GetIndexDefnById(defn.DefnId)
+	if err != nil {
+		return err
+	}
+	if exist == nil {
+		return NewError(ERROR_META_IDX_DEFN_NOT_EXIST, NORMAL, METADATA_REPO, nil,
+			fmt.Sprintf("Index Definition '%v' does not exist", defn.DefnId))
+	}
+
+	if exist.Name != defn.Name {
+		if other := c.findIndexDefnByName(defn); other != nil {
+			return NewError(ERROR_META_IDX_DEFN_EXIST, NORMAL, METADATA_REPO, nil,
+				fmt.Sprintf("Index Definition '%s' already exists", defn.Name))
+		}
+	}
+
+	return nil
+}
+
+//
+// Find another index definition with the same name in the same keyspace.
+//
+func (c *MetadataRepo) findIndexDefnByName(defn *common.IndexDefn) *common.IndexDefn {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, other := range c.defnCache {
+		if other.DefnId != defn.DefnId && other.Name == defn.Name && other.Bucket == defn.Bucket &&
+			other.GetScope() == defn.GetScope() && other.GetCollection() == defn.GetCollection() {
+			return other
+		}
+	}
+
+	return nil
+}
+
 /////////////////////////////////////////////////////////////////////////////
 // Private Function : Initialization
 /////////////////////////////////////////////////////////////////////////////
@@ -48,6 +48,9 @@ const (
 	CREATE RequestType = "create"
 	DROP   RequestType = "drop"
 	BUILD  RequestType = "build"
+	ALTER  RequestType = "alter"
+	PAUSE  RequestType = "pause"
+	RESUME RequestType = "resume"
 )
 
 type IndexRequest struct {
@@ -186,6 +189,9 @@ func registerRequestHandler(mgr *IndexManager, clusterUrl string, mux *http.Serv
 		mux.HandleFunc("/createIndexRebalance", handlerContext.createIndexRequestRebalance)
 		mux.HandleFunc("/dropIndex", handlerContext.dropIndexRequest)
 		mux.HandleFunc("/buildIndex", handlerContext.buildIndexRequest)
+		mux.HandleFunc("/alterIndex", handlerContext.alterIndexRequest)
+		mux.HandleFunc("/pauseIndex", handlerContext.pauseIndexRequest)
+		mux.HandleFunc("/resumeIndex", handlerContext.resumeIndexRequest)
 		mux.HandleFunc("/getLocalIndexMetadata", handlerContext.handleLocalIndexMetadataRequest)
 		mux.HandleFunc("/getIndexMetadata", handlerContext.handleIndexMetadataRequest)
 		mux.HandleFunc("/restoreIndexMetadata", handlerContext.handleRestoreIndexMetadataRequest)
@@ -366,6 +372,126 @@ func (m *requestHandlerContext) buildIndexRequest(w http.ResponseWriter, r *http
 	}
 }
 
+//
+// Rename the index or change its metadata-only properties on this node.  The
+// new name is given by the index definition, and the properties are given by
+// the plan, e.g.
+//
+// {"index":{"defnId":1234,"bucket":"default","name":"newName"},
+//  "plan":{"retain_deleted_xattr":true,"defer_build":false}}
+//
+func (m *requestHandlerContext) alterIndexRequest(w http.ResponseWriter, r *http.Request) {
+
+	creds, ok := doAuth(r, w)
+	if !ok {
+		return
+	}
+
+	// convert request
+	request := m.convertIndexRequest(r)
+	if request == nil {
+		sendIndexResponseWithError(http.StatusBadRequest, w, "Unable to convert request for alter index")
+		return
+	}
+
+	permission := fmt.Sprintf("cluster.bucket[%s].n1ql.index!alter", request.Index.Bucket)
+	if !isAllowed(creds, []string{permission}, w) {
+		return
+	}
+
+	alter := &client.AlterIndexRequest{
+		DefnId: request.Index.DefnId,
+		Name:   request.Index.Name,
+	}
+
+	for key, value := range request.Plan {
+		flag, ok := value.(bool)
+		if !ok {
+			sendIndexResponseWithError(http.StatusBadRequest, w, fmt.Sprintf("Parameter %v must be a boolean value", key))
+			return
+		}
+
+		switch key {
+		case "retain_deleted_xattr":
+			alter.RetainDeletedXATTR = &flag
+		case "defer_build":
+			alter.Deferred = &flag
+		default:
+			sendIndexResponseWithError(http.StatusBadRequest, w, fmt.Sprintf("Parameter %v cannot be altered", key))
+			return
+		}
+	}
+
+	if alter.DefnId == 0 || alter.IsEmpty() {
+		sendIndexResponseWithError(http.StatusBadRequest, w, "Missing index definition id, name or index property for alter index")
+		return
+	}
+
+	// call the index manager to handle the DDL
+	if err := m.mgr.HandleAlterIndexDDL(alter); err == nil {
+		// No error, return success
+		sendIndexResponse(w)
+	} else {
+		// report failure
+		sendIndexResponseWithError(http.StatusInternalServerError, w, fmt.Sprintf("%v", err))
+	}
+}
+
+//
+// Stop maintenance of the index on this node.  Scans on the paused index
+// are only allowed with AnyConsistency.
+//
+func (m *requestHandlerContext) pauseIndexRequest(w http.ResponseWriter, r *http.Request) {
+	m.doPauseIndexRequest(w, r, true)
+}
+
+//
+// Resume maintenance of the index on this node.  The index catches up
+// from its last snapshot.
+//
+func (m *requestHandlerContext) resumeIndexRequest(w http.ResponseWriter, r *http.Request) {
+	m.doPauseIndexRequest(w, r, false)
+}
+
+func (m *requestHandlerContext) doPauseIndexRequest(w http.ResponseWriter, r *http.Request, pause bool) {
+
+	creds, ok := doAuth(r, w)
+	if !ok {
+		return
+	}
+
+	action := RESUME
+	if pause {
+		action = PAUSE
+	}
+
+	// convert request
+	request := m.convertIndexRequest(r)
+	if request == nil {
+		sendIndexResponseWithError(http.StatusBadRequest, w, fmt.Sprintf("Unable to convert request for %v index", action))
+		return
+	}
+
+	permission := fmt.Sprintf("cluster.bucket[%s].n1ql.index!alter", request.Index.Bucket)
+	if !isAllowed(creds, []string{permission}, w) {
+		return
+	}
+
+	if request.Index.DefnId == 0 {
+		sendIndexResponseWithError(http.StatusBadRequest, w, fmt.Sprintf("Missing index definition id for %v index", action))
+		return
+	}
+
+	// call the index manager to handle the DDL
+	if err := m.mgr.HandlePauseIndexDDL(request.Index.DefnId, pause); err == nil {
+		// No error, return success
+		sendIndexResponse(w)
+	} else {
+		// report failure
+		sendIndexResponseWithError(http.StatusInternalServerError, w, fmt.Sprintf("%v", err))
+	}
+}
+
 func (m *requestHandlerContext) convertIndexRequest(r *http.Request) *IndexRequest {
 
 	req := &IndexRequest{}
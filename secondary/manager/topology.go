@@ -49,6 +49,7 @@ type IndexInstDistribution struct {
 	StorageMode    string                  `json:"storageMode,omitempty"`
 	OldStorageMode string                  `json:"oldStorageMode,omitempty"`
 	RealInstId     uint64                  `json:"realInstId,omitempty"`
+	Paused         bool                    `json:"paused,omitempty"`
 }
 
 type IndexPartDistribution struct {
@@ -295,6 +296,28 @@ func (t *IndexTopology) UpdateScheduledFlagForIndexInst(defnId common.IndexDefnI
 	return false
 }
 
+//
+// Set paused flag
+//
+func (t *IndexTopology) UpdatePausedFlagForIndexInst(defnId common.IndexDefnId, instId common.IndexInstId, paused bool) bool {
+
+	for i, _ := range t.Definitions {
+		if t.Definitions[i].DefnId == uint64(defnId) {
+			for j, _ := range t.Definitions[i].Instances {
+				if t.Definitions[i].Instances[j].InstId == uint64(instId) {
+					if t.Definitions[i].Instances[j].Paused != paused {
+						t.Definitions[i].Instances[j].Paused = paused
+						logging.Debugf("IndexTopology.UpdatePausedFlagForIndexInst(): Set paused flag to %v for index '%v' inst '%v'",
+							paused, defnId, t.Definitions[i].Instances[j].InstId)
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
 //
 // Update Index Rebalance Status on instance
 //
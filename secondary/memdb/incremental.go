@@ -0,0 +1,442 @@
+package memdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Incremental snapshots
+//
+// An incremental snapshot records only the items inserted into and the
+// items deleted from the previous persisted snapshot (its base). Every item
+// carries the snapshot number it was born in and deleted by, hence the
+// changes between two snapshots can be found by visiting all versions of
+// the items, as long as the base snapshot is kept open so that deleted
+// items are not garbage collected.
+//
+// Layout of an incremental snapshot directory:
+//   nitro.json          {"version", "baseSn", "sn"}
+//   insert/shard-N      items inserted since base
+//   delete/shard-N      items deleted since base
+//
+// nitro.json is written last, an incremental snapshot without it is
+// incomplete. A chain of incremental snapshots is restored on top of the
+// full snapshot by LoadIncrementalFromDisk.
+
+var ErrInvalidBaseSnapshot = errors.New("MemDB base snapshot must be older than snapshot")
+
+type incrementalManifest struct {
+	Version int    `json:"version"`
+	BaseSn  uint32 `json:"baseSn"`
+	Sn      uint32 `json:"sn"`
+}
+
+// StoreIncrementalToDisk persist the items inserted and deleted between
+// baseSnap and snap. baseSnap is not closed, snap is closed on return.
+func (m *MemDB) StoreIncrementalToDisk(dir string, snap, baseSnap *Snapshot,
+	concurr int, itmCallback ItemCallback) (err error) {
+
+	defer snap.Close()
+
+	if baseSnap.sn >= snap.sn {
+		return ErrInvalidBaseSnapshot
+	}
+
+	m.Lock()
+	if m.hasShutdown {
+		m.Unlock()
+		return ErrShutdown
+	}
+
+	if m.useMemoryMgmt {
+		m.shutdownWg1.Add(1)
+		defer m.shutdownWg1.Done()
+	}
+
+	m.Unlock()
+
+	shards := runtime.NumCPU()
+	inserts, err := m.createShardFiles(filepath.Join(dir, "insert"), shards)
+	if err != nil {
+		return err
+	}
+	defer inserts.close()
+
+	deletes, err := m.createShardFiles(filepath.Join(dir, "delete"), shards)
+	if err != nil {
+		return err
+	}
+	defer deletes.close()
+
+	visitorCallback := func(itm *Item, shard int) error {
+		if m.hasShutdown {
+			return ErrShutdown
+		}
+
+		var w FileWriter
+		if isInserted(itm, baseSnap.sn, snap.sn) {
+			w = inserts.writers[shard]
+		} else if isDeleted(itm, baseSnap.sn, snap.sn) {
+			w = deletes.writers[shard]
+		} else {
+			return nil
+		}
+
+		if err := w.WriteItem(itm); err != nil {
+			return err
+		}
+
+		if itmCallback != nil {
+			itmCallback(&ItemEntry{itm: itm, n: nil})
+		}
+
+		return nil
+	}
+
+	if err = m.visitor(snap, visitorCallback, shards, concurr, true); err != nil {
+		return err
+	}
+
+	if err = inserts.commit(); err != nil {
+		return err
+	}
+
+	if err = deletes.commit(); err != nil {
+		return err
+	}
+
+	manifest, _ := json.Marshal(&incrementalManifest{
+		Version: version,
+		BaseSn:  baseSnap.sn,
+		Sn:      snap.sn,
+	})
+	return ioutil.WriteFile(filepath.Join(dir, "nitro.json"), manifest, 0660)
+}
+
+// LoadIncrementalFromDisk restore the full snapshot persisted in dir
+// followed by the incremental snapshots persisted in incrDirs, in the
+// order they were persisted. An incremental snapshot that does not follow
+// its predecessor in the chain is reported as corrupt.
+func (m *MemDB) LoadIncrementalFromDisk(dir string, incrDirs []string,
+	concurr int, callb ItemCallback) (*Snapshot, error) {
+
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "nitro.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var base struct {
+		Sn *uint32 `json:"sn"`
+	}
+	if err := json.Unmarshal(bs, &base); err != nil {
+		return nil, err
+	}
+
+	if len(incrDirs) > 0 && base.Sn == nil {
+		return nil, ErrCorruptSnapshot
+	}
+
+	// Fold the changes of all incremental snapshots, keys deleted from the
+	// full snapshot and the items to be inserted on top of it.
+	var mu sync.Mutex
+	deleted := make(map[string]bool)
+	inserted := make(map[string]*Item)
+	defer func() {
+		for _, itm := range inserted {
+			m.freeItem(itm)
+		}
+	}()
+
+	onDelete := func(itm *Item) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		key := string(itm.Bytes())
+		if old, ok := inserted[key]; ok {
+			delete(inserted, key)
+			m.freeItem(old)
+		} else {
+			deleted[key] = true
+		}
+		m.freeItem(itm)
+		return nil
+	}
+
+	onInsert := func(itm *Item) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		key := string(itm.Bytes())
+		if old, ok := inserted[key]; ok {
+			m.freeItem(old)
+		}
+		inserted[key] = itm
+		return nil
+	}
+
+	sn := uint32(0)
+	if base.Sn != nil {
+		sn = *base.Sn
+	}
+
+	for _, incrDir := range incrDirs {
+		bs, err := ioutil.ReadFile(filepath.Join(incrDir, "nitro.json"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, ErrCorruptSnapshot
+			}
+			return nil, err
+		}
+
+		var manifest incrementalManifest
+		if err := json.Unmarshal(bs, &manifest); err != nil {
+			return nil, err
+		}
+
+		if manifest.BaseSn != sn {
+			return nil, ErrCorruptSnapshot
+		}
+		sn = manifest.Sn
+
+		if err := m.readShardFiles(filepath.Join(incrDir, "delete"), manifest.Version,
+			concurr, onDelete); err != nil {
+			return nil, err
+		}
+
+		if err := m.readShardFiles(filepath.Join(incrDir, "insert"), manifest.Version,
+			concurr, onInsert); err != nil {
+			return nil, err
+		}
+	}
+
+	skip := func(itm *Item) bool {
+		return deleted[string(itm.Bytes())]
+	}
+
+	if err := m.loadFromDisk(dir, concurr, callb, skip); err != nil {
+		return nil, err
+	}
+
+	m.insertItems(inserted, concurr, callb)
+	inserted = nil
+
+	stats := m.store.GetStats()
+	m.itemsCount = int64(stats.NodeCount)
+	return m.NewSnapshot()
+}
+
+// Item is part of snapshot sn but not of baseSn
+func isInserted(itm *Item, baseSn, sn uint32) bool {
+	return itm.bornSn > baseSn && itm.bornSn <= sn &&
+		(itm.deadSn == 0 || itm.deadSn > sn)
+}
+
+// Item is part of snapshot baseSn but not of sn
+func isDeleted(itm *Item, baseSn, sn uint32) bool {
+	return itm.bornSn <= baseSn && itm.deadSn > baseSn && itm.deadSn <= sn
+}
+
+func (m *MemDB) insertItems(items map[string]*Item, concurr int, callb ItemCallback) {
+	var wg sync.WaitGroup
+
+	ch := make(chan *Item, concurr)
+	for i := 0; i < concurr; i++ {
+		w := m.newWriter()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for itm := range ch {
+				if n, success := w.store.Insert2(unsafe.Pointer(itm),
+					w.insCmp, w.existCmp, w.buf, w.rand.Float32, &w.slSts1); success {
+
+					w.resSts.DeltaRestored += 1
+					if callb != nil {
+						callb(&ItemEntry{itm: (*Item)(n.Item()), n: n})
+					}
+				} else {
+					w.freeItem(itm)
+					w.resSts.DeltaRestoreFailed += 1
+				}
+			}
+
+			m.store.Stats.Merge(&w.slSts1)
+			atomic.AddUint64(&m.restoreStats.DeltaRestored, w.resSts.DeltaRestored)
+			atomic.AddUint64(&m.restoreStats.DeltaRestoreFailed, w.resSts.DeltaRestoreFailed)
+		}()
+	}
+
+	for _, itm := range items {
+		ch <- itm
+	}
+	close(ch)
+	wg.Wait()
+}
+
+// shardFiles is a set of shard files written in parallel along with the
+// files.json and checksums.json that describe them.
+type shardFiles struct {
+	dir     string
+	writers []FileWriter
+	files   []string
+}
+
+func (m *MemDB) createShardFiles(dir string, shards int) (*shardFiles, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &shardFiles{
+		dir:     dir,
+		writers: make([]FileWriter, shards),
+		files:   make([]string, shards),
+	}
+
+	for shard := 0; shard < shards; shard++ {
+		w := m.newFileWriter(m.fileType)
+		file := fmt.Sprintf("shard-%d", shard)
+		if err := w.Open(filepath.Join(dir, file)); err != nil {
+			s.close()
+			return nil, err
+		}
+
+		s.writers[shard] = w
+		s.files[shard] = file
+	}
+
+	return s, nil
+}
+
+// commit flushes the shard files and writes their checksums.
+func (s *shardFiles) commit() error {
+	checksums := make([]uint32, len(s.writers))
+	for id, w := range s.writers {
+		checksums[id] = w.Checksum()
+		err := w.Close()
+		s.writers[id] = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	bs, _ := json.Marshal(s.files)
+	if err := ioutil.WriteFile(filepath.Join(s.dir, "files.json"), bs, 0660); err != nil {
+		return err
+	}
+
+	bs, _ = json.Marshal(checksums)
+	return ioutil.WriteFile(filepath.Join(s.dir, "checksums.json"), bs, 0660)
+}
+
+func (s *shardFiles) close() {
+	for _, w := range s.writers {
+		if w != nil {
+			w.Close()
+		}
+	}
+}
+
+// readShardFiles reads all items from the shard files in dir and verifies
+// their checksums. Ownership of the items passes on to callb.
+func (m *MemDB) readShardFiles(dir string, version int, concurr int,
+	callb func(*Item) error) error {
+
+	var wg sync.WaitGroup
+	var files []string
+	var checksums []uint32
+
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "files.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrCorruptSnapshot
+		}
+		return err
+	}
+	if err := json.Unmarshal(bs, &files); err != nil {
+		return err
+	}
+
+	if bs, err := ioutil.ReadFile(filepath.Join(dir, "checksums.json")); err != nil {
+		return err
+	} else if err := json.Unmarshal(bs, &checksums); err != nil {
+		return err
+	}
+
+	if len(checksums) != len(files) {
+		return ErrCorruptSnapshot
+	}
+
+	readers := make([]FileReader, len(files))
+	errors := make([]error, len(files))
+	defer func() {
+		for _, r := range readers {
+			if r != nil {
+				r.Close()
+			}
+		}
+	}()
+
+	for i, file := range files {
+		r := m.newFileReader(m.fileType, version)
+		if err := r.Open(filepath.Join(dir, file)); err != nil {
+			return err
+		}
+		readers[i] = r
+	}
+
+	wchan := make(chan int)
+	for i := 0; i < concurr; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for shard := range wchan {
+				r := readers[shard]
+				for {
+					itm, err := r.ReadItem()
+					if err != nil {
+						errors[shard] = err
+						break
+					}
+
+					if itm == nil {
+						break
+					}
+
+					if err := callb(itm); err != nil {
+						errors[shard] = err
+						break
+					}
+				}
+			}
+		}()
+	}
+
+	for i := range files {
+		wchan <- i
+	}
+	close(wchan)
+	wg.Wait()
+
+	for _, err := range errors {
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, r := range readers {
+		if checksums[i] != r.Checksum() {
+			return ErrCorruptSnapshot
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package memdb
+
+import "fmt"
+import "os"
+import "testing"
+import "reflect"
+import "path/filepath"
+import "io/ioutil"
+
+func snapshotKeys(snap *Snapshot) []string {
+	var keys []string
+	itr := snap.NewIterator()
+	defer itr.Close()
+	for itr.SeekFirst(); itr.Valid(); itr.Next() {
+		keys = append(keys, string(itr.Get()))
+	}
+	return keys
+}
+
+func loadIncremental(t *testing.T, dir string, incrs ...string) ([]string, error) {
+	db := NewWithConfig(testConf)
+	defer db.Close()
+
+	var incrDirs []string
+	for _, incr := range incrs {
+		incrDirs = append(incrDirs, filepath.Join(dir, incr))
+	}
+
+	snap, err := db.LoadIncrementalFromDisk(filepath.Join(dir, "base"), incrDirs, 8, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Close()
+
+	keys := snapshotKeys(snap)
+	if count := int(snap.Count()); count != len(keys) {
+		t.Errorf("Count mismatch on snapshot. Expected %d, got %d", len(keys), count)
+	}
+	return keys, nil
+}
+
+// Persist a full snapshot followed by two incremental snapshots, keeping
+// the previous persisted snapshot open as the base of the next one.
+func storeIncrementalChain(t *testing.T, dir string) (expected [][]string) {
+	os.RemoveAll(dir)
+	db := NewWithConfig(testConf)
+	defer db.Close()
+
+	key := func(i int) []byte {
+		return []byte(fmt.Sprintf("key-%06d", i))
+	}
+
+	w := db.NewWriter()
+	for i := 0; i < 1000; i++ {
+		w.Put(key(i))
+	}
+
+	base, _ := db.NewSnapshot()
+	base.Open()
+	expected = append(expected, snapshotKeys(base))
+	if err := db.StoreToDisk(filepath.Join(dir, "base"), base, 8, nil); err != nil {
+		t.Fatalf("Expected no error. got=%v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		w.Delete(key(i))
+	}
+	for i := 1000; i < 1100; i++ {
+		w.Put(key(i))
+	}
+	w.Delete(key(500))
+	w.Put(key(500))
+
+	snap1, _ := db.NewSnapshot()
+	snap1.Open()
+	expected = append(expected, snapshotKeys(snap1))
+	if err := db.StoreIncrementalToDisk(filepath.Join(dir, "incr1"), snap1, base, 8, nil); err != nil {
+		t.Fatalf("Expected no error. got=%v", err)
+	}
+	base.Close()
+
+	for i := 2000; i < 2100; i++ {
+		w.Put(key(i))
+	}
+	for i := 1000; i < 1050; i++ {
+		w.Delete(key(i))
+	}
+	for i := 100; i < 150; i++ {
+		w.Delete(key(i))
+	}
+	for i := 0; i < 10; i++ {
+		w.Put(key(i))
+	}
+	// inserted and deleted between two persisted snapshots
+	w.Put(key(5000))
+	s, _ := db.NewSnapshot()
+	s.Close()
+	w.Delete(key(5000))
+
+	snap2, _ := db.NewSnapshot()
+	expected = append(expected, snapshotKeys(snap2))
+	if err := db.StoreIncrementalToDisk(filepath.Join(dir, "incr2"), snap2, snap1, 8, nil); err != nil {
+		t.Fatalf("Expected no error. got=%v", err)
+	}
+	snap1.Close()
+
+	return expected
+}
+
+func TestIncrementalStoreDisk(t *testing.T) {
+	dir := "incr.dump"
+	defer os.RemoveAll(dir)
+	expected := storeIncrementalChain(t, dir)
+
+	chains := [][]string{nil, {"incr1"}, {"incr1", "incr2"}}
+	for i, chain := range chains {
+		keys, err := loadIncremental(t, dir, chain...)
+		if err != nil {
+			t.Fatalf("Expected no error for %v. got=%v", chain, err)
+		}
+		if !reflect.DeepEqual(keys, expected[i]) {
+			t.Errorf("Mismatch for %v. Expected %d items, got %d",
+				chain, len(expected[i]), len(keys))
+		}
+	}
+}
+
+func TestIncrementalCrashConsistency(t *testing.T) {
+	dir := "incr.dump"
+	defer os.RemoveAll(dir)
+	expected := storeIncrementalChain(t, dir)
+
+	// incr2 does not apply on top of base
+	if _, err := loadIncremental(t, dir, "incr2"); err != ErrCorruptSnapshot {
+		t.Errorf("Expected corrupted snapshot for broken chain! got=%v", err)
+	}
+
+	// Partially written shard file in the last incremental snapshot
+	files, _ := filepath.Glob(filepath.Join(dir, "incr2", "insert", "shard-*"))
+	var shard string
+	for _, file := range files {
+		if fi, err := os.Stat(file); err == nil && fi.Size() > 16 {
+			shard = file
+			break
+		}
+	}
+	if shard == "" {
+		t.Fatalf("Expected a non empty shard file")
+	}
+
+	data, _ := ioutil.ReadFile(shard)
+	if err := ioutil.WriteFile(shard, data[:len(data)-10], 0660); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadIncremental(t, dir, "incr1", "incr2"); err == nil {
+		t.Errorf("Expected error for truncated incremental snapshot")
+	}
+	ioutil.WriteFile(shard, data, 0660)
+
+	// Crash before the manifest of the last incremental snapshot is written
+	os.Remove(filepath.Join(dir, "incr2", "nitro.json"))
+	if _, err := loadIncremental(t, dir, "incr1", "incr2"); err != ErrCorruptSnapshot {
+		t.Errorf("Expected corrupted snapshot for incomplete chain! got=%v", err)
+	}
+
+	// Recovery falls back to the previous incremental snapshot
+	keys, err := loadIncremental(t, dir, "incr1")
+	if err != nil {
+		t.Fatalf("Expected no error. got=%v", err)
+	}
+	if !reflect.DeepEqual(keys, expected[1]) {
+		t.Errorf("Mismatch. Expected %d items, got %d", len(expected[1]), len(keys))
+	}
+}
@@ -9,9 +9,20 @@ type Iterator struct {
 	count       int
 	refreshRate int
 
-	snap *Snapshot
-	iter *skiplist.Iterator
-	buf  *skiplist.ActionBuffer
+	snap    *Snapshot
+	iter    *skiplist.Iterator
+	buf     *skiplist.ActionBuffer
+	reverse bool
+
+	// visit every version of an item irrespective of the snapshot
+	allVersions bool
+}
+
+func (it *Iterator) isUnwanted(itm *Item) bool {
+	if it.allVersions {
+		return false
+	}
+	return itm.bornSn > it.snap.sn || (itm.deadSn > 0 && itm.deadSn <= it.snap.sn)
 }
 
 func (it *Iterator) skipUnwanted() {
@@ -20,24 +31,57 @@ loop:
 		return
 	}
 	itm := (*Item)(it.iter.Get())
-	if itm.bornSn > it.snap.sn || (itm.deadSn > 0 && itm.deadSn <= it.snap.sn) {
+	if it.isUnwanted(itm) {
 		it.iter.Next()
 		it.count++
 		goto loop
 	}
 }
 
+// Multiple versions of a key can be present in the skiplist, they are
+// ordered by bornSn. Moving backwards uses insCmp so that none of the
+// versions are skipped.
+func (it *Iterator) skipUnwantedPrev() {
+loop:
+	if !it.iter.Valid() {
+		return
+	}
+	itm := (*Item)(it.iter.Get())
+	if it.isUnwanted(itm) {
+		it.iter.PrevWithCmp(it.snap.db.insCmp)
+		it.count++
+		goto loop
+	}
+}
+
 func (it *Iterator) SeekFirst() {
+	it.reverse = false
 	it.iter.SeekFirst()
 	it.skipUnwanted()
 }
 
 func (it *Iterator) Seek(bs []byte) {
+	it.reverse = false
 	itm := it.snap.db.newItem(bs, false)
 	it.iter.Seek(unsafe.Pointer(itm))
 	it.skipUnwanted()
 }
 
+func (it *Iterator) SeekLast() {
+	it.reverse = true
+	it.iter.SeekLast()
+	it.skipUnwantedPrev()
+}
+
+// SeekForPrev positions the iterator at the last item less than or
+// equal to bs.
+func (it *Iterator) SeekForPrev(bs []byte) {
+	it.reverse = true
+	itm := it.snap.db.newItem(bs, false)
+	it.iter.SeekForPrevWithCmp(unsafe.Pointer(itm), it.snap.db.seekPrevCmp)
+	it.skipUnwantedPrev()
+}
+
 func (it *Iterator) Valid() bool {
 	return it.iter.Valid()
 }
@@ -51,6 +95,7 @@ func (it *Iterator) GetNode() *skiplist.Node {
 }
 
 func (it *Iterator) Next() {
+	it.reverse = false
 	it.iter.Next()
 	it.count++
 	it.skipUnwanted()
@@ -60,13 +105,28 @@ func (it *Iterator) Next() {
 	}
 }
 
+func (it *Iterator) Prev() {
+	it.reverse = true
+	it.iter.PrevWithCmp(it.snap.db.insCmp)
+	it.count++
+	it.skipUnwantedPrev()
+	if it.refreshRate > 0 && it.count > it.refreshRate {
+		it.Refresh()
+		it.count = 0
+	}
+}
+
 // Refresh can help safe-memory-reclaimer to free deleted objects
 func (it *Iterator) Refresh() {
 	if it.Valid() {
 		itm := it.snap.db.ptrToItem(it.GetNode().Item())
 		it.iter.Close()
 		it.iter = it.snap.db.store.NewIterator(it.snap.db.iterCmp, it.buf)
-		it.iter.Seek(unsafe.Pointer(itm))
+		if it.reverse {
+			it.iter.SeekForPrevWithCmp(unsafe.Pointer(itm), it.snap.db.insCmp)
+		} else {
+			it.iter.Seek(unsafe.Pointer(itm))
+		}
 	}
 }
 
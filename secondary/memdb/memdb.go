@@ -122,6 +122,19 @@ func newExistCompare(keyCmp KeyCompare) skiplist.CompareFn {
 	}
 }
 
+// Items with key equal to the seek key compare less than the seek key,
+// hence a search ends past all the versions of the key.
+func newSeekPrevCompare(keyCmp KeyCompare) skiplist.CompareFn {
+	return func(this, that unsafe.Pointer) int {
+		thisItem := (*Item)(this)
+		thatItem := (*Item)(that)
+		if v := keyCmp(thisItem.Bytes(), thatItem.Bytes()); v != 0 {
+			return v
+		}
+		return -1
+	}
+}
+
 func defaultKeyCmp(this, that []byte) int {
 	return bytes.Compare(this, that)
 }
@@ -270,6 +283,7 @@ type Config struct {
 	insCmp      skiplist.CompareFn
 	iterCmp     skiplist.CompareFn
 	existCmp    skiplist.CompareFn
+	seekPrevCmp skiplist.CompareFn
 	refreshRate int
 
 	ignoreItemSize bool
@@ -287,6 +301,7 @@ func (cfg *Config) SetKeyComparator(cmp KeyCompare) {
 	cfg.insCmp = newInsertCompare(cmp)
 	cfg.iterCmp = newIterCompare(cmp)
 	cfg.existCmp = newExistCompare(cmp)
+	cfg.seekPrevCmp = newSeekPrevCompare(cmp)
 }
 
 func (cfg *Config) SetFileType(t FileType) error {
@@ -707,6 +722,14 @@ func (m *MemDB) ptrToItem(itmPtr unsafe.Pointer) *Item {
 }
 
 func (m *MemDB) Visitor(snap *Snapshot, callb VisitorCallback, shards int, concurrency int) error {
+	return m.visitor(snap, callb, shards, concurrency, false)
+}
+
+// visitor with allVersions set also visits the items that are not part of
+// snap, i.e. items born after or deleted by snap that are not yet freed.
+func (m *MemDB) visitor(snap *Snapshot, callb VisitorCallback, shards int,
+	concurrency int, allVersions bool) error {
+
 	var wg sync.WaitGroup
 	var pivotItems []*Item
 
@@ -761,6 +784,7 @@ func (m *MemDB) Visitor(snap *Snapshot, callb VisitorCallback, shards int, concu
 				}
 				defer itr.Close()
 
+				itr.allVersions = allVersions
 				itr.SetRefreshRate(m.refreshRate)
 				if startItem == nil {
 					itr.SeekFirst()
@@ -773,6 +797,12 @@ func (m *MemDB) Visitor(snap *Snapshot, callb VisitorCallback, shards int, concu
 						break loop
 					}
 
+					// Older versions of the pivot key belong to the previous shard
+					if allVersions && startItem != nil &&
+						m.insCmp(itr.GetNode().Item(), unsafe.Pointer(startItem)) < 0 {
+						continue
+					}
+
 					itm := (*Item)(itr.GetNode().Item())
 					if err := callb(itm, shard); err != nil {
 						errors[shard] = err
@@ -966,7 +996,7 @@ func (m *MemDB) StoreToDisk(dir string, snap *Snapshot, concurr int, itmCallback
 		return nil
 	}
 
-	manifest, _ := json.Marshal(map[string]interface{}{"version": version})
+	manifest, _ := json.Marshal(map[string]interface{}{"version": version, "sn": snap.sn})
 	if err = ioutil.WriteFile(filepath.Join(manifestdir, "nitro.json"), manifest, 0660); err == nil {
 		if err = m.Visitor(snap, visitorCallback, shards, concurr); err == nil {
 			bs, _ := json.Marshal(files)
@@ -985,6 +1015,20 @@ func (m *MemDB) StoreToDisk(dir string, snap *Snapshot, concurr int, itmCallback
 }
 
 func (m *MemDB) LoadFromDisk(dir string, concurr int, callb ItemCallback) (*Snapshot, error) {
+	if err := m.loadFromDisk(dir, concurr, callb, nil); err != nil {
+		return nil, err
+	}
+
+	stats := m.store.GetStats()
+	m.itemsCount = int64(stats.NodeCount)
+	return m.NewSnapshot()
+}
+
+// loadFromDisk builds the store from the snapshot files in dir, items for
+// which skip returns true are dropped.
+func (m *MemDB) loadFromDisk(dir string, concurr int, callb ItemCallback,
+	skip func(*Item) bool) error {
+
 	var wg sync.WaitGroup
 	datadir := filepath.Join(dir, "data")
 	var files []string
@@ -996,15 +1040,15 @@ func (m *MemDB) LoadFromDisk(dir string, concurr int, callb ItemCallback) (*Snap
 	if bs, err := ioutil.ReadFile(filepath.Join(manifestdir, "nitro.json")); err == nil {
 		mMap := make(map[string]int)
 		if err = json.Unmarshal(bs, &mMap); err != nil {
-			return nil, err
+			return err
 		}
 		version = mMap["version"]
 	} else if !os.IsNotExist(err) {
-		return nil, err
+		return err
 	}
 
 	if bs, err := ioutil.ReadFile(filepath.Join(datadir, "files.json")); err != nil {
-		return nil, err
+		return err
 	} else {
 		json.Unmarshal(bs, &files)
 	}
@@ -1043,7 +1087,7 @@ func (m *MemDB) LoadFromDisk(dir string, concurr int, callb ItemCallback) (*Snap
 		r := m.newFileReader(m.fileType, version)
 		datafile := filepath.Join(datadir, file)
 		if err := r.Open(datafile); err != nil {
-			return nil, err
+			return err
 		}
 
 		readers[i] = r
@@ -1067,6 +1111,11 @@ func (m *MemDB) LoadFromDisk(dir string, concurr int, callb ItemCallback) (*Snap
 					if itm == nil {
 						break loop
 					}
+
+					if skip != nil && skip(itm) {
+						m.freeItem(itm)
+						continue
+					}
 					segments[shard].Add(unsafe.Pointer(itm))
 				}
 			}
@@ -1080,13 +1129,13 @@ func (m *MemDB) LoadFromDisk(dir string, concurr int, callb ItemCallback) (*Snap
 	wg.Wait()
 	for i, rdr := range readers {
 		if checksums[i] != 0 && checksums[i] != rdr.Checksum() {
-			return nil, ErrCorruptSnapshot
+			return ErrCorruptSnapshot
 		}
 	}
 
 	for _, err := range errors {
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
@@ -1124,7 +1173,7 @@ func (m *MemDB) LoadFromDisk(dir string, concurr int, callb ItemCallback) (*Snap
 			r := m.newFileReader(m.fileType, version)
 			deltafile := filepath.Join(deltadir, file)
 			if err := r.Open(deltafile); err != nil {
-				return nil, err
+				return err
 			}
 
 			readers[i] = r
@@ -1151,6 +1200,11 @@ func (m *MemDB) LoadFromDisk(dir string, concurr int, callb ItemCallback) (*Snap
 						}
 
 						w := writers[id]
+						if skip != nil && skip(itm) {
+							w.freeItem(itm)
+							continue
+						}
+
 						if n, success := w.store.Insert2(unsafe.Pointer(itm),
 							w.insCmp, w.existCmp, w.buf, w.rand.Float32, &w.slSts1); success {
 
@@ -1181,20 +1235,18 @@ func (m *MemDB) LoadFromDisk(dir string, concurr int, callb ItemCallback) (*Snap
 
 		for i, rdr := range readers {
 			if deltaChecksums[i] != 0 && deltaChecksums[i] != rdr.Checksum() {
-				return nil, ErrCorruptSnapshot
+				return ErrCorruptSnapshot
 			}
 		}
 
 		for _, err := range errors {
 			if err != nil {
-				return nil, err
+				return err
 			}
 		}
 	}
 
-	stats := m.store.GetStats()
-	m.itemsCount = int64(stats.NodeCount)
-	return m.NewSnapshot()
+	return nil
 }
 
 func (m *MemDB) DumpStats() string {
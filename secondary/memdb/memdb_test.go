@@ -336,6 +336,65 @@ func TestDelete(t *testing.T) {
 	fmt.Println(db.DumpStats())
 }
 
+func TestReverseIterator(t *testing.T) {
+	n := 100
+	db := NewWithConfig(testConf)
+	defer db.Close()
+	w := db.NewWriter()
+	for i := 0; i < n; i++ {
+		w.Put([]byte(fmt.Sprintf("%010d", i)))
+	}
+	snap1, _ := w.NewSnapshot()
+	defer snap1.Close()
+
+	// Delete even items and reinsert every 10th item, which leaves
+	// two versions of those keys in the skiplist.
+	for i := 0; i < n; i += 2 {
+		w.Delete([]byte(fmt.Sprintf("%010d", i)))
+	}
+	for i := 0; i < n; i += 10 {
+		w.Put([]byte(fmt.Sprintf("%010d", i)))
+	}
+	snap2, _ := w.NewSnapshot()
+	defer snap2.Close()
+
+	var expected []string
+	for i := n - 1; i >= 0; i-- {
+		expected = append(expected, fmt.Sprintf("%010d", i))
+	}
+	itr := snap1.NewIterator()
+	i := 0
+	for itr.SeekLast(); itr.Valid(); itr.Prev() {
+		if got := string(itr.Get()); i < len(expected) && got != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], got)
+		}
+		i++
+	}
+	itr.Close()
+	if i != len(expected) {
+		t.Errorf("Expected %d items, got %d", len(expected), i)
+	}
+
+	expected = expected[:0]
+	for i := 55; i >= 0; i-- {
+		if i%2 == 1 || i%10 == 0 {
+			expected = append(expected, fmt.Sprintf("%010d", i))
+		}
+	}
+	itr = snap2.NewIterator()
+	i = 0
+	for itr.SeekForPrev([]byte(fmt.Sprintf("%010d", 56))); itr.Valid(); itr.Prev() {
+		if got := string(itr.Get()); i < len(expected) && got != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], got)
+		}
+		i++
+	}
+	itr.Close()
+	if i != len(expected) {
+		t.Errorf("Expected %d items, got %d", len(expected), i)
+	}
+}
+
 func doReplace(wg *sync.WaitGroup, t *testing.T, w *Writer, start, end int) {
 	defer wg.Done()
 
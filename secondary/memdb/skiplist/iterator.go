@@ -53,8 +53,37 @@ func (it *Iterator) Seek(itm unsafe.Pointer) bool {
 	return found
 }
 
+// SeekLast positions the iterator at the last item in the list.
+func (it *Iterator) SeekLast() {
+	it.valid = true
+	it.deleted = false
+	it.s.findPath(nil, it.cmp, it.buf, &it.s.Stats)
+	it.prev = nil
+	it.curr = it.buf.preds[0]
+}
+
+// SeekForPrev positions the iterator at the last item less than or equal
+// to itm.
+func (it *Iterator) SeekForPrev(itm unsafe.Pointer) bool {
+	return it.SeekForPrevWithCmp(itm, it.cmp)
+}
+
+func (it *Iterator) SeekForPrevWithCmp(itm unsafe.Pointer, cmp CompareFn) bool {
+	it.valid = true
+	it.deleted = false
+	found := it.s.findPath(itm, cmp, it.buf, &it.s.Stats) != nil
+	if found {
+		it.prev = it.buf.preds[0]
+		it.curr = it.buf.succs[0]
+	} else {
+		it.prev = nil
+		it.curr = it.buf.preds[0]
+	}
+	return found
+}
+
 func (it *Iterator) Valid() bool {
-	if it.valid && it.curr == it.s.tail {
+	if it.valid && (it.curr == it.s.tail || it.curr == it.s.head) {
 		it.valid = false
 	}
 
@@ -90,10 +119,15 @@ retry:
 		// Current node is deleted. Unlink current node from the level
 		// and make next node as current node.
 		// If it fails, refresh the path buffer and obtain new current node.
-		if it.s.helpDelete(0, it.prev, it.curr, next, &it.s.Stats) {
+		//
+		// Predecessor is not known if the iterator was positioned by a
+		// backward seek, the path is refreshed instead.
+		if it.prev != nil && it.s.helpDelete(0, it.prev, it.curr, next, &it.s.Stats) {
 			it.curr = next
 		} else {
-			atomic.AddUint64(&it.s.Stats.readConflicts, 1)
+			if it.prev != nil {
+				atomic.AddUint64(&it.s.Stats.readConflicts, 1)
+			}
 			found := it.s.findPath(it.curr.Item(), it.cmp, it.buf, &it.s.Stats) != nil
 			last := it.curr
 			it.prev = it.buf.preds[0]
@@ -108,6 +142,31 @@ retry:
 	}
 }
 
+// Prev moves the iterator to the previous item. Nodes are only linked in
+// forward direction, so the previous item is found by a fresh search for
+// the current item. This also unlinks any deleted nodes on the way and
+// observes items inserted concurrently. The current node can be deleted
+// meanwhile, it remains accessible under the iterator's barrier session.
+func (it *Iterator) Prev() {
+	it.PrevWithCmp(it.cmp)
+}
+
+// PrevWithCmp is same as Prev, but uses cmp to locate the previous item.
+// cmp should impose a total order on the items if the iterator compare
+// function does not.
+func (it *Iterator) PrevWithCmp(cmp CompareFn) {
+	it.deleted = false
+	if it.curr == it.s.head {
+		it.valid = false
+		return
+	}
+
+	it.valid = true
+	it.s.findPath(it.curr.Item(), cmp, it.buf, &it.s.Stats)
+	it.prev = nil
+	it.curr = it.buf.preds[0]
+}
+
 func (it *Iterator) Close() {
 	it.s.barrier.Release(it.bs)
 }
@@ -40,6 +40,108 @@ func TestInsert(t *testing.T) {
 	}
 }
 
+func TestReverseIterator(t *testing.T) {
+	s := New()
+	cmp := CompareBytes
+	buf := s.MakeBuf()
+	defer s.FreeBuf(buf)
+
+	for i := 0; i < 2000; i++ {
+		s.Insert(NewByteKeyItem([]byte(fmt.Sprintf("%010d", i))), cmp, buf, &s.Stats)
+	}
+
+	for i := 0; i < 2000; i += 2 {
+		s.Delete(NewByteKeyItem([]byte(fmt.Sprintf("%010d", i))), cmp, buf, &s.Stats)
+	}
+
+	itr := s.NewIterator(cmp, buf)
+	defer itr.Close()
+
+	count := 0
+	for itr.SeekLast(); itr.Valid(); itr.Prev() {
+		expected := fmt.Sprintf("%010d", 1999-count*2)
+		got := string(*(*byteKeyItem)(itr.Get()))
+		count++
+		if got != expected {
+			t.Errorf("Expected %s, got %v", expected, got)
+		}
+	}
+
+	if count != 1000 {
+		t.Errorf("Expected count = 1000, got %v", count)
+	}
+
+	// Deleted item, positioned at the previous one
+	if itr.SeekForPrev(NewByteKeyItem([]byte(fmt.Sprintf("%010d", 1500)))) {
+		t.Errorf("Expected item not to be found")
+	}
+	if got := string(*(*byteKeyItem)(itr.Get())); got != fmt.Sprintf("%010d", 1499) {
+		t.Errorf("Expected %010d, got %v", 1499, got)
+	}
+
+	// Change direction
+	itr.Next()
+	if got := string(*(*byteKeyItem)(itr.Get())); got != fmt.Sprintf("%010d", 1501) {
+		t.Errorf("Expected %010d, got %v", 1501, got)
+	}
+	itr.Prev()
+	itr.Prev()
+	if got := string(*(*byteKeyItem)(itr.Get())); got != fmt.Sprintf("%010d", 1497) {
+		t.Errorf("Expected %010d, got %v", 1497, got)
+	}
+
+	itr.SeekForPrev(NewByteKeyItem([]byte(fmt.Sprintf("%010d", 0))))
+	if itr.Valid() {
+		t.Errorf("Expected iterator to be invalid")
+	}
+}
+
+func TestReverseIteratorConcurrentDelete(t *testing.T) {
+	var wg sync.WaitGroup
+	sl := New()
+	n := 100000
+	wg.Add(1)
+	go doInsert(sl, &wg, n, false)
+	wg.Wait()
+
+	// Delete even items while iterating backwards
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		buf := sl.MakeBuf()
+		defer sl.FreeBuf(buf)
+		for i := 0; i < n; i += 2 {
+			itm := intKeyItem(i)
+			sl.Delete(unsafe.Pointer(&itm), CompareInt, buf, &sl.Stats)
+		}
+	}()
+
+	buf := sl.MakeBuf()
+	defer sl.FreeBuf(buf)
+	itr := sl.NewIterator(CompareInt, buf)
+	last := n
+	for itr.SeekLast(); itr.Valid(); itr.Prev() {
+		curr := int(*(*intKeyItem)(itr.Get()))
+		if curr >= last {
+			t.Errorf("Expected item less than %d, got %d", last, curr)
+		}
+		last = curr
+	}
+	itr.Close()
+	wg.Wait()
+
+	count := 0
+	itr = sl.NewIterator(CompareInt, buf)
+	for itr.SeekLast(); itr.Valid(); itr.Prev() {
+		count++
+	}
+	itr.Close()
+
+	if count != n/2 {
+		t.Errorf("Expected count = %d, got %d", n/2, count)
+	}
+}
+
 func doInsert(sl *Skiplist, wg *sync.WaitGroup, n int, isRand bool) {
 	defer wg.Done()
 	buf := sl.MakeBuf()
@@ -108,8 +108,10 @@ type IndexSpec struct {
 	PartitionScheme    string             `json:"partitionScheme,omitempty"`
 	HashScheme         uint64             `json:"hashScheme,omitempty"`
 	PartitionKeys      []string           `json:"partitionKeys,omitempty"`
+	RangeBoundaries    []string           `json:"rangeBoundaries,omitempty"`
 	Replica            uint64             `json:"replica,omitempty"`
 	Desc               []bool             `json:"desc,omitempty"`
+	Collations         []string           `json:"collations,omitempty"`
 	Using              string             `json:"using,omitempty"`
 	ExprType           string             `json:"exprType,omitempty"`
 
@@ -1321,6 +1323,11 @@ func indexUsageFromSpec(sizing SizingMethod, spec *IndexSpec) ([]*IndexUsage, er
 		}
 	}
 
+	// range partitions are fixed by the boundaries.
+	if common.PartitionScheme(spec.PartitionScheme) == common.RANGE {
+		spec.NumPartition = uint64(len(spec.RangeBoundaries) + 1)
+	}
+
 	var startPartnId int
 	if common.IsPartitioned(common.PartitionScheme(spec.PartitionScheme)) {
 		startPartnId = 1
@@ -1350,8 +1357,6 @@ func indexUsageFromSpec(sizing SizingMethod, spec *IndexSpec) ([]*IndexUsage, er
 			index.Instance = &common.IndexInst{}
 			index.Instance.InstId = index.InstId
 			index.Instance.ReplicaId = i
-			index.Instance.Pc = common.NewKeyPartitionContainer(numVbuckets, int(spec.NumPartition),
-				common.PartitionScheme(spec.PartitionScheme), common.HashScheme(spec.HashScheme))
 			index.Instance.State = common.INDEX_STATE_READY
 			index.Instance.Stream = common.NIL_STREAM
 			index.Instance.Error = ""
@@ -1369,9 +1374,12 @@ func indexUsageFromSpec(sizing SizingMethod, spec *IndexSpec) ([]*IndexUsage, er
 			index.Instance.Defn.RetainDeletedXATTR = spec.RetainDeletedXATTR
 			index.Instance.Defn.Deferred = spec.Deferred
 			index.Instance.Defn.Desc = spec.Desc
+			index.Instance.Defn.Collations = spec.Collations
 			index.Instance.Defn.NumReplica = uint32(spec.Replica) - 1
 			index.Instance.Defn.PartitionScheme = common.PartitionScheme(spec.PartitionScheme)
 			index.Instance.Defn.PartitionKeys = spec.PartitionKeys
+			index.Instance.Defn.HashScheme = common.HashScheme(spec.HashScheme)
+			index.Instance.Defn.RangeBoundaries = spec.RangeBoundaries
 			index.Instance.Defn.NumDoc = spec.NumDoc / uint64(spec.NumPartition)
 			index.Instance.Defn.DocKeySize = spec.DocKeySize
 			index.Instance.Defn.SecKeySize = spec.SecKeySize
@@ -1381,6 +1389,8 @@ func indexUsageFromSpec(sizing SizingMethod, spec *IndexSpec) ([]*IndexUsage, er
 			if index.Instance.Defn.ResidentRatio == 0 {
 				index.Instance.Defn.ResidentRatio = 100
 			}
+			index.Instance.Pc = common.NewIndexPartitionContainer(numVbuckets, int(spec.NumPartition),
+				&index.Instance.Defn)
 
 			index.NumOfDocs = spec.NumDoc / uint64(spec.NumPartition)
 			index.AvgDocKeySize = spec.DocKeySize
@@ -1391,6 +1401,13 @@ func indexUsageFromSpec(sizing SizingMethod, spec *IndexSpec) ([]*IndexUsage, er
 			index.MutationRate = spec.MutationRate
 			index.ScanRate = spec.ScanRate
 
+			// Range partitioned index is typically on an ever increasing key
+			// (e.g. timestamp), where the last partition takes all the
+			// mutations.  Size the partitions accordingly for placement.
+			if common.PartitionScheme(spec.PartitionScheme) == common.RANGE && j != int(spec.NumPartition)-1 {
+				index.MutationRate = 0
+			}
+
 			// This is need to compute stats for new indexes
 			// The index size will be recomputed later on in plan/rebalance
 			sizing.ComputeIndexSize(index)
@@ -312,7 +312,7 @@ func ConvertToIndexUsage(config common.Config, defn *common.IndexDefn, localMeta
 
 				// update partition
 				numVbuckets := config["indexer.numVbuckets"].Int()
-				pc := common.NewKeyPartitionContainer(numVbuckets, int(inst.NumPartitions), defn.PartitionScheme, defn.HashScheme)
+				pc := common.NewIndexPartitionContainer(numVbuckets, int(inst.NumPartitions), defn)
 
 				// Is the index being deleted by user?   Thsi will read the delete token from metakv.  If untable read from metakv,
 				// pendingDelete is false (cannot assert index is to-be-delete).
@@ -1233,7 +1233,7 @@ func processCreateToken(clusterUrl string, indexers []*IndexerNode, config commo
 			index := makeIndexUsageFromDefn(defn, defn.InstId, partition, uint64(defn.NumPartitions))
 
 			numVbuckets := config["indexer.numVbuckets"].Int()
-			pc := common.NewKeyPartitionContainer(numVbuckets, int(defn.NumPartitions), defn.PartitionScheme, defn.HashScheme)
+			pc := common.NewIndexPartitionContainer(numVbuckets, int(defn.NumPartitions), defn)
 
 			index.Instance = &common.IndexInst{
 				InstId:    defn.InstId,
@@ -39,6 +39,7 @@ func (p *Projector) mainAdminPort(reqch chan ap.Request) {
 	p.admind.Register(reqShutdownFeed)
 	p.admind.Register(reqStats)
 	p.admind.RegisterHTTPHandler("/stats", p.handleStats)
+	p.admind.RegisterHTTPHandler("/metrics", p.handleMetrics)
 	p.admind.RegisterHTTPHandler("/settings", p.handleSettings)
 
 	// debug pprof hanlders.
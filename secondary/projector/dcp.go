@@ -34,10 +34,13 @@ type BucketFeeder interface {
 	// GetChannel return a mutation channel.
 	GetChannel() (mutch <-chan *mc.DcpEvent)
 
-	// StartVbStreams starts a set of vbucket streams on this feed.
+	// StartVbStreams starts a set of vbucket streams on this feed,
+	// streaming only the listed collections, or all collections if the
+	// list is empty.
 	// returns list of vbuckets for which StreamRequest is successfully
 	// posted.
-	StartVbStreams(opaque uint16, ts *protobuf.TsVbuuid) error
+	StartVbStreams(
+		opaque uint16, ts *protobuf.TsVbuuid, collectionIds []string) error
 
 	// EndVbStreams ends an existing vbucket stream from this feed.
 	EndVbStreams(opaque uint16, endTs *protobuf.TsVbuuid) error
@@ -81,7 +84,7 @@ func (bdcp *bucketDcp) GetChannel() (mutch <-chan *mc.DcpEvent) {
 
 // StartVbStreams implements Feeder{} interface.
 func (bdcp *bucketDcp) StartVbStreams(
-	opaque uint16, reqTs *protobuf.TsVbuuid) error {
+	opaque uint16, reqTs *protobuf.TsVbuuid, collectionIds []string) error {
 
 	var err error
 
@@ -95,8 +98,9 @@ func (bdcp *bucketDcp) StartVbStreams(
 		flags, vbuuid := uint32(0), vbuuids[i]
 		start, end := seqnos[i], uint64(0xFFFFFFFFFFFFFFFF)
 		snapStart, snapEnd := snapshots[i].GetStart(), snapshots[i].GetEnd()
-		e := bdcp.dcpFeed.DcpRequestStream(
-			vbno, opaque, flags, vbuuid, start, end, snapStart, snapEnd)
+		e := bdcp.dcpFeed.DcpRequestStreamWithCollections(
+			vbno, opaque, flags, vbuuid, start, end, snapStart, snapEnd,
+			collectionIds)
 		if e != nil {
 			err = e
 		}
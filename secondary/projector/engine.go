@@ -58,6 +58,21 @@ func (engine *Engine) SnapshotData(
 	return engine.evaluator.SnapshotData(m, vbno, vbuuid, seqno, opaque2)
 }
 
+// SystemEventData from this engine.
+func (engine *Engine) SystemEventData(
+	m *mc.DcpEvent, vbno uint16, vbuuid,
+	seqno uint64, opaque2 uint64) interface{} {
+
+	return engine.evaluator.SystemEventData(m, vbno, vbuuid, seqno, opaque2)
+}
+
+// UpdateSeqnoData from this engine.
+func (engine *Engine) UpdateSeqnoData(
+	vbno uint16, vbuuid, seqno uint64, opaque2 uint64) interface{} {
+
+	return engine.evaluator.UpdateSeqnoData(vbno, vbuuid, seqno, opaque2)
+}
+
 // StreamEndData from this engine.
 func (engine *Engine) StreamEndData(
 	vbno uint16, vbuuid, seqno uint64, opaque2 uint64) interface{} {
@@ -86,6 +101,11 @@ func (engine *Engine) GetIndexName() string {
 	return engine.evaluator.GetIndexName()
 }
 
+// CollectionID of the index.
+func (engine *Engine) CollectionID() string {
+	return engine.evaluator.CollectionID()
+}
+
 // Get name of the bucket
 func (engine *Engine) Bucket() string {
 	return engine.evaluator.Bucket()
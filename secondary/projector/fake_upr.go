@@ -84,7 +84,7 @@ func (b *FakeBucket) GetChannel() <-chan *mc.DcpEvent {
 
 // StartVbStreams is method receiver for BucketFeeder interface
 func (b *FakeBucket) StartVbStreams(
-	opaque uint16, ts *protobuf.TsVbuuid) (err error) {
+	opaque uint16, ts *protobuf.TsVbuuid, collectionIds []string) (err error) {
 
 	return err
 }
@@ -1,6 +1,7 @@
 package projector
 
 import "fmt"
+import "sort"
 import "time"
 
 import "github.com/couchbase/indexing/secondary/logging"
@@ -55,6 +56,9 @@ type Feed struct {
 	rollTss map[string]*protobuf.TsVbuuid // bucket -> TsVbuuid
 
 	feeders map[string]BucketFeeder // bucket -> BucketFeeder{}
+	// collections, streams are filtered to the collections of indexes
+	// on the bucket when they are requested.
+	collections map[string][]string // bucket -> []collectionId
 	// downstream
 	kvdata    map[string]*KVData            // bucket -> kvdata
 	engines   map[string]map[uint64]*Engine // bucket -> uuid -> engine
@@ -108,6 +112,8 @@ func NewFeed(
 		actTss:  make(map[string]*protobuf.TsVbuuid),
 		rollTss: make(map[string]*protobuf.TsVbuuid),
 		feeders: make(map[string]BucketFeeder),
+
+		collections: make(map[string][]string),
 		// downstream
 		kvdata:    make(map[string]*KVData),
 		engines:   make(map[string]map[uint64]*Engine),
@@ -1268,6 +1274,9 @@ func (feed *Feed) addInstances(
 				return errResp, err
 			}
 			tsResp = tsResp.AddCurrentTimestamp(feed.pooln, bucketn, curSeqnos)
+			if err := feed.restreamCollections(opaque, bucketn); err != nil {
+				return errResp, err
+			}
 
 		} else {
 			fmsg := "%v ##%x addInstances() invalid-bucket %q\n"
@@ -1279,6 +1288,46 @@ func (feed *Feed) addInstances(
 	return tsResp, err
 }
 
+// engineCollections return the sorted list of collections on which
+// indexes of the bucket are defined.
+func (feed *Feed) engineCollections(bucketn string) []string {
+	seen := make(map[string]bool)
+	collectionIds := make([]string, 0)
+	for _, engine := range feed.engines[bucketn] {
+		if collectionId := engine.CollectionID(); !seen[collectionId] {
+			seen[collectionId] = true
+			collectionIds = append(collectionIds, collectionId)
+		}
+	}
+	sort.Strings(collectionIds)
+	return collectionIds
+}
+
+// restreamCollections ends active streams of the bucket if an index is
+// defined on a collection they are not filtered to, downstream shall
+// restart them with the new set of collections.
+func (feed *Feed) restreamCollections(opaque uint16, bucketn string) error {
+	streamed := make(map[string]bool)
+	for _, collectionId := range feed.collections[bucketn] {
+		streamed[collectionId] = true
+	}
+	missing := false
+	for _, collectionId := range feed.engineCollections(bucketn) {
+		missing = missing || !streamed[collectionId]
+	}
+	actTs, ok := feed.actTss[bucketn]
+	if !missing || !ok || len(actTs.GetVbnos()) == 0 {
+		return nil
+	}
+
+	fmsg := "%v ##%x restreaming %v for collections %v\n"
+	logging.Infof(fmsg, feed.logPrefix, opaque, bucketn,
+		feed.engineCollections(bucketn))
+	req := protobuf.NewShutdownVbucketsRequest(feed.topic)
+	req.Append(actTs.Clone())
+	return feed.shutdownVbuckets(req, opaque)
+}
+
 // only data-path shall be updated.
 // * if it is the last instance defined on the bucket, then
 //   use delBuckets() API to delete the bucket.
@@ -1444,9 +1493,10 @@ func (feed *Feed) cleanupBucket(bucketn string, enginesOk bool) {
 	if enginesOk {
 		delete(feed.engines, bucketn) // :SideEffect:
 	}
-	delete(feed.reqTss, bucketn)  // :SideEffect:
-	delete(feed.actTss, bucketn)  // :SideEffect:
-	delete(feed.rollTss, bucketn) // :SideEffect:
+	delete(feed.reqTss, bucketn)      // :SideEffect:
+	delete(feed.actTss, bucketn)      // :SideEffect:
+	delete(feed.rollTss, bucketn)     // :SideEffect:
+	delete(feed.collections, bucketn) // :SideEffect:
 	// close upstream
 	feeder, ok := feed.feeders[bucketn]
 	if ok {
@@ -1497,11 +1547,13 @@ func (feed *Feed) openFeeder(
 	}
 	name := newDCPConnectionName(bucket.Name, feed.topic, uuid.Uint64())
 	dcpConfig := map[string]interface{}{
-		"genChanSize":    feed.config["dcp.genChanSize"].Int(),
-		"dataChanSize":   feed.config["dcp.dataChanSize"].Int(),
-		"numConnections": feed.config["dcp.numConnections"].Int(),
-		"latencyTick":    feed.config["dcp.latencyTick"].Int(),
-		"activeVbOnly":   feed.config["dcp.activeVbOnly"].Bool(),
+		"genChanSize":      feed.config["dcp.genChanSize"].Int(),
+		"dataChanSize":     feed.config["dcp.dataChanSize"].Int(),
+		"numConnections":   feed.config["dcp.numConnections"].Int(),
+		"latencyTick":      feed.config["dcp.latencyTick"].Int(),
+		"activeVbOnly":     feed.config["dcp.activeVbOnly"].Bool(),
+		"collectionsAware": feed.config["dcp.collectionsAware"].Bool(),
+		"snappy":           feed.config["dcp.snappy"].Bool(),
 	}
 	kvaddr, err := feed.getLocalKVAddrs(pooln, bucketn, opaque)
 	if err != nil {
@@ -1545,9 +1597,12 @@ func (feed *Feed) bucketFeed(
 		}
 
 	} else if start {
-		fmsg := "%v ##%x start-timestamp %v\n"
-		logging.Infof(fmsg, feed.logPrefix, opaque, reqTs.Repr())
-		if err = feeder.StartVbStreams(opaque, reqTs); err != nil {
+		collectionIds := feed.engineCollections(bucketn)
+		fmsg := "%v ##%x start-timestamp %v collections %v\n"
+		logging.Infof(fmsg, feed.logPrefix, opaque, reqTs.Repr(), collectionIds)
+		feed.collections[bucketn] = collectionIds // :SideEffect:
+		err = feeder.StartVbStreams(opaque, reqTs, collectionIds)
+		if err != nil {
 			fmsg := "%v ##%x StartVbStreams(%q): %v"
 			logging.Errorf(fmsg, feed.logPrefix, opaque, bucketn, err)
 			return projC.ErrorFeeder
@@ -2058,6 +2113,7 @@ func FeedConfigParams() []string {
 		"dataport.bufferSize",
 		"dataport.bufferTimeout",
 		"dataport.harakiriTimeout",
-		"dataport.maxPayload"}
+		"dataport.maxPayload",
+		"dataport.compression"}
 	return paramNames
 }
@@ -613,6 +613,12 @@ func (kvdata *KVData) scatterMutation(
 		case mcd.DCP_EXPIRATION:
 			kvdata.stats.exprCount.Add(1)
 		}
+
+	case mcd.DCP_SYSTEM_EVENT, mcd.DCP_SEQNO_ADVANCED:
+		seqno = m.Seqno
+		if err := worker.Event(m); err != nil {
+			panic(err)
+		}
 	}
 	return
 }
@@ -0,0 +1,166 @@
+package projector
+
+import (
+	"net/http"
+
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/security"
+	"github.com/couchbase/indexing/secondary/stats"
+
+	memcached "github.com/couchbase/indexing/secondary/dcp/transport/client"
+)
+
+// handleMetrics exports the projector stats in the Prometheus text
+// format. Stats of the dcp feeds, kvdata and workers of a bucket in a
+// topic are summed and labelled by topic and bucket.
+func (p *Projector) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	valid := validateAuth(w, r)
+	if !valid {
+		return
+	}
+
+	m := stats.NewPromMetrics()
+	if ps := p.statsMgr.stats.Get(); ps != nil {
+		ps.addMetrics(m)
+	}
+	m.Counter("projector_tls_handshake_failures_total", "Failed TLS handshakes connecting to indexer",
+		nil, float64(security.GetHandshakeStats().ClientFailures))
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := m.WriteTo(w); err != nil {
+		logging.Errorf("%v handleMetrics() %v\n", p.logPrefix, err)
+	}
+}
+
+func (ps *ProjectorStats) addMetrics(m *stats.PromMetrics) {
+
+	for _, feedStats := range ps.feedStats {
+		for _, bucketStats := range feedStats.bucketStats {
+			labels := stats.PromLabels{
+				"topic":  bucketStats.topic,
+				"bucket": bucketStats.bucket,
+			}
+
+			bucketStats.addDcpMetrics(m, labels)
+			bucketStats.addKvdataMetrics(m, labels)
+			bucketStats.addWorkerMetrics(m, labels)
+		}
+	}
+}
+
+func (bs *BucketStats) addDcpMetrics(m *stats.PromMetrics, labels stats.PromLabels) {
+
+	var bytes, mutations, snapshots, streamReqs, streamEnds uint64
+	var bufferAcks, systemEvents, rcvchLen uint64
+	var latency stats.Histogram
+	latency.Init(stats.LatencyBuckets, nil)
+
+	for _, value := range bs.dcpStats {
+		val, ok := value.(*memcached.DcpStats)
+		if !ok || val.IsClosed() {
+			continue
+		}
+		bytes += val.TotalBytes.Value()
+		mutations += val.TotalMutation.Value()
+		snapshots += val.TotalSnapShot.Value()
+		streamReqs += val.TotalStreamReq.Value()
+		streamEnds += val.TotalStreamEnd.Value()
+		bufferAcks += val.TotalBufferAckSent.Value()
+		systemEvents += val.TotalSystemEvent.Value()
+		rcvchLen += val.RcvchLen.Value()
+		latency.Merge(&val.DcplatencyDist)
+	}
+
+	m.Counter("projector_dcp_bytes_total", "Bytes received from dcp",
+		labels, float64(bytes))
+	m.Counter("projector_dcp_mutations_total", "Mutations received from dcp",
+		labels, float64(mutations))
+	m.Counter("projector_dcp_snapshots_total", "Snapshot markers received from dcp",
+		labels, float64(snapshots))
+	m.Counter("projector_dcp_stream_requests_total", "Dcp stream requests",
+		labels, float64(streamReqs))
+	m.Counter("projector_dcp_stream_ends_total", "Dcp stream ends",
+		labels, float64(streamEnds))
+	m.Counter("projector_dcp_buffer_acks_total", "Dcp buffer acks sent",
+		labels, float64(bufferAcks))
+	m.Counter("projector_dcp_system_events_total", "System events received from dcp",
+		labels, float64(systemEvents))
+	m.Gauge("projector_dcp_rcvch_length", "Messages in the dcp receive channel",
+		labels, float64(rcvchLen))
+	m.Histogram("projector_dcp_latency_seconds", "Time between dcp messages of a stream within a snapshot",
+		labels, &latency, 1e-9)
+}
+
+func (bs *BucketStats) addKvdataMetrics(m *stats.PromMetrics, labels stats.PromLabels) {
+
+	var events, upserts, deletes, exprs, ainsts, dinsts, tss, mutchLen uint64
+	var docsProcessed uint64
+
+	for _, value := range bs.kvstats {
+		val, ok := value.(*KvdataStats)
+		if !ok || val.IsClosed() {
+			continue
+		}
+		events += val.eventCount.Value()
+		upserts += val.upsertCount.Value()
+		deletes += val.deleteCount.Value()
+		exprs += val.exprCount.Value()
+		ainsts += val.ainstCount.Value()
+		dinsts += val.dinstCount.Value()
+		tss += val.tsCount.Value()
+		mutchLen += val.mutchLen.Value()
+		for i := range val.vbseqnos {
+			docsProcessed += val.vbseqnos[i].Value()
+		}
+	}
+
+	m.Counter("projector_kvdata_events_total", "Events processed by kvdata",
+		labels, float64(events))
+	m.Counter("projector_kvdata_upserts_total", "Upserts processed by kvdata",
+		labels, float64(upserts))
+	m.Counter("projector_kvdata_deletes_total", "Deletes processed by kvdata",
+		labels, float64(deletes))
+	m.Counter("projector_kvdata_expirations_total", "Expirations processed by kvdata",
+		labels, float64(exprs))
+	m.Counter("projector_kvdata_add_instances_total", "Add instance requests",
+		labels, float64(ainsts))
+	m.Counter("projector_kvdata_del_instances_total", "Delete instance requests",
+		labels, float64(dinsts))
+	m.Counter("projector_kvdata_ts_requests_total", "Timestamp requests",
+		labels, float64(tss))
+	m.Gauge("projector_kvdata_mutch_length", "Messages in the kvdata mutation channel",
+		labels, float64(mutchLen))
+	m.Gauge("projector_kvdata_docs_processed", "Sum of the seqnos processed of all vbuckets",
+		labels, float64(docsProcessed))
+}
+
+func (bs *BucketStats) addWorkerMetrics(m *stats.PromMetrics, labels stats.PromLabels) {
+
+	var datachLen, outgoingMut, compressedBytes, inflatedBytes, inflateErrors uint64
+
+	for _, wrkrStats := range bs.wrkrStats {
+		for _, value := range wrkrStats {
+			val, ok := value.(*WorkerStats)
+			if !ok {
+				continue
+			}
+			datachLen += val.datachLen.Value()
+			outgoingMut += val.outgoingMut.Value()
+			compressedBytes += val.compressedBytes.Value()
+			inflatedBytes += val.inflatedBytes.Value()
+			inflateErrors += val.inflateErrors.Value()
+		}
+	}
+
+	m.Gauge("projector_worker_datach_length", "Messages in the worker data channels",
+		labels, float64(datachLen))
+	m.Counter("projector_worker_mutations_total", "Mutations sent by the workers",
+		labels, float64(outgoingMut))
+	m.Counter("projector_worker_compressed_bytes_total", "Snappy compressed bytes received",
+		labels, float64(compressedBytes))
+	m.Counter("projector_worker_inflated_bytes_total", "Bytes after inflating snappy values",
+		labels, float64(inflatedBytes))
+	m.Counter("projector_worker_inflate_errors_total", "Errors inflating snappy values",
+		labels, float64(inflateErrors))
+}
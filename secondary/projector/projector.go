@@ -99,7 +99,7 @@ func NewProjector(maxvbs int, config c.Config, certFile string, keyFile string)
 	p.logPrefix = fmt.Sprintf("PROJ[%s]", p.adminport)
 
 	encryptLocalHost := config["security.encryption.encryptLocalhost"].Bool()
-	if err := p.initSecurityContext(encryptLocalHost); err != nil {
+	if err := p.initSecurityContext(encryptLocalHost, c.GetClientAuthConfig(config)); err != nil {
 		c.CrashOnError(fmt.Errorf("Fail to initialize security context: %v", err))
 	}
 
@@ -170,6 +170,9 @@ func (p *Projector) ResetConfig(config c.Config) {
 	if cv, ok := config["projector.settings.log_level"]; ok {
 		logging.SetLogLevel(logging.Level(cv.String()))
 	}
+	if cv, ok := config["projector.settings.log_format"]; ok {
+		logging.SetLogFormat(logging.Format(cv.String()))
+	}
 	if cv, ok := config["projector.maxCpuPercent"]; ok {
 		logging.Infof("Projector CPU set at %v", cv.Int())
 		c.SetNumCPUs(cv.Int())
@@ -918,13 +921,20 @@ func requestRead(r io.Reader, data []byte) (err error) {
 	return err
 }
 
-func (p *Projector) initSecurityContext(encryptLocalHost bool) error {
+func (p *Projector) initSecurityContext(encryptLocalHost bool,
+	clientAuth security.ClientAuthConfig) error {
 
 	logger := func(err error) { c.Console(p.clusterAddr, err.Error()) }
 	if err := security.InitSecurityContext(logger, p.clusterAddr, p.certFile, p.keyFile, encryptLocalHost); err != nil {
 		return err
 	}
 
+	// projector does not listen on queryport or dataport, this sets up
+	// the CA bundle to verify indexer nodes and certificate hot-reload.
+	if err := security.SetClientAuthConfig(clientAuth); err != nil {
+		return err
+	}
+
 	fn := func(refreshCert bool, refreshEncrypt bool) error {
 		select {
 		case <-p.enableSecurityChange:
@@ -399,11 +399,17 @@ func (sm *statsManager) logger() {
 
 func Accmulate(wrkr []interface{}) string {
 	var dataChLen, outgoingMut uint64
+	var compressedBytes, inflatedBytes, inflateErrors uint64
 	for _, stats := range wrkr {
 		wrkrStat := stats.(*WorkerStats)
 		dataChLen += wrkrStat.datachLen.Value()
 		outgoingMut += wrkrStat.outgoingMut.Value()
+		compressedBytes += wrkrStat.compressedBytes.Value()
+		inflatedBytes += wrkrStat.inflatedBytes.Value()
+		inflateErrors += wrkrStat.inflateErrors.Value()
 	}
 	return fmt.Sprintf(
-		"{\"datachLen\":%v,\"outgoingMut\":%v}", dataChLen, outgoingMut)
+		"{\"datachLen\":%v,\"outgoingMut\":%v,\"compressedBytes\":%v,"+
+			"\"inflatedBytes\":%v,\"inflateErrors\":%v}", dataChLen, outgoingMut,
+		compressedBytes, inflatedBytes, inflateErrors)
 }
@@ -132,6 +132,63 @@ func (v *Vbucket) makeSnapshotData(
 	return nil
 }
 
+func (v *Vbucket) makeSystemEventData(
+	m *mc.DcpEvent, engines map[uint64]*Engine) (data interface{}) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			fmsg := "%v ##%x system-event crashed: %v\n"
+			logging.Fatalf(fmsg, v.logPrefix, v.opaque, r)
+			logging.Errorf("%s", logging.StackTrace())
+
+		} else if data == nil {
+			fmsg := "%v ##%x SystemEvent NOT PUBLISHED\n"
+			logging.Errorf(fmsg, v.logPrefix, m.Opaque)
+
+		} else {
+			fmsg := "%v ##%x received system event %v (collection %x) seqno %v\n"
+			logging.Infof(fmsg, v.logPrefix, m.Opaque, m.EventType,
+				m.CollectionID, m.Seqno)
+		}
+	}()
+
+	if len(engines) == 0 {
+		return nil
+	}
+	// using the first engine that is capable of it.
+	for _, engine := range engines {
+		data := engine.SystemEventData(m, v.vbno, v.vbuuid, v.seqno, v.opaque2)
+		if data != nil {
+			return data
+		}
+	}
+	return nil
+}
+
+func (v *Vbucket) makeUpdateSeqnoData(
+	engines map[uint64]*Engine) (data interface{}) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			fmsg := "%v ##%x update-seqno crashed: %v\n"
+			logging.Fatalf(fmsg, v.logPrefix, v.opaque, r)
+			logging.Errorf("%s", logging.StackTrace())
+		}
+	}()
+
+	if len(engines) == 0 {
+		return nil
+	}
+	// using the first engine that is capable of it.
+	for _, engine := range engines {
+		data := engine.UpdateSeqnoData(v.vbno, v.vbuuid, v.seqno, v.opaque2)
+		if data != nil {
+			return data
+		}
+	}
+	return nil
+}
+
 func (v *Vbucket) makeStreamEndData(
 	engines map[uint64]*Engine) (data interface{}) {
 
@@ -63,11 +63,20 @@ type WorkerStats struct {
 
 	// Number of mutations consumed from this worker
 	outgoingMut stats.Uint64Val
+
+	// Size of snappy compressed values received from dcp and the size
+	// of the same values after inflating them.
+	compressedBytes stats.Uint64Val
+	inflatedBytes   stats.Uint64Val
+	inflateErrors   stats.Uint64Val
 }
 
 func (stats *WorkerStats) Init() {
 	stats.datachLen.Init()
 	stats.outgoingMut.Init()
+	stats.compressedBytes.Init()
+	stats.inflatedBytes.Init()
+	stats.inflateErrors.Init()
 }
 
 // NewVbucketWorker creates a new routine to handle this vbucket stream.
@@ -444,11 +453,24 @@ func (worker *VbucketWorker) handleEvent(m *mc.DcpEvent) *Vbucket {
 			return v
 		}
 		v.mutationCount++
-		v.seqno = m.Seqno // sequence number gets updated only here
+		v.seqno = m.Seqno // sequence number also moves with system events
 		// prepare a data for each endpoint.
 		dataForEndpoints := make(map[string]interface{})
 		// for each engine distribute transformations to endpoints.
 
+		if m.IsSnappy() {
+			compressed := len(m.Value)
+			n, err := m.Inflate()
+			if err != nil {
+				fmsg := "%v ##%x error inflating value for key %v: %v\n"
+				arg1 := logging.TagStrUD(m.Key)
+				logging.Errorf(fmsg, logPrefix, m.Opaque, arg1, err)
+				worker.stats.inflateErrors.Add(1)
+			}
+			worker.stats.compressedBytes.Add(uint64(compressed))
+			worker.stats.inflatedBytes.Add(uint64(n))
+		}
+
 		var nvalue qvalue.Value
 		if m.IsJSON() {
 			nvalue = qvalue.NewParsedValueWithOptions(m.Value, true, true)
@@ -494,6 +516,28 @@ func (worker *VbucketWorker) handleEvent(m *mc.DcpEvent) *Vbucket {
 			}
 		}
 
+	case mcd.DCP_SYSTEM_EVENT: // broadcast SystemEvent
+		if !vbok {
+			fmsg := "%v ##%x vbucket %v not started\n"
+			logging.Errorf(fmsg, logPrefix, m.Opaque, m.VBucket)
+			return v
+		}
+		v.seqno = m.Seqno
+		if data := v.makeSystemEventData(m, worker.engines); data != nil {
+			worker.broadcast2Endpoints(data)
+		}
+
+	case mcd.DCP_SEQNO_ADVANCED: // broadcast UpdateSeqno
+		if !vbok {
+			fmsg := "%v ##%x vbucket %v not started\n"
+			logging.Errorf(fmsg, logPrefix, m.Opaque, m.VBucket)
+			return v
+		}
+		v.seqno = m.Seqno
+		if data := v.makeUpdateSeqnoData(worker.engines); data != nil {
+			worker.broadcast2Endpoints(data)
+		}
+
 	case mcd.DCP_STREAMEND:
 		if vbok {
 			if data := v.makeStreamEndData(worker.engines); data != nil {
@@ -25,3 +25,20 @@ func (kv *KeyVersions) Snapshot() (typ uint32, start, end uint64) {
 	}
 	return
 }
+
+func (kv *KeyVersions) SystemEvent() (typ uint32, manifestUID uint64,
+	scopeID, collectionID uint32) {
+
+	uuids := kv.GetUuids()
+	keys := kv.GetKeys()
+	oldkeys := kv.GetOldkeys()
+	for i, cmd := range kv.GetCommands() {
+		if byte(cmd) == c.SystemEvent {
+			typ = uint32(uuids[i])
+			collectionID = binary.BigEndian.Uint32(keys[i][:4])
+			scopeID = binary.BigEndian.Uint32(keys[i][4:8])
+			manifestUID = binary.BigEndian.Uint64(oldkeys[i])
+		}
+	}
+	return
+}
@@ -2,10 +2,12 @@ package protoProjector
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/couchbase/indexing/secondary/stats"
 
+	"github.com/couchbase/indexing/secondary/collatejson"
 	c "github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/common/json"
 	qu "github.com/couchbase/indexing/secondary/common/queryutil"
@@ -93,7 +95,7 @@ func (instance *IndexInst) GetPartitionObject() Partition {
 	case PartitionScheme_HASH:
 		// return instance.GetHashPartn()
 	case PartitionScheme_RANGE:
-		// return instance.GetRangePartn()
+		return instance.GetRangePartn()
 	}
 	return nil
 }
@@ -104,10 +106,13 @@ type IndexEvaluator struct {
 	skExprs  []interface{} // compiled expression
 	pkExprs  []interface{} // compiled expression
 	whExpr   interface{}   // compiled expression
+	skColls  []collatejson.Collator
 	instance *IndexInst
 	version  FeedVersion
 	xattrs   []string
 	stats    *IndexEvaluatorStats
+	// collection on which the index is defined
+	collectionID uint32
 }
 
 // NewIndexEvaluator returns a reference to a new instance
@@ -132,6 +137,19 @@ func NewIndexEvaluator(instance *IndexInst,
 		if err != nil {
 			return nil, err
 		}
+		// collation of strings in secondary-key
+		for i, collation := range defn.GetCollations() {
+			collator, err := collatejson.NewCollator(collation)
+			if err != nil {
+				logging.Errorf("invalid collation %v\n", collation)
+				return nil, fmt.Errorf("invalid collation %v", collation)
+			} else if collator != nil && ie.skColls == nil {
+				ie.skColls = make([]collatejson.Collator, len(defn.GetCollations()))
+			}
+			if collator != nil {
+				ie.skColls[i] = collator
+			}
+		}
 		// expression to evaluate partition key
 		exprs = defn.GetPartnExpressions()
 		xattrExprs = append(xattrExprs, exprs...)
@@ -162,6 +180,15 @@ func NewIndexEvaluator(instance *IndexInst,
 		return nil, fmt.Errorf("invalid expression type %v", exprtype)
 	}
 
+	if cid := defn.GetCollectionID(); cid != "" {
+		collectionID, err := strconv.ParseUint(cid, 16, 32)
+		if err != nil {
+			logging.Errorf("invalid collection id %v\n", cid)
+			return nil, fmt.Errorf("invalid collection id %v", cid)
+		}
+		ie.collectionID = uint32(collectionID)
+	}
+
 	ie.stats = &IndexEvaluatorStats{}
 	ie.stats.Init()
 	return ie, nil
@@ -204,6 +231,28 @@ func (ie *IndexEvaluator) SnapshotData(
 	return &c.DataportKeyVersions{bucket, vbno, vbuuid, kv, opaque2}
 }
 
+// SystemEventData implement Evaluator{} interface.
+func (ie *IndexEvaluator) SystemEventData(
+	m *mc.DcpEvent, vbno uint16, vbuuid, seqno uint64,
+	opaque2 uint64) (data interface{}) {
+
+	bucket := ie.Bucket()
+	kv := c.NewKeyVersions(seqno, nil, 1, m.Ctime)
+	kv.AddSystemEvent(uint32(m.EventType), m.ManifestUID, m.ScopeID,
+		m.CollectionID)
+	return &c.DataportKeyVersions{bucket, vbno, vbuuid, kv, opaque2}
+}
+
+// UpdateSeqnoData implement Evaluator{} interface.
+func (ie *IndexEvaluator) UpdateSeqnoData(
+	vbno uint16, vbuuid, seqno uint64, opaque2 uint64) (data interface{}) {
+
+	bucket := ie.Bucket()
+	kv := c.NewKeyVersions(seqno, nil, 1, 0 /*ctime*/)
+	kv.AddUpdateSeqno()
+	return &c.DataportKeyVersions{bucket, vbno, vbuuid, kv, opaque2}
+}
+
 // StreamEndData implement Evaluator{} interface.
 func (ie *IndexEvaluator) StreamEndData(
 	vbno uint16, vbuuid, seqno uint64, opaque2 uint64) (data interface{}) {
@@ -290,6 +339,12 @@ func (ie *IndexEvaluator) TransformRoute(
 	var where bool
 	var opcode mcd.CommandCode
 
+	// mutations on other collections only move the seqno forward.
+	if m.CollectionID != ie.collectionID {
+		ie.populateUpdateSeqno(vbuuid, m, data, numIndexes, opaque2)
+		return encodeBuf, nil
+	}
+
 	forceUpsertDeletion := false
 	npkey, opkey, nkey, okey, newBuf, where, opcode, err = ie.processEvent(m,
 		encodeBuf, docval, context, meta)
@@ -314,6 +369,22 @@ func (ie *IndexEvaluator) TransformRoute(
 	return newBuf, err
 }
 
+// populateUpdateSeqno for endpoints of this index that did not receive any
+// data for the mutation, so that downstream can track the seqno.
+func (ie *IndexEvaluator) populateUpdateSeqno(vbuuid uint64, m *mc.DcpEvent,
+	data map[string]interface{}, numIndexes int, opaque2 uint64) {
+
+	bucket := ie.Bucket()
+	for _, raddr := range ie.instance.Endpoints() {
+		if _, ok := data[raddr]; ok {
+			continue
+		}
+		kv := c.NewKeyVersions(m.Seqno, m.Key, numIndexes, m.Ctime)
+		kv.AddUpdateSeqno()
+		data[raddr] = &c.DataportKeyVersions{bucket, m.VBucket, vbuuid, kv, opaque2}
+	}
+}
+
 func (ie *IndexEvaluator) populateData(vbuuid uint64, m *mc.DcpEvent,
 	data map[string]interface{}, numIndexes int, npkey, opkey []byte,
 	nkey, okey []byte, where bool, opcode mcd.CommandCode, opaque2 uint64,
@@ -430,7 +501,7 @@ func (ie *IndexEvaluator) evaluate(
 	exprType := defn.GetExprType()
 	switch exprType {
 	case ExprType_N1QL:
-		return N1QLTransform(docid, docval, context, ie.skExprs, encodeBuf, ie.stats)
+		return N1QLTransform(docid, docval, context, ie.skExprs, ie.skColls, encodeBuf, ie.stats)
 	}
 	return nil, nil, nil
 }
@@ -447,7 +518,7 @@ func (ie *IndexEvaluator) partitionKey(
 	exprType := defn.GetExprType()
 	switch exprType {
 	case ExprType_N1QL:
-		out, _, err := N1QLTransform(docid, docval, context, ie.pkExprs, nil, ie.stats)
+		out, _, err := N1QLTransform(docid, docval, context, ie.pkExprs, nil, nil, ie.stats)
 		return out, err
 	}
 	return nil, nil
@@ -467,7 +538,7 @@ func (ie *IndexEvaluator) wherePredicate(
 	switch exprType {
 	case ExprType_N1QL:
 		// TODO: can be optimized by using a custom N1QL-evaluator.
-		out, _, err := N1QLTransform(nil, docval, context, []interface{}{ie.whExpr}, encodeBuf, ie.stats)
+		out, _, err := N1QLTransform(nil, docval, context, []interface{}{ie.whExpr}, nil, encodeBuf, ie.stats)
 		if out == nil { // missing is treated as false
 			return false, err
 		} else if err != nil { // errors are treated as false
@@ -520,6 +591,11 @@ func (ie *IndexEvaluator) GetIndexName() string {
 	return ie.instance.GetDefinition().GetName()
 }
 
+// CollectionID implements Evaluator{} interface.
+func (ie *IndexEvaluator) CollectionID() string {
+	return strconv.FormatUint(uint64(ie.collectionID), 16)
+}
+
 type IndexEvaluatorStats struct {
 	Count     stats.Int64Val
 	TotalDur  stats.Int64Val
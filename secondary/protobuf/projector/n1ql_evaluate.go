@@ -27,10 +27,11 @@ var missing = qvalue.NewValue(string(collatejson.MissingLiteral))
 
 // N1QLTransform will use compiled list of expression from N1QL's DDL
 // statement and evaluate a document using them to return a secondary
-// key as JSON object.
+// key as JSON object. Strings in secondary key are collated as per
+// `collators`, nil for binary collation of all the keys.
 func N1QLTransform(
 	docid []byte, docval qvalue.AnnotatedValue, context qexpr.Context,
-	cExprs []interface{},
+	cExprs []interface{}, collators []collatejson.Collator,
 	encodeBuf []byte, stats *IndexEvaluatorStats) ([]byte, []byte, error) {
 
 	arrValue := make([]interface{}, 0, len(cExprs))
@@ -119,7 +120,7 @@ func N1QLTransform(
 		//    arrValue = append(arrValue, qvalue.NewValue(string(docid)))
 		//}
 		if encodeBuf != nil {
-			out, newBuf, err := CollateJSONEncode(qvalue.NewValue(arrValue), encodeBuf)
+			out, newBuf, err := CollateJSONEncode(qvalue.NewValue(arrValue), collators, encodeBuf)
 			if err != nil {
 				fmsg := "CollateJSONEncode: index field for docid: %s (err: %v) skip document"
 				arg1 := logging.TagUD(docid)
@@ -138,8 +139,13 @@ func N1QLTransform(
 	return nil, nil, nil
 }
 
-func CollateJSONEncode(val qvalue.Value, encodeBuf []byte) ([]byte, []byte, error) {
+// CollateJSONEncode encodes secondary key `val`, strings of i-th key
+// are collated as per `collators[i]`.
+func CollateJSONEncode(val qvalue.Value, collators []collatejson.Collator,
+	encodeBuf []byte) ([]byte, []byte, error) {
+
 	codec := collatejson.NewCodec(16)
+	codec.CollateKeys(collators)
 	encoded, err := codec.EncodeN1QLValue(val, encodeBuf[:0])
 
 	if err != nil && err.Error() == collatejson.ErrorOutputLen.Error() {
@@ -147,7 +153,12 @@ func CollateJSONEncode(val qvalue.Value, encodeBuf []byte) ([]byte, []byte, erro
 		if e1 != nil {
 			return append([]byte(nil), encoded...), nil, err
 		}
-		newBuf := make([]byte, 0, len(valBytes)*3)
+		size := len(valBytes) * 3
+		if len(collators) > 0 {
+			// collation key is encoded along with the string.
+			size *= 3
+		}
+		newBuf := make([]byte, 0, size)
 		enc, e2 := codec.EncodeN1QLValue(val, newBuf)
 		return append([]byte(nil), enc...), newBuf, e2
 	}
@@ -81,7 +81,7 @@ func TestN1QLTransform150(t *testing.T) {
 	docval := qvalue.NewAnnotatedValue(qvalue.NewParsedValue(doc150, true))
 	docval.SetAttachment("meta", make(map[string]interface{} /*meta*/))
 	context := qexpr.NewIndexContext()
-	secKey, _, err := N1QLTransform([]byte("docid"), docval, context, cExprs, buf, &stats)
+	secKey, _, err := N1QLTransform([]byte("docid"), docval, context, cExprs, nil, buf, &stats)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -99,7 +99,7 @@ func TestN1QLTransform2000(t *testing.T) {
 	docval := qvalue.NewAnnotatedValue(qvalue.NewParsedValue(doc2000, true))
 	docval.SetAttachment("meta", make(map[string]interface{} /*meta*/))
 	context := qexpr.NewIndexContext()
-	secKey, _, err := N1QLTransform([]byte("docid"), docval, context, cExprs, buf, &stats)
+	secKey, _, err := N1QLTransform([]byte("docid"), docval, context, cExprs, nil, buf, &stats)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -139,7 +139,7 @@ func BenchmarkN1QLTransform150(b *testing.B) {
 	docval.SetAttachment("meta", make(map[string]interface{} /*meta*/))
 	context := qexpr.NewIndexContext()
 	for i := 0; i < b.N; i++ {
-		N1QLTransform([]byte("docid"), docval, context, cExprs, buf, &stats)
+		N1QLTransform([]byte("docid"), docval, context, cExprs, nil, buf, &stats)
 	}
 }
 
@@ -149,7 +149,7 @@ func BenchmarkN1QLTransform2000(b *testing.B) {
 	docval.SetAttachment("meta", make(map[string]interface{} /*meta*/))
 	context := qexpr.NewIndexContext()
 	for i := 0; i < b.N; i++ {
-		N1QLTransform([]byte("docid"), docval, context, cExprs, buf, &stats)
+		N1QLTransform([]byte("docid"), docval, context, cExprs, nil, buf, &stats)
 	}
 }
 
@@ -0,0 +1,89 @@
+package protoProjector
+
+import mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
+import "github.com/couchbase/indexing/secondary/common"
+import "github.com/couchbase/indexing/secondary/logging"
+import "github.com/golang/protobuf/proto"
+
+// NewRangePartition return a new partition instance,
+// initialized with a list of endpoint hosts and collatejson
+// encoded range boundaries.
+func NewRangePartition(numPartition uint64, endpoints []string, partitions []uint64, boundaries [][]byte) *RangePartition {
+	return &RangePartition{
+		Partitions:   partitions,
+		NumPartition: proto.Uint64(numPartition),
+		Endpoints:    endpoints,
+		Boundaries:   boundaries,
+	}
+}
+
+func (p *RangePartition) AddPartitions(partitions []uint64) {
+	p.Partitions = append(p.Partitions, partitions...)
+}
+
+// Hosts implements Partition{} interface.
+func (p *RangePartition) Hosts(inst *IndexInst) []string {
+	return p.getAllEndpoints()
+}
+
+// UpsertEndpoints implements Partition{} interface.
+// - sent only if where clause is true.
+// - UpsertDeletion is implied for every UpsertEndpoint.
+// - if `key` is empty downstream shall consider Upsert as NOOP
+//   and only apply UpsertDeletion.
+// - for now, `oldKey` is ignored.
+func (p *RangePartition) UpsertEndpoints(
+	inst *IndexInst, m *mc.DcpEvent, partKey, key, oldKey []byte) []string {
+
+	return p.getPartitionEndpoint(partKey)
+}
+
+// UpsertDeletionEndpoints implements Partition{} interface.
+// - sent only if where clause is false.
+// - downstream can use immutable flag to opimtimize back-index lookup.
+// - `key` is always nil
+// - `partnKey` is ignored.
+// - for now, `oldKey` is ignored.
+func (p *RangePartition) UpsertDeletionEndpoints(
+	inst *IndexInst, m *mc.DcpEvent, partKey, key, oldKey []byte) []string {
+
+	// Note: Based on available information, partKey, key, oldKey can be nil.
+	return p.getAllEndpoints()
+}
+
+// DeletionEndpoints implements Partition{} interface.
+// - not sent to coordinator-endpoint
+// - `oldPartKey` is ignored.
+// - for now, `oldKey` is ignored.
+func (p *RangePartition) DeletionEndpoints(
+	inst *IndexInst, m *mc.DcpEvent, oldPartKey, oldKey []byte) []string {
+
+	return p.getAllEndpoints()
+}
+
+//
+// Get endpoint of a specific partition
+//
+func (p *RangePartition) getPartitionEndpoint(partKey []byte) []string {
+
+	partitionId := uint64(1)
+	if code, err := common.CollateRangeKey(partKey); err != nil {
+		// route the same way as indexer's flusher does.
+		logging.Errorf("RangePartition: invalid partition key %v: %v", logging.TagUD(string(partKey)), err)
+	} else {
+		partitionId = uint64(common.RangeKeyPartition(code, p.GetBoundaries()))
+	}
+	for _, partnId := range p.Partitions {
+		if partnId == partitionId {
+			return p.GetEndpoints()
+		}
+	}
+	return nil
+}
+
+//
+// Get all endpoints
+//
+func (p *RangePartition) getAllEndpoints() []string {
+	return p.GetEndpoints()
+}
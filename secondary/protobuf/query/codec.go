@@ -39,6 +39,18 @@ func ProtobufEncodeInBuf(payload interface{}, buf []byte) (data []byte, err erro
 	case *EndStreamRequest:
 		pl.EndStream = val
 
+	case *OpenSnapshotRequest:
+		pl.OpenSnapshotRequest = val
+
+	case *CloseSnapshotRequest:
+		pl.CloseSnapshotRequest = val
+
+	case *DocIdLookupRequest:
+		pl.DocIdLookupRequest = val
+
+	case *LeadKeyHistogramRequest:
+		pl.LeadKeyHistogramRequest = val
+
 	// response
 	case *StatisticsResponse:
 		pl.Statistics = val
@@ -58,6 +70,12 @@ func ProtobufEncodeInBuf(payload interface{}, buf []byte) (data []byte, err erro
 	case *HeloResponse:
 		pl.HeloResponse = val
 
+	case *OpenSnapshotResponse:
+		pl.OpenSnapshotResponse = val
+
+	case *CloseSnapshotResponse:
+		pl.CloseSnapshotResponse = val
+
 	default:
 		return nil, ErrorMissingPayload
 	}
@@ -110,6 +128,18 @@ func ProtobufDecode(data []byte) (value interface{}, err error) {
 		return val, nil
 	} else if val := pl.GetHeloResponse(); val != nil {
 		return val, nil
+	} else if val := pl.GetOpenSnapshotRequest(); val != nil {
+		return val, nil
+	} else if val := pl.GetOpenSnapshotResponse(); val != nil {
+		return val, nil
+	} else if val := pl.GetCloseSnapshotRequest(); val != nil {
+		return val, nil
+	} else if val := pl.GetCloseSnapshotResponse(); val != nil {
+		return val, nil
+	} else if val := pl.GetDocIdLookupRequest(); val != nil {
+		return val, nil
+	} else if val := pl.GetLeadKeyHistogramRequest(); val != nil {
+		return val, nil
 	}
 	return nil, ErrorMissingPayload
 }
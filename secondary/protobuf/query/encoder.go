@@ -18,6 +18,13 @@ func EncodeAndWrite(conn net.Conn, buf []byte, r interface{}) (err error) {
 		return
 	}
 	flags := transport.TransportFlag(0).SetProtobuf()
+	// compress response as negotiated with the client, if any.
+	if tconn, ok := conn.(*transport.Conn); ok {
+		flags = flags.SetCompression(tconn.Compression())
+		if data, err = tconn.Compress(data); err != nil {
+			return
+		}
+	}
 	err = transport.Send(conn, buf, flags, data, false)
 	return
 }
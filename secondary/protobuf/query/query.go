@@ -96,7 +96,24 @@ func (s *IndexStatistics) DistinctCount() (int64, error) {
 
 // Bins implements common.IndexStatistics{} method.
 func (s *IndexStatistics) Bins() ([]c.IndexStatistics, error) {
-	return nil, nil
+	bins := s.GetBins()
+	if len(bins) == 0 {
+		return nil, nil
+	}
+	stats := make([]c.IndexStatistics, 0, len(bins))
+	for _, bin := range bins {
+		stats = append(stats, bin)
+	}
+	return stats, nil
+}
+
+// LeadKeyStatistics return statistics on the leading key of a composite
+// index, nil if not available.
+func (s *IndexStatistics) LeadKeyStatistics() c.IndexStatistics {
+	if leadKey := s.GetLeadKey(); leadKey != nil {
+		return leadKey
+	}
+	return nil
 }
 
 func NewTsConsistency(
@@ -0,0 +1,152 @@
+package protoQuery
+
+import "bytes"
+import "sort"
+
+import "github.com/couchbase/indexing/secondary/collatejson"
+import "github.com/golang/protobuf/proto"
+
+var statsCodec = collatejson.NewCodec(16)
+
+// MergeStatistics combine statistics computed on disjoint set of index
+// entries, like partitions of an index, into a single statistics with
+// upto `nbins` bins. Since the same key can be present in more than
+// one set, distinct count of the result is an upper bound.
+func MergeStatistics(nbins int, stats ...*IndexStatistics) (*IndexStatistics, error) {
+	var err error
+
+	sources := make([]*IndexStatistics, 0, len(stats))
+	for _, s := range stats {
+		if s != nil {
+			sources = append(sources, s)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, nil
+	} else if len(sources) == 1 {
+		return sources[0], nil
+	}
+
+	res := &IndexStatistics{}
+	var min, max []byte
+	var bins []*collatedBin
+	var leadKeys []*IndexStatistics
+	var count, unique uint64
+
+	for _, s := range sources {
+		count += s.GetKeysCount()
+		unique += s.GetUniqueKeysCount()
+		if s.GetKeysCount() > 0 {
+			if min, res.KeyMin, err = pickKey(min, res.KeyMin, s.GetKeyMin(), -1); err != nil {
+				return nil, err
+			}
+			if max, res.KeyMax, err = pickKey(max, res.KeyMax, s.GetKeyMax(), 1); err != nil {
+				return nil, err
+			}
+		}
+		for _, bin := range s.GetBins() {
+			cbin := &collatedBin{stats: bin}
+			if cbin.min, err = collateKey(bin.GetKeyMin()); err != nil {
+				return nil, err
+			}
+			if cbin.max, err = collateKey(bin.GetKeyMax()); err != nil {
+				return nil, err
+			}
+			bins = append(bins, cbin)
+		}
+		if s.GetLeadKey() != nil {
+			leadKeys = append(leadKeys, s.GetLeadKey())
+		}
+	}
+	if unique > count {
+		unique = count
+	}
+	res.KeysCount, res.UniqueKeysCount = proto.Uint64(count), proto.Uint64(unique)
+	if res.KeyMin == nil {
+		res.KeyMin, res.KeyMax = []byte("[]"), []byte("[]")
+	}
+
+	res.Bins = rebinStatistics(nbins, count, bins)
+	if res.LeadKey, err = MergeStatistics(nbins, leadKeys...); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+type collatedBin struct {
+	stats    *IndexStatistics
+	min, max []byte
+}
+
+// collatedBins sorts bins on their min-key.
+type collatedBins []*collatedBin
+
+func (b collatedBins) Len() int      { return len(b) }
+func (b collatedBins) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b collatedBins) Less(i, j int) bool {
+	return bytes.Compare(b[i].min, b[j].min) < 0
+}
+
+// rebinStatistics sort bins from different sources on their min-key and
+// combine adjacent bins until there are no more than `nbins` bins.
+func rebinStatistics(nbins int, count uint64, bins []*collatedBin) []*IndexStatistics {
+	if nbins <= 0 || len(bins) == 0 {
+		return nil
+	}
+	sort.Sort(collatedBins(bins))
+
+	depth := (count + uint64(nbins) - 1) / uint64(nbins)
+	res := make([]*IndexStatistics, 0, nbins)
+
+	var curr *IndexStatistics
+	var currMax []byte
+	var binCount, binUnique uint64
+	flush := func() {
+		if binUnique > binCount {
+			binUnique = binCount
+		}
+		curr.KeysCount, curr.UniqueKeysCount = proto.Uint64(binCount), proto.Uint64(binUnique)
+		res = append(res, curr)
+		curr, currMax, binCount, binUnique = nil, nil, 0, 0
+	}
+	for _, bin := range bins {
+		if curr == nil {
+			curr = &IndexStatistics{
+				KeyMin: bin.stats.GetKeyMin(), KeyMax: bin.stats.GetKeyMax(),
+			}
+			currMax = bin.max
+		} else if bytes.Compare(bin.max, currMax) > 0 {
+			curr.KeyMax, currMax = bin.stats.GetKeyMax(), bin.max
+		}
+		binCount += bin.stats.GetKeysCount()
+		binUnique += bin.stats.GetUniqueKeysCount()
+		if binCount >= depth {
+			flush()
+		}
+	}
+	if curr != nil {
+		flush()
+	}
+	return res
+}
+
+// pickKey return the lesser of the two keys if `cmp` is -1, the greater
+// if `cmp` is 1, along with its collated form.
+func pickKey(ckey, key, other []byte, cmp int) ([]byte, []byte, error) {
+	cother, err := collateKey(other)
+	if err != nil {
+		return nil, nil, err
+	}
+	if key == nil || bytes.Compare(cother, ckey) == cmp {
+		return cother, other, nil
+	}
+	return ckey, key, nil
+}
+
+func collateKey(key []byte) ([]byte, error) {
+	size := 3 * len(key)
+	if size < collatejson.MinBufferSize {
+		size = collatejson.MinBufferSize
+	}
+	return statsCodec.Encode(key, make([]byte, 0, size))
+}
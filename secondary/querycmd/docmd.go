@@ -28,12 +28,14 @@ import "github.com/couchbase/query/parser/n1ql"
 type Command struct {
 	OpType string
 	// basic options.
-	Server    string
-	IndexName string
-	Bucket    string
-	AdminPort string
-	QueryPort string
-	Auth      string
+	Server     string
+	IndexName  string
+	Bucket     string
+	Scope      string
+	Collection string
+	AdminPort  string
+	QueryPort  string
+	Auth       string
 	// options for create-index.
 	Using     string
 	ExprType  string
@@ -74,6 +76,8 @@ func ParseArgs(arguments []string) (*Command, []string, *flag.FlagSet, error) {
 	fset.StringVar(&cmdOptions.Server, "server", "127.0.0.1:8091", "Cluster server address")
 	fset.StringVar(&cmdOptions.Auth, "auth", "", "Auth user and password")
 	fset.StringVar(&cmdOptions.Bucket, "bucket", "", "Bucket name")
+	fset.StringVar(&cmdOptions.Scope, "scope", "", "Scope name, default scope if empty")
+	fset.StringVar(&cmdOptions.Collection, "collection", "", "Collection name, default collection if empty")
 	fset.StringVar(&cmdOptions.OpType, "type", "", "Command: scan|stats|scanAll|count|nodes|create|build|move|drop|list|config")
 	fset.StringVar(&cmdOptions.IndexName, "index", "", "Index name")
 	// options for create-index
@@ -239,10 +243,10 @@ func HandleCommand(
 		if len(cmd.SecStrs) == 0 && !cmd.IsPrimary || cmd.IndexName == "" {
 			return fmt.Errorf("createIndex(): required fields missing")
 		}
-		defnID, err = client.CreateIndex(
-			iname, bucket, cmd.Using, cmd.ExprType,
-			cmd.PartnStr, cmd.WhereStr, cmd.SecStrs, cmd.IsPrimary,
-			[]byte(cmd.With))
+		defnID, err = client.CreateIndex4(
+			iname, bucket, cmd.Scope, cmd.Collection, cmd.Using,
+			cmd.ExprType, cmd.WhereStr, cmd.SecStrs, nil, cmd.IsPrimary,
+			c.SINGLE, nil, []byte(cmd.With))
 		if err == nil {
 			fmt.Fprintf(w, "Index created: %v with %q\n", defnID, cmd.With)
 		}
@@ -12,6 +12,7 @@ import "errors"
 import "strings"
 import "sync"
 import "math"
+import "time"
 
 import "github.com/couchbase/indexing/secondary/logging"
 import "github.com/couchbase/indexing/secondary/common"
@@ -133,7 +134,7 @@ func (b *cbqClient) Nodes() ([]*IndexerService, error) {
 
 // CreateIndex implement BridgeAccessor{} interface.
 func (b *cbqClient) CreateIndex(
-	name, bucket, using, exprType, whereExpr string,
+	name, bucket, scope, collection, using, exprType, whereExpr string,
 	secExprs []string, desc []bool, isPrimary bool,
 	scheme common.PartitionScheme, partitionKeys []string,
 	with []byte) (defnID uint64, err error) {
@@ -194,6 +195,26 @@ func (b *cbqClient) AlterReplicaCount(action string, defnID uint64, plan map[str
 	panic("cbqClient does not implement alter replica count")
 }
 
+// AlterIndex implement BridgeAccessor{} interface.
+func (b *cbqClient) AlterIndex(defnID uint64, with map[string]interface{}) error {
+	panic("cbqClient does not implement alter index")
+}
+
+// PauseIndex implement BridgeAccessor{} interface.
+func (b *cbqClient) PauseIndex(defnID uint64, pause bool) error {
+	panic("cbqClient does not implement pause index")
+}
+
+// CreateAggregate implement BridgeAccessor{} interface.
+func (b *cbqClient) CreateAggregate(defnID uint64, aggr *common.AggregateDefn) error {
+	panic("cbqClient does not implement create aggregate")
+}
+
+// DropAggregate implement BridgeAccessor{} interface.
+func (b *cbqClient) DropAggregate(defnID uint64, name string) error {
+	panic("cbqClient does not implement drop aggregate")
+}
+
 // DropIndex implement BridgeAccessor{} interface.
 func (b *cbqClient) DropIndex(defnID uint64) error {
 	var resp *http.Response
@@ -253,6 +274,13 @@ func (b *cbqClient) GetIndexReplica(defnId uint64) []*mclient.InstanceDefn {
 	panic("cbqClient does not implement GetIndexReplica")
 }
 
+// GetHedgeScanport implement BridgeAccessor{} interface.
+func (b *cbqClient) GetHedgeScanport(instId uint64, partitions []common.PartitionId) (queryport string,
+	targetInstId uint64, rollbackTime int64, delay time.Duration, ok bool) {
+
+	return "", 0, 0, 0, false
+}
+
 // Timeit implement BridgeAccessor{} interface.
 func (b *cbqClient) Timeit(defnID uint64, partitionId common.PartitionId, value float64) {
 	// TODO: do nothing ?
@@ -25,7 +25,9 @@ import "github.com/couchbase/indexing/secondary/logging"
 import "github.com/couchbase/indexing/secondary/common"
 import "github.com/couchbase/indexing/secondary/security"
 import mclient "github.com/couchbase/indexing/secondary/manager/client"
+import protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
 import "github.com/couchbase/query/value"
+import "github.com/golang/protobuf/proto"
 
 // TODO:
 // - Timeit() uses the wall-clock time instead of process-time to compute
@@ -52,6 +54,19 @@ type ResponseReader interface {
 	Error() error
 }
 
+// ProfileReader is implemented by responses that can carry the execution
+// profile of a scan, requested by setting a ProfileHandler on the
+// RequestBroker.
+type ProfileReader interface {
+	// GetProfile returns the JSON encoded profile, nil if the response
+	// does not carry one.
+	GetProfile() []byte
+}
+
+// ProfileHandler receives the JSON encoded execution profile of a scan,
+// from the indexer hosting `partitions` of index instance `instId`.
+type ProfileHandler func(instId uint64, partitions []common.PartitionId, profile []byte)
+
 // ResponseSender is responsible for forwarding result to the client
 // after streams from multiple servers/ResponseHandler have been merged.
 // mskey - marshalled sec key (as Value)
@@ -113,6 +128,8 @@ type Aggregate struct {
 	KeyPos     int32               // >=0 means use expr at index key position otherwise use Expr
 	Expr       string              // Aggregate expression
 	Distinct   bool                // Aggregate only on Distinct values with in the group
+	Limit      int64               // Maximum number of values in ARRAY_AGG, 0 means no limit
+	Quantile   float64             // Quantile for APPROX_QUANTILE
 }
 
 type GroupAggr struct {
@@ -123,6 +140,7 @@ type GroupAggr struct {
 	IndexKeyNames      []string     // Index key names used in expressions
 	AllowPartialAggr   bool         // Partial aggregates are allowed
 	OnePerPrimaryKey   bool         // Leading Key is ALL & equality span consider one per docid
+	PartialAggrState   bool         // Return mergeable partial state of AVG and approximate aggregates
 }
 
 type IndexKeyOrder struct {
@@ -161,6 +179,9 @@ type BridgeAccessor interface {
 	//      index name
 	// bucket
 	//      bucket name in which index is defined.
+	// scope, collection
+	//      scope and collection on which index is defined, empty string
+	//      refers to the default scope and collection.
 	// using
 	//      token should always be GSI.
 	// exprType
@@ -179,7 +200,7 @@ type BridgeAccessor interface {
 	// with
 	//      JSON marshalled description about index deployment (and more...).
 	CreateIndex(
-		name, bucket, using, exprType, whereExpr string,
+		name, bucket, scope, collection, using, exprType, whereExpr string,
 		secExprs []string, desc []bool, isPrimary bool,
 		scheme common.PartitionScheme, partitionKeys []string,
 		with []byte) (defnID uint64, err error)
@@ -194,6 +215,19 @@ type BridgeAccessor interface {
 	// AlterReplicaCount to change replica count of index
 	AlterReplicaCount(action string, defnID uint64, with map[string]interface{}) error
 
+	// AlterIndex to rename index or change its metadata-only properties.
+	AlterIndex(defnID uint64, with map[string]interface{}) error
+
+	// PauseIndex to stop maintenance of index, or to resume it when
+	// pause is false.
+	PauseIndex(defnID uint64, pause bool) error
+
+	// CreateAggregate to materialize a group aggregate with index.
+	CreateAggregate(defnID uint64, aggr *common.AggregateDefn) error
+
+	// DropAggregate to drop aggregate `name` materialized with index.
+	DropAggregate(defnID uint64, name string) error
+
 	// DropIndex to drop index specified by `defnID`.
 	// - if index is in deferred build state, it shall be removed
 	//   from deferred list.
@@ -214,6 +248,13 @@ type BridgeAccessor interface {
 		skips map[common.IndexDefnId]bool) (queryport []string, targetDefnID uint64, targetInstID []uint64,
 		rollbackTime []int64, partition [][]common.PartitionId, numPartitions uint32, ok bool)
 
+	// GetHedgeScanport shall fetch queryport address of another replica
+	// hosting `partitions` of index instance `instId`, to hedge a slow
+	// scan with, and the delay after which to hedge. Returns false if
+	// hedging is disabled or there is no such replica.
+	GetHedgeScanport(instId uint64, partitions []common.PartitionId) (queryport string,
+		targetInstId uint64, rollbackTime int64, delay time.Duration, ok bool)
+
 	// GetIndexDefn will return the index-definition structure for defnID.
 	GetIndexDefn(defnID uint64) *common.IndexDefn
 
@@ -252,6 +293,9 @@ type GsiAccessor interface {
 		defnID uint64, requestId string, low, high common.SecondaryKey,
 		inclusion Inclusion) (common.IndexStatistics, error)
 
+	// LeadKeyHistogram of the leading key of the index.
+	LeadKeyHistogram(defnID uint64, requestId string) (common.IndexStatistics, error)
+
 	// Lookup scan index between low and high.
 	Lookup(
 		defnID uint64, requestId string, values []common.SecondaryKey,
@@ -292,6 +336,18 @@ type GsiAccessor interface {
 		cons common.Consistency, vector *TsConsistency,
 		broker *RequestBroker) error
 
+	// DocIdLookup for index entries of a batch of documents.
+	DocIdLookup(
+		defnID uint64, requestId string, docids [][]byte,
+		cons common.Consistency, vector *TsConsistency,
+		callb ResponseHandler) error
+
+	// DocIdLookup for index entries of a batch of documents.
+	DocIdLookupInternal(
+		defnID uint64, requestId string, docids [][]byte,
+		cons common.Consistency, vector *TsConsistency,
+		broker *RequestBroker) error
+
 	// Multiple scans with composite index filters
 	MultiScan(
 		defnID uint64, requestId string, scans Scans,
@@ -534,6 +590,17 @@ func (c *GsiClient) CreateIndex3(
 	scheme common.PartitionScheme, partitionKeys []string,
 	with []byte) (defnID uint64, err error) {
 
+	return c.CreateIndex4(name, bucket, "", "", using, exprType, whereExpr,
+		secExprs, desc, isPrimary, scheme, partitionKeys, with)
+}
+
+// CreateIndex4 creates index on scope and collection of bucket.
+func (c *GsiClient) CreateIndex4(
+	name, bucket, scope, collection, using, exprType, whereExpr string,
+	secExprs []string, desc []bool, isPrimary bool,
+	scheme common.PartitionScheme, partitionKeys []string,
+	with []byte) (defnID uint64, err error) {
+
 	err = common.IsValidIndexName(name)
 	if err != nil {
 		return 0, err
@@ -544,13 +611,13 @@ func (c *GsiClient) CreateIndex3(
 	}
 	begin := time.Now()
 	defnID, err = c.bridge.CreateIndex(
-		name, bucket, using, exprType, whereExpr,
+		name, bucket, scope, collection, using, exprType, whereExpr,
 		secExprs, desc, isPrimary, scheme, partitionKeys, with)
-	fmsg := "CreateIndex %v %v/%v using:%v exprType:%v " +
+	fmsg := "CreateIndex %v %v/%v/%v/%v using:%v exprType:%v " +
 		"whereExpr:%v secExprs:%v desc:%v isPrimary:%v scheme:%v " +
 		" partitionKeys:%v with:%v - elapsed(%v) err(%v)"
 	logging.Infof(
-		fmsg, defnID, bucket, name, using, exprType, logging.TagUD(whereExpr),
+		fmsg, defnID, bucket, scope, collection, name, using, exprType, logging.TagUD(whereExpr),
 		logging.TagUD(secExprs), desc, isPrimary, scheme, logging.TagUD(partitionKeys), string(with), time.Since(begin), err)
 	return defnID, err
 }
@@ -591,6 +658,54 @@ func (c *GsiClient) AlterReplicaCount(action string, defnID uint64, with map[str
 	return err
 }
 
+// AlterIndex implements BridgeAccessor{} interface.
+func (c *GsiClient) AlterIndex(defnID uint64, with map[string]interface{}) error {
+	if c.bridge == nil {
+		return ErrorClientUninitialized
+	}
+	begin := time.Now()
+	err := c.bridge.AlterIndex(defnID, with)
+	fmsg := "AlterIndex %v - elapsed(%v), err(%v)"
+	logging.Infof(fmsg, defnID, time.Since(begin), err)
+	return err
+}
+
+// PauseIndex implements BridgeAccessor{} interface.
+func (c *GsiClient) PauseIndex(defnID uint64, pause bool) error {
+	if c.bridge == nil {
+		return ErrorClientUninitialized
+	}
+	begin := time.Now()
+	err := c.bridge.PauseIndex(defnID, pause)
+	fmsg := "PauseIndex %v pause(%v) - elapsed(%v), err(%v)"
+	logging.Infof(fmsg, defnID, pause, time.Since(begin), err)
+	return err
+}
+
+// CreateAggregate implements BridgeAccessor{} interface.
+func (c *GsiClient) CreateAggregate(defnID uint64, aggr *common.AggregateDefn) error {
+	if c.bridge == nil {
+		return ErrorClientUninitialized
+	}
+	begin := time.Now()
+	err := c.bridge.CreateAggregate(defnID, aggr)
+	fmsg := "CreateAggregate %v %v - elapsed(%v), err(%v)"
+	logging.Infof(fmsg, defnID, aggr, time.Since(begin), err)
+	return err
+}
+
+// DropAggregate implements BridgeAccessor{} interface.
+func (c *GsiClient) DropAggregate(defnID uint64, name string) error {
+	if c.bridge == nil {
+		return ErrorClientUninitialized
+	}
+	begin := time.Now()
+	err := c.bridge.DropAggregate(defnID, name)
+	fmsg := "DropAggregate %v %v - elapsed(%v), err(%v)"
+	logging.Infof(fmsg, defnID, name, time.Since(begin), err)
+	return err
+}
+
 // DropIndex implements BridgeAccessor{} interface.
 func (c *GsiClient) DropIndex(defnID uint64) error {
 	if c.bridge == nil {
@@ -607,7 +722,26 @@ func (c *GsiClient) DropIndex(defnID uint64) error {
 func (c *GsiClient) LookupStatistics(
 	defnID uint64, requestId string, value common.SecondaryKey) (common.IndexStatistics, error) {
 
-	return nil, ErrorNotImplemented
+	if c.bridge == nil {
+		return nil, ErrorClientUninitialized
+	}
+
+	var val []byte
+	var err error
+	if c.bridge.IsPrimary(defnID) {
+		// primary keys are plain sequence of binary.
+		var what string
+		if len(value) > 0 {
+			if val, what = curePrimaryKey(value[0]); what != "ok" {
+				return emptyStatistics(), nil
+			}
+		}
+	} else if val, err = commonjson.Marshal(value); err != nil {
+		return nil, err
+	}
+
+	span := &protobuf.Span{Equals: [][]byte{val}}
+	return c.doStatistics(defnID, requestId, spanStatistics(requestId, span))
 }
 
 // RangeStatistics for index range.
@@ -615,7 +749,134 @@ func (c *GsiClient) RangeStatistics(
 	defnID uint64, requestId string, low, high common.SecondaryKey,
 	inclusion Inclusion) (common.IndexStatistics, error) {
 
-	return nil, ErrorNotImplemented
+	if c.bridge == nil {
+		return nil, ErrorClientUninitialized
+	}
+
+	var l, h []byte
+	var err error
+	if c.bridge.IsPrimary(defnID) {
+		// primary keys are plain sequence of binary.
+		var what string
+		if len(low) > 0 {
+			if l, what = curePrimaryKey(low[0]); what == "after" {
+				return emptyStatistics(), nil
+			}
+		}
+		if len(high) > 0 {
+			if h, what = curePrimaryKey(high[0]); what == "before" {
+				return emptyStatistics(), nil
+			}
+		}
+	} else {
+		// empty low and high, request statistics on full index.
+		if len(low) > 0 {
+			if l, err = commonjson.Marshal(low); err != nil {
+				return nil, err
+			}
+		}
+		if len(high) > 0 {
+			if h, err = commonjson.Marshal(high); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	span := &protobuf.Span{
+		Range: &protobuf.Range{
+			Low: l, High: h, Inclusion: proto.Uint32(uint32(inclusion)),
+		},
+	}
+	return c.doStatistics(defnID, requestId, spanStatistics(requestId, span))
+}
+
+// LeadKeyHistogram of the leading key of the index, sampled by the
+// indexer nodes hosting its partitions.
+func (c *GsiClient) LeadKeyHistogram(
+	defnID uint64, requestId string) (common.IndexStatistics, error) {
+
+	if c.bridge == nil {
+		return nil, ErrorClientUninitialized
+	}
+
+	fetch := func(qc *GsiScanClient, defnID uint64,
+		partitions []common.PartitionId) (*protobuf.IndexStatistics, error) {
+
+		return qc.LeadKeyHistogram(defnID, requestId, partitions)
+	}
+	return c.doStatistics(defnID, requestId, fetch)
+}
+
+// statisticsFetcher gets statistics of index partitions from an
+// indexer node.
+type statisticsFetcher func(qc *GsiScanClient, defnID uint64,
+	partitions []common.PartitionId) (*protobuf.IndexStatistics, error)
+
+func spanStatistics(requestId string, span *protobuf.Span) statisticsFetcher {
+	return func(qc *GsiScanClient, defnID uint64,
+		partitions []common.PartitionId) (*protobuf.IndexStatistics, error) {
+
+		return qc.Statistics(defnID, requestId, span, partitions)
+	}
+}
+
+// doStatistics gather statistics from indexer nodes hosting the
+// partitions of an index and merge them. Unlike scans there is no replica
+// retry, statistics are best effort and consumer can retry on error.
+func (c *GsiClient) doStatistics(
+	defnID uint64, requestId string,
+	fetch statisticsFetcher) (common.IndexStatistics, error) {
+
+	// check whether the index is present and available.
+	if _, err := c.bridge.IndexState(defnID); err != nil {
+		return nil, err
+	}
+
+	begin := time.Now()
+
+	var excludes map[common.IndexDefnId]map[common.PartitionId]map[uint64]bool
+	skips := make(map[common.IndexDefnId]bool)
+
+	queryports, targetDefnID, _, _, partitions, _, ok := c.bridge.GetScanport(defnID, excludes, skips)
+	if !ok {
+		return nil, ErrorNoHost
+	}
+	qcs, ok := c.getScanClients(queryports)
+	if !ok {
+		return nil, ErrorNoHost
+	}
+
+	nbins := 0
+	results := make([]*protobuf.IndexStatistics, 0, len(qcs))
+	for i, qc := range qcs {
+		stats, err := fetch(qc, targetDefnID, partitions[i])
+		if err != nil {
+			return nil, err
+		}
+		if len(stats.GetBins()) > nbins {
+			nbins = len(stats.GetBins())
+		}
+		results = append(results, stats)
+	}
+	stats, err := protobuf.MergeStatistics(nbins, results...)
+
+	fmsg := "Statistics {%v,%v} - elapsed(%v) err(%v)"
+	logging.Verbosef(fmsg, defnID, requestId, time.Since(begin), err)
+	if err != nil {
+		return nil, err
+	} else if stats == nil {
+		return emptyStatistics(), nil
+	}
+	return stats, nil
+}
+
+func emptyStatistics() *protobuf.IndexStatistics {
+	return &protobuf.IndexStatistics{
+		KeysCount:       proto.Uint64(0),
+		UniqueKeysCount: proto.Uint64(0),
+		KeyMin:          []byte("[]"),
+		KeyMax:          []byte("[]"),
+	}
 }
 
 // Lookup scan index between low and high.
@@ -810,6 +1071,62 @@ func (c *GsiClient) ScanAllInternal(
 	return
 }
 
+// DocIdLookup returns (docid, secondary-key) entries of documents
+// `docids` from the index. For a partitioned index, all partitions are
+// looked up and a document is returned from the partition holding it.
+func (c *GsiClient) DocIdLookup(
+	defnID uint64, requestId string, docids [][]byte,
+	cons common.Consistency, vector *TsConsistency,
+	callb ResponseHandler) (err error) {
+
+	dataEncFmt := c.GetDataEncodingFormat()
+	broker := makeDefaultRequestBroker(callb, dataEncFmt)
+	return c.DocIdLookupInternal(defnID, requestId, docids, cons, vector, broker)
+}
+
+// DocIdLookup for index entries of a batch of documents.
+func (c *GsiClient) DocIdLookupInternal(
+	defnID uint64, requestId string, docids [][]byte,
+	cons common.Consistency, vector *TsConsistency,
+	broker *RequestBroker) (err error) {
+
+	if c.bridge == nil {
+		return ErrorClientUninitialized
+	}
+
+	// check whether the index is present and available.
+	if _, err = c.bridge.IndexState(defnID); err != nil {
+		return err
+	}
+
+	begin := time.Now()
+
+	handler := func(qc *GsiScanClient, index *common.IndexDefn, rollbackTime int64, partitions []common.PartitionId,
+		handler ResponseHandler) (error, bool) {
+		var err error
+
+		dataEncFmt := broker.GetDataEncodingFormat()
+
+		vector, err = c.getConsistency(qc, cons, vector, index.Bucket)
+		if err != nil {
+			return err, false
+		}
+		return qc.DocIdLookup(uint64(index.DefnId), requestId, docids,
+			cons, vector, handler, rollbackTime, partitions, dataEncFmt, broker.DoRetry())
+	}
+
+	broker.SetScanRequestHandler(handler)
+
+	_, err = c.doScan(defnID, requestId, broker)
+	if err != nil { // callback with error
+		return err
+	}
+
+	fmsg := "DocIdLookup {%v,%v,%v} - elapsed(%v) err(%v)"
+	logging.Verbosef(fmsg, defnID, requestId, len(docids), time.Since(begin), err)
+	return
+}
+
 func (c *GsiClient) MultiScan(
 	defnID uint64, requestId string, scans Scans, reverse,
 	distinct bool, projection *IndexProjection, offset, limit int64,
@@ -1047,12 +1364,12 @@ func (c *GsiClient) MultiScanCountInternal(
 		}
 		if c.bridge.IsPrimary(uint64(index.DefnId)) {
 			count, err = qc.MultiScanCountPrimary(
-				uint64(index.DefnId), requestId, scans, distinct, cons, vector, rollbackTime, partitions, broker.DoRetry())
+				uint64(index.DefnId), requestId, scans, distinct, cons, vector, rollbackTime, partitions, 0, broker.DoRetry())
 			return count, err, false
 		}
 
 		count, err = qc.MultiScanCount(
-			uint64(index.DefnId), requestId, scans, distinct, cons, vector, rollbackTime, partitions, broker.DoRetry())
+			uint64(index.DefnId), requestId, scans, distinct, cons, vector, rollbackTime, partitions, 0, broker.DoRetry())
 		return count, err, false
 	}
 
@@ -1110,16 +1427,16 @@ func (c *GsiClient) Scan3Internal(
 		if c.bridge.IsPrimary(uint64(index.DefnId)) {
 			return qc.Scan3Primary(
 				uint64(index.DefnId), requestId, scans, reverse, distinct,
-				projection, broker.GetOffset(), broker.GetLimit(), groupAggr,
+				projection, broker.GetOffset(), broker.GetLimit(), broker.GetGroupAggr(),
 				broker.GetSorted(), cons, vector, handler, rollbackTime,
-				partitions, dataEncFmt, broker.DoRetry())
+				partitions, dataEncFmt, 0, broker.GetProfile(), broker.DoRetry())
 		}
 
 		return qc.Scan3(
 			uint64(index.DefnId), requestId, scans, reverse, distinct,
-			projection, broker.GetOffset(), broker.GetLimit(), groupAggr,
+			projection, broker.GetOffset(), broker.GetLimit(), broker.GetGroupAggr(),
 			broker.GetSorted(), cons, vector, handler, rollbackTime,
-			partitions, dataEncFmt, broker.DoRetry())
+			partitions, dataEncFmt, 0, broker.GetProfile(), broker.DoRetry())
 	}
 
 	broker.SetScanRequestHandler(handler)
@@ -1142,6 +1459,222 @@ func (c *GsiClient) Scan3Internal(
 	return
 }
 
+//-------------------------------------
+// Point-in-time scans on a pinned snapshot
+//-------------------------------------
+
+// SnapshotHandle refers to an index snapshot pinned on an indexer node by
+// OpenSnapshot. Scans and counts issued with the handle read from the same
+// point-in-time until the handle is closed or its lease expires. The lease
+// is renewed by the indexer every time the snapshot is scanned.
+type SnapshotHandle struct {
+	DefnID     uint64
+	SnapshotId uint64
+	Lease      time.Duration
+
+	queryport     string
+	index         *common.IndexDefn
+	instId        uint64
+	rollbackTime  int64
+	partitions    []common.PartitionId
+	numPartitions uint32
+	renewed       int64 // unix-nano, when the lease was last renewed
+}
+
+// Expired returns true if the lease on the snapshot has lapsed. The lease
+// is renewed by the indexer only after the client sent a request, hence
+// this errs on the side of reporting expiry early.
+func (h *SnapshotHandle) Expired() bool {
+	renewed := time.Unix(0, atomic.LoadInt64(&h.renewed))
+	return time.Since(renewed) > h.Lease
+}
+
+// OpenSnapshot pins a snapshot of index `defnID` satisfying the requested
+// consistency. All partitions of the chosen index instance must be hosted
+// by the same indexer node. A `lease` of ZERO picks the indexer default.
+func (c *GsiClient) OpenSnapshot(
+	defnID uint64, requestId string,
+	cons common.Consistency, vector *TsConsistency,
+	lease time.Duration) (*SnapshotHandle, error) {
+
+	if c.bridge == nil {
+		return nil, ErrorClientUninitialized
+	}
+
+	// check whether the index is present and available.
+	if _, err := c.bridge.IndexState(defnID); err != nil {
+		return nil, err
+	}
+
+	skips := make(map[common.IndexDefnId]bool)
+	queryports, targetDefnID, targetInstIds, rollbackTimes, partitions, numPartitions, ok := c.bridge.GetScanport(defnID, nil, skips)
+	if !ok {
+		return nil, ErrorNoHost
+	} else if len(queryports) != 1 {
+		return nil, ErrorSnapshotSpansNodes
+	}
+
+	index := c.bridge.GetIndexDefn(targetDefnID)
+	if index == nil {
+		return nil, ErrorIndexNotFound
+	}
+	qc := c.makeScanClient(queryports[0])
+	if qc == nil {
+		return nil, ErrorNoHost
+	}
+
+	vector, err := c.getConsistency(qc, cons, vector, index.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	snapshotId, granted, err := qc.OpenSnapshot(
+		uint64(index.DefnId), requestId, cons, vector, lease,
+		rollbackTimes[0], partitions[0], true)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &SnapshotHandle{
+		DefnID:        uint64(index.DefnId),
+		SnapshotId:    snapshotId,
+		Lease:         granted,
+		queryport:     queryports[0],
+		index:         index,
+		instId:        targetInstIds[0],
+		rollbackTime:  rollbackTimes[0],
+		partitions:    partitions[0],
+		numPartitions: numPartitions,
+		renewed:       now.UnixNano(),
+	}
+	fmsg := "OpenSnapshot {%v,%v} - snapshot %v on %v lease %v"
+	logging.Verbosef(fmsg, defnID, requestId, snapshotId, h.queryport, granted)
+	return h, nil
+}
+
+// CloseSnapshot releases the snapshot pinned by OpenSnapshot.
+func (c *GsiClient) CloseSnapshot(h *SnapshotHandle, requestId string) error {
+	qc := c.makeScanClient(h.queryport)
+	if qc == nil {
+		return ErrorSnapshotUnavailable
+	}
+	return qc.CloseSnapshot(h.DefnID, h.SnapshotId, requestId, true)
+}
+
+// Scan3Snapshot is Scan3 on the snapshot pinned by `h`.
+func (c *GsiClient) Scan3Snapshot(
+	h *SnapshotHandle, requestId string, scans Scans, reverse,
+	distinct bool, projection *IndexProjection, offset, limit int64,
+	groupAggr *GroupAggr, indexOrder *IndexKeyOrder,
+	callb ResponseHandler) (err error) {
+
+	if c.bridge == nil {
+		return ErrorClientUninitialized
+	}
+
+	begin := time.Now()
+
+	broker := makeDefaultRequestBroker(callb, c.GetDataEncodingFormat())
+	handler := func(qc *GsiScanClient, index *common.IndexDefn, rollbackTime int64, partitions []common.PartitionId,
+		handler ResponseHandler) (error, bool) {
+
+		dataEncFmt := broker.GetDataEncodingFormat()
+		if c.bridge.IsPrimary(uint64(index.DefnId)) {
+			return qc.Scan3Primary(
+				uint64(index.DefnId), requestId, scans, reverse, distinct,
+				projection, broker.GetOffset(), broker.GetLimit(), broker.GetGroupAggr(),
+				broker.GetSorted(), common.AnyConsistency, nil, handler, rollbackTime,
+				partitions, dataEncFmt, h.SnapshotId, broker.GetProfile(), false)
+		}
+
+		return qc.Scan3(
+			uint64(index.DefnId), requestId, scans, reverse, distinct,
+			projection, broker.GetOffset(), broker.GetLimit(), broker.GetGroupAggr(),
+			broker.GetSorted(), common.AnyConsistency, nil, handler, rollbackTime,
+			partitions, dataEncFmt, h.SnapshotId, broker.GetProfile(), false)
+	}
+
+	broker.SetScanRequestHandler(handler)
+	broker.SetLimit(limit)
+	broker.SetOffset(offset)
+	broker.SetScans(scans)
+	broker.SetGroupAggr(groupAggr)
+	broker.SetProjection(projection)
+	broker.SetSorted(indexOrder != nil)
+	broker.SetDistinct(distinct)
+	broker.SetIndexOrder(indexOrder)
+
+	_, err = c.doSnapshotScan(h, requestId, broker)
+
+	fmsg := "Scan3Snapshot {%v,%v,%v} - elapsed(%v) err(%v)"
+	logging.Verbosef(fmsg, h.DefnID, h.SnapshotId, requestId, time.Since(begin), err)
+	return err
+}
+
+// MultiScanCountSnapshot is MultiScanCount on the snapshot pinned by `h`.
+func (c *GsiClient) MultiScanCountSnapshot(
+	h *SnapshotHandle, requestId string,
+	scans Scans, distinct bool) (count int64, err error) {
+
+	if c.bridge == nil {
+		return 0, ErrorClientUninitialized
+	}
+
+	begin := time.Now()
+
+	broker := makeDefaultRequestBroker(nil, c.GetDataEncodingFormat())
+	handler := func(qc *GsiScanClient, index *common.IndexDefn, rollbackTime int64, partitions []common.PartitionId) (int64, error, bool) {
+		var count int64
+		var err error
+
+		if c.bridge.IsPrimary(uint64(index.DefnId)) {
+			count, err = qc.MultiScanCountPrimary(
+				uint64(index.DefnId), requestId, scans, distinct, common.AnyConsistency, nil, rollbackTime, partitions, h.SnapshotId, false)
+			return count, err, false
+		}
+
+		count, err = qc.MultiScanCount(
+			uint64(index.DefnId), requestId, scans, distinct, common.AnyConsistency, nil, rollbackTime, partitions, h.SnapshotId, false)
+		return count, err, false
+	}
+
+	broker.SetCountRequestHandler(handler)
+
+	count, err = c.doSnapshotScan(h, requestId, broker)
+
+	fmsg := "MultiScanCountSnapshot {%v,%v,%v} - elapsed(%v) err(%v)"
+	logging.Verbosef(fmsg, h.DefnID, h.SnapshotId, requestId, time.Since(begin), err)
+	return count, err
+}
+
+// doSnapshotScan scatters the request to the indexer holding the pinned
+// snapshot. Unlike doScan there is no retry on other replicas, as no other
+// replica can serve the same point-in-time.
+func (c *GsiClient) doSnapshotScan(h *SnapshotHandle, requestId string,
+	broker *RequestBroker) (int64, error) {
+
+	atomic.AddInt64(&c.numScans, 1)
+	defer atomic.AddInt64(&c.numScans, -1)
+
+	if h.Expired() {
+		return 0, ErrorSnapshotExpired
+	}
+
+	now := time.Now()
+	broker.SetResponseTimer(c.bridge.Timeit)
+	count, scan_errs, _, refresh := broker.scatter(c.makeScanClient, h.index,
+		[]string{h.queryport}, []uint64{h.instId}, []int64{h.rollbackTime},
+		[][]common.PartitionId{h.partitions}, h.numPartitions, c.settings)
+	if refresh {
+		return 0, ErrorSnapshotUnavailable
+	} else if len(scan_errs) != 0 {
+		return 0, getScanError(scan_errs)
+	}
+	atomic.StoreInt64(&h.renewed, now.UnixNano())
+	return count, nil
+}
+
 //-------------------------------------
 // StorageStatistics implementation
 //-------------------------------------
@@ -1456,6 +1989,17 @@ func (c *GsiClient) makeScanClient(scanport string) *GsiScanClient {
 	return nil
 }
 
+// hedgeReplica implements ReplicaHedger{} with replicas known to bridge.
+func (c *GsiClient) hedgeReplica(instId uint64, partitions []common.PartitionId) (*GsiScanClient,
+	uint64, int64, time.Duration, bool) {
+
+	queryport, targetInstId, rollbackTime, delay, ok := c.bridge.GetHedgeScanport(instId, partitions)
+	if !ok {
+		return nil, 0, 0, 0, false
+	}
+	return c.makeScanClient(queryport), targetInstId, rollbackTime, delay, true
+}
+
 func (c *GsiClient) doScan(defnID uint64, requestId string, broker *RequestBroker) (int64, error) {
 
 	atomic.AddInt64(&c.numScans, 1)
@@ -1465,6 +2009,7 @@ func (c *GsiClient) doScan(defnID uint64, requestId string, broker *RequestBroke
 	var err error
 
 	broker.SetResponseTimer(c.bridge.Timeit)
+	broker.SetReplicaHedger(c.hedgeReplica)
 	skips := make(map[common.IndexDefnId]bool)
 
 	wait := c.config["retryIntervalScanport"].Int()
@@ -1506,8 +2051,14 @@ func (c *GsiClient) doScan(defnID uint64, requestId string, broker *RequestBroke
 				err = fmt.Errorf("%v from %v", getScanError(scan_errs), queryports)
 
 				if len(queryports) == len(partitions) && len(queryports) == len(targetInstIds) {
+					log := logging.WithFields(logging.Fields{
+						Component: "gsiclient",
+						Bucket:    index.Bucket,
+						Index:     index.Name,
+						RequestId: requestId,
+					})
 					for i, _ := range queryports {
-						logging.Warnf("scan failed: requestId %v queryport %v inst %v partition %v", requestId, queryports[i], targetInstIds[i], partitions[i])
+						log.WithPartition(partitions[i]).Warnf("scan failed: requestId %v queryport %v inst %v partition %v", requestId, queryports[i], targetInstIds[i], partitions[i])
 					}
 				}
 			}
@@ -43,6 +43,11 @@ type connectionPool struct {
 	relConnBatchSize int32
 	stopCh           chan bool
 	ewma             gometrics.EWMA
+	// transport compression for new connections, negotiated via Helo.
+	compression uint32
+	// payload bytes of closed connections, before and after compression.
+	bytesUncompressed uint64
+	bytesCompressed   uint64
 }
 
 type connection struct {
@@ -86,12 +91,31 @@ func (cp *connectionPool) defaultMkConn(host string) (*connection, error) {
 		return nil, err
 	}
 	flags := transport.TransportFlag(0).SetProtobuf()
+	flags = flags.SetCompression(cp.getCompression())
 	pkt := transport.NewTransportPacket(cp.maxPayload, flags)
 	pkt.SetEncoder(transport.EncodingProtobuf, protobuf.ProtobufEncode)
 	pkt.SetDecoder(transport.EncodingProtobuf, protobuf.ProtobufDecode)
 	return &connection{conn, pkt}, nil
 }
 
+func (cp *connectionPool) setCompression(compression byte) {
+	atomic.StoreUint32(&cp.compression, uint32(compression))
+}
+
+func (cp *connectionPool) getCompression() byte {
+	return byte(atomic.LoadUint32(&cp.compression))
+}
+
+// closeConnection and account its compression stats with the pool.
+func (cp *connectionPool) closeConnection(connectn *connection) {
+	connectn.conn.Close()
+	if connectn.pkt != nil {
+		uncompressed, compressed := connectn.pkt.CompressionStats()
+		atomic.AddUint64(&cp.bytesUncompressed, uncompressed)
+		atomic.AddUint64(&cp.bytesCompressed, compressed)
+	}
+}
+
 func (cp *connectionPool) Close() (err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -102,7 +126,7 @@ func (cp *connectionPool) Close() (err error) {
 	cp.stopCh <- true
 	close(cp.connections)
 	for connectn := range cp.connections {
-		connectn.conn.Close()
+		cp.closeConnection(connectn)
 	}
 	logging.Infof("%v ... stopped\n", cp.logPrefix)
 	return
@@ -192,7 +216,7 @@ func (cp *connectionPool) Renew(conn *connection) (*connection, error) {
 	newConn, err := cp.mkConn(cp.host)
 	if err == nil {
 		logging.Infof("%v closing unhealthy connection %q\n", cp.logPrefix, conn.conn.LocalAddr())
-		conn.conn.Close()
+		cp.closeConnection(conn)
 		conn = newConn
 	}
 
@@ -222,7 +246,7 @@ func (cp *connectionPool) Return(connectn *connection, healthy bool) {
 				// closed and we're trying to return a
 				// connection to it anyway.  Just close the
 				// connection.
-				connectn.conn.Close()
+				cp.closeConnection(connectn)
 			}
 		}()
 
@@ -233,13 +257,13 @@ func (cp *connectionPool) Return(connectn *connection, healthy bool) {
 		default:
 			logging.Debugf("%v closing overflow connection %q poolSize=%v\n", cp.logPrefix, laddr, len(cp.connections))
 			<-cp.createsem
-			connectn.conn.Close()
+			cp.closeConnection(connectn)
 		}
 
 	} else {
 		logging.Infof("%v closing unhealthy connection %q\n", cp.logPrefix, laddr)
 		<-cp.createsem
-		connectn.conn.Close()
+		cp.closeConnection(connectn)
 	}
 }
 
@@ -278,7 +302,7 @@ func (cp *connectionPool) releaseConns(numRetConns int32) {
 					return
 				}
 				atomic.AddInt32(&cp.freeConns, -1)
-				conn.conn.Close()
+				cp.closeConnection(conn)
 			default:
 				break
 			}
@@ -316,6 +340,10 @@ func (cp *connectionPool) releaseConnsRoutine() {
 			fc := atomic.LoadInt32(&cp.freeConns)
 			if j == CONN_COUNT_LOG_INTERVAL-1 {
 				logging.Infof("%v active conns %v, free conns %v", cp.logPrefix, act, fc)
+				uncompressed := atomic.LoadUint64(&cp.bytesUncompressed)
+				compressed := atomic.LoadUint64(&cp.bytesCompressed)
+				fmsg := "%v closed conns payload bytes %v compressed to %v"
+				logging.Infof(fmsg, cp.logPrefix, uncompressed, compressed)
 			}
 
 			i = (i + 1) % CONN_RELEASE_INTERVAL
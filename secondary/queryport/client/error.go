@@ -27,6 +27,15 @@ var ErrorInvalidConsistency = errors.New("queryport.invalidConsistency")
 // ErrorExpectedTimestamp
 var ErrorExpectedTimestamp = errors.New("queryport.expectedTimestamp")
 
+// ErrorSnapshotSpansNodes
+var ErrorSnapshotSpansNodes = errors.New("queryport.snapshotSpansNodes")
+
+// ErrorSnapshotUnavailable
+var ErrorSnapshotUnavailable = errors.New("queryport.snapshotUnavailable")
+
+// ErrorSnapshotExpired
+var ErrorSnapshotExpired = errors.New("queryport.snapshotExpired")
+
 // These error strings need to be in sync with common.ErrIndexNotFound
 // and common.ErrIndexNotReady.
 var ErrIndexNotFound = fmt.Errorf("Index not found")
@@ -41,6 +50,9 @@ var errorDescriptions = map[string]string{
 	ErrorNotImplemented.Error():      "client API not implemented",
 	ErrorInvalidConsistency.Error():  "supplied consistency is invalid",
 	ErrorExpectedTimestamp.Error():   "consistency timestamp is expected",
+	ErrorSnapshotSpansNodes.Error():  "index is spread across indexer nodes, cannot pin a snapshot",
+	ErrorSnapshotUnavailable.Error(): "indexer node holding the snapshot is unavailable",
+	ErrorSnapshotExpired.Error():     "lease on the snapshot has expired",
 	ErrIndexNotFound.Error():         "index is deleted or node hosting index is down",
 	ErrIndexNotReady.Error():         ErrIndexNotReady.Error(),
 }
@@ -38,7 +38,8 @@ type metadataClient struct {
 	mdNotifyCh     chan bool
 	stNotifyCh     chan map[common.IndexInstId]map[common.PartitionId]common.Statistics
 
-	settings *ClientSettings
+	settings    *ClientSettings
+	serverGroup atomic.Value // string, server group of query node
 
 	refreshLock    sync.Mutex
 	refreshCond    *sync.Cond
@@ -48,15 +49,16 @@ type metadataClient struct {
 
 // sherlock topology management, multi-node & single-partition.
 type indexTopology struct {
-	version     uint64
-	adminports  map[string]common.IndexerId // book-keeping for cluster changes
-	topology    map[common.IndexerId][]*mclient.IndexMetadata
-	queryports  map[common.IndexerId]string
-	replicas    map[common.IndexDefnId][]common.IndexInstId
-	equivalents map[common.IndexDefnId][]common.IndexDefnId
-	partitions  map[common.IndexDefnId]map[common.PartitionId][]common.IndexInstId
-	rw          sync.RWMutex
-	loads       map[common.IndexInstId]*loadHeuristics
+	version      uint64
+	adminports   map[string]common.IndexerId // book-keeping for cluster changes
+	topology     map[common.IndexerId][]*mclient.IndexMetadata
+	queryports   map[common.IndexerId]string
+	serverGroups map[common.IndexerId]string
+	replicas     map[common.IndexDefnId][]common.IndexInstId
+	equivalents  map[common.IndexDefnId][]common.IndexDefnId
+	partitions   map[common.IndexDefnId]map[common.PartitionId][]common.IndexInstId
+	rw           sync.RWMutex
+	loads        map[common.IndexInstId]*loadHeuristics
 	// insts could include pending RState inst if there is no corresponding active instance
 	insts      map[common.IndexInstId]*mclient.InstanceDefn
 	rebalInsts map[common.IndexInstId]*mclient.InstanceDefn
@@ -209,7 +211,7 @@ func (b *metadataClient) GetIndexReplica(defnId uint64) []*mclient.InstanceDefn
 
 // CreateIndex implements BridgeAccessor{} interface.
 func (b *metadataClient) CreateIndex(
-	indexName, bucket, using, exprType, whereExpr string,
+	indexName, bucket, scope, collection, using, exprType, whereExpr string,
 	secExprs []string, desc []bool, isPrimary bool,
 	scheme common.PartitionScheme, partitionKeys []string,
 	planJSON []byte) (uint64, error) {
@@ -224,8 +226,8 @@ func (b *metadataClient) CreateIndex(
 
 	refreshCnt := 0
 RETRY:
-	defnID, err, needRefresh := b.mdClient.CreateIndexWithPlan(
-		indexName, bucket, using, exprType, whereExpr,
+	defnID, err, needRefresh := b.mdClient.CreateIndexWithPlan2(
+		indexName, bucket, scope, collection, using, exprType, whereExpr,
 		secExprs, desc, isPrimary, scheme, partitionKeys, plan)
 
 	if needRefresh && refreshCnt == 0 {
@@ -315,6 +317,38 @@ func (b *metadataClient) AlterReplicaCount(action string, defnID uint64, planJSO
 	return b.mdClient.AlterReplicaCount(action, common.IndexDefnId(defnID), planJSON)
 }
 
+// AlterIndex implements BridgeAccessor{} interface.
+func (b *metadataClient) AlterIndex(defnID uint64, with map[string]interface{}) error {
+	err := b.mdClient.AlterIndex(common.IndexDefnId(defnID), with)
+	if err == nil { // refresh index local cache.
+		b.safeupdate(nil, false /*force*/)
+	}
+	return err
+}
+
+// PauseIndex implements BridgeAccessor{} interface.
+func (b *metadataClient) PauseIndex(defnID uint64, pause bool) error {
+	return b.mdClient.PauseIndex(common.IndexDefnId(defnID), pause)
+}
+
+// CreateAggregate implements BridgeAccessor{} interface.
+func (b *metadataClient) CreateAggregate(defnID uint64, aggr *common.AggregateDefn) error {
+	err := b.mdClient.CreateAggregate(common.IndexDefnId(defnID), aggr)
+	if err == nil { // refresh index local cache.
+		b.safeupdate(nil, false /*force*/)
+	}
+	return err
+}
+
+// DropAggregate implements BridgeAccessor{} interface.
+func (b *metadataClient) DropAggregate(defnID uint64, name string) error {
+	err := b.mdClient.DropAggregate(common.IndexDefnId(defnID), name)
+	if err == nil { // refresh index local cache.
+		b.safeupdate(nil, false /*force*/)
+	}
+	return err
+}
+
 // DropIndex implements BridgeAccessor{} interface.
 func (b *metadataClient) DropIndex(defnID uint64) error {
 	err := b.mdClient.DropIndex(common.IndexDefnId(defnID))
@@ -432,6 +466,7 @@ func (b *metadataClient) Timeit(instID uint64, partitionId common.PartitionId, v
 
 	load.updateLoad(partitionId, value)
 	load.incHit(partitionId)
+	load.latency.update(partitionId, value, b.settings.RoutingPolicy().LatencyAlpha)
 }
 
 // IsPrimary implement BridgeAccessor{} interface.
@@ -595,6 +630,7 @@ type loadHeuristics struct {
 	hit           []uint64
 	numPartitions int
 	stats         unsafe.Pointer
+	latency       *replicaLatency
 }
 
 type loadStats struct {
@@ -629,6 +665,7 @@ func newLoadHeuristics(numPartitions int) *loadHeuristics {
 		hit:           make([]uint64, numPartitions+1),
 		numPartitions: numPartitions,
 		stats:         unsafe.Pointer(newLoadStats(numPartitions)),
+		latency:       newReplicaLatency(numPartitions),
 	}
 
 	for i := 0; i < numPartitions+1; i++ {
@@ -762,6 +799,11 @@ func (b *loadHeuristics) cloneRefresh(curInst *mclient.InstanceDefn, newInst *mc
 		}
 	}
 
+	clone.latency = b.latency.cloneRefresh(b.numPartitions, func(partnId common.PartitionId) bool {
+		_, ok := newInst.IndexerId[partnId]
+		return ok && newInst.Versions[partnId] == curInst.Versions[partnId]
+	})
+
 	return clone
 }
 
@@ -912,6 +954,10 @@ func (b *metadataClient) pickRandom(replicas []uint64, defnID uint64,
 		return result
 	}
 	replicas = shuffle(replicas)
+	policy := b.settings.RoutingPolicy()
+	if policy.LatencyWeighted {
+		replicas = b.latencyOrder(currmeta, replicas)
+	}
 
 	//
 	// Filter out inst based on pending item stats.
@@ -922,7 +968,7 @@ func (b *metadataClient) pickRandom(replicas []uint64, defnID uint64,
 	b.filterByTiming(currmeta, replicas, rollbackTimesList, startPartnId, endPartnId)
 
 	//
-	// Randomly select an inst after filtering
+	// Randomly select an inst after filtering, in the order of routing policy
 	//
 	chosenInst := make(map[common.PartitionId]*mclient.InstanceDefn)
 	chosenTimestamp := make(map[common.PartitionId]int64)
@@ -933,8 +979,9 @@ func (b *metadataClient) pickRandom(replicas []uint64, defnID uint64,
 		var inst *mclient.InstanceDefn
 		var rollbackTime int64
 
-		for n, replica := range replicas {
+		for _, n := range b.routeReplicas(currmeta, replicas, common.PartitionId(partnId), policy) {
 
+			replica := replicas[n]
 			var ok1, ok2, ok3 bool
 			inst, ok1 = currmeta.insts[common.IndexInstId(replica)]
 			rollbackTime, ok2 = rollbackTimesList[n][common.PartitionId(partnId)]
@@ -1339,6 +1386,7 @@ func (b *metadataClient) updateIndexerList(discardExisting bool) error {
 	if err := cinfo.Fetch(); err != nil {
 		return err
 	}
+	b.serverGroup.Store(clusterServerGroup(cinfo))
 
 	// UpdateIndexerList is synchronous, except for async callback from WatchMetadata() -- when indexer is
 	// not responding fast enough.
@@ -1502,16 +1550,17 @@ func (b *metadataClient) updateTopology(
 
 	// create a new topology.
 	newmeta := &indexTopology{
-		version:     version,
-		allIndexes:  mindexes,
-		adminports:  make(map[string]common.IndexerId),
-		topology:    make(map[common.IndexerId][]*mclient.IndexMetadata),
-		replicas:    make(map[common.IndexDefnId][]common.IndexInstId),
-		equivalents: make(map[common.IndexDefnId][]common.IndexDefnId),
-		queryports:  make(map[common.IndexerId]string),
-		insts:       make(map[common.IndexInstId]*mclient.InstanceDefn),
-		rebalInsts:  make(map[common.IndexInstId]*mclient.InstanceDefn),
-		defns:       make(map[common.IndexDefnId]*mclient.IndexMetadata),
+		version:      version,
+		allIndexes:   mindexes,
+		adminports:   make(map[string]common.IndexerId),
+		topology:     make(map[common.IndexerId][]*mclient.IndexMetadata),
+		replicas:     make(map[common.IndexDefnId][]common.IndexInstId),
+		equivalents:  make(map[common.IndexDefnId][]common.IndexDefnId),
+		queryports:   make(map[common.IndexerId]string),
+		serverGroups: make(map[common.IndexerId]string),
+		insts:        make(map[common.IndexInstId]*mclient.InstanceDefn),
+		rebalInsts:   make(map[common.IndexInstId]*mclient.InstanceDefn),
+		defns:        make(map[common.IndexDefnId]*mclient.IndexMetadata),
 	}
 
 	// adminport/queryport
@@ -1524,6 +1573,9 @@ func (b *metadataClient) updateTopology(
 			// This excludes watcher that is not currently connected
 			newmeta.queryports[indexerID] = qp
 		}
+		if group, err := b.mdClient.FindServerGroupForIndexer(indexerID); err == nil {
+			newmeta.serverGroups[indexerID] = group
+		}
 	}
 
 	// insts/defns
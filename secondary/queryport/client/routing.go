@@ -0,0 +1,428 @@
+package client
+
+import "math"
+import "math/rand"
+import "sort"
+import "sync"
+import "sync/atomic"
+import "time"
+
+import "github.com/couchbase/indexing/secondary/logging"
+import common "github.com/couchbase/indexing/secondary/common"
+
+// RoutingPolicy decides how scans are routed to the replicas of an
+// index, on top of pruning replicas that lag behind or respond slowly.
+type RoutingPolicy struct {
+	// PreferServerGroup picks replicas in the server group of the
+	// query node, if any of them can serve the scan.
+	PreferServerGroup bool
+	// ServerGroup of the query node, discovered from cluster
+	// membership if empty.
+	ServerGroup string
+	// LatencyWeighted picks replicas with a probability inversely
+	// proportional to the moving average of their scan latency.
+	LatencyWeighted bool
+	// LatencyAlpha is the smoothing factor of the moving average.
+	LatencyAlpha float64
+	// Hedge sends a duplicate scan request to another replica if the
+	// first one has not responded after HedgePercentile of its recent
+	// scan latencies, or HedgeMinDelay whichever is larger.
+	Hedge           bool
+	HedgePercentile float64
+	HedgeMinDelay   time.Duration
+}
+
+//--------------------------------------
+// replica latency
+//--------------------------------------
+
+// number of recent scans tracked for the hedge delay, and the minimum
+// before a replica is hedged.
+const latencyWindow = 128
+const minHedgeSamples = 16
+
+// replicaLatency tracks scan latency of an index instance, a moving
+// average per partition for routing and a window of recent scans for
+// the hedge delay.
+type replicaLatency struct {
+	ewma []uint64 // float64 bits, indexed by partition id
+
+	mu      sync.Mutex
+	samples []float64
+	next    int
+}
+
+func newReplicaLatency(numPartitions int) *replicaLatency {
+	return &replicaLatency{
+		ewma:    make([]uint64, numPartitions+1),
+		samples: make([]float64, 0, latencyWindow),
+	}
+}
+
+// update latency of `partitionId` with a scan that took `value`
+// nanoseconds.
+func (l *replicaLatency) update(partitionId common.PartitionId, value, alpha float64) {
+
+	if int(partitionId) >= len(l.ewma) {
+		return
+	}
+
+	for {
+		oldInt := atomic.LoadUint64(&l.ewma[int(partitionId)])
+		ewma := value
+		if oldInt != 0 {
+			ewma = alpha*value + (1.0-alpha)*math.Float64frombits(oldInt)
+		}
+		if atomic.CompareAndSwapUint64(&l.ewma[int(partitionId)], oldInt, math.Float64bits(ewma)) {
+			break
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.samples) < latencyWindow {
+		l.samples = append(l.samples, value)
+	} else {
+		l.samples[l.next] = value
+	}
+	l.next = (l.next + 1) % latencyWindow
+}
+
+func (l *replicaLatency) get(partitionId common.PartitionId) (float64, bool) {
+
+	if int(partitionId) >= len(l.ewma) {
+		return 0, false
+	}
+	ewmaInt := atomic.LoadUint64(&l.ewma[int(partitionId)])
+	return math.Float64frombits(ewmaInt), ewmaInt != 0
+}
+
+// avg latency across partitions timed so far.
+func (l *replicaLatency) avg() (float64, bool) {
+
+	sum, count := 0.0, 0
+	for i := range l.ewma {
+		if latency, ok := l.get(common.PartitionId(i)); ok {
+			sum += latency
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return sum / float64(count), true
+}
+
+// percentile `p` of recent scan latencies, false if there are not
+// enough scans to go by.
+func (l *replicaLatency) percentile(p float64) (time.Duration, bool) {
+
+	l.mu.Lock()
+	samples := append([]float64(nil), l.samples...)
+	l.mu.Unlock()
+
+	if len(samples) < minHedgeSamples {
+		return 0, false
+	}
+	sort.Float64s(samples)
+	pos := int(math.Ceil(p/100.0*float64(len(samples)))) - 1
+	if pos < 0 {
+		pos = 0
+	}
+	return time.Duration(samples[pos]), true
+}
+
+// cloneRefresh copies latency of partitions that `keep`.
+func (l *replicaLatency) cloneRefresh(numPartitions int,
+	keep func(common.PartitionId) bool) *replicaLatency {
+
+	clone := newReplicaLatency(numPartitions)
+	for i := range clone.ewma {
+		if i < len(l.ewma) && keep(common.PartitionId(i)) {
+			clone.ewma[i] = atomic.LoadUint64(&l.ewma[i])
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clone.samples = append(clone.samples, l.samples...)
+	clone.next = l.next
+	return clone
+}
+
+//--------------------------------------
+// replica routing
+//--------------------------------------
+
+// routeReplicas orders `replicas` for scanning partition `partnId` as
+// per the server group preference of routing policy, the first replica
+// that can serve the scan is picked. Otherwise the order of `replicas`
+// is kept, see latencyOrder.
+func (b *metadataClient) routeReplicas(currmeta *indexTopology, replicas []uint64,
+	partnId common.PartitionId, policy *RoutingPolicy) []int {
+
+	order := make([]int, len(replicas))
+	for i := range order {
+		order[i] = i
+	}
+	if policy == nil || len(replicas) <= 1 {
+		return order
+	}
+
+	if policy.PreferServerGroup {
+		if group := b.localServerGroup(policy); group != "" {
+			sameGroup := func(n int) bool {
+				inst, ok := currmeta.insts[common.IndexInstId(replicas[n])]
+				if !ok {
+					return false
+				}
+				indexerId, ok := inst.IndexerId[partnId]
+				return ok && currmeta.serverGroups[indexerId] == group
+			}
+			same := make([]int, 0, len(order))
+			other := make([]int, 0, len(order))
+			for _, n := range order {
+				if sameGroup(n) {
+					same = append(same, n)
+				} else {
+					other = append(other, n)
+				}
+			}
+			order = append(same, other...)
+		}
+	}
+
+	return order
+}
+
+// latencyOrder samples `replicas` without replacement, with weight
+// inversely proportional to their average latency. Replicas not timed
+// yet get the largest weight, so that they are tried out. Ordering is
+// by replica and not by partition, to keep the partitions of a scan
+// on fewer indexers.
+func (b *metadataClient) latencyOrder(currmeta *indexTopology, replicas []uint64) []uint64 {
+
+	weights := make([]float64, len(replicas))
+	maxWeight := 0.0
+	for i, instId := range replicas {
+		if load, ok := currmeta.loads[common.IndexInstId(instId)]; ok {
+			if latency, ok := load.latency.avg(); ok && latency > 0 {
+				weights[i] = 1.0 / latency
+				if weights[i] > maxWeight {
+					maxWeight = weights[i]
+				}
+			}
+		}
+	}
+	if maxWeight == 0 {
+		maxWeight = 1.0
+	}
+
+	total := 0.0
+	for i := range weights {
+		if weights[i] == 0 {
+			weights[i] = maxWeight
+		}
+		total += weights[i]
+	}
+
+	order := make([]uint64, 0, len(replicas))
+	for len(order) < len(replicas) {
+		r := rand.Float64() * total
+		pick := -1
+		for i, w := range weights {
+			if w == 0 {
+				continue
+			}
+			pick = i
+			if r -= w; r < 0 {
+				break
+			}
+		}
+		order = append(order, replicas[pick])
+		total -= weights[pick]
+		weights[pick] = 0
+	}
+	return order
+}
+
+// localServerGroup is the server group of the query node.
+func (b *metadataClient) localServerGroup(policy *RoutingPolicy) string {
+	if policy.ServerGroup != "" {
+		return policy.ServerGroup
+	}
+	group, _ := b.serverGroup.Load().(string)
+	return group
+}
+
+// clusterServerGroup of this node from cluster membership, empty if
+// this node is not a member (e.g. client running outside the cluster).
+func clusterServerGroup(cinfo *common.ClusterInfoCache) (group string) {
+	defer func() {
+		if r := recover(); r != nil {
+			group = ""
+		}
+	}()
+	group, _ = cinfo.GetLocalServerGroup()
+	return group
+}
+
+// GetHedgeScanport implements BridgeAccessor{} interface.
+func (b *metadataClient) GetHedgeScanport(instId uint64, partitions []common.PartitionId) (queryport string,
+	targetInstId uint64, rollbackTime int64, delay time.Duration, ok bool) {
+
+	policy := b.settings.RoutingPolicy()
+	if policy == nil || !policy.Hedge || len(partitions) == 0 {
+		return "", 0, 0, 0, false
+	}
+
+	currmeta := (*indexTopology)(atomic.LoadPointer(&b.indexers))
+
+	inst, ok := currmeta.insts[common.IndexInstId(instId)]
+	if !ok {
+		return "", 0, 0, 0, false
+	}
+	load, ok := currmeta.loads[common.IndexInstId(instId)]
+	if !ok {
+		return "", 0, 0, 0, false
+	}
+	if delay, ok = load.latency.percentile(policy.HedgePercentile); !ok {
+		return "", 0, 0, 0, false
+	}
+	if delay < policy.HedgeMinDelay {
+		delay = policy.HedgeMinDelay
+	}
+
+	replicas := make([]uint64, 0, len(currmeta.replicas[inst.DefnId]))
+	for _, replicaId := range currmeta.replicas[inst.DefnId] {
+		if uint64(replicaId) != instId {
+			replicas = append(replicas, uint64(replicaId))
+		}
+	}
+	rand.Shuffle(len(replicas), func(i, j int) { replicas[i], replicas[j] = replicas[j], replicas[i] })
+	if policy.LatencyWeighted {
+		replicas = b.latencyOrder(currmeta, replicas)
+	}
+
+	// the replica must host all the partitions on one indexer.
+	for _, n := range b.routeReplicas(currmeta, replicas, partitions[0], policy) {
+		replica, ok := currmeta.insts[common.IndexInstId(replicas[n])]
+		if !ok {
+			continue
+		}
+		indexerId, ok := replica.IndexerId[partitions[0]]
+		for _, partnId := range partitions[1:] {
+			ok = ok && replica.IndexerId[partnId] == indexerId
+		}
+		if !ok {
+			continue
+		}
+		if queryport, ok = currmeta.queryports[indexerId]; !ok {
+			continue
+		}
+		if load, ok := currmeta.loads[replica.InstId]; ok {
+			rollbackTime = load.getStats().getRollbackTime(partitions[0])
+		}
+		return queryport, uint64(replica.InstId), rollbackTime, delay, true
+	}
+
+	return "", 0, 0, 0, false
+}
+
+//--------------------------------------
+// hedged scan
+//--------------------------------------
+
+// ReplicaHedger returns the scan client of another replica to hedge
+// the scan of `partitions` of index instance `instId` with, and the
+// delay after which the hedge request is to be sent.
+type ReplicaHedger func(instId uint64, partitions []common.PartitionId) (client *GsiScanClient,
+	targetInstId uint64, rollbackTime int64, delay time.Duration, ok bool)
+
+func (b *RequestBroker) SetReplicaHedger(hedger ReplicaHedger) {
+
+	b.hedger = hedger
+}
+
+const (
+	hedgePending int32 = iota
+	hedgePrimary
+	hedgeReplica
+)
+
+type hedgeStatus struct {
+	err     error
+	partial bool
+	who     int32
+}
+
+// Scan partitions through a single connection, hedged by a duplicate
+// request to another replica if the scan has not got its first response
+// within the hedge delay.  Rows are streamed from the request that
+// responds first, the other request is stopped on its first response.
+// It returns the instance that served the scan.
+func (c *RequestBroker) hedgedScan(id ResponseHandlerId, client *GsiScanClient, index *common.IndexDefn,
+	instId uint64, rollback int64, partition []common.PartitionId) (error, bool, uint64) {
+
+	hedgeClient, hedgeInstId, hedgeRollback, delay, ok := c.hedger(instId, partition)
+	if !ok || hedgeClient == nil {
+		err, partial := c.scan(client, index, rollback, partition, c.factory(id, instId, partition))
+		return err, partial, instId
+	}
+
+	winner := hedgePending
+	handlerFor := func(who int32, instId uint64) ResponseHandler {
+		var handler ResponseHandler
+		return func(resp ResponseReader) bool {
+			if handler == nil {
+				if !atomic.CompareAndSwapInt32(&winner, hedgePending, who) &&
+					atomic.LoadInt32(&winner) != who {
+					return false
+				}
+				// response handler is made only for the request that wins.
+				handler = c.factory(id, instId, partition)
+			}
+			return handler(resp)
+		}
+	}
+
+	donech := make(chan *hedgeStatus, 2)
+	run := func(who int32, client *GsiScanClient, instId uint64, rollback int64) {
+		err, partial := c.scan(client, index, rollback, partition, handlerFor(who, instId))
+		donech <- &hedgeStatus{err: err, partial: partial, who: who}
+	}
+
+	go run(hedgePrimary, client, instId, rollback)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case status := <-donech:
+		return status.err, status.partial, instId
+	case <-timer.C:
+	}
+
+	if atomic.LoadInt32(&winner) == hedgePrimary {
+		status := <-donech
+		return status.err, status.partial, instId
+	}
+
+	logging.Verbosef("scatter: requestId %v hedge inst %v with inst %v partition %v after %v",
+		c.requestId, instId, hedgeInstId, partition, delay)
+	go run(hedgeReplica, hedgeClient, hedgeInstId, hedgeRollback)
+
+	// wait for the request that won, or both if neither got a response.
+	var status *hedgeStatus
+	for i := 0; i < 2; i++ {
+		status = <-donech
+		if atomic.LoadInt32(&winner) == status.who {
+			break
+		}
+	}
+	if status.who == hedgeReplica {
+		return status.err, status.partial, hedgeInstId
+	}
+	return status.err, status.partial, instId
+}
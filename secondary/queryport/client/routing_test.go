@@ -0,0 +1,355 @@
+package client
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	common "github.com/couchbase/indexing/secondary/common"
+	mclient "github.com/couchbase/indexing/secondary/manager/client"
+)
+
+func TestReplicaLatencyPercentile(t *testing.T) {
+	l := newReplicaLatency(1)
+
+	for i := 1; i < minHedgeSamples; i++ {
+		l.update(common.PartitionId(0), float64(i), 0.5)
+	}
+	if _, ok := l.percentile(90); ok {
+		t.Errorf("expected no percentile with %v scans", minHedgeSamples-1)
+	}
+
+	for i := minHedgeSamples; i <= 100; i++ {
+		l.update(common.PartitionId(0), float64(i), 0.5)
+	}
+	testcases := []struct {
+		p     float64
+		delay time.Duration
+	}{
+		{0, 1},
+		{1, 1},
+		{50, 50},
+		{90, 90},
+		{99.5, 100},
+		{100, 100},
+	}
+	for _, tc := range testcases {
+		if delay, ok := l.percentile(tc.p); !ok || delay != tc.delay {
+			t.Errorf("p%v: expected %v, got %v %v", tc.p, tc.delay, delay, ok)
+		}
+	}
+
+	// only the recent scans are kept.
+	for i := 101; i <= 200; i++ {
+		l.update(common.PartitionId(0), float64(i), 0.5)
+	}
+	if delay, _ := l.percentile(0); delay != time.Duration(200-latencyWindow+1) {
+		t.Errorf("expected %v, got %v", 200-latencyWindow+1, delay)
+	}
+	if delay, _ := l.percentile(100); delay != 200 {
+		t.Errorf("expected 200, got %v", delay)
+	}
+
+	// partition out of range is ignored.
+	l.update(common.PartitionId(5), 1000, 0.5)
+	if delay, _ := l.percentile(100); delay != 200 {
+		t.Errorf("expected 200, got %v", delay)
+	}
+}
+
+func TestLatencyOrder(t *testing.T) {
+	currmeta := &indexTopology{loads: make(map[common.IndexInstId]*loadHeuristics)}
+	timed := func(instId uint64, latency float64) {
+		load := newLoadHeuristics(1)
+		load.latency.update(common.PartitionId(0), latency, 1.0)
+		currmeta.loads[common.IndexInstId(instId)] = load
+	}
+	timed(1, 1000) // fast
+	timed(2, 1000000)
+	timed(3, 1000000)
+	// replica 4 is not timed
+
+	b := &metadataClient{}
+	first := make(map[uint64]int)
+	untimed, slow := 0, 0
+	for i := 0; i < 1000; i++ {
+		replicas := []uint64{2, 3, 1}
+		order := b.latencyOrder(currmeta, replicas)
+
+		seen := make(map[uint64]bool)
+		for _, instId := range order {
+			seen[instId] = true
+		}
+		if len(order) != 3 || len(seen) != 3 || !seen[1] || !seen[2] || !seen[3] {
+			t.Fatalf("expected a permutation of replicas, got %v", order)
+		}
+		first[order[0]]++
+
+		// replica not timed yet is tried out like the fastest one.
+		order = b.latencyOrder(currmeta, []uint64{2, 4, 1})
+		if order[0] == 4 {
+			untimed++
+		} else if order[0] == 2 {
+			slow++
+		}
+	}
+
+	if first[1] < 950 {
+		t.Errorf("expected fast replica first most of the times, got %v/1000", first[1])
+	}
+	if untimed < 350 || slow > 50 {
+		t.Errorf("expected replica not timed first as often as the fast one, got %v/1000, "+
+			"slow one %v/1000", untimed, slow)
+	}
+
+	if order := b.latencyOrder(currmeta, []uint64{5, 6}); len(order) != 2 {
+		t.Errorf("expected replicas without load to be ordered, got %v", order)
+	}
+}
+
+func TestRouteReplicas(t *testing.T) {
+	partnId := common.PartitionId(1)
+	currmeta := &indexTopology{
+		insts: map[common.IndexInstId]*mclient.InstanceDefn{
+			1: {InstId: 1, IndexerId: map[common.PartitionId]common.IndexerId{partnId: "n1"}},
+			2: {InstId: 2, IndexerId: map[common.PartitionId]common.IndexerId{partnId: "n2"}},
+			3: {InstId: 3, IndexerId: map[common.PartitionId]common.IndexerId{partnId: "n3"}},
+			4: {InstId: 4, IndexerId: map[common.PartitionId]common.IndexerId{partnId: "n4"}},
+			// partition on another indexer
+			5: {InstId: 5, IndexerId: map[common.PartitionId]common.IndexerId{2: "n2"}},
+		},
+		serverGroups: map[common.IndexerId]string{
+			"n1": "g1",
+			"n2": "g2",
+			"n3": "g1",
+			"n4": "g2",
+		},
+	}
+	replicas := []uint64{1, 2, 5, 3, 6, 4}
+
+	b := &metadataClient{}
+	b.serverGroup.Store("g2")
+
+	testcases := []struct {
+		name   string
+		policy *RoutingPolicy
+		order  []int
+	}{
+		{"no policy", nil, []int{0, 1, 2, 3, 4, 5}},
+		{"no preference", &RoutingPolicy{ServerGroup: "g1"}, []int{0, 1, 2, 3, 4, 5}},
+		{"policy group", &RoutingPolicy{PreferServerGroup: true, ServerGroup: "g1"}, []int{0, 3, 1, 2, 4, 5}},
+		{"cluster group", &RoutingPolicy{PreferServerGroup: true}, []int{1, 5, 0, 2, 3, 4}},
+		{"unknown group", &RoutingPolicy{PreferServerGroup: true, ServerGroup: "g3"}, []int{0, 1, 2, 3, 4, 5}},
+	}
+	for _, tc := range testcases {
+		if order := b.routeReplicas(currmeta, replicas, partnId, tc.policy); !reflect.DeepEqual(order, tc.order) {
+			t.Errorf("%v: expected %v, got %v", tc.name, tc.order, order)
+		}
+	}
+
+	// server group of query node is not known.
+	b = &metadataClient{}
+	policy := &RoutingPolicy{PreferServerGroup: true}
+	if order := b.routeReplicas(currmeta, replicas, partnId, policy); !reflect.DeepEqual(order, []int{0, 1, 2, 3, 4, 5}) {
+		t.Errorf("expected order of replicas, got %v", order)
+	}
+}
+
+// hedgeTestScan scripts the scan of a client, `respond` sends the first
+// response to the handler, `done` ends the scan with an error.
+type hedgeTestScan struct {
+	started chan bool
+	respond chan bool
+	done    chan error
+	handled chan bool // result of the first response
+}
+
+func newHedgeTestScan() *hedgeTestScan {
+	return &hedgeTestScan{
+		started: make(chan bool),
+		respond: make(chan bool),
+		done:    make(chan error),
+		handled: make(chan bool, 1),
+	}
+}
+
+func (s *hedgeTestScan) scan(handler ResponseHandler) (error, bool) {
+	close(s.started)
+	for {
+		select {
+		case <-s.respond:
+			s.handled <- handler(nil)
+		case err := <-s.done:
+			return err, false
+		}
+	}
+}
+
+// hedgeTestBroker hedges scans of instance 1 with instance 2, after
+// `delay`.
+func hedgeTestBroker(delay time.Duration, primary, replica *hedgeTestScan,
+	handlers chan uint64) *RequestBroker {
+
+	replicaClient := &GsiScanClient{}
+
+	broker := NewRequestBroker("hedge", 10, 1)
+	broker.SetScanRequestHandler(func(client *GsiScanClient, index *common.IndexDefn,
+		rollback int64, partitions []common.PartitionId, handler ResponseHandler) (error, bool) {
+
+		if client == replicaClient {
+			return replica.scan(handler)
+		}
+		return primary.scan(handler)
+	})
+	broker.SetResponseHandlerFactory(func(id ResponseHandlerId, instId uint64,
+		partitions []common.PartitionId) ResponseHandler {
+
+		handlers <- instId
+		return func(resp ResponseReader) bool { return true }
+	})
+	broker.SetReplicaHedger(func(instId uint64, partitions []common.PartitionId) (*GsiScanClient,
+		uint64, int64, time.Duration, bool) {
+
+		return replicaClient, 2, 0, delay, true
+	})
+
+	return broker
+}
+
+type hedgeResult struct {
+	err    error
+	instId uint64
+}
+
+func runHedgedScan(broker *RequestBroker) chan hedgeResult {
+	resultch := make(chan hedgeResult, 1)
+	go func() {
+		err, _, instId := broker.hedgedScan(ResponseHandlerId(0), &GsiScanClient{}, &common.IndexDefn{},
+			1, 0, []common.PartitionId{0})
+		resultch <- hedgeResult{err, instId}
+	}()
+	return resultch
+}
+
+func TestHedgedScan(t *testing.T) {
+	scanErr := errors.New("scan error")
+
+	expectHandled := func(name string, s *hedgeTestScan, handled bool) {
+		if h := <-s.handled; h != handled {
+			t.Errorf("%v: expected response handled %v, got %v", name, handled, h)
+		}
+	}
+	expectResult := func(name string, resultch chan hedgeResult, err error, instId uint64) {
+		if result := <-resultch; result.err != err || result.instId != instId {
+			t.Errorf("%v: expected %v from %v, got %v from %v", name, err, instId,
+				result.err, result.instId)
+		}
+	}
+	expectHandlers := func(name string, handlers chan uint64, instIds ...uint64) {
+		close(handlers)
+		var got []uint64
+		for instId := range handlers {
+			got = append(got, instId)
+		}
+		if len(got) != len(instIds) || (len(got) > 0 && !reflect.DeepEqual(got, instIds)) {
+			t.Errorf("%v: expected handlers for %v, got %v", name, instIds, got)
+		}
+	}
+
+	// primary responds within the delay, no hedge request.
+	{
+		name := "primary wins"
+		primary, replica := newHedgeTestScan(), newHedgeTestScan()
+		handlers := make(chan uint64, 2)
+		broker := hedgeTestBroker(time.Hour, primary, replica, handlers)
+		resultch := runHedgedScan(broker)
+		primary.respond <- true
+		expectHandled(name, primary, true)
+		primary.done <- nil
+		expectResult(name, resultch, nil, 1)
+		expectHandlers(name, handlers, 1)
+	}
+
+	// primary errors within the delay, error is returned without hedging.
+	{
+		name := "primary errors"
+		primary, replica := newHedgeTestScan(), newHedgeTestScan()
+		handlers := make(chan uint64, 2)
+		broker := hedgeTestBroker(time.Hour, primary, replica, handlers)
+		resultch := runHedgedScan(broker)
+		primary.done <- scanErr
+		expectResult(name, resultch, scanErr, 1)
+		expectHandlers(name, handlers)
+	}
+
+	// replica responds first, primary is stopped on its first response.
+	{
+		name := "replica wins"
+		primary, replica := newHedgeTestScan(), newHedgeTestScan()
+		handlers := make(chan uint64, 2)
+		broker := hedgeTestBroker(time.Millisecond, primary, replica, handlers)
+		resultch := runHedgedScan(broker)
+		<-replica.started
+		replica.respond <- true
+		expectHandled(name, replica, true)
+		primary.respond <- true
+		expectHandled(name, primary, false)
+		primary.done <- nil
+		replica.done <- nil
+		expectResult(name, resultch, nil, 2)
+		expectHandlers(name, handlers, 2)
+	}
+
+	// primary responds after the hedge request was sent, but before
+	// the replica, replica is stopped on its first response.
+	{
+		name := "primary wins late"
+		primary, replica := newHedgeTestScan(), newHedgeTestScan()
+		handlers := make(chan uint64, 2)
+		broker := hedgeTestBroker(time.Millisecond, primary, replica, handlers)
+		resultch := runHedgedScan(broker)
+		<-replica.started
+		primary.respond <- true
+		expectHandled(name, primary, true)
+		replica.respond <- true
+		expectHandled(name, replica, false)
+		replica.done <- scanErr
+		primary.done <- nil
+		expectResult(name, resultch, nil, 1)
+		expectHandlers(name, handlers, 1)
+	}
+
+	// primary errors after the hedge request was sent, replica serves
+	// the scan.
+	{
+		name := "primary errors late"
+		primary, replica := newHedgeTestScan(), newHedgeTestScan()
+		handlers := make(chan uint64, 2)
+		broker := hedgeTestBroker(time.Millisecond, primary, replica, handlers)
+		resultch := runHedgedScan(broker)
+		<-replica.started
+		primary.done <- scanErr
+		replica.respond <- true
+		expectHandled(name, replica, true)
+		replica.done <- nil
+		expectResult(name, resultch, nil, 2)
+		expectHandlers(name, handlers, 2)
+	}
+
+	// neither responds, error of either is returned.
+	{
+		name := "both error"
+		primary, replica := newHedgeTestScan(), newHedgeTestScan()
+		handlers := make(chan uint64, 2)
+		broker := hedgeTestBroker(time.Millisecond, primary, replica, handlers)
+		resultch := runHedgedScan(broker)
+		<-replica.started
+		primary.done <- scanErr
+		replica.done <- errors.New("replica error")
+		if result := <-resultch; result.err == nil {
+			t.Errorf("%v: expected error", name)
+		}
+		expectHandlers(name, handlers)
+	}
+}
@@ -39,6 +39,7 @@ type GsiScanClient struct {
 	logPrefix          string
 	minPoolSizeWM      int32
 	relConnBatchSize   int32
+	compression        byte
 
 	serverVersion uint32
 }
@@ -58,6 +59,12 @@ func NewGsiScanClient(queryport string, config common.Config) (*GsiScanClient, e
 		minPoolSizeWM:      int32(config["settings.minPoolSizeWM"].Int()),
 		relConnBatchSize:   int32(config["settings.relConnBatchSize"].Int()),
 	}
+	compression, err := transport.CompressionFromString(config["compression"].String())
+	if err != nil {
+		fmsg := "%v invalid compression %q, using none\n"
+		logging.Errorf(fmsg, c.logPrefix, config["compression"].String())
+	}
+	c.compression = compression
 	c.pool = newConnectionPool(
 		queryport, c.poolSize, c.poolOverflow, c.maxPayload, c.cpTimeout,
 		c.cpAvailWaitTimeout, c.minPoolSizeWM, c.relConnBatchSize)
@@ -97,9 +104,27 @@ func (c *GsiScanClient) Helo() (uint32, error) {
 		return 0, err
 	}
 	heloResp := resp.(*protobuf.HeloResponse)
+	c.negotiateCompression(heloResp.GetCompressions())
 	return heloResp.GetVersion(), nil
 }
 
+// negotiateCompression for new connections, use the configured compression
+// only if server accepts it.
+func (c *GsiScanClient) negotiateCompression(compressions []uint32) {
+	compression := transport.CompressionNone
+	for _, accepted := range compressions {
+		if byte(accepted) == c.compression {
+			compression = c.compression
+			break
+		}
+	}
+	if compression != c.pool.getCompression() {
+		fmsg := "%v using %v compression for new connections\n"
+		logging.Infof(fmsg, c.logPrefix, transport.CompressionString(compression))
+		c.pool.setCompression(compression)
+	}
+}
+
 // LookupStatistics for a single secondary-key.
 func (c *GsiScanClient) LookupStatistics(
 	defnID uint64, value common.SecondaryKey) (common.IndexStatistics, error) {
@@ -160,6 +185,62 @@ func (c *GsiScanClient) RangeStatistics(
 	return statResp.GetStats(), nil
 }
 
+// Statistics on index keys within `span`, for a subset of partitions.
+func (c *GsiScanClient) Statistics(
+	defnID uint64, requestId string, span *protobuf.Span,
+	partitions []common.PartitionId) (*protobuf.IndexStatistics, error) {
+
+	partnIds := make([]uint64, len(partitions))
+	for i, partnId := range partitions {
+		partnIds[i] = uint64(partnId)
+	}
+
+	req := &protobuf.StatisticsRequest{
+		DefnID:       proto.Uint64(defnID),
+		RequestId:    proto.String(requestId),
+		Span:         span,
+		PartitionIds: partnIds,
+	}
+	resp, err := c.doRequestResponse(req, requestId, true)
+	if err != nil {
+		return nil, err
+	}
+	statResp := resp.(*protobuf.StatisticsResponse)
+	if statResp.GetErr() != nil {
+		err = errors.New(statResp.GetErr().GetError())
+		return nil, err
+	}
+	return statResp.GetStats(), nil
+}
+
+// LeadKeyHistogram of the leading key of an index, for partitions
+// hosted by the indexer node.
+func (c *GsiScanClient) LeadKeyHistogram(
+	defnID uint64, requestId string,
+	partitions []common.PartitionId) (*protobuf.IndexStatistics, error) {
+
+	partnIds := make([]uint64, len(partitions))
+	for i, partnId := range partitions {
+		partnIds[i] = uint64(partnId)
+	}
+
+	req := &protobuf.LeadKeyHistogramRequest{
+		DefnID:       proto.Uint64(defnID),
+		RequestId:    proto.String(requestId),
+		PartitionIds: partnIds,
+	}
+	resp, err := c.doRequestResponse(req, requestId, true)
+	if err != nil {
+		return nil, err
+	}
+	statResp := resp.(*protobuf.StatisticsResponse)
+	if statResp.GetErr() != nil {
+		err = errors.New(statResp.GetErr().GetError())
+		return nil, err
+	}
+	return statResp.GetStats(), nil
+}
+
 // Lookup scan index between low and high.
 func (c *GsiScanClient) Lookup(
 	defnID uint64, requestId string, values []common.SecondaryKey,
@@ -385,6 +466,36 @@ func (c *GsiScanClient) ScanAll(
 	return c.doStreamingWithRetry(requestId, req, callb, "ScanAll", retry)
 }
 
+// DocIdLookup reads index entries of documents `docids` from the
+// back-index, at a snapshot satisfying `cons`.
+func (c *GsiScanClient) DocIdLookup(
+	defnID uint64, requestId string, docids [][]byte,
+	cons common.Consistency, vector *TsConsistency,
+	callb ResponseHandler, rollbackTime int64, partitions []common.PartitionId,
+	dataEncFmt common.DataEncodingFormat, retry bool) (error, bool) {
+
+	partnIds := make([]uint64, len(partitions))
+	for i, partnId := range partitions {
+		partnIds[i] = uint64(partnId)
+	}
+
+	req := &protobuf.DocIdLookupRequest{
+		DefnID:       proto.Uint64(defnID),
+		RequestId:    proto.String(requestId),
+		DocIds:       docids,
+		Cons:         proto.Uint32(uint32(cons)),
+		RollbackTime: proto.Int64(rollbackTime),
+		PartitionIds: partnIds,
+		DataEncFmt:   proto.Uint32(uint32(dataEncFmt)),
+	}
+	if vector != nil {
+		req.Vector = protobuf.NewTsConsistency(
+			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+	}
+
+	return c.doStreamingWithRetry(requestId, req, callb, "DocIdLookup", retry)
+}
+
 func (c *GsiScanClient) MultiScan(
 	defnID uint64, requestId string, scans Scans,
 	reverse, distinct bool, projection *IndexProjection, offset, limit int64,
@@ -758,7 +869,8 @@ func (c *GsiScanClient) CountRangePrimary(
 
 func (c *GsiScanClient) MultiScanCount(
 	defnID uint64, requestId string, scans Scans, distinct bool,
-	cons common.Consistency, vector *TsConsistency, rollbackTime int64, partitions []common.PartitionId, retry bool) (int64, error) {
+	cons common.Consistency, vector *TsConsistency, rollbackTime int64, partitions []common.PartitionId,
+	snapshotId uint64, retry bool) (int64, error) {
 
 	// serialize scans
 	protoScans := make([]*protobuf.Scan, len(scans))
@@ -835,6 +947,10 @@ func (c *GsiScanClient) MultiScanCount(
 			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
 	}
 
+	if snapshotId != 0 {
+		req.SnapshotId = proto.Uint64(snapshotId)
+	}
+
 	resp, err := c.doRequestResponse(req, requestId, retry)
 	if err != nil {
 		return 0, err
@@ -849,7 +965,8 @@ func (c *GsiScanClient) MultiScanCount(
 
 func (c *GsiScanClient) MultiScanCountPrimary(
 	defnID uint64, requestId string, scans Scans, distinct bool,
-	cons common.Consistency, vector *TsConsistency, rollbackTime int64, partitions []common.PartitionId, retry bool) (int64, error) {
+	cons common.Consistency, vector *TsConsistency, rollbackTime int64, partitions []common.PartitionId,
+	snapshotId uint64, retry bool) (int64, error) {
 
 	var what string
 	// serialize scans
@@ -933,6 +1050,10 @@ func (c *GsiScanClient) MultiScanCountPrimary(
 			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
 	}
 
+	if snapshotId != 0 {
+		req.SnapshotId = proto.Uint64(snapshotId)
+	}
+
 	resp, err := c.doRequestResponse(req, requestId, retry)
 	if err != nil {
 		return 0, err
@@ -951,7 +1072,8 @@ func (c *GsiScanClient) Scan3(
 	groupAggr *GroupAggr, sorted bool,
 	cons common.Consistency, vector *TsConsistency,
 	callb ResponseHandler, rollbackTime int64, partitions []common.PartitionId,
-	dataEncFmt common.DataEncodingFormat, retry bool) (error, bool) {
+	dataEncFmt common.DataEncodingFormat, snapshotId uint64, profile bool,
+	retry bool) (error, bool) {
 
 	// serialize scans
 	protoScans := make([]*protobuf.Scan, len(scans))
@@ -1036,6 +1158,8 @@ func (c *GsiScanClient) Scan3(
 				KeyPos:     proto.Int32(aggr.KeyPos),
 				Expr:       []byte(aggr.Expr),
 				Distinct:   proto.Bool(aggr.Distinct),
+				Limit:      proto.Int64(aggr.Limit),
+				Quantile:   proto.Float64(aggr.Quantile),
 			}
 			protoAggregates[i] = ag
 		}
@@ -1051,6 +1175,7 @@ func (c *GsiScanClient) Scan3(
 			IndexKeyNames:      protoIndexKeyNames,
 			AllowPartialAggr:   proto.Bool(groupAggr.AllowPartialAggr),
 			OnePerPrimaryKey:   proto.Bool(groupAggr.OnePerPrimaryKey),
+			PartialAggrState:   proto.Bool(groupAggr.PartialAggrState),
 		}
 	}
 
@@ -1083,6 +1208,13 @@ func (c *GsiScanClient) Scan3(
 			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
 	}
 
+	if snapshotId != 0 {
+		req.SnapshotId = proto.Uint64(snapshotId)
+	}
+	if profile {
+		req.Profile = proto.Bool(true)
+	}
+
 	return c.doStreamingWithRetry(requestId, req, callb, "Scan3", retry)
 }
 
@@ -1092,7 +1224,8 @@ func (c *GsiScanClient) Scan3Primary(
 	groupAggr *GroupAggr, sorted bool,
 	cons common.Consistency, vector *TsConsistency,
 	callb ResponseHandler, rollbackTime int64, partitions []common.PartitionId,
-	dataEncFmt common.DataEncodingFormat, retry bool) (error, bool) {
+	dataEncFmt common.DataEncodingFormat, snapshotId uint64, profile bool,
+	retry bool) (error, bool) {
 
 	var what string
 	// serialize scans
@@ -1183,6 +1316,8 @@ func (c *GsiScanClient) Scan3Primary(
 				KeyPos:     proto.Int32(aggr.KeyPos),
 				Expr:       []byte(aggr.Expr),
 				Distinct:   proto.Bool(aggr.Distinct),
+				Limit:      proto.Int64(aggr.Limit),
+				Quantile:   proto.Float64(aggr.Quantile),
 			}
 			protoAggregates[i] = ag
 		}
@@ -1228,9 +1363,80 @@ func (c *GsiScanClient) Scan3Primary(
 			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
 	}
 
+	if snapshotId != 0 {
+		req.SnapshotId = proto.Uint64(snapshotId)
+	}
+	if profile {
+		req.Profile = proto.Bool(true)
+	}
+
 	return c.doStreamingWithRetry(requestId, req, callb, "Scan3Primary", retry)
 }
 
+// OpenSnapshot pins an index snapshot on the indexer, satisfying the
+// requested consistency, and returns its id along with the lease granted by
+// the indexer. The lease is renewed every time the snapshot is scanned.
+func (c *GsiScanClient) OpenSnapshot(
+	defnID uint64, requestId string, cons common.Consistency,
+	vector *TsConsistency, leaseTime time.Duration, rollbackTime int64,
+	partitions []common.PartitionId, retry bool) (uint64, time.Duration, error) {
+
+	partnIds := make([]uint64, len(partitions))
+	for i, partnId := range partitions {
+		partnIds[i] = uint64(partnId)
+	}
+
+	req := &protobuf.OpenSnapshotRequest{
+		DefnID:       proto.Uint64(defnID),
+		RequestId:    proto.String(requestId),
+		Cons:         proto.Uint32(uint32(cons)),
+		RollbackTime: proto.Int64(rollbackTime),
+		PartitionIds: partnIds,
+		LeaseTime:    proto.Int64(int64(leaseTime / time.Millisecond)),
+	}
+	if vector != nil {
+		req.Vector = protobuf.NewTsConsistency(
+			vector.Vbnos, vector.Seqnos, vector.Vbuuids, vector.Crc64)
+	}
+
+	resp, err := c.doRequestResponse(req, requestId, retry)
+	if err != nil {
+		return 0, 0, err
+	}
+	openResp, ok := resp.(*protobuf.OpenSnapshotResponse)
+	if !ok {
+		return 0, 0, ErrorProtocol
+	} else if openResp.GetErr() != nil {
+		err = errors.New(openResp.GetErr().GetError())
+		return 0, 0, err
+	}
+	lease := time.Duration(openResp.GetLeaseTime()) * time.Millisecond
+	return openResp.GetSnapshotId(), lease, nil
+}
+
+// CloseSnapshot releases a snapshot pinned by OpenSnapshot.
+func (c *GsiScanClient) CloseSnapshot(
+	defnID, snapshotId uint64, requestId string, retry bool) error {
+
+	req := &protobuf.CloseSnapshotRequest{
+		SnapshotId: proto.Uint64(snapshotId),
+		RequestId:  proto.String(requestId),
+		DefnID:     proto.Uint64(defnID),
+	}
+
+	resp, err := c.doRequestResponse(req, requestId, retry)
+	if err != nil {
+		return err
+	}
+	closeResp, ok := resp.(*protobuf.CloseSnapshotResponse)
+	if !ok {
+		return ErrorProtocol
+	} else if closeResp.GetErr() != nil {
+		return errors.New(closeResp.GetErr().GetError())
+	}
+	return nil
+}
+
 func (c *GsiScanClient) Close() error {
 	return c.pool.Close()
 }
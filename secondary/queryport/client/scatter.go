@@ -16,6 +16,7 @@ import (
 	"reflect"
 	"strings"
 
+	"github.com/couchbase/indexing/secondary/collatejson"
 	"github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/logging"
 	"github.com/couchbase/query/value"
@@ -83,6 +84,8 @@ type RequestBroker struct {
 	sender  ResponseSender
 	timer   ResponseTimer
 	waiter  BackfillWaiter
+	profile ProfileHandler
+	hedger  ReplicaHedger
 
 	// initialization
 	requestId   string
@@ -113,9 +116,12 @@ type RequestBroker struct {
 	pushdownSorted bool
 	scans          Scans
 	grpAggr        *GroupAggr
+	pushdownAggr   *GroupAggr
+	mergeAggrs     bool
 	projections    *IndexProjection
 	indexOrder     *IndexKeyOrder
 	projDesc       []bool
+	projColl       []collatejson.Collator
 	distinct       bool
 
 	// Additional key positions (not in projection list) added due to
@@ -288,6 +294,14 @@ func (b *RequestBroker) SetGroupAggr(grpAggr *GroupAggr) {
 	b.grpAggr = grpAggr
 }
 
+//
+// Get GroupAggr
+//
+func (b *RequestBroker) GetGroupAggr() *GroupAggr {
+
+	return b.pushdownAggr
+}
+
 //
 // Set Projection
 // Also reset indexOrderPosPruneMap. There should be analyzeOrderBy invoked
@@ -308,6 +322,31 @@ func (b *RequestBroker) SetIndexOrder(indexOrder *IndexKeyOrder) {
 	b.indexOrder = indexOrder
 }
 
+//
+// Profile
+//
+func (b *RequestBroker) SetProfileHandler(handler ProfileHandler) {
+	b.profile = handler
+}
+
+// GetProfile returns true if indexers shall return the execution
+// profile of scans.
+func (b *RequestBroker) GetProfile() bool {
+	return b.profile != nil
+}
+
+// Profile forwards the execution profile received from an indexer.
+func (b *RequestBroker) Profile(resp ResponseReader, instId uint64, partitions []common.PartitionId) {
+	if b.profile == nil {
+		return
+	}
+	if pr, ok := resp.(ProfileReader); ok {
+		if profile := pr.GetProfile(); len(profile) != 0 {
+			b.profile(instId, partitions, profile)
+		}
+	}
+}
+
 //
 // Retry
 //
@@ -534,7 +573,10 @@ func (b *RequestBroker) reset() {
 	b.pushdownLimit = b.limit
 	b.pushdownOffset = b.offset
 	b.pushdownSorted = b.sorted
+	b.pushdownAggr = b.grpAggr
+	b.mergeAggrs = false
 	b.projDesc = nil
+	b.projColl = nil
 }
 
 //--------------------------
@@ -572,7 +614,10 @@ func (c *RequestBroker) scatter(clientMaker scanClientMaker, index *common.Index
 
 	c.analyzeOrderBy(partition, numPartition, index)
 	c.analyzeProjection(partition, numPartition, index)
-	c.changePushdownParams(partition, numPartition, index)
+	if e := c.changePushdownParams(partition, numPartition, index); e != nil {
+		logging.Errorf("scatter: requestId %v %v", c.requestId, e)
+		return 0, c.makeErrorMap(targetInstId, partition, e), false, false
+	}
 
 	if len(partition) == len(client) {
 		for i, partitions := range partition {
@@ -699,7 +744,7 @@ func (c *RequestBroker) scatterScan(client []*GsiScanClient, index *common.Index
 	c.notifych = make(chan bool, 1)
 	donech_gather := make(chan bool, 1)
 
-	if len(partition) > 1 {
+	if len(partition) > 1 || c.mergeAggrs {
 		c.bGather = true
 	}
 
@@ -720,7 +765,9 @@ func (c *RequestBroker) scatterScan(client []*GsiScanClient, index *common.Index
 			c.queues[i] = NewQueue(int64(size), c.notifych)
 		}
 
-		if c.sorted {
+		if c.mergeAggrs {
+			go c.mergeAggregates(donech_gather, targetInstId, partition)
+		} else if c.sorted {
 			go c.gather(donech_gather)
 		} else {
 			go c.forward(donech_gather)
@@ -758,7 +805,7 @@ func (c *RequestBroker) scatterScan2(client []*GsiScanClient, index *common.Inde
 	c.notifych = make(chan bool, 1)
 	donech_gather := make(chan bool, 1)
 
-	if len(partition) > 1 {
+	if len(partition) > 1 || c.mergeAggrs {
 		c.bGather = true
 	}
 
@@ -791,7 +838,9 @@ func (c *RequestBroker) scatterScan2(client []*GsiScanClient, index *common.Inde
 		// 1) scan is finished (done() method is called)
 		// 2) there is an error (Error() method is called)
 		// The gather routine could exit before all scatter routines have exited
-		if c.sorted {
+		if c.mergeAggrs {
+			c.mergeAggregates(donech_gather, targetInstId, partition)
+		} else if c.sorted {
 			c.gather(donech_gather)
 		} else {
 			c.forward(donech_gather)
@@ -1177,6 +1226,298 @@ func (c *RequestBroker) forward(donech chan bool) {
 	}
 }
 
+//
+// Gather partial aggregates from multiple connections and merge them.
+// The merged rows are sent after all indexers have returned their rows.
+//
+func (c *RequestBroker) mergeAggregates(donech chan bool, instIds []uint64, partitions [][]common.PartitionId) {
+
+	size := len(c.queues)
+	rows := make([]Row, size)
+
+	defer close(donech)
+
+	merger := newAggrMerger(c.grpAggr, c.projections)
+
+	for {
+		if c.IsClose() {
+			return
+		}
+
+		count := 0
+		found := false
+		for i := 0; i < size; i++ {
+			if c.queues[i].Peek(&rows[i]) {
+
+				if rows[i].last {
+					count++
+					continue
+				}
+
+				found = true
+
+				if c.queues[i].Dequeue(&rows[i]) {
+					if err := merger.add(rows[i].value); err != nil {
+						logging.Errorf("scatter: requestId %v fail to merge aggregates. Error: %v", c.requestId, err)
+						c.Error(err, instIds[i], partitions[i])
+						return
+					}
+				}
+			}
+		}
+
+		if count == size {
+			c.sendMergedAggregates(merger)
+			c.done()
+			return
+		}
+
+		if !found {
+			select {
+			case <-c.notifych:
+				continue
+			case <-c.killch:
+				return
+			}
+		}
+	}
+}
+
+func (c *RequestBroker) sendMergedAggregates(merger *aggrMerger) {
+
+	rows := merger.result()
+	if c.sorted {
+		sort.Stable(&aggrRows{rows: rows, broker: c})
+	}
+
+	var curOffset int64 = 0
+	var curLimit int64 = 0
+
+	var cont bool
+	var retBuf *[]byte
+
+	tmpbuf, tmpbufPoolIdx := GetFromPools()
+	defer func() {
+		PutInPools(tmpbuf, tmpbufPoolIdx)
+	}()
+
+	for _, row := range rows {
+
+		// skip offset
+		if curOffset < c.offset {
+			curOffset++
+			continue
+		}
+
+		curLimit++
+		c.Partial(true)
+
+		prunedRow := c.pruneOrderByProjections(row)
+		skey, err := c.makeScanResultKey(prunedRow)
+		if err != nil {
+			logging.Errorf("scatter: requestId %v fail to encode merged aggregates. Error: %v", c.requestId, err)
+			return
+		}
+		cont, retBuf = c.sender(nil, prunedRow, skey, tmpbuf)
+		if retBuf != nil {
+			tmpbuf = retBuf
+		}
+		if !cont {
+			return
+		}
+
+		// reaching limit
+		if curLimit >= c.limit {
+			return
+		}
+	}
+}
+
+func (c *RequestBroker) makeScanResultKey(vals value.Values) (common.ScanResultKey, error) {
+
+	dataEncFmt := c.GetDataEncodingFormat()
+	skey := common.ScanResultKey{DataEncFmt: dataEncFmt}
+
+	encoded := make([][]byte, len(vals))
+	for i, val := range vals {
+		bs, err := val.MarshalJSON()
+		if err != nil {
+			return skey, err
+		}
+		encoded[i] = bs
+	}
+	text := append(append([]byte("["), bytes.Join(encoded, []byte(","))...), ']')
+
+	if dataEncFmt == common.DATA_ENC_JSON {
+		err := json.Unmarshal(text, &skey.Skey)
+		return skey, err
+	}
+
+	buf := make([]byte, 0, 3*len(text)+collatejson.MinBufferSize)
+	code, err := collatejson.NewCodec(16).Encode(text, buf)
+	skey.Skeycjson = code
+	return skey, err
+}
+
+//
+// aggrMerger merges rows of partial aggregates by group.  Each
+// projected column of a row is either a group key or an aggregate.
+//
+type aggrMerger struct {
+	columns  []*Aggregate // nil for group key
+	finalize bool
+
+	groups map[string]*mergedRow
+	order  []*mergedRow
+}
+
+type mergedRow struct {
+	vals  value.Values
+	aggrs []common.AggrFunc
+}
+
+func newAggrMerger(grpAggr *GroupAggr, projection *IndexProjection) *aggrMerger {
+
+	m := &aggrMerger{
+		columns:  make([]*Aggregate, len(projection.EntryKeys)),
+		finalize: !grpAggr.PartialAggrState,
+		groups:   make(map[string]*mergedRow),
+	}
+
+	for i, entryId := range projection.EntryKeys {
+		for _, aggr := range grpAggr.Aggrs {
+			if entryId == int64(aggr.EntryKeyId) {
+				m.columns[i] = aggr
+				break
+			}
+		}
+	}
+
+	return m
+}
+
+func (m *aggrMerger) add(vals value.Values) error {
+
+	var key bytes.Buffer
+	for i, aggr := range m.columns {
+		if aggr == nil && i < len(vals) {
+			bs, err := vals[i].MarshalJSON()
+			if err != nil {
+				return err
+			}
+			key.Write(bs)
+			key.WriteByte(0)
+		}
+	}
+
+	row, ok := m.groups[key.String()]
+	if !ok {
+		row = &mergedRow{
+			vals:  make(value.Values, len(vals)),
+			aggrs: make([]common.AggrFunc, len(vals)),
+		}
+		copy(row.vals, vals)
+		m.groups[key.String()] = row
+		m.order = append(m.order, row)
+	}
+
+	for i, aggr := range m.columns {
+		if aggr == nil || i >= len(vals) {
+			continue
+		}
+		if err := m.merge(row, i, aggr, vals[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *aggrMerger) merge(row *mergedRow, pos int, aggr *Aggregate, val value.Value) error {
+
+	switch aggr.AggrFunc {
+
+	case common.AGG_SUM, common.AGG_COUNT, common.AGG_COUNTN:
+		// counts are merged as a sum
+		if row.aggrs[pos] == nil {
+			row.aggrs[pos] = common.NewAggrFunc(common.AGG_SUM, val.Actual(), false, false)
+		} else {
+			row.aggrs[pos].AddDelta(val.Actual())
+		}
+
+	case common.AGG_MIN, common.AGG_MAX:
+		if row.aggrs[pos] == nil {
+			row.aggrs[pos] = common.NewAggrFunc(aggr.AggrFunc, val, false, true)
+		} else {
+			row.aggrs[pos].AddDeltaObj(val)
+		}
+
+	default:
+		fn, ok := row.aggrs[pos].(common.MergeableAggrFunc)
+		if !ok {
+			fn = common.NewMergeableAggrFunc(aggr.AggrFunc, aggr.Distinct, false, aggr.Limit, aggr.Quantile)
+			if fn == nil {
+				return fmt.Errorf("Cannot merge aggregate %v", aggr.AggrFunc)
+			}
+			row.aggrs[pos] = fn
+		}
+
+		// partial state as plain json types
+		var partial interface{}
+		bs, err := val.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(bs, &partial); err != nil {
+			return err
+		}
+		if err := fn.MergePartial(partial); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// aggrRows sorts merged rows on their keys.
+type aggrRows struct {
+	rows   []value.Values
+	broker *RequestBroker
+}
+
+func (r *aggrRows) Len() int      { return len(r.rows) }
+func (r *aggrRows) Swap(i, j int) { r.rows[i], r.rows[j] = r.rows[j], r.rows[i] }
+func (r *aggrRows) Less(i, j int) bool {
+	return r.broker.compareKey(r.rows[i], r.rows[j]) < 0
+}
+
+func (m *aggrMerger) result() []value.Values {
+
+	rows := make([]value.Values, 0, len(m.order))
+	for _, row := range m.order {
+		for i, fn := range row.aggrs {
+			if fn == nil {
+				continue
+			}
+
+			var val interface{}
+			if mfn, ok := fn.(common.MergeableAggrFunc); ok && !m.finalize {
+				val = mfn.PartialValue()
+			} else if fn.IsValid() {
+				val = fn.Value()
+			}
+
+			if v, ok := val.(value.Value); ok {
+				row.vals[i] = v
+			} else {
+				row.vals[i] = value.NewValue(val)
+			}
+		}
+		rows = append(rows, row.vals)
+	}
+	return rows
+}
+
 // This function compares two set of secondart key values.
 // Returns –int, 0 or +int depending on if key1
 // sorts less than, equal to, or greater than key2.
@@ -1195,7 +1536,7 @@ func (c *RequestBroker) compareKey(key1, key2 []value.Value) int {
 
 	for i := 0; i < ln; i++ {
 
-		if r := key1[i].Collate(key2[i]); r != 0 {
+		if r := c.collateKey(i, key1[i], key2[i]); r != 0 {
 
 			// default: ascending
 			if i >= len(c.projDesc) {
@@ -1215,6 +1556,23 @@ func (c *RequestBroker) compareKey(key1, key2 []value.Value) int {
 	return len(key1) - len(key2)
 }
 
+// collateKey compares strings projected at position `i` by their
+// collation key, if the index key is collated, and then by value, the
+// order of entries in the index.
+func (c *RequestBroker) collateKey(i int, v1, v2 value.Value) int {
+	if i < len(c.projColl) && c.projColl[i] != nil &&
+		v1.Type() == value.STRING && v2.Type() == value.STRING {
+
+		s1, s2 := v1.Actual().(string), v2.Actual().(string)
+		k1 := c.projColl[i].Key(nil, []byte(s1))
+		k2 := c.projColl[i].Key(nil, []byte(s2))
+		if r := bytes.Compare(k1, k2); r != 0 {
+			return r
+		}
+	}
+	return v1.Collate(v2)
+}
+
 // This function compares the primary key.
 // Returns –int, 0 or +int depending on if key1
 // sorts less than, equal to, or greater than key2.
@@ -1240,7 +1598,13 @@ func (c *RequestBroker) scanSingleNode(id ResponseHandlerId, client *GsiScanClie
 	}
 
 	begin := time.Now()
-	err, partial := c.scan(client, index, rollback, partition, c.factory(id, instId, partition))
+	var err error
+	var partial bool
+	if c.hedger != nil {
+		err, partial, instId = c.hedgedScan(id, client, index, instId, rollback, partition)
+	} else {
+		err, partial = c.scan(client, index, rollback, partition, c.factory(id, instId, partition))
+	}
 	if err != nil {
 		// If there is any error, then stop the broker.
 		// This will force other go-routine to terminate.
@@ -1322,7 +1686,7 @@ func (c *RequestBroker) SendEntries(id ResponseHandlerId, pkeys [][]byte,
 	for i := 0; i < skeys.GetLength(); i++ {
 		if c.useGather() {
 			var vals []value.Value
-			if c.sorted {
+			if c.sorted || c.mergeAggrs {
 				vals, err, rb = skeys.Getkth(tmpbuf, i)
 				if err != nil {
 					logging.Errorf("Error %v in RequestBroker::SendEntries Getkth", err)
@@ -1334,7 +1698,7 @@ func (c *RequestBroker) SendEntries(id ResponseHandlerId, pkeys [][]byte,
 				}
 			}
 
-			if c.sorted && len(vals) == 0 {
+			if (c.sorted || c.mergeAggrs) && len(vals) == 0 {
 				vals = make(value.Values, 0)
 			}
 
@@ -1439,6 +1803,7 @@ func makeDefaultResponseHandler(id ResponseHandlerId, broker *RequestBroker, ins
 			broker.Error(err, instId, partitions)
 			return false
 		}
+		broker.Profile(resp, instId, partitions)
 		skeys, pkeys, err := resp.GetEntries(broker.GetDataEncodingFormat())
 		if err != nil {
 			logging.Errorf("defaultResponseHandler: %v", err)
@@ -1482,6 +1847,14 @@ func (c *RequestBroker) filterPartitions(index *common.IndexDefn, partitions [][
 		return partitions
 	}
 
+	if index.PartitionScheme == common.RANGE {
+		filter := partitionKeyRange(c.requestId, partitionKeyPos, c.scans, index.RangeBoundaries)
+		if len(filter) == 0 {
+			return partitions
+		}
+		return filterPartitionIds(partitions, filter)
+	}
+
 	partitionKeyValues := partitionKeyValues(c.requestId, partitionKeyPos, c.scans)
 	if len(partitionKeyValues) == 0 {
 		return partitions
@@ -1532,6 +1905,11 @@ func partitionKeyPos(defn *common.IndexDefn) []int {
 			for i, secExpr := range secExprs {
 
 				if partnExpr.EquivalentTo(secExpr) {
+					// Strings equal as per collation of index key can
+					// hash to different partitions.
+					if defn.GetCollation(i) != "" {
+						return nil
+					}
 					pos = append(pos, i)
 					break
 				}
@@ -1663,6 +2041,92 @@ func partitionKeyHash(partnKeyValues [][]interface{}, scans Scans, numPartition
 	return result
 }
 
+//
+// Generate a list of partitionId for RANGE partitioned index, from the range
+// of partition key values of each scan.  If any scan does not restrict the
+// partition key, then the request needs to be scatter-gather.
+//
+func partitionKeyRange(requestId string, partnKeyPos []int, scans Scans, rangeBoundaries []string) map[common.PartitionId]bool {
+
+	if len(partnKeyPos) != 1 || len(scans) == 0 {
+		return nil
+	}
+
+	boundaries, err := common.CollateRangeBoundaries(rangeBoundaries)
+	if err != nil {
+		logging.Errorf("scatter: requestId %v invalid range boundaries: %v", requestId, err)
+		return nil
+	}
+
+	pos := partnKeyPos[0]
+	if pos == MetaIdPos {
+		// n1ql only push down span on primary key for metaId()
+		pos = 0
+	}
+
+	result := make(map[common.PartitionId]bool)
+	for _, scan := range scans {
+		if scan == nil {
+			continue
+		}
+
+		var low, high []byte
+		inclHigh := true
+
+		if len(scan.Filter) > 0 {
+			if pos >= len(scan.Filter) {
+				return nil
+			}
+
+			filter := scan.Filter[pos]
+			if filter.Low != common.MinUnbounded {
+				if low, err = collatePartitionKey(filter.Low); err != nil {
+					return nil
+				}
+			}
+			if filter.High != common.MaxUnbounded {
+				if high, err = collatePartitionKey(filter.High); err != nil {
+					return nil
+				}
+			}
+			inclHigh = filter.Inclusion == High || filter.Inclusion == Both
+
+			// desc keys can have the span in index order
+			if low != nil && high != nil && bytes.Compare(low, high) > 0 {
+				low, high, inclHigh = high, low, true
+			}
+
+		} else if len(scan.Seek) > 0 {
+			if pos >= len(scan.Seek) {
+				return nil
+			}
+
+			if low, err = collatePartitionKey(scan.Seek[pos]); err != nil {
+				return nil
+			}
+			high = low
+
+		} else {
+			return nil
+		}
+
+		for _, partnId := range common.RangeSpanPartitions(low, high, inclHigh, boundaries) {
+			result[partnId] = true
+		}
+	}
+
+	return result
+}
+
+func collatePartitionKey(key interface{}) ([]byte, error) {
+
+	v, err := qvalue.NewValue([]interface{}{key}).MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return common.CollateRangeKey(v)
+}
+
 //
 // Given the indexer-partitionId map, filter out the partitionId that are not used in the scans
 //
@@ -1684,10 +2148,11 @@ func filterPartitionIds(allPartitions [][]common.PartitionId, filter map[common.
 // API2 Push Down
 //--------------------------
 
-func (c *RequestBroker) changePushdownParams(partitions [][]common.PartitionId, numPartition uint32, index *common.IndexDefn) {
+func (c *RequestBroker) changePushdownParams(partitions [][]common.PartitionId, numPartition uint32, index *common.IndexDefn) error {
 	c.changeLimit(partitions, numPartition, index)
 	c.changeOffset(partitions, numPartition, index)
 	c.changeSorted(partitions, numPartition, index)
+	return c.changeGroupAggr(partitions, numPartition, index)
 }
 
 //
@@ -1830,6 +2295,111 @@ func (c *RequestBroker) changeSorted(partitions [][]common.PartitionId, numParti
 
 }
 
+//
+// AVG, ARRAY_AGG and approximate aggregates cannot be merged from the final
+// value of each row of a group.  An indexer returns more than one row for a
+// group if the group spans partitions, or if the group is not on leading
+// index keys and it is flushed from the group buffer.  Unless there is a
+// single row for each group, ask the indexers for the partial state of the
+// aggregates and merge the rows of each group before returning them.  Limit
+// and offset can only apply after the merge.
+//
+func (c *RequestBroker) changeGroupAggr(partitions [][]common.PartitionId, numPartition uint32, index *common.IndexDefn) error {
+
+	c.pushdownAggr = c.grpAggr
+	c.mergeAggrs = false
+
+	if !c.hasMergeableAggregates() || c.isSingleRowGroup(numPartition, index) {
+		return nil
+	}
+
+	if err := c.canMergeAggregates(index); err != nil {
+		return err
+	}
+
+	grpAggr := *c.grpAggr
+	grpAggr.PartialAggrState = true
+	c.pushdownAggr = &grpAggr
+	c.mergeAggrs = true
+
+	c.pushdownLimit = math.MaxInt64
+	c.pushdownOffset = 0
+	return nil
+}
+
+func (c *RequestBroker) hasMergeableAggregates() bool {
+
+	// other aggregates are merged by cbq-engine
+	if c.grpAggr == nil {
+		return false
+	}
+	for _, aggr := range c.grpAggr.Aggrs {
+		if common.IsMergeableAggr(aggr.AggrFunc) {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// There is a single row for each group if the index has a single partition
+// and group keys are leading index keys.
+//
+func (c *RequestBroker) isSingleRowGroup(numPartition uint32, index *common.IndexDefn) bool {
+
+	if index.PartitionScheme != common.SINGLE && numPartition != 1 {
+		return false
+	}
+
+	for i, group := range c.grpAggr.Group {
+		if int32(i) != group.KeyPos {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *RequestBroker) canMergeAggregates(index *common.IndexDefn) error {
+
+	if c.projections == nil {
+		return fmt.Errorf("Cannot merge aggregates of index %v:%v without projection.", index.Bucket, index.Name)
+	}
+
+	// group of a row is identified by its group keys
+	for _, group := range c.grpAggr.Group {
+		projected := false
+		for _, entryId := range c.projections.EntryKeys {
+			if entryId == int64(group.EntryKeyId) {
+				projected = true
+				break
+			}
+		}
+		if !projected {
+			return fmt.Errorf("Cannot merge aggregates of index %v:%v. Group key %v is not projected.",
+				index.Bucket, index.Name, group.EntryKeyId)
+		}
+	}
+
+	// Distinct values of an aggregate key can span partitions, unless it is
+	// the partition key.
+	positions := partitionKeyPos(index)
+	for _, aggr := range c.grpAggr.Aggrs {
+		if !aggr.Distinct {
+			continue
+		}
+
+		switch aggr.AggrFunc {
+		case common.AGG_SUM, common.AGG_COUNT, common.AGG_COUNTN, common.AGG_AVG:
+			if len(positions) != 1 || int32(positions[0]) != aggr.KeyPos {
+				return fmt.Errorf("Cannot merge distinct aggregate %v of index %v:%v on non-partition key.",
+					aggr.AggrFunc, index.Bucket, index.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
 //--------------------------
 // API3 push down
 //--------------------------
@@ -2028,6 +2598,16 @@ func (c *RequestBroker) analyzeProjection(partitions [][]common.PartitionId, num
 				c.projDesc[i] = index.Desc[position]
 			}
 		}
+
+		if index.HasCollation() {
+			c.projColl = make([]collatejson.Collator, len(c.projections.EntryKeys))
+			for i, position := range pos {
+				if position >= 0 && position < len(index.SecExprs) {
+					// validated when the index is created.
+					c.projColl[i], _ = collatejson.NewCollator(index.GetCollation(position))
+				}
+			}
+		}
 	}
 }
 
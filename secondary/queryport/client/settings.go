@@ -17,6 +17,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+	"unsafe"
 )
 
 type ClientSettings struct {
@@ -29,6 +30,7 @@ type ClientSettings struct {
 	queueSize      uint64
 	concurrency    uint32
 	usePlanner     uint32
+	routing        unsafe.Pointer // *RoutingPolicy
 	config         common.Config
 	cancelCh       chan struct{}
 
@@ -187,6 +189,25 @@ func (s *ClientSettings) handleSettings(config common.Config) {
 		atomic.StoreUint32(&s.usePlanner, 1)
 	}
 
+	routing := &RoutingPolicy{
+		PreferServerGroup: config["queryport.client.routing.preferServerGroup"].Bool(),
+		ServerGroup:       config["queryport.client.routing.serverGroup"].String(),
+		LatencyWeighted:   config["queryport.client.routing.latencyWeighted"].Bool(),
+		LatencyAlpha:      config["queryport.client.routing.latencyAlpha"].Float64(),
+		Hedge:             config["queryport.client.routing.hedge.enable"].Bool(),
+		HedgePercentile:   config["queryport.client.routing.hedge.percentile"].Float64(),
+		HedgeMinDelay:     time.Duration(config["queryport.client.routing.hedge.minDelay"].Int()) * time.Millisecond,
+	}
+	if routing.LatencyAlpha <= 0 || routing.LatencyAlpha > 1.0 {
+		logging.Errorf("ClientSettings: invalid setting value for routing.latencyAlpha=%v", routing.LatencyAlpha)
+		routing.LatencyAlpha = 0.2
+	}
+	if routing.HedgePercentile <= 0 || routing.HedgePercentile > 100 {
+		logging.Errorf("ClientSettings: invalid setting value for routing.hedge.percentile=%v", routing.HedgePercentile)
+		routing.HedgePercentile = 95.0
+	}
+	atomic.StorePointer(&s.routing, unsafe.Pointer(routing))
+
 	storageMode := config["indexer.settings.storage_mode"].String()
 	if len(storageMode) != 0 {
 		func() {
@@ -200,6 +221,9 @@ func (s *ClientSettings) handleSettings(config common.Config) {
 		logLevel := config["queryport.client.log_level"].String()
 		level := logging.Level(logLevel)
 		logging.SetLogLevel(level)
+
+		logFormat := config["queryport.client.log_format"].String()
+		logging.SetLogFormat(logging.Format(logFormat))
 	}
 }
 
@@ -254,3 +278,7 @@ func (s *ClientSettings) AllowCJsonScanFormat() bool {
 func (s *ClientSettings) UsePlanner() bool {
 	return atomic.LoadUint32(&s.usePlanner) == 1
 }
+
+func (s *ClientSettings) RoutingPolicy() *RoutingPolicy {
+	return (*RoutingPolicy)(atomic.LoadPointer(&s.routing))
+}
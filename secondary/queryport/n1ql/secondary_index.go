@@ -12,6 +12,7 @@
 package n1ql
 
 import "fmt"
+import "math"
 import "os"
 import "sync"
 import "time"
@@ -50,6 +51,10 @@ var ErrorIndexEmpty = errors.NewError(
 // refreshed.
 var ErrorIndexNotAvailable = fmt.Errorf("index not available")
 
+// ErrorCountCollation is count pushed down to an index with collation.
+var ErrorCountCollation = errors.NewError(
+	fmt.Errorf("gsi.countCollation"), "Count is not supported on index with collation")
+
 var n1ql2GsiInclusion = map[datastore.Inclusion]qclient.Inclusion{
 	datastore.NEITHER: qclient.Neither,
 	datastore.LOW:     qclient.Low,
@@ -602,6 +607,14 @@ func (gsi *gsiKeyspace) delIndex(id string) {
 func (gsi *gsiKeyspace) getIndexFromVersion(index *secondaryIndex,
 	clusterVersion uint64) datastore.Index {
 
+	// spans on collated keys are not exact, index order is not the
+	// order of values, hence no pushdown of order, offset, limit, count
+	// or aggregates. Query does not know of the collation, see
+	// Collations().
+	if index.hasCollation() {
+		return datastore.Index(index)
+	}
+
 	if clusterVersion >= c.INDEXER_65_VERSION {
 		si2 := &secondaryIndex2{secondaryIndex: *index}
 		si3 := &secondaryIndex3{secondaryIndex2: *si2}
@@ -684,6 +697,9 @@ type secondaryIndex struct {
 	state     datastore.IndexState
 	err       string
 	deferred  bool
+
+	aggregates []c.AggregateDefn // materialized with the index
+	collations []string          // of strings in each index key
 }
 
 // for metadata-provider.
@@ -708,6 +724,9 @@ func newSecondaryIndexFromMetaData(
 		state:     gsi2N1QLState[imd.State],
 		err:       imd.Error,
 		deferred:  indexDefn.Deferred,
+
+		aggregates: indexDefn.Aggregates,
+		collations: indexDefn.Collations,
 	}
 
 	if indexDefn.SecExprs != nil {
@@ -791,6 +810,34 @@ func (si *secondaryIndex) Condition() expression.Expression {
 	return nil
 }
 
+// Collations of strings in index keys, empty string for binary
+// collation. Index with collation is served only through Index{}
+// interface and its spans match all the strings having the same
+// collation key as the span, hence predicates must be applied on the
+// scanned entries.
+//
+// Collations() is not part of any datastore interface, so query
+// neither sees it nor plans for it. Query re-applies its own binary
+// predicates on the scanned entries, thus `WHERE name = "abc"` on a
+// "nocase" index still returns only "abc", not "ABC", and is slower
+// than on a binary index. Collated results are available only through
+// the queryport client, see TestN1QLCollatedIndex in functionaltests.
+func (si *secondaryIndex) Collations() []string {
+	if si != nil && si.hasCollation() {
+		return si.collations
+	}
+	return nil
+}
+
+func (si *secondaryIndex) hasCollation() bool {
+	for _, collation := range si.collations {
+		if collation != "" && collation != collatejson.CollationBinary {
+			return true
+		}
+	}
+	return false
+}
+
 // IsPrimary implements Index{} interface.
 func (si *secondaryIndex) IsPrimary() bool {
 	return si.isPrimary
@@ -836,6 +883,8 @@ func (si *secondaryIndex) Count(span *datastore.Span,
 
 	if si == nil {
 		return 0, ErrorIndexEmpty
+	} else if si.hasCollation() {
+		return 0, ErrorCountCollation
 	}
 	client := si.gsi.gsiClient
 
@@ -910,6 +959,12 @@ func (si *secondaryIndex) Scan(
 
 	starttm := time.Now()
 
+	// span matches more entries than its values on collated keys, that
+	// are filtered after the scan, hence no limit.
+	if si.hasCollation() {
+		limit = math.MaxInt64
+	}
+
 	client, cnf := si.gsi.gsiClient, si.gsi.config
 	if span.Seek != nil {
 		seek := values2SKey(span.Seek)
@@ -1099,18 +1154,59 @@ type secondaryIndex3 struct {
 	secondaryIndex2
 }
 
-// CreateAggregate implement Index3 interface.
+// CreateAggregate implement Index3 interface. Group keys and aggregates
+// shall be on index keys, COUNT of a constant counts index entries.
 func (si *secondaryIndex3) CreateAggregate(requestId string, groupAggs *datastore.IndexGroupAggregates,
 	with value.Value) errors.Error {
-	return errors.NewError(fmt.Errorf("Create Aggregate not supported"), "")
+
+	aggr, e := n1qlgroupaggrtoaggregate(groupAggs)
+	if e != nil {
+		return errors.NewError(e, "GSI CreateAggregate()")
+	}
+	client := si.gsi.gsiClient
+	if e := client.CreateAggregate(si.defnID, aggr); e != nil {
+		return errors.NewError(e, "GSI CreateAggregate()")
+	}
+	return nil
 }
 
+// DropAggregate implement Index3 interface.
 func (si *secondaryIndex3) DropAggregate(requestId, name string) errors.Error {
-	return errors.NewError(fmt.Errorf("Drops Aggregate not supported"), "")
+	client := si.gsi.gsiClient
+	if e := client.DropAggregate(si.defnID, name); e != nil {
+		return errors.NewError(e, "GSI DropAggregate()")
+	}
+	return nil
 }
 
+// Aggregates implement Index3 interface.
 func (si *secondaryIndex3) Aggregates() ([]datastore.IndexGroupAggregates, errors.Error) {
-	return nil, errors.NewError(fmt.Errorf("Precomputed Aggregates not supported"), "")
+	aggrs := make([]datastore.IndexGroupAggregates, 0, len(si.aggregates))
+	for _, aggr := range si.aggregates {
+		groupAggs := datastore.IndexGroupAggregates{Name: aggr.Name}
+		for i, pos := range aggr.Group {
+			groupAggs.Group = append(groupAggs.Group, &datastore.IndexGroupKey{
+				EntryKeyId: i,
+				KeyPos:     int(pos),
+				Expr:       si.secExprs[pos],
+			})
+		}
+		for i, fn := range aggr.Aggrs {
+			a := &datastore.IndexAggregate{
+				Operation:  gsiaggrtypeton1ql(fn.Type),
+				EntryKeyId: len(aggr.Group) + i,
+				KeyPos:     int(fn.KeyPos),
+			}
+			if fn.KeyPos >= 0 {
+				a.Expr = si.secExprs[fn.KeyPos]
+			} else {
+				a.Expr = expression.NewConstant(1)
+			}
+			groupAggs.Aggregates = append(groupAggs.Aggregates, a)
+		}
+		aggrs = append(aggrs, groupAggs)
+	}
+	return aggrs, nil
 }
 
 func (si *secondaryIndex3) PartitionKeys() (*datastore.IndexPartition, errors.Error) {
@@ -1232,6 +1328,20 @@ func (si *secondaryIndex3) Alter(requestId string, with value.Value) (
 			return nil, errors.NewError(e, "GSI AlterIndex()")
 		}
 		return datastore.Index(si), nil
+	case "rename", "set_property":
+		client := si.gsi.gsiClient
+		e := client.AlterIndex(si.defnID, withMap)
+		if e != nil {
+			return nil, errors.NewError(e, "GSI AlterIndex()")
+		}
+		return datastore.Index(si), nil
+	case "pause", "resume":
+		client := si.gsi.gsiClient
+		e := client.PauseIndex(si.defnID, action.(string) == "pause")
+		if e != nil {
+			return nil, errors.NewError(e, "GSI AlterIndex()")
+		}
+		return datastore.Index(si), nil
 	default:
 		return nil, errors.NewError(fmt.Errorf(ErrorUnsupportedAction), "")
 	}
@@ -1280,8 +1390,18 @@ func (si *secondaryIndex4) StorageMode() (datastore.IndexStorageMode, errors.Err
 	return "", errors.NewError(nil, "Index4 StorageMode(): Unknown storage mode")
 }
 
+// LeadKeyHistogram implement Index4{} interface.
 func (si *secondaryIndex4) LeadKeyHistogram(requestId string) (*datastore.Histogram, errors.Error) {
-	return nil, errors.NewNotImplemented("Index4 LeadKeyHistogram")
+	if si == nil {
+		return nil, ErrorIndexEmpty
+	}
+	client := si.gsi.gsiClient
+
+	pstats, err := client.LeadKeyHistogram(si.defnID, requestId)
+	if err != nil {
+		return nil, n1qlError(client, err)
+	}
+	return newHistogram(pstats), nil
 }
 
 func (si *secondaryIndex4) StorageStatistics(requestid string) ([]map[datastore.IndexStatType]value.Value,
@@ -1650,6 +1770,7 @@ type statistics struct {
 	uniqueKeys int64
 	min        value.Values
 	max        value.Values
+	bins       []datastore.Statistics
 }
 
 // return an
@@ -1662,9 +1783,19 @@ func newStatistics(pstats c.IndexStatistics) datastore.Statistics {
 	stats.min = skey2Values(min)
 	max, _ := pstats.MaxKey()
 	stats.max = skey2Values(max)
+	bins, _ := pstats.Bins()
+	for _, bin := range bins {
+		stats.bins = append(stats.bins, newStatistics(bin))
+	}
 	return stats
 }
 
+// newHistogram of leading key, bins of the histogram are those of
+// statistics.
+func newHistogram(pstats c.IndexStatistics) *datastore.Histogram {
+	return &datastore.Histogram{Statistics: newStatistics(pstats)}
+}
+
 // Count implement Statistics{} interface.
 func (stats *statistics) Count() (int64, errors.Error) {
 	return stats.count, nil
@@ -1687,7 +1818,7 @@ func (stats *statistics) Max() (value.Values, errors.Error) {
 
 // Bins implement Statistics{} interface.
 func (stats *statistics) Bins() ([]datastore.Statistics, errors.Error) {
-	return nil, nil
+	return stats.bins, nil
 }
 
 //------------------
@@ -2073,6 +2204,53 @@ func n1qlaggrtypetogsi(aggrType datastore.AggregateType) c.AggrFuncType {
 	}
 }
 
+func gsiaggrtypeton1ql(aggrType c.AggrFuncType) datastore.AggregateType {
+	switch aggrType {
+	case c.AGG_MIN:
+		return datastore.AGG_MIN
+	case c.AGG_MAX:
+		return datastore.AGG_MAX
+	case c.AGG_SUM:
+		return datastore.AGG_SUM
+	case c.AGG_COUNT:
+		return datastore.AGG_COUNT
+	default:
+		return datastore.AGG_COUNTN
+	}
+}
+
+// n1qlgroupaggrtoaggregate converts an aggregate to be materialized with
+// the index.
+func n1qlgroupaggrtoaggregate(groupAggs *datastore.IndexGroupAggregates) (*c.AggregateDefn, error) {
+	if groupAggs == nil {
+		return nil, fmt.Errorf("Missing aggregate definition")
+	}
+
+	aggr := &c.AggregateDefn{Name: groupAggs.Name}
+	for _, grp := range groupAggs.Group {
+		if grp.KeyPos < 0 {
+			return nil, fmt.Errorf("Group key %v is not an index key", grp.Expr)
+		}
+		aggr.Group = append(aggr.Group, int32(grp.KeyPos))
+	}
+	for _, a := range groupAggs.Aggregates {
+		fn := c.AggregateFunc{
+			Type:   n1qlaggrtypetogsi(a.Operation),
+			KeyPos: int32(a.KeyPos),
+		}
+		if a.Distinct {
+			return nil, fmt.Errorf("DISTINCT aggregate %v not supported", a.Expr)
+		} else if a.KeyPos < 0 {
+			if fn.Type != c.AGG_COUNT || a.Expr == nil || a.Expr.Value() == nil {
+				return nil, fmt.Errorf("Aggregate %v is not on an index key", a.Expr)
+			}
+			fn.KeyPos = -1
+		}
+		aggr.Aggrs = append(aggr.Aggrs, fn)
+	}
+	return aggr, nil
+}
+
 func gsistatston1ql(stats []map[string]interface{}) []map[datastore.IndexStatType]value.Value {
 	storageStats := make([]map[datastore.IndexStatType]value.Value, 0)
 	for _, partitionStats := range stats {
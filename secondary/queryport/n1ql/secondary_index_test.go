@@ -1,7 +1,11 @@
 package n1ql
 
 import (
+	"reflect"
 	"testing"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/query/datastore"
 )
 
 func TestIndexConfig(t *testing.T) {
@@ -66,3 +70,28 @@ func validateConf(t *testing.T, preconf, postconf map[string]interface{}) {
 		t.Errorf("config mismatch %v %v", preconf, postconf)
 	}
 }
+
+func TestCollatedIndex(t *testing.T) {
+	gsi := &gsiKeyspace{}
+
+	si := &secondaryIndex{gsi: gsi, collations: []string{"nocase", ""}}
+	index := gsi.getIndexFromVersion(si, c.INDEXER_65_VERSION)
+	if _, ok := index.(datastore.Index2); ok {
+		t.Errorf("expected index with collation to be served through Index{} only")
+	}
+	if collations := index.(*secondaryIndex).Collations(); !reflect.DeepEqual(collations, si.collations) {
+		t.Errorf("expected collations %v, got %v", si.collations, collations)
+	}
+	if _, err := si.Count(nil, datastore.UNBOUNDED, nil); err != ErrorCountCollation {
+		t.Errorf("expected count to be refused, got %v", err)
+	}
+
+	si = &secondaryIndex{gsi: gsi, collations: []string{"binary", ""}}
+	index = gsi.getIndexFromVersion(si, c.INDEXER_65_VERSION)
+	if _, ok := index.(datastore.Index2); !ok {
+		t.Errorf("expected index in binary collation to be served through Index2{}")
+	}
+	if collations := si.Collations(); collations != nil {
+		t.Errorf("expected no collations, got %v", collations)
+	}
+}
@@ -54,14 +54,27 @@ type Server struct {
 	writeDeadline     time.Duration
 	keepAliveInterval time.Duration
 	streamChanSize    int
+	drainTimeout      time.Duration
 	logPrefix         string
 	nConnections      int64
+	// payload bytes of closed connections, before and after compression.
+	bytesUncompressed uint64
+	bytesCompressed   uint64
 
-	conns map[string]net.Conn
+	conns map[string]*serverConn
+}
+
+// serverConn tracks a connection for graceful drain on reset.
+type serverConn struct {
+	conn     *transport.Conn
+	busy     bool // request in flight
+	draining bool // close once the request in flight is done
 }
 
 type ServerStats struct {
-	Connections int64
+	Connections       int64
+	BytesUncompressed uint64
+	BytesCompressed   uint64
 }
 
 // NewServer creates a new queryport daemon.
@@ -77,13 +90,14 @@ func NewServer(
 		readDeadline:   time.Duration(config["readDeadline"].Int()),
 		writeDeadline:  time.Duration(config["writeDeadline"].Int()),
 		streamChanSize: config["streamChanSize"].Int(),
+		drainTimeout:   time.Duration(config["drainTimeout"].Int()) * time.Second,
 		logPrefix:      fmt.Sprintf("[Queryport %q]", laddr),
 		nConnections:   0,
-		conns:          make(map[string]net.Conn),
+		conns:          make(map[string]*serverConn),
 	}
 	keepAliveInterval := config["keepAliveInterval"].Int()
 	s.keepAliveInterval = time.Duration(keepAliveInterval) * time.Second
-	if s.lis, err = security.MakeListener(laddr); err != nil {
+	if s.lis, err = security.MakeClientAuthListener(laddr); err != nil {
 		logging.Errorf("%v failed starting %v !!\n", s.logPrefix, err)
 		return nil, err
 	}
@@ -94,9 +108,20 @@ func NewServer(
 }
 
 func (s *Server) Statistics() ServerStats {
-	return ServerStats{
-		Connections: atomic.LoadInt64(&s.nConnections),
+	stats := ServerStats{
+		Connections:       atomic.LoadInt64(&s.nConnections),
+		BytesUncompressed: atomic.LoadUint64(&s.bytesUncompressed),
+		BytesCompressed:   atomic.LoadUint64(&s.bytesCompressed),
 	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sconn := range s.conns {
+		uncompressed, compressed := sconn.conn.CompressionStats()
+		stats.BytesUncompressed += uncompressed
+		stats.BytesCompressed += compressed
+	}
+	return stats
 }
 
 // Close queryport daemon.
@@ -122,22 +147,51 @@ func (s *Server) Close() (err error) {
 	return
 }
 
+// ResetConnections restarts the listener with the current security
+// setting and drains existing connections. Idle connections are closed
+// right away, others once their request in flight is done or after
+// drainTimeout, whichever is earlier.
 func (s *Server) ResetConnections() error {
 
 	// close listener
 	s.Close()
 
-	// close all existing connections
-	func() {
+	// drain all existing connections
+	draining := func() []*serverConn {
 		s.mu.Lock()
 		defer s.mu.Unlock()
 
-		for _, conn := range s.conns {
-			s.deregisterConnNoLock(conn)
-			conn.Close()
+		sconns := make([]*serverConn, 0, len(s.conns))
+		for _, sconn := range s.conns {
+			if sconn.busy {
+				sconn.draining = true
+				sconns = append(sconns, sconn)
+			} else {
+				s.deregisterConnNoLock(sconn.conn)
+				sconn.conn.Close()
+			}
 		}
+		return sconns
 	}()
 
+	if len(draining) > 0 {
+		logging.Infof("%v draining %v connections\n", s.logPrefix, len(draining))
+		time.AfterFunc(s.drainTimeout, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			for _, sconn := range draining {
+				raddr := sconn.conn.RemoteAddr().String()
+				if s.conns[raddr] == sconn {
+					logging.Warnf("%v connection %v not drained in %v, closing\n",
+						s.logPrefix, raddr, s.drainTimeout)
+					delete(s.conns, raddr)
+					sconn.conn.Close()
+				}
+			}
+		})
+	}
+
 	// Existing connection will continue to run.  They need to
 	// be closed by the clients by flushing their connection pools.
 	logging.Infof("%v ... restarting listener\n", s.logPrefix)
@@ -148,7 +202,7 @@ func (s *Server) ResetConnections() error {
 
 		// Restart listener.
 		var err error
-		if s.lis, err = security.MakeListener(s.laddr); err != nil {
+		if s.lis, err = security.MakeClientAuthListener(s.laddr); err != nil {
 			logging.Errorf("%v failed starting listener %v %v !!\n", s.logPrefix, s.laddr, err)
 			return err
 		}
@@ -164,10 +218,10 @@ func (s *Server) ResetConnections() error {
 	return nil
 }
 
-func (s *Server) registerConn(conn net.Conn) {
+func (s *Server) registerConn(conn *transport.Conn) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.conns[conn.RemoteAddr().String()] = conn
+	s.conns[conn.RemoteAddr().String()] = &serverConn{conn: conn}
 }
 
 func (s *Server) deregisterConn(conn net.Conn) bool {
@@ -201,7 +255,7 @@ func (s *Server) listener() {
 
 		if s.lis != nil && s.lis == lis { // if s.lis == nil, then Server.Close() was called
 			s.lis.Close()
-			if s.lis, err = security.MakeListener(s.laddr); err != nil {
+			if s.lis, err = security.MakeClientAuthListener(s.laddr); err != nil {
 				logging.Errorf("%v failed starting %v !!\n", s.logPrefix, err)
 				panic(err)
 			}
@@ -220,8 +274,9 @@ func (s *Server) listener() {
 
 	for {
 		if conn, err := lis.Accept(); err == nil {
-			s.registerConn(conn)
-			go s.handleConnection(conn)
+			tconn := transport.NewConn(conn)
+			s.registerConn(tconn)
+			go s.handleConnection(tconn)
 
 		} else {
 			e, ok := err.(*net.OpError)
@@ -237,22 +292,34 @@ func (s *Server) listener() {
 
 // handle connection request. connection might be kept open in client's
 // connection pool.
-func (s *Server) handleConnection(conn net.Conn) {
+func (s *Server) handleConnection(tconn *transport.Conn) {
 	atomic.AddInt64(&s.nConnections, 1)
 	defer func() {
 		atomic.AddInt64(&s.nConnections, -1)
 	}()
 
-	raddr := conn.RemoteAddr()
+	raddr := tconn.RemoteAddr()
 	defer func() {
-		if s.deregisterConn(conn) {
-			conn.Close()
+		if s.deregisterConn(tconn) {
+			tconn.Close()
 		}
-		logging.Infof("%v connection %v closed\n", s.logPrefix, raddr)
+		uncompressed, compressed := tconn.CompressionStats()
+		atomic.AddUint64(&s.bytesUncompressed, uncompressed)
+		atomic.AddUint64(&s.bytesCompressed, compressed)
+		fmsg := "%v connection %v closed, payload bytes %v compressed to %v\n"
+		logging.Infof(fmsg, s.logPrefix, raddr, uncompressed, compressed)
 	}()
 
+	identity, err := security.ServerHandshake(tconn.Conn, security.QueryportListener)
+	if err != nil {
+		logging.Errorf("%v %v\n", s.logPrefix, err)
+		return
+	} else if identity != "" {
+		logging.Infof("%v connection %v authenticated as %q\n", s.logPrefix, raddr, identity)
+	}
+
 	// Set keep alive interval.
-	if tcpconn, ok := conn.(*net.TCPConn); ok {
+	if tcpconn, ok := tconn.Conn.(*net.TCPConn); ok {
 		tcpconn.SetKeepAlive(true)
 		tcpconn.SetKeepAlivePeriod(s.keepAliveInterval)
 	}
@@ -261,7 +328,7 @@ func (s *Server) handleConnection(conn net.Conn) {
 	killch := make(chan bool)
 	rcvch := make(chan request, s.streamChanSize)
 
-	go s.doReceive(conn, rcvch, killch)
+	go s.doReceive(tconn, rcvch, killch)
 	go s.doPing(rcvch, killch)
 
 	var ctx interface{}
@@ -270,16 +337,43 @@ func (s *Server) handleConnection(conn net.Conn) {
 	}
 
 	for req := range rcvch {
-		s.callb(req.r, ctx, conn, req.quitch) // blocking call
+		if !s.setBusy(tconn, true) {
+			tconn.Close() // drained, wait for doReceive to exit
+			continue
+		}
+		s.callb(req.r, ctx, tconn, req.quitch) // blocking call
 		if req.r != Ping {
-			transport.SendResponseEnd(conn)
+			transport.SendResponseEnd(tconn)
+		}
+		if !s.setBusy(tconn, false) {
+			logging.Infof("%v connection %v drained\n", s.logPrefix, raddr)
+			tconn.Close()
 		}
 	}
 }
 
+// setBusy marks a request in flight on the connection, returns false if
+// the connection is being drained and shall not serve more requests.
+func (s *Server) setBusy(tconn *transport.Conn, busy bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sconn, ok := s.conns[tconn.RemoteAddr().String()]
+	if !ok || sconn.conn != tconn {
+		return false
+	}
+	if sconn.draining {
+		delete(s.conns, tconn.RemoteAddr().String())
+		return false
+	}
+	sconn.busy = busy
+	return true
+}
+
 // receive requests from remote, when this function returns
-// the connection is expected to be closed.
-func (s *Server) doReceive(conn net.Conn, rcvch chan<- request, killch chan bool) {
+// the connection is expected to be closed. Responses are compressed
+// using the same compression as the last request received on `conn`.
+func (s *Server) doReceive(conn *transport.Conn, rcvch chan<- request, killch chan bool) {
 	raddr := conn.RemoteAddr()
 
 	// transport buffer for receiving
@@ -289,6 +383,11 @@ func (s *Server) doReceive(conn net.Conn, rcvch chan<- request, killch chan bool
 
 	logging.Infof("%v connection %q doReceive() ...\n", s.logPrefix, raddr)
 
+	defer func() {
+		uncompressed, compressed := rpkt.CompressionStats()
+		conn.AddStats(int(uncompressed), int(compressed))
+	}()
+
 	var currRequest request
 
 loop:
@@ -316,6 +415,8 @@ loop:
 			break loop
 		}
 
+		conn.SetCompression(rpkt.Flags().GetCompression())
+
 		// This message indicates graceful shutdown of a prior request.
 		if _, yes := reqMsg.(*protobuf.EndStreamRequest); yes {
 			format := "%v connection %s client requested quit"
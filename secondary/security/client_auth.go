@@ -0,0 +1,550 @@
+//  Copyright (c) 2014 Couchbase, Inc.
+//  Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+//  except in compliance with the License. You may obtain a copy of the License at
+//    http://www.apache.org/licenses/LICENSE-2.0
+//  Unless required by applicable law or agreed to in writing, software distributed under the
+//  License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+//  either express or implied. See the License for the specific language governing permissions
+//  and limitations under the License.
+
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/couchbase/indexing/secondary/logging"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+//////////////////////////////////////////////////////
+// Client certificate authentication
+//////////////////////////////////////////////////////
+
+//
+// ClientAuthConfig controls client certificate authentication on the
+// queryport and dataport listeners.
+//
+type ClientAuthConfig struct {
+	// PEM bundle of CAs trusted to sign client certificates.  If empty,
+	// the node certificate is used as the CA.
+	CAFile string
+
+	// Reject clients that do not present a valid certificate.  Otherwise
+	// a certificate is verified only if the client presents one.
+	Required bool
+
+	// Comma separated list of "field:pattern=identity" rules mapping a
+	// client certificate to an identity, see parseIdentityMap.
+	// Certificates that match no rule are rejected.
+	IdentityMap string
+
+	// Comma separated identities allowed to connect to queryport and
+	// dataport respectively.  If empty, any client passing certificate
+	// verification is allowed.  Otherwise clients without a certificate
+	// are rejected.
+	QueryportIdentities string
+	DataportIdentities  string
+
+	// Interval to check certificate, key and CA files for change.  Zero
+	// disables hot-reload.
+	ReloadInterval time.Duration
+}
+
+type clientAuthSetting struct {
+	required bool
+	rules    []identityRule
+	allowed  map[string]map[string]bool // listener -> allowed identities
+}
+
+// Listeners authenticating clients by their certificate.
+const (
+	QueryportListener = "queryport"
+	DataportListener  = "dataport"
+)
+
+// timeout for the server side of a TLS handshake.
+const serverHandshakeTimeout = 30 * time.Second
+
+//
+// Set client certificate authentication for queryport and dataport listeners.
+// This is expected to be called once, after the security context is
+// initialized and before any listener is created.
+//
+func SetClientAuthConfig(cfg ClientAuthConfig) error {
+
+	rules, err := parseIdentityMap(cfg.IdentityMap)
+	if err != nil {
+		return err
+	}
+	allowed := map[string]map[string]bool{
+		QueryportListener: parseIdentities(cfg.QueryportIdentities),
+		DataportListener:  parseIdentities(cfg.DataportIdentities),
+	}
+	restricted := len(allowed[QueryportListener]) != 0 || len(allowed[DataportListener]) != 0
+
+	p := pSecurityContext
+
+	p.refreshMutex.Lock()
+	defer p.refreshMutex.Unlock()
+
+	newSetting := &SecuritySetting{}
+	if oldSetting := GetSecuritySetting(); oldSetting != nil {
+		temp := *oldSetting
+		newSetting = &temp
+	}
+
+	if len(cfg.CAFile) != 0 {
+		caInBytes, err := loadCABundle(cfg.CAFile)
+		if err != nil {
+			return err
+		}
+		newSetting.caInBytes = caInBytes
+	}
+
+	if cfg.Required || len(cfg.CAFile) != 0 || len(rules) != 0 || restricted {
+		newSetting.clientAuth = &clientAuthSetting{
+			required: cfg.Required,
+			rules:    rules,
+			allowed:  allowed,
+		}
+	}
+
+	p.caFile = cfg.CAFile
+
+	// listeners are yet to be created, no need to notify.
+	UpdateSecuritySetting(newSetting)
+
+	logging.Infof("client certificate authentication: required %v caFile %q identity rules %v "+
+		"queryport identities %q dataport identities %q", cfg.Required, cfg.CAFile, len(rules),
+		cfg.QueryportIdentities, cfg.DataportIdentities)
+
+	if cfg.ReloadInterval > 0 {
+		p.watcher.Do(func() {
+			go p.watchCertificates(cfg.ReloadInterval)
+		})
+	}
+
+	return nil
+}
+
+func loadCABundle(caFile string) ([]byte, error) {
+
+	caInBytes, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("Fail to load CA bundle %v: %v", caFile, err)
+	}
+
+	if !x509.NewCertPool().AppendCertsFromPEM(caInBytes) {
+		return nil, fmt.Errorf("No certificate found in CA bundle %v", caFile)
+	}
+
+	return caInBytes, nil
+}
+
+//
+// Setup TLSConfig for listeners authenticating clients.  Falls back to the
+// cbauth client authentication setting if client authentication is not
+// configured.
+//
+func getClientAuthTLSConfig(setting *SecuritySetting) (*tls.Config, error) {
+
+	config, err := getTLSConfigFromSetting(setting)
+	if err != nil {
+		return nil, err
+	}
+
+	clientAuth := setting.clientAuth
+	if clientAuth == nil {
+		return config, nil
+	}
+
+	caInBytes := setting.caInBytes
+	if len(caInBytes) == 0 {
+		caInBytes = setting.certInBytes
+	}
+	if len(caInBytes) == 0 {
+		return nil, fmt.Errorf("No CA certificate has been provided. Can't verify client certificate")
+	}
+
+	config.ClientCAs = x509.NewCertPool()
+	config.ClientCAs.AppendCertsFromPEM(caInBytes)
+
+	if clientAuth.required {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config, nil
+}
+
+//
+// Set up a TLS or TCP listener authenticating clients by their certificate,
+// depending on whether encryption is used.  Meant for the queryport and
+// dataport, whose clients are other nodes of the cluster carrying a node
+// certificate.  HTTP servers are not covered, as REST clients need not
+// have a certificate.
+//
+func MakeClientAuthListener(addr string) (net.Listener, error) {
+
+	addr, err := EncryptPortFromAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := makeTCPListener(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	setting := GetSecuritySetting()
+	if setting == nil || !setting.encryptionEnabled {
+		return listener, nil
+	}
+
+	config, err := getClientAuthTLSConfig(setting)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	tlsListener := tls.NewListener(listener, config)
+	logging.Infof("TLS listener created for %v, client auth %v", tlsListener.Addr().String(), config.ClientAuth)
+	return tlsListener, nil
+}
+
+//
+// Perform the server side of TLS handshake on a connection accepted from a
+// TLS listener of `listener`, map the client certificate to an identity and
+// check that the identity is allowed on the listener.  Return the identity
+// of the client, if it presented a certificate.  This is a no-op for a TCP
+// connection.  Failures are accounted in handshake stats.  This function
+// does not close conn upon error.
+//
+func ServerHandshake(conn net.Conn, listener string) (string, error) {
+
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return "", nil
+	}
+
+	tlsConn.SetDeadline(time.Now().Add(serverHandshakeTimeout))
+	err := tlsConn.Handshake()
+	tlsConn.SetDeadline(time.Time{})
+
+	if err != nil {
+		handshakeStats.fail(err)
+		return "", fmt.Errorf("TLS handshake failed with %v, err=%v", conn.RemoteAddr(), err)
+	}
+
+	var clientAuth *clientAuthSetting
+	if setting := GetSecuritySetting(); setting != nil {
+		clientAuth = setting.clientAuth
+	}
+
+	identity := ""
+	if state := tlsConn.ConnectionState(); len(state.PeerCertificates) != 0 {
+		var rules []identityRule
+		if clientAuth != nil {
+			rules = clientAuth.rules
+		}
+		if identity, err = mapIdentity(rules, state.PeerCertificates[0]); err != nil {
+			atomic.AddUint64(&handshakeStats.identityRejected, 1)
+			return "", fmt.Errorf("TLS handshake failed with %v, err=%v", conn.RemoteAddr(), err)
+		}
+	}
+
+	if err := clientAuth.authorize(listener, identity); err != nil {
+		atomic.AddUint64(&handshakeStats.identityRejected, 1)
+		return "", fmt.Errorf("TLS handshake failed with %v, err=%v", conn.RemoteAddr(), err)
+	}
+
+	atomic.AddUint64(&handshakeStats.succeeded, 1)
+	return identity, nil
+}
+
+//
+// Return an error if `identity` is not allowed on `listener`.  An empty
+// identity stands for a client without a certificate.
+//
+func (s *clientAuthSetting) authorize(listener, identity string) error {
+
+	if s == nil {
+		return nil
+	}
+
+	allowed := s.allowed[listener]
+	if len(allowed) == 0 || allowed[identity] {
+		return nil
+	}
+
+	if len(identity) == 0 {
+		return fmt.Errorf("client without certificate is not allowed on %v", listener)
+	}
+	return fmt.Errorf("client identity %q is not allowed on %v", identity, listener)
+}
+
+//////////////////////////////////////////////////////
+// Certificate to identity mapping
+//////////////////////////////////////////////////////
+
+type identityRule struct {
+	field    string // "cn", "san" or "ou"
+	pattern  string // path.Match pattern
+	identity string
+}
+
+type identityError struct {
+	subject string
+}
+
+func (e *identityError) Error() string {
+	return fmt.Sprintf("client certificate %q does not map to any identity", e.subject)
+}
+
+//
+// Parse identity map of the form "field:pattern=identity,...".  Field is
+// one of cn (subject common name), san (DNS, IP or email subject
+// alternative name) or ou (subject organizational unit), pattern is a
+// shell pattern, e.g. "san:*.query.example.com=query".
+//
+func parseIdentityMap(s string) ([]identityRule, error) {
+
+	var rules []identityRule
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		eq := strings.LastIndex(item, "=")
+		colon := strings.Index(item, ":")
+		if eq < 0 || colon < 0 || colon > eq {
+			return nil, fmt.Errorf("Invalid identity rule %q", item)
+		}
+
+		rule := identityRule{
+			field:    strings.ToLower(strings.TrimSpace(item[:colon])),
+			pattern:  strings.TrimSpace(item[colon+1 : eq]),
+			identity: strings.TrimSpace(item[eq+1:]),
+		}
+		switch rule.field {
+		case "cn", "san", "ou":
+		default:
+			return nil, fmt.Errorf("Invalid field %q in identity rule %q", rule.field, item)
+		}
+		if _, err := path.Match(rule.pattern, ""); err != nil || len(rule.identity) == 0 {
+			return nil, fmt.Errorf("Invalid identity rule %q", item)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+//
+// Map certificate to identity using the first matching rule.  Without
+// rules every certificate maps to its common name.
+//
+func mapIdentity(rules []identityRule, cert *x509.Certificate) (string, error) {
+
+	if len(rules) == 0 {
+		return cert.Subject.CommonName, nil
+	}
+
+	for _, rule := range rules {
+		var values []string
+		switch rule.field {
+		case "cn":
+			values = []string{cert.Subject.CommonName}
+		case "ou":
+			values = cert.Subject.OrganizationalUnit
+		case "san":
+			values = append(values, cert.DNSNames...)
+			values = append(values, cert.EmailAddresses...)
+			for _, ip := range cert.IPAddresses {
+				values = append(values, ip.String())
+			}
+		}
+
+		for _, value := range values {
+			if ok, _ := path.Match(rule.pattern, value); ok {
+				return rule.identity, nil
+			}
+		}
+	}
+
+	return "", &identityError{subject: cert.Subject.String()}
+}
+
+//
+// Parse comma separated list of identities.  Returns nil for an empty
+// list.
+//
+func parseIdentities(s string) map[string]bool {
+
+	var identities map[string]bool
+	for _, identity := range strings.Split(s, ",") {
+		identity = strings.TrimSpace(identity)
+		if len(identity) == 0 {
+			continue
+		}
+		if identities == nil {
+			identities = make(map[string]bool)
+		}
+		identities[identity] = true
+	}
+
+	return identities
+}
+
+//////////////////////////////////////////////////////
+// Handshake Stats
+//////////////////////////////////////////////////////
+
+type HandshakeStats struct {
+	Succeeded        uint64 // server handshakes
+	NoCertificate    uint64 // client did not present a certificate
+	BadCertificate   uint64 // client certificate failed verification
+	IdentityRejected uint64 // client certificate not mapped to an identity
+	Other            uint64 // timeout, protocol or network error
+	ClientFailures   uint64 // handshakes failed connecting to a server
+}
+
+// Failed returns the number of failed server handshakes.
+func (s HandshakeStats) Failed() uint64 {
+	return s.NoCertificate + s.BadCertificate + s.IdentityRejected + s.Other
+}
+
+type handshakeCounters struct {
+	succeeded        uint64
+	noCertificate    uint64
+	badCertificate   uint64
+	identityRejected uint64
+	other            uint64
+	clientFailures   uint64
+}
+
+var handshakeStats handshakeCounters
+
+func GetHandshakeStats() HandshakeStats {
+	return HandshakeStats{
+		Succeeded:        atomic.LoadUint64(&handshakeStats.succeeded),
+		NoCertificate:    atomic.LoadUint64(&handshakeStats.noCertificate),
+		BadCertificate:   atomic.LoadUint64(&handshakeStats.badCertificate),
+		IdentityRejected: atomic.LoadUint64(&handshakeStats.identityRejected),
+		Other:            atomic.LoadUint64(&handshakeStats.other),
+		ClientFailures:   atomic.LoadUint64(&handshakeStats.clientFailures),
+	}
+}
+
+//
+// Account a failed server handshake.  crypto/tls reports certificate
+// failures as plain errors, so they are told apart by their text.
+//
+func (c *handshakeCounters) fail(err error) {
+
+	switch err.(type) {
+	case x509.UnknownAuthorityError, x509.CertificateInvalidError:
+		atomic.AddUint64(&c.badCertificate, 1)
+		return
+	}
+
+	msg := err.Error()
+	if strings.Contains(msg, "didn't provide a certificate") {
+		atomic.AddUint64(&c.noCertificate, 1)
+	} else if strings.Contains(msg, "failed to verify client's certificate") {
+		atomic.AddUint64(&c.badCertificate, 1)
+	} else {
+		atomic.AddUint64(&c.other, 1)
+	}
+}
+
+//////////////////////////////////////////////////////
+// Certificate Hot-Reload
+//////////////////////////////////////////////////////
+
+//
+// Poll certificate, key and CA files for change.  Certificates are reloaded
+// once all files are readable and consistent, and the change is notified
+// the same way as a certificate refresh from cbauth.
+//
+func (p *SecurityContext) watchCertificates(interval time.Duration) {
+
+	modTimes := p.certModTimes()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		newModTimes := p.certModTimes()
+		if newModTimes == modTimes {
+			continue
+		}
+
+		logging.Infof("Certificate files changed.  Reloading certificate ...")
+		if err := p.reloadCertificates(); err != nil {
+			// files may be partially written, retry on next tick.
+			logging.Warnf("Fail to reload certificate: %v", err)
+			continue
+		}
+		modTimes = newModTimes
+	}
+}
+
+func (p *SecurityContext) certModTimes() (modTimes [3]time.Time) {
+	for i, file := range []string{p.certFile, p.keyFile, p.caFile} {
+		if len(file) == 0 {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			modTimes[i] = info.ModTime()
+		}
+	}
+	return
+}
+
+func (p *SecurityContext) reloadCertificates() error {
+
+	p.refreshMutex.Lock()
+	defer p.refreshMutex.Unlock()
+
+	newSetting := &SecuritySetting{}
+	if oldSetting := GetSecuritySetting(); oldSetting != nil {
+		temp := *oldSetting
+		newSetting = &temp
+	}
+
+	if len(p.certFile) != 0 && len(p.keyFile) != 0 {
+		cert, err := tls.LoadX509KeyPair(p.certFile, p.keyFile)
+		if err != nil {
+			return err
+		}
+		certInBytes, err := ioutil.ReadFile(p.certFile)
+		if err != nil {
+			return err
+		}
+		newSetting.certificate = &cert
+		newSetting.certInBytes = certInBytes
+	}
+
+	if len(p.caFile) != 0 {
+		caInBytes, err := loadCABundle(p.caFile)
+		if err != nil {
+			return err
+		}
+		newSetting.caInBytes = caInBytes
+	}
+
+	logging.Infof("Certificate reloaded successfully")
+
+	return p.update(newSetting, true)
+}
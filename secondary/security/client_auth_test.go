@@ -0,0 +1,132 @@
+package security
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+)
+
+func TestParseIdentityMap(t *testing.T) {
+	rules, err := parseIdentityMap(" CN:indexer-* = indexer, san:*.query.example.com=query,,ou:ops=admin ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []identityRule{
+		{field: "cn", pattern: "indexer-*", identity: "indexer"},
+		{field: "san", pattern: "*.query.example.com", identity: "query"},
+		{field: "ou", pattern: "ops", identity: "admin"},
+	}
+	if len(rules) != len(expected) {
+		t.Fatalf("expected %v rules, got %v", len(expected), rules)
+	}
+	for i, rule := range rules {
+		if rule != expected[i] {
+			t.Errorf("expected rule %+v, got %+v", expected[i], rule)
+		}
+	}
+
+	// pattern may contain a colon, identity is after the last '='
+	rules, err = parseIdentityMap("san:spiffe://example.com/*=svc")
+	if err != nil || len(rules) != 1 || rules[0].pattern != "spiffe://example.com/*" {
+		t.Errorf("unexpected rules %+v, err %v", rules, err)
+	}
+
+	if rules, err := parseIdentityMap(""); err != nil || len(rules) != 0 {
+		t.Errorf("expected no rules, got %+v, err %v", rules, err)
+	}
+
+	invalid := []string{
+		"cn=indexer",
+		"cn:indexer",
+		"=cn:indexer",
+		"dn:indexer=indexer",
+		"cn:indexer=",
+		"cn:[=indexer",
+	}
+	for _, s := range invalid {
+		if _, err := parseIdentityMap(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestMapIdentity(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "node1.example.com",
+			OrganizationalUnit: []string{"eng", "ops"},
+		},
+		DNSNames:       []string{"n1.query.example.com"},
+		EmailAddresses: []string{"admin@example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+	}
+
+	testcases := []struct {
+		identityMap string
+		identity    string
+	}{
+		{"", "node1.example.com"},
+		{"cn:node*=node", "node"},
+		{"ou:ops=admin", "admin"},
+		{"san:*.query.example.com=query", "query"},
+		{"san:*@example.com=mail", "mail"},
+		{"san:10.0.0.*=subnet", "subnet"},
+		// first matching rule wins
+		{"cn:other=other,ou:eng=eng,ou:ops=ops", "eng"},
+		// common name is not a subject alternative name
+		{"san:node1.example.com=san,cn:node1.example.com=cn", "cn"},
+	}
+	for _, tc := range testcases {
+		rules, err := parseIdentityMap(tc.identityMap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		identity, err := mapIdentity(rules, cert)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tc.identityMap, err)
+		} else if identity != tc.identity {
+			t.Errorf("%q: expected identity %q, got %q", tc.identityMap, tc.identity, identity)
+		}
+	}
+
+	rules, _ := parseIdentityMap("cn:indexer-*=indexer,ou:dev=dev")
+	_, err := mapIdentity(rules, cert)
+	if _, ok := err.(*identityError); !ok {
+		t.Errorf("expected identity error for unmapped certificate, got %v", err)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	if err := (*clientAuthSetting)(nil).authorize(QueryportListener, ""); err != nil {
+		t.Errorf("expected any client allowed without client auth, got %v", err)
+	}
+
+	s := &clientAuthSetting{
+		allowed: map[string]map[string]bool{
+			QueryportListener: parseIdentities(" query, admin ,,"),
+			DataportListener:  parseIdentities(""),
+		},
+	}
+	testcases := []struct {
+		listener string
+		identity string
+		allowed  bool
+	}{
+		{QueryportListener, "query", true},
+		{QueryportListener, "admin", true},
+		{QueryportListener, "node", false},
+		// client without certificate
+		{QueryportListener, "", false},
+		{DataportListener, "node", true},
+		{DataportListener, "", true},
+	}
+	for _, tc := range testcases {
+		err := s.authorize(tc.listener, tc.identity)
+		if tc.allowed && err != nil {
+			t.Errorf("%v %q: unexpected error %v", tc.listener, tc.identity, err)
+		} else if !tc.allowed && err == nil {
+			t.Errorf("%v %q: expected error", tc.listener, tc.identity)
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -56,6 +57,14 @@ func setupClientTLSConfig(host string) (*tls.Config, error) {
 	//  Set up cert pool for rootCAs
 	tlsConfig.RootCAs = x509.NewCertPool()
 	tlsConfig.RootCAs.AppendCertsFromPEM(certInBytes)
+	if len(setting.caInBytes) != 0 {
+		tlsConfig.RootCAs.AppendCertsFromPEM(setting.caInBytes)
+	}
+
+	// present node certificate if server asks for client certificate
+	if setting.certificate != nil {
+		tlsConfig.Certificates = []tls.Certificate{*setting.certificate}
+	}
 
 	if IsLocal(host) {
 		// skip server verify if it is localhost
@@ -117,6 +126,7 @@ func makeTLSConn(conn net.Conn) (net.Conn, error) {
 
 		err = <-errChannel
 		if err != nil {
+			atomic.AddUint64(&handshakeStats.clientFailures, 1)
 			return nil, fmt.Errorf("TLS handshake failed when connecting to %v, err=%v\n", host, err)
 		}
 
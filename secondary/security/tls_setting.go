@@ -31,6 +31,10 @@ type SecuritySetting struct {
 	certificate       *tls.Certificate
 	certInBytes       []byte
 	tlsPreference     *cbauth.TLSConfig
+
+	// client certificate authentication
+	caInBytes  []byte
+	clientAuth *clientAuthSetting
 }
 
 var pSecuritySetting unsafe.Pointer = unsafe.Pointer(new(SecuritySetting))
@@ -75,6 +79,11 @@ type SecurityContext struct {
 	// certificate
 	certFile string
 	keyFile  string
+	caFile   string
+
+	// serialize refresh of security setting
+	refreshMutex sync.Mutex
+	watcher      sync.Once
 
 	// encryption for localhost
 	encryptLocalHost bool
@@ -164,6 +173,9 @@ func Refresh(tlsConfig cbauth.TLSConfig, encryptConfig cbauth.ClusterEncryptionC
 
 	logging.Infof("Recieve security change notification. encryption=%v", encryptConfig.EncryptData)
 
+	pSecurityContext.refreshMutex.Lock()
+	defer pSecurityContext.refreshMutex.Unlock()
+
 	newSetting := &SecuritySetting{}
 
 	oldSetting := GetSecuritySetting()
@@ -269,6 +281,9 @@ func (p *SecurityContext) refresh(code uint64) error {
 
 	logging.Infof("Recieve security change notification. code %v", code)
 
+	p.refreshMutex.Lock()
+	defer p.refreshMutex.Unlock()
+
 	newSetting := &SecuritySetting{}
 
 	oldSetting := GetSecuritySetting()
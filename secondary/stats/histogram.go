@@ -6,9 +6,19 @@ import (
 	"sync/atomic"
 )
 
+// LatencyBuckets are the bucket bounds, in nanoseconds, of a latency
+// histogram. The last bucket is unbounded.
+var LatencyBuckets = []int64{
+	10 * 1000, 100 * 1000, 500 * 1000,
+	1000 * 1000, 5 * 1000 * 1000, 10 * 1000 * 1000, 50 * 1000 * 1000,
+	100 * 1000 * 1000, 500 * 1000 * 1000, 1000 * 1000 * 1000,
+	5 * 1000 * 1000 * 1000, math.MaxInt64,
+}
+
 type Histogram struct {
 	buckets    []int64
 	vals       []int64
+	sum        Int64Val
 	humanizeFn func(int64) string
 }
 
@@ -19,6 +29,7 @@ func (h *Histogram) Init(buckets []int64, humanizeFn func(int64) string) {
 	h.buckets[0] = math.MinInt64
 	h.buckets[l] = math.MaxInt64
 	h.vals = make([]int64, l)
+	h.sum.Init()
 
 	if humanizeFn == nil {
 		humanizeFn = func(v int64) string { return fmt.Sprint(v) }
@@ -30,6 +41,18 @@ func (h *Histogram) Init(buckets []int64, humanizeFn func(int64) string) {
 func (h *Histogram) Add(val int64) {
 	i := h.findBucket(val)
 	atomic.AddInt64(&h.vals[i], 1)
+	h.sum.Add(val)
+}
+
+// Merge adds the counts of another histogram with the same buckets.
+func (h *Histogram) Merge(o *Histogram) {
+	if len(o.vals) != len(h.vals) {
+		return
+	}
+	for i := range o.vals {
+		atomic.AddInt64(&h.vals[i], atomic.LoadInt64(&o.vals[i]))
+	}
+	h.sum.Add(o.sum.Value())
 }
 
 func (h *Histogram) findBucket(val int64) int {
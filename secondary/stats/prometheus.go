@@ -0,0 +1,166 @@
+package stats
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// PromLabels are the labels of a metric sample.
+type PromLabels map[string]string
+
+// PromMetrics collects metrics in the Prometheus text exposition
+// format. The samples of a metric are written together, after its
+// HELP and TYPE, in the order the metrics are first added.
+type PromMetrics struct {
+	names    []string
+	families map[string]*promFamily
+}
+
+type promFamily struct {
+	help    string
+	typ     string
+	samples bytes.Buffer
+}
+
+func NewPromMetrics() *PromMetrics {
+	return &PromMetrics{families: make(map[string]*promFamily)}
+}
+
+// Gauge adds a sample of a value that can go up and down.
+func (m *PromMetrics) Gauge(name, help string, labels PromLabels, v float64) {
+	m.addSample(m.family(name, help, "gauge"), name, labels, v)
+}
+
+// Counter adds a sample of a value that only goes up.
+func (m *PromMetrics) Counter(name, help string, labels PromLabels, v float64) {
+	m.addSample(m.family(name, help, "counter"), name, labels, v)
+}
+
+// Histogram adds the cumulative buckets, sum and count of a histogram.
+// Bucket bounds and sum are multiplied by scale, e.g. 1e-9 to export a
+// histogram of nanoseconds in seconds.
+func (m *PromMetrics) Histogram(name, help string, labels PromLabels,
+	h *Histogram, scale float64) {
+
+	if h.vals == nil {
+		return
+	}
+
+	f := m.family(name, help, "histogram")
+
+	var cumulative int64
+	for i := range h.vals {
+		cumulative += atomic.LoadInt64(&h.vals[i])
+
+		le := "+Inf"
+		if bound := h.buckets[i+1]; bound != math.MaxInt64 {
+			le = formatPromValue(float64(bound) * scale)
+		}
+		m.addSample(f, name+"_bucket", withLabel(labels, "le", le), float64(cumulative))
+	}
+
+	m.addSample(f, name+"_sum", labels, float64(h.sum.Value())*scale)
+	m.addSample(f, name+"_count", labels, float64(cumulative))
+}
+
+// Timing adds the sum and count of a timing stat, in seconds, as a
+// summary without quantiles.
+func (m *PromMetrics) Timing(name, help string, labels PromLabels, t *TimingStat) {
+	f := m.family(name, help, "summary")
+	m.addSample(f, name+"_sum", labels, float64(t.Sum.Value())/1e9)
+	m.addSample(f, name+"_count", labels, float64(t.Count.Value()))
+}
+
+// WriteTo writes all the metrics to w.
+func (m *PromMetrics) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for _, name := range m.names {
+		f := m.families[name]
+		c, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n",
+			name, escapePromHelp(f.help), name, f.typ)
+		n += int64(c)
+		if err != nil {
+			return n, err
+		}
+		c64, err := f.samples.WriteTo(w)
+		n += c64
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (m *PromMetrics) family(name, help, typ string) *promFamily {
+	if f, ok := m.families[name]; ok {
+		return f
+	}
+	f := &promFamily{help: help, typ: typ}
+	m.families[name] = f
+	m.names = append(m.names, name)
+	return f
+}
+
+func (m *PromMetrics) addSample(f *promFamily, name string, labels PromLabels, v float64) {
+	f.samples.WriteString(name)
+	if len(labels) != 0 {
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		f.samples.WriteByte('{')
+		for i, k := range keys {
+			if i != 0 {
+				f.samples.WriteByte(',')
+			}
+			f.samples.WriteString(k)
+			f.samples.WriteString(`="`)
+			f.samples.WriteString(escapePromLabel(labels[k]))
+			f.samples.WriteByte('"')
+		}
+		f.samples.WriteByte('}')
+	}
+	f.samples.WriteByte(' ')
+	f.samples.WriteString(formatPromValue(v))
+	f.samples.WriteByte('\n')
+}
+
+func withLabel(labels PromLabels, k, v string) PromLabels {
+	l := make(PromLabels, len(labels)+1)
+	for lk, lv := range labels {
+		l[lk] = lv
+	}
+	l[k] = v
+	return l
+}
+
+func formatPromValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var promHelpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapePromLabel(s string) string {
+	return promLabelEscaper.Replace(s)
+}
+
+func escapePromHelp(s string) string {
+	return promHelpEscaper.Replace(s)
+}
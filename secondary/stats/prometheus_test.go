@@ -0,0 +1,124 @@
+package stats
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPromMetrics(t *testing.T) {
+	m := NewPromMetrics()
+
+	m.Gauge("index_memory_used_bytes", "Memory used", nil, 1024)
+	m.Counter("index_scan_requests_total", "Scan requests",
+		PromLabels{"index": "idx1", "bucket": "default"}, 10)
+	m.Gauge("index_state", "State of the indexer", PromLabels{"state": "Active"}, 1)
+	m.Counter("index_scan_requests_total", "Scan requests",
+		PromLabels{"index": "idx2", "bucket": "default"}, 2.5)
+
+	expected := "# HELP index_memory_used_bytes Memory used\n" +
+		"# TYPE index_memory_used_bytes gauge\n" +
+		"index_memory_used_bytes 1024\n" +
+		"# HELP index_scan_requests_total Scan requests\n" +
+		"# TYPE index_scan_requests_total counter\n" +
+		"index_scan_requests_total{bucket=\"default\",index=\"idx1\"} 10\n" +
+		"index_scan_requests_total{bucket=\"default\",index=\"idx2\"} 2.5\n" +
+		"# HELP index_state State of the indexer\n" +
+		"# TYPE index_state gauge\n" +
+		"index_state{state=\"Active\"} 1\n"
+
+	var buf bytes.Buffer
+	n, err := m.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("expected %v bytes written, got %v", buf.Len(), n)
+	}
+}
+
+func TestPromMetricsEscape(t *testing.T) {
+	m := NewPromMetrics()
+	m.Gauge("index_items_count", "Items in\nthe index \\ partition",
+		PromLabels{"index": "a\"b\\c\nd"}, math.Inf(1))
+	m.Gauge("index_frag_percent", "Fragmentation", nil, math.NaN())
+	m.Gauge("index_resident_percent", "Resident", nil, math.Inf(-1))
+
+	expected := "# HELP index_items_count Items in\\nthe index \\\\ partition\n" +
+		"# TYPE index_items_count gauge\n" +
+		"index_items_count{index=\"a\\\"b\\\\c\\nd\"} +Inf\n" +
+		"# HELP index_frag_percent Fragmentation\n" +
+		"# TYPE index_frag_percent gauge\n" +
+		"index_frag_percent NaN\n" +
+		"# HELP index_resident_percent Resident\n" +
+		"# TYPE index_resident_percent gauge\n" +
+		"index_resident_percent -Inf\n"
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestPromMetricsHistogram(t *testing.T) {
+	var h Histogram
+	h.Init([]int64{1000, 1000000, math.MaxInt64}, nil)
+	h.Add(500)
+	h.Add(1000)
+	h.Add(2000)
+	h.Add(2000000000)
+
+	var uninit Histogram
+
+	m := NewPromMetrics()
+	m.Histogram("index_scan_latency_ms", "Latency of scans",
+		PromLabels{"index": "idx1"}, &h, 0.001)
+	m.Histogram("index_scan_latency_ms", "Latency of scans",
+		PromLabels{"index": "idx2"}, &uninit, 0.001)
+
+	expected := "# HELP index_scan_latency_ms Latency of scans\n" +
+		"# TYPE index_scan_latency_ms histogram\n" +
+		"index_scan_latency_ms_bucket{index=\"idx1\",le=\"1\"} 2\n" +
+		"index_scan_latency_ms_bucket{index=\"idx1\",le=\"1000\"} 3\n" +
+		"index_scan_latency_ms_bucket{index=\"idx1\",le=\"+Inf\"} 4\n" +
+		"index_scan_latency_ms_sum{index=\"idx1\"} 2.0000035e+06\n" +
+		"index_scan_latency_ms_count{index=\"idx1\"} 4\n"
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestPromMetricsTiming(t *testing.T) {
+	var ts TimingStat
+	ts.Init()
+	ts.Put(time.Second)
+	ts.Put(500 * time.Millisecond)
+
+	m := NewPromMetrics()
+	m.Timing("projector_dcp_latency_seconds", "DCP latency", PromLabels{"bucket": "b"}, &ts)
+
+	expected := "# HELP projector_dcp_latency_seconds DCP latency\n" +
+		"# TYPE projector_dcp_latency_seconds summary\n" +
+		"projector_dcp_latency_seconds_sum{bucket=\"b\"} 1.5\n" +
+		"projector_dcp_latency_seconds_count{bucket=\"b\"} 2\n"
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
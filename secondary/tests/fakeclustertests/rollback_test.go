@@ -0,0 +1,316 @@
+// Package fakeclustertests runs projector, indexer and queryport client
+// in-process against a fake cluster. Unlike functionaltests it needs no
+// cluster_run, but indexer keeps process wide state, so a single indexer
+// is started for the package and is never stopped.
+package fakeclustertests
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/dataport"
+	"github.com/couchbase/indexing/secondary/indexer"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/projector"
+	qc "github.com/couchbase/indexing/secondary/queryport/client"
+	"github.com/couchbase/indexing/secondary/tests/framework/fakecluster"
+)
+
+const testUser, testPass = "Administrator", "asdasd"
+
+const numVbuckets = 8
+
+var timeout = 2 * time.Minute
+
+var cluster *fakecluster.Cluster
+
+func TestMain(m *testing.M) {
+	logging.SetLogLevel(logging.Error)
+
+	dir, err := ioutil.TempDir("", "fakeclustertests")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cluster, err = fakecluster.NewCluster(1, testUser, testPass); err != nil {
+		log.Fatal(err)
+	}
+	restore := fakecluster.InstallAuth(cluster)
+	// metakv client of cbauth locates ns_server from the revrpc url.
+	revrpc := fmt.Sprintf("http://%v:%v@%v/index", testUser, testPass, cluster.RestAddr(0))
+	os.Setenv("CBAUTH_REVRPC_URL", revrpc)
+
+	if err := cluster.CreateBucket("default", numVbuckets); err != nil {
+		log.Fatal(err)
+	}
+	settings := fmt.Sprintf(`{"indexer.settings.storage_mode":%q}`, c.MemoryOptimized)
+	cluster.MetakvSet(c.IndexingSettingsMetaPath, []byte(settings))
+
+	if err := startProjector(dir); err != nil {
+		log.Fatal(err)
+	}
+	if err := startIndexer(dir); err != nil {
+		log.Fatal(err)
+	}
+
+	rc := m.Run()
+
+	cluster.Close()
+	restore()
+	os.RemoveAll(dir)
+	os.Exit(rc)
+}
+
+func startProjector(dir string) error {
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+	clusterAddr := cluster.RestAddr(0)
+	config := c.SystemConfig.Clone()
+	config.SetValue("maxVbuckets", numVbuckets)
+	config.SetValue("projector.clusterAddr", clusterAddr)
+	config.SetValue("projector.adminport.listenAddr", net.JoinHostPort("127.0.0.1", port))
+	config.SetValue("projector.diagnostics_dir", dir)
+	epfactory := func(
+		topic, endpointType, addr string, config c.Config) (c.RouterEndpoint, error) {
+
+		return dataport.NewRouterEndpoint(clusterAddr, topic, addr, numVbuckets, config)
+	}
+	config.SetValue("projector.routerEndpointFactory", c.RouterEndpointFactory(epfactory))
+
+	projector.NewProjector(numVbuckets, config, "", "")
+	return setServices("kv", map[string]string{"projector": port})
+}
+
+func startIndexer(dir string) error {
+	names := []string{
+		"adminPort", "scanPort", "httpPort", "streamInitPort",
+		"streamCatchupPort", "streamMaintPort",
+	}
+	ports := make(map[string]string)
+	for _, name := range names {
+		port, err := freePort()
+		if err != nil {
+			return err
+		}
+		ports[name] = port
+	}
+
+	config := c.SystemConfig.Clone()
+	config.SetValue("indexer.clusterAddr", cluster.RestAddr(0))
+	config.SetValue("indexer.numVbuckets", numVbuckets)
+	config.SetValue("indexer.enableManager", true)
+	for _, name := range names {
+		config.SetValue("indexer."+name, ports[name])
+	}
+	config.SetValue("indexer.httpsPort", "")
+	config.SetValue("indexer.storage_dir", dir)
+	config.SetValue("indexer.diagnostics_dir", dir)
+	config.SetValue("indexer.nodeuuid", "fakeclustertests")
+	config.SetValue("indexer.isEnterprise", true)
+
+	// NewIndexer returns only when indexer shuts down.
+	go indexer.NewIndexer(config)
+
+	err := setServices("index", map[string]string{
+		"indexAdmin":         ports["adminPort"],
+		"indexScan":          ports["scanPort"],
+		"indexHttp":          ports["httpPort"],
+		"indexStreamInit":    ports["streamInitPort"],
+		"indexStreamCatchup": ports["streamCatchupPort"],
+		"indexStreamMaint":   ports["streamMaintPort"],
+	})
+	if err != nil {
+		return err
+	}
+	return waitAddr(net.JoinHostPort("127.0.0.1", ports["scanPort"]))
+}
+
+func TestRollback(t *testing.T) {
+	client, err := qc.NewGsiClient(cluster.RestAddr(0), c.SystemConfig.SectionConfig("queryport.client.", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	docids := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		docid := fmt.Sprintf("doc%d", i)
+		if _, _, err := cluster.Set("default", docid, []byte(fmt.Sprintf(`{"age":%d}`, i))); err != nil {
+			t.Fatal(err)
+		}
+		docids[docid] = true
+	}
+
+	defnID, err := client.CreateIndex(
+		"index_age", "default", "gsi", "N1QL", "", "", []string{"`age`"}, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitIndexActive(t, client, defnID)
+	waitDocids(t, client, defnID, docids)
+
+	// mutations after `seqno` of `vb` are indexed, then lost by rollback.
+	vb, err := cluster.VbucketOf("default", "doc0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seqnos, err := cluster.Seqnos("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seqno := seqnos[vb]
+	withLost := make(map[string]bool)
+	for docid := range docids {
+		withLost[docid] = true
+	}
+	for i := 0; len(withLost) < len(docids)+10; i++ {
+		docid := fmt.Sprintf("lost%d", i)
+		if v, err := cluster.VbucketOf("default", docid); err != nil {
+			t.Fatal(err)
+		} else if v != vb {
+			continue
+		}
+		if _, _, err := cluster.Set("default", docid, []byte(`{"age":1000}`)); err != nil {
+			t.Fatal(err)
+		}
+		withLost[docid] = true
+	}
+	waitDocids(t, client, defnID, withLost)
+
+	if err := cluster.Rollback("default", vb, seqno); err != nil {
+		t.Fatal(err)
+	}
+	waitDocids(t, client, defnID, docids)
+
+	// index keeps up with mutations after rollback.
+	if _, _, err := cluster.Set("default", "doc0", []byte(`{"age":2000}`)); err != nil {
+		t.Fatal(err)
+	}
+	waitCount(t, client, defnID, []interface{}{2000}, 1)
+}
+
+func waitIndexActive(t *testing.T, client *qc.GsiClient, defnID uint64) {
+	deadline := time.Now().Add(timeout)
+	for {
+		state, err := client.IndexState(defnID)
+		if err == nil && state == c.INDEX_STATE_ACTIVE {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("index not active after %v, state %v err %v", timeout, state, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// waitDocids scans index `defnID` until it has exactly `docids`.
+func waitDocids(t *testing.T, client *qc.GsiClient, defnID uint64, docids map[string]bool) {
+	expected := sortedKeys(docids)
+	deadline := time.Now().Add(timeout)
+	for {
+		actual, err := scanDocids(client, defnID)
+		if err == nil && fmt.Sprint(actual) == fmt.Sprint(expected) {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("expected %v docids, got %v, err %v", len(expected), len(actual), err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func scanDocids(client *qc.GsiClient, defnID uint64) ([]string, error) {
+	docids := make(map[string]bool)
+	var scanErr error
+	err := client.ScanAll(
+		defnID, "", math.MaxInt64, c.SessionConsistency, nil,
+		func(response qc.ResponseReader) bool {
+			if scanErr = response.Error(); scanErr != nil {
+				return false
+			}
+			_, pkeys, err := response.GetEntries(client.GetDataEncodingFormat())
+			if err != nil {
+				scanErr = err
+				return false
+			}
+			for _, pkey := range pkeys {
+				docids[string(pkey)] = true
+			}
+			return true
+		})
+	if err != nil {
+		return nil, err
+	} else if scanErr != nil {
+		return nil, scanErr
+	}
+	return sortedKeys(docids), nil
+}
+
+func waitCount(t *testing.T, client *qc.GsiClient, defnID uint64, key []interface{}, n int64) {
+	deadline := time.Now().Add(timeout)
+	for {
+		count, err := client.CountRange(
+			defnID, "", c.SecondaryKey(key), c.SecondaryKey(key), qc.Both,
+			c.SessionConsistency, nil)
+		if err == nil && count == n {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("expected count %v of %v, got %v, err %v", n, key, count, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// setServices publishes `ports` of `service` on the only node of cluster.
+func setServices(service string, ports map[string]string) error {
+	services := make(map[string]int)
+	for name, port := range ports {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return err
+		}
+		services[name] = p
+	}
+	return cluster.SetServices(0, service, services)
+}
+
+func freePort() (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer ln.Close()
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	return port, err
+}
+
+func waitAddr(addr string) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return nil
+		} else if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
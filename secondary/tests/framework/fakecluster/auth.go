@@ -0,0 +1,71 @@
+package fakecluster
+
+import (
+	"net/http"
+
+	"github.com/couchbase/cbauth"
+	"github.com/couchbase/cbauth/cbauthimpl"
+)
+
+// InstallAuth sets cbauth.Default to an authenticator that hands out the
+// administrator credentials of cluster `c` for all services and allows
+// every request with them, in place of cbauth talking to ns_server.
+// Returns a function to restore the previous authenticator.
+func InstallAuth(c *Cluster) (restore func()) {
+	prev := cbauth.Default
+	cbauth.Default = &fakeAuthenticator{user: c.user, pass: c.pass}
+	return func() { cbauth.Default = prev }
+}
+
+// fakeAuthenticator implements cbauth.Authenticator{}, methods not
+// overridden panic on the nil interface.
+type fakeAuthenticator struct {
+	cbauth.Authenticator
+	user, pass string
+}
+
+func (a *fakeAuthenticator) GetHTTPServiceAuth(hostport string) (string, string, error) {
+	return a.user, a.pass, nil
+}
+
+func (a *fakeAuthenticator) GetMemcachedServiceAuth(hostport string) (string, string, error) {
+	return a.user, a.pass, nil
+}
+
+func (a *fakeAuthenticator) AuthWebCreds(req *http.Request) (cbauth.Creds, error) {
+	user, pass, ok := req.BasicAuth()
+	if !ok || user != a.user || pass != a.pass {
+		return nil, cbauthimpl.ErrNoAuth
+	}
+	return &fakeCreds{name: user}, nil
+}
+
+func (a *fakeAuthenticator) RegisterConfigRefreshCallback(cb cbauth.ConfigRefreshCallback) error {
+	return cb(cbauth.CFG_CHANGE_CLUSTER_ENCRYPTION)
+}
+
+func (a *fakeAuthenticator) GetClusterEncryptionConfig() (cbauth.ClusterEncryptionConfig, error) {
+	return cbauth.ClusterEncryptionConfig{}, nil
+}
+
+// fakeCreds of the administrator, allowed all permissions.
+type fakeCreds struct {
+	cbauth.Creds
+	name string
+}
+
+func (c *fakeCreds) Name() string {
+	return c.name
+}
+
+func (c *fakeCreds) Domain() string {
+	return "admin"
+}
+
+func (c *fakeCreds) User() (string, string) {
+	return c.name, "admin"
+}
+
+func (c *fakeCreds) IsAllowed(permission string) (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,444 @@
+// Package fakecluster runs an in-process stand-in for a couchbase cluster,
+// so that projector, indexer and queryport client can be tested with
+// `go test` without a real cluster.
+//
+// Each node of the cluster serves the memcached binary protocol, with a
+// DCP producer, on a kv port and a minimal ns_server REST API, pools,
+// buckets, nodeServices, serverGroups and metakv, on a rest port. Buckets
+// are held in memory and shared by all nodes, the vbucket map decides
+// which node streams a vbucket. Failovers, rollbacks and vbucket moves
+// can be injected while streams are active.
+package fakecluster
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+// DefaultVbuckets is the number of vbuckets of a bucket, unless
+// specified.
+const DefaultVbuckets = 64
+
+// Errors returned by fake cluster.
+var (
+	ErrNoBucket      = errors.New("fakecluster.noBucket")
+	ErrBucketExists  = errors.New("fakecluster.bucketExists")
+	ErrInvalidVb     = errors.New("fakecluster.invalidVbucket")
+	ErrInvalidNode   = errors.New("fakecluster.invalidNode")
+	ErrInvalidSeqno  = errors.New("fakecluster.invalidSeqno")
+	ErrClusterClosed = errors.New("fakecluster.closed")
+)
+
+// Cluster of fake nodes.
+type Cluster struct {
+	mu      sync.Mutex
+	uuid    string
+	rev     int
+	user    string
+	pass    string
+	nodes   []*node
+	buckets map[string]*bucket
+	metakv  *metakvStore
+	changed chan struct{} // closed and replaced on every config change
+	closed  bool
+	uuids   uint64 // source of vbuuids and bucket uuids
+}
+
+type node struct {
+	id       int
+	cluster  *Cluster
+	kvln     net.Listener
+	restln   net.Listener
+	kvaddr   string
+	restaddr string
+	uuid     string
+	group    string
+	failed   bool
+	roles    []string       // services running on the node, like "kv"
+	services map[string]int // service name -> port
+	conns    map[*dcpConn]bool
+}
+
+// NewCluster starts a cluster of `numNodes` nodes listening on
+// loopback. REST API and memcached connections are authenticated with
+// `user` and `pass`.
+func NewCluster(numNodes int, user, pass string) (*Cluster, error) {
+	if numNodes <= 0 {
+		return nil, ErrInvalidNode
+	}
+
+	c := &Cluster{
+		uuid:    fmt.Sprintf("%x", time.Now().UnixNano()),
+		rev:     1,
+		user:    user,
+		pass:    pass,
+		buckets: make(map[string]*bucket),
+		metakv:  newMetakvStore(),
+		changed: make(chan struct{}),
+		uuids:   uint64(time.Now().UnixNano()),
+	}
+	for i := 0; i < numNodes; i++ {
+		n, err := c.startNode(i)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.nodes = append(c.nodes, n)
+	}
+	logging.Infof("FakeCluster: started %v nodes, rest %v", numNodes, c.URL())
+	return c, nil
+}
+
+func (c *Cluster) startNode(id int) (n *node, err error) {
+	n = &node{
+		id:       id,
+		cluster:  c,
+		uuid:     fmt.Sprintf("%v-node-%d", c.uuid, id),
+		group:    "Group 1",
+		roles:    []string{"kv"},
+		services: make(map[string]int),
+		conns:    make(map[*dcpConn]bool),
+	}
+	if n.kvln, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		return nil, err
+	}
+	if n.restln, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		n.kvln.Close()
+		return nil, err
+	}
+	n.kvaddr, n.restaddr = n.kvln.Addr().String(), n.restln.Addr().String()
+	n.services["mgmt"] = portOf(n.restaddr)
+	n.services["kv"] = portOf(n.kvaddr)
+
+	go n.serveKV()
+	go n.serveREST()
+	return n, nil
+}
+
+// Close all nodes of the cluster, active streams are disconnected.
+func (c *Cluster) Close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	var conns []*dcpConn
+	for _, n := range c.nodes {
+		n.kvln.Close()
+		n.restln.Close()
+		for conn := range n.conns {
+			conns = append(conns, conn)
+		}
+	}
+	c.notifyLocked()
+	c.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.close()
+	}
+	logging.Infof("FakeCluster: closed")
+}
+
+// URL of the cluster, that is the REST endpoint of its first node.
+func (c *Cluster) URL() string {
+	return "http://" + c.nodes[0].restaddr
+}
+
+// NumNodes in the cluster.
+func (c *Cluster) NumNodes() int {
+	return len(c.nodes)
+}
+
+// RestAddr returns the host:port of REST API on node `n`.
+func (c *Cluster) RestAddr(n int) string {
+	return c.nodes[n].restaddr
+}
+
+// KVAddr returns the host:port of memcached on node `n`.
+func (c *Cluster) KVAddr(n int) string {
+	return c.nodes[n].kvaddr
+}
+
+// Credentials of cluster administrator.
+func (c *Cluster) Credentials() (user, pass string) {
+	return c.user, c.pass
+}
+
+// SetServices publishes `ports` of services, like "indexAdmin",
+// "indexScan", "indexHttp" or "projector", running on node `n` in
+// nodeServices and marks the node as running `service`, like "index".
+func (c *Cluster) SetServices(n int, service string, ports map[string]int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if n < 0 || n >= len(c.nodes) {
+		return ErrInvalidNode
+	}
+	node := c.nodes[n]
+	found := false
+	for _, role := range node.roles {
+		found = found || role == service
+	}
+	if !found {
+		node.roles = append(node.roles, service)
+	}
+	for name, port := range ports {
+		node.services[name] = port
+	}
+	c.notifyLocked()
+	return nil
+}
+
+// SetServerGroup moves node `n` to server `group`.
+func (c *Cluster) SetServerGroup(n int, group string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if n < 0 || n >= len(c.nodes) {
+		return ErrInvalidNode
+	}
+	c.nodes[n].group = group
+	c.notifyLocked()
+	return nil
+}
+
+// CreateBucket with `numVbuckets` vbuckets, a power of 2, distributed
+// evenly across the nodes.
+func (c *Cluster) CreateBucket(name string, numVbuckets int) error {
+	if numVbuckets <= 0 || numVbuckets&(numVbuckets-1) != 0 {
+		return ErrInvalidVb
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClusterClosed
+	} else if _, ok := c.buckets[name]; ok {
+		return ErrBucketExists
+	}
+	b := &bucket{
+		name:     name,
+		uuid:     fmt.Sprintf("%x", c.nextUUIDLocked()),
+		vbuckets: make([]*vbucket, numVbuckets),
+	}
+	active := c.activeNodesLocked()
+	for i := range b.vbuckets {
+		b.vbuckets[i] = newVbucket(uint16(i), active[i%len(active)], c.nextUUIDLocked())
+	}
+	c.buckets[name] = b
+	c.notifyLocked()
+	logging.Infof("FakeCluster: created bucket %v with %v vbuckets", name, numVbuckets)
+	return nil
+}
+
+// DropBucket and disconnect its streams.
+func (c *Cluster) DropBucket(name string) error {
+	c.mu.Lock()
+	b, ok := c.buckets[name]
+	if !ok {
+		c.mu.Unlock()
+		return ErrNoBucket
+	}
+	delete(c.buckets, name)
+	var conns []*dcpConn
+	for _, n := range c.nodes {
+		for conn := range n.conns {
+			if conn.bucket == b.name {
+				conns = append(conns, conn)
+			}
+		}
+	}
+	c.notifyLocked()
+	c.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.close()
+	}
+	return nil
+}
+
+// Buckets return the name of buckets in the cluster.
+func (c *Cluster) Buckets() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bucketNamesLocked()
+}
+
+//---------------------------
+// fault injection
+//---------------------------
+
+// Failover vbucket `vbno` of `bucket`, a new branch is added to its
+// failover log at its current seqno and active streams are ended. A
+// stream can be resumed from any seqno seen by the client.
+func (c *Cluster) Failover(bucket string, vbno uint16) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vb, err := c.getVbucketLocked(bucket, vbno)
+	if err != nil {
+		return err
+	}
+	vb.failover(c.nextUUIDLocked(), vb.seqno)
+	vb.endStreams(streamEndStateChanged)
+	logging.Infof("FakeCluster: failover %v vb %v at seqno %v", bucket, vbno, vb.seqno)
+	return nil
+}
+
+// Rollback vbucket `vbno` of `bucket` to `seqno`, as if it failed over to
+// a replica that is behind. Mutations after `seqno` are lost, a new branch
+// is added to failover log and active streams are ended. A client resuming
+// from a later seqno is asked to rollback.
+func (c *Cluster) Rollback(bucket string, vbno uint16, seqno uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vb, err := c.getVbucketLocked(bucket, vbno)
+	if err != nil {
+		return err
+	} else if seqno > vb.seqno {
+		return ErrInvalidSeqno
+	}
+	vb.truncate(seqno)
+	vb.failover(c.nextUUIDLocked(), seqno)
+	vb.endStreams(streamEndStateChanged)
+	logging.Infof("FakeCluster: rollback %v vb %v to seqno %v", bucket, vbno, seqno)
+	return nil
+}
+
+// MoveVbucket `vbno` of `bucket` to node `to`, as done by rebalance. Active
+// streams on the old node are ended and the bucket's vbucket map is
+// updated, stream requests on the old node fail with NOT_MY_VBUCKET.
+func (c *Cluster) MoveVbucket(bucket string, vbno uint16, to int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vb, err := c.getVbucketLocked(bucket, vbno)
+	if err != nil {
+		return err
+	} else if to < 0 || to >= len(c.nodes) || c.nodes[to].failed {
+		return ErrInvalidNode
+	}
+	if vb.node != to {
+		vb.node = to
+		vb.endStreams(streamEndStateChanged)
+		c.notifyLocked()
+	}
+	logging.Infof("FakeCluster: moved %v vb %v to node %v", bucket, vbno, to)
+	return nil
+}
+
+// FailoverNode `n`, its vbuckets of all buckets failover to the other
+// nodes and its connections are dropped. The node stays up but owns no
+// vbuckets.
+func (c *Cluster) FailoverNode(n int) error {
+	c.mu.Lock()
+	if n < 0 || n >= len(c.nodes) || c.nodes[n].failed {
+		c.mu.Unlock()
+		return ErrInvalidNode
+	}
+	node := c.nodes[n]
+	node.failed = true
+	active := c.activeNodesLocked()
+	if len(active) == 0 {
+		node.failed = false
+		c.mu.Unlock()
+		return ErrInvalidNode
+	}
+
+	i := 0
+	for _, b := range c.buckets {
+		for _, vb := range b.vbuckets {
+			if vb.node == n {
+				vb.node = active[i%len(active)]
+				vb.failover(c.nextUUIDLocked(), vb.seqno)
+				vb.endStreams(streamEndStateChanged)
+				i++
+			}
+		}
+	}
+	conns := make([]*dcpConn, 0, len(node.conns))
+	for conn := range node.conns {
+		conns = append(conns, conn)
+	}
+	c.notifyLocked()
+	c.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.close()
+	}
+	logging.Infof("FakeCluster: failover node %v, %v vbuckets moved", n, i)
+	return nil
+}
+
+//---------------------------
+// local functions
+//---------------------------
+
+// notifyLocked bumps the config revision and wakes up streaming REST
+// clients.
+func (c *Cluster) notifyLocked() {
+	c.rev++
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *Cluster) nextUUIDLocked() uint64 {
+	c.uuids = c.uuids*6364136223846793005 + 1442695040888963407
+	return c.uuids
+}
+
+func (c *Cluster) activeNodesLocked() []int {
+	active := make([]int, 0, len(c.nodes))
+	for _, n := range c.nodes {
+		if !n.failed {
+			active = append(active, n.id)
+		}
+	}
+	return active
+}
+
+func (c *Cluster) bucketNamesLocked() []string {
+	names := make([]string, 0, len(c.buckets))
+	for name := range c.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Cluster) getBucketLocked(name string) (*bucket, error) {
+	if c.closed {
+		return nil, ErrClusterClosed
+	}
+	b, ok := c.buckets[name]
+	if !ok {
+		return nil, ErrNoBucket
+	}
+	return b, nil
+}
+
+func (c *Cluster) getVbucketLocked(bucket string, vbno uint16) (*vbucket, error) {
+	b, err := c.getBucketLocked(bucket)
+	if err != nil {
+		return nil, err
+	} else if int(vbno) >= len(b.vbuckets) {
+		return nil, ErrInvalidVb
+	}
+	return b.vbuckets[vbno], nil
+}
+
+func portOf(hostport string) int {
+	_, port, _ := net.SplitHostPort(hostport)
+	p, _ := strconv.Atoi(port)
+	return p
+}
@@ -0,0 +1,330 @@
+package fakecluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	couchbase "github.com/couchbase/indexing/secondary/dcp"
+	"github.com/couchbase/indexing/secondary/dcp/transport"
+	memcached "github.com/couchbase/indexing/secondary/dcp/transport/client"
+)
+
+const testUser, testPass = "Administrator", "asdasd"
+
+type testAuth struct{}
+
+func (testAuth) GetCredentials() (string, string) {
+	return testUser, testPass
+}
+
+func (testAuth) AuthenticateMemcachedConn(host string, conn *memcached.Client) error {
+	if _, err := conn.Auth(testUser, testPass); err != nil {
+		return err
+	}
+	_, err := conn.SelectBucket("default")
+	return err
+}
+
+var feedConfig = map[string]interface{}{
+	"genChanSize":    100,
+	"dataChanSize":   1000,
+	"numConnections": 1,
+	"activeVbOnly":   true,
+}
+
+func TestStreamMutations(t *testing.T) {
+	c, b, done := startCluster(t, 2, 8)
+	defer done()
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("doc%d", i)
+		if _, _, err := c.Set("default", key, []byte(fmt.Sprintf(`{"n":%d}`, i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// only the latest version is backfilled.
+	c.Set("default", "doc0", []byte(`{"n":100}`))
+
+	feed := startFeed(t, b, "streammutations")
+	defer feed.Close()
+	for vb := 0; vb < 8; vb++ {
+		requestStream(t, feed, uint16(vb), 0, 0)
+	}
+
+	docs := make(map[string]string)
+	receive(t, feed, func(e *memcached.DcpEvent) bool {
+		if e.Opcode == transport.DCP_MUTATION {
+			if e.Datatype&datatypeJSON == 0 {
+				t.Errorf("expected json datatype for %s", e.Key)
+			}
+			docs[string(e.Key)] = string(e.Value)
+		}
+		return len(docs) == 20
+	})
+	if docs["doc0"] != `{"n":100}` {
+		t.Errorf("expected latest version of doc0, got %v", docs["doc0"])
+	}
+
+	// mutations after backfill are streamed from memory.
+	c.Set("default", "doc1", []byte(`{"n":101}`))
+	c.Delete("default", "doc2")
+	deleted := false
+	receive(t, feed, func(e *memcached.DcpEvent) bool {
+		switch e.Opcode {
+		case transport.DCP_MUTATION:
+			docs[string(e.Key)] = string(e.Value)
+		case transport.DCP_DELETION:
+			deleted = deleted || string(e.Key) == "doc2"
+		}
+		return deleted && docs["doc1"] == `{"n":101}`
+	})
+}
+
+func TestRollback(t *testing.T) {
+	c, b, done := startCluster(t, 1, 4)
+	defer done()
+
+	keys := keysOfVbucket(t, c, 1, 3)
+	for _, key := range keys {
+		c.Set("default", key, []byte(`{}`))
+	}
+
+	feed := startFeed(t, b, "rollback")
+	defer feed.Close()
+	requestStream(t, feed, 1, 0, 3)
+	var vbuuid uint64
+	receive(t, feed, func(e *memcached.DcpEvent) bool {
+		if e.Opcode == transport.DCP_STREAMREQ {
+			vbuuid, _, _ = e.FailoverLog.Latest()
+		}
+		return e.Opcode == transport.DCP_STREAMEND
+	})
+
+	if err := c.Rollback("default", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := c.Get("default", keys[2]); ok {
+		t.Errorf("expected %v to be rolled back", keys[2])
+	}
+
+	// resuming from seqno 3 needs a rollback to 1.
+	err := feed.DcpRequestStream(1, 1, 0, vbuuid, 3, math.MaxUint64, 3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive(t, feed, func(e *memcached.DcpEvent) bool {
+		if e.Opcode != transport.DCP_STREAMREQ {
+			return false
+		} else if e.Status != transport.ROLLBACK || e.Seqno != 1 {
+			t.Fatalf("expected rollback to 1, got %v %v", e.Status, e.Seqno)
+		}
+		return true
+	})
+
+	// resuming from seqno 1 of old branch is fine.
+	err = feed.DcpRequestStream(1, 1, 0, vbuuid, 1, math.MaxUint64, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set("default", keys[2], []byte(`{"n":1}`))
+	receive(t, feed, func(e *memcached.DcpEvent) bool {
+		switch e.Opcode {
+		case transport.DCP_STREAMREQ:
+			if e.Status != transport.SUCCESS {
+				t.Fatalf("expected success, got %v", e.Status)
+			} else if len(*e.FailoverLog) != 2 {
+				t.Fatalf("expected 2 failover entries, got %v", *e.FailoverLog)
+			}
+		case transport.DCP_MUTATION:
+			if e.Seqno != 2 {
+				t.Fatalf("expected seqno 2, got %v", e.Seqno)
+			}
+			return true
+		}
+		return false
+	})
+}
+
+func TestMoveVbucket(t *testing.T) {
+	c, b, done := startCluster(t, 2, 4)
+	defer done()
+
+	feed := startFeed(t, b, "movevbucket")
+	defer feed.Close()
+	requestStream(t, feed, 0, 0, 0)
+	receive(t, feed, func(e *memcached.DcpEvent) bool {
+		return e.Opcode == transport.DCP_STREAMREQ
+	})
+
+	if err := c.MoveVbucket("default", 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, feed, func(e *memcached.DcpEvent) bool {
+		return e.Opcode == transport.DCP_STREAMEND && e.VBucket == 0
+	})
+
+	if err := b.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if node := b.VBServerMap().VBucketMap[0][0]; node != 1 {
+		t.Errorf("expected vbucket 0 on node 1, got %v", node)
+	}
+}
+
+func TestNodeServices(t *testing.T) {
+	c, b, done := startCluster(t, 2, 4)
+	defer done()
+
+	ports := map[string]int{"indexAdmin": 9100, "indexScan": 9101}
+	if err := c.SetServices(1, "index", ports); err != nil {
+		t.Fatal(err)
+	}
+	client := b.GetPool().GetClient()
+	ps, err := client.GetPoolServices("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps.NodesExt) != 2 || ps.NodesExt[1].Services["indexScan"] != 9101 {
+		t.Errorf("unexpected node services %v", ps.NodesExt)
+	}
+
+	c.SetServerGroup(1, "Group 2")
+	groups, err := b.GetPool().GetServerGroups()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(groups.Groups) != 2 || groups.Groups[1].Name != "Group 2" {
+		t.Errorf("unexpected server groups %v", groups)
+	}
+}
+
+func TestMetakv(t *testing.T) {
+	c, _, done := startCluster(t, 1, 4)
+	defer done()
+
+	do := func(method, path string, form url.Values) (int, string) {
+		u := c.URL() + metakvPrefix + path
+		var req *http.Request
+		if form != nil {
+			req, _ = http.NewRequest(method, u, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req, _ = http.NewRequest(method, u, nil)
+		}
+		req.SetBasicAuth(testUser, testPass)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		return res.StatusCode, string(body)
+	}
+
+	status, _ := do("PUT", "/indexing/a", url.Values{"value": {"1"}, "create": {"true"}})
+	if status != http.StatusOK {
+		t.Fatalf("put failed with %v", status)
+	}
+	status, _ = do("PUT", "/indexing/a", url.Values{"value": {"2"}, "create": {"true"}})
+	if status != http.StatusConflict {
+		t.Errorf("expected conflict, got %v", status)
+	}
+	c.MetakvSet("/indexing/b", []byte("3"))
+	if value, ok := c.MetakvGet("/indexing/a"); !ok || string(value) != "1" {
+		t.Errorf("unexpected value %q", value)
+	}
+
+	status, body := do("GET", "/indexing/", nil)
+	if status != http.StatusOK || !strings.Contains(body, `"path":"/indexing/b"`) {
+		t.Errorf("unexpected listing %v %v", status, body)
+	}
+	do("DELETE", "/indexing/", nil)
+	if status, _ = do("GET", "/indexing/a", nil); status != http.StatusNotFound {
+		t.Errorf("expected not found, got %v", status)
+	}
+}
+
+// startCluster with bucket "default" and connect to it, returns a
+// function to close them.
+func startCluster(
+	t *testing.T, numNodes, numVbuckets int) (*Cluster, *couchbase.Bucket, func()) {
+
+	c, err := NewCluster(numNodes, testUser, testPass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore := InstallAuth(c)
+	if err := c.CreateBucket("default", numVbuckets); err != nil {
+		t.Fatal(err)
+	}
+	client, err := couchbase.ConnectWithAuth(c.URL(), testAuth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := client.GetPool("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := pool.GetBucket("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, b, func() {
+		b.Close()
+		c.Close()
+		restore()
+	}
+}
+
+func startFeed(t *testing.T, b *couchbase.Bucket, name string) *couchbase.DcpFeed {
+	feedname := couchbase.NewDcpFeedName(name)
+	feed, err := b.StartDcpFeedOver(feedname, 0, 0, nil, 0xABCD, feedConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feed
+}
+
+func requestStream(t *testing.T, feed *couchbase.DcpFeed, vb uint16, start, end uint64) {
+	if end == 0 {
+		end = math.MaxUint64
+	}
+	if err := feed.DcpRequestStream(vb, vb, 0, 0, start, end, start, start); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// receive events until `fn` returns true.
+func receive(t *testing.T, feed *couchbase.DcpFeed, fn func(*memcached.DcpEvent) bool) {
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case e, ok := <-feed.C:
+			if !ok {
+				t.Fatal("feed closed")
+			} else if fn(e) {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for events")
+		}
+	}
+}
+
+func keysOfVbucket(t *testing.T, c *Cluster, vb uint16, n int) []string {
+	keys := make([]string, 0, n)
+	for i := 0; len(keys) < n; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if v, err := c.VbucketOf("default", key); err != nil {
+			t.Fatal(err)
+		} else if v == vb {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,219 @@
+package fakecluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const metakvPrefix = "/_metakv"
+
+// metakvEntry is the JSON form of an entry, as in cbauth/metakv.
+type metakvEntry struct {
+	Path  string `json:"path,omitempty"`
+	Value []byte `json:"value"`
+	Rev   []byte `json:"rev"`
+}
+
+// metakvStore serves a flat key-value store under /_metakv, keys ending
+// with "/" are directories. Every update bumps the revision of the entry,
+// PUT and DELETE with a stale revision fail with 409.
+type metakvStore struct {
+	mu      sync.Mutex
+	entries map[string]*metakvEntry
+	rev     uint64
+	changed chan struct{} // closed and replaced on every update
+}
+
+func newMetakvStore() *metakvStore {
+	return &metakvStore{
+		entries: make(map[string]*metakvEntry),
+		changed: make(chan struct{}),
+	}
+}
+
+func (m *metakvStore) handle(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, metakvPrefix)
+	isDir := strings.HasSuffix(path, "/")
+
+	switch r.Method {
+	case "GET":
+		if !isDir {
+			m.get(w, path)
+		} else if r.URL.Query().Get("feed") == "continuous" {
+			m.feed(w, r, path)
+		} else {
+			writeJSON(w, m.list(path))
+		}
+
+	case "PUT":
+		if err := r.ParseForm(); err != nil || isDir {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		create := r.PostForm.Get("create") != ""
+		rev := r.PostForm.Get("rev")
+		value := []byte(r.PostForm.Get("value"))
+		w.WriteHeader(m.set(path, value, rev, create))
+
+	case "DELETE":
+		w.WriteHeader(m.delete(path, r.URL.Query().Get("rev"), isDir))
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (m *metakvStore) get(w http.ResponseWriter, path string) {
+	m.mu.Lock()
+	e, ok := m.entries[path]
+	m.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, nil)
+		return
+	}
+	writeJSON(w, &metakvEntry{Value: e.Value, Rev: e.Rev})
+}
+
+// list entries under directory `path`, recursively, ordered by path.
+func (m *metakvStore) list(path string) []*metakvEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := make([]*metakvEntry, 0)
+	for p, e := range m.entries {
+		if strings.HasPrefix(p, path) {
+			entries = append(entries, e)
+		}
+	}
+	sort.Sort(metakvEntries(entries))
+	return entries
+}
+
+type metakvEntries []*metakvEntry
+
+func (s metakvEntries) Len() int           { return len(s) }
+func (s metakvEntries) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s metakvEntries) Less(i, j int) bool { return s[i].Path < s[j].Path }
+
+// feed writes entries under directory `path`, and every update to them
+// after that, until the client goes away. Deleted entries are sent
+// with nil value.
+func (m *metakvStore) feed(w http.ResponseWriter, r *http.Request, path string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	seen := make(map[string][]byte) // path -> rev
+	for {
+		m.mu.Lock()
+		changed := m.changed
+		m.mu.Unlock()
+
+		current := make(map[string]bool)
+		for _, e := range m.list(path) {
+			current[e.Path] = true
+			if rev, ok := seen[e.Path]; ok && string(rev) == string(e.Rev) {
+				continue
+			}
+			seen[e.Path] = e.Rev
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+		}
+		for p := range seen {
+			if !current[p] {
+				delete(seen, p)
+				if err := enc.Encode(&metakvEntry{Path: p}); err != nil {
+					return
+				}
+			}
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (m *metakvStore) set(path string, value []byte, rev string, create bool) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[path]
+	if ok && (create || (rev != "" && rev != string(e.Rev))) {
+		return http.StatusConflict
+	} else if !ok && rev != "" {
+		return http.StatusConflict
+	}
+	m.rev++
+	m.entries[path] = &metakvEntry{
+		Path:  path,
+		Value: value,
+		Rev:   []byte(strconv.FormatUint(m.rev, 10)),
+	}
+	m.notifyLocked()
+	return http.StatusOK
+}
+
+func (m *metakvStore) delete(path string, rev string, isDir bool) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if isDir {
+		for p := range m.entries {
+			if strings.HasPrefix(p, path) {
+				delete(m.entries, p)
+			}
+		}
+		m.notifyLocked()
+		return http.StatusOK
+	}
+
+	e, ok := m.entries[path]
+	if !ok {
+		return http.StatusNotFound
+	} else if rev != "" && rev != string(e.Rev) {
+		return http.StatusConflict
+	}
+	delete(m.entries, path)
+	m.notifyLocked()
+	return http.StatusOK
+}
+
+func (m *metakvStore) notifyLocked() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+//---------------------------
+// metakv API
+//---------------------------
+
+// MetakvGet returns the value of metakv `path`.
+func (c *Cluster) MetakvGet(path string) ([]byte, bool) {
+	m := c.metakv
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.entries[path]; ok {
+		return append([]byte(nil), e.Value...), true
+	}
+	return nil, false
+}
+
+// MetakvSet sets metakv `path` to `value`, as if set by another node.
+func (c *Cluster) MetakvSet(path string, value []byte) {
+	c.metakv.set(path, append([]byte(nil), value...), "", false)
+}
@@ -0,0 +1,589 @@
+package fakecluster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/dcp/transport"
+	memcached "github.com/couchbase/indexing/secondary/dcp/transport/server"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+const datatypeJSON = uint8(0x1)
+
+const statusAuthError = transport.Status(0x20)
+
+// flags in DCP_STREAMEND.
+const (
+	streamEndOK           = uint32(0x0)
+	streamEndClosed       = uint32(0x1)
+	streamEndStateChanged = uint32(0x2)
+	streamEndDisconnected = uint32(0x3)
+)
+
+// type of DCP_SNAPSHOT.
+const (
+	snapshotMemory = uint32(0x1)
+	snapshotDisk   = uint32(0x2)
+)
+
+func (n *node) serveKV() {
+	for {
+		conn, err := n.kvln.Accept()
+		if err != nil {
+			return
+		}
+		c := n.cluster
+		dc := &dcpConn{
+			node:    n,
+			conn:    conn,
+			streams: make(map[uint16]*stream),
+			closech: make(chan struct{}),
+		}
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			conn.Close()
+			return
+		}
+		n.conns[dc] = true
+		c.mu.Unlock()
+		go dc.run()
+	}
+}
+
+// dcpConn is a memcached connection on a node, opened as DCP producer
+// on DCP_OPEN. Requests are handled in the order received, while
+// streams write to the connection from their own routines.
+type dcpConn struct {
+	node    *node
+	conn    net.Conn
+	wmu     sync.Mutex // serializes packets written to conn
+	bucket  string
+	name    string             // DCP connection name
+	streams map[uint16]*stream // vbno -> stream, guarded by cluster mutex
+	noopOn  bool
+	noop    time.Duration // noop interval, guarded by wmu
+	once    sync.Once
+	closech chan struct{}
+}
+
+func (dc *dcpConn) run() {
+	defer dc.close()
+
+	for {
+		if err := memcached.HandleMessage(dc.conn, dc.conn, dc); err != nil {
+			if err != io.EOF {
+				logging.Debugf("FakeCluster: node %v connection %q: %v",
+					dc.node.id, dc.name, err)
+			}
+			return
+		}
+	}
+}
+
+func (dc *dcpConn) close() {
+	dc.once.Do(func() {
+		close(dc.closech)
+		dc.conn.Close()
+
+		c := dc.node.cluster
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, s := range dc.streams {
+			delete(s.vb.streams, s)
+		}
+		dc.streams = make(map[uint16]*stream)
+		delete(dc.node.conns, dc)
+	})
+}
+
+// HandleMessage implements memcached.RequestHandler{}. Responses are
+// transmitted by the handler, interleaved with stream messages, hence
+// nil is returned.
+func (dc *dcpConn) HandleMessage(
+	_ io.Writer, req *transport.MCRequest) *transport.MCResponse {
+
+	res := &transport.MCResponse{
+		Opcode: req.Opcode,
+		Opaque: req.Opaque,
+	}
+
+	switch req.Opcode {
+	case transport.SASL_LIST_MECHS:
+		res.Body = []byte("PLAIN")
+
+	case transport.SASL_AUTH:
+		res.Status = dc.handleAuth(req)
+
+	case transport.SELECT_BUCKET:
+		res.Status = dc.selectBucket(string(req.Key))
+
+	case transport.HELO:
+		res.Body = handleHelo(req.Body)
+
+	case transport.DCP_OPEN:
+		dc.name = string(req.Key)
+		if dc.bucket == "" {
+			// no bucket selected, authenticated as bucket of old.
+			res.Status = dc.selectBucket("default")
+		}
+
+	case transport.DCP_CONTROL:
+		res.Status = dc.handleControl(string(req.Key), string(req.Body))
+
+	case transport.DCP_BUFFERACK, transport.DCP_NOOP:
+		// flow control is not enforced, noop is a response.
+		return nil
+
+	case transport.DCP_GET_SEQNO:
+		res.Status, res.Body = dc.handleGetSeqnos()
+
+	case transport.DCP_FAILOVERLOG:
+		res.Status, res.Body = dc.handleFailoverLog(req.VBucket)
+
+	case transport.DCP_STREAMREQ:
+		dc.handleStreamRequest(req, res)
+		return nil
+
+	case transport.DCP_CLOSESTREAM:
+		res.Status = dc.handleCloseStream(req.VBucket)
+
+	case transport.GET:
+		res.Status, res.Extras, res.Body, res.Cas = dc.handleGet(req)
+
+	case transport.SET, transport.DELETE:
+		res.Status, res.Cas = dc.handleStore(req)
+
+	default:
+		res.Status = transport.UNKNOWN_COMMAND
+	}
+	dc.transmit(res)
+	return nil
+}
+
+func (dc *dcpConn) handleAuth(req *transport.MCRequest) transport.Status {
+	parts := bytes.Split(req.Body, []byte{0})
+	if len(parts) != 3 {
+		return statusAuthError
+	}
+	user, pass := string(parts[1]), string(parts[2])
+	c := dc.node.cluster
+	if user == c.user && pass == c.pass {
+		return transport.SUCCESS
+	}
+	// authenticated as bucket, password is not checked.
+	if status := dc.selectBucket(user); status != transport.SUCCESS {
+		return statusAuthError
+	}
+	return transport.SUCCESS
+}
+
+func (dc *dcpConn) selectBucket(name string) transport.Status {
+	c := dc.node.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.getBucketLocked(name); err != nil {
+		return transport.KEY_ENOENT
+	}
+	dc.bucket = name
+	return transport.SUCCESS
+}
+
+// handleHelo acknowledges xattr and json, collections and snappy are not
+// supported.
+func handleHelo(body []byte) []byte {
+	ack := make([]byte, 0, len(body))
+	for i := 0; i+2 <= len(body); i += 2 {
+		switch transport.Feature(binary.BigEndian.Uint16(body[i:])) {
+		case transport.FeatureXattr, transport.FeatureJSON:
+			ack = append(ack, body[i:i+2]...)
+		}
+	}
+	return ack
+}
+
+func (dc *dcpConn) handleControl(key, value string) transport.Status {
+	switch key {
+	case "enable_noop":
+		if value == "true" && !dc.noopOn {
+			dc.noopOn = true
+			dc.wmu.Lock()
+			if dc.noop == 0 {
+				dc.noop = 20 * time.Second
+			}
+			dc.wmu.Unlock()
+			go dc.sendNoops()
+		}
+
+	case "set_noop_interval":
+		secs, err := strconv.Atoi(value)
+		if err != nil || secs <= 0 {
+			return transport.EINVAL
+		}
+		dc.wmu.Lock()
+		dc.noop = time.Duration(secs) * time.Second
+		dc.wmu.Unlock()
+	}
+	return transport.SUCCESS
+}
+
+func (dc *dcpConn) handleGetSeqnos() (transport.Status, []byte) {
+	c := dc.node.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, err := c.getBucketLocked(dc.bucket)
+	if err != nil {
+		return transport.EINVAL, nil
+	}
+	body := make([]byte, 0, 10*len(b.vbuckets))
+	for _, vb := range b.vbuckets {
+		if vb.node != dc.node.id {
+			continue
+		}
+		var entry [10]byte
+		binary.BigEndian.PutUint16(entry[:2], vb.vbno)
+		binary.BigEndian.PutUint64(entry[2:], vb.seqno)
+		body = append(body, entry[:]...)
+	}
+	return transport.SUCCESS, body
+}
+
+func (dc *dcpConn) handleFailoverLog(vbno uint16) (transport.Status, []byte) {
+	c := dc.node.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vb, err := c.getVbucketLocked(dc.bucket, vbno)
+	if err != nil {
+		return transport.EINVAL, nil
+	} else if vb.node != dc.node.id {
+		return transport.NOT_MY_VBUCKET, nil
+	}
+	return transport.SUCCESS, encodeFailoverLog(vb.flog)
+}
+
+func (dc *dcpConn) handleStreamRequest(
+	req *transport.MCRequest, res *transport.MCResponse) {
+
+	if len(req.Extras) < 48 {
+		res.Status = transport.EINVAL
+		dc.transmit(res)
+		return
+	}
+	start := binary.BigEndian.Uint64(req.Extras[8:16])
+	end := binary.BigEndian.Uint64(req.Extras[16:24])
+	vbuuid := binary.BigEndian.Uint64(req.Extras[24:32])
+	snapStart := binary.BigEndian.Uint64(req.Extras[32:40])
+	snapEnd := binary.BigEndian.Uint64(req.Extras[40:48])
+
+	c := dc.node.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vb, err := c.getVbucketLocked(dc.bucket, req.VBucket)
+	switch {
+	case err != nil:
+		res.Status = transport.EINVAL
+
+	case vb.node != dc.node.id:
+		res.Status = transport.NOT_MY_VBUCKET
+
+	case dc.streams[vb.vbno] != nil:
+		res.Status = transport.KEY_EEXISTS
+
+	case start > end:
+		res.Status = transport.ERANGE
+	}
+	if res.Status != transport.SUCCESS {
+		dc.transmit(res)
+		return
+	}
+
+	if seqno, ok := vb.rollbackSeqno(vbuuid, start, snapStart, snapEnd); ok {
+		res.Status, res.Body = transport.ROLLBACK, make([]byte, 8)
+		binary.BigEndian.PutUint64(res.Body, seqno)
+		dc.transmit(res)
+		logging.Infof("FakeCluster: node %v %q vb %v rollback to %v",
+			dc.node.id, dc.name, vb.vbno, seqno)
+		return
+	}
+
+	// response is sent before stream messages, under cluster mutex.
+	res.Body = encodeFailoverLog(vb.flog)
+	dc.transmit(res)
+
+	s := &stream{
+		dc:       dc,
+		vb:       vb,
+		opaque:   req.Opaque,
+		cur:      start,
+		endSeqno: end,
+		endch:    make(chan uint32, 1),
+	}
+	vb.streams[s] = true
+	dc.streams[vb.vbno] = s
+	go s.run()
+}
+
+func (dc *dcpConn) handleCloseStream(vbno uint16) transport.Status {
+	c := dc.node.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := dc.streams[vbno]
+	if !ok {
+		return transport.KEY_ENOENT
+	}
+	s.end(streamEndClosed)
+	delete(s.vb.streams, s)
+	return transport.SUCCESS
+}
+
+func (dc *dcpConn) handleGet(
+	req *transport.MCRequest) (transport.Status, []byte, []byte, uint64) {
+
+	c := dc.node.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vb, err := c.getVbucketLocked(dc.bucket, req.VBucket)
+	if err != nil {
+		return transport.EINVAL, nil, nil, 0
+	} else if vb.node != dc.node.id {
+		return transport.NOT_MY_VBUCKET, nil, nil, 0
+	}
+	it := vb.get(req.Key)
+	if it == nil {
+		return transport.KEY_ENOENT, nil, nil, 0
+	}
+	return transport.SUCCESS, make([]byte, 4), it.value, it.cas
+}
+
+func (dc *dcpConn) handleStore(req *transport.MCRequest) (transport.Status, uint64) {
+	c := dc.node.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vb, err := c.getVbucketLocked(dc.bucket, req.VBucket)
+	if err != nil {
+		return transport.EINVAL, 0
+	} else if vb.node != dc.node.id {
+		return transport.NOT_MY_VBUCKET, 0
+	}
+	if req.Opcode == transport.DELETE {
+		if vb.get(req.Key) == nil {
+			return transport.KEY_ENOENT, 0
+		}
+		return transport.SUCCESS, vb.upsert(req.Key, nil, true).cas
+	}
+	return transport.SUCCESS, vb.upsert(req.Key, req.Body, false).cas
+}
+
+func (dc *dcpConn) sendNoops() {
+	for {
+		dc.wmu.Lock()
+		interval := dc.noop
+		dc.wmu.Unlock()
+
+		select {
+		case <-time.After(interval):
+		case <-dc.closech:
+			return
+		}
+		dc.transmitRequest(&transport.MCRequest{Opcode: transport.DCP_NOOP})
+	}
+}
+
+func (dc *dcpConn) transmit(res *transport.MCResponse) {
+	dc.wmu.Lock()
+	_, err := res.Transmit(dc.conn)
+	dc.wmu.Unlock()
+	if err != nil {
+		dc.conn.Close()
+	}
+}
+
+func (dc *dcpConn) transmitRequest(req *transport.MCRequest) error {
+	dc.wmu.Lock()
+	_, err := req.Transmit(dc.conn)
+	dc.wmu.Unlock()
+	if err != nil {
+		dc.conn.Close()
+	}
+	return err
+}
+
+func encodeFailoverLog(flog [][2]uint64) []byte {
+	body := make([]byte, 16*len(flog))
+	for i, entry := range flog {
+		binary.BigEndian.PutUint64(body[16*i:], entry[0])
+		binary.BigEndian.PutUint64(body[16*i+8:], entry[1])
+	}
+	return body
+}
+
+//---------------------------
+// stream
+//---------------------------
+
+// stream of a vbucket on a DCP connection, streams documents after
+// `cur` upto `endSeqno` in snapshots. The first snapshot is a disk snapshot
+// with the latest version of documents, later snapshots are memory
+// snapshots with every mutation.
+type stream struct {
+	dc       *dcpConn
+	vb       *vbucket
+	opaque   uint32
+	cur      uint64
+	endSeqno uint64
+	endch    chan uint32 // flag of DCP_STREAMEND
+}
+
+// end the stream, called with cluster mutex held.
+func (s *stream) end(flag uint32) {
+	select {
+	case s.endch <- flag:
+	default:
+	}
+	if s.dc.streams[s.vb.vbno] == s {
+		delete(s.dc.streams, s.vb.vbno)
+	}
+}
+
+func (s *stream) run() {
+	c := s.dc.node.cluster
+	backfill := true
+	for {
+		c.mu.Lock()
+		items := s.vb.since(s.cur, s.endSeqno, backfill)
+		notify := s.vb.notify
+		c.mu.Unlock()
+
+		if len(items) > 0 {
+			typ := snapshotMemory
+			if backfill {
+				typ = snapshotDisk
+			}
+			first, last := items[0].seqno, items[len(items)-1].seqno
+			if err := s.send(snapshotRequest(first, last, typ)); err != nil {
+				return
+			}
+			for _, it := range items {
+				if err := s.send(mutationRequest(it)); err != nil {
+					return
+				}
+			}
+			s.cur = last
+		}
+		backfill = false
+
+		if s.cur >= s.endSeqno {
+			s.finish(streamEndOK)
+			return
+		}
+
+		select {
+		case <-notify:
+		case flag := <-s.endch:
+			if flag != streamEndClosed {
+				s.sendEnd(flag)
+			}
+			return
+		case <-s.dc.closech:
+			return
+		}
+	}
+}
+
+// finish the stream on reaching its end seqno, unless ended already.
+func (s *stream) finish(flag uint32) {
+	c := s.dc.node.cluster
+	c.mu.Lock()
+	if _, active := s.vb.streams[s]; active {
+		delete(s.vb.streams, s)
+		if s.dc.streams[s.vb.vbno] == s {
+			delete(s.dc.streams, s.vb.vbno)
+		}
+	} else {
+		select {
+		case flag = <-s.endch:
+		default: // connection closed
+			flag = streamEndClosed
+		}
+	}
+	c.mu.Unlock()
+
+	if flag != streamEndClosed {
+		s.sendEnd(flag)
+	}
+}
+
+func (s *stream) send(req *transport.MCRequest) error {
+	select {
+	case flag := <-s.endch:
+		// ended while streaming.
+		if flag != streamEndClosed {
+			s.sendEnd(flag)
+		}
+		return io.EOF
+	default:
+	}
+	req.VBucket, req.Opaque = s.vb.vbno, s.opaque
+	return s.dc.transmitRequest(req)
+}
+
+func (s *stream) sendEnd(flag uint32) {
+	req := &transport.MCRequest{
+		Opcode:  transport.DCP_STREAMEND,
+		VBucket: s.vb.vbno,
+		Opaque:  s.opaque,
+		Extras:  make([]byte, 4),
+	}
+	binary.BigEndian.PutUint32(req.Extras, flag)
+	s.dc.transmitRequest(req)
+}
+
+func snapshotRequest(start, end uint64, typ uint32) *transport.MCRequest {
+	req := &transport.MCRequest{
+		Opcode: transport.DCP_SNAPSHOT,
+		Extras: make([]byte, 20),
+	}
+	binary.BigEndian.PutUint64(req.Extras[0:8], start)
+	binary.BigEndian.PutUint64(req.Extras[8:16], end)
+	binary.BigEndian.PutUint32(req.Extras[16:20], typ)
+	return req
+}
+
+func mutationRequest(it *item) *transport.MCRequest {
+	if it.deleted {
+		req := &transport.MCRequest{
+			Opcode: transport.DCP_DELETION,
+			Cas:    it.cas,
+			Key:    it.key,
+			Extras: make([]byte, 18),
+		}
+		binary.BigEndian.PutUint64(req.Extras[0:8], it.seqno)
+		binary.BigEndian.PutUint64(req.Extras[8:16], it.revSeqno)
+		return req
+	}
+	req := &transport.MCRequest{
+		Opcode:   transport.DCP_MUTATION,
+		Cas:      it.cas,
+		Datatype: it.datatype,
+		Key:      it.key,
+		Body:     it.value,
+		Extras:   make([]byte, 31),
+	}
+	// seqno, rev-seqno, flags, expiry, lock-time, nmeta, nru
+	binary.BigEndian.PutUint64(req.Extras[0:8], it.seqno)
+	binary.BigEndian.PutUint64(req.Extras[8:16], it.revSeqno)
+	return req
+}
@@ -0,0 +1,287 @@
+package fakecluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	couchbase "github.com/couchbase/indexing/secondary/dcp"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+// streamDelimiter follows every config object on streaming endpoints.
+const streamDelimiter = "\n\n\n\n"
+
+func (n *node) serveREST() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pools", n.handlePools)
+	mux.HandleFunc("/pools/default", n.handlePool)
+	mux.HandleFunc("/poolsStreaming/default", n.handlePoolStreaming)
+	mux.HandleFunc("/pools/default/buckets", n.handleBuckets)
+	mux.HandleFunc("/pools/default/buckets/", n.handleBucket)
+	mux.HandleFunc("/pools/default/b/", n.handleBucket)
+	mux.HandleFunc("/pools/default/nodeServices", n.handleNodeServices)
+	mux.HandleFunc("/pools/default/nodeServicesStreaming", n.handleNodeServicesStreaming)
+	mux.HandleFunc("/pools/default/serverGroups", n.handleServerGroups)
+	mux.HandleFunc("/_metakv/", n.cluster.metakv.handle)
+
+	server := &http.Server{Handler: n.authenticate(mux)}
+	server.Serve(n.restln)
+}
+
+// authenticate requests with basic auth, if the cluster has credentials.
+func (n *node) authenticate(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := n.cluster
+		if c.user != "" {
+			user, pass, ok := r.BasicAuth()
+			if !ok || user != c.user || pass != c.pass {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (n *node) handlePools(w http.ResponseWriter, r *http.Request) {
+	c := n.cluster
+	c.mu.Lock()
+	pools := couchbase.Pools{
+		ImplementationVersion: "7.0.0-0000-enterprise",
+		IsAdmin:               true,
+		UUID:                  c.uuid,
+		Pools: []couchbase.RestPool{{
+			Name:         "default",
+			URI:          "/pools/default",
+			StreamingURI: "/poolsStreaming/default",
+		}},
+	}
+	c.mu.Unlock()
+	writeJSON(w, pools)
+}
+
+func (n *node) handlePool(w http.ResponseWriter, r *http.Request) {
+	c := n.cluster
+	c.mu.Lock()
+	pool := n.poolLocked()
+	c.mu.Unlock()
+	writeJSON(w, pool)
+}
+
+func (n *node) handlePoolStreaming(w http.ResponseWriter, r *http.Request) {
+	n.streamConfig(w, r, func() interface{} { return n.poolLocked() })
+}
+
+func (n *node) handleBuckets(w http.ResponseWriter, r *http.Request) {
+	c := n.cluster
+	c.mu.Lock()
+	buckets := make([]*couchbase.Bucket, 0, len(c.buckets))
+	for _, name := range c.bucketNamesLocked() {
+		buckets = append(buckets, n.bucketLocked(c.buckets[name]))
+	}
+	c.mu.Unlock()
+	writeJSON(w, buckets)
+}
+
+// handleBucket serves full and terse bucket config at
+// /pools/default/buckets/<name> and /pools/default/b/<name>, and the
+// collections manifest at /pools/default/buckets/<name>/scopes.
+func (n *node) handleBucket(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/pools/default/")
+	parts := strings.Split(path, "/")
+	name, scopes := parts[1], len(parts) == 3 && parts[2] == "scopes"
+	if len(parts) > 3 || (len(parts) == 3 && !scopes) {
+		http.NotFound(w, r)
+		return
+	}
+
+	c := n.cluster
+	c.mu.Lock()
+	b, err := c.getBucketLocked(name)
+	if err != nil {
+		c.mu.Unlock()
+		http.Error(w, fmt.Sprintf("Requested resource not found. %v", err), http.StatusNotFound)
+		return
+	}
+	var out interface{}
+	if scopes {
+		out = defaultManifest()
+	} else {
+		out = n.bucketLocked(b)
+	}
+	c.mu.Unlock()
+	writeJSON(w, out)
+}
+
+func (n *node) handleNodeServices(w http.ResponseWriter, r *http.Request) {
+	c := n.cluster
+	c.mu.Lock()
+	ps := n.nodeServicesLocked()
+	c.mu.Unlock()
+	writeJSON(w, ps)
+}
+
+func (n *node) handleNodeServicesStreaming(w http.ResponseWriter, r *http.Request) {
+	n.streamConfig(w, r, func() interface{} { return n.nodeServicesLocked() })
+}
+
+func (n *node) handleServerGroups(w http.ResponseWriter, r *http.Request) {
+	c := n.cluster
+	c.mu.Lock()
+	var groups couchbase.ServerGroups
+	index := make(map[string]int)
+	for _, nd := range c.nodes {
+		i, ok := index[nd.group]
+		if !ok {
+			i = len(groups.Groups)
+			index[nd.group] = i
+			groups.Groups = append(groups.Groups, couchbase.ServerGroup{Name: nd.group})
+		}
+		groups.Groups[i].Nodes = append(groups.Groups[i].Nodes, n.nodeJSONLocked(nd))
+	}
+	c.mu.Unlock()
+	writeJSON(w, groups)
+}
+
+// streamConfig writes the config returned by `get`, called with cluster
+// mutex held, and then again on every config change until the client
+// goes away or the cluster is closed.
+func (n *node) streamConfig(
+	w http.ResponseWriter, r *http.Request, get func() interface{}) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	c := n.cluster
+	for {
+		c.mu.Lock()
+		data, err := json.Marshal(get())
+		changed, closed := c.changed, c.closed
+		c.mu.Unlock()
+
+		if err != nil {
+			logging.Errorf("FakeCluster: %v: %v", r.URL.Path, err)
+			return
+		}
+		if _, err := w.Write(append(data, streamDelimiter...)); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		if closed {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (n *node) poolLocked() *couchbase.Pool {
+	c := n.cluster
+	pool := &couchbase.Pool{
+		BucketURL: map[string]string{
+			"uri":              "/pools/default/buckets",
+			"terseBucketsBase": "/pools/default/b/",
+		},
+		ServerGroupsUri: "/pools/default/serverGroups",
+	}
+	for _, nd := range c.nodes {
+		pool.Nodes = append(pool.Nodes, n.nodeJSONLocked(nd))
+	}
+	return pool
+}
+
+func (n *node) bucketLocked(b *bucket) *couchbase.Bucket {
+	c := n.cluster
+	bucket := &couchbase.Bucket{
+		AuthType:    "sasl",
+		Type:        "membase",
+		Name:        b.name,
+		NodeLocator: "vbucket",
+		URI:         "/pools/default/buckets/" + b.name,
+		UUID:        b.uuid,
+		VBSMJson: couchbase.VBucketServerMap{
+			HashAlgorithm: "CRC",
+			VBucketMap:    make([][]int, len(b.vbuckets)),
+		},
+	}
+	for _, nd := range c.nodes {
+		bucket.VBSMJson.ServerList = append(bucket.VBSMJson.ServerList, nd.kvaddr)
+		if !nd.failed {
+			bucket.NodesJSON = append(bucket.NodesJSON, n.nodeJSONLocked(nd))
+		}
+	}
+	for i, vb := range b.vbuckets {
+		bucket.VBSMJson.VBucketMap[i] = []int{vb.node}
+	}
+	return bucket
+}
+
+func (n *node) nodeServicesLocked() *couchbase.PoolServices {
+	c := n.cluster
+	ps := &couchbase.PoolServices{Rev: c.rev}
+	for _, nd := range c.nodes {
+		services := make(map[string]int, len(nd.services))
+		for name, port := range nd.services {
+			services[name] = port
+		}
+		ps.NodesExt = append(ps.NodesExt, couchbase.NodeServices{
+			Services: services,
+			Hostname: "127.0.0.1",
+			ThisNode: nd == n,
+		})
+	}
+	return ps
+}
+
+func (n *node) nodeJSONLocked(nd *node) couchbase.Node {
+	status, membership := "healthy", "active"
+	if nd.failed {
+		status, membership = "unhealthy", "inactiveFailed"
+	}
+	return couchbase.Node{
+		ClusterCompatibility: 0x70000,
+		ClusterMembership:    membership,
+		Hostname:             nd.restaddr,
+		Ports:                map[string]int{"direct": portOf(nd.kvaddr)},
+		Status:               status,
+		Version:              "7.0.0-0000-enterprise",
+		ThisNode:             nd == n,
+		Services:             append([]string(nil), nd.roles...),
+		NodeUUID:             nd.uuid,
+	}
+}
+
+// defaultManifest has only the default scope and collection.
+func defaultManifest() *couchbase.Manifest {
+	return &couchbase.Manifest{
+		UID: "0",
+		Scopes: []couchbase.ManifestScope{{
+			UID:  "0",
+			Name: "_default",
+			Collections: []couchbase.ManifestCollection{{
+				UID:  "0",
+				Name: "_default",
+			}},
+		}},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,271 @@
+package fakecluster
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"sort"
+)
+
+type bucket struct {
+	name     string
+	uuid     string
+	vbuckets []*vbucket
+}
+
+// vbHash returns the vbucket of `key`, same as couchbase client.
+func (b *bucket) vbHash(key []byte) uint16 {
+	crc := crc32.ChecksumIEEE(key)
+	return uint16((crc >> 16) & 0x7fff & uint32(len(b.vbuckets)-1))
+}
+
+// item is a version of document in a vbucket.
+type item struct {
+	key      []byte
+	value    []byte
+	seqno    uint64
+	revSeqno uint64
+	cas      uint64
+	datatype uint8
+	deleted  bool
+}
+
+// vbucket holds all the versions of its documents in seqno order, the
+// latest version of a document is streamed from disk (backfill) and all
+// the versions are streamed from memory.
+type vbucket struct {
+	vbno    uint16
+	node    int         // active node
+	flog    [][2]uint64 // failover log {vbuuid, seqno}, latest first
+	seqno   uint64      // high seqno
+	items   []*item
+	keys    map[string]*item // latest version of document
+	streams map[*stream]bool
+	notify  chan struct{} // closed and replaced on every mutation
+}
+
+func newVbucket(vbno uint16, node int, vbuuid uint64) *vbucket {
+	return &vbucket{
+		vbno:    vbno,
+		node:    node,
+		flog:    [][2]uint64{{vbuuid, 0}},
+		keys:    make(map[string]*item),
+		streams: make(map[*stream]bool),
+		notify:  make(chan struct{}),
+	}
+}
+
+func (vb *vbucket) vbuuid() uint64 {
+	return vb.flog[0][0]
+}
+
+func (vb *vbucket) upsert(key, value []byte, deleted bool) *item {
+	vb.seqno++
+	it := &item{
+		key:     append([]byte(nil), key...),
+		value:   append([]byte(nil), value...),
+		seqno:   vb.seqno,
+		cas:     vb.seqno<<16 | uint64(vb.vbno),
+		deleted: deleted,
+	}
+	if prev, ok := vb.keys[string(key)]; ok {
+		it.revSeqno = prev.revSeqno + 1
+	} else {
+		it.revSeqno = 1
+	}
+	if !deleted && isJSON(value) {
+		it.datatype = datatypeJSON
+	}
+	vb.items = append(vb.items, it)
+	vb.keys[string(key)] = it
+	vb.wakeup()
+	return it
+}
+
+// isJSON is true if value is a valid JSON document, RawMessage is
+// unmarshaled only after the input is validated.
+func isJSON(value []byte) bool {
+	var raw json.RawMessage
+	return json.Unmarshal(value, &raw) == nil
+}
+
+func (vb *vbucket) get(key []byte) *item {
+	if it, ok := vb.keys[string(key)]; ok && !it.deleted {
+		return it
+	}
+	return nil
+}
+
+// since returns items after `seqno` upto `end`, if `backfill` only the
+// latest version of documents is returned.
+func (vb *vbucket) since(seqno, end uint64, backfill bool) []*item {
+	i := sort.Search(len(vb.items), func(i int) bool {
+		return vb.items[i].seqno > seqno
+	})
+	items := make([]*item, 0, len(vb.items)-i)
+	for _, it := range vb.items[i:] {
+		if it.seqno > end {
+			break
+		} else if backfill && vb.keys[string(it.key)] != it {
+			continue
+		}
+		items = append(items, it)
+	}
+	return items
+}
+
+// truncate mutations after `seqno`, restoring the previous versions of
+// documents.
+func (vb *vbucket) truncate(seqno uint64) {
+	i := sort.Search(len(vb.items), func(i int) bool {
+		return vb.items[i].seqno > seqno
+	})
+	removed := vb.items[i:]
+	vb.items = vb.items[:i]
+	for _, it := range removed {
+		delete(vb.keys, string(it.key))
+	}
+	for _, it := range removed {
+		if _, ok := vb.keys[string(it.key)]; ok {
+			continue
+		}
+		for j := len(vb.items) - 1; j >= 0; j-- {
+			if string(vb.items[j].key) == string(it.key) {
+				vb.keys[string(it.key)] = vb.items[j]
+				break
+			}
+		}
+	}
+	vb.seqno = seqno
+}
+
+// failover adds a new branch `vbuuid` at `seqno` to the failover log.
+func (vb *vbucket) failover(vbuuid, seqno uint64) {
+	vb.flog = append([][2]uint64{{vbuuid, seqno}}, vb.flog...)
+	vb.wakeup()
+}
+
+// rollbackSeqno returns the seqno to rollback to and true, if a client
+// that has seen upto `start` in snapshot {snapStart, snapEnd} of branch
+// `vbuuid` cannot resume its stream.
+func (vb *vbucket) rollbackSeqno(vbuuid, start, snapStart, snapEnd uint64) (uint64, bool) {
+	if start == 0 {
+		return 0, false
+	}
+	if snapStart > start || snapEnd < start {
+		snapStart, snapEnd = start, start
+	}
+	for i, entry := range vb.flog {
+		if entry[0] != vbuuid {
+			continue
+		}
+		// highest seqno of the branch common with current history.
+		upper := vb.seqno
+		if i > 0 {
+			upper = vb.flog[i-1][1]
+		}
+		if snapEnd > upper {
+			if snapStart < upper {
+				return snapStart, true
+			}
+			return upper, true
+		}
+		return 0, false
+	}
+	return 0, true
+}
+
+func (vb *vbucket) endStreams(flag uint32) {
+	for s := range vb.streams {
+		s.end(flag)
+		delete(vb.streams, s)
+	}
+}
+
+func (vb *vbucket) wakeup() {
+	close(vb.notify)
+	vb.notify = make(chan struct{})
+}
+
+//---------------------------
+// document API
+//---------------------------
+
+// Set document `key` to `value` in `bucket`, returns its vbucket and
+// seqno.
+func (c *Cluster) Set(bucket string, key string, value []byte) (uint16, uint64, error) {
+	return c.upsert(bucket, key, value, false)
+}
+
+// Delete document `key` in `bucket`, returns its vbucket and seqno.
+func (c *Cluster) Delete(bucket string, key string) (uint16, uint64, error) {
+	return c.upsert(bucket, key, nil, true)
+}
+
+func (c *Cluster) upsert(bucket, key string, value []byte, deleted bool) (uint16, uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, err := c.getBucketLocked(bucket)
+	if err != nil {
+		return 0, 0, err
+	}
+	vbno := b.vbHash([]byte(key))
+	it := b.vbuckets[vbno].upsert([]byte(key), value, deleted)
+	return vbno, it.seqno, nil
+}
+
+// Get document `key` from `bucket`.
+func (c *Cluster) Get(bucket string, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, err := c.getBucketLocked(bucket)
+	if err != nil {
+		return nil, false, err
+	}
+	it := b.vbuckets[b.vbHash([]byte(key))].get([]byte(key))
+	if it == nil {
+		return nil, false, nil
+	}
+	return it.value, true, nil
+}
+
+// VbucketOf returns the vbucket of document `key` in `bucket`.
+func (c *Cluster) VbucketOf(bucket string, key string) (uint16, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, err := c.getBucketLocked(bucket)
+	if err != nil {
+		return 0, err
+	}
+	return b.vbHash([]byte(key)), nil
+}
+
+// Seqnos returns the high seqno of all vbuckets of `bucket`.
+func (c *Cluster) Seqnos(bucket string) ([]uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, err := c.getBucketLocked(bucket)
+	if err != nil {
+		return nil, err
+	}
+	seqnos := make([]uint64, len(b.vbuckets))
+	for i, vb := range b.vbuckets {
+		seqnos[i] = vb.seqno
+	}
+	return seqnos, nil
+}
+
+// FailoverLog of vbucket `vbno` in `bucket`, latest branch first.
+func (c *Cluster) FailoverLog(bucket string, vbno uint16) ([][2]uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vb, err := c.getVbucketLocked(bucket, vbno)
+	if err != nil {
+		return nil, err
+	}
+	return append([][2]uint64(nil), vb.flog...), nil
+}
@@ -12,7 +12,7 @@ import (
 	qerrors "github.com/couchbase/query/errors"
 	qexpr "github.com/couchbase/query/expression"
 	qparser "github.com/couchbase/query/expression/parser"
-	//"github.com/couchbase/query/value"
+	qvalue "github.com/couchbase/query/value"
 	"io/ioutil"
 	"log"
 	"os"
@@ -384,6 +384,75 @@ func TestBufferedScan_BackfillEnabled(t *testing.T) {
 	}
 }
 
+// TestN1QLCollatedIndex shows what query gets from an index with
+// collation. Query does not know of the collation, it scans the index
+// for all the case variants of "abc" and then filters them by its own
+// binary predicate, hence a query returns the same rows as on a binary
+// index.
+func TestN1QLCollatedIndex(t *testing.T) {
+	log.Printf("In TestN1QLCollatedIndex()")
+
+	var indexName = "index_name_nocase"
+	var bucketName = "default"
+
+	e := secondaryindex.DropAllSecondaryIndexes(indexManagementAddress)
+	FailTestIfError(e, "Error in DropAllSecondaryIndexes", t)
+	kvutility.FlushBucket(bucketName, "", clusterconfig.Username, clusterconfig.Password, kvaddress)
+	time.Sleep(5 * time.Second)
+
+	kvdocs := tc.KeyValues{
+		"doc_lower": map[string]interface{}{"name": "abc"},
+		"doc_upper": map[string]interface{}{"name": "ABC"},
+		"doc_title": map[string]interface{}{"name": "Abc"},
+		"doc_other": map[string]interface{}{"name": "abd"},
+	}
+	kvutility.SetKeyValues(kvdocs, bucketName, "", clusterconfig.KVAddress)
+
+	with := []byte(`{"collation":"nocase"}`)
+	err := secondaryindex.CreateSecondaryIndex(indexName, bucketName, indexManagementAddress, "", []string{"name"}, false, with, true, defaultIndexActiveTimeout, nil)
+	FailTestIfError(err, "Error in creating the index", t)
+
+	// queryport client gets the case insensitive lookup.
+	scanResults, err := secondaryindex.Lookup(indexName, bucketName, indexScanAddress, []interface{}{"abc"}, false, defaultlimit, c.SessionConsistency, nil)
+	FailTestIfError(err, "Error in scan", t)
+	if len(scanResults) != 3 || scanResults["doc_other"] != nil {
+		FailTestIfError(fmt.Errorf("expected 3 case variants of abc, got %v", scanResults), "TestN1QLCollatedIndex failed", t)
+	}
+
+	n1qlclient, err := secondaryindex.GetOrCreateN1QLClient(indexScanAddress, bucketName)
+	FailTestIfError(err, "Error in creating n1ql client", t)
+	index, err := n1qlclient.IndexByName(indexName)
+	FailTestIfError(err, "Error in getting IndexByName", t)
+	if _, ok := index.(datastore.Index2); ok {
+		FailTestIfError(errors.New("collated index is served with pushdowns"), "TestN1QLCollatedIndex failed", t)
+	}
+
+	// query scans the same entries, limit is not pushed down.
+	scanResults, err = secondaryindex.N1QLLookup(indexName, bucketName, indexScanAddress, []interface{}{"abc"}, false, 1, c.SessionConsistency, nil)
+	FailTestIfError(err, "Error in n1ql scan", t)
+	if len(scanResults) != 3 {
+		FailTestIfError(fmt.Errorf("expected 3 entries from n1ql scan, got %v", scanResults), "TestN1QLCollatedIndex failed", t)
+	}
+
+	// and applies `name = "abc"` on the fetched documents, as its filter
+	// operator does, leaving only the exact match.
+	cond, err := qparser.Parse(`name = "abc"`)
+	FailTestIfError(err, "Error in parsing predicate", t)
+	context := qexpr.NewIndexContext()
+	var rows []string
+	for docid := range scanResults {
+		doc := qvalue.NewAnnotatedValue(kvdocs[docid])
+		v, err := cond.Evaluate(doc, context)
+		FailTestIfError(err, "Error in evaluating predicate", t)
+		if v.Truth() {
+			rows = append(rows, docid)
+		}
+	}
+	if len(rows) != 1 || rows[0] != "doc_lower" {
+		FailTestIfError(fmt.Errorf("expected only doc_lower, got %v", rows), "TestN1QLCollatedIndex failed", t)
+	}
+}
+
 type qcmdContext struct {
 	err error
 }
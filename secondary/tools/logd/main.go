@@ -11,6 +11,14 @@ import "io/ioutil"
 var options struct {
 	show    []string
 	session int
+	// filters for structured logs
+	json      bool
+	level     string
+	component string
+	bucket    string
+	index     string
+	requestId string
+	partition string
 }
 
 func argParse() []string {
@@ -18,6 +26,20 @@ func argParse() []string {
 
 	flag.StringVar(&show, "show", "", "log lines to show")
 	flag.IntVar(&options.session, "session", 0, "session to analyse")
+	flag.BoolVar(&options.json, "json", false,
+		"filter structured (json) logs, detected by default")
+	flag.StringVar(&options.level, "level", "",
+		"filter structured logs at or above level")
+	flag.StringVar(&options.component, "component", "",
+		"filter structured logs by component")
+	flag.StringVar(&options.bucket, "bucket", "",
+		"filter structured logs by bucket")
+	flag.StringVar(&options.index, "index", "",
+		"filter structured logs by index")
+	flag.StringVar(&options.requestId, "requestId", "",
+		"filter structured logs by requestId")
+	flag.StringVar(&options.partition, "partition", "",
+		"filter structured logs by partition")
 
 	flag.Parse()
 
@@ -43,6 +65,10 @@ func argParse() []string {
 
 func main() {
 	args := argParse()
+	if options.json || isStructured(readLines(args[0])) {
+		filterLog(args)
+		return
+	}
 	analyseLog(args[0])
 }
 
@@ -0,0 +1,78 @@
+package main
+
+import "encoding/json"
+import "fmt"
+import "strings"
+
+import "github.com/couchbase/indexing/secondary/logging"
+
+// JSONLine is a log line logged in logging.JSONFormat.
+type JSONLine struct {
+	Ts        string      `json:"ts"`
+	Level     string      `json:"level"`
+	Component string      `json:"component"`
+	Bucket    string      `json:"bucket"`
+	Index     string      `json:"index"`
+	RequestId string      `json:"requestId"`
+	Partition interface{} `json:"partition"`
+	Msg       string      `json:"msg"`
+}
+
+// isStructured returns true if log lines are JSON objects, going by the
+// first non-empty line.
+func isStructured(lines []string) bool {
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			return strings.HasPrefix(line, "{")
+		}
+	}
+	return false
+}
+
+// filterLog prints lines from structured log files that match the
+// -level, -component, -bucket, -index, -requestId and -partition
+// options, in the order of files. Lines that are not JSON are skipped.
+func filterLog(logfiles []string) {
+	matched, skipped := 0, 0
+	for _, logfile := range logfiles {
+		for _, line := range readLines(logfile) {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			var jl JSONLine
+			if err := json.Unmarshal([]byte(line), &jl); err != nil {
+				skipped++
+				continue
+			}
+			if jl.matches() {
+				fmt.Println(line)
+				matched++
+			}
+		}
+	}
+	fmt.Printf("Lines matched: %d, lines skipped: %d\n", matched, skipped)
+}
+
+func (jl *JSONLine) matches() bool {
+	if options.level != "" {
+		// messages at or above the level.
+		if logging.Level(jl.Level) > logging.Level(options.level) {
+			return false
+		}
+	}
+	if options.component != "" && jl.Component != options.component {
+		return false
+	} else if options.bucket != "" && jl.Bucket != options.bucket {
+		return false
+	} else if options.index != "" && jl.Index != options.index {
+		return false
+	} else if options.requestId != "" && jl.RequestId != options.requestId {
+		return false
+	}
+	if options.partition != "" {
+		if jl.Partition == nil || fmt.Sprint(jl.Partition) != options.partition {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+// Compression codecs for transport payload.
+//
+// Payloads are compressed after encoding and decompressed before decoding,
+// the codec used is carried in the COMP. bits of packet flags, hence
+// receiver can always decompress a packet irrespective of its own
+// configuration.
+
+package transport
+
+import "bytes"
+import "errors"
+import "compress/bzip2"
+import "compress/gzip"
+import "io"
+import "io/ioutil"
+import "strings"
+
+import "github.com/golang/snappy"
+import bzip2w "github.com/dsnet/compress/bzip2"
+
+// ErrorCompressionUnknown for unknown compression.
+var ErrorCompressionUnknown = errors.New("transport.compressionUnknown")
+
+// Compressions supported by transport, in addition to CompressionNone.
+var Compressions = []byte{CompressionSnappy, CompressionGzip, CompressionBzip2}
+
+// CompressionFromString return the compression type for codec name,
+// name can be one of "none", "snappy", "gzip", "bzip2".
+func CompressionFromString(name string) (byte, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return CompressionNone, nil
+	case "snappy":
+		return CompressionSnappy, nil
+	case "gzip":
+		return CompressionGzip, nil
+	case "bzip2":
+		return CompressionBzip2, nil
+	}
+	return CompressionNone, ErrorCompressionUnknown
+}
+
+// CompressionString return the codec name for compression type.
+func CompressionString(compression byte) string {
+	switch compression {
+	case CompressionNone:
+		return "none"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionBzip2:
+		return "bzip2"
+	}
+	return "unknown"
+}
+
+// Compress `big` using `compression` codec.
+func Compress(compression byte, big []byte) (small []byte, err error) {
+	switch compression {
+	case CompressionNone:
+		return big, nil
+
+	case CompressionSnappy:
+		return snappy.Encode(nil, big), nil
+
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err = w.Write(big); err != nil {
+			return nil, err
+		}
+		if err = w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+
+	case CompressionBzip2:
+		var buf bytes.Buffer
+		w, err := bzip2w.NewWriter(&buf, nil /*default config*/)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = w.Write(big); err != nil {
+			return nil, err
+		}
+		if err = w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, ErrorCompressionUnknown
+}
+
+// Decompress `small` using `compression` codec. Payload inflating to more
+// than `maxPayload` bytes is rejected with ErrorPacketOverflow, so that a
+// small frame cannot exhaust memory on the receiver.
+func Decompress(compression byte, small []byte, maxPayload int) (big []byte, err error) {
+	switch compression {
+	case CompressionNone:
+		return small, nil
+
+	case CompressionSnappy:
+		n, err := snappy.DecodedLen(small)
+		if err != nil {
+			return nil, err
+		} else if n > maxPayload {
+			return nil, ErrorPacketOverflow
+		}
+		return snappy.Decode(nil, small)
+
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(small))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return readPayload(r, maxPayload)
+
+	case CompressionBzip2:
+		return readPayload(bzip2.NewReader(bytes.NewReader(small)), maxPayload)
+	}
+	return nil, ErrorCompressionUnknown
+}
+
+// readPayload reads all of `r`, failing with ErrorPacketOverflow once more
+// than `maxPayload` bytes are read.
+func readPayload(r io.Reader, maxPayload int) ([]byte, error) {
+	big, err := ioutil.ReadAll(io.LimitReader(r, int64(maxPayload)+1))
+	if err != nil {
+		return nil, err
+	} else if len(big) > maxPayload {
+		return nil, ErrorPacketOverflow
+	}
+	return big, nil
+}
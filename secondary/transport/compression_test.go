@@ -0,0 +1,96 @@
+package transport
+
+import "bytes"
+import "fmt"
+import "net"
+import "testing"
+
+func TestCompressionRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&buf, `{"docid":"doc%d","age":%d}`, i, i%100)
+	}
+	big := buf.Bytes()
+
+	for _, compression := range Compressions {
+		name := CompressionString(compression)
+		small, err := Compress(compression, big)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		} else if len(small) >= len(big) {
+			t.Errorf("%v: expected compression, %v -> %v", name, len(big), len(small))
+		}
+		out, err := Decompress(compression, small, len(big))
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		} else if !bytes.Equal(out, big) {
+			t.Errorf("%v: mismatch after round trip", name)
+		}
+		if c, err := CompressionFromString(name); err != nil || c != compression {
+			t.Errorf("%v: unexpected compression %v %v", name, c, err)
+		}
+	}
+
+	if small, err := Compress(CompressionNone, big); err != nil || !bytes.Equal(small, big) {
+		t.Errorf("none: unexpected compression %v", err)
+	}
+	if _, err := Compress(0x0F, big); err != ErrorCompressionUnknown {
+		t.Errorf("expected %v, got %v", ErrorCompressionUnknown, err)
+	}
+	if _, err := CompressionFromString("lz4"); err != ErrorCompressionUnknown {
+		t.Errorf("expected %v, got %v", ErrorCompressionUnknown, err)
+	}
+}
+
+func TestDecompressOverflow(t *testing.T) {
+	big := make([]byte, 1024*1024)
+	for _, compression := range Compressions {
+		name := CompressionString(compression)
+		small, err := Compress(compression, big)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if _, err := Decompress(compression, small, len(big)-1); err != ErrorPacketOverflow {
+			t.Errorf("%v: expected %v, got %v", name, ErrorPacketOverflow, err)
+		}
+		if out, err := Decompress(compression, small, len(big)); err != nil || len(out) != len(big) {
+			t.Errorf("%v: expected %v bytes, got %v %v", name, len(big), len(out), err)
+		}
+	}
+}
+
+func TestPacketOverflow(t *testing.T) {
+	big := make([]byte, 64*1024)
+	// payload is sent as is, with a valid encoding in flags.
+	encoder := func(payload interface{}) ([]byte, error) { return payload.([]byte), nil }
+	decoder := func(data []byte) (interface{}, error) { return data, nil }
+	for _, compression := range Compressions {
+		name := CompressionString(compression)
+		conn := &testConnection{}
+		flags := TransportFlag(0).SetProtobuf().SetCompression(compression)
+		tx := NewTransportPacket(len(big)+MaxSendBufSize, flags)
+		tx.SetEncoder(EncodingProtobuf, encoder)
+		if err := tx.Send(conn, big); err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+
+		// compressed packet fits the receive buffer, payload does not.
+		rx := NewTransportPacket(1024, 0)
+		rx.SetDecoder(EncodingProtobuf, decoder)
+		if _, err := rx.Receive(conn); err != ErrorPacketOverflow {
+			t.Errorf("%v: expected %v, got %v", name, ErrorPacketOverflow, err)
+		}
+	}
+}
+
+type testConnection struct {
+	bytes.Buffer
+}
+
+func (tc *testConnection) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9998}
+}
+
+func (tc *testConnection) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9999}
+}
@@ -0,0 +1,53 @@
+package transport
+
+import "net"
+import "sync/atomic"
+
+// Conn wraps a net.Conn along with the compression negotiated with the
+// remote end, to be applied on payloads written using Send(). Typically
+// used by servers that respond in the same compression as the request.
+type Conn struct {
+	net.Conn
+	compression  uint32
+	uncompressed uint64
+	compressed   uint64
+}
+
+// NewConn wraps `conn`, starting with no compression.
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{Conn: conn}
+}
+
+// SetCompression negotiated for this connection.
+func (c *Conn) SetCompression(compression byte) {
+	atomic.StoreUint32(&c.compression, uint32(compression))
+}
+
+// Compression return the compression negotiated for this connection.
+func (c *Conn) Compression() byte {
+	return byte(atomic.LoadUint32(&c.compression))
+}
+
+// Compress payload using the negotiated compression and account for
+// it in connection statistics.
+func (c *Conn) Compress(big []byte) (small []byte, err error) {
+	if small, err = Compress(c.Compression(), big); err != nil {
+		return nil, err
+	}
+	c.AddStats(len(big), len(small))
+	return small, nil
+}
+
+// AddStats account for payload transported on this connection.
+func (c *Conn) AddStats(uncompressed, compressed int) {
+	atomic.AddUint64(&c.uncompressed, uint64(uncompressed))
+	atomic.AddUint64(&c.compressed, uint64(compressed))
+}
+
+// CompressionStats return the cumulative payload size, in bytes, before
+// compression and after compression, for this connection.
+func (c *Conn) CompressionStats() (uncompressed, compressed uint64) {
+	uncompressed = atomic.LoadUint64(&c.uncompressed)
+	compressed = atomic.LoadUint64(&c.compressed)
+	return
+}
@@ -10,6 +10,7 @@ package transport
 
 import "errors"
 import "net"
+import "sync/atomic"
 import "github.com/couchbase/indexing/secondary/logging"
 
 // error codes
@@ -53,6 +54,9 @@ type TransportPacket struct {
 	buf      []byte
 	encoders map[byte]Encoder
 	decoders map[byte]Decoder
+	// statistics
+	uncompressed uint64 // payload bytes before compression / after decompression
+	compressed   uint64 // payload bytes as transported on the wire
 }
 
 // Encoder callback
@@ -93,18 +97,44 @@ func (pkt *TransportPacket) SetDecoder(typ byte, callb Decoder) *TransportPacket
 	return pkt
 }
 
+// Flags return the flags used for the last packet sent or received.
+func (pkt *TransportPacket) Flags() TransportFlag {
+	return pkt.flags
+}
+
+// SetCompression for subsequent packets sent using this TransportPacket.
+func (pkt *TransportPacket) SetCompression(compression byte) *TransportPacket {
+	pkt.flags = pkt.flags.SetCompression(compression)
+	return pkt
+}
+
+// CompressionStats return the cumulative payload size, in bytes, before
+// compression and after compression, for packets sent and received using
+// this TransportPacket.
+func (pkt *TransportPacket) CompressionStats() (uncompressed, compressed uint64) {
+	uncompressed = atomic.LoadUint64(&pkt.uncompressed)
+	compressed = atomic.LoadUint64(&pkt.compressed)
+	return
+}
+
+func (pkt *TransportPacket) addStats(uncompressed, compressed int) {
+	atomic.AddUint64(&pkt.uncompressed, uint64(uncompressed))
+	atomic.AddUint64(&pkt.compressed, uint64(compressed))
+}
+
 // Send payload to the other end using sufficient encoding and compression.
 func (pkt *TransportPacket) Send(conn transporter, payload interface{}) (err error) {
-	var data []byte
+	var data, big []byte
 
 	// encode
-	if data, err = pkt.encode(payload); err != nil {
+	if big, err = pkt.encode(payload); err != nil {
 		return
 	}
 	// compress
-	if data, err = pkt.compress(data); err != nil {
+	if data, err = pkt.compress(big); err != nil {
 		return
 	}
+	pkt.addStats(len(big), len(data))
 
 	err = Send(conn, pkt.buf, pkt.flags, data, true)
 	return
@@ -132,9 +162,11 @@ func (pkt *TransportPacket) Receive(conn transporter) (payload interface{}, err
 	logging.Tracef("read %v bytes on connection %v<-%v", len(data), laddr, raddr)
 
 	// de-compression
-	if data, err = pkt.decompress(data); err != nil {
+	small := data
+	if data, err = pkt.decompress(small); err != nil {
 		return
 	}
+	pkt.addStats(len(data), len(small))
 	// decoding
 	if payload, err = pkt.decode(data); err != nil {
 		return
@@ -166,20 +198,12 @@ func (pkt *TransportPacket) decode(data []byte) (payload interface{}, err error)
 
 // compress array of bytes.
 func (pkt *TransportPacket) compress(big []byte) (small []byte, err error) {
-	switch pkt.flags.GetCompression() {
-	case CompressionNone:
-		small = big
-	}
-	return
+	return Compress(pkt.flags.GetCompression(), big)
 }
 
-// decompress array of bytes.
+// decompress array of bytes, upto the size of packet buffer.
 func (pkt *TransportPacket) decompress(small []byte) (big []byte, err error) {
-	switch pkt.flags.GetCompression() {
-	case CompressionNone:
-		big = small
-	}
-	return
+	return Decompress(pkt.flags.GetCompression(), small, len(pkt.buf))
 }
 
 // read len(buf) bytes from `conn`.
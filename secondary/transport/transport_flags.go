@@ -35,6 +35,11 @@ func (flags TransportFlag) GetCompression() byte {
 	return byte(flags & TransportFlag(0x000F))
 }
 
+// SetCompression will set packet compression to `compression`
+func (flags TransportFlag) SetCompression(compression byte) TransportFlag {
+	return (flags & TransportFlag(0xFFF0)) | TransportFlag(compression&0x0F)
+}
+
 // SetSnappy will set packet compression to snappy
 func (flags TransportFlag) SetSnappy() TransportFlag {
 	return (flags & TransportFlag(0xFFF0)) | TransportFlag(CompressionSnappy)
@@ -0,0 +1,210 @@
+package verifier
+
+import (
+	"sort"
+
+	"github.com/couchbase/indexing/secondary/collatejson"
+	c "github.com/couchbase/indexing/secondary/common"
+	qu "github.com/couchbase/indexing/secondary/common/queryutil"
+	mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
+	protoProjector "github.com/couchbase/indexing/secondary/protobuf/projector"
+	qexpr "github.com/couchbase/query/expression"
+	qvalue "github.com/couchbase/query/value"
+)
+
+// evaluator computes the entries an index is expected to hold for a
+// document, the same way projector and indexer derive them from a KV
+// mutation.
+type evaluator struct {
+	defn     *c.IndexDefn
+	skExprs  []interface{}
+	whExpr   interface{}
+	isArray  bool
+	arrayPos int
+
+	codec     *collatejson.Codec
+	encodeBuf []byte
+}
+
+func newEvaluator(defn *c.IndexDefn) (*evaluator, error) {
+	if !defn.IsPrimary && defn.ExprType != c.N1QL {
+		return nil, ErrUnsupportedIndex
+	}
+	if defn.GetScope() != c.DEFAULT_SCOPE ||
+		defn.GetCollection() != c.DEFAULT_COLLECTION {
+		return nil, ErrUnsupportedIndex
+	}
+
+	exprs := append([]string(nil), defn.SecExprs...)
+	if defn.WhereExpr != "" {
+		exprs = append(exprs, defn.WhereExpr)
+	}
+	if present, _, err := qu.GetXATTRNames(exprs); err != nil {
+		return nil, err
+	} else if present {
+		return nil, ErrUnsupportedIndex
+	}
+
+	ev := &evaluator{
+		defn:      defn,
+		codec:     collatejson.NewCodec(16),
+		encodeBuf: make([]byte, 0, 1024),
+	}
+	if defn.IsPrimary {
+		return ev, nil
+	}
+
+	var err error
+	if ev.skExprs, err = protoProjector.CompileN1QLExpression(defn.SecExprs); err != nil {
+		return nil, err
+	}
+	if defn.WhereExpr != "" {
+		cExprs, err := protoProjector.CompileN1QLExpression([]string{defn.WhereExpr})
+		if err != nil {
+			return nil, err
+		}
+		ev.whExpr = cExprs[0]
+	}
+	if defn.IsArrayIndex {
+		ev.isArray, _, ev.arrayPos, err = qu.GetArrayExpressionPosition(defn.SecExprs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ev, nil
+}
+
+// keys returns the sorted set of normalized secondary keys for the
+// document in mutation `m`, nil if the document is not indexed.
+func (ev *evaluator) keys(m *mc.DcpEvent) ([]string, error) {
+	if ev.defn.IsPrimary {
+		return []string{""}, nil
+	}
+
+	var nvalue qvalue.Value
+	if m.IsJSON() {
+		nvalue = qvalue.NewParsedValueWithOptions(m.Value, true, true)
+	} else {
+		nvalue = qvalue.NewBinaryValue(m.Value)
+	}
+	docval := qvalue.NewAnnotatedValue(nvalue)
+	docval.SetAttachment("meta", map[string]interface{}{
+		"id":         string(m.Key),
+		"byseqno":    m.Seqno,
+		"revseqno":   m.RevSeqno,
+		"flags":      m.Flags,
+		"expiration": m.Expiry,
+		"locktime":   m.LockTime,
+		"nru":        m.Nru,
+		"cas":        m.Cas,
+	})
+	context := qexpr.NewIndexContext()
+
+	if ev.whExpr != nil {
+		out, _, err := protoProjector.N1QLTransform(
+			nil, docval, context, []interface{}{ev.whExpr}, nil, ev.encodeBuf, nil)
+		if err != nil || string(out) != "true" {
+			return nil, nil
+		}
+	}
+
+	key, newBuf, err := protoProjector.N1QLTransform(
+		m.Key, docval, context, ev.skExprs, nil, ev.encodeBuf, nil)
+	if cap(newBuf) > cap(ev.encodeBuf) {
+		ev.encodeBuf = newBuf[:0]
+	}
+	if err != nil || key == nil {
+		return nil, err
+	}
+
+	var items [][]byte
+	if ev.isArray {
+		if items, err = ev.explodeArray(key); err != nil {
+			return nil, err
+		}
+	} else {
+		items = [][]byte{key}
+	}
+
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		k, err := ev.normalizeCJson(item)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return uniqueKeys(keys), nil
+}
+
+// explodeArray expands the array expression of a composite key into
+// one key per array item, as indexer stores them.
+func (ev *evaluator) explodeArray(key []byte) ([][]byte, error) {
+	tmp := make([]byte, 0, len(key)*3)
+	fields, err := ev.codec.ExplodeArray4(key, tmp)
+	if err != nil {
+		return nil, err
+	}
+	items, err := ev.codec.ExplodeArray4(fields[ev.arrayPos], tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([][]byte, 0, len(items))
+	for _, item := range items {
+		parts := make([][]byte, len(fields))
+		copy(parts, fields)
+		parts[ev.arrayPos] = item
+		k, err := ev.codec.JoinArray(parts, nil)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// normalizeCJson re-encodes a collatejson key through its JSON form,
+// so keys received from indexer and keys computed here compare
+// byte-wise irrespective of how numbers were encoded.
+func (ev *evaluator) normalizeCJson(code []byte) (string, error) {
+	text := make([]byte, 0, len(code)*3+collatejson.MinBufferSize)
+	text, err := ev.codec.Decode(code, text)
+	if err != nil {
+		return "", err
+	}
+	return ev.normalizeJSON(text)
+}
+
+func (ev *evaluator) normalizeJSON(text []byte) (string, error) {
+	code := make([]byte, 0, len(text)*3+collatejson.MinBufferSize)
+	code, err := ev.codec.Encode(text, code)
+	if err != nil {
+		return "", err
+	}
+	return string(code), nil
+}
+
+// keyJSON returns the JSON form of a normalized key, for reporting.
+func (ev *evaluator) keyJSON(key string) string {
+	if ev.defn.IsPrimary {
+		return ""
+	}
+	text := make([]byte, 0, len(key)*3+collatejson.MinBufferSize)
+	text, err := ev.codec.Decode([]byte(key), text)
+	if err != nil {
+		return err.Error()
+	}
+	return string(text)
+}
+
+func uniqueKeys(keys []string) []string {
+	sort.Strings(keys)
+	out := keys[:0]
+	for i, k := range keys {
+		if i == 0 || k != keys[i-1] {
+			out = append(out, k)
+		}
+	}
+	return out
+}
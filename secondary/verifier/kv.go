@@ -0,0 +1,91 @@
+package verifier
+
+import (
+	"fmt"
+
+	couchbase "github.com/couchbase/indexing/secondary/dcp"
+	mcd "github.com/couchbase/indexing/secondary/dcp/transport"
+	mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+const dcpOpaque = uint16(0xBEEF)
+
+// streamVbuckets streams mutations of every vbucket `vb` in the
+// seqno range (from[vb], to[vb]] and calls `callb` for each mutation,
+// deletion and expiry, in seqno order within the vbucket. Returns
+// once all streams have ended. A stream request is rejected by KV if
+// the vbucket failed over since `vbuuids` were sampled.
+func streamVbuckets(
+	b *couchbase.Bucket, name string, vbuuids, from, to []uint64,
+	config map[string]interface{}, callb func(m *mc.DcpEvent) error) error {
+
+	dcpConfig := map[string]interface{}{
+		"genChanSize":    config["genChanSize"],
+		"dataChanSize":   config["dataChanSize"],
+		"numConnections": config["numConnections"],
+		"activeVbOnly":   true,
+	}
+	feed, err := b.StartDcpFeed(
+		couchbase.NewDcpFeedName(name), uint32(0), uint32(0), dcpOpaque,
+		dcpConfig)
+	if err != nil {
+		return err
+	}
+	defer feed.Close()
+
+	// end of the last snapshot received, per vbucket.
+	snapEnds := make(map[uint16]uint64)
+
+	pending := 0
+	for vb := range to {
+		if to[vb] <= from[vb] {
+			continue
+		}
+		err := feed.DcpRequestStream(
+			uint16(vb), dcpOpaque, uint32(0), vbuuids[vb], from[vb], to[vb],
+			from[vb], from[vb])
+		if err != nil {
+			return fmt.Errorf("stream request for vbucket %v: %v", vb, err)
+		}
+		pending++
+	}
+
+	for pending > 0 {
+		m, ok := <-feed.C
+		if !ok {
+			return ErrFeedClosed
+		}
+
+		switch m.Opcode {
+		case mcd.DCP_STREAMREQ:
+			if m.Status != mcd.SUCCESS {
+				return fmt.Errorf("stream request for vbucket %v: %v",
+					m.VBucket, m.Status)
+			}
+
+		case mcd.DCP_SNAPSHOT:
+			snapEnds[m.VBucket] = m.SnapendSeq
+
+		case mcd.DCP_MUTATION, mcd.DCP_DELETION, mcd.DCP_EXPIRATION:
+			if m.IsSnappy() {
+				if _, err := m.Inflate(); err != nil {
+					return err
+				}
+			}
+			if err := callb(m); err != nil {
+				return err
+			}
+
+		case mcd.DCP_STREAMEND:
+			if snapEnds[m.VBucket] < to[m.VBucket] {
+				return fmt.Errorf("stream for vbucket %v ended at %v, before %v",
+					m.VBucket, snapEnds[m.VBucket], to[m.VBucket])
+			}
+			pending--
+			logging.Debugf("Verifier: vbucket %v streamed, %v pending",
+				m.VBucket, pending)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package verifier
+
+import (
+	"fmt"
+
+	couchbase "github.com/couchbase/indexing/secondary/dcp"
+	mcd "github.com/couchbase/indexing/secondary/dcp/transport"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+// kvStore is the subset of bucket operations used by repair.
+type kvStore interface {
+	GetsRaw(k string) (data []byte, flags int, cas uint64, err error)
+	AddRawCas(k string, exp int, v []byte) (cas uint64, added bool, err error)
+	DeleteCas(k string, cas uint64) error
+	WriteCas(k string, flags, exp int, cas uint64, v interface{},
+		opt couchbase.WriteOptions) error
+}
+
+// Repair re-injects a mutation in KV for every document in `report`,
+// which flows through projector to all indexes of the bucket and
+// replaces the document's entries in them.
+//
+// A document present in KV is written back with its own value, flags
+// and expiry, under CAS so that a concurrent update is not lost. A
+// document absent in KV is added and deleted, so that a deletion is
+// streamed for it. The deletion is under the CAS of the add, so that
+// a document written concurrently is not deleted. The deletion leaves
+// a tombstone in KV, like any other deletion, until the bucket's
+// metadata purge. Returns the number of documents repaired.
+func Repair(b *couchbase.Bucket, report *Report) (int, error) {
+	return repair(b, report)
+}
+
+func repair(kv kvStore, report *Report) (int, error) {
+	repaired := 0
+	for _, docid := range report.DocIds() {
+		ok, err := repairDoc(kv, docid, report.expiry[docid])
+		if err != nil {
+			return repaired, fmt.Errorf("repair %q: %v", docid, err)
+		} else if ok {
+			repaired++
+		}
+	}
+	logging.Infof("Verifier[%v:%v] repaired %v documents",
+		report.Bucket, report.Index, repaired)
+	return repaired, nil
+}
+
+// repairDoc returns false if the document was mutated concurrently,
+// in which case it needs no repair.
+func repairDoc(kv kvStore, docid string, expiry uint32) (bool, error) {
+	data, flags, cas, err := kv.GetsRaw(docid)
+	if isStatus(err, mcd.KEY_ENOENT) {
+		cas, added, err := kv.AddRawCas(docid, 0, []byte("{}"))
+		if err != nil || !added {
+			return false, err
+		}
+		err = kv.DeleteCas(docid, cas)
+		if isStatus(err, mcd.KEY_EEXISTS) || isStatus(err, mcd.KEY_ENOENT) {
+			return false, nil
+		}
+		return err == nil, err
+	} else if err != nil {
+		return false, err
+	}
+
+	err = kv.WriteCas(docid, flags, int(expiry), cas, data, couchbase.Raw)
+	if isStatus(err, mcd.KEY_EEXISTS) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func isStatus(err error, status mcd.Status) bool {
+	res, ok := err.(*mcd.MCResponse)
+	return ok && res.Status == status
+}
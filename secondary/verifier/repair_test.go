@@ -0,0 +1,159 @@
+package verifier
+
+import (
+	"testing"
+
+	couchbase "github.com/couchbase/indexing/secondary/dcp"
+	mcd "github.com/couchbase/indexing/secondary/dcp/transport"
+)
+
+type testDoc struct {
+	data   []byte
+	flags  int
+	expiry int
+	cas    uint64
+}
+
+// testKV is an in-memory bucket, `after` is called after a document is
+// read or added, to mutate it concurrently with repair.
+type testKV struct {
+	docs    map[string]*testDoc
+	cas     uint64
+	deletes []string
+	after   func(op, docid string)
+}
+
+func newTestKV() *testKV {
+	return &testKV{docs: make(map[string]*testDoc)}
+}
+
+func (kv *testKV) set(docid string, data []byte, flags, expiry int) {
+	kv.cas++
+	kv.docs[docid] = &testDoc{data: data, flags: flags, expiry: expiry, cas: kv.cas}
+}
+
+func (kv *testKV) GetsRaw(k string) ([]byte, int, uint64, error) {
+	doc, ok := kv.docs[k]
+	if !ok {
+		return nil, 0, 0, &mcd.MCResponse{Status: mcd.KEY_ENOENT}
+	}
+	if kv.after != nil {
+		defer kv.after("get", k)
+	}
+	return doc.data, doc.flags, doc.cas, nil
+}
+
+func (kv *testKV) AddRawCas(k string, exp int, v []byte) (uint64, bool, error) {
+	if _, ok := kv.docs[k]; ok {
+		return 0, false, nil
+	}
+	kv.set(k, v, 0, exp)
+	cas := kv.cas
+	if kv.after != nil {
+		kv.after("add", k)
+	}
+	return cas, true, nil
+}
+
+func (kv *testKV) DeleteCas(k string, cas uint64) error {
+	doc, ok := kv.docs[k]
+	if !ok {
+		return &mcd.MCResponse{Status: mcd.KEY_ENOENT}
+	} else if doc.cas != cas {
+		return &mcd.MCResponse{Status: mcd.KEY_EEXISTS}
+	}
+	delete(kv.docs, k)
+	kv.deletes = append(kv.deletes, k)
+	return nil
+}
+
+func (kv *testKV) WriteCas(k string, flags, exp int, cas uint64, v interface{},
+	opt couchbase.WriteOptions) error {
+
+	doc, ok := kv.docs[k]
+	if !ok {
+		return &mcd.MCResponse{Status: mcd.KEY_ENOENT}
+	} else if doc.cas != cas {
+		return &mcd.MCResponse{Status: mcd.KEY_EEXISTS}
+	}
+	kv.set(k, v.([]byte), flags, exp)
+	return nil
+}
+
+func TestRepair(t *testing.T) {
+	kv := newTestKV()
+	kv.set("doc1", []byte(`{"a":1}`), 5, 0)
+	kv.set("doc2", []byte(`{"a":2}`), 0, 0)
+
+	report := &Report{
+		Missing:    []Entry{{DocId: "doc1"}},
+		Extra:      []Entry{{DocId: "doc3"}},
+		Mismatched: []Mismatch{{DocId: "doc2"}},
+		expiry:     map[string]uint32{"doc2": 1000},
+	}
+	cas1, cas2 := kv.docs["doc1"].cas, kv.docs["doc2"].cas
+
+	repaired, err := repair(kv, report)
+	if err != nil {
+		t.Fatal(err)
+	} else if repaired != 3 {
+		t.Errorf("expected 3 documents repaired, got %v", repaired)
+	}
+
+	// documents present are written back with their value, flags and expiry
+	if doc := kv.docs["doc1"]; doc.cas == cas1 || string(doc.data) != `{"a":1}` || doc.flags != 5 {
+		t.Errorf("unexpected doc1 %+v", doc)
+	}
+	if doc := kv.docs["doc2"]; doc.cas == cas2 || doc.expiry != 1000 {
+		t.Errorf("unexpected doc2 %+v", doc)
+	}
+
+	// document absent is added and deleted
+	if _, ok := kv.docs["doc3"]; ok {
+		t.Errorf("expected doc3 to be deleted")
+	}
+	if len(kv.deletes) != 1 || kv.deletes[0] != "doc3" {
+		t.Errorf("expected deletion of doc3, got %v", kv.deletes)
+	}
+}
+
+func TestRepairConcurrent(t *testing.T) {
+	kv := newTestKV()
+
+	// document written after it was added by repair is not deleted
+	kv.after = func(op, docid string) {
+		kv.set(docid, []byte(`{"new":true}`), 0, 0)
+	}
+	ok, err := repairDoc(kv, "doc1", 0)
+	if err != nil || ok {
+		t.Errorf("expected no repair for concurrent write, got %v %v", ok, err)
+	}
+	if doc, found := kv.docs["doc1"]; !found || string(doc.data) != `{"new":true}` {
+		t.Errorf("expected concurrent write to be preserved, got %+v", doc)
+	}
+	if len(kv.deletes) != 0 {
+		t.Errorf("unexpected deletes %v", kv.deletes)
+	}
+
+	// document deleted after it was added by repair
+	kv.after = func(op, docid string) {
+		delete(kv.docs, docid)
+	}
+	if ok, err := repairDoc(kv, "doc2", 0); err != nil || ok {
+		t.Errorf("expected no repair for concurrent delete, got %v %v", ok, err)
+	}
+
+	// document updated between read and write back
+	kv.after = nil
+	kv.set("doc3", []byte(`{"a":1}`), 0, 0)
+	kv.after = func(op, docid string) {
+		kv.after = nil
+		kv.set(docid, []byte(`{"a":2}`), 0, 0)
+	}
+	if ok, err := repairDoc(kv, "doc3", 0); err != nil || ok {
+		t.Errorf("expected no repair for concurrent update, got %v %v", ok, err)
+	}
+	if doc := kv.docs["doc3"]; string(doc.data) != `{"a":2}` {
+		t.Errorf("expected concurrent update to be preserved, got %s", doc.data)
+	}
+}
@@ -0,0 +1,376 @@
+// Package verifier checks an index against the KV data it is built
+// from. The bucket is streamed over DCP up to a timestamp, index keys
+// are computed for every document with the same N1QL evaluation used
+// by projector and compared with the index scanned at a snapshot
+// that is consistent with the timestamp. Documents found to be
+// missing, extra or mismatched in the index can be repaired by
+// re-injecting a mutation for them in KV.
+//
+// Expected and scanned entries are held in memory, hence memory
+// requirement is proportional to the number of documents in the
+// bucket.
+package verifier
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/common/json"
+	couchbase "github.com/couchbase/indexing/secondary/dcp"
+	mcd "github.com/couchbase/indexing/secondary/dcp/transport"
+	mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
+	"github.com/couchbase/indexing/secondary/logging"
+	qclient "github.com/couchbase/indexing/secondary/queryport/client"
+)
+
+var (
+	ErrIndexNotFound    = errors.New("verifier: index not found")
+	ErrUnsupportedIndex = errors.New("verifier: index not supported for verification")
+	ErrFeedClosed       = errors.New("verifier: DCP feed closed")
+)
+
+// Config for verifying an index.
+type Config struct {
+	Bucket string
+	Index  string
+
+	// DCP feed settings, "genChanSize", "dataChanSize" and
+	// "numConnections". DefaultDcpConfig() is used if nil.
+	DcpConfig map[string]interface{}
+}
+
+// DefaultDcpConfig returns DCP feed settings suitable for streaming
+// a bucket from a tool.
+func DefaultDcpConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"genChanSize":    10000,
+		"dataChanSize":   10000,
+		"numConnections": 4,
+	}
+}
+
+// Entry of a document in the index, keys are JSON encoded secondary
+// keys, empty for primary index.
+type Entry struct {
+	DocId string   `json:"docid"`
+	Keys  []string `json:"keys,omitempty"`
+}
+
+// Mismatch of a document whose entries in the index differ from the
+// entries computed from KV.
+type Mismatch struct {
+	DocId    string   `json:"docid"`
+	Expected []string `json:"expected"`
+	Actual   []string `json:"actual"`
+}
+
+// Report of a verification run.
+type Report struct {
+	Bucket     string     `json:"bucket"`
+	Index      string     `json:"index"`
+	NumDocs    int        `json:"numDocs"`    // documents to index, per KV
+	NumIndexed int        `json:"numIndexed"` // documents found in index
+	NumSkipped int        `json:"numSkipped"` // mutated while verifying
+	Missing    []Entry    `json:"missing"`
+	Extra      []Entry    `json:"extra"`
+	Mismatched []Mismatch `json:"mismatched"`
+	Elapsed    string     `json:"elapsed"`
+
+	// expiry of documents in the report, preserved on repair.
+	expiry map[string]uint32
+}
+
+// Consistent returns true if no discrepancy was found.
+func (r *Report) Consistent() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Mismatched) == 0
+}
+
+// DocIds returns the documents with a discrepancy.
+func (r *Report) DocIds() []string {
+	docids := make([]string, 0, len(r.Missing)+len(r.Extra)+len(r.Mismatched))
+	for _, e := range r.Missing {
+		docids = append(docids, e.DocId)
+	}
+	for _, e := range r.Extra {
+		docids = append(docids, e.DocId)
+	}
+	for _, m := range r.Mismatched {
+		docids = append(docids, m.DocId)
+	}
+	return docids
+}
+
+// Verify index `config.Index` of bucket `b` against the documents in
+// the bucket.
+func Verify(
+	client *qclient.GsiClient, b *couchbase.Bucket,
+	config *Config) (*Report, error) {
+
+	start := time.Now()
+	prefix := fmt.Sprintf("Verifier[%v:%v]", config.Bucket, config.Index)
+
+	defn, err := findIndex(client, config.Bucket, config.Index)
+	if err != nil {
+		return nil, err
+	}
+	ev, err := newEvaluator(defn)
+	if err != nil {
+		return nil, err
+	}
+
+	maxvb, err := c.MaxVbuckets(b)
+	if err != nil {
+		return nil, err
+	}
+	seqnos, vbuuids, err := c.BucketTs(b, maxvb)
+	if err != nil {
+		return nil, err
+	}
+
+	dcpConfig := config.DcpConfig
+	if dcpConfig == nil {
+		dcpConfig = DefaultDcpConfig()
+	}
+
+	report := &Report{
+		Bucket: config.Bucket,
+		Index:  config.Index,
+		expiry: make(map[string]uint32),
+	}
+
+	// documents and their index keys as of timestamp `seqnos`, and
+	// documents that carry an expiry.
+	expected := make(map[string][]string)
+	expiry := make(map[string]uint32)
+	feedName := fmt.Sprintf("verifier-%v-%v", defn.DefnId, start.UnixNano())
+	logging.Infof("%v streaming bucket upto %v", prefix, seqnos)
+	err = streamVbuckets(
+		b, feedName, vbuuids, make([]uint64, maxvb), seqnos, dcpConfig,
+		func(m *mc.DcpEvent) error {
+			docid := string(m.Key)
+			delete(expiry, docid)
+			if m.Opcode != mcd.DCP_MUTATION {
+				delete(expected, docid)
+				return nil
+			} else if m.Expiry != 0 {
+				expiry[docid] = m.Expiry
+			}
+			keys, err := ev.keys(m)
+			if err != nil {
+				return err
+			} else if keys == nil {
+				delete(expected, docid)
+				return nil
+			}
+			expected[docid] = keys
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	report.NumDocs = len(expected)
+
+	logging.Infof("%v scanning index", prefix)
+	actual, err := scanIndex(client, ev, uint64(defn.DefnId), seqnos, vbuuids)
+	if err != nil {
+		return nil, err
+	}
+	report.NumIndexed = len(actual)
+
+	// index is scanned at a snapshot that is atleast as recent as the
+	// timestamp, documents mutated after the timestamp cannot be
+	// verified.
+	seqnos2, _, err := c.BucketTs(b, maxvb)
+	if err != nil {
+		return nil, err
+	}
+	inflight := make(map[string]bool)
+	err = streamVbuckets(
+		b, feedName+"-inflight", vbuuids, seqnos, seqnos2, dcpConfig,
+		func(m *mc.DcpEvent) error {
+			inflight[string(m.Key)] = true
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	compare(ev, report, expected, actual, inflight)
+	for _, docid := range report.DocIds() {
+		if exp, ok := expiry[docid]; ok {
+			report.expiry[docid] = exp
+		}
+	}
+	report.Elapsed = time.Since(start).String()
+
+	logging.Infof("%v done, missing:%v extra:%v mismatched:%v skipped:%v elapsed:%v",
+		prefix, len(report.Missing), len(report.Extra), len(report.Mismatched),
+		report.NumSkipped, report.Elapsed)
+	return report, nil
+}
+
+func compare(
+	ev *evaluator, report *Report, expected map[string][]string,
+	actual map[string][]string, inflight map[string]bool) {
+
+	toJSON := func(keys []string) []string {
+		out := make([]string, 0, len(keys))
+		for _, key := range keys {
+			if s := ev.keyJSON(key); s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+
+	skipped := make(map[string]bool)
+	for docid, keys1 := range expected {
+		if inflight[docid] {
+			skipped[docid] = true
+			continue
+		}
+		keys2, ok := actual[docid]
+		if !ok {
+			report.Missing = append(report.Missing,
+				Entry{DocId: docid, Keys: toJSON(keys1)})
+		} else if !equalKeys(keys1, keys2) {
+			report.Mismatched = append(report.Mismatched, Mismatch{
+				DocId:    docid,
+				Expected: toJSON(keys1),
+				Actual:   toJSON(keys2),
+			})
+		}
+	}
+	for docid, keys := range actual {
+		if _, ok := expected[docid]; ok {
+			continue
+		} else if inflight[docid] {
+			skipped[docid] = true
+			continue
+		}
+		report.Extra = append(report.Extra, Entry{DocId: docid, Keys: toJSON(keys)})
+	}
+	report.NumSkipped = len(skipped)
+
+	sort.Sort(entriesByDocId(report.Missing))
+	sort.Sort(entriesByDocId(report.Extra))
+	sort.Sort(mismatchesByDocId(report.Mismatched))
+}
+
+type entriesByDocId []Entry
+
+func (s entriesByDocId) Len() int           { return len(s) }
+func (s entriesByDocId) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s entriesByDocId) Less(i, j int) bool { return s[i].DocId < s[j].DocId }
+
+type mismatchesByDocId []Mismatch
+
+func (s mismatchesByDocId) Len() int           { return len(s) }
+func (s mismatchesByDocId) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s mismatchesByDocId) Less(i, j int) bool { return s[i].DocId < s[j].DocId }
+
+// scanIndex returns the normalized keys of every document in the
+// index, scanned at a snapshot satisfying timestamp {seqnos,vbuuids}.
+func scanIndex(
+	client *qclient.GsiClient, ev *evaluator, defnID uint64,
+	seqnos, vbuuids []uint64) (map[string][]string, error) {
+
+	vbnos := make([]uint16, len(seqnos))
+	for i := range vbnos {
+		vbnos[i] = uint16(i)
+	}
+	vector := qclient.NewTsConsistency(vbnos, seqnos, vbuuids)
+
+	var mu sync.Mutex
+	var scanErr error
+	actual := make(map[string][]string)
+	dataEncFmt := client.GetDataEncodingFormat()
+
+	callb := func(resp qclient.ResponseReader) bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err := resp.Error(); err != nil {
+			scanErr = err
+			return false
+		}
+		skeys, pkeys, err := resp.GetEntries(dataEncFmt)
+		if err != nil {
+			scanErr = err
+			return false
+		}
+		for i, pkey := range pkeys {
+			var key string
+			if !ev.defn.IsPrimary {
+				skey, err := skeys.GetkthKey(i)
+				if err == nil {
+					key, err = normalizeScanKey(ev, skey)
+				}
+				if err != nil {
+					scanErr = err
+					return false
+				}
+			}
+			actual[string(pkey)] = append(actual[string(pkey)], key)
+		}
+		return true
+	}
+
+	err := client.ScanAll(
+		defnID, "", math.MaxInt64, c.QueryConsistency, vector, callb)
+	if err == nil {
+		err = scanErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for docid, keys := range actual {
+		actual[docid] = uniqueKeys(keys)
+	}
+	return actual, nil
+}
+
+func normalizeScanKey(ev *evaluator, skey c.ScanResultKey) (string, error) {
+	if skey.DataEncFmt == c.DATA_ENC_COLLATEJSON {
+		return ev.normalizeCJson(skey.Skeycjson)
+	}
+	text, err := json.Marshal(skey.Skey)
+	if err != nil {
+		return "", err
+	}
+	return ev.normalizeJSON(text)
+}
+
+func findIndex(
+	client *qclient.GsiClient, bucket, name string) (*c.IndexDefn, error) {
+
+	indexes, _, _, err := client.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		defn := index.Definition
+		if defn.Bucket == bucket && defn.Name == name {
+			return defn, nil
+		}
+	}
+	return nil, ErrIndexNotFound
+}
+
+func equalKeys(keys1, keys2 []string) bool {
+	if len(keys1) != len(keys2) {
+		return false
+	}
+	for i := range keys1 {
+		if keys1[i] != keys2[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package verifier
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/collatejson"
+	c "github.com/couchbase/indexing/secondary/common"
+)
+
+func TestCompare(t *testing.T) {
+	ev := &evaluator{defn: &c.IndexDefn{}, codec: collatejson.NewCodec(16)}
+	key := func(s string) string {
+		k, err := ev.normalizeJSON([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	expected := map[string][]string{
+		"doc1": {key(`["a"]`)},
+		"doc2": {key(`["b"]`)},
+		"doc3": {key(`["c"]`), key(`["d"]`)},
+		"doc4": {key(`["e"]`)},
+	}
+	actual := map[string][]string{
+		"doc1": {key(`["a"]`)},
+		"doc3": {key(`["c"]`)},
+		"doc4": {key(`["x"]`)},
+		"doc5": {key(`["f"]`)},
+		"doc6": {key(`["g"]`)},
+	}
+	inflight := map[string]bool{"doc4": true, "doc6": true}
+
+	report := &Report{}
+	compare(ev, report, expected, actual, inflight)
+
+	if !reflect.DeepEqual(report.Missing, []Entry{{DocId: "doc2", Keys: []string{`["b"]`}}}) {
+		t.Errorf("unexpected missing %v", report.Missing)
+	}
+	if !reflect.DeepEqual(report.Extra, []Entry{{DocId: "doc5", Keys: []string{`["f"]`}}}) {
+		t.Errorf("unexpected extra %v", report.Extra)
+	}
+	mismatch := Mismatch{DocId: "doc3", Expected: []string{`["c"]`, `["d"]`}, Actual: []string{`["c"]`}}
+	if !reflect.DeepEqual(report.Mismatched, []Mismatch{mismatch}) {
+		t.Errorf("unexpected mismatched %v", report.Mismatched)
+	}
+	if report.NumSkipped != 2 {
+		t.Errorf("expected 2 documents mutated while verifying, got %v", report.NumSkipped)
+	}
+	if report.Consistent() {
+		t.Errorf("expected report to be inconsistent")
+	}
+	if docids := report.DocIds(); !reflect.DeepEqual(docids, []string{"doc2", "doc5", "doc3"}) {
+		t.Errorf("unexpected docids %v", docids)
+	}
+}
+
+func TestComparePrimary(t *testing.T) {
+	ev := &evaluator{defn: &c.IndexDefn{IsPrimary: true}, codec: collatejson.NewCodec(16)}
+	expected := map[string][]string{"doc1": {""}, "doc2": {""}}
+	actual := map[string][]string{"doc1": {""}, "doc3": {""}}
+
+	report := &Report{}
+	compare(ev, report, expected, actual, nil)
+	if !reflect.DeepEqual(report.Missing, []Entry{{DocId: "doc2", Keys: []string{}}}) ||
+		!reflect.DeepEqual(report.Extra, []Entry{{DocId: "doc3", Keys: []string{}}}) ||
+		len(report.Mismatched) != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	report = &Report{}
+	compare(ev, report, expected, map[string][]string{"doc1": {""}, "doc2": {""}}, nil)
+	if !report.Consistent() {
+		t.Errorf("expected report to be consistent %+v", report)
+	}
+}
+
+func TestUniqueKeys(t *testing.T) {
+	keys := uniqueKeys([]string{"b", "a", "b", "c", "a"})
+	if !reflect.DeepEqual(keys, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	if !equalKeys(keys, []string{"a", "b", "c"}) || equalKeys(keys, []string{"a", "b"}) {
+		t.Errorf("equalKeys failed")
+	}
+}